@@ -0,0 +1,91 @@
+package admissionctrl
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// CanaryValidator enforces a validator only for a share of the jobs, for all
+// other jobs its errors are reported as warnings (audit only).
+// The share is picked by hashing the rule name, namespace and job ID, so a job
+// keeps getting the same treatment on every submission while the percentage is unchanged.
+type CanaryValidator struct {
+	validator JobValidator
+	percent   float64
+	logger    hclog.Logger
+}
+
+func NewCanaryValidator(validator JobValidator, percent float64, logger hclog.Logger) (*CanaryValidator, error) {
+	if percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("canary percent of %s must be between 0 and 100", validator.Name())
+	}
+	return &CanaryValidator{
+		validator: validator,
+		percent:   percent,
+		logger:    logger,
+	}, nil
+}
+
+func (c *CanaryValidator) Name() string {
+	return c.validator.Name()
+}
+
+// Unwrap returns the wrapped validator.
+func (c *CanaryValidator) Unwrap() JobValidator {
+	return c.validator
+}
+
+func (c *CanaryValidator) Validate(payload *types.Payload) ([]error, error) {
+	return c.ValidateContext(context.Background(), payload)
+}
+
+func (c *CanaryValidator) ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error) {
+	warnings, err := ValidateContext(ctx, c.validator, payload)
+	if err == nil || c.Enforced(payload.Job) {
+		return warnings, err
+	}
+	c.logger.Info("job would have been rejected, rule is audit only for this job", "rule", c.Name(), "job", jobID(payload.Job), "error", err)
+	errs := []error{err}
+	if merr, ok := err.(*multierror.Error); ok {
+		errs = merr.Errors
+	}
+	for _, e := range errs {
+		warnings = append(warnings, fmt.Errorf("%s (audit only, not enforced for this job): %w", c.Name(), e))
+	}
+	return warnings, nil
+}
+
+// Enforced reports whether the job falls into the enforced share.
+func (c *CanaryValidator) Enforced(job *api.Job) bool {
+	if c.percent >= 100 {
+		return true
+	}
+	return float64(c.bucket(job))/100 < c.percent
+}
+
+// bucket maps the job to one of 10000 buckets.
+func (c *CanaryValidator) bucket(job *api.Job) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", c.Name(), namespaceOf(job), jobID(job))
+	return h.Sum32() % 10000
+}
+
+func jobID(job *api.Job) string {
+	if job.ID == nil {
+		return ""
+	}
+	return *job.ID
+}
+
+func namespaceOf(job *api.Job) string {
+	if job.Namespace != nil && *job.Namespace != "" {
+		return *job.Namespace
+	}
+	return api.DefaultNamespace
+}
@@ -0,0 +1,97 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanaryValidator(t *testing.T) {
+	rejecting := new(testutil.MockValidator)
+	rejecting.On("Validate", mock.Anything).Return([]error{fmt.Errorf("existing warning")},
+		multierror.Append(nil, fmt.Errorf("missing owner"), fmt.Errorf("missing team")))
+
+	tt := []struct {
+		name         string
+		percent      float64
+		wantEnforced bool
+	}{
+		{name: "enforced for all", percent: 100, wantEnforced: true},
+		{name: "audit only for all", percent: 0, wantEnforced: false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			canary, err := NewCanaryValidator(rejecting, tc.percent, hclog.NewNullLogger())
+			require.NoError(t, err)
+			assert.Equal(t, "mock-validator", canary.Name())
+
+			warnings, err := canary.Validate(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+			if tc.wantEnforced {
+				assert.ErrorContains(t, err, "missing owner")
+				assert.Len(t, warnings, 1)
+			} else {
+				assert.NoError(t, err)
+				require.Len(t, warnings, 3)
+				assert.EqualError(t, warnings[1], "mock-validator (audit only, not enforced for this job): missing owner")
+				assert.EqualError(t, warnings[2], "mock-validator (audit only, not enforced for this job): missing team")
+			}
+		})
+	}
+}
+
+func TestCanaryValidatorSampling(t *testing.T) {
+	validator := new(testutil.MockValidator)
+	canary, err := NewCanaryValidator(validator, 25, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	enforced := 0
+	for i := 0; i < 4000; i++ {
+		job := &api.Job{ID: pointer(fmt.Sprintf("job-%d", i))}
+		first := canary.Enforced(job)
+		assert.Equal(t, first, canary.Enforced(job), "decision is stable for a job")
+		if first {
+			enforced++
+		}
+	}
+	assert.InDelta(t, 1000, enforced, 150, "about a quarter of the jobs are enforced")
+
+	job := &api.Job{ID: pointer("job-1")}
+	other := &api.Job{ID: pointer("job-1"), Namespace: pointer("other")}
+	assert.Equal(t, canary.bucket(job), canary.bucket(&api.Job{ID: pointer("job-1"), Namespace: pointer("default")}), "empty namespace is the default namespace")
+	assert.NotEqual(t, canary.bucket(job), canary.bucket(other), "namespace is part of the hash")
+
+	wider, err := NewCanaryValidator(validator, 50, hclog.NewNullLogger())
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		job := &api.Job{ID: pointer(fmt.Sprintf("job-%d", i))}
+		if canary.Enforced(job) {
+			assert.True(t, wider.Enforced(job), "raising the percentage keeps enforcing already enforced jobs")
+		}
+	}
+}
+
+func TestCanaryValidatorPassesThroughSuccess(t *testing.T) {
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf("warning")}, nil)
+	canary, err := NewCanaryValidator(validator, 0, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	warnings, err := canary.Validate(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+
+	_, err = NewCanaryValidator(validator, -1, hclog.NewNullLogger())
+	assert.Error(t, err)
+}
+
+func pointer[T any](v T) *T {
+	return &v
+}
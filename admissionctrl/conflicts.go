@@ -0,0 +1,171 @@
+package admissionctrl
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// ConflictStrategy decides what happens when a mutator changes a path of the job an earlier mutator already changed.
+type ConflictStrategy string
+
+const (
+	// ConflictFail rejects the job
+	ConflictFail ConflictStrategy = "fail"
+	// ConflictFirstWins reverts the changes of the later mutator on the conflicting paths and warns about it
+	ConflictFirstWins ConflictStrategy = "first_wins"
+	// ConflictLastWins keeps the changes of the later mutator and warns about it
+	ConflictLastWins ConflictStrategy = "last_wins"
+)
+
+// UseConflictStrategy detects mutators changing the same paths of a job, without a strategy the last mutator silently wins.
+func (j *JobHandler) UseConflictStrategy(strategy ConflictStrategy) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.conflicts = strategy
+}
+
+func (j *JobHandler) conflictStrategy() ConflictStrategy {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.conflicts
+}
+
+// changeTracker remembers which mutator changed which path of the job during one pass of the mutators.
+type changeTracker struct {
+	strategy ConflictStrategy
+	// owners maps JSON pointers to the mutator that changed them
+	owners map[string]string
+}
+
+func newChangeTracker(strategy ConflictStrategy) *changeTracker {
+	return &changeTracker{strategy: strategy, owners: map[string]string{}}
+}
+
+// track records the changes of the mutator from before to the job and applies the strategy to conflicting changes.
+func (t *changeTracker) track(mutator string, before []byte, job *api.Job) (*api.Job, []error, error) {
+	var beforeDoc, afterDoc interface{}
+	after, err := json.Marshal(job)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(before, &beforeDoc); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(after, &afterDoc); err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []error
+	var reverted bool
+	for _, path := range changedPaths(beforeDoc, afterDoc, "") {
+		owner, conflict := t.owner(path)
+		if !conflict {
+			t.owners[path] = mutator
+			continue
+		}
+		switch t.strategy {
+		case ConflictFail:
+			return nil, nil, fmt.Errorf("conflicting change at %s, mutator %s already changed it", path, owner)
+		case ConflictFirstWins:
+			afterDoc = revert(afterDoc, beforeDoc, splitPath(path))
+			reverted = true
+			warnings = append(warnings, fmt.Errorf("change of mutator %s at %s dropped, mutator %s changed it first", mutator, path, owner))
+		default:
+			t.owners[path] = mutator
+			warnings = append(warnings, fmt.Errorf("mutator %s overrides the change of mutator %s at %s", mutator, owner, path))
+		}
+	}
+	if !reverted {
+		return job, warnings, nil
+	}
+	data, err := json.Marshal(afterDoc)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolved := &api.Job{}
+	if err := json.Unmarshal(data, resolved); err != nil {
+		return nil, nil, err
+	}
+	return resolved, warnings, nil
+}
+
+// owner returns the mutator that changed the path, a parent or a child of it.
+func (t *changeTracker) owner(path string) (string, bool) {
+	paths := make([]string, 0, len(t.owners))
+	for owned := range t.owners {
+		if owned == path || strings.HasPrefix(path, owned+"/") || strings.HasPrefix(owned, path+"/") {
+			paths = append(paths, owned)
+		}
+	}
+	if len(paths) == 0 {
+		return "", false
+	}
+	sort.Strings(paths)
+	return t.owners[paths[0]], true
+}
+
+// changedPaths returns the JSON pointers of the values that differ, objects are compared field by field and anything else as a whole.
+func changedPaths(before, after interface{}, prefix string) []string {
+	beforeObject, beforeOK := before.(map[string]interface{})
+	afterObject, afterOK := after.(map[string]interface{})
+	// a missing object is empty, so mutators adding different fields to it don't conflict
+	if before == nil && afterOK {
+		beforeObject, beforeOK = map[string]interface{}{}, true
+	}
+	if after == nil && beforeOK {
+		afterObject, afterOK = map[string]interface{}{}, true
+	}
+	if !beforeOK || !afterOK {
+		if reflect.DeepEqual(before, after) {
+			return nil
+		}
+		return []string{prefix}
+	}
+	var paths []string
+	for key, value := range beforeObject {
+		paths = append(paths, changedPaths(value, afterObject[key], prefix+"/"+escapeKey(key))...)
+	}
+	for key, value := range afterObject {
+		if _, ok := beforeObject[key]; !ok {
+			paths = append(paths, changedPaths(nil, value, prefix+"/"+escapeKey(key))...)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// revert sets the value at the path of doc back to the one of original, it returns the updated doc.
+func revert(doc, original interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return original
+	}
+	docObject, ok := doc.(map[string]interface{})
+	if !ok {
+		return original
+	}
+	originalObject, _ := original.(map[string]interface{})
+	value, existed := originalObject[path[0]]
+	if len(path) == 1 && !existed {
+		delete(docObject, path[0])
+		return docObject
+	}
+	docObject[path[0]] = revert(docObject[path[0]], value, path[1:])
+	return docObject
+}
+
+func escapeKey(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+func splitPath(path string) []string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+	}
+	return segments
+}
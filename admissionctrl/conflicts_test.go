@@ -0,0 +1,105 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// labelMutator adds a meta label and keeps the others.
+type labelMutator struct {
+	name, key, value string
+}
+
+func (m *labelMutator) Name() string {
+	return m.name
+}
+
+func (m *labelMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	if payload.Job.Meta == nil {
+		payload.Job.Meta = map[string]string{}
+	}
+	payload.Job.Meta[m.key] = m.value
+	return payload.Job, nil, nil
+}
+
+func TestJobHandler_UseConflictStrategy(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategy     ConflictStrategy
+		mutators     []JobMutator
+		wantMeta     map[string]string
+		wantWarnings []error
+		wantErr      string
+	}{
+		{
+			name:     "no conflict",
+			strategy: ConflictFail,
+			mutators: []JobMutator{&labelMutator{name: "a", key: "team", value: "a"}, &labelMutator{name: "b", key: "owner", value: "b"}},
+			wantMeta: map[string]string{"team": "a", "owner": "b"},
+		},
+		{
+			name:     "fail",
+			strategy: ConflictFail,
+			mutators: []JobMutator{&labelMutator{name: "a", key: "owner", value: "a"}, &labelMutator{name: "b", key: "owner", value: "b"}},
+			wantErr:  "error in job mutator b: conflicting change at /Meta/owner, mutator a already changed it",
+		},
+		{
+			name:         "first wins",
+			strategy:     ConflictFirstWins,
+			mutators:     []JobMutator{&labelMutator{name: "a", key: "owner", value: "a"}, &labelMutator{name: "b", key: "owner", value: "b"}, &labelMutator{name: "c", key: "team", value: "c"}},
+			wantMeta:     map[string]string{"owner": "a", "team": "c"},
+			wantWarnings: []error{fmt.Errorf("change of mutator b at /Meta/owner dropped, mutator a changed it first")},
+		},
+		{
+			name:         "last wins",
+			strategy:     ConflictLastWins,
+			mutators:     []JobMutator{&labelMutator{name: "a", key: "owner", value: "a"}, &labelMutator{name: "b", key: "owner", value: "b"}},
+			wantMeta:     map[string]string{"owner": "b"},
+			wantWarnings: []error{fmt.Errorf("mutator b overrides the change of mutator a at /Meta/owner")},
+		},
+		{
+			name:     "replaced parent",
+			strategy: ConflictFail,
+			mutators: []JobMutator{&labelMutator{name: "a", key: "owner", value: "a"}, &metaMutator{name: "b", value: "b"}},
+			wantErr:  "error in job mutator b: conflicting change at /Meta/owner, mutator a already changed it",
+		},
+		{
+			name:     "same value",
+			strategy: ConflictFail,
+			mutators: []JobMutator{&labelMutator{name: "a", key: "owner", value: "a"}, &labelMutator{name: "b", key: "owner", value: "a"}},
+			wantMeta: map[string]string{"owner": "a"},
+		},
+		{
+			name:     "no strategy",
+			mutators: []JobMutator{&labelMutator{name: "a", key: "owner", value: "a"}, &labelMutator{name: "b", key: "owner", value: "b"}},
+			wantMeta: map[string]string{"owner": "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewJobHandler(tt.mutators, nil, hclog.NewNullLogger(), false)
+			j.UseConflictStrategy(tt.strategy)
+
+			job, warnings, err := j.AdmissionMutators(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMeta, job.Meta)
+			assert.Equal(t, tt.wantWarnings, warnings)
+		})
+	}
+}
+
+func TestChangedPaths(t *testing.T) {
+	before := map[string]interface{}{"ID": "web", "Meta": nil, "Datacenters": []interface{}{"dc1"}}
+	after := map[string]interface{}{"ID": "web", "Meta": map[string]interface{}{"a/b": "c"}, "Datacenters": []interface{}{"dc1", "dc2"}, "Region": "eu"}
+	assert.Equal(t, []string{"/Datacenters", "/Meta/a~1b", "/Region"}, changedPaths(before, after, ""))
+}
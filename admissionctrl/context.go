@@ -0,0 +1,46 @@
+package admissionctrl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// ContextMutator is a mutator that stops when the request is cancelled, e.g. a webhook call or policy evaluation.
+type ContextMutator interface {
+	JobMutator
+	MutateContext(ctx context.Context, payload *types.Payload) (*api.Job, []error, error)
+}
+
+// ContextValidator is a validator that stops when the request is cancelled.
+type ContextValidator interface {
+	JobValidator
+	ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error)
+}
+
+// MutateContext applies the mutator with the context, mutators without MutateContext run to completion.
+func MutateContext(ctx context.Context, mutator JobMutator, payload *types.Payload) (*api.Job, []error, error) {
+	if m, ok := mutator.(ContextMutator); ok {
+		return m.MutateContext(ctx, payload)
+	}
+	return mutator.Mutate(payload)
+}
+
+// ValidateContext applies the validator with the context, validators without ValidateContext run to completion.
+func ValidateContext(ctx context.Context, validator JobValidator, payload *types.Payload) ([]error, error) {
+	if v, ok := validator.(ContextValidator); ok {
+		return v.ValidateContext(ctx, payload)
+	}
+	return validator.Validate(payload)
+}
+
+// aborted fails the rule without running it if the request already ended, e.g. the client disconnected.
+func aborted(ctx context.Context, rule string) error {
+	if err := ctx.Err(); err != nil {
+		return errcode.Unreachable(rule, fmt.Errorf("request ended before the rule ran: %w", err))
+	}
+	return nil
+}
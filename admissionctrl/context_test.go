@@ -0,0 +1,71 @@
+package admissionctrl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type contextKeyTest struct{}
+
+// contextValidator rejects jobs if the context carries a value for contextKeyTest.
+type contextValidator struct {
+	testutil.MockValidator
+}
+
+func (v *contextValidator) ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error) {
+	if value, ok := ctx.Value(contextKeyTest{}).(string); ok {
+		return nil, fmt.Errorf("context value %s", value)
+	}
+	return nil, nil
+}
+
+func TestValidateContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextKeyTest{}, "request")
+	payload := &types.Payload{Job: &api.Job{ID: pointer("job")}}
+
+	_, err := ValidateContext(ctx, &contextValidator{}, payload)
+	assert.EqualError(t, err, "context value request")
+
+	legacy := new(testutil.MockValidator)
+	legacy.On("Validate", mock.Anything).Return([]error{}, nil)
+	_, err = ValidateContext(ctx, legacy, payload)
+	assert.NoError(t, err, "validators without ValidateContext are adapted")
+	legacy.AssertExpectations(t)
+
+	jobs, err := selector.NewJobFilter(&config.Jobs{})
+	require.NoError(t, err)
+	scoped := NewScopedValidator(NewSeverityValidator(&contextValidator{}, types.SeverityWarning), jobs, hclog.NewNullLogger())
+	warnings, err := ValidateContext(ctx, scoped, payload)
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1, "wrappers pass the context on")
+}
+
+func TestJobHandler_StopsWhenRequestEnds(t *testing.T) {
+	mutator := new(testutil.MockMutator)
+	validator := new(testutil.MockValidator)
+	j := NewJobHandler([]JobMutator{mutator}, []JobValidator{validator}, hclog.NewNullLogger(), false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := j.ApplyAdmissionControllersContext(ctx, &types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "mock-mutator", errcode.Of(err).Rule)
+	mutator.AssertNotCalled(t, "Mutate", mock.Anything)
+	validator.AssertNotCalled(t, "Validate", mock.Anything)
+
+	_, err = j.AdmissionValidatorsContext(ctx, &types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.ErrorIs(t, err, context.Canceled)
+	validator.AssertNotCalled(t, "Validate", mock.Anything)
+}
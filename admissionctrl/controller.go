@@ -4,10 +4,15 @@ package admissionctrl
 // https://github.com/hashicorp/nomad/blob/v1.5.0-beta.1/nomad/job_endpoint_hooks.go
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+
+	"github.com/mxab/nacp/admissionctrl/errcode"
 	"github.com/mxab/nacp/admissionctrl/types"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
@@ -27,11 +32,29 @@ type JobValidator interface {
 	Validate(*types.Payload) (warnings []error, err error)
 }
 
+// DataProvider provides the content of external data sources by name.
+type DataProvider interface {
+	Snapshot() map[string]interface{}
+}
+
 type JobHandler struct {
+	mu           sync.RWMutex
 	mutators     []JobMutator
 	validators   []JobValidator
 	resolveToken bool
 	logger       hclog.Logger
+	data         DataProvider
+	faults       *FaultInjector
+	versions     RuleVersions
+	shadow       *Shadow
+	exemptions   *Exemptions
+	sinks        []DecisionSink
+	maxPasses    int
+	conflicts    ConflictStrategy
+
+	// degraded is set when the handler runs in pass-through mode because the
+	// policy subsystem could not be (re)loaded.
+	degraded error
 }
 
 func NewJobHandler(mutators []JobMutator, validators []JobValidator, logger hclog.Logger, resolverToken bool) *JobHandler {
@@ -44,14 +67,35 @@ func NewJobHandler(mutators []JobMutator, validators []JobValidator, logger hclo
 }
 
 func (j *JobHandler) ApplyAdmissionControllers(payload *types.Payload) (out *api.Job, warnings []error, err error) {
+	return j.ApplyAdmissionControllersContext(context.Background(), payload)
+}
+
+// ApplyAdmissionControllersContext applies the rules like ApplyAdmissionControllers,
+// cancelling the context stops the rules in flight, e.g. when the client disconnects.
+func (j *JobHandler) ApplyAdmissionControllersContext(ctx context.Context, payload *types.Payload) (out *api.Job, warnings []error, err error) {
+	j.mu.RLock()
+	shadow := j.shadow
+	j.mu.RUnlock()
+	if shadow == nil {
+		return j.applyAdmissionControllers(ctx, payload)
+	}
+
+	original := &types.Payload{Job: copyJob(payload.Job), Context: payload.Context}
+	out, warnings, err = j.applyAdmissionControllers(ctx, payload)
+	shadow.Compare(original, NewShadowDecision(original.Job, out, warnings, err), out)
+	return out, warnings, err
+}
+
+func (j *JobHandler) applyAdmissionControllers(ctx context.Context, payload *types.Payload) (out *api.Job, warnings []error, err error) {
 	// Mutators run first before validators, so validators view the final rendered job.
 	// So, mutators must handle invalid jobs.
-	out, warnings, err = j.AdmissionMutators(payload)
+	out, warnings, err = j.AdmissionMutatorsContext(ctx, payload)
 	if err != nil {
 		return nil, nil, err
 	}
+	payload.Job = out
 
-	validateWarnings, err := j.AdmissionValidators(payload)
+	validateWarnings, err := j.AdmissionValidatorsContext(ctx, payload)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -61,17 +105,83 @@ func (j *JobHandler) ApplyAdmissionControllers(payload *types.Payload) (out *api
 }
 
 // AdmissionMutators returns an updated job as well as warnings or an error.
+// With revalidation the mutators are re-run until the job is stable.
 func (j *JobHandler) AdmissionMutators(payload *types.Payload) (job *api.Job, warnings []error, err error) {
+	return j.AdmissionMutatorsContext(context.Background(), payload)
+}
+
+// AdmissionMutatorsContext is AdmissionMutators with a context that cancels the mutators in flight.
+func (j *JobHandler) AdmissionMutatorsContext(ctx context.Context, payload *types.Payload) (job *api.Job, warnings []error, err error) {
+	j.mu.RLock()
+	maxPasses := j.maxPasses
+	j.mu.RUnlock()
+	if maxPasses > 1 {
+		return j.mutateUntilStable(ctx, payload, maxPasses)
+	}
+	return j.mutate(ctx, payload)
+}
+
+// mutate applies every mutator once.
+func (j *JobHandler) mutate(ctx context.Context, payload *types.Payload) (job *api.Job, warnings []error, err error) {
 	var w []error
 	job = payload.Job
-	j.logger.Debug("applying job mutators", "mutators", len(j.mutators), "job", payload.Job.ID)
-	for _, mutator := range j.mutators {
+	j.attachData(payload)
+	mutators, _ := j.rules()
+	if degraded := j.Degraded(); degraded != nil {
+		j.logger.Error("admission control is degraded, passing job through without policy enforcement", "reason", degraded, "job", payload.Job.ID)
+		warnings = append(warnings, fmt.Errorf("admission control is degraded, job was not checked: %v", degraded))
+	}
+	j.logger.Debug("applying job mutators", "mutators", len(mutators), "job", payload.Job.ID)
+	var tracker *changeTracker
+	if strategy := j.conflictStrategy(); strategy != "" {
+		tracker = newChangeTracker(strategy)
+	}
+	log := patchLogFromContext(ctx)
+	for _, mutator := range mutators {
 		j.logger.Debug("applying job mutator", "mutator", mutator.Name(), "job", payload.Job.ID)
-		job, w, err = mutator.Mutate(payload)
+		if err := aborted(ctx, mutator.Name()); err != nil {
+			return nil, nil, fmt.Errorf("error in job mutator %s: %w", mutator.Name(), err)
+		}
+		if err := j.injectFault(mutator.Name()); err != nil {
+			return nil, nil, fmt.Errorf("error in job mutator %s: %w", mutator.Name(), err)
+		}
+		var before []byte
+		if tracker != nil || j.recording() {
+			before, _ = json.Marshal(payload.Job)
+		}
+		var changes jsonpatch.Patch
+		if log != nil {
+			job, w, changes, err = mutateWithPatch(ctx, mutator, payload)
+		} else {
+			job, w, err = MutateContext(ctx, mutator, payload)
+		}
+		err = errcode.Classify(mutator.Name(), err)
 		j.logger.Trace("job mutate results", "mutator", mutator.Name(), "warnings", w, "error", err)
+		if tracker != nil && err == nil && before != nil {
+			var resolved *api.Job
+			var conflicts []error
+			resolved, conflicts, err = tracker.track(mutator.Name(), before, job)
+			if err == nil && resolved != job && log != nil {
+				// conflicting changes were dropped, the patch of the mutator doesn't match anymore
+				changes, err = diffJobs(before, resolved)
+			}
+			job = resolved
+			w = append(w, conflicts...)
+		}
+		w, err = j.decide(kindMutator, mutator.Name(), payload.Job, w, err)
+		var patch json.RawMessage
+		if before != nil && err == nil {
+			patch = mutationPatch(before, job)
+		}
+		j.record(kindMutator, mutator.Name(), payload, patch, w, err)
 		if err != nil {
-			return nil, nil, fmt.Errorf("error in job mutator %s: %v", mutator.Name(), err)
+			return nil, nil, fmt.Errorf("error in job mutator %s: %w", mutator.Name(), err)
+		}
+		if log != nil {
+			log.Patches = append(log.Patches, changes)
 		}
+		// the next mutator continues with the mutated job
+		payload.Job = job
 		warnings = append(warnings, w...)
 	}
 	return job, warnings, err
@@ -80,17 +190,24 @@ func (j *JobHandler) AdmissionMutators(payload *types.Payload) (job *api.Job, wa
 // AdmissionValidators returns a slice of validation warnings and a multierror
 // of validation failures.
 func (j *JobHandler) AdmissionValidators(payload *types.Payload) ([]error, error) {
-	// ensure job is not mutated
-	j.logger.Debug("applying job validators", "validators", len(j.validators), "job", payload.Job.ID)
-	job := copyJob(payload.Job)
+	return j.AdmissionValidatorsContext(context.Background(), payload)
+}
+
+// AdmissionValidatorsContext is AdmissionValidators with a context that cancels the validators in flight.
+func (j *JobHandler) AdmissionValidatorsContext(ctx context.Context, payload *types.Payload) ([]error, error) {
+	j.attachData(payload)
+	_, validators := j.rules()
+	j.logger.Debug("applying job validators", "validators", len(validators), "job", payload.Job.ID)
 
 	var warnings []error
 	var errs error
 
-	for _, validator := range j.validators {
-		j.logger.Debug("applying job validator", "validator", validator.Name(), "job", job.ID)
-		w, err := validator.Validate(payload)
-		j.logger.Trace("job validate results", "validator", validator.Name(), "warnings", w, "error", err)
+	for _, validator := range validators {
+		// operation validators only check operations on registered jobs, e.g. stops
+		if ValidatedOperations(validator) != nil {
+			continue
+		}
+		w, err := j.validate(ctx, validator, payload)
 		if err != nil {
 			errs = multierror.Append(errs, err)
 		}
@@ -102,9 +219,106 @@ func (j *JobHandler) AdmissionValidators(payload *types.Payload) ([]error, error
 }
 
 func (j *JobHandler) ResolveToken() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
 	return j.resolveToken
 }
 
+// Replace swaps the active rule set, e.g. after a successful policy reload,
+// and leaves the degraded mode if it was active.
+func (j *JobHandler) Replace(mutators []JobMutator, validators []JobValidator, resolveToken bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.mutators = mutators
+	j.validators = validators
+	j.resolveToken = resolveToken
+	j.degraded = nil
+}
+
+// PassThrough drops all rules and lets every job through unchecked.
+// It is used as a last resort when the policies cannot be loaded.
+func (j *JobHandler) PassThrough(reason error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.mutators = nil
+	j.validators = nil
+	j.resolveToken = false
+	j.degraded = reason
+}
+
+// Degraded returns the reason why the handler is in pass-through mode or nil.
+func (j *JobHandler) Degraded() error {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.degraded
+}
+
+// UseDataSources attaches the content of the data sources to every payload.
+func (j *JobHandler) UseDataSources(data DataProvider) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.data = data
+}
+
+// UseFaultInjector enables the fault injection mode, the injector's faults are applied before every rule.
+func (j *JobHandler) UseFaultInjector(faults *FaultInjector) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.faults = faults
+}
+
+func (j *JobHandler) injectFault(rule string) error {
+	j.mu.RLock()
+	faults := j.faults
+	j.mu.RUnlock()
+	if faults == nil {
+		return nil
+	}
+	if err := faults.Inject(rule); err != nil {
+		return errcode.New(errcode.CodeUnavailable, rule, err)
+	}
+	return nil
+}
+
+// UseShadow evaluates the shadow's candidate rules for every job in the background and compares the decisions.
+func (j *JobHandler) UseShadow(shadow *Shadow) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.shadow = shadow
+}
+
+// UseExemptions turns the errors of validators into warnings for the exempted jobs.
+func (j *JobHandler) UseExemptions(exemptions *Exemptions) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.exemptions = exemptions
+}
+
+func (j *JobHandler) exempt(rule string, job *api.Job, warnings []error, err error) ([]error, error) {
+	j.mu.RLock()
+	exemptions := j.exemptions
+	j.mu.RUnlock()
+	if exemptions == nil {
+		return warnings, err
+	}
+	return exemptions.Apply(rule, job, warnings, err)
+}
+
+func (j *JobHandler) attachData(payload *types.Payload) {
+	j.mu.RLock()
+	data := j.data
+	j.mu.RUnlock()
+	if data != nil && payload.Data == nil {
+		payload.Data = data.Snapshot()
+	}
+}
+
+func (j *JobHandler) rules() ([]JobMutator, []JobValidator) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.mutators, j.validators
+}
+
 func copyJob(job *api.Job) *api.Job {
 	jobCopy := &api.Job{}
 	data, err := json.Marshal(job)
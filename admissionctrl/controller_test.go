@@ -1,6 +1,7 @@
 package admissionctrl
 
 import (
+	"fmt"
 	"github.com/mxab/nacp/admissionctrl/types"
 	"testing"
 
@@ -8,6 +9,8 @@ import (
 	"github.com/hashicorp/nomad/api"
 	"github.com/mxab/nacp/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestJobHandler_ApplyAdmissionControllers(t *testing.T) {
@@ -73,3 +76,60 @@ func TestJobHandler_ApplyAdmissionControllers(t *testing.T) {
 		})
 	}
 }
+
+func TestJobHandler_PassThrough(t *testing.T) {
+	validator := new(testutil.MockValidator)
+	j := NewJobHandler(nil, []JobValidator{validator}, hclog.NewNullLogger(), true)
+
+	j.PassThrough(fmt.Errorf("broken policy"))
+
+	payload := &types.Payload{Job: &api.Job{}}
+	job, warnings, err := j.ApplyAdmissionControllers(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, payload.Job, job)
+	assert.Len(t, warnings, 1, "degraded mode is reported as warning")
+	assert.False(t, j.ResolveToken())
+	assert.EqualError(t, j.Degraded(), "broken policy")
+	validator.AssertNotCalled(t, "Validate", mock.Anything)
+
+	j.Replace(nil, nil, false)
+	assert.Nil(t, j.Degraded())
+}
+
+type staticData map[string]interface{}
+
+func (s staticData) Snapshot() map[string]interface{} {
+	return s
+}
+
+func TestJobHandler_UseDataSources(t *testing.T) {
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.MatchedBy(func(payload *types.Payload) bool {
+		return payload.Data["teams"] == "a"
+	})).Return([]error{}, nil)
+	j := NewJobHandler(nil, []JobValidator{validator}, hclog.NewNullLogger(), false)
+	j.UseDataSources(staticData{"teams": "a"})
+
+	_, _, err := j.ApplyAdmissionControllers(&types.Payload{Job: &api.Job{}})
+	assert.NoError(t, err)
+	validator.AssertExpectations(t)
+}
+
+func TestJobHandler_UseFaultInjector(t *testing.T) {
+	mutator := new(testutil.MockMutator)
+	validator := new(testutil.MockValidator)
+	j := NewJobHandler([]JobMutator{mutator}, []JobValidator{validator}, hclog.NewNullLogger(), false)
+	faults := NewFaultInjector()
+	j.UseFaultInjector(faults)
+
+	require.NoError(t, faults.Set("mock-validator", Fault{ErrorPercent: 100}))
+	payload := &types.Payload{Job: &api.Job{}}
+	mutator.On("Mutate", payload).Return(payload.Job, []error{}, nil)
+	_, _, err := j.ApplyAdmissionControllers(payload)
+	assert.ErrorContains(t, err, "error in job validator mock-validator: injected fault")
+	validator.AssertNotCalled(t, "Validate", mock.Anything)
+
+	require.NoError(t, faults.Set("mock-mutator", Fault{ErrorPercent: 100}))
+	_, _, err = j.ApplyAdmissionControllers(&types.Payload{Job: &api.Job{}})
+	assert.EqualError(t, err, "error in job mutator mock-mutator: injected fault")
+}
@@ -0,0 +1,123 @@
+package admissionctrl
+
+import (
+	"encoding/json"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+)
+
+// Decision is the outcome of one rule for one job, as passed to the decision sinks.
+type Decision struct {
+	Time time.Time `json:"time"`
+	// Kind is mutator or validator
+	Kind    string `json:"kind"`
+	Rule    string `json:"rule"`
+	Version string `json:"version,omitempty"`
+	// Decision is accepted, warned or rejected, exempted denials are warned
+	Decision  string   `json:"decision"`
+	Namespace string   `json:"namespace"`
+	JobID     string   `json:"job_id"`
+	Errors    []string `json:"errors,omitempty"`
+	// ErrorCode tells why a rejected job failed the rule, see errcode.Code
+	ErrorCode string `json:"error_code,omitempty"`
+	// Retriable is set if the rule failed and the same job may pass later
+	Retriable bool     `json:"retriable,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+	// Results are the warnings and denials with their severity, field, code and docs URL
+	Results []*types.Result `json:"results,omitempty"`
+	// Patch is the JSON merge patch (RFC 7386) of the changes a mutator made to the job
+	Patch json.RawMessage `json:"patch,omitempty"`
+	// Context of the request, nil if the job was checked without one
+	Context *config.RequestContext `json:"context,omitempty"`
+}
+
+// DecisionSink receives every rule decision, e.g. to export it to a SIEM.
+// Record is called on the request path and must not block.
+type DecisionSink interface {
+	Record(Decision)
+}
+
+// UseDecisionSinks passes the decisions of all rules to the sinks.
+func (j *JobHandler) UseDecisionSinks(sinks ...DecisionSink) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.sinks = sinks
+}
+
+// recording tells whether decisions are passed to sinks, e.g. to skip computing mutation patches.
+func (j *JobHandler) recording() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return len(j.sinks) > 0
+}
+
+// record passes the final outcome of a rule, after versions and exemptions were applied, to the sinks.
+// patch holds the changes of a mutator, it is nil for validators.
+func (j *JobHandler) record(kind, rule string, payload *types.Payload, patch json.RawMessage, warnings []error, err error) {
+	j.mu.RLock()
+	sinks := j.sinks
+	version := j.versions.version(kind, rule)
+	j.mu.RUnlock()
+	if len(sinks) == 0 {
+		return
+	}
+
+	d := Decision{
+		Time:      time.Now(),
+		Kind:      kind,
+		Rule:      rule,
+		Version:   version,
+		Decision:  decisionAccepted,
+		Namespace: namespaceOf(payload.Job),
+		JobID:     jobID(payload.Job),
+		Patch:     patch,
+		Context:   payload.Context,
+	}
+	if payload.Context != nil && payload.Context.Namespace != "" {
+		d.Namespace = payload.Context.Namespace
+	}
+	for _, w := range warnings {
+		d.Warnings = append(d.Warnings, w.Error())
+	}
+	d.Results = types.ResultsOf(warnings)
+	if denials := Denials(err); len(denials) > 0 {
+		d.Results = append(d.Results, denials...)
+	}
+	switch {
+	case err != nil:
+		d.Decision = decisionRejected
+		if merr, ok := err.(*multierror.Error); ok {
+			for _, e := range merr.Errors {
+				d.Errors = append(d.Errors, e.Error())
+			}
+		} else {
+			d.Errors = []string{err.Error()}
+		}
+		coded := errcode.Of(err)
+		d.ErrorCode, d.Retriable = string(coded.Code), coded.Retriable
+	case len(warnings) > 0:
+		d.Decision = decisionWarned
+	}
+	for _, sink := range sinks {
+		sink.Record(d)
+	}
+}
+
+// mutationPatch returns the merge patch from before to the job, nil if the job is unchanged.
+func mutationPatch(before []byte, job *api.Job) json.RawMessage {
+	after, err := json.Marshal(job)
+	if err != nil {
+		return nil
+	}
+	patch, err := jsonpatch.CreateMergePatch(before, after)
+	if err != nil || string(patch) == "{}" {
+		return nil
+	}
+	return patch
+}
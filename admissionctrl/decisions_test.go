@@ -0,0 +1,104 @@
+package admissionctrl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type decisionRecorder struct {
+	decisions []Decision
+}
+
+func (r *decisionRecorder) Record(d Decision) {
+	r.decisions = append(r.decisions, d)
+}
+
+func TestJobHandler_UseDecisionSinks(t *testing.T) {
+	mutator := new(testutil.MockMutator)
+	mutator.On("Mutate", mock.Anything).Return(&api.Job{ID: pointer("job")}, []error{}, nil)
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf("careful")},
+		multierror.Append(nil, fmt.Errorf("missing owner"), fmt.Errorf("missing team")))
+
+	j := NewJobHandler([]JobMutator{mutator}, []JobValidator{validator}, hclog.NewNullLogger(), false)
+	j.UseRuleVersions(RuleVersions{Validators: map[string]string{"mock-validator": "bbbb"}})
+	recorder := &decisionRecorder{}
+	j.UseDecisionSinks(recorder)
+
+	ctx := &config.RequestContext{Operation: "register", Namespace: "team-a"}
+	_, _, err := j.ApplyAdmissionControllers(&types.Payload{Job: &api.Job{ID: pointer("job")}, Context: ctx})
+	require.Error(t, err)
+
+	require.Len(t, recorder.decisions, 2)
+	mutated, validated := recorder.decisions[0], recorder.decisions[1]
+	assert.Equal(t, "mutator", mutated.Kind)
+	assert.Equal(t, "mock-mutator", mutated.Rule)
+	assert.Equal(t, "accepted", mutated.Decision)
+
+	assert.Equal(t, "validator", validated.Kind)
+	assert.Equal(t, "bbbb", validated.Version)
+	assert.Equal(t, "rejected", validated.Decision)
+	assert.Equal(t, "team-a", validated.Namespace, "the namespace of the request wins")
+	assert.Equal(t, "job", validated.JobID)
+	assert.Equal(t, []string{"missing owner (mock-validator@bbbb)", "missing team (mock-validator@bbbb)"}, validated.Errors)
+	assert.Equal(t, []string{"careful (mock-validator@bbbb)"}, validated.Warnings)
+	assert.Equal(t, "denied", validated.ErrorCode)
+	assert.False(t, validated.Retriable)
+	assert.Same(t, ctx, validated.Context)
+	assert.False(t, validated.Time.IsZero())
+}
+
+func TestJobHandler_RecordsWarnedDecisions(t *testing.T) {
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf("careful")}, nil)
+	j := NewJobHandler(nil, []JobValidator{validator}, hclog.NewNullLogger(), false)
+	recorder := &decisionRecorder{}
+	j.UseDecisionSinks(recorder)
+
+	_, err := j.AdmissionValidators(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.NoError(t, err)
+	require.Len(t, recorder.decisions, 1)
+	assert.Equal(t, "warned", recorder.decisions[0].Decision)
+	assert.Equal(t, "default", recorder.decisions[0].Namespace)
+	assert.Nil(t, recorder.decisions[0].Context)
+}
+
+func TestJobHandler_RecordsFailingRules(t *testing.T) {
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, errcode.Unreachable("", context.DeadlineExceeded))
+	j := NewJobHandler(nil, []JobValidator{validator}, hclog.NewNullLogger(), false)
+	recorder := &decisionRecorder{}
+	j.UseDecisionSinks(recorder)
+
+	_, err := j.AdmissionValidators(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.Error(t, err)
+	assert.Equal(t, "mock-validator", errcode.Of(err).Rule, "the handler names the failing rule")
+	require.Len(t, recorder.decisions, 1)
+	assert.Equal(t, "rejected", recorder.decisions[0].Decision)
+	assert.Equal(t, "timeout", recorder.decisions[0].ErrorCode)
+	assert.True(t, recorder.decisions[0].Retriable)
+}
+
+func TestJobHandler_RecordsMutationPatch(t *testing.T) {
+	j := NewJobHandler([]JobMutator{&metaMutator{name: "meta", value: "a"}, &metaMutator{name: "again", value: "a"}}, nil, hclog.NewNullLogger(), false)
+	recorder := &decisionRecorder{}
+	j.UseDecisionSinks(recorder)
+
+	_, _, err := j.AdmissionMutators(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.NoError(t, err)
+	require.Len(t, recorder.decisions, 2)
+	assert.JSONEq(t, `{"Meta":{"owner":"a"}}`, string(recorder.decisions[0].Patch))
+	assert.Nil(t, recorder.decisions[1].Patch, "no patch if the job is unchanged")
+}
@@ -0,0 +1,173 @@
+// Package errcode classifies the errors of rules, so clients and audit sinks can tell a denied job
+// from a rule that failed, and whether it is worth retrying the request.
+package errcode
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Code tells why a rule failed.
+type Code string
+
+const (
+	// CodeDenied is a rule rejecting the job, retrying won't change the outcome
+	CodeDenied Code = "denied"
+	// CodeForbidden is a read rule rejecting the request, NACP answers like Nomad does for missing permissions
+	CodeForbidden Code = "forbidden"
+	// CodeInvalidRequest is a request NACP could not check, e.g. a malformed job
+	CodeInvalidRequest Code = "invalid_request"
+	// CodeUnavailable is a rule that could not be reached, e.g. a webhook that is down
+	CodeUnavailable Code = "unavailable"
+	// CodeTimeout is a rule that did not decide in time
+	CodeTimeout Code = "timeout"
+	// CodeInternal is a rule that failed, e.g. a policy evaluation error or an invalid webhook response
+	CodeInternal Code = "internal"
+)
+
+// precedence orders the codes of a request with several errors, the first one decides the response.
+// A denial stands whatever else failed, so it wins over the failures that could be retried.
+var precedence = []Code{CodeDenied, CodeForbidden, CodeInvalidRequest, CodeInternal, CodeTimeout, CodeUnavailable}
+
+// Status is the HTTP status of a response failing with the code.
+// Denials keep the status of Nomad's own failed job validations, so clients handle both the same.
+func (c Code) Status() int {
+	switch c {
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeInvalidRequest:
+		return http.StatusBadRequest
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Retriable reports whether the same request may succeed later.
+func (c Code) Retriable() bool {
+	return c == CodeUnavailable || c == CodeTimeout
+}
+
+// Error is the error of a rule with its code, it survives wrapping with %w.
+type Error struct {
+	Code Code
+	// Rule is the name of the failing rule, empty for errors outside of rules
+	Rule      string
+	Retriable bool
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error with the code, retriable if the code is.
+func New(code Code, rule string, err error) *Error {
+	return &Error{Code: code, Rule: rule, Retriable: code.Retriable(), Err: err}
+}
+
+// Denied marks the reason of a rejection.
+func Denied(rule string, err error) error {
+	return New(CodeDenied, rule, err)
+}
+
+// Failed marks the failure of a rule as internal, unless it already has a code, e.g. a timeout.
+func Failed(rule string, err error) error {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return err
+	}
+	return New(CodeInternal, rule, err)
+}
+
+// Unreachable classifies the error of calling a remote rule, timeouts and network failures can be retried.
+func Unreachable(rule string, err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return New(CodeTimeout, rule, err)
+	}
+	return New(CodeUnavailable, rule, err)
+}
+
+// Classify gives every error of a rule a code and the rule name. Errors that have no code yet are denials,
+// rules mark their own failures. The errors of a multierror are classified one by one, so they stay flat.
+func Classify(rule string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if merr, ok := err.(*multierror.Error); ok {
+		classified := &multierror.Error{ErrorFormat: merr.ErrorFormat}
+		for _, e := range merr.Errors {
+			classified.Errors = append(classified.Errors, Classify(rule, e))
+		}
+		return classified
+	}
+	var coded *Error
+	if errors.As(err, &coded) {
+		if coded.Rule == "" {
+			coded.Rule = rule
+		}
+		return err
+	}
+	return Denied(rule, err)
+}
+
+// Errors returns the coded errors of err, one per error of a multierror. Errors without a code are internal.
+func Errors(err error) []*Error {
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	var merr *multierror.Error
+	if errors.As(err, &merr) {
+		errs = merr.Errors
+	}
+	coded := make([]*Error, 0, len(errs))
+	for _, e := range errs {
+		var c *Error
+		if !errors.As(e, &c) {
+			c = New(CodeInternal, "", e)
+		}
+		coded = append(coded, c)
+	}
+	return coded
+}
+
+// Of returns the code deciding the response to err, see Status.
+func Of(err error) *Error {
+	errs := Errors(err)
+	if len(errs) == 0 {
+		return nil
+	}
+	retriable := true
+	for _, e := range errs {
+		retriable = retriable && e.Retriable
+	}
+	for _, code := range precedence {
+		for _, e := range errs {
+			if e.Code == code {
+				return &Error{Code: e.Code, Rule: e.Rule, Retriable: retriable, Err: err}
+			}
+		}
+	}
+	return &Error{Code: errs[0].Code, Rule: errs[0].Rule, Retriable: retriable, Err: err}
+}
+
+// Status is the HTTP status of a response failing with err, 500 for errors without a code.
+func Status(err error) int {
+	if e := Of(err); e != nil {
+		return e.Code.Status()
+	}
+	return http.StatusInternalServerError
+}
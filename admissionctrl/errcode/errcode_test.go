@@ -0,0 +1,82 @@
+package errcode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	err := Classify("owner", multierror.Append(nil,
+		fmt.Errorf("missing owner"),
+		New(CodeTimeout, "", fmt.Errorf("policy evaluation timed out after 1s")),
+	))
+	merr, ok := err.(*multierror.Error)
+	require.True(t, ok, "the errors stay flat")
+	require.Len(t, merr.Errors, 2)
+
+	errs := Errors(err)
+	assert.Equal(t, CodeDenied, errs[0].Code)
+	assert.Equal(t, "owner", errs[0].Rule)
+	assert.Equal(t, CodeTimeout, errs[1].Code)
+	assert.Equal(t, "owner", errs[1].Rule)
+	assert.Contains(t, err.Error(), "missing owner", "the messages are unchanged")
+
+	assert.Nil(t, Classify("owner", nil))
+}
+
+func TestOf(t *testing.T) {
+	tt := []struct {
+		name          string
+		err           error
+		wantCode      Code
+		wantRule      string
+		wantStatus    int
+		wantRetriable bool
+	}{
+		{name: "uncoded", err: fmt.Errorf("boom"), wantCode: CodeInternal, wantStatus: http.StatusInternalServerError},
+		{name: "denied", err: Denied("owner", fmt.Errorf("missing owner")), wantCode: CodeDenied, wantRule: "owner", wantStatus: http.StatusInternalServerError},
+		{name: "forbidden", err: New(CodeForbidden, "namespaces", fmt.Errorf("namespace ops is not allowed")), wantCode: CodeForbidden, wantRule: "namespaces", wantStatus: http.StatusForbidden},
+		{name: "invalid request", err: New(CodeInvalidRequest, "", fmt.Errorf("bad json")), wantCode: CodeInvalidRequest, wantStatus: http.StatusBadRequest},
+		{name: "timeout", err: Unreachable("hook", context.DeadlineExceeded), wantCode: CodeTimeout, wantRule: "hook", wantStatus: http.StatusGatewayTimeout, wantRetriable: true},
+		{name: "unavailable", err: Unreachable("hook", fmt.Errorf("connection refused")), wantCode: CodeUnavailable, wantRule: "hook", wantStatus: http.StatusServiceUnavailable, wantRetriable: true},
+		{name: "wrapped", err: fmt.Errorf("error in job mutator hook: %w", Unreachable("hook", fmt.Errorf("connection refused"))), wantCode: CodeUnavailable, wantRule: "hook", wantStatus: http.StatusServiceUnavailable, wantRetriable: true},
+		{
+			name: "denial wins",
+			err: multierror.Append(nil,
+				Unreachable("hook", fmt.Errorf("connection refused")),
+				fmt.Errorf("%w (owner@v2)", Denied("owner", fmt.Errorf("missing owner"))),
+			),
+			wantCode: CodeDenied, wantRule: "owner", wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "all retriable",
+			err: multierror.Append(nil,
+				Unreachable("hook", fmt.Errorf("connection refused")),
+				Unreachable("other", context.DeadlineExceeded),
+			),
+			wantCode: CodeTimeout, wantRule: "other", wantStatus: http.StatusGatewayTimeout, wantRetriable: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Of(tc.err)
+			require.NotNil(t, got)
+			assert.Equal(t, tc.wantCode, got.Code)
+			assert.Equal(t, tc.wantRule, got.Rule)
+			assert.Equal(t, tc.wantRetriable, got.Retriable)
+			assert.Equal(t, tc.wantStatus, Status(tc.err))
+		})
+	}
+	assert.Nil(t, Of(nil))
+}
+
+func TestFailed(t *testing.T) {
+	assert.Equal(t, CodeInternal, Of(Failed("rule", fmt.Errorf("eval error"))).Code)
+	assert.Equal(t, CodeTimeout, Of(Failed("rule", New(CodeTimeout, "", fmt.Errorf("timed out")))).Code, "failures keep their code")
+}
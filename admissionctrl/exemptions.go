@@ -0,0 +1,262 @@
+package admissionctrl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/metrics"
+)
+
+const (
+	ExemptionSourceConfig = "config"
+	ExemptionSourceAPI    = "api"
+
+	exemptionActive   = "active"
+	exemptionExpiring = "expiring"
+	exemptionExpired  = "expired"
+)
+
+// Exemption turns the errors of a validator into warnings for the matching jobs until it expires.
+type Exemption struct {
+	ID   string `json:"id"`
+	Rule string `json:"rule"`
+	// Namespace and Job narrow the exemption, Job is a glob pattern on the job ID, empty matches all
+	Namespace string    `json:"namespace,omitempty"`
+	Job       string    `json:"job,omitempty"`
+	Expires   time.Time `json:"expires"`
+	Reason    string    `json:"reason"`
+	// Source is config for exemptions of the config file and api for the ones added via the admin API
+	Source string `json:"source"`
+}
+
+func (e Exemption) Validate() error {
+	if e.Rule == "" {
+		return fmt.Errorf("rule must be set")
+	}
+	if e.Reason == "" {
+		return fmt.Errorf("reason must be set")
+	}
+	if e.Expires.IsZero() {
+		return fmt.Errorf("expires must be set")
+	}
+	if _, err := path.Match(e.Job, ""); err != nil {
+		return fmt.Errorf("invalid job pattern %q: %w", e.Job, err)
+	}
+	return nil
+}
+
+func (e Exemption) matches(rule string, job *api.Job) bool {
+	if e.Rule != rule {
+		return false
+	}
+	if e.Namespace != "" && e.Namespace != namespaceOf(job) {
+		return false
+	}
+	if e.Job == "" {
+		return true
+	}
+	ok, _ := path.Match(e.Job, jobID(job))
+	return ok
+}
+
+// Exemptions holds the exemptions of the config file and the ones managed via the admin API.
+// The managed ones are stored in the file if one is given.
+type Exemptions struct {
+	mu         sync.RWMutex
+	configured []Exemption
+	managed    []Exemption
+	file       string
+	warnBefore time.Duration
+	logger     hclog.Logger
+	now        func() time.Time
+}
+
+// NewExemptions loads the managed exemptions from the file, a missing file is treated as empty.
+func NewExemptions(file string, warnBefore time.Duration, logger hclog.Logger) (*Exemptions, error) {
+	e := &Exemptions{
+		file:       file,
+		warnBefore: warnBefore,
+		logger:     logger,
+		now:        time.Now,
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("failed to read exemptions: %w", err)
+		default:
+			if err := json.Unmarshal(data, &e.managed); err != nil {
+				return nil, fmt.Errorf("failed to parse exemptions %s: %w", file, err)
+			}
+		}
+	}
+	e.updateMetrics()
+	return e, nil
+}
+
+// SetConfigured replaces the exemptions of the config file, e.g. after a reload.
+func (e *Exemptions) SetConfigured(exemptions []Exemption) error {
+	for i := range exemptions {
+		if err := exemptions[i].Validate(); err != nil {
+			return fmt.Errorf("invalid exemption for %s: %w", exemptions[i].Rule, err)
+		}
+		exemptions[i].ID = fmt.Sprintf("config-%d", i)
+		exemptions[i].Source = ExemptionSourceConfig
+	}
+	e.mu.Lock()
+	e.configured = exemptions
+	e.mu.Unlock()
+	e.updateMetrics()
+	return nil
+}
+
+// Add stores a new managed exemption and returns it with its generated ID.
+func (e *Exemptions) Add(exemption Exemption) (Exemption, error) {
+	if err := exemption.Validate(); err != nil {
+		return Exemption{}, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Exemption{}, err
+	}
+	exemption.ID = hex.EncodeToString(id)
+	exemption.Source = ExemptionSourceAPI
+
+	e.mu.Lock()
+	managed := append(append([]Exemption{}, e.managed...), exemption)
+	if err := e.save(managed); err != nil {
+		e.mu.Unlock()
+		return Exemption{}, err
+	}
+	e.managed = managed
+	e.mu.Unlock()
+	e.updateMetrics()
+	return exemption, nil
+}
+
+// Remove deletes a managed exemption, exemptions of the config file can only be removed there.
+func (e *Exemptions) Remove(id string) (bool, error) {
+	e.mu.Lock()
+	managed := make([]Exemption, 0, len(e.managed))
+	for _, exemption := range e.managed {
+		if exemption.ID != id {
+			managed = append(managed, exemption)
+		}
+	}
+	if len(managed) == len(e.managed) {
+		e.mu.Unlock()
+		return false, nil
+	}
+	if err := e.save(managed); err != nil {
+		e.mu.Unlock()
+		return false, err
+	}
+	e.managed = managed
+	e.mu.Unlock()
+	e.updateMetrics()
+	return true, nil
+}
+
+// save writes the managed exemptions to the file, it must be called with the lock held.
+func (e *Exemptions) save(managed []Exemption) error {
+	if e.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(managed, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(e.file), filepath.Base(e.file)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save exemptions: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save exemptions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save exemptions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), e.file); err != nil {
+		return fmt.Errorf("failed to save exemptions: %w", err)
+	}
+	return nil
+}
+
+// List returns all exemptions including the expired ones.
+func (e *Exemptions) List() []Exemption {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append(append([]Exemption{}, e.configured...), e.managed...)
+}
+
+// Find returns the first unexpired exemption of the rule for the job.
+func (e *Exemptions) Find(rule string, job *api.Job) (Exemption, bool) {
+	now := e.now()
+	for _, exemption := range e.List() {
+		if exemption.Expires.After(now) && exemption.matches(rule, job) {
+			return exemption, true
+		}
+	}
+	return Exemption{}, false
+}
+
+// Apply turns the error of the rule into warnings if the job is exempted from it.
+func (e *Exemptions) Apply(rule string, job *api.Job, warnings []error, err error) ([]error, error) {
+	if err == nil {
+		return warnings, nil
+	}
+	exemption, ok := e.Find(rule, job)
+	if !ok {
+		return warnings, err
+	}
+	metrics.ExemptionsApplied.WithLabelValues(rule).Inc()
+	expires := exemption.Expires.UTC().Format(time.RFC3339)
+	e.logger.Info("job is exempted from rule", "rule", rule, "job", jobID(job), "exemption", exemption.ID, "expires", expires, "error", err)
+
+	errs := []error{err}
+	if merr, ok := err.(*multierror.Error); ok {
+		errs = merr.Errors
+	}
+	for _, cause := range errs {
+		warnings = append(warnings, fmt.Errorf("%s (exempted until %s: %s): %w", rule, expires, exemption.Reason, cause))
+	}
+	if exemption.Expires.Sub(e.now()) <= e.warnBefore {
+		e.logger.Warn("exemption expires soon", "rule", rule, "exemption", exemption.ID, "expires", expires)
+		warnings = append(warnings, fmt.Errorf("the exemption of job %s from %s expires at %s, the job will be rejected afterwards", jobID(job), rule, expires))
+	}
+	e.updateMetrics()
+	return warnings, nil
+}
+
+func (e *Exemptions) updateMetrics() {
+	counts := map[string]float64{exemptionActive: 0, exemptionExpiring: 0, exemptionExpired: 0}
+	now := e.now()
+	for _, exemption := range e.List() {
+		left := exemption.Expires.Sub(now)
+		switch {
+		case left <= 0:
+			counts[exemptionExpired]++
+		case left <= e.warnBefore:
+			counts[exemptionExpiring]++
+		default:
+			counts[exemptionActive]++
+		}
+	}
+	for state, count := range counts {
+		metrics.Exemptions.WithLabelValues(state).Set(count)
+	}
+}
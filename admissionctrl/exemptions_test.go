@@ -0,0 +1,164 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExemptions(t *testing.T, file string, now time.Time) *Exemptions {
+	t.Helper()
+	exemptions, err := NewExemptions(file, 7*24*time.Hour, hclog.NewNullLogger())
+	require.NoError(t, err)
+	exemptions.now = func() time.Time { return now }
+	return exemptions
+}
+
+func TestExemptionsApply(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	exemptions := newTestExemptions(t, "", now)
+	require.NoError(t, exemptions.SetConfigured([]Exemption{
+		{Rule: "costcenter", Namespace: "billing", Job: "legacy-*", Expires: now.AddDate(0, 1, 0), Reason: "migration BILL-12"},
+		{Rule: "costcenter", Job: "soon", Expires: now.Add(24 * time.Hour), Reason: "cleanup"},
+		{Rule: "costcenter", Job: "old", Expires: now.Add(-time.Hour), Reason: "expired"},
+	}))
+	rejected := multierror.Append(nil, fmt.Errorf("missing costcenter"), fmt.Errorf("missing owner"))
+	job := func(namespace, id string) *api.Job {
+		return &api.Job{Namespace: &namespace, ID: &id}
+	}
+
+	tt := []struct {
+		name         string
+		rule         string
+		job          *api.Job
+		wantErr      bool
+		wantWarnings []string
+	}{
+		{
+			name: "exempted",
+			rule: "costcenter",
+			job:  job("billing", "legacy-invoices"),
+			wantWarnings: []string{
+				"costcenter (exempted until 2026-07-01T12:00:00Z: migration BILL-12): missing costcenter",
+				"costcenter (exempted until 2026-07-01T12:00:00Z: migration BILL-12): missing owner",
+			},
+		},
+		{
+			name:    "other namespace",
+			rule:    "costcenter",
+			job:     job("default", "legacy-invoices"),
+			wantErr: true,
+		},
+		{
+			name:    "other job",
+			rule:    "costcenter",
+			job:     job("billing", "invoices"),
+			wantErr: true,
+		},
+		{
+			name:    "other rule",
+			rule:    "naming",
+			job:     job("billing", "legacy-invoices"),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			rule:    "costcenter",
+			job:     job("default", "old"),
+			wantErr: true,
+		},
+		{
+			name: "expiring",
+			rule: "costcenter",
+			job:  job("default", "soon"),
+			wantWarnings: []string{
+				"costcenter (exempted until 2026-06-02T12:00:00Z: cleanup): missing costcenter",
+				"costcenter (exempted until 2026-06-02T12:00:00Z: cleanup): missing owner",
+				"the exemption of job soon from costcenter expires at 2026-06-02T12:00:00Z, the job will be rejected afterwards",
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := exemptions.Apply(tc.rule, tc.job, nil, rejected)
+			if tc.wantErr {
+				assert.Equal(t, rejected, err)
+				assert.Empty(t, warnings)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.Error())
+			}
+			assert.Equal(t, tc.wantWarnings, got)
+		})
+	}
+}
+
+func TestExemptionsManaged(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	file := filepath.Join(t.TempDir(), "exemptions.json")
+	exemptions := newTestExemptions(t, file, now)
+	require.NoError(t, exemptions.SetConfigured([]Exemption{{Rule: "naming", Expires: now.AddDate(0, 1, 0), Reason: "configured"}}))
+
+	_, err := exemptions.Add(Exemption{Rule: "costcenter", Expires: now.AddDate(0, 1, 0)})
+	assert.ErrorContains(t, err, "reason must be set")
+
+	added, err := exemptions.Add(Exemption{Rule: "costcenter", Job: "legacy-*", Expires: now.AddDate(0, 1, 0), Reason: "migration"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, added.ID)
+	assert.Equal(t, ExemptionSourceAPI, added.Source)
+	assert.Len(t, exemptions.List(), 2)
+
+	reloaded := newTestExemptions(t, file, now)
+	assert.Equal(t, []Exemption{added}, reloaded.List(), "managed exemptions are loaded from the file")
+
+	removed, err := exemptions.Remove("config-0")
+	require.NoError(t, err)
+	assert.False(t, removed, "configured exemptions can't be removed via the API")
+
+	removed, err = exemptions.Remove(added.ID)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	reloaded = newTestExemptions(t, file, now)
+	assert.Empty(t, reloaded.List())
+}
+
+func TestNewExemptionsFailsOnInvalidFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "exemptions.json")
+	require.NoError(t, os.WriteFile(file, []byte("not json"), 0o600))
+	_, err := NewExemptions(file, time.Hour, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "failed to parse exemptions")
+}
+
+func TestJobHandlerExemptions(t *testing.T) {
+	rejecting := new(testutil.MockValidator)
+	rejecting.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf("missing owner"))
+	handler := NewJobHandler(nil, []JobValidator{rejecting}, hclog.NewNullLogger(), false)
+
+	exemptions, err := NewExemptions("", time.Hour, hclog.NewNullLogger())
+	require.NoError(t, err)
+	_, err = exemptions.Add(Exemption{Rule: "mock-validator", Job: "legacy", Expires: time.Now().Add(48 * time.Hour), Reason: "migration"})
+	require.NoError(t, err)
+	handler.UseExemptions(exemptions)
+
+	warnings, err := handler.AdmissionValidators(&types.Payload{Job: &api.Job{ID: pointer("legacy")}})
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.ErrorContains(t, warnings[0], "mock-validator (exempted until")
+
+	_, err = handler.AdmissionValidators(&types.Payload{Job: &api.Job{ID: pointer("web")}})
+	assert.ErrorContains(t, err, "missing owner")
+}
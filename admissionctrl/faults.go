@@ -0,0 +1,100 @@
+package admissionctrl
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mxab/nacp/metrics"
+)
+
+var ErrInjectedFault = errors.New("injected fault")
+
+// Fault is an artificial delay and/or failure of a rule, used to test how
+// the setup copes with slow or failing rules before enabling them for real.
+type Fault struct {
+	Delay time.Duration
+	// ErrorPercent is the share of evaluations that fail, between 0 and 100
+	ErrorPercent float64
+}
+
+func (f Fault) Validate() error {
+	if f.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	if f.ErrorPercent < 0 || f.ErrorPercent > 100 {
+		return fmt.Errorf("error percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// FaultInjector holds the faults per rule name, they apply to all mutators and validators with that name.
+type FaultInjector struct {
+	mu     sync.RWMutex
+	faults map[string]Fault
+	random func() float64
+	sleep  func(time.Duration)
+}
+
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{
+		faults: map[string]Fault{},
+		random: rand.Float64,
+		sleep:  time.Sleep,
+	}
+}
+
+func (f *FaultInjector) Set(rule string, fault Fault) error {
+	if err := fault.Validate(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[rule] = fault
+	return nil
+}
+
+func (f *FaultInjector) Remove(rule string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.faults, rule)
+}
+
+func (f *FaultInjector) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = map[string]Fault{}
+}
+
+// Faults returns a copy of the configured faults.
+func (f *FaultInjector) Faults() map[string]Fault {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	faults := make(map[string]Fault, len(f.faults))
+	for rule, fault := range f.faults {
+		faults[rule] = fault
+	}
+	return faults
+}
+
+// Inject applies the fault configured for the rule, it sleeps for the delay
+// and returns ErrInjectedFault for the configured share of calls.
+func (f *FaultInjector) Inject(rule string) error {
+	f.mu.RLock()
+	fault, ok := f.faults[rule]
+	f.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if fault.Delay > 0 {
+		metrics.FaultsInjected.WithLabelValues(rule, "delay").Inc()
+		f.sleep(fault.Delay)
+	}
+	if fault.ErrorPercent > 0 && f.random()*100 < fault.ErrorPercent {
+		metrics.FaultsInjected.WithLabelValues(rule, "error").Inc()
+		return ErrInjectedFault
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package admissionctrl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultInjector(t *testing.T) {
+	tt := []struct {
+		name      string
+		fault     Fault
+		random    float64
+		wantSleep time.Duration
+		wantErr   bool
+	}{
+		{name: "delay only", fault: Fault{Delay: time.Second}, random: 0, wantSleep: time.Second},
+		{name: "error within percentage", fault: Fault{ErrorPercent: 30}, random: 0.29, wantErr: true},
+		{name: "error outside percentage", fault: Fault{ErrorPercent: 30}, random: 0.3},
+		{name: "always fail", fault: Fault{ErrorPercent: 100}, random: 0.999, wantErr: true},
+		{name: "delay and error", fault: Fault{Delay: time.Millisecond, ErrorPercent: 50}, random: 0.1, wantSleep: time.Millisecond, wantErr: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var slept time.Duration
+			f := NewFaultInjector()
+			f.random = func() float64 { return tc.random }
+			f.sleep = func(d time.Duration) { slept += d }
+			require.NoError(t, f.Set("rule", tc.fault))
+
+			err := f.Inject("rule")
+			if tc.wantErr {
+				assert.ErrorIs(t, err, ErrInjectedFault)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantSleep, slept)
+
+			assert.NoError(t, f.Inject("other"), "other rules are not affected")
+		})
+	}
+}
+
+func TestFaultInjectorManageFaults(t *testing.T) {
+	f := NewFaultInjector()
+	assert.Error(t, f.Set("rule", Fault{ErrorPercent: 101}))
+	assert.Error(t, f.Set("rule", Fault{Delay: -time.Second}))
+
+	require.NoError(t, f.Set("a", Fault{ErrorPercent: 10}))
+	require.NoError(t, f.Set("b", Fault{Delay: time.Second}))
+	assert.Equal(t, map[string]Fault{"a": {ErrorPercent: 10}, "b": {Delay: time.Second}}, f.Faults())
+
+	f.Remove("a")
+	assert.Equal(t, map[string]Fault{"b": {Delay: time.Second}}, f.Faults())
+
+	f.Clear()
+	assert.Empty(t, f.Faults())
+}
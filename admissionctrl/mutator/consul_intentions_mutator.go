@@ -0,0 +1,169 @@
+package mutator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+)
+
+// IntentionProvisioner makes sure the source service may connect to the destination service.
+type IntentionProvisioner interface {
+	// Exists reports whether an intention from source to destination exists.
+	Exists(source, destination string) (bool, error)
+	// Allow creates an allow intention from source to destination.
+	Allow(source, destination, description string) error
+}
+
+// ConsulIntentions manages the intentions as service-intentions config entries.
+type ConsulIntentions struct {
+	entries *consulapi.ConfigEntries
+}
+
+func NewConsulIntentions(client *consulapi.Client) *ConsulIntentions {
+	return &ConsulIntentions{entries: client.ConfigEntries()}
+}
+
+func (c *ConsulIntentions) get(destination string) (*consulapi.ServiceIntentionsConfigEntry, uint64, error) {
+	entry, meta, err := c.entries.Get(consulapi.ServiceIntentions, destination, nil)
+	if err != nil {
+		var statusErr consulapi.StatusError
+		if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+			return &consulapi.ServiceIntentionsConfigEntry{Kind: consulapi.ServiceIntentions, Name: destination}, 0, nil
+		}
+		return nil, 0, err
+	}
+	intentions, ok := entry.(*consulapi.ServiceIntentionsConfigEntry)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected config entry %T", entry)
+	}
+	return intentions, meta.LastIndex, nil
+}
+
+func (c *ConsulIntentions) Exists(source, destination string) (bool, error) {
+	entry, _, err := c.get(destination)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range entry.Sources {
+		if s.Name == source || s.Name == "*" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Allow adds the source to the config entry of the destination, the write fails if the entry changed in between.
+func (c *ConsulIntentions) Allow(source, destination, description string) error {
+	entry, index, err := c.get(destination)
+	if err != nil {
+		return err
+	}
+	entry.Sources = append(entry.Sources, &consulapi.SourceIntention{
+		Name:        source,
+		Action:      consulapi.IntentionActionAllow,
+		Description: description,
+	})
+	written, _, err := c.entries.CAS(entry, index, nil)
+	if err != nil {
+		return err
+	}
+	if !written {
+		return fmt.Errorf("intentions of %s were changed concurrently", destination)
+	}
+	return nil
+}
+
+// ConsulIntentionsMutator creates allow intentions for the Connect upstreams of registered jobs.
+// The job itself is never changed and failures only result in warnings, so Consul can't block deployments.
+type ConsulIntentionsMutator struct {
+	name        string
+	logger      hclog.Logger
+	provisioner IntentionProvisioner
+	dryRun      bool
+}
+
+func NewConsulIntentionsMutator(logger hclog.Logger, name string, provisioner IntentionProvisioner, dryRun bool) *ConsulIntentionsMutator {
+	return &ConsulIntentionsMutator{
+		name:        name,
+		logger:      logger,
+		provisioner: provisioner,
+		dryRun:      dryRun,
+	}
+}
+
+func (m *ConsulIntentionsMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	job := payload.Job
+	register := payload.Context != nil && payload.Context.Operation == config.OperationRegister
+
+	var warnings []error
+	for _, link := range upstreamLinks(job) {
+		exists, err := m.provisioner.Exists(link.source, link.destination)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("failed to check intention %s => %s: %w", link.source, link.destination, err))
+			continue
+		}
+		if exists {
+			continue
+		}
+		if m.dryRun || !register {
+			warnings = append(warnings, fmt.Errorf("intention %s => %s is missing and would be created", link.source, link.destination))
+			continue
+		}
+		description := fmt.Sprintf("created by nacp for job %s", *job.ID)
+		if err := m.provisioner.Allow(link.source, link.destination, description); err != nil {
+			warnings = append(warnings, fmt.Errorf("failed to create intention %s => %s: %w", link.source, link.destination, err))
+			continue
+		}
+		// audit log entry of every change made in consul
+		auditFields := []interface{}{"rule", m.name, "source", link.source, "destination", link.destination, "job", *job.ID}
+		if payload.Context != nil {
+			auditFields = append(auditFields, "accessorID", payload.Context.AccessorID, "clientIP", payload.Context.ClientIP)
+		}
+		m.logger.Info("created consul intention", auditFields...)
+	}
+	return job, warnings, nil
+}
+
+func (m *ConsulIntentionsMutator) Name() string {
+	return m.name
+}
+
+type upstreamLink struct {
+	source      string
+	destination string
+}
+
+func upstreamLinks(job *api.Job) []upstreamLink {
+	var links []upstreamLink
+	seen := map[upstreamLink]bool{}
+	collect := func(services []*api.Service) {
+		for _, service := range services {
+			if service == nil || service.Connect == nil || service.Connect.SidecarService == nil || service.Connect.SidecarService.Proxy == nil {
+				continue
+			}
+			for _, upstream := range service.Connect.SidecarService.Proxy.Upstreams {
+				if upstream == nil || upstream.DestinationName == "" || upstream.DestinationPeer != "" {
+					continue
+				}
+				link := upstreamLink{source: service.Name, destination: upstream.DestinationName}
+				if !seen[link] {
+					seen[link] = true
+					links = append(links, link)
+				}
+			}
+		}
+	}
+	for _, tg := range job.TaskGroups {
+		collect(tg.Services)
+		for _, task := range tg.Tasks {
+			collect(task.Services)
+		}
+	}
+	return links
+}
@@ -0,0 +1,130 @@
+package mutator
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvisioner struct {
+	existing map[string]bool
+	created  []string
+}
+
+func (f *fakeProvisioner) Exists(source, destination string) (bool, error) {
+	return f.existing[source+"=>"+destination], nil
+}
+
+func (f *fakeProvisioner) Allow(source, destination, _ string) error {
+	f.created = append(f.created, source+"=>"+destination)
+	return nil
+}
+
+func upstreamJob() *api.Job {
+	id, group := "shop", "web"
+	return &api.Job{
+		ID: &id,
+		TaskGroups: []*api.TaskGroup{{
+			Name: &group,
+			Services: []*api.Service{{
+				Name: "web",
+				Connect: &api.ConsulConnect{SidecarService: &api.ConsulSidecarService{Proxy: &api.ConsulProxy{
+					Upstreams: []*api.ConsulUpstream{{DestinationName: "db"}, {DestinationName: "cache"}, {DestinationName: "remote", DestinationPeer: "other"}},
+				}}},
+			}},
+		}},
+	}
+}
+
+func TestConsulIntentionsMutator(t *testing.T) {
+	tt := []struct {
+		name         string
+		operation    string
+		dryRun       bool
+		wantCreated  []string
+		wantWarnings []string
+	}{
+		{
+			name:        "register creates missing intentions",
+			operation:   config.OperationRegister,
+			wantCreated: []string{"web=>cache"},
+		},
+		{
+			name:         "dry run",
+			operation:    config.OperationRegister,
+			dryRun:       true,
+			wantWarnings: []string{"intention web => cache is missing and would be created"},
+		},
+		{
+			name:         "plan does not create intentions",
+			operation:    config.OperationPlan,
+			wantWarnings: []string{"intention web => cache is missing and would be created"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			provisioner := &fakeProvisioner{existing: map[string]bool{"web=>db": true}}
+			mutator := NewConsulIntentionsMutator(hclog.NewNullLogger(), "intentions", provisioner, tc.dryRun)
+
+			job := upstreamJob()
+			out, warnings, err := mutator.Mutate(&types.Payload{Job: job, Context: &config.RequestContext{Operation: tc.operation}})
+			require.NoError(t, err)
+			assert.Same(t, job, out, "job is not changed")
+			assert.Equal(t, tc.wantCreated, provisioner.created)
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.Error())
+			}
+			assert.Equal(t, tc.wantWarnings, got)
+		})
+	}
+}
+
+func TestConsulIntentions(t *testing.T) {
+	var written *consulapi.ServiceIntentionsConfigEntry
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/config/service-intentions/db":
+			w.Header().Set("X-Consul-Index", "7")
+			json.NewEncoder(w).Encode(&consulapi.ServiceIntentionsConfigEntry{
+				Kind:    consulapi.ServiceIntentions,
+				Name:    "db",
+				Sources: []*consulapi.SourceIntention{{Name: "api", Action: consulapi.IntentionActionAllow}},
+			})
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/config":
+			assert.Equal(t, "7", r.URL.Query().Get("cas"))
+			body, _ := io.ReadAll(r.Body)
+			written = &consulapi.ServiceIntentionsConfigEntry{}
+			require.NoError(t, json.Unmarshal(body, written))
+			w.Write([]byte("true"))
+		}
+	}))
+	defer consul.Close()
+	client, err := consulapi.NewClient(&consulapi.Config{Address: consul.URL})
+	require.NoError(t, err)
+	intentions := NewConsulIntentions(client)
+
+	exists, err := intentions.Exists("api", "db")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = intentions.Exists("web", "cache")
+	require.NoError(t, err)
+	assert.False(t, exists, "missing config entry")
+
+	require.NoError(t, intentions.Allow("web", "db", "created by nacp"))
+	require.NotNil(t, written)
+	assert.Equal(t, []string{"api", "web"}, []string{written.Sources[0].Name, written.Sources[1].Name})
+}
@@ -0,0 +1,83 @@
+package mutator
+
+import (
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// DeviceSettings are added to tasks requesting a device of a vendor.
+type DeviceSettings struct {
+	Env  map[string]string
+	Meta map[string]string
+}
+
+// DeviceMutator injects vendor specific env vars and meta into tasks requesting devices,
+// values set by the job are kept.
+type DeviceMutator struct {
+	name    string
+	logger  hclog.Logger
+	vendors map[string]DeviceSettings
+}
+
+func NewDeviceMutator(logger hclog.Logger, name string, vendors map[string]DeviceSettings) *DeviceMutator {
+	return &DeviceMutator{
+		name:    name,
+		logger:  logger,
+		vendors: vendors,
+	}
+}
+
+func (m *DeviceMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	job := payload.Job
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			if task.Resources == nil {
+				continue
+			}
+			for _, device := range task.Resources.Devices {
+				if device == nil {
+					continue
+				}
+				settings, ok := m.vendors[deviceVendor(device.Name)]
+				if !ok {
+					continue
+				}
+				m.logger.Debug("injecting device settings", "job", job.ID, "task", task.Name, "device", device.Name)
+				task.Env = mergeMissing(task.Env, settings.Env)
+				task.Meta = mergeMissing(task.Meta, settings.Meta)
+			}
+		}
+	}
+	return job, nil, nil
+}
+
+func (m *DeviceMutator) Name() string {
+	return m.name
+}
+
+// deviceVendor returns the vendor of a device request name or an empty string if the name has none.
+func deviceVendor(name string) string {
+	vendor, _, found := strings.Cut(name, "/")
+	if !found {
+		return ""
+	}
+	return vendor
+}
+
+func mergeMissing(target, values map[string]string) map[string]string {
+	if len(values) == 0 {
+		return target
+	}
+	if target == nil {
+		target = make(map[string]string, len(values))
+	}
+	for key, value := range values {
+		if _, exists := target[key]; !exists {
+			target[key] = value
+		}
+	}
+	return target
+}
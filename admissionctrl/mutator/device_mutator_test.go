@@ -0,0 +1,62 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceMutator(t *testing.T) {
+	mutator := NewDeviceMutator(hclog.NewNullLogger(), "devices", map[string]DeviceSettings{
+		"nvidia": {
+			Env:  map[string]string{"NVIDIA_DRIVER_CAPABILITIES": "compute,utility", "CUDA_CACHE_DISABLE": "1"},
+			Meta: map[string]string{"accelerator": "nvidia"},
+		},
+	})
+
+	task := func(env map[string]string, devices ...string) *api.Task {
+		t := &api.Task{Name: "model", Env: env, Resources: &api.Resources{}}
+		for _, name := range devices {
+			t.Resources.Devices = append(t.Resources.Devices, &api.RequestedDevice{Name: name})
+		}
+		return t
+	}
+
+	tt := []struct {
+		name     string
+		task     *api.Task
+		wantEnv  map[string]string
+		wantMeta map[string]string
+	}{
+		{
+			name:     "injects vendor settings",
+			task:     task(nil, "nvidia/gpu"),
+			wantEnv:  map[string]string{"NVIDIA_DRIVER_CAPABILITIES": "compute,utility", "CUDA_CACHE_DISABLE": "1"},
+			wantMeta: map[string]string{"accelerator": "nvidia"},
+		},
+		{
+			name:     "keeps job values",
+			task:     task(map[string]string{"CUDA_CACHE_DISABLE": "0"}, "nvidia/gpu/Tesla K80"),
+			wantEnv:  map[string]string{"NVIDIA_DRIVER_CAPABILITIES": "compute,utility", "CUDA_CACHE_DISABLE": "0"},
+			wantMeta: map[string]string{"accelerator": "nvidia"},
+		},
+		{
+			name: "ignores requests without known vendor",
+			task: task(nil, "gpu", "amd/gpu"),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			job := &api.Job{TaskGroups: []*api.TaskGroup{{Tasks: []*api.Task{tc.task}}}}
+			out, warnings, err := mutator.Mutate(&types.Payload{Job: job})
+			require.NoError(t, err)
+			assert.Empty(t, warnings)
+			assert.Equal(t, tc.wantEnv, out.TaskGroups[0].Tasks[0].Env)
+			assert.Equal(t, tc.wantMeta, out.TaskGroups[0].Tasks[0].Meta)
+		})
+	}
+}
@@ -2,9 +2,12 @@ package mutator
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/mxab/nacp/admissionctrl/errcode"
 	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/pkg/webhook"
 	"net/http"
 	"net/url"
 
@@ -18,14 +21,12 @@ type JsonPatchWebhookMutator struct {
 	logger   hclog.Logger
 	endpoint *url.URL
 	method   string
-}
-type jsonPatchWebhookResponse struct {
-	Patch    []interface{} `json:"patch"`
-	Warnings []string      `json:"warnings"`
-	Errors   []string      `json:"errors"`
+	// maxResponseSize bounds the response, webhook.DefaultMaxResponseSize if not positive
+	maxResponseSize int64
+	patchPolicy     *PatchPolicy
 }
 
-func NewJsonPatchWebhookMutator(name string, endpoint string, method string, logger hclog.Logger) (*JsonPatchWebhookMutator, error) {
+func NewJsonPatchWebhookMutator(name string, endpoint string, method string, maxResponseSize int64, logger hclog.Logger) (*JsonPatchWebhookMutator, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
@@ -35,41 +36,73 @@ func NewJsonPatchWebhookMutator(name string, endpoint string, method string, log
 		logger:   logger,
 		endpoint: u,
 		method:   method,
+
+		maxResponseSize: maxResponseSize,
 	}, nil
 }
 func (j *JsonPatchWebhookMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
-	jobJson, err := json.Marshal(payload)
+	return j.MutateContext(context.Background(), payload)
+}
+
+// MutateContext calls the webhook, cancelling the context aborts the call.
+func (j *JsonPatchWebhookMutator) MutateContext(ctx context.Context, payload *types.Payload) (*api.Job, []error, error) {
+	_, warnings, patchedJobJson, err := j.patch(ctx, payload)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	req, err := http.NewRequest(j.method, j.endpoint.String(), bytes.NewBuffer(jobJson))
+	var patchedJob api.Job
+	err = json.Unmarshal(patchedJobJson, &patchedJob)
 	if err != nil {
 		return nil, nil, err
 	}
+	return &patchedJob, warnings, nil
+}
+
+// MutatePatch returns the patch of the webhook, it passed the patch policy.
+func (j *JsonPatchWebhookMutator) MutatePatch(ctx context.Context, payload *types.Payload) (*types.Mutation, error) {
+	patch, warnings, _, err := j.patch(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Mutation{Patch: patch, Warnings: warnings}, nil
+}
 
+// patch calls the webhook and returns its patch and the patched job.
+func (j *JsonPatchWebhookMutator) patch(ctx context.Context, payload *types.Payload) (jsonpatch.Patch, []error, []byte, error) {
+	jobJson, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, j.method, j.endpoint.String(), bytes.NewBuffer(jobJson))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	req.Header.Set(webhook.HeaderContractVersion, webhook.Version)
 	// Add context headers and body if available
 	if payload.Context != nil {
 		// Add standard headers for backward compatibility
 		if payload.Context.ClientIP != "" {
-			req.Header.Set("X-Forwarded-For", payload.Context.ClientIP) // Standard proxy header
-			req.Header.Set("NACP-Client-IP", payload.Context.ClientIP)  // NACP specific
+			req.Header.Set("X-Forwarded-For", payload.Context.ClientIP)      // Standard proxy header
+			req.Header.Set(webhook.HeaderClientIP, payload.Context.ClientIP) // NACP specific
 		}
 		if payload.Context.AccessorID != "" {
-			req.Header.Set("NACP-Accessor-ID", payload.Context.AccessorID)
+			req.Header.Set(webhook.HeaderAccessorID, payload.Context.AccessorID)
 		}
 	}
 
 	httpClient := &http.Client{}
 	res, err := httpClient.Do(req)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, errcode.Unreachable(j.name, err)
 	}
+	defer res.Body.Close()
 
-	patchResponse := &jsonPatchWebhookResponse{}
-	err = json.NewDecoder(res.Body).Decode(&patchResponse)
+	patchResponse := &webhook.PatchResponse{}
+	err = webhook.DecodeResponse(res.Body, j.maxResponseSize, &patchResponse)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, errcode.Failed(j.name, err)
 	}
 
 	var warnings []error
@@ -82,26 +115,31 @@ func (j *JsonPatchWebhookMutator) Mutate(payload *types.Payload) (*api.Job, []er
 
 	patchJson, err := json.Marshal(patchResponse.Patch)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	patch, err := jsonpatch.DecodePatch(patchJson)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, errcode.Failed(j.name, err)
 	}
 	j.logger.Debug("Got patch fom rule", "rule", j.name, "patch", string(patchJson), "job", payload.Job.ID)
-	patchedJobJson, err := patch.Apply(jobJson)
-
+	// the patch paths are relative to the job, not to the request
+	jobJson, err = json.Marshal(payload.Job)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	var patchedJob api.Job
-	err = json.Unmarshal(patchedJobJson, &patchedJob)
+	patchedJobJson, err := applyPatch(j.patchPolicy, patch, jobJson)
+
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	return &patchedJob, warnings, nil
+	return patch, warnings, patchedJobJson, nil
+}
 
+// UsePatchPolicy rejects patches the policy doesn't allow.
+func (j *JsonPatchWebhookMutator) UsePatchPolicy(policy *PatchPolicy) {
+	j.patchPolicy = policy
 }
+
 func (j *JsonPatchWebhookMutator) Name() string {
 	return j.name
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/mxab/nacp/admissionctrl/types"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
@@ -56,6 +57,23 @@ func TestJsonPatchMutator(t *testing.T) {
 			wantWarns: nil,
 			wantJob:   &api.Job{Meta: map[string]string{"foo": "bar"}},
 		},
+		{
+			name:         "patch keeps the job",
+			endpointPath: "/mutate",
+			method:       "POST",
+
+			response: []byte(`{
+				"patch": [
+					{"op": "add", "path": "/Meta", "value": {"foo": "bar"}}
+				]
+			}`),
+
+			job: &api.Job{ID: pointer("example")},
+
+			wantErr:   nil,
+			wantWarns: nil,
+			wantJob:   &api.Job{ID: pointer("example"), Meta: map[string]string{"foo": "bar"}},
+		},
 		{
 			name:         "with warnings",
 			endpointPath: "/mutate",
@@ -93,7 +111,7 @@ func TestJsonPatchMutator(t *testing.T) {
 			}))
 			defer webhookServer.Close()
 
-			mutator, err := NewJsonPatchWebhookMutator(tc.name, webhookServer.URL+tc.endpointPath, tc.method, hclog.NewNullLogger())
+			mutator, err := NewJsonPatchWebhookMutator(tc.name, webhookServer.URL+tc.endpointPath, tc.method, 0, hclog.NewNullLogger())
 			require.NoError(t, err)
 
 			payload := &types.Payload{Job: tc.job}
@@ -107,3 +125,18 @@ func TestJsonPatchMutator(t *testing.T) {
 		})
 	}
 }
+
+func TestJsonPatchMutator_RejectsOversizedResponse(t *testing.T) {
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"patch": [{"op": "add", "path": "/Meta", "value": {"foo": "` + strings.Repeat("x", 1024) + `"}}]}`))
+	}))
+	defer webhookServer.Close()
+
+	mutator, err := NewJsonPatchWebhookMutator("test", webhookServer.URL, "POST", 512, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	job, warnings, err := mutator.Mutate(&types.Payload{Job: &api.Job{}})
+	assert.EqualError(t, err, "webhook response exceeds the limit of 512 bytes")
+	assert.Nil(t, warnings)
+	assert.Nil(t, job)
+}
@@ -0,0 +1,234 @@
+package mutator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// MetaKey is a canonical job meta key.
+type MetaKey struct {
+	Name      string
+	Aliases   []string
+	Required  bool
+	Default   string
+	From      string
+	Lowercase bool
+}
+
+var metaPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// MetaMutator renames job meta keys to their canonical spelling, fills missing values from the request
+// or data sources and rejects jobs without the required keys.
+type MetaMutator struct {
+	name   string
+	logger hclog.Logger
+	keys   []MetaKey
+	// required replaces the required keys for jobs of a namespace
+	required map[string][]string
+}
+
+func NewMetaMutator(logger hclog.Logger, name string, keys []MetaKey, required map[string][]string) (*MetaMutator, error) {
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if err := validateMetaSource(key.From); err != nil {
+			return nil, fmt.Errorf("invalid from of meta key %s: %w", key.Name, err)
+		}
+		known[key.Name] = true
+	}
+	for namespace, names := range required {
+		for _, name := range names {
+			if !known[name] {
+				return nil, fmt.Errorf("namespace %s requires unknown meta key %s", namespace, name)
+			}
+		}
+	}
+	return &MetaMutator{
+		name:     name,
+		logger:   logger,
+		keys:     keys,
+		required: required,
+	}, nil
+}
+
+func validateMetaSource(from string) error {
+	kind, arg, _ := strings.Cut(from, ":")
+	switch {
+	case from == "", from == "identity", from == "group", from == "token_name":
+		return nil
+	case kind == "header" && arg != "":
+		return nil
+	case kind == "data" && arg != "":
+		return nil
+	}
+	return fmt.Errorf("%q must be identity, group, token_name, header:<name> or data:<source>.<path>", from)
+}
+
+func (m *MetaMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	job := payload.Job
+	var warnings []error
+	for _, key := range m.keys {
+		warnings = append(warnings, m.rename(job, key)...)
+	}
+	for _, key := range m.keys {
+		if value, ok := job.Meta[key.Name]; ok && value != "" {
+			if key.Lowercase && value != strings.ToLower(value) {
+				job.Meta[key.Name] = strings.ToLower(value)
+			}
+			continue
+		}
+		value := metaValue(payload, key.From)
+		if value == "" {
+			value = key.Default
+		}
+		if value == "" {
+			continue
+		}
+		if key.Lowercase {
+			value = strings.ToLower(value)
+		}
+		if job.Meta == nil {
+			job.Meta = map[string]string{}
+		}
+		job.Meta[key.Name] = value
+		m.logger.Debug("filled job meta", "job", job.ID, "key", key.Name, "value", value)
+		warnings = append(warnings, fmt.Errorf("meta %s was missing and set to %q", key.Name, value))
+	}
+
+	var errs *multierror.Error
+	for _, name := range m.requiredKeys(job) {
+		if job.Meta[name] == "" {
+			errs = multierror.Append(errs, fmt.Errorf("missing meta %s", name))
+		}
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, nil, err
+	}
+	return job, warnings, nil
+}
+
+func (m *MetaMutator) Name() string {
+	return m.name
+}
+
+// rename moves the values of aliases and differently cased keys to the canonical key, an existing value of the key wins.
+func (m *MetaMutator) rename(job *api.Job, key MetaKey) []error {
+	var variants []string
+	for existing := range job.Meta {
+		if existing == key.Name {
+			continue
+		}
+		if strings.EqualFold(existing, key.Name) || containsFold(key.Aliases, existing) {
+			variants = append(variants, existing)
+		}
+	}
+	// deterministic choice if several variants are set
+	sort.Strings(variants)
+	var warnings []error
+	for _, variant := range variants {
+		value := job.Meta[variant]
+		delete(job.Meta, variant)
+		if current, ok := job.Meta[key.Name]; ok && current != value {
+			warnings = append(warnings, fmt.Errorf("meta %s was dropped, %s is already set to %q", variant, key.Name, current))
+			continue
+		}
+		job.Meta[key.Name] = value
+		warnings = append(warnings, fmt.Errorf("meta %s was renamed to %s", variant, key.Name))
+	}
+	return warnings
+}
+
+func (m *MetaMutator) requiredKeys(job *api.Job) []string {
+	namespace := "default"
+	if job.Namespace != nil && *job.Namespace != "" {
+		namespace = *job.Namespace
+	}
+	if required, ok := m.required[namespace]; ok {
+		return required
+	}
+	var required []string
+	for _, key := range m.keys {
+		if key.Required {
+			required = append(required, key.Name)
+		}
+	}
+	return required
+}
+
+// metaValue resolves the from of a meta key, an empty string means no value.
+func metaValue(payload *types.Payload, from string) string {
+	kind, arg, _ := strings.Cut(from, ":")
+	ctx := payload.Context
+	switch {
+	case from == "" || ctx == nil && kind != "data":
+		return ""
+	case from == "identity":
+		return ctx.Identity
+	case from == "group":
+		if len(ctx.Groups) > 0 {
+			return ctx.Groups[0]
+		}
+		return ""
+	case from == "token_name":
+		if ctx.TokenInfo != nil {
+			return ctx.TokenInfo.Name
+		}
+		return ""
+	case kind == "header":
+		for name, value := range ctx.Headers {
+			if strings.EqualFold(name, arg) {
+				return value
+			}
+		}
+		return ""
+	}
+	return dataValue(payload, arg)
+}
+
+// dataValue looks up <source>.<path> in the data sources, {key} in the path is replaced by the meta value of the key.
+func dataValue(payload *types.Payload, path string) string {
+	missing := false
+	path = metaPlaceholder.ReplaceAllStringFunc(path, func(placeholder string) string {
+		value := payload.Job.Meta[strings.Trim(placeholder, "{}")]
+		if value == "" {
+			missing = true
+		}
+		return value
+	})
+	if missing {
+		return ""
+	}
+	var current interface{} = payload.Data
+	for _, segment := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if current, ok = object[segment]; !ok {
+			return ""
+		}
+	}
+	switch v := current.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package mutator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetaMutator(t *testing.T) {
+	keys := []MetaKey{
+		{Name: "owner", Required: true, From: "identity", Lowercase: true},
+		{Name: "team", Required: true, From: "data:owners.{owner}.team"},
+		{Name: "cost-center", Aliases: []string{"costcenter", "cost_center"}, From: "data:teams.{team}.costcenter", Default: "shared"},
+		{Name: "git-sha", From: "header:X-Git-Sha"},
+	}
+	mutator, err := NewMetaMutator(hclog.NewNullLogger(), "meta", keys, map[string][]string{"sandbox": {}})
+	require.NoError(t, err)
+
+	data := map[string]interface{}{
+		"owners": map[string]interface{}{"alice": map[string]interface{}{"team": "payments"}},
+		"teams":  map[string]interface{}{"payments": map[string]interface{}{"costcenter": json.Number("4711")}},
+	}
+
+	tt := []struct {
+		name         string
+		namespace    string
+		meta         map[string]string
+		context      *config.RequestContext
+		wantMeta     map[string]string
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name:     "keeps complete meta",
+			meta:     map[string]string{"owner": "bob", "team": "search", "cost-center": "1", "git-sha": "abc"},
+			wantMeta: map[string]string{"owner": "bob", "team": "search", "cost-center": "1", "git-sha": "abc"},
+		},
+		{
+			name:     "normalizes keys and values",
+			meta:     map[string]string{"Owner": "Bob", "TEAM": "search", "cost_center": "1"},
+			wantMeta: map[string]string{"owner": "bob", "team": "search", "cost-center": "1"},
+			wantWarnings: []string{
+				"meta Owner was renamed to owner",
+				"meta TEAM was renamed to team",
+				"meta cost_center was renamed to cost-center",
+			},
+		},
+		{
+			name:         "canonical key wins over variants",
+			meta:         map[string]string{"owner": "bob", "OWNER": "alice", "team": "search", "cost-center": "1"},
+			wantMeta:     map[string]string{"owner": "bob", "team": "search", "cost-center": "1"},
+			wantWarnings: []string{`meta OWNER was dropped, owner is already set to "bob"`},
+		},
+		{
+			name:     "fills defaults from the request and data sources",
+			context:  &config.RequestContext{Identity: "Alice", Headers: map[string]string{"X-Git-Sha": "abc"}},
+			wantMeta: map[string]string{"owner": "alice", "team": "payments", "cost-center": "4711", "git-sha": "abc"},
+			wantWarnings: []string{
+				`meta owner was missing and set to "alice"`,
+				`meta team was missing and set to "payments"`,
+				`meta cost-center was missing and set to "4711"`,
+				`meta git-sha was missing and set to "abc"`,
+			},
+		},
+		{
+			name:     "falls back to the default",
+			meta:     map[string]string{"owner": "bob", "team": "search"},
+			wantMeta: map[string]string{"owner": "bob", "team": "search", "cost-center": "shared"},
+			wantWarnings: []string{
+				`meta cost-center was missing and set to "shared"`,
+			},
+		},
+		{
+			name:    "rejects missing required keys",
+			context: &config.RequestContext{Identity: "carol"},
+			wantErr: "missing meta team",
+		},
+		{
+			name:      "namespace overrides the required keys",
+			namespace: "sandbox",
+			wantMeta:  map[string]string{"cost-center": "shared"},
+			wantWarnings: []string{
+				`meta cost-center was missing and set to "shared"`,
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			job := &api.Job{Meta: tc.meta}
+			if tc.namespace != "" {
+				job.Namespace = &tc.namespace
+			}
+			out, warnings, err := mutator.Mutate(&types.Payload{Job: job, Context: tc.context, Data: data})
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantMeta, out.Meta)
+			var messages []string
+			for _, w := range warnings {
+				messages = append(messages, w.Error())
+			}
+			assert.Equal(t, tc.wantWarnings, messages)
+		})
+	}
+}
+
+func TestMetaMutatorSources(t *testing.T) {
+	tt := []struct {
+		name    string
+		from    string
+		context *config.RequestContext
+		want    string
+	}{
+		{name: "first group", from: "group", context: &config.RequestContext{Groups: []string{"payments", "admins"}}, want: "payments"},
+		{name: "no groups", from: "group", context: &config.RequestContext{}},
+		{name: "token name", from: "token_name", context: &config.RequestContext{TokenInfo: &api.ACLToken{Name: "ci-payments"}}, want: "ci-payments"},
+		{name: "unresolved token", from: "token_name", context: &config.RequestContext{}},
+		{name: "header is case insensitive", from: "header:x-git-sha", context: &config.RequestContext{Headers: map[string]string{"X-Git-Sha": "abc"}}, want: "abc"},
+		{name: "no context", from: "identity"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			mutator, err := NewMetaMutator(hclog.NewNullLogger(), "meta", []MetaKey{{Name: "owner", From: tc.from}}, nil)
+			require.NoError(t, err)
+			out, _, err := mutator.Mutate(&types.Payload{Job: &api.Job{}, Context: tc.context})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, out.Meta["owner"])
+		})
+	}
+}
+
+func TestNewMetaMutatorFails(t *testing.T) {
+	_, err := NewMetaMutator(hclog.NewNullLogger(), "meta", []MetaKey{{Name: "owner", From: "token"}}, nil)
+	assert.ErrorContains(t, err, "invalid from of meta key owner")
+
+	_, err = NewMetaMutator(hclog.NewNullLogger(), "meta", []MetaKey{{Name: "owner"}}, map[string][]string{"ci": {"git-sha"}})
+	assert.EqualError(t, err, "namespace ci requires unknown meta key git-sha")
+}
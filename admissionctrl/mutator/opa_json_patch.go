@@ -8,24 +8,55 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/errcode"
 	"github.com/mxab/nacp/admissionctrl/notation"
 	"github.com/mxab/nacp/admissionctrl/opa"
 	"github.com/mxab/nacp/admissionctrl/types"
 )
 
 type OpaJsonPatchMutator struct {
-	query  *opa.OpaQuery
-	logger hclog.Logger
-	name   string
+	query       *opa.OpaQuery
+	logger      hclog.Logger
+	name        string
+	patchPolicy *PatchPolicy
 }
 
 func (j *OpaJsonPatchMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	return j.MutateContext(context.Background(), payload)
+}
+
+// MutateContext evaluates the policy, cancelling the context aborts the evaluation.
+func (j *OpaJsonPatchMutator) MutateContext(ctx context.Context, payload *types.Payload) (*api.Job, []error, error) {
+	_, warnings, patched, err := j.patch(ctx, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	var patchedJob api.Job
+	err = json.Unmarshal(patched, &patchedJob)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload.Job = &patchedJob
+
+	return payload.Job, warnings, nil
+}
+
+// MutatePatch returns the patch of the policy, it passed the patch policy.
+func (j *OpaJsonPatchMutator) MutatePatch(ctx context.Context, payload *types.Payload) (*types.Mutation, error) {
+	patch, warnings, _, err := j.patch(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Mutation{Patch: patch, Warnings: warnings}, nil
+}
+
+// patch evaluates the policy and returns its patch and the patched job.
+func (j *OpaJsonPatchMutator) patch(ctx context.Context, payload *types.Payload) (jsonpatch.Patch, []error, []byte, error) {
 	allWarnings := make([]error, 0)
-	ctx := context.TODO()
 
 	results, err := j.query.Query(ctx, payload)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, errcode.Failed(j.Name(), err)
 	}
 
 	errors := results.GetErrors()
@@ -36,7 +67,7 @@ func (j *OpaJsonPatchMutator) Mutate(payload *types.Payload) (*api.Job, []error,
 		for _, warn := range errors {
 			allErrors = multierror.Append(allErrors, fmt.Errorf("%s (%s)", warn, j.Name()))
 		}
-		return nil, nil, allErrors
+		return nil, nil, nil, allErrors
 	}
 
 	warnings := results.GetWarnings()
@@ -50,41 +81,47 @@ func (j *OpaJsonPatchMutator) Mutate(payload *types.Payload) (*api.Job, []error,
 	patchData := results.GetPatch()
 	patchJSON, err := json.Marshal(patchData)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	patch, err := jsonpatch.DecodePatch(patchJSON)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, errcode.Failed(j.Name(), err)
 	}
 	j.logger.Debug("Got patch fom rule", "rule", j.Name(), "patch", string(patchJSON), "job", payload.Job.ID)
 	jobJson, err := json.Marshal(payload.Job)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	patched, err := patch.Apply(jobJson)
+	patched, err := applyPatch(j.patchPolicy, patch, jobJson)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	var patchedJob api.Job
-	err = json.Unmarshal(patched, &patchedJob)
-	if err != nil {
-		return nil, nil, err
-	}
-	payload.Job = &patchedJob
+	return patch, allWarnings, patched, nil
+}
 
-	return payload.Job, allWarnings, nil
+// UsePatchPolicy rejects patches the policy doesn't allow.
+func (j *OpaJsonPatchMutator) UsePatchPolicy(policy *PatchPolicy) {
+	j.patchPolicy = policy
 }
+
 func (j *OpaJsonPatchMutator) Name() string {
 	return j.name
 }
 
-func NewOpaJsonPatchMutator(name, filename, query string, logger hclog.Logger, ImageVerifier notation.ImageVerifier) (*OpaJsonPatchMutator, error) {
+// Trace evaluates the policy for the payload with a full evaluation trace, the patch is not applied.
+func (j *OpaJsonPatchMutator) Trace(payload *types.Payload) *types.Trace {
+	trace := j.query.Trace(context.TODO(), payload)
+	trace.Rule = j.name
+	return trace
+}
+
+func NewOpaJsonPatchMutator(name, filename, query string, logger hclog.Logger, ImageVerifier notation.ImageVerifier, opts ...opa.Option) (*OpaJsonPatchMutator, error) {
 
 	ctx := context.TODO()
 	// read the policy file
-	preparedQuery, err := opa.CreateQuery(filename, query, ctx, ImageVerifier)
+	preparedQuery, err := opa.CreateQuery(filename, query, ctx, ImageVerifier, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,201 @@
+package mutator
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// PatchPolicy guards the JSON patches returned by webhook and OPA mutators, so a compromised endpoint can't hijack jobs.
+type PatchPolicy struct {
+	// ProtectedPaths are JSON pointers to values a patch must not change, a * segment matches every key or index
+	ProtectedPaths []string
+	// MaxOperations is the maximum number of operations of a patch, 0 is unlimited
+	MaxOperations int
+	// TypeChecks rejects operations replacing a value with a value of another JSON type, e.g. an object with a string
+	TypeChecks bool
+}
+
+// applyPatch applies the patch to the document if the policy allows it, a nil policy allows every patch.
+func applyPatch(policy *PatchPolicy, patch jsonpatch.Patch, doc []byte) ([]byte, error) {
+	if policy == nil {
+		return patch.Apply(doc)
+	}
+	if policy.MaxOperations > 0 && len(patch) > policy.MaxOperations {
+		return nil, fmt.Errorf("patch has %d operations, at most %d are allowed", len(patch), policy.MaxOperations)
+	}
+	var before interface{}
+	if err := json.Unmarshal(doc, &before); err != nil {
+		return nil, err
+	}
+	if policy.TypeChecks {
+		if err := checkTypes(patch, before); err != nil {
+			return nil, err
+		}
+	}
+	patched, err := patch.Apply(doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(policy.ProtectedPaths) == 0 {
+		return patched, nil
+	}
+	var after interface{}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return nil, err
+	}
+	// compare the values instead of the operation paths, so replacing or moving a parent is caught too
+	for _, protected := range policy.ProtectedPaths {
+		if path, changed := changedPath(protected, before, after); changed {
+			return nil, fmt.Errorf("patch changes the protected path %s", path)
+		}
+	}
+	return patched, nil
+}
+
+// checkTypes rejects replace and add operations changing the JSON type of an existing value, null can be replaced by anything.
+func checkTypes(patch jsonpatch.Patch, doc interface{}) error {
+	for i, op := range patch {
+		kind := op.Kind()
+		if kind != "replace" && kind != "add" {
+			continue
+		}
+		path, err := op.Path()
+		if err != nil {
+			return err
+		}
+		segments := splitPointer(path)
+		if kind == "add" && len(segments) > 0 {
+			// adding to an array inserts an element instead of replacing one
+			if parent, _ := lookup(doc, segments[:len(segments)-1]); jsonType(parent) == "array" {
+				continue
+			}
+		}
+		current, ok := lookup(doc, segments)
+		if !ok || current == nil {
+			continue
+		}
+		value, err := op.ValueInterface()
+		if err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+		if value != nil && jsonType(value) != jsonType(current) {
+			return fmt.Errorf("operation %d changes the type at %s from %s to %s", i, path, jsonType(current), jsonType(value))
+		}
+	}
+	return nil
+}
+
+// changedPath returns the first concrete path matching the pattern whose value differs between the documents.
+func changedPath(pattern string, before, after interface{}) (string, bool) {
+	segments := splitPointer(pattern)
+	beforeValues, afterValues := map[string]interface{}{}, map[string]interface{}{}
+	expand(before, segments, "", beforeValues)
+	expand(after, segments, "", afterValues)
+
+	paths := make([]string, 0, len(beforeValues)+len(afterValues))
+	for path := range beforeValues {
+		paths = append(paths, path)
+	}
+	for path := range afterValues {
+		if _, ok := beforeValues[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		b, inBefore := beforeValues[path]
+		a, inAfter := afterValues[path]
+		if inBefore != inAfter || !reflect.DeepEqual(a, b) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// expand collects the values at the paths matching the segments.
+func expand(doc interface{}, segments []string, prefix string, values map[string]interface{}) {
+	if len(segments) == 0 {
+		values[prefix] = doc
+		return
+	}
+	segment, rest := segments[0], segments[1:]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if segment == "*" {
+			for key, child := range node {
+				expand(child, rest, prefix+"/"+escapePointer(key), values)
+			}
+		} else if child, ok := node[segment]; ok {
+			expand(child, rest, prefix+"/"+escapePointer(segment), values)
+		}
+	case []interface{}:
+		if segment == "*" {
+			for i, child := range node {
+				expand(child, rest, prefix+"/"+strconv.Itoa(i), values)
+			}
+		} else if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(node) {
+			expand(node[i], rest, prefix+"/"+segment, values)
+		}
+	}
+}
+
+func lookup(doc interface{}, segments []string) (interface{}, bool) {
+	for _, segment := range segments {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			doc = child
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// splitPointer splits a JSON pointer (RFC 6901) into its unescaped segments.
+func splitPointer(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+	}
+	return segments
+}
+
+func escapePointer(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
@@ -0,0 +1,86 @@
+package mutator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPatch(t *testing.T) {
+	job := &api.Job{
+		ID:          pointer("web"),
+		Namespace:   pointer("default"),
+		Meta:        map[string]string{"team": "a"},
+		Datacenters: []string{"dc1"},
+		TaskGroups: []*api.TaskGroup{{
+			Name:  pointer("web"),
+			Count: pointer(1),
+			Tasks: []*api.Task{{Name: "server", Vault: &api.Vault{Policies: []string{"web"}}}},
+		}},
+	}
+	policy := &PatchPolicy{
+		ProtectedPaths: []string{"/ID", "/Namespace", "/TaskGroups/*/Tasks/*/Vault"},
+		MaxOperations:  2,
+		TypeChecks:     true,
+	}
+	tests := []struct {
+		name    string
+		policy  *PatchPolicy
+		patch   string
+		wantErr string
+	}{
+		{name: "allowed", policy: policy, patch: `[{"op": "add", "path": "/Meta/owner", "value": "b"}]`},
+		{name: "no policy", patch: `[{"op": "replace", "path": "/Namespace", "value": "prod"}]`},
+		{name: "protected path", policy: policy, patch: `[{"op": "replace", "path": "/Namespace", "value": "prod"}]`, wantErr: "patch changes the protected path /Namespace"},
+		{name: "protected wildcard path", policy: policy, patch: `[{"op": "remove", "path": "/TaskGroups/0/Tasks/0/Vault"}]`, wantErr: "patch changes the protected path /TaskGroups/0/Tasks/0/Vault"},
+		{name: "replaced parent", policy: policy, patch: `[{"op": "replace", "path": "/TaskGroups", "value": []}]`, wantErr: "patch changes the protected path /TaskGroups/0/Tasks/0/Vault"},
+		{name: "moved into protected path", policy: policy, patch: `[{"op": "move", "from": "/Meta/team", "path": "/ID"}]`, wantErr: "patch changes the protected path /ID"},
+		{name: "unchanged protected path", policy: policy, patch: `[{"op": "replace", "path": "/ID", "value": "web"}]`},
+		{name: "too many operations", policy: policy, patch: `[{"op": "add", "path": "/Meta/a", "value": "1"}, {"op": "add", "path": "/Meta/b", "value": "2"}, {"op": "add", "path": "/Meta/c", "value": "3"}]`, wantErr: "patch has 3 operations, at most 2 are allowed"},
+		{name: "type mismatch", policy: policy, patch: `[{"op": "replace", "path": "/TaskGroups/0/Count", "value": "5"}]`, wantErr: "operation 0 changes the type at /TaskGroups/0/Count from number to string"},
+		{name: "type mismatch on add", policy: policy, patch: `[{"op": "add", "path": "/Meta", "value": ["a"]}]`, wantErr: "operation 0 changes the type at /Meta from object to array"},
+		{name: "type checks disabled", policy: &PatchPolicy{}, patch: `[{"op": "replace", "path": "/Meta", "value": null}]`},
+		{name: "null replaced", policy: policy, patch: `[{"op": "replace", "path": "/Region", "value": "eu"}]`},
+		{name: "array insert", policy: &PatchPolicy{TypeChecks: true}, patch: `[{"op": "add", "path": "/Datacenters/0", "value": {"name": "dc2"}}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := json.Marshal(job)
+			require.NoError(t, err)
+			patch, err := jsonpatch.DecodePatch([]byte(tt.patch))
+			require.NoError(t, err)
+
+			patched, err := applyPatch(tt.policy, patch, doc)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, patched)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, patched)
+		})
+	}
+}
+
+func TestJsonPatchMutator_RejectsProtectedPath(t *testing.T) {
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"patch": [{"op": "replace", "path": "/Namespace", "value": "prod"}]}`))
+	}))
+	defer webhookServer.Close()
+
+	mutator, err := NewJsonPatchWebhookMutator("test", webhookServer.URL, "POST", 0, hclog.NewNullLogger())
+	require.NoError(t, err)
+	mutator.UsePatchPolicy(&PatchPolicy{ProtectedPaths: []string{"/Namespace"}})
+
+	job, _, err := mutator.Mutate(&types.Payload{Job: &api.Job{Namespace: pointer("default")}})
+	assert.EqualError(t, err, "patch changes the protected path /Namespace")
+	assert.Nil(t, job)
+}
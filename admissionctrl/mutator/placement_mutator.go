@@ -0,0 +1,98 @@
+package mutator
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// PlacementMutator forces selected jobs into a node pool and adds required spreads.
+// Jobs that already set a different node pool or spread on the same attribute are rejected,
+// so users can't override the placement.
+type PlacementMutator struct {
+	name     string
+	logger   hclog.Logger
+	selector *selector.Selector
+	nodePool string
+	spreads  []*api.Spread
+}
+
+func NewPlacementMutator(logger hclog.Logger, name string, selector *selector.Selector, nodePool string, spreads []*api.Spread) *PlacementMutator {
+	return &PlacementMutator{
+		name:     name,
+		logger:   logger,
+		selector: selector,
+		nodePool: nodePool,
+		spreads:  spreads,
+	}
+}
+
+func (m *PlacementMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	job := payload.Job
+	if !m.selector.Matches(job) {
+		return job, nil, nil
+	}
+
+	if m.nodePool != "" {
+		switch {
+		case job.NodePool == nil || *job.NodePool == "":
+			m.logger.Debug("setting node pool", "job", job.ID, "node_pool", m.nodePool)
+			nodePool := m.nodePool
+			job.NodePool = &nodePool
+		case *job.NodePool != m.nodePool:
+			return nil, nil, fmt.Errorf("job must run in node pool %s, not %s", m.nodePool, *job.NodePool)
+		}
+	}
+
+	for _, required := range m.spreads {
+		existing := findSpread(job.Spreads, required.Attribute)
+		if existing == nil {
+			m.logger.Debug("adding spread", "job", job.ID, "attribute", required.Attribute)
+			job.Spreads = append(job.Spreads, copySpread(required))
+			continue
+		}
+		if !sameSpread(existing, required) {
+			return nil, nil, fmt.Errorf("spread on %s must not be overridden", required.Attribute)
+		}
+	}
+	return job, nil, nil
+}
+
+func (m *PlacementMutator) Name() string {
+	return m.name
+}
+
+func findSpread(spreads []*api.Spread, attribute string) *api.Spread {
+	for _, spread := range spreads {
+		if spread != nil && spread.Attribute == attribute {
+			return spread
+		}
+	}
+	return nil
+}
+
+func sameSpread(a, b *api.Spread) bool {
+	weight := func(s *api.Spread) int8 {
+		if s.Weight == nil {
+			return 0
+		}
+		return *s.Weight
+	}
+	return weight(a) == weight(b) && (len(a.SpreadTarget) == 0 && len(b.SpreadTarget) == 0 || reflect.DeepEqual(a.SpreadTarget, b.SpreadTarget))
+}
+
+func copySpread(s *api.Spread) *api.Spread {
+	c := &api.Spread{Attribute: s.Attribute}
+	if s.Weight != nil {
+		weight := *s.Weight
+		c.Weight = &weight
+	}
+	for _, target := range s.SpreadTarget {
+		c.SpreadTarget = append(c.SpreadTarget, &api.SpreadTarget{Value: target.Value, Percent: target.Percent})
+	}
+	return c
+}
@@ -0,0 +1,83 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlacementMutator(t *testing.T) {
+	tenant, err := selector.New(&config.Selector{Namespaces: []string{"tenant-a"}})
+	require.NoError(t, err)
+
+	weight := int8(50)
+	spread := &api.Spread{Attribute: "${node.datacenter}", Weight: &weight, SpreadTarget: []*api.SpreadTarget{{Value: "dc1", Percent: 50}, {Value: "dc2", Percent: 50}}}
+	mutator := NewPlacementMutator(hclog.NewNullLogger(), "placement", tenant, "tenant-a", []*api.Spread{spread})
+
+	job := func(namespace string, nodePool string, spreads ...*api.Spread) *api.Job {
+		id := "example"
+		j := &api.Job{ID: &id, Namespace: &namespace, Spreads: spreads}
+		if nodePool != "" {
+			j.NodePool = &nodePool
+		}
+		return j
+	}
+
+	tt := []struct {
+		name     string
+		job      *api.Job
+		nodePool *string
+		spreads  []*api.Spread
+		wantErr  string
+	}{
+		{
+			name:     "injects node pool and spread",
+			job:      job("tenant-a", ""),
+			nodePool: pointer("tenant-a"),
+			spreads:  []*api.Spread{spread},
+		},
+		{
+			name:     "keeps matching settings and other spreads",
+			job:      job("tenant-a", "tenant-a", &api.Spread{Attribute: "${node.unique.id}"}, copySpread(spread)),
+			nodePool: pointer("tenant-a"),
+			spreads:  []*api.Spread{{Attribute: "${node.unique.id}"}, spread},
+		},
+		{
+			name:    "rejects other node pool",
+			job:     job("tenant-a", "gpu"),
+			wantErr: "job must run in node pool tenant-a, not gpu",
+		},
+		{
+			name:    "rejects overridden spread",
+			job:     job("tenant-a", "", &api.Spread{Attribute: "${node.datacenter}", SpreadTarget: []*api.SpreadTarget{{Value: "dc1", Percent: 100}}}),
+			wantErr: "spread on ${node.datacenter} must not be overridden",
+		},
+		{
+			name: "ignores other namespaces",
+			job:  job("default", ""),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out, warnings, err := mutator.Mutate(&types.Payload{Job: tc.job})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, warnings)
+			assert.Equal(t, tc.nodePool, out.NodePool)
+			assert.Equal(t, tc.spreads, out.Spreads)
+		})
+	}
+}
+
+func pointer[T any](v T) *T {
+	return &v
+}
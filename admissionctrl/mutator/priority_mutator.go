@@ -0,0 +1,42 @@
+package mutator
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/priority"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// PriorityMutator rewrites job priorities into the allowed band of the namespace or submitter.
+type PriorityMutator struct {
+	name   string
+	logger hclog.Logger
+	policy *priority.Policy
+}
+
+func NewPriorityMutator(logger hclog.Logger, name string, policy *priority.Policy) *PriorityMutator {
+	return &PriorityMutator{
+		name:   name,
+		logger: logger,
+		policy: policy,
+	}
+}
+
+func (m *PriorityMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	job := payload.Job
+	band := m.policy.Band(payload)
+	current := priority.Of(job)
+	allowed := band.Clamp(current)
+	if allowed == current {
+		return job, nil, nil
+	}
+	m.logger.Debug("rewriting job priority", "job", job.ID, "from", current, "to", allowed)
+	job.Priority = &allowed
+	return job, []error{fmt.Errorf("priority changed from %d to %d, the allowed range is %s", current, allowed, band)}, nil
+}
+
+func (m *PriorityMutator) Name() string {
+	return m.name
+}
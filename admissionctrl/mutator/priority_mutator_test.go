@@ -0,0 +1,54 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/priority"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityMutator(t *testing.T) {
+	mutator := NewPriorityMutator(hclog.NewNullLogger(), "priority", &priority.Policy{
+		Default:       priority.Band{Min: 1, Max: 60},
+		TokenPolicies: map[string]priority.Band{"operator": {Min: 1, Max: 100}},
+	})
+
+	tt := []struct {
+		name         string
+		priority     *int
+		policies     []string
+		wantPriority *int
+		wantWarnings []string
+	}{
+		{name: "unset priority is kept", wantPriority: nil},
+		{name: "allowed priority", priority: pointer(60), wantPriority: pointer(60)},
+		{
+			name:         "lowered into band",
+			priority:     pointer(100),
+			wantPriority: pointer(60),
+			wantWarnings: []string{"priority changed from 100 to 60, the allowed range is 1-60"},
+		},
+		{name: "operators may use high priorities", priority: pointer(100), policies: []string{"operator"}, wantPriority: pointer(100)},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := &types.Payload{Job: &api.Job{Priority: tc.priority}}
+			if tc.policies != nil {
+				payload.Context = &config.RequestContext{TokenInfo: &api.ACLToken{Policies: tc.policies}}
+			}
+			out, warnings, err := mutator.Mutate(payload)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPriority, out.Priority)
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.Error())
+			}
+			assert.Equal(t, tc.wantWarnings, got)
+		})
+	}
+}
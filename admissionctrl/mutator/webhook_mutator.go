@@ -2,8 +2,11 @@ package mutator
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"github.com/mxab/nacp/admissionctrl/errcode"
 	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/pkg/webhook"
 	"io"
 	"net/http"
 	"net/url"
@@ -18,24 +21,30 @@ type WebhookMutator struct {
 }
 
 func (w *WebhookMutator) Mutate(payload *types.Payload) (out *api.Job, warnings []error, err error) {
+	return w.MutateContext(context.Background(), payload)
+}
+
+// MutateContext calls the webhook, cancelling the context aborts the call.
+func (w *WebhookMutator) MutateContext(ctx context.Context, payload *types.Payload) (out *api.Job, warnings []error, err error) {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return nil, nil, err
 	}
-	req, err := http.NewRequest(w.method, w.endpoint.String(), bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, w.method, w.endpoint.String(), bytes.NewBuffer(data))
 	if err != nil {
 		return nil, nil, err
 	}
 
+	req.Header.Set(webhook.HeaderContractVersion, webhook.Version)
 	// Add context headers and body if available
 	if payload.Context != nil {
 		// Add standard headers for backward compatibility
 		if payload.Context.ClientIP != "" {
-			req.Header.Set("X-Forwarded-For", payload.Context.ClientIP) // Standard proxy header
-			req.Header.Set("NACP-Client-IP", payload.Context.ClientIP)  // NACP specific
+			req.Header.Set("X-Forwarded-For", payload.Context.ClientIP)      // Standard proxy header
+			req.Header.Set(webhook.HeaderClientIP, payload.Context.ClientIP) // NACP specific
 		}
 		if payload.Context.AccessorID != "" {
-			req.Header.Set("NACP-Accessor-ID", payload.Context.AccessorID)
+			req.Header.Set(webhook.HeaderAccessorID, payload.Context.AccessorID)
 		}
 	}
 
@@ -46,13 +55,13 @@ func (w *WebhookMutator) Mutate(payload *types.Payload) (out *api.Job, warnings
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, errcode.Unreachable(w.name, err)
 	}
 
 	newJob := &api.Job{}
 	err = json.NewDecoder(resp.Body).Decode(newJob)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, errcode.Failed(w.name, err)
 	}
 	return newJob, nil, nil
 }
@@ -0,0 +1,64 @@
+package notation
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultParallelism bounds the concurrent registry calls of VerifyImages if no parallelism is configured.
+const DefaultParallelism = 4
+
+// BatchVerifier verifies several images at once, e.g. to verify images sharing a digest only once.
+type BatchVerifier interface {
+	ImageVerifier
+	VerifyImages(ctx context.Context, imageReferences []string, parallelism int) map[string]error
+}
+
+// VerifyImages verifies each distinct image once, at most parallelism at a time, and returns the errors
+// of the failed images by reference.
+func VerifyImages(ctx context.Context, verifier ImageVerifier, imageReferences []string, parallelism int) map[string]error {
+	if batch, ok := verifier.(BatchVerifier); ok {
+		return batch.VerifyImages(ctx, imageReferences, parallelism)
+	}
+	return forEach(ctx, distinct(imageReferences), parallelism, verifier.VerifyImage)
+}
+
+// forEach calls fn for the references concurrently, at most parallelism at a time, and collects the errors.
+func forEach(ctx context.Context, references []string, parallelism int, fn func(context.Context, string) error) map[string]error {
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+	errs := map[string]error{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallelism)
+	for _, reference := range references {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(reference string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := fn(ctx, reference); err != nil {
+				mu.Lock()
+				errs[reference] = err
+				mu.Unlock()
+			}
+		}(reference)
+	}
+	wg.Wait()
+	return errs
+}
+
+func distinct(references []string) []string {
+	seen := make(map[string]bool, len(references))
+	var result []string
+	for _, reference := range references {
+		if !seen[reference] {
+			seen[reference] = true
+			result = append(result, reference)
+		}
+	}
+	return result
+}
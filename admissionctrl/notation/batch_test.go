@@ -0,0 +1,61 @@
+package notation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowVerifier tracks the verifications running at the same time.
+type slowVerifier struct {
+	mu      sync.Mutex
+	calls   map[string]int
+	running atomic.Int32
+	max     atomic.Int32
+}
+
+func (v *slowVerifier) VerifyImage(ctx context.Context, imageReference string) error {
+	running := v.running.Add(1)
+	defer v.running.Add(-1)
+	for {
+		max := v.max.Load()
+		if running <= max || v.max.CompareAndSwap(max, running) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	v.mu.Lock()
+	v.calls[imageReference]++
+	v.mu.Unlock()
+	if imageReference == "registry.example.com/invalid:1" {
+		return errors.New("no signature")
+	}
+	return nil
+}
+
+func TestVerifyImages(t *testing.T) {
+	verifier := &slowVerifier{calls: map[string]int{}}
+	images := []string{
+		"registry.example.com/app:1",
+		"registry.example.com/invalid:1",
+		"registry.example.com/app:1",
+		"registry.example.com/sidecar:1",
+		"registry.example.com/proxy:1",
+	}
+
+	errs := VerifyImages(context.Background(), verifier, images, 2)
+	assert.Equal(t, map[string]error{"registry.example.com/invalid:1": errors.New("no signature")}, errs)
+	assert.Equal(t, map[string]int{
+		"registry.example.com/app:1":     1,
+		"registry.example.com/invalid:1": 1,
+		"registry.example.com/sidecar:1": 1,
+		"registry.example.com/proxy:1":   1,
+	}, verifier.calls, "each image is verified once")
+	assert.Equal(t, int32(2), verifier.max.Load(), "at most parallelism verifications run at once")
+}
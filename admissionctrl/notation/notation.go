@@ -3,7 +3,13 @@ package notation
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-hclog"
 	_ "github.com/notaryproject/notation-core-go/signature/cose"
@@ -15,6 +21,7 @@ import (
 	"github.com/notaryproject/notation-go/verifier/truststore"
 	credentials "github.com/oras-project/oras-credentials-go"
 
+	orasregistry "oras.land/oras-go/v2/registry"
 	"oras.land/oras-go/v2/registry/remote"
 	"oras.land/oras-go/v2/registry/remote/auth"
 	"oras.land/oras-go/v2/registry/remote/retry"
@@ -31,6 +38,40 @@ type notationImageVerifier struct {
 	maxSignatureAttempts int
 	logger               hclog.Logger
 	client               remote.Client
+	// mirrors by registry host
+	mirrors map[string]Mirror
+	proxy   *url.URL
+
+	policies   []ImagePolicy
+	truststore truststore.X509TrustStore
+	// verifiers of the image policies by repository
+	mu        sync.Mutex
+	verifiers map[string]notation.Verifier
+}
+
+// Mirror serves the repositories of a registry, e.g. a pull-through cache of the organization.
+type Mirror struct {
+	// Endpoint is the host of the mirror, optionally followed by a repository prefix, e.g. mirror.example.com/dockerhub
+	Endpoint  string
+	PlainHTTP bool
+}
+
+// Option configures the registry access of an image verifier.
+type Option func(*notationImageVerifier)
+
+// WithMirrors looks up the images and signatures of the registries at their mirrors. The trust policy
+// still applies to the original references, so its scopes don't change.
+func WithMirrors(mirrors map[string]Mirror) Option {
+	return func(iv *notationImageVerifier) {
+		iv.mirrors = mirrors
+	}
+}
+
+// WithProxy sends the registry calls through the HTTP proxy instead of the one of the environment.
+func WithProxy(proxy *url.URL) Option {
+	return func(iv *notationImageVerifier) {
+		iv.proxy = proxy
+	}
 }
 
 // LoadTrustPolicyDocument loads a trust policy document from the given path.
@@ -49,13 +90,24 @@ func LoadTrustPolicyDocument(path string) (*trustpolicy.Document, error) {
 }
 
 func NewClientWithFileCredStore(path string) (remote.Client, error) {
+	return newClient(path, nil)
+}
+
+// newClient returns a registry client with the credentials of the file, its calls go through the proxy if set.
+func newClient(path string, proxy *url.URL) (remote.Client, error) {
 
 	store, err := credentials.NewFileStore(path)
 	if err != nil {
 		return nil, err
 	}
+	client := retry.DefaultClient
+	if proxy != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxy)
+		client = &http.Client{Transport: retry.NewTransport(transport)}
+	}
 	return &auth.Client{
-		Client:     retry.DefaultClient,
+		Client:     client,
 		Cache:      auth.DefaultCache,
 		Credential: credentials.Credential(store), // Use the credential store
 	}, nil
@@ -63,23 +115,39 @@ func NewClientWithFileCredStore(path string) (remote.Client, error) {
 
 // NewImageVerifier creates a new ImageVerifier instance with the given trust policy, trust store, and repoPlainHTTP flag.
 // It returns the ImageVerifier instance or an error if the verifier cannot be created.
-func NewImageVerifier(policy *trustpolicy.Document, truststore truststore.X509TrustStore, repoPlainHTTP bool, maxSignatureAttempts int, credStorePath string, logger hclog.Logger) (ImageVerifier, error) {
+func NewImageVerifier(policy *trustpolicy.Document, truststore truststore.X509TrustStore, repoPlainHTTP bool, maxSignatureAttempts int, credStorePath string, logger hclog.Logger, opts ...Option) (ImageVerifier, error) {
 
-	verifier, err := verifier.New(policy, truststore, nil)
-	if err != nil {
+	iv := &notationImageVerifier{
+		repoPlainHTTP:        repoPlainHTTP,
+		logger:               logger,
+		maxSignatureAttempts: maxSignatureAttempts,
+		truststore:           truststore,
+	}
+	for _, opt := range opts {
+		opt(iv)
+	}
+	// the trust policy document is optional if image policies are configured
+	if policy != nil || len(iv.policies) == 0 {
+		verifier, err := verifier.New(policy, truststore, nil)
+		if err != nil {
+			return nil, err
+		}
+		iv.verifier = verifier
+	}
+	if err := validatePolicies(iv.policies); err != nil {
 		return nil, err
 	}
-	client, err := NewClientWithFileCredStore(credStorePath)
+	for registry, mirror := range iv.mirrors {
+		if _, err := mirrorReference(orasregistry.Reference{Registry: registry, Repository: "test"}, mirror); err != nil {
+			return nil, fmt.Errorf("invalid mirror of registry %s: %w", registry, err)
+		}
+	}
+	client, err := newClient(credStorePath, iv.proxy)
 	if err != nil {
 		return nil, err
 	}
-	return &notationImageVerifier{
-		verifier:             verifier,
-		repoPlainHTTP:        repoPlainHTTP,
-		logger:               logger,
-		maxSignatureAttempts: maxSignatureAttempts,
-		client:               client,
-	}, nil
+	iv.client = client
+	return iv, nil
 
 }
 
@@ -89,17 +157,16 @@ func (iv *notationImageVerifier) VerifyImage(ctx context.Context, imageReference
 
 	// derived from https://pkg.go.dev/github.com/notaryproject/notation-go@v1.0.1#example-package-RemoteVerify
 
-	remoteRepo, err := remote.NewRepository(imageReference)
+	ref, err := orasregistry.ParseReference(imageReference)
 	if err != nil {
-		iv.logger.Debug("Remote repository creation failed", "err", err, "reference", imageReference)
 		return err
 	}
-	remoteRepo.PlainHTTP = iv.repoPlainHTTP
-
-	remoteRepo.Client = iv.client
-
+	verifier, err := iv.verifierFor(ref.Registry, ref.Registry+"/"+ref.Repository)
+	if err != nil {
+		return err
+	}
+	remoteRepo, err := iv.repository(imageReference)
 	if err != nil {
-		iv.logger.Debug("Remote repository creation failed", "err", err, "reference", imageReference)
 		return err
 	}
 	repo := registry.NewRepository(remoteRepo)
@@ -113,7 +180,7 @@ func (iv *notationImageVerifier) VerifyImage(ctx context.Context, imageReference
 	// remote verify core process
 	// upon successful verification, the target manifest descriptor
 	// and signature verification outcome are returned.
-	targetDesc, _, err := notation.Verify(ctx, iv.verifier, repo, verifyOptions)
+	targetDesc, _, err := notation.Verify(ctx, verifier, repo, verifyOptions)
 	if err != nil {
 		iv.logger.Debug("Notation verify failed", "err", err, "reference", imageReference)
 		return err
@@ -122,3 +189,98 @@ func (iv *notationImageVerifier) VerifyImage(ctx context.Context, imageReference
 	iv.logger.Debug("Notation verify succeeded", "reference", imageReference, "digest", targetDesc.Digest, "size", targetDesc.Size, "mediaType", targetDesc.MediaType)
 	return nil
 }
+
+// VerifyImages resolves the tags of the images to digests first, so images referenced by several tags or
+// by tag and digest are verified once.
+func (iv *notationImageVerifier) VerifyImages(ctx context.Context, imageReferences []string, parallelism int) map[string]error {
+	references := distinct(imageReferences)
+	var mu sync.Mutex
+	digests := make(map[string]string, len(references))
+	errs := forEach(ctx, references, parallelism, func(ctx context.Context, imageReference string) error {
+		digestReference, err := iv.resolve(ctx, imageReference)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		digests[imageReference] = digestReference
+		mu.Unlock()
+		return nil
+	})
+
+	unique := make([]string, 0, len(digests))
+	for _, reference := range references {
+		if digestReference, ok := digests[reference]; ok {
+			unique = append(unique, digestReference)
+		}
+	}
+	verifyErrs := forEach(ctx, distinct(unique), parallelism, iv.VerifyImage)
+	for reference, digestReference := range digests {
+		if err, ok := verifyErrs[digestReference]; ok {
+			errs[reference] = err
+		}
+	}
+	return errs
+}
+
+// resolve returns the reference of the image by digest.
+func (iv *notationImageVerifier) resolve(ctx context.Context, imageReference string) (string, error) {
+	remoteRepo, err := iv.repository(imageReference)
+	if err != nil {
+		return "", err
+	}
+	if _, err := remoteRepo.Reference.Digest(); err == nil {
+		return imageReference, nil
+	}
+	desc, err := remoteRepo.Resolve(ctx, remoteRepo.Reference.ReferenceOrDefault())
+	if err != nil {
+		iv.logger.Debug("Resolving the image digest failed", "err", err, "reference", imageReference)
+		return "", err
+	}
+	// the digest of the original reference, a mirror is only where it is looked up
+	resolved, err := orasregistry.ParseReference(imageReference)
+	if err != nil {
+		return "", err
+	}
+	resolved.Reference = desc.Digest.String()
+	return resolved.String(), nil
+}
+
+// repository returns the repository of the image, at the mirror of its registry if there is one.
+func (iv *notationImageVerifier) repository(imageReference string) (*remote.Repository, error) {
+	ref, err := orasregistry.ParseReference(imageReference)
+	if err != nil {
+		iv.logger.Debug("Remote repository creation failed", "err", err, "reference", imageReference)
+		return nil, err
+	}
+	plainHTTP := iv.repoPlainHTTP
+	if mirror, ok := iv.mirrors[ref.Registry]; ok {
+		if ref, err = mirrorReference(ref, mirror); err != nil {
+			return nil, err
+		}
+		plainHTTP = mirror.PlainHTTP
+		iv.logger.Debug("Looking up the image at the registry mirror", "reference", imageReference, "mirror", ref.String())
+	}
+	remoteRepo := &remote.Repository{
+		Reference: ref,
+		PlainHTTP: plainHTTP,
+		Client:    iv.client,
+	}
+	return remoteRepo, nil
+}
+
+// mirrorReference moves the reference to the mirror, the path of the mirror endpoint prefixes the repository.
+func mirrorReference(ref orasregistry.Reference, mirror Mirror) (orasregistry.Reference, error) {
+	host, prefix, _ := strings.Cut(mirror.Endpoint, "/")
+	mirrored := orasregistry.Reference{
+		Registry:   host,
+		Repository: path.Join(prefix, ref.Repository),
+		Reference:  ref.Reference,
+	}
+	if err := mirrored.ValidateRegistry(); err != nil {
+		return ref, err
+	}
+	if err := mirrored.ValidateRepository(); err != nil {
+		return ref, err
+	}
+	return mirrored, nil
+}
@@ -8,8 +8,12 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/docker/docker/api/types"
@@ -33,6 +37,7 @@ import (
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 	"golang.org/x/crypto/bcrypt"
+	orasregistry "oras.land/oras-go/v2/registry"
 	"oras.land/oras-go/v2/registry/remote"
 )
 
@@ -463,3 +468,45 @@ func writeTruststore(t *testing.T, path string, name string, cert *x509.Certific
 	}
 
 }
+
+func TestMirrorReference(t *testing.T) {
+	ref, err := orasregistry.ParseReference("docker.io/library/nginx:1.25")
+	require.NoError(t, err)
+
+	mirrored, err := mirrorReference(ref, Mirror{Endpoint: "mirror.example.com/dockerhub"})
+	require.NoError(t, err)
+	require.Equal(t, "mirror.example.com/dockerhub/library/nginx:1.25", mirrored.String())
+
+	mirrored, err = mirrorReference(ref, Mirror{Endpoint: "mirror.example.com:5000"})
+	require.NoError(t, err)
+	require.Equal(t, "mirror.example.com:5000/library/nginx:1.25", mirrored.String())
+
+	_, err = mirrorReference(ref, Mirror{})
+	require.Error(t, err)
+}
+
+func TestVerifyImagesThroughMirrorAndProxy(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.Host+r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	client, err := newClient(filepath.Join(t.TempDir(), "config.json"), proxyURL)
+	require.NoError(t, err)
+	iv := &notationImageVerifier{
+		logger:  hclog.NewNullLogger(),
+		client:  client,
+		mirrors: map[string]Mirror{"docker.io": {Endpoint: "mirror.example.com/dockerhub", PlainHTTP: true}},
+	}
+
+	errs := iv.VerifyImages(context.Background(), []string{"docker.io/library/nginx:1.25"}, 1)
+	require.Error(t, errs["docker.io/library/nginx:1.25"], "the proxy doesn't know the image")
+	require.Equal(t, []string{"mirror.example.com/v2/dockerhub/library/nginx/manifests/1.25"}, requested)
+}
@@ -0,0 +1,102 @@
+package notation
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/notaryproject/notation-go"
+	"github.com/notaryproject/notation-go/verifier"
+	"github.com/notaryproject/notation-go/verifier/trustpolicy"
+)
+
+// ImagePolicy is a trust policy for the images of registries and repositories, so registries can require
+// different signers without one trust policy document listing every repository.
+type ImagePolicy struct {
+	Name string
+	// Registries match the registry host of an image
+	Registries []string
+	// Repositories are path.Match patterns of the repository including the registry, e.g. ghcr.io/acme/*
+	Repositories []string
+	TrustStores  []string
+	Identities   []string
+	// Level is the signature verification level, strict if empty
+	Level string
+}
+
+// WithImagePolicies verifies the images matching an image policy with it, the first matching policy applies.
+// The trust policy document of the verifier applies to the other images, without one they fail.
+func WithImagePolicies(policies []ImagePolicy) Option {
+	return func(iv *notationImageVerifier) {
+		iv.policies = policies
+	}
+}
+
+func (p *ImagePolicy) matches(registry, repository string) bool {
+	if slices.Contains(p.Registries, registry) {
+		return true
+	}
+	for _, pattern := range p.Repositories {
+		if ok, _ := path.Match(pattern, repository); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// document returns the trust policy document of the policy for one repository.
+func (p *ImagePolicy) document(repository string) *trustpolicy.Document {
+	level := p.Level
+	if level == "" {
+		level = trustpolicy.LevelStrict.Name
+	}
+	return &trustpolicy.Document{
+		Version: "1.0",
+		TrustPolicies: []trustpolicy.TrustPolicy{{
+			Name:                  p.Name,
+			RegistryScopes:        []string{repository},
+			SignatureVerification: trustpolicy.SignatureVerification{VerificationLevel: level},
+			TrustStores:           p.TrustStores,
+			TrustedIdentities:     p.Identities,
+		}},
+	}
+}
+
+// verifierFor returns the verifier of the repository, the one of the first matching image policy
+// or the one of the trust policy document.
+func (iv *notationImageVerifier) verifierFor(registry, repository string) (notation.Verifier, error) {
+	for i := range iv.policies {
+		policy := &iv.policies[i]
+		if !policy.matches(registry, repository) {
+			continue
+		}
+		iv.mu.Lock()
+		defer iv.mu.Unlock()
+		if v, ok := iv.verifiers[repository]; ok {
+			return v, nil
+		}
+		v, err := verifier.New(policy.document(repository), iv.truststore, nil)
+		if err != nil {
+			return nil, fmt.Errorf("image_policy %s: %w", policy.Name, err)
+		}
+		if iv.verifiers == nil {
+			iv.verifiers = map[string]notation.Verifier{}
+		}
+		iv.verifiers[repository] = v
+		return v, nil
+	}
+	if iv.verifier == nil {
+		return nil, fmt.Errorf("no image policy matches the repository %s", repository)
+	}
+	return iv.verifier, nil
+}
+
+// validatePolicies checks the policies like notation checks a trust policy document.
+func validatePolicies(policies []ImagePolicy) error {
+	for i := range policies {
+		if err := policies[i].document("registry.example.com/validate").Validate(); err != nil {
+			return fmt.Errorf("image_policy %s: %w", policies[i].Name, err)
+		}
+	}
+	return nil
+}
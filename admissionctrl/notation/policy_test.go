@@ -0,0 +1,63 @@
+package notation
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/notaryproject/notation-go/dir"
+	"github.com/notaryproject/notation-go/verifier/truststore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImagePolicies(t *testing.T) {
+	ts := truststore.NewX509TrustStore(dir.NewSysFS(t.TempDir()))
+	policies := []ImagePolicy{
+		{
+			Name:        "internal",
+			Registries:  []string{"registry.example.com"},
+			TrustStores: []string{"ca:internal"},
+			Identities:  []string{"*"},
+		},
+		{
+			Name:         "acme",
+			Repositories: []string{"ghcr.io/acme/*"},
+			TrustStores:  []string{"ca:acme"},
+			Identities:   []string{"x509.subject: C=US, ST=WA, O=Acme, CN=release"},
+			Level:        "audit",
+		},
+	}
+	v, err := NewImageVerifier(nil, ts, false, 50, filepath.Join(t.TempDir(), "config.json"), hclog.NewNullLogger(), WithImagePolicies(policies))
+	require.NoError(t, err, "the trust policy document is optional with image policies")
+	iv := v.(*notationImageVerifier)
+
+	internal, err := iv.verifierFor("registry.example.com", "registry.example.com/team/app")
+	require.NoError(t, err)
+	cached, err := iv.verifierFor("registry.example.com", "registry.example.com/team/app")
+	require.NoError(t, err)
+	assert.Same(t, internal, cached, "the verifier of a repository is reused")
+
+	_, err = iv.verifierFor("ghcr.io", "ghcr.io/acme/app")
+	require.NoError(t, err)
+	assert.Len(t, iv.verifiers, 2)
+
+	_, err = iv.verifierFor("ghcr.io", "ghcr.io/other/app")
+	assert.EqualError(t, err, "no image policy matches the repository ghcr.io/other/app")
+
+	doc := policies[1].document("ghcr.io/acme/app")
+	assert.Equal(t, []string{"ghcr.io/acme/app"}, doc.TrustPolicies[0].RegistryScopes)
+	assert.Equal(t, "audit", doc.TrustPolicies[0].SignatureVerification.VerificationLevel)
+	assert.Equal(t, "strict", policies[0].document("registry.example.com/app").TrustPolicies[0].SignatureVerification.VerificationLevel)
+}
+
+func TestImagePoliciesAreValidated(t *testing.T) {
+	ts := truststore.NewX509TrustStore(dir.NewSysFS(t.TempDir()))
+	_, err := NewImageVerifier(nil, ts, false, 50, filepath.Join(t.TempDir(), "config.json"), hclog.NewNullLogger(), WithImagePolicies([]ImagePolicy{{
+		Name:        "broken",
+		Registries:  []string{"registry.example.com"},
+		TrustStores: []string{"acme"},
+		Identities:  []string{"*"},
+	}}))
+	assert.ErrorContains(t, err, "image_policy broken")
+}
@@ -0,0 +1,56 @@
+package opa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// PolicyCache persists every policy module that compiled successfully to a local directory.
+// If a policy source is unavailable later on, e.g. at boot, the last good copy is used instead.
+// Policies that can be read but fail to compile are not replaced by their copy.
+type PolicyCache struct {
+	dir    string
+	logger hclog.Logger
+}
+
+func NewPolicyCache(dir string, logger hclog.Logger) (*PolicyCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &PolicyCache{
+		dir:    dir,
+		logger: logger,
+	}, nil
+}
+
+// Store saves the module of the given policy file as last known good version.
+func (c *PolicyCache) Store(filename string, module []byte) error {
+	path := c.path(filename)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, module, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load returns the last known good module of the given policy file.
+func (c *PolicyCache) Load(filename string) ([]byte, error) {
+	module, err := os.ReadFile(c.path(filename))
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Warn("Using cached last known good policy", "filename", filename)
+	return module, nil
+}
+
+func (c *PolicyCache) path(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	sum := sha256.Sum256([]byte(filename))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".rego")
+}
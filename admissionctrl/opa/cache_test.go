@@ -0,0 +1,75 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateQueryFallsBackToPolicyCache(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewPolicyCache(t.TempDir(), hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	module, err := os.ReadFile(testutil.Filepath(t, "opa/test.rego"))
+	require.NoError(t, err)
+	policyFile := filepath.Join(t.TempDir(), "test.rego")
+	require.NoError(t, os.WriteFile(policyFile, module, 0644))
+
+	query := "errors = data.opatest.errors"
+	_, err = CreateQuery(policyFile, query, ctx, nil, WithPolicyCache(cache))
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(policyFile))
+	_, err = CreateQuery(policyFile, query, ctx, nil)
+	assert.Error(t, err, "fails without cache")
+
+	cachedQuery, err := CreateQuery(policyFile, query, ctx, nil, WithPolicyCache(cache))
+	require.NoError(t, err)
+
+	result, err := cachedQuery.Query(ctx, &types.Payload{Job: &api.Job{}})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"This is a error message"}, result.GetErrors())
+}
+
+func TestCreateQueryFailsOnBrokenPolicyWithCache(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewPolicyCache(t.TempDir(), hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	module, err := os.ReadFile(testutil.Filepath(t, "opa/test.rego"))
+	require.NoError(t, err)
+	policyFile := filepath.Join(t.TempDir(), "test.rego")
+	require.NoError(t, os.WriteFile(policyFile, module, 0644))
+
+	query := "errors = data.opatest.errors"
+	_, err = CreateQuery(policyFile, query, ctx, nil, WithPolicyCache(cache))
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(policyFile, []byte("package opatest\nerrors[msg] {"), 0644))
+	_, err = CreateQuery(policyFile, query, ctx, nil, WithPolicyCache(cache))
+	assert.ErrorContains(t, err, "rego_parse_error", "compile errors are not hidden by the cached copy")
+
+	require.NoError(t, os.Remove(policyFile))
+	cachedQuery, err := CreateQuery(policyFile, query, ctx, nil, WithPolicyCache(cache))
+	require.NoError(t, err, "the broken policy did not replace the cached copy")
+	result, err := cachedQuery.Query(ctx, &types.Payload{Job: &api.Job{}})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"This is a error message"}, result.GetErrors())
+}
+
+func TestCreateQueryFailsWithoutCachedPolicy(t *testing.T) {
+	cache, err := NewPolicyCache(t.TempDir(), hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	_, err = CreateQuery("/does/not/exist.rego", "errors = data.opatest.errors", context.Background(), nil, WithPolicyCache(cache))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
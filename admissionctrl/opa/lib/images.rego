@@ -0,0 +1,75 @@
+# Helpers for container image references, e.g. ghcr.io/acme/app:1.2@sha256:...
+package nacp.lib.images
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+# parse splits a reference into registry, repository, tag and digest.
+# Images without registry are on docker.io, images without tag and digest use latest.
+parse(ref) := {
+	"registry": registry(ref),
+	"repository": repository(ref),
+	"tag": tag(ref),
+	"digest": digest(ref),
+}
+
+registry(ref) := segments[0] if {
+	_has_registry(ref)
+	segments := split(_name(ref), "/")
+} else := "docker.io"
+
+repository(ref) := split(_path(ref), ":")[0]
+
+tag(ref) := parts[1] if {
+	parts := split(_path(ref), ":")
+	count(parts) == 2
+} else := "" if {
+	digest(ref) != ""
+} else := "latest"
+
+digest(ref) := parts[1] if {
+	parts := split(ref, "@")
+	count(parts) == 2
+} else := ""
+
+# pinned references have a digest
+pinned(ref) if digest(ref) != ""
+
+latest(ref) if tag(ref) == "latest"
+
+# from_registry checks the registry against glob patterns, e.g. ["*.example.com"]
+from_registry(ref, patterns) if {
+	some pattern in patterns
+	glob.match(pattern, [], registry(ref))
+}
+
+# all are the images of all docker and podman tasks of the job
+all contains image if {
+	some group in input.job.TaskGroups
+	some task in group.Tasks
+	image := task.Config.image
+	is_string(image)
+}
+
+# the reference without digest
+_name(ref) := split(ref, "@")[0]
+
+# the first segment is a registry if it looks like a host
+_has_registry(ref) if {
+	segments := split(_name(ref), "/")
+	count(segments) > 1
+	_is_host(segments[0])
+}
+
+_is_host(segment) if indexof(segment, ".") >= 0
+
+_is_host(segment) if indexof(segment, ":") >= 0
+
+_is_host(segment) if segment == "localhost"
+
+# the reference without registry and digest
+_path(ref) := concat("/", array.slice(segments, 1, count(segments))) if {
+	_has_registry(ref)
+	segments := split(_name(ref), "/")
+} else := _name(ref)
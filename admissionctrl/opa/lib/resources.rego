@@ -0,0 +1,28 @@
+# Helpers to sum up the resources of a job, CPU is in MHz and memory in MB like in Nomad
+package nacp.lib.resources
+
+import future.keywords.if
+import future.keywords.in
+
+# group_cpu and group_memory are the resources of one allocation of the group
+group_cpu(group) := sum([_number(task.Resources.CPU) | some task in group.Tasks])
+
+group_memory(group) := sum([_number(task.Resources.MemoryMB) | some task in group.Tasks])
+
+# job_cpu and job_memory are the resources of all allocations of the job
+job_cpu := sum([cpu |
+	some group in input.job.TaskGroups
+	cpu := _count(group) * group_cpu(group)
+])
+
+job_memory := sum([memory |
+	some group in input.job.TaskGroups
+	memory := _count(group) * group_memory(group)
+])
+
+# to_mb converts sizes like "512MiB" or "2GB" to MB, e.g. for limits in data sources
+to_mb(size) := units.parse_bytes(size) / 1048576
+
+_count(group) := group.Count if is_number(group.Count) else := 1
+
+_number(value) := value if is_number(value) else := 0
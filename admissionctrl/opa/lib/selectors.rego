@@ -0,0 +1,31 @@
+# Helpers to select jobs and submitters
+package nacp.lib.selectors
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+namespace := input.job.Namespace if is_string(input.job.Namespace) else := "default"
+
+# in_namespace and job_matches check against glob patterns, e.g. ["team-*"]
+in_namespace(patterns) if {
+	some pattern in patterns
+	glob.match(pattern, [], namespace)
+}
+
+job_matches(patterns) if {
+	some pattern in patterns
+	glob.match(pattern, [], input.job.ID)
+}
+
+has_meta(key) if is_string(input.job.Meta[key])
+
+drivers contains task.Driver if {
+	some group in input.job.TaskGroups
+	some task in group.Tasks
+}
+
+# has_policy and in_group check the token policies and the groups of the submitter
+has_policy(policy) if policy in input.context.policies
+
+in_group(group) if group in input.context.groups
@@ -0,0 +1,24 @@
+package opa
+
+import (
+	"embed"
+	"path"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// library are the rego packages below data.nacp.lib every policy can use without shipping them.
+//
+//go:embed lib/*.rego
+var library embed.FS
+
+// libraryModules returns the library modules for a query, the package nacp.lib is reserved for them.
+func libraryModules() []func(*rego.Rego) {
+	entries, _ := library.ReadDir("lib")
+	options := make([]func(*rego.Rego), 0, len(entries))
+	for _, entry := range entries {
+		module, _ := library.ReadFile(path.Join("lib", entry.Name()))
+		options = append(options, rego.Module("nacp/lib/"+entry.Name(), string(module)))
+	}
+	return options
+}
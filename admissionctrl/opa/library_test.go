@@ -0,0 +1,114 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func evalLibrary(t *testing.T, query string, input interface{}) interface{} {
+	options := append(libraryModules(), rego.Query("x = "+query), rego.Input(input))
+	rs, err := rego.New(options...).Eval(context.Background())
+	require.NoError(t, err)
+	if len(rs) == 0 {
+		return nil
+	}
+	return rs[0].Bindings["x"]
+}
+
+func TestLibraryImages(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want map[string]interface{}
+	}{
+		{ref: "nginx", want: map[string]interface{}{"registry": "docker.io", "repository": "nginx", "tag": "latest", "digest": ""}},
+		{ref: "acme/app:1.2", want: map[string]interface{}{"registry": "docker.io", "repository": "acme/app", "tag": "1.2", "digest": ""}},
+		{ref: "ghcr.io/acme/app:1.2", want: map[string]interface{}{"registry": "ghcr.io", "repository": "acme/app", "tag": "1.2", "digest": ""}},
+		{ref: "localhost:5000/app", want: map[string]interface{}{"registry": "localhost:5000", "repository": "app", "tag": "latest", "digest": ""}},
+		{ref: "ghcr.io/acme/app@sha256:abc", want: map[string]interface{}{"registry": "ghcr.io", "repository": "acme/app", "tag": "", "digest": "sha256:abc"}},
+		{ref: "ghcr.io/acme/app:1.2@sha256:abc", want: map[string]interface{}{"registry": "ghcr.io", "repository": "acme/app", "tag": "1.2", "digest": "sha256:abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			assert.Equal(t, tt.want, evalLibrary(t, `data.nacp.lib.images.parse(input.ref)`, map[string]interface{}{"ref": tt.ref}))
+		})
+	}
+
+	assert.Equal(t, true, evalLibrary(t, `data.nacp.lib.images.pinned("ghcr.io/acme/app@sha256:abc")`, nil))
+	assert.Equal(t, true, evalLibrary(t, `data.nacp.lib.images.latest("nginx")`, nil))
+	assert.Equal(t, true, evalLibrary(t, `data.nacp.lib.images.from_registry("registry.example.com/app", ["*.example.com"])`, nil))
+	assert.Nil(t, evalLibrary(t, `data.nacp.lib.images.from_registry("docker.io/app", ["*.example.com"])`, nil))
+}
+
+func TestLibraryResourcesAndSelectors(t *testing.T) {
+	input := map[string]interface{}{
+		"job": map[string]interface{}{
+			"ID":        "team-a-web",
+			"Namespace": "team-a",
+			"Meta":      map[string]interface{}{"owner": "alice"},
+			"TaskGroups": []interface{}{
+				map[string]interface{}{"Count": 3, "Tasks": []interface{}{
+					map[string]interface{}{"Driver": "docker", "Config": map[string]interface{}{"image": "nginx"}, "Resources": map[string]interface{}{"CPU": 100, "MemoryMB": 256}},
+					map[string]interface{}{"Driver": "exec", "Resources": map[string]interface{}{"CPU": 50}},
+				}},
+				map[string]interface{}{"Tasks": []interface{}{
+					map[string]interface{}{"Driver": "docker", "Config": map[string]interface{}{"image": "ghcr.io/acme/app:1.2"}, "Resources": map[string]interface{}{"CPU": 500, "MemoryMB": 1024}},
+				}},
+			},
+		},
+		"context": map[string]interface{}{"policies": []interface{}{"deploy"}},
+	}
+	assert.Equal(t, json.Number("950"), evalLibrary(t, `data.nacp.lib.resources.job_cpu`, input))
+	assert.Equal(t, json.Number("1792"), evalLibrary(t, `data.nacp.lib.resources.job_memory`, input))
+	assert.Equal(t, json.Number("512"), evalLibrary(t, `data.nacp.lib.resources.to_mb("512MiB")`, nil))
+	assert.Equal(t, []interface{}{"ghcr.io/acme/app:1.2", "nginx"}, evalLibrary(t, `data.nacp.lib.images.all`, input))
+
+	assert.Equal(t, "team-a", evalLibrary(t, `data.nacp.lib.selectors.namespace`, input))
+	assert.Equal(t, true, evalLibrary(t, `data.nacp.lib.selectors.in_namespace(["team-*"])`, input))
+	assert.Equal(t, true, evalLibrary(t, `data.nacp.lib.selectors.job_matches(["*-web"])`, input))
+	assert.Equal(t, true, evalLibrary(t, `data.nacp.lib.selectors.has_meta("owner")`, input))
+	assert.Equal(t, []interface{}{"docker", "exec"}, evalLibrary(t, `data.nacp.lib.selectors.drivers`, input))
+	assert.Equal(t, true, evalLibrary(t, `data.nacp.lib.selectors.has_policy("deploy")`, input))
+	assert.Equal(t, "default", evalLibrary(t, `data.nacp.lib.selectors.namespace`, map[string]interface{}{"job": map[string]interface{}{}}))
+}
+
+func TestLibraryInPolicy(t *testing.T) {
+	job := &api.Job{
+		ID: pointerOf("web"),
+		TaskGroups: []*api.TaskGroup{{
+			Count: pointerOf(2),
+			Tasks: []*api.Task{{
+				Name:      "web",
+				Driver:    "docker",
+				Config:    map[string]interface{}{"image": "nginx"},
+				Resources: &api.Resources{MemoryMB: pointerOf(1024)},
+			}},
+		}},
+	}
+	for _, partial := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial=%v", partial), func(t *testing.T) {
+			var opts []Option
+			if partial {
+				opts = append(opts, WithPartialEvaluation())
+			}
+			query, err := CreateQuery(testutil.Filepath(t, "opa/library.rego"), `
+				errors = data.library.errors
+				warnings = data.library.warnings
+			`, context.Background(), nil, opts...)
+			require.NoError(t, err)
+
+			result, err := query.Query(context.Background(), &types.Payload{Job: job})
+			require.NoError(t, err)
+			assert.Equal(t, []interface{}{"image nginx must not use the latest tag"}, result.GetErrors())
+			assert.Equal(t, []interface{}{"job needs more than 1GiB of memory"}, result.GetWarnings())
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"time"
+
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	nacpmetrics "github.com/mxab/nacp/metrics"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/topdown"
+)
+
+// heapCheckInterval is the number of steps between two reads of the heap size, reading it takes about a microsecond.
+const heapCheckInterval = 10000
+
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// Limits bound every evaluation of a policy, zero values are unlimited.
+type Limits struct {
+	Timeout time.Duration
+	// MaxSteps is the number of evaluation steps, e.g. rule and expression evaluations, after which an evaluation is aborted
+	MaxSteps int
+	// MaxHeapBytes aborts evaluations while the heap of the process exceeds it, Go can't account memory to a single evaluation
+	MaxHeapBytes uint64
+}
+
+// WithLimits aborts evaluations that run too long or while the heap is too large, so a pathological policy can't hang or OOM NACP.
+// Builtins are not interrupted, e.g. a single huge numbers.range call still runs to completion.
+func WithLimits(limits Limits) Option {
+	return func(c *queryConfig) {
+		c.limits = limits
+	}
+}
+
+// limiter aborts an evaluation once a limit is exceeded, it runs in the evaluating goroutine.
+type limiter struct {
+	limits   Limits
+	cancel   context.CancelFunc
+	steps    int
+	sample   []metrics.Sample
+	exceeded error
+}
+
+// limit returns the context and evaluation options that enforce the limits.
+func (l Limits) limit(ctx context.Context) (context.Context, context.CancelFunc, *limiter, []rego.EvalOption) {
+	var cancel context.CancelFunc
+	if l.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	if l.MaxSteps <= 0 && l.MaxHeapBytes == 0 {
+		return ctx, cancel, nil, nil
+	}
+	lim := &limiter{limits: l, cancel: cancel, sample: []metrics.Sample{{Name: heapMetric}}}
+	return ctx, cancel, lim, []rego.EvalOption{rego.EvalQueryTracer(lim)}
+}
+
+func (l *limiter) Enabled() bool {
+	return true
+}
+
+func (l *limiter) Config() topdown.TraceConfig {
+	return topdown.TraceConfig{}
+}
+
+func (l *limiter) TraceEvent(topdown.Event) {
+	if l.exceeded != nil {
+		return
+	}
+	l.steps++
+	if l.limits.MaxSteps > 0 && l.steps > l.limits.MaxSteps {
+		l.abort("steps", fmt.Errorf("policy evaluation exceeded %d steps", l.limits.MaxSteps))
+		return
+	}
+	if l.limits.MaxHeapBytes > 0 && l.steps%heapCheckInterval == 0 {
+		metrics.Read(l.sample)
+		if heap := l.sample[0].Value.Uint64(); heap > l.limits.MaxHeapBytes {
+			l.abort("heap", fmt.Errorf("policy evaluation aborted, the heap of %d bytes exceeds %d bytes", heap, l.limits.MaxHeapBytes))
+		}
+	}
+}
+
+func (l *limiter) abort(reason string, err error) {
+	l.exceeded = err
+	nacpmetrics.OpaEvaluationsAborted.WithLabelValues(reason).Inc()
+	l.cancel()
+}
+
+// evalError explains why an evaluation was cancelled.
+func (l Limits) evalError(ctx context.Context, lim *limiter, err error) error {
+	if err == nil || !topdown.IsCancel(err) {
+		return err
+	}
+	if lim != nil && lim.exceeded != nil {
+		return lim.exceeded
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && l.Timeout > 0 {
+		nacpmetrics.OpaEvaluationsAborted.WithLabelValues("timeout").Inc()
+		return errcode.New(errcode.CodeTimeout, "", fmt.Errorf("policy evaluation timed out after %s", l.Timeout))
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package opa
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/metrics"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expensivePolicy iterates over 9 million pairs before it finds nothing,
+// it depends on the input so partial evaluation can't do the work ahead.
+const expensivePolicy = `package limits
+
+errors[msg] {
+	n := count(input.job.ID) * 1000
+	some i, j
+	numbers.range(1, n)[i]
+	numbers.range(1, n)[j]
+	i + j < 0
+	msg := "unreachable"
+}
+`
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		wantErr string
+		aborted string
+	}{
+		{name: "steps", limits: Limits{MaxSteps: 1000}, wantErr: "policy evaluation exceeded 1000 steps", aborted: "steps"},
+		{name: "heap", limits: Limits{MaxHeapBytes: 1}, wantErr: "policy evaluation aborted, the heap of", aborted: "heap"},
+		{name: "timeout", limits: Limits{Timeout: 10 * time.Millisecond}, wantErr: "policy evaluation timed out after 10ms", aborted: "timeout"},
+	}
+	for _, tt := range tests {
+		for _, partial := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s partial=%t", tt.name, partial), func(t *testing.T) {
+				policy := filepath.Join(t.TempDir(), "limits.rego")
+				require.NoError(t, os.WriteFile(policy, []byte(expensivePolicy), 0644))
+				options := []Option{WithLimits(tt.limits)}
+				if partial {
+					options = append(options, WithPartialEvaluation())
+				}
+				query, err := CreateQuery(policy, "errors = data.limits.errors", context.Background(), nil, options...)
+				require.NoError(t, err)
+
+				aborted := metrics.OpaEvaluationsAborted.WithLabelValues(tt.aborted)
+				before := promtestutil.ToFloat64(aborted)
+				_, err = query.Query(context.Background(), &types.Payload{Job: &api.Job{ID: pointerOf("abc")}})
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Equal(t, before+1, promtestutil.ToFloat64(aborted))
+			})
+		}
+	}
+}
+
+func TestLimits_WithinLimits(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "limits.rego")
+	require.NoError(t, os.WriteFile(policy, []byte("package limits\n\nerrors[msg] {\n\tinput.job.ID == \"bad\"\n\tmsg := \"bad job\"\n}\n"), 0644))
+	query, err := CreateQuery(policy, "errors = data.limits.errors", context.Background(), nil,
+		WithLimits(Limits{Timeout: time.Second, MaxSteps: 1000, MaxHeapBytes: 1 << 40}))
+	require.NoError(t, err)
+
+	result, err := query.Query(context.Background(), &types.Payload{Job: &api.Job{ID: pointerOf("bad")}})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"bad job"}, result.GetErrors())
+}
@@ -0,0 +1,159 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// WithStrict lints the policy before it is prepared and compiles it in OPA's strict mode,
+// so deprecated built-ins, unused variables and references to undefined documents fail the load.
+func WithStrict() Option {
+	return func(c *queryConfig) {
+		c.strict = true
+	}
+}
+
+// LintError lists every finding of a policy, one per line.
+type LintError struct {
+	Filename string
+	Findings []string
+}
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf("policy %s failed the lint:\n  %s", e.Filename, strings.Join(e.Findings, "\n  "))
+}
+
+// lintHints explain how to fix the errors of OPA's strict mode, they are matched against the error message.
+var lintHints = []struct {
+	match string
+	hint  string
+}{
+	{"deprecated built-in", "replace it with its successor listed in the OPA policy reference"},
+	{"undefined function", "check the spelling, NACP provides nacp.*, nomad.* and notation_verify_image"},
+	{"is unsafe", "bind the variable in the rule body, e.g. with := or as iteration variable"},
+	{"assigned var", "remove the assignment or rename the variable to _"},
+	{"declared var", "remove the declaration or rename the variable to _"},
+	// OPA already adds a hint to unused arguments
+	{"unused argument", ""},
+	{"unused", "remove the import"},
+	{"shadowed", "rename the variable, it hides a function of the same name"},
+}
+
+// Lint compiles a policy in strict mode with all NACP functions declared and reports undefined data references.
+// It doesn't need a Nomad cluster or notation verifier, the functions are never called.
+func Lint(ctx context.Context, filename string, query string) error {
+	module, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	cfg := &queryConfig{strict: true}
+	WithNomadLookup(nil)(cfg)
+	return lint(ctx, filename, module, query, cfg)
+}
+
+func lint(ctx context.Context, filename string, module []byte, query string, cfg *queryConfig) error {
+	lintErr := &LintError{Filename: filename}
+	parsed, err := ast.ParseModule(filename, string(module))
+	if err != nil {
+		lintErr.Findings = findings(err)
+		return lintErr
+	}
+
+	options := append(regoOptions(filename, module, query, lintVerifier{}, cfg), rego.Strict(true))
+	if _, err := rego.New(options...).PrepareForEval(ctx); err != nil {
+		lintErr.Findings = findings(err)
+	}
+	lintErr.Findings = append(lintErr.Findings, undefinedDataRefs(parsed)...)
+
+	if len(lintErr.Findings) > 0 {
+		return lintErr
+	}
+	return nil
+}
+
+func findings(err error) []string {
+	var astErrors ast.Errors
+	if !errors.As(err, &astErrors) {
+		return []string{err.Error()}
+	}
+	result := make([]string, 0, len(astErrors))
+	for _, astErr := range astErrors {
+		finding := astErr.Message
+		if astErr.Location != nil {
+			finding = fmt.Sprintf("%s:%d: %s", astErr.Location.File, astErr.Location.Row, astErr.Message)
+		}
+		for _, h := range lintHints {
+			if strings.Contains(astErr.Message, h.match) {
+				if h.hint != "" {
+					finding += " (" + h.hint + ")"
+				}
+				break
+			}
+		}
+		result = append(result, finding)
+	}
+	return result
+}
+
+// undefinedDataRefs finds references to data documents that neither the policy, the library nor the data sources define.
+// References into other packages are not resolved, there is only one module per policy.
+func undefinedDataRefs(module *ast.Module) []string {
+	pkg := module.Package.Path
+	rules := map[string]bool{}
+	for _, rule := range module.Rules {
+		rules[rule.Head.Ref()[0].String()] = true
+	}
+	external := []ast.Ref{ast.MustParseRef("data.nacp.lib"), dataSourcesRef}
+
+	var result []string
+	seen := map[string]bool{}
+	ast.WalkRefs(module, func(ref ast.Ref) bool {
+		if !ref.HasPrefix(ast.DefaultRootRef) {
+			return false
+		}
+		prefix := ref.ConstantPrefix()
+		if isDefined(prefix, pkg, rules, external) || seen[prefix.String()] {
+			return false
+		}
+		seen[prefix.String()] = true
+		finding := fmt.Sprintf("undefined reference %s (define the rule in the policy or load the document as data_source)", prefix)
+		if loc := ref[0].Location; loc != nil {
+			finding = fmt.Sprintf("%s:%d: %s", loc.File, loc.Row, finding)
+		}
+		result = append(result, finding)
+		return false
+	})
+	return result
+}
+
+func isDefined(ref ast.Ref, pkg ast.Ref, rules map[string]bool, external []ast.Ref) bool {
+	if ref.HasPrefix(pkg) {
+		if len(ref) == len(pkg) {
+			return true
+		}
+		name, ok := ref[len(pkg)].Value.(ast.String)
+		return ok && rules[string(name)]
+	}
+	if pkg.HasPrefix(ref) {
+		return true
+	}
+	for _, e := range external {
+		if ref.HasPrefix(e) || e.HasPrefix(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintVerifier declares notation_verify_image for the lint, it is never called.
+type lintVerifier struct{}
+
+func (lintVerifier) VerifyImage(context.Context, string) error {
+	return errors.New("lint only")
+}
@@ -0,0 +1,108 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePolicy(t *testing.T, policy string) string {
+	path := filepath.Join(t.TempDir(), "policy.rego")
+	require.NoError(t, os.WriteFile(path, []byte(policy), 0644))
+	return path
+}
+
+func TestLint(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		policy   string
+		query    string
+		findings []string
+	}{
+		{
+			name:   "library and nacp functions",
+			policy: "",
+			query:  "errors = data.library.errors",
+		},
+		{
+			name: "deprecated built-in",
+			policy: `package lint
+errors[msg] {
+	any([true])
+	msg := "x"
+}`,
+			query:    "errors = data.lint.errors",
+			findings: []string{"policy.rego:3: deprecated built-in function calls in expression: any (replace it with its successor listed in the OPA policy reference)"},
+		},
+		{
+			name: "undefined function",
+			policy: `package lint
+errors[msg] {
+	nomad.jobs("default", "app")
+	msg := "x"
+}`,
+			query:    "errors = data.lint.errors",
+			findings: []string{"policy.rego:3: undefined function nomad.jobs (check the spelling, NACP provides nacp.*, nomad.* and notation_verify_image)"},
+		},
+		{
+			name: "undefined references",
+			policy: `package lint
+import data.teams
+errors[msg] {
+	data.lint.allowd
+	data.sources.registries[_]
+	teams[_]
+	msg := "x"
+}
+allowed = true`,
+			query: "errors = data.lint.errors",
+			findings: []string{
+				"policy.rego:2: undefined reference data.teams (define the rule in the policy or load the document as data_source)",
+				"policy.rego:4: undefined reference data.lint.allowd (define the rule in the policy or load the document as data_source)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := testutil.Filepath(t, "opa/library.rego")
+			if tt.policy != "" {
+				path = writePolicy(t, tt.policy)
+			}
+			err := Lint(ctx, path, tt.query)
+			if tt.findings == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var lintErr *LintError
+			require.ErrorAs(t, err, &lintErr)
+			for i := range tt.findings {
+				tt.findings[i] = filepath.Join(filepath.Dir(path), tt.findings[i])
+			}
+			assert.Equal(t, tt.findings, lintErr.Findings)
+		})
+	}
+}
+
+func TestCreateQueryStrict(t *testing.T) {
+	ctx := context.Background()
+	path := writePolicy(t, `package lint
+errors[msg] {
+	x := 1
+	msg := "x"
+}`)
+
+	_, err := CreateQuery(path, "errors = data.lint.errors", ctx, nil)
+	assert.NoError(t, err)
+
+	_, err = CreateQuery(path, "errors = data.lint.errors", ctx, nil, WithStrict())
+	var lintErr *LintError
+	require.ErrorAs(t, err, &lintErr)
+	assert.Contains(t, err.Error(), "assigned var x unused (remove the assignment or rename the variable to _)")
+}
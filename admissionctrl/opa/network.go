@@ -0,0 +1,130 @@
+package opa
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+)
+
+const reverseDNSCacheTTL = time.Minute
+
+// Resolver is the part of net.Resolver used for reverse lookups.
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// WithResolver replaces the resolver used by nacp.reverse_dns, defaults to net.DefaultResolver.
+func WithResolver(resolver Resolver) Option {
+	return func(c *queryConfig) {
+		c.resolver = resolver
+	}
+}
+
+// networkFunctions provides nacp.ip_in_cidrs(ip, cidrs) and nacp.reverse_dns(ip), mostly meant
+// for checks on input.context.clientIP.
+func networkFunctions(resolver Resolver) []func(*rego.Rego) {
+	cache := &reverseDNSCache{
+		resolver: resolver,
+		entries:  make(map[string]cachedLookup),
+	}
+	return []func(*rego.Rego){
+		rego.Function2(
+			&rego.Function{
+				Name: "nacp.ip_in_cidrs",
+				Decl: types.NewFunction(types.Args(types.S, types.NewAny(types.NewArray(nil, types.S), types.NewSet(types.S))), types.B),
+			},
+			func(_ rego.BuiltinContext, ipTerm, cidrsTerm *ast.Term) (*ast.Term, error) {
+				str, ok := ipTerm.Value.(ast.String)
+				if !ok {
+					return nil, fmt.Errorf("nacp.ip_in_cidrs expects ip as string")
+				}
+				ip := net.ParseIP(string(str))
+				if ip == nil {
+					return ast.BooleanTerm(false), nil
+				}
+				var cidrs []string
+				collect := func(t *ast.Term) {
+					if s, ok := t.Value.(ast.String); ok {
+						cidrs = append(cidrs, string(s))
+					}
+				}
+				switch v := cidrsTerm.Value.(type) {
+				case *ast.Array:
+					v.Foreach(collect)
+				case ast.Set:
+					v.Foreach(collect)
+				}
+				for _, cidr := range cidrs {
+					_, network, err := net.ParseCIDR(cidr)
+					if err != nil {
+						return nil, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+					}
+					if network.Contains(ip) {
+						return ast.BooleanTerm(true), nil
+					}
+				}
+				return ast.BooleanTerm(false), nil
+			}),
+		rego.Function1(
+			&rego.Function{
+				Name: "nacp.reverse_dns",
+				Decl: types.NewFunction(types.Args(types.S), types.NewArray(nil, types.S)),
+			},
+			func(bctx rego.BuiltinContext, ipTerm *ast.Term) (*ast.Term, error) {
+				str, ok := ipTerm.Value.(ast.String)
+				if !ok {
+					return nil, fmt.Errorf("nacp.reverse_dns expects ip as string")
+				}
+				names, err := cache.lookup(bctx.Context, string(str))
+				if err != nil {
+					return nil, err
+				}
+				terms := make([]*ast.Term, 0, len(names))
+				for _, name := range names {
+					terms = append(terms, ast.StringTerm(name))
+				}
+				return ast.ArrayTerm(terms...), nil
+			}),
+	}
+}
+
+type reverseDNSCache struct {
+	resolver Resolver
+	mu       sync.Mutex
+	entries  map[string]cachedLookup
+}
+
+// lookup returns the sorted host names without trailing dot, unresolvable addresses result in no names.
+func (c *reverseDNSCache) lookup(ctx context.Context, ip string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[ip]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value.([]string), nil
+	}
+
+	names, err := c.resolver.LookupAddr(ctx, ip)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+			return nil, err
+		}
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, strings.TrimSuffix(name, "."))
+	}
+	sort.Strings(result)
+
+	c.mu.Lock()
+	c.entries[ip] = cachedLookup{value: result, expires: time.Now().Add(reverseDNSCacheTTL)}
+	c.mu.Unlock()
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package opa
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver struct {
+	names map[string][]string
+	calls int
+}
+
+func (r *fakeResolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	r.calls++
+	names, ok := r.names[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func TestNetworkBuiltins(t *testing.T) {
+	resolver := &fakeResolver{names: map[string][]string{
+		"10.1.2.3": {"runner-1.ci.example.com."},
+	}}
+
+	ctx := context.Background()
+	query, err := CreateQuery(testutil.Filepath(t, "opa/network.rego"), `
+		errors = data.network.errors
+		warnings = data.network.warnings
+	`, ctx, nil, WithResolver(resolver))
+	require.NoError(t, err)
+
+	tt := []struct {
+		name         string
+		namespace    string
+		clientIP     string
+		wantErrors   []interface{}
+		wantWarnings []interface{}
+	}{
+		{
+			name:         "ci subnet deploys to prod",
+			namespace:    "prod",
+			clientIP:     "10.1.2.3",
+			wantErrors:   []interface{}{},
+			wantWarnings: []interface{}{},
+		},
+		{
+			name:         "ipv6 ci subnet deploys to prod",
+			namespace:    "prod",
+			clientIP:     "fd00::1",
+			wantErrors:   []interface{}{},
+			wantWarnings: []interface{}{"job was not submitted from a CI runner"},
+		},
+		{
+			name:         "other subnet deploys to prod",
+			namespace:    "prod",
+			clientIP:     "192.168.0.1",
+			wantErrors:   []interface{}{"192.168.0.1 may not deploy to prod"},
+			wantWarnings: []interface{}{"job was not submitted from a CI runner"},
+		},
+		{
+			name:         "other subnet deploys to dev",
+			namespace:    "dev",
+			clientIP:     "192.168.0.1",
+			wantErrors:   []interface{}{},
+			wantWarnings: []interface{}{"job was not submitted from a CI runner"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := query.Query(ctx, &types.Payload{
+				Job:     &api.Job{ID: pointerOf("example"), Namespace: pointerOf(tc.namespace)},
+				Context: &config.RequestContext{ClientIP: tc.clientIP},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantErrors, result.GetErrors())
+			assert.Equal(t, tc.wantWarnings, result.GetWarnings())
+		})
+	}
+	assert.Equal(t, 3, resolver.calls, "reverse lookups are cached")
+}
@@ -0,0 +1,169 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+)
+
+// NomadLookup resolves live cluster state for the nomad.* built-in functions.
+// A nil result without error means the object does not exist.
+type NomadLookup interface {
+	Job(ctx context.Context, namespace, id string) (*api.Job, error)
+	Namespace(ctx context.Context, name string) (*api.Namespace, error)
+	NodePool(ctx context.Context, name string) (*api.NodePool, error)
+}
+
+// CachedNomadLookup queries the Nomad API and caches every result, including misses, for the given ttl.
+type CachedNomadLookup struct {
+	client *api.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedLookup
+}
+
+type cachedLookup struct {
+	value   interface{}
+	expires time.Time
+}
+
+func NewCachedNomadLookup(client *api.Client, ttl time.Duration) *CachedNomadLookup {
+	return &CachedNomadLookup{
+		client: client,
+		ttl:    ttl,
+		cache:  make(map[string]cachedLookup),
+	}
+}
+
+func (l *CachedNomadLookup) Job(ctx context.Context, namespace, id string) (*api.Job, error) {
+	v, err := l.lookup("job/"+namespace+"/"+id, func() (interface{}, error) {
+		job, _, err := l.client.Jobs().Info(id, (&api.QueryOptions{Namespace: namespace}).WithContext(ctx))
+		return job, err
+	})
+	job, _ := v.(*api.Job)
+	return job, err
+}
+
+func (l *CachedNomadLookup) Namespace(ctx context.Context, name string) (*api.Namespace, error) {
+	v, err := l.lookup("namespace/"+name, func() (interface{}, error) {
+		namespace, _, err := l.client.Namespaces().Info(name, (&api.QueryOptions{}).WithContext(ctx))
+		return namespace, err
+	})
+	namespace, _ := v.(*api.Namespace)
+	return namespace, err
+}
+
+func (l *CachedNomadLookup) NodePool(ctx context.Context, name string) (*api.NodePool, error) {
+	v, err := l.lookup("node_pool/"+name, func() (interface{}, error) {
+		pool, _, err := l.client.NodePools().Info(name, (&api.QueryOptions{}).WithContext(ctx))
+		return pool, err
+	})
+	pool, _ := v.(*api.NodePool)
+	return pool, err
+}
+
+func (l *CachedNomadLookup) lookup(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	l.mu.Lock()
+	entry, ok := l.cache[key]
+	l.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		if !isNotFound(err) {
+			return nil, err
+		}
+		value = nil
+	}
+
+	l.mu.Lock()
+	l.cache[key] = cachedLookup{value: value, expires: time.Now().Add(l.ttl)}
+	l.mu.Unlock()
+	return value, nil
+}
+
+func isNotFound(err error) bool {
+	var apiErr api.UnexpectedResponseError
+	return errors.As(err, &apiErr) && apiErr.StatusCode() == http.StatusNotFound
+}
+
+// WithNomadLookup registers the built-in functions nomad.job(namespace, id),
+// nomad.namespace(name) and nomad.node_pool(name). They are undefined if the object doesn't exist.
+func WithNomadLookup(lookup NomadLookup) Option {
+	return func(c *queryConfig) {
+		c.regoOptions = append(c.regoOptions,
+			rego.Function2(
+				&rego.Function{
+					Name: "nomad.job",
+					Decl: types.NewFunction(types.Args(types.S, types.S), types.A),
+				},
+				func(bctx rego.BuiltinContext, namespace, id *ast.Term) (*ast.Term, error) {
+					ns, ok1 := namespace.Value.(ast.String)
+					jobID, ok2 := id.Value.(ast.String)
+					if !ok1 || !ok2 {
+						return nil, fmt.Errorf("nomad.job expects namespace and id as string")
+					}
+					job, err := lookup.Job(bctx.Context, string(ns), string(jobID))
+					return toTerm(job, job == nil, err)
+				}),
+			rego.Function1(
+				&rego.Function{
+					Name: "nomad.namespace",
+					Decl: types.NewFunction(types.Args(types.S), types.A),
+				},
+				func(bctx rego.BuiltinContext, name *ast.Term) (*ast.Term, error) {
+					str, ok := name.Value.(ast.String)
+					if !ok {
+						return nil, fmt.Errorf("nomad.namespace expects name as string")
+					}
+					namespace, err := lookup.Namespace(bctx.Context, string(str))
+					return toTerm(namespace, namespace == nil, err)
+				}),
+			rego.Function1(
+				&rego.Function{
+					Name: "nomad.node_pool",
+					Decl: types.NewFunction(types.Args(types.S), types.A),
+				},
+				func(bctx rego.BuiltinContext, name *ast.Term) (*ast.Term, error) {
+					str, ok := name.Value.(ast.String)
+					if !ok {
+						return nil, fmt.Errorf("nomad.node_pool expects name as string")
+					}
+					pool, err := lookup.NodePool(bctx.Context, string(str))
+					return toTerm(pool, pool == nil, err)
+				}),
+		)
+	}
+}
+
+// toTerm converts a lookup result into its JSON representation, a missing object results in undefined.
+func toTerm(v interface{}, missing bool, err error) (*ast.Term, error) {
+	if err != nil || missing {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	value, err := ast.InterfaceToValue(generic)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewTerm(value), nil
+}
@@ -0,0 +1,88 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNomadLookupBuiltins(t *testing.T) {
+	calls := map[string]int{}
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		switch r.URL.Path {
+		case "/v1/namespace/default":
+			json.NewEncoder(w).Encode(&api.Namespace{Name: "default"})
+		case "/v1/node/pool/frozen":
+			json.NewEncoder(w).Encode(&api.NodePool{Name: "frozen", Meta: map[string]string{"frozen": "true"}})
+		case "/v1/node/pool/default":
+			json.NewEncoder(w).Encode(&api.NodePool{Name: "default"})
+		case "/v1/job/example":
+			assert.Equal(t, "default", r.URL.Query().Get("namespace"))
+			json.NewEncoder(w).Encode(&api.Job{ID: pointerOf("example"), Meta: map[string]string{"owner": "team-a"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer nomad.Close()
+
+	client, err := api.NewClient(&api.Config{Address: nomad.URL})
+	require.NoError(t, err)
+	lookup := NewCachedNomadLookup(client, time.Minute)
+
+	ctx := context.Background()
+	query, err := CreateQuery(testutil.Filepath(t, "opa/nomad_lookup.rego"), `
+		errors = data.nomad_lookup.errors
+		warnings = data.nomad_lookup.warnings
+	`, ctx, nil, WithNomadLookup(lookup))
+	require.NoError(t, err)
+
+	tt := []struct {
+		name         string
+		job          *api.Job
+		wantErrors   []interface{}
+		wantWarnings []interface{}
+	}{
+		{
+			name:         "all fine",
+			job:          &api.Job{ID: pointerOf("example"), Namespace: pointerOf("default"), NodePool: pointerOf("default"), Meta: map[string]string{"owner": "team-a"}},
+			wantErrors:   []interface{}{},
+			wantWarnings: []interface{}{},
+		},
+		{
+			name:         "missing namespace",
+			job:          &api.Job{ID: pointerOf("example"), Namespace: pointerOf("missing"), NodePool: pointerOf("default")},
+			wantErrors:   []interface{}{"namespace missing does not exist"},
+			wantWarnings: []interface{}{},
+		},
+		{
+			name:         "frozen pool and changed owner",
+			job:          &api.Job{ID: pointerOf("example"), Namespace: pointerOf("default"), NodePool: pointerOf("frozen"), Meta: map[string]string{"owner": "team-b"}},
+			wantErrors:   []interface{}{"node pool frozen is frozen"},
+			wantWarnings: []interface{}{"job owner changed"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := query.Query(ctx, &types.Payload{Job: tc.job})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantErrors, result.GetErrors())
+			assert.Equal(t, tc.wantWarnings, result.GetWarnings())
+		})
+	}
+	assert.Equal(t, 1, calls["/v1/namespace/default"], "lookups are cached")
+	assert.Equal(t, 1, calls["/v1/namespace/missing"], "misses are cached")
+}
+
+func pointerOf[T any](v T) *T {
+	return &v
+}
@@ -3,32 +3,221 @@ package opa
 import (
 	"context"
 	"errors"
+	"fmt"
 	types2 "github.com/mxab/nacp/admissionctrl/types"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/mxab/nacp/admissionctrl/notation"
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/topdown"
 	"github.com/open-policy-agent/opa/types"
 )
 
 type OpaQuery struct {
 	query *rego.PreparedEvalQuery
+	// bindings are set instead of query if the query was partially evaluated
+	bindings []partialBinding
+	limits   Limits
+}
+
+// partialBinding is a partially evaluated "name = ref" expression of a query.
+type partialBinding struct {
+	name  string
+	query rego.PreparedEvalQuery
 }
 type OpaQueryResult struct {
 	resultSet *rego.ResultSet
 }
 
-func CreateQuery(filename string, query string, ctx context.Context, verifier notation.ImageVerifier) (*OpaQuery, error) {
+// Option customizes how a query is prepared.
+type Option func(*queryConfig)
+
+type queryConfig struct {
+	cache       *PolicyCache
+	resolver    Resolver
+	location    *time.Location
+	calendars   map[string]map[string]bool
+	clock       func() time.Time
+	store       storage.Store
+	partialEval bool
+	strict      bool
+	limits      Limits
+	regoOptions []func(*rego.Rego)
+}
+
+// WithPolicyCache persists the policy module once it compiled and falls back to the cached
+// copy if the policy file can't be read or compiled.
+func WithPolicyCache(cache *PolicyCache) Option {
+	return func(c *queryConfig) {
+		c.cache = cache
+	}
+}
+
+// WithStore evaluates the query against the given data store, e.g. the one holding the data sources.
+func WithStore(store storage.Store) Option {
+	return func(c *queryConfig) {
+		c.store = store
+	}
+}
+
+// WithPartialEvaluation partially evaluates the query against the policy when it is prepared,
+// so only the input dependent parts are evaluated per request. Functions returning live data
+// (time, nomad lookups, dns, image verification) and data sources are still evaluated per request.
+func WithPartialEvaluation() Option {
+	return func(c *queryConfig) {
+		c.partialEval = true
+	}
+}
+
+func CreateQuery(filename string, query string, ctx context.Context, verifier notation.ImageVerifier, opts ...Option) (*OpaQuery, error) {
+
+	cfg := &queryConfig{
+		resolver: net.DefaultResolver,
+		location: time.Local,
+		clock:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	prepare := prepareQuery
+	if cfg.partialEval {
+		prepare = prepareQueryPartially
+	}
 
+	// only an unreadable policy falls back to the cache, a broken one fails so a reload keeps the running rules
 	module, err := os.ReadFile(filename)
+	var preparedQuery *OpaQuery
+	if err != nil {
+		if cfg.cache == nil {
+			return nil, err
+		}
+		cached, cacheErr := cfg.cache.Load(filename)
+		if cacheErr != nil {
+			return nil, err
+		}
+		preparedQuery, cacheErr = prepare(ctx, filename, cached, query, verifier, cfg)
+		if cacheErr != nil {
+			return nil, err
+		}
+	} else {
+		if cfg.strict {
+			if err := lint(ctx, filename, module, query, cfg); err != nil {
+				return nil, err
+			}
+		}
+		preparedQuery, err = prepare(ctx, filename, module, query, verifier, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.cache != nil {
+			if err := cfg.cache.Store(filename, module); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	preparedQuery.limits = cfg.limits
+	return preparedQuery, nil
+}
+
+func prepareQuery(ctx context.Context, filename string, module []byte, query string, verifier notation.ImageVerifier, cfg *queryConfig) (*OpaQuery, error) {
+	preparedQuery, err := rego.New(regoOptions(filename, module, query, verifier, cfg)...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &OpaQuery{query: &preparedQuery}, nil
+}
+
+// liveFunctions return data that changes between requests, they must not be evaluated ahead.
+var liveFunctions = map[string]bool{
+	"nacp.now":              true,
+	"nacp.time_between":     true,
+	"nacp.in_calendar":      true,
+	"nacp.reverse_dns":      true,
+	"nomad.job":             true,
+	"nomad.namespace":       true,
+	"nomad.node_pool":       true,
+	"notation_verify_image": true,
+}
+
+var dataSourcesRef = ast.MustParseRef("data.sources")
+
+// prepareQueryPartially partially evaluates every "name = ref" expression of the query on its own,
+// as OPA can only partially evaluate single references.
+// Policies using live functions or data sources are prepared without partial evaluation,
+// OPA would otherwise inline their results.
+func prepareQueryPartially(ctx context.Context, filename string, module []byte, query string, verifier notation.ImageVerifier, cfg *queryConfig) (*OpaQuery, error) {
+	parsedModule, err := ast.ParseModule(filename, string(module))
+	if err != nil {
+		return nil, err
+	}
+	if usesLiveData(parsedModule) {
+		return prepareQuery(ctx, filename, module, query, verifier, cfg)
+	}
+	body, err := ast.ParseBody(query)
 	if err != nil {
 		return nil, err
 	}
+	q := &OpaQuery{}
+	for _, expr := range body {
+		name, ref, ok := bindingOf(expr)
+		if !ok {
+			return nil, fmt.Errorf("partial evaluation requires queries of the form name = data.ref, got %s", expr)
+		}
+		prepared, err := rego.New(regoOptions(filename, module, ref.String(), verifier, cfg)...).PrepareForEval(ctx, rego.WithPartialEval())
+		if err != nil {
+			return nil, err
+		}
+		q.bindings = append(q.bindings, partialBinding{name: name, query: prepared})
+	}
+	return q, nil
+}
+
+func usesLiveData(module *ast.Module) bool {
+	live := false
+	ast.WalkRefs(module, func(ref ast.Ref) bool {
+		if liveFunctions[ref.String()] || ref.HasPrefix(dataSourcesRef) {
+			live = true
+		}
+		return live
+	})
+	return live
+}
+
+func bindingOf(expr *ast.Expr) (string, ast.Ref, bool) {
+	if !expr.IsEquality() && !expr.IsAssignment() {
+		return "", nil, false
+	}
+	terms := expr.Operands()
+	name, ok := terms[0].Value.(ast.Var)
+	if !ok {
+		return "", nil, false
+	}
+	ref, ok := terms[1].Value.(ast.Ref)
+	if !ok {
+		return "", nil, false
+	}
+	return string(name), ref, true
+}
+
+func regoOptions(filename string, module []byte, query string, verifier notation.ImageVerifier, cfg *queryConfig) []func(*rego.Rego) {
 	options := []func(*rego.Rego){
 		rego.Query(query),
 		rego.Module(filename, string(module)),
 	}
+	options = append(options, libraryModules()...)
+	options = append(options, networkFunctions(cfg.resolver)...)
+	options = append(options, timeFunctions(cfg)...)
+	options = append(options, cfg.regoOptions...)
+	if cfg.store != nil {
+		options = append(options, rego.Store(cfg.store))
+	}
 	if verifier != nil {
 		options = append(options, rego.Function1(
 
@@ -49,21 +238,43 @@ func CreateQuery(filename string, query string, ctx context.Context, verifier no
 		)
 	}
 
-	preparedQuery, err := rego.New(options...).PrepareForEval(ctx)
+	return options
+}
 
+func (q *OpaQuery) Query(ctx context.Context, payload *types2.Payload) (*OpaQueryResult, error) {
+	return q.eval(ctx, payload)
+}
+
+// Trace evaluates the query like Query with a full evaluation trace, one event per line.
+// The trace of a partially evaluated query only shows the remaining, input dependent parts.
+func (q *OpaQuery) Trace(ctx context.Context, payload *types2.Payload) *types2.Trace {
+	tracer := topdown.NewBufferTracer()
+	result, err := q.eval(ctx, payload, rego.EvalQueryTracer(tracer))
+	buf := &strings.Builder{}
+	topdown.PrettyTraceWithLocation(buf, *tracer)
+	trace := &types2.Trace{Events: strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")}
 	if err != nil {
-		return nil, err
+		trace.Error = err.Error()
+	} else {
+		trace.Result = (*result.resultSet)[0].Bindings
 	}
-
-	return &OpaQuery{
-		query: &preparedQuery,
-	}, nil
+	return trace
 }
 
-func (q *OpaQuery) Query(ctx context.Context, payload *types2.Payload) (*OpaQueryResult, error) {
-	resultSet, err := q.query.Eval(ctx, rego.EvalInput(payload))
+func (q *OpaQuery) eval(ctx context.Context, payload *types2.Payload, evalOptions ...rego.EvalOption) (*OpaQueryResult, error) {
+	// data sources are already part of the data document, no need to convert them twice
+	input := *payload
+	input.Data = nil
+	ctx, cancel, lim, limitOptions := q.limits.limit(ctx)
+	defer cancel()
+	evalOptions = append(evalOptions, limitOptions...)
+	if q.query == nil {
+		result, err := q.queryPartial(ctx, &input, evalOptions)
+		return result, q.limits.evalError(ctx, lim, err)
+	}
+	resultSet, err := q.query.Eval(ctx, append(evalOptions, rego.EvalInput(&input))...)
 	if err != nil {
-		return nil, err
+		return nil, q.limits.evalError(ctx, lim, err)
 	}
 	if len(resultSet) == 0 {
 		return nil, errors.New("no result set returned, maybe the query is wrong?")
@@ -71,6 +282,26 @@ func (q *OpaQuery) Query(ctx context.Context, payload *types2.Payload) (*OpaQuer
 	return &OpaQueryResult{&resultSet}, nil
 }
 
+func (q *OpaQuery) queryPartial(ctx context.Context, input *types2.Payload, evalOptions []rego.EvalOption) (*OpaQueryResult, error) {
+	// convert the input once for all bindings
+	parsedInput, err := ast.InterfaceToValue(input)
+	if err != nil {
+		return nil, err
+	}
+	bindings := rego.Vars{}
+	for _, b := range q.bindings {
+		resultSet, err := b.query.Eval(ctx, append(evalOptions, rego.EvalParsedInput(parsedInput))...)
+		if err != nil {
+			return nil, err
+		}
+		if len(resultSet) == 0 || len(resultSet[0].Expressions) == 0 {
+			return nil, errors.New("no result set returned, maybe the query is wrong?")
+		}
+		bindings[b.name] = resultSet[0].Expressions[0].Value
+	}
+	return &OpaQueryResult{&rego.ResultSet{{Bindings: bindings}}}, nil
+}
+
 func (result *OpaQueryResult) GetWarnings() []interface{} {
 
 	rs := *result.resultSet
@@ -81,6 +312,17 @@ func (result *OpaQueryResult) GetWarnings() []interface{} {
 	}
 	return warnings
 }
+
+// GetInfos returns the informational findings of the infos binding, they never reject a job.
+func (result *OpaQueryResult) GetInfos() []interface{} {
+
+	rs := *result.resultSet
+	infos, ok := rs[0].Bindings["infos"].([]interface{})
+	if !ok {
+		return make([]interface{}, 0)
+	}
+	return infos
+}
 func (result *OpaQueryResult) GetErrors() []interface{} {
 
 	rs := *result.resultSet
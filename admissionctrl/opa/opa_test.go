@@ -2,13 +2,17 @@ package opa
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/mxab/nacp/admissionctrl/types"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/nomad/api"
 	"github.com/mxab/nacp/admissionctrl/notation"
 	"github.com/mxab/nacp/testutil"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -182,3 +186,166 @@ func TestCreateQueryIfNotationFnIsUsedButVerifierIsNil(t *testing.T) {
 	assert.Error(t, err, "Error creating query")
 
 }
+
+func TestQueryWithStore(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.NewFromObject(map[string]interface{}{
+		"sources": map[string]interface{}{"teams": []interface{}{"team-a"}},
+	})
+	query, err := CreateQuery(testutil.Filepath(t, "opa/data_sources.rego"), `
+		errors = data.data_sources.errors
+	`, ctx, nil, WithStore(store))
+	require.NoError(t, err)
+
+	payload := &types.Payload{
+		Job:  &api.Job{Meta: map[string]string{"team": "team-a"}},
+		Data: map[string]interface{}{"teams": []interface{}{"team-a"}},
+	}
+	result, err := query.Query(ctx, payload)
+	require.NoError(t, err)
+	assert.Empty(t, result.GetErrors())
+
+	require.NoError(t, storage.WriteOne(ctx, store, storage.AddOp, storage.Path{"sources", "teams"}, []interface{}{"team-b"}))
+	result, err = query.Query(ctx, payload)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"unknown team team-a"}, result.GetErrors(), "store updates are visible without preparing the query again")
+}
+
+func TestPartialEvaluation(t *testing.T) {
+	ctx := context.Background()
+
+	query, err := CreateQuery(testutil.Filepath(t, "opa/test.rego"), `
+		errors = data.opatest.errors
+		warnings = data.opatest.warnings
+		patch = data.opatest.patch
+	`, ctx, nil, WithPartialEvaluation())
+	require.NoError(t, err)
+	result, err := query.Query(ctx, &types.Payload{Job: &api.Job{}})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"This is a warning message"}, result.GetWarnings())
+	assert.Equal(t, []interface{}{"This is a error message"}, result.GetErrors())
+	assert.Len(t, result.GetPatch(), 1)
+
+	now := time.Date(2024, 12, 20, 9, 0, 0, 0, time.UTC)
+	query, err = CreateQuery(testutil.Filepath(t, "opa/time.rego"), `
+		errors = data.time_window.errors
+	`, ctx, nil, WithPartialEvaluation(), WithTimeZone(time.UTC), WithCalendars(map[string][]string{"holidays": {"2024-12-25"}}), withClock(func() time.Time { return now }))
+	require.NoError(t, err)
+	payload := &types.Payload{Job: &api.Job{ID: pointerOf("example"), Namespace: pointerOf("prod")}}
+	result, err = query.Query(ctx, payload)
+	require.NoError(t, err)
+	assert.Empty(t, result.GetErrors())
+	now = time.Date(2024, 12, 20, 19, 0, 0, 0, time.UTC)
+	result, err = query.Query(ctx, payload)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"no prod deployments at 19:00 UTC"}, result.GetErrors(), "time functions are not evaluated ahead")
+
+	store := inmem.NewFromObject(map[string]interface{}{
+		"sources": map[string]interface{}{"teams": []interface{}{"team-a"}},
+	})
+	query, err = CreateQuery(testutil.Filepath(t, "opa/data_sources.rego"), `
+		errors = data.data_sources.errors
+	`, ctx, nil, WithPartialEvaluation(), WithStore(store))
+	require.NoError(t, err)
+	payload = &types.Payload{Job: &api.Job{Meta: map[string]string{"team": "team-a"}}}
+	result, err = query.Query(ctx, payload)
+	require.NoError(t, err)
+	assert.Empty(t, result.GetErrors())
+	require.NoError(t, storage.WriteOne(ctx, store, storage.AddOp, storage.Path{"sources", "teams"}, []interface{}{"team-b"}))
+	result, err = query.Query(ctx, payload)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"unknown team team-a"}, result.GetErrors(), "data sources are not evaluated ahead")
+}
+
+func BenchmarkQuery(b *testing.B) {
+	ctx := context.Background()
+	job := &api.Job{}
+	require.NoError(b, json.Unmarshal([]byte(testutil.ReadJobJson(&testing.T{}, "job.json")), job))
+
+	for _, bc := range []struct {
+		name   string
+		policy string
+		query  string
+		opts   []Option
+	}{
+		{name: "simple prepared", policy: "opa/validators/costcenter_meta.rego", query: "errors = data.costcenter_meta.errors"},
+		{name: "simple partial evaluation", policy: "opa/validators/costcenter_meta.rego", query: "errors = data.costcenter_meta.errors", opts: []Option{WithPartialEvaluation()}},
+		{name: "computed data prepared", policy: "opa/registries.rego", query: "errors = data.registries.errors"},
+		{name: "computed data partial evaluation", policy: "opa/registries.rego", query: "errors = data.registries.errors", opts: []Option{WithPartialEvaluation()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			query, err := CreateQuery(testutil.Filepath(&testing.T{}, bc.policy), bc.query, ctx, nil, bc.opts...)
+			require.NoError(b, err)
+			payload := &types.Payload{Job: job}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := query.Query(ctx, payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPartialEvaluationMatchesPreparedQuery(t *testing.T) {
+	ctx := context.Background()
+	job := func(image string) *types.Payload {
+		return &types.Payload{Job: &api.Job{TaskGroups: []*api.TaskGroup{{
+			Tasks: []*api.Task{{Name: "app", Config: map[string]interface{}{"image": image}}},
+		}}}}
+	}
+	prepared, err := CreateQuery(testutil.Filepath(t, "opa/registries.rego"), "errors = data.registries.errors", ctx, nil)
+	require.NoError(t, err)
+	partial, err := CreateQuery(testutil.Filepath(t, "opa/registries.rego"), "errors = data.registries.errors", ctx, nil, WithPartialEvaluation())
+	require.NoError(t, err)
+	assert.Nil(t, partial.query)
+	assert.Len(t, partial.bindings, 1)
+
+	for _, image := range []string{"registry-5.example.com/app:1", "docker.io/library/redis:7"} {
+		want, err := prepared.Query(ctx, job(image))
+		require.NoError(t, err)
+		got, err := partial.Query(ctx, job(image))
+		require.NoError(t, err)
+		assert.Equal(t, want.GetErrors(), got.GetErrors(), image)
+	}
+
+	live, err := CreateQuery(testutil.Filepath(t, "opa/time.rego"), "errors = data.time_window.errors", ctx, nil, WithPartialEvaluation())
+	require.NoError(t, err)
+	assert.NotNil(t, live.query, "policies using live functions are not partially evaluated")
+
+	_, err = CreateQuery(testutil.Filepath(t, "opa/registries.rego"), "count(data.registries.errors) > 0", ctx, nil, WithPartialEvaluation())
+	assert.ErrorContains(t, err, "partial evaluation requires queries of the form name = data.ref")
+
+	undefined, err := CreateQuery(testutil.Filepath(t, "opa/registries.rego"), "errors = data.registries.unknown", ctx, nil, WithPartialEvaluation())
+	require.NoError(t, err)
+	_, err = undefined.Query(ctx, job("docker.io/library/redis:7"))
+	assert.ErrorContains(t, err, "no result set returned")
+}
+
+func TestOpaTrace(t *testing.T) {
+	ctx := context.Background()
+	path := testutil.Filepath(t, "opa/test.rego")
+	payload := &types.Payload{Job: &api.Job{}}
+
+	for _, partial := range []bool{false, true} {
+		var opts []Option
+		if partial {
+			opts = append(opts, WithPartialEvaluation())
+		}
+		query, err := CreateQuery(path, "errors = data.opatest.errors", ctx, nil, opts...)
+		require.NoError(t, err)
+
+		trace := query.Trace(ctx, payload)
+		assert.Empty(t, trace.Error)
+		assert.Equal(t, []interface{}{"This is a error message"}, trace.Result["errors"])
+		assert.NotEmpty(t, trace.Events)
+		assert.Contains(t, trace.Events[0], "Enter")
+	}
+
+	query, err := CreateQuery(path, "errors = data.opatest.notexisting", ctx, nil)
+	require.NoError(t, err)
+	trace := query.Trace(ctx, payload)
+	assert.Equal(t, "no result set returned, maybe the query is wrong?", trace.Error)
+	assert.Nil(t, trace.Result)
+}
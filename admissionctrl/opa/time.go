@@ -0,0 +1,116 @@
+package opa
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+)
+
+const calendarDateLayout = "2006-01-02"
+
+// WithTimeZone sets the time zone used by the nacp.now and nacp.time_between functions, defaults to the local time zone.
+func WithTimeZone(location *time.Location) Option {
+	return func(c *queryConfig) {
+		c.location = location
+	}
+}
+
+// WithCalendars makes the given calendars, a list of dates in YYYY-MM-DD format per name, available to nacp.in_calendar.
+func WithCalendars(calendars map[string][]string) Option {
+	return func(c *queryConfig) {
+		c.calendars = make(map[string]map[string]bool, len(calendars))
+		for name, dates := range calendars {
+			set := make(map[string]bool, len(dates))
+			for _, date := range dates {
+				set[date] = true
+			}
+			c.calendars[name] = set
+		}
+	}
+}
+
+// timeFunctions provides nacp.now(), nacp.time_between(start, end) and nacp.in_calendar(name, date).
+func timeFunctions(cfg *queryConfig) []func(*rego.Rego) {
+	now := func() time.Time {
+		return cfg.clock().In(cfg.location)
+	}
+	return []func(*rego.Rego){
+		rego.FunctionDyn(
+			&rego.Function{
+				Name: "nacp.now",
+				Decl: types.NewFunction(types.Args(), types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))),
+			},
+			func(_ rego.BuiltinContext, _ []*ast.Term) (*ast.Term, error) {
+				t := now()
+				name, _ := t.Zone()
+				return ast.ObjectTerm(
+					ast.Item(ast.StringTerm("unix_ns"), ast.IntNumberTerm(int(t.UnixNano()))),
+					ast.Item(ast.StringTerm("rfc3339"), ast.StringTerm(t.Format(time.RFC3339))),
+					ast.Item(ast.StringTerm("date"), ast.StringTerm(t.Format(calendarDateLayout))),
+					ast.Item(ast.StringTerm("weekday"), ast.StringTerm(t.Weekday().String())),
+					ast.Item(ast.StringTerm("hour"), ast.IntNumberTerm(t.Hour())),
+					ast.Item(ast.StringTerm("minute"), ast.IntNumberTerm(t.Minute())),
+					ast.Item(ast.StringTerm("timezone"), ast.StringTerm(name)),
+				), nil
+			}),
+		rego.Function2(
+			&rego.Function{
+				Name: "nacp.time_between",
+				Decl: types.NewFunction(types.Args(types.S, types.S), types.B),
+			},
+			func(_ rego.BuiltinContext, startTerm, endTerm *ast.Term) (*ast.Term, error) {
+				start, err := parseClock(startTerm)
+				if err != nil {
+					return nil, err
+				}
+				end, err := parseClock(endTerm)
+				if err != nil {
+					return nil, err
+				}
+				t := now()
+				current := t.Hour()*60 + t.Minute()
+				// windows like 22:00-06:00 wrap around midnight
+				if start <= end {
+					return ast.BooleanTerm(current >= start && current < end), nil
+				}
+				return ast.BooleanTerm(current >= start || current < end), nil
+			}),
+		rego.Function2(
+			&rego.Function{
+				Name: "nacp.in_calendar",
+				Decl: types.NewFunction(types.Args(types.S, types.S), types.B),
+			},
+			func(_ rego.BuiltinContext, nameTerm, dateTerm *ast.Term) (*ast.Term, error) {
+				name, ok := nameTerm.Value.(ast.String)
+				if !ok {
+					return nil, fmt.Errorf("nacp.in_calendar expects calendar name as string")
+				}
+				date, ok := dateTerm.Value.(ast.String)
+				if !ok {
+					return nil, fmt.Errorf("nacp.in_calendar expects date as string")
+				}
+				calendar, ok := cfg.calendars[string(name)]
+				if !ok {
+					// a typo in the calendar name must not silently turn into "not a holiday"
+					return nil, rego.NewHaltError(fmt.Errorf("unknown calendar %q", string(name)))
+				}
+				return ast.BooleanTerm(calendar[string(date)]), nil
+			}),
+	}
+}
+
+// parseClock returns the minutes since midnight of a HH:MM string.
+func parseClock(term *ast.Term) (int, error) {
+	str, ok := term.Value.(ast.String)
+	if !ok {
+		return 0, fmt.Errorf("nacp.time_between expects times as HH:MM strings")
+	}
+	t, err := time.Parse("15:04", string(str))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %w", str, err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,91 @@
+package opa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withClock(clock func() time.Time) Option {
+	return func(c *queryConfig) {
+		c.clock = clock
+	}
+}
+
+func TestTimeBuiltins(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	tt := []struct {
+		name         string
+		now          time.Time
+		namespace    string
+		wantErrors   []interface{}
+		wantWarnings []interface{}
+	}{
+		{
+			name:         "working hours",
+			now:          time.Date(2024, 12, 20, 9, 0, 0, 0, time.UTC),
+			namespace:    "prod",
+			wantErrors:   []interface{}{},
+			wantWarnings: []interface{}{},
+		},
+		{
+			name:         "after working hours in cluster time zone",
+			now:          time.Date(2024, 12, 20, 17, 30, 0, 0, time.UTC),
+			namespace:    "prod",
+			wantErrors:   []interface{}{"no prod deployments at 18:30 CET"},
+			wantWarnings: []interface{}{},
+		},
+		{
+			name:         "holiday",
+			now:          time.Date(2024, 12, 25, 9, 0, 0, 0, time.UTC),
+			namespace:    "prod",
+			wantErrors:   []interface{}{"no prod deployments on holidays"},
+			wantWarnings: []interface{}{},
+		},
+		{
+			name:         "night window wraps midnight",
+			now:          time.Date(2024, 12, 25, 2, 0, 0, 0, time.UTC),
+			namespace:    "dev",
+			wantErrors:   []interface{}{},
+			wantWarnings: []interface{}{"deploying at night"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			query, err := CreateQuery(testutil.Filepath(t, "opa/time.rego"), `
+				errors = data.time_window.errors
+				warnings = data.time_window.warnings
+			`, ctx, nil,
+				WithTimeZone(berlin),
+				WithCalendars(map[string][]string{"holidays": {"2024-12-25", "2024-12-26"}}),
+				withClock(func() time.Time { return tc.now }),
+			)
+			require.NoError(t, err)
+
+			result, err := query.Query(ctx, &types.Payload{Job: &api.Job{ID: pointerOf("example"), Namespace: pointerOf(tc.namespace)}})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantErrors, result.GetErrors())
+			assert.Equal(t, tc.wantWarnings, result.GetWarnings())
+		})
+	}
+}
+
+func TestInCalendarFailsOnUnknownCalendar(t *testing.T) {
+	ctx := context.Background()
+	query, err := CreateQuery(testutil.Filepath(t, "opa/time.rego"), `
+		errors = data.time_window.errors
+	`, ctx, nil)
+	require.NoError(t, err)
+
+	_, err = query.Query(ctx, &types.Payload{Job: &api.Job{ID: pointerOf("example"), Namespace: pointerOf("prod")}})
+	assert.ErrorContains(t, err, `unknown calendar "holidays"`)
+}
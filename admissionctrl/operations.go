@@ -0,0 +1,91 @@
+package admissionctrl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// OperationValidator checks operations on registered jobs instead of job submissions, e.g. stops, purges
+// or allocation restarts. The payload job is the registered job and the context holds the operation.
+type OperationValidator interface {
+	JobValidator
+	Operations() []string
+}
+
+// wrappedValidator is implemented by validators that change the decisions of another validator.
+type wrappedValidator interface {
+	Unwrap() JobValidator
+}
+
+// ValidatedOperations returns the operations the validator, or the one it wraps, checks instead of job submissions.
+func ValidatedOperations(validator JobValidator) []string {
+	for {
+		if v, ok := validator.(OperationValidator); ok {
+			return v.Operations()
+		}
+		wrapped, ok := validator.(wrappedValidator)
+		if !ok {
+			return nil
+		}
+		validator = wrapped.Unwrap()
+	}
+}
+
+// ChecksOperation reports whether any validator checks the operation, so requests are only intercepted if needed.
+func (j *JobHandler) ChecksOperation(operation string) bool {
+	_, validators := j.rules()
+	for _, validator := range validators {
+		if slices.Contains(ValidatedOperations(validator), operation) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdmissionOperation applies the validators of the operation in the payload context to the registered job.
+func (j *JobHandler) AdmissionOperation(payload *types.Payload) ([]error, error) {
+	return j.AdmissionOperationContext(context.Background(), payload)
+}
+
+// AdmissionOperationContext is AdmissionOperation with a context that cancels the validators in flight.
+func (j *JobHandler) AdmissionOperationContext(ctx context.Context, payload *types.Payload) ([]error, error) {
+	j.attachData(payload)
+	_, validators := j.rules()
+
+	var warnings []error
+	var errs error
+	for _, validator := range validators {
+		if payload.Context == nil || !slices.Contains(ValidatedOperations(validator), payload.Context.Operation) {
+			continue
+		}
+		w, err := j.validate(ctx, validator, payload)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		warnings = append(warnings, w...)
+	}
+	return warnings, errs
+}
+
+// validate applies a single validator including fault injection, rule versions, exemptions and decision recording.
+func (j *JobHandler) validate(ctx context.Context, validator JobValidator, payload *types.Payload) ([]error, error) {
+	j.logger.Debug("applying job validator", "validator", validator.Name(), "job", payload.Job.ID)
+	if err := aborted(ctx, validator.Name()); err != nil {
+		return nil, fmt.Errorf("error in job validator %s: %w", validator.Name(), err)
+	}
+	if err := j.injectFault(validator.Name()); err != nil {
+		return nil, fmt.Errorf("error in job validator %s: %w", validator.Name(), err)
+	}
+	w, err := ValidateContext(ctx, validator, payload)
+	err = errcode.Classify(validator.Name(), err)
+	j.logger.Trace("job validate results", "validator", validator.Name(), "warnings", w, "error", err)
+	w, err = j.decide(kindValidator, validator.Name(), payload.Job, w, err)
+	w, err = j.exempt(validator.Name(), payload.Job, w, err)
+	j.record(kindValidator, validator.Name(), payload, nil, w, err)
+	return w, err
+}
@@ -0,0 +1,57 @@
+package admissionctrl
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// operationValidator only checks the given operations.
+type operationValidator struct {
+	testutil.MockValidator
+	operations []string
+}
+
+func (v *operationValidator) Operations() []string {
+	return v.operations
+}
+
+func TestValidatedOperations(t *testing.T) {
+	deregister := &operationValidator{operations: []string{config.OperationDeregister}}
+	assert.Equal(t, []string{config.OperationDeregister}, ValidatedOperations(deregister))
+	assert.Equal(t, []string{config.OperationDeregister}, ValidatedOperations(NewSeverityValidator(deregister, types.SeverityWarning)))
+	assert.Nil(t, ValidatedOperations(new(testutil.MockValidator)))
+	assert.Nil(t, ValidatedOperations(NewSeverityValidator(new(testutil.MockValidator), types.SeverityWarning)))
+}
+
+func TestJobHandler_AdmissionOperation(t *testing.T) {
+	submission := new(testutil.MockValidator)
+	submission.On("Validate", mock.Anything).Return([]error{}, nil)
+	deregister := &operationValidator{operations: []string{config.OperationDeregister}}
+	deregister.On("Validate", mock.Anything).Return([]error{}, nil)
+	restart := &operationValidator{operations: []string{config.OperationAllocRestart}}
+	restart.On("Validate", mock.Anything).Return([]error{}, nil)
+
+	j := NewJobHandler(nil, []JobValidator{submission, deregister, restart}, hclog.NewNullLogger(), false)
+	assert.True(t, j.ChecksOperation(config.OperationDeregister))
+	assert.False(t, j.ChecksOperation(config.OperationEvaluate))
+
+	_, err := j.AdmissionOperation(&types.Payload{Job: &api.Job{ID: pointer("job")}, Context: &config.RequestContext{Operation: config.OperationDeregister}})
+	require.NoError(t, err)
+	deregister.AssertNumberOfCalls(t, "Validate", 1)
+	restart.AssertNotCalled(t, "Validate", mock.Anything)
+	submission.AssertNotCalled(t, "Validate", mock.Anything)
+
+	_, err = j.AdmissionValidators(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.NoError(t, err)
+	submission.AssertNumberOfCalls(t, "Validate", 1)
+	deregister.AssertNumberOfCalls(t, "Validate", 1)
+	restart.AssertNotCalled(t, "Validate", mock.Anything)
+}
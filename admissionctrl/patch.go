@@ -0,0 +1,209 @@
+package admissionctrl
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// PatchMutator describes its changes as a JSON patch instead of returning a rebuilt job, so the proxy can apply
+// them to the submitted JSON and keep the fields the Nomad API client doesn't know, e.g. of a newer Nomad version.
+// AsMutator adds it to the mutators of a handler.
+type PatchMutator interface {
+	AdmissionController
+	MutatePatch(ctx context.Context, payload *types.Payload) (*types.Mutation, error)
+}
+
+// AsMutator adapts a PatchMutator to a JobMutator, its Mutate applies the patch to the job.
+func AsMutator(mutator PatchMutator) JobMutator {
+	return &patchMutatorAdapter{mutator: mutator}
+}
+
+type patchMutatorAdapter struct {
+	mutator PatchMutator
+}
+
+func (a *patchMutatorAdapter) Name() string {
+	return a.mutator.Name()
+}
+
+func (a *patchMutatorAdapter) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	return a.MutateContext(context.Background(), payload)
+}
+
+func (a *patchMutatorAdapter) MutateContext(ctx context.Context, payload *types.Payload) (*api.Job, []error, error) {
+	mutation, err := a.mutator.MutatePatch(ctx, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	job, err := ApplyPatch(payload.Job, mutation.Patch)
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, mutation.Warnings, nil
+}
+
+func (a *patchMutatorAdapter) MutatePatch(ctx context.Context, payload *types.Payload) (*types.Mutation, error) {
+	return a.mutator.MutatePatch(ctx, payload)
+}
+
+// MutatePatch returns the changes of the mutator as a patch, the payload's job is not changed.
+// Mutators without MutatePatch run on a copy of the job, their changes are diffed from the job before and after.
+func MutatePatch(ctx context.Context, mutator JobMutator, payload *types.Payload) (*types.Mutation, error) {
+	if m, ok := mutator.(PatchMutator); ok {
+		return m.MutatePatch(ctx, payload)
+	}
+	before, err := json.Marshal(payload.Job)
+	if err != nil {
+		return nil, err
+	}
+	// mutators may change the job in place
+	job, warnings, err := MutateContext(ctx, mutator, &types.Payload{Job: copyJob(payload.Job), Context: payload.Context, Data: payload.Data})
+	if err != nil {
+		return nil, err
+	}
+	patch, err := diffJobs(before, job)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Mutation{Patch: patch, Warnings: warnings}, nil
+}
+
+// ApplyPatch returns a copy of the job with the patch applied.
+func ApplyPatch(job *api.Job, patch jsonpatch.Patch) (*api.Job, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := patch.Apply(data)
+	if err != nil {
+		return nil, err
+	}
+	out := &api.Job{}
+	if err := json.Unmarshal(patched, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DiffPatch returns a JSON patch from one document to the other. Objects and arrays of the same length are
+// compared member by member, so the patch only touches the changed values and keeps everything else of a document it is applied to.
+func DiffPatch(before, after []byte) (jsonpatch.Patch, error) {
+	var beforeDoc, afterDoc interface{}
+	if err := json.Unmarshal(before, &beforeDoc); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &afterDoc); err != nil {
+		return nil, err
+	}
+	ops := diffOperations(beforeDoc, afterDoc, "", false, nil)
+	if len(ops) == 0 {
+		return jsonpatch.Patch{}, nil
+	}
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.DecodePatch(data)
+}
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// diffOperations appends the operations changing before to after at the path, element tells whether the path is an array element.
+func diffOperations(before, after interface{}, path string, element bool, ops []patchOperation) []patchOperation {
+	beforeObject, beforeOK := before.(map[string]interface{})
+	afterObject, afterOK := after.(map[string]interface{})
+	if beforeOK && afterOK {
+		keys := make([]string, 0, len(beforeObject))
+		for key := range beforeObject {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, ok := afterObject[key]
+			if !ok {
+				ops = append(ops, patchOperation{Op: "remove", Path: path + "/" + escapeKey(key)})
+				continue
+			}
+			ops = diffOperations(beforeObject[key], value, path+"/"+escapeKey(key), false, ops)
+		}
+		keys = keys[:0]
+		for key := range afterObject {
+			if _, ok := beforeObject[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			ops = append(ops, patchOperation{Op: "add", Path: path + "/" + escapeKey(key), Value: afterObject[key]})
+		}
+		return ops
+	}
+	beforeArray, beforeOK := before.([]interface{})
+	afterArray, afterOK := after.([]interface{})
+	if beforeOK && afterOK && len(beforeArray) == len(afterArray) {
+		for i := range beforeArray {
+			ops = diffOperations(beforeArray[i], afterArray[i], path+"/"+strconv.Itoa(i), true, ops)
+		}
+		return ops
+	}
+	if reflect.DeepEqual(before, after) {
+		return ops
+	}
+	if element {
+		// add would insert the value before the element
+		return append(ops, patchOperation{Op: "replace", Path: path, Value: after})
+	}
+	// add replaces an existing member, but unlike replace it doesn't fail if the member is missing
+	return append(ops, patchOperation{Op: "add", Path: path, Value: after})
+}
+
+// PatchLog collects the changes of the mutators as patches, in the order they were applied to the job.
+type PatchLog struct {
+	Patches []jsonpatch.Patch
+}
+
+type contextKeyPatchLog struct{}
+
+// WithPatchLog makes the handler record the changes of the mutators applied with the returned context.
+func WithPatchLog(ctx context.Context) (context.Context, *PatchLog) {
+	log := &PatchLog{}
+	return context.WithValue(ctx, contextKeyPatchLog{}, log), log
+}
+
+func patchLogFromContext(ctx context.Context) *PatchLog {
+	log, _ := ctx.Value(contextKeyPatchLog{}).(*PatchLog)
+	return log
+}
+
+// mutateWithPatch applies the mutator through its patch, so the patch can be logged.
+func mutateWithPatch(ctx context.Context, mutator JobMutator, payload *types.Payload) (*api.Job, []error, jsonpatch.Patch, error) {
+	mutation, err := MutatePatch(ctx, mutator, payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	job, err := ApplyPatch(payload.Job, mutation.Patch)
+	if err != nil {
+		return nil, nil, nil, errcode.Failed(mutator.Name(), err)
+	}
+	return job, mutation.Warnings, mutation.Patch, nil
+}
+
+func diffJobs(before []byte, job *api.Job) (jsonpatch.Patch, error) {
+	after, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	return DiffPatch(before, after)
+}
@@ -0,0 +1,141 @@
+package admissionctrl
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ownerPatchMutator sets the owner meta with a patch.
+type ownerPatchMutator struct{}
+
+func (m *ownerPatchMutator) Name() string {
+	return "owner-patch"
+}
+
+func (m *ownerPatchMutator) MutatePatch(ctx context.Context, payload *types.Payload) (*types.Mutation, error) {
+	patch, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/Meta", "value": {"owner": "platform"}}]`))
+	if err != nil {
+		return nil, err
+	}
+	return &types.Mutation{Patch: patch}, nil
+}
+
+func TestDiffPatch(t *testing.T) {
+	tt := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			before: `{"a": 1, "b": [1, 2]}`,
+			after:  `{"a": 1, "b": [1, 2]}`,
+			want:   `[]`,
+		},
+		{
+			name:   "members",
+			before: `{"a": 1, "b": {"c": "x", "d": "y"}}`,
+			after:  `{"a": 2, "b": {"c": "x", "e": "z"}}`,
+			want: `[
+				{"op": "add", "path": "/a", "value": 2},
+				{"op": "remove", "path": "/b/d", "value": null},
+				{"op": "add", "path": "/b/e", "value": "z"}
+			]`,
+		},
+		{
+			name:   "array elements",
+			before: `{"tasks": [{"name": "a"}, "b"]}`,
+			after:  `{"tasks": [{"name": "x"}, "c"]}`,
+			want: `[
+				{"op": "add", "path": "/tasks/0/name", "value": "x"},
+				{"op": "replace", "path": "/tasks/1", "value": "c"}
+			]`,
+		},
+		{
+			name:   "array length",
+			before: `{"tasks": ["a"]}`,
+			after:  `{"tasks": ["a", "b"]}`,
+			want:   `[{"op": "add", "path": "/tasks", "value": ["a", "b"]}]`,
+		},
+		{
+			name:   "escaped keys",
+			before: `{"Meta": {}}`,
+			after:  `{"Meta": {"a/b~c": "x"}}`,
+			want:   `[{"op": "add", "path": "/Meta/a~1b~0c", "value": "x"}]`,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			patch, err := DiffPatch([]byte(tc.before), []byte(tc.after))
+			require.NoError(t, err)
+			got, err := json.Marshal(patch)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(got))
+
+			applied, err := patch.Apply([]byte(tc.before))
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.after, string(applied))
+		})
+	}
+}
+
+func TestDiffPatch_KeepsUnknownFields(t *testing.T) {
+	patch, err := DiffPatch([]byte(`{"ID": "job", "Meta": {"a": "b"}}`), []byte(`{"ID": "job", "Meta": {"a": "c"}}`))
+	require.NoError(t, err)
+
+	applied, err := patch.Apply([]byte(`{"ID": "job", "Meta": {"a": "b"}, "FutureField": true}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ID": "job", "Meta": {"a": "c"}, "FutureField": true}`, string(applied))
+}
+
+func TestAsMutator(t *testing.T) {
+	mutator := AsMutator(&ownerPatchMutator{})
+	assert.Equal(t, "owner-patch", mutator.Name())
+
+	job := &api.Job{ID: pointer("job")}
+	mutated, warnings, err := mutator.Mutate(&types.Payload{Job: job})
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, "platform", mutated.Meta["owner"])
+	assert.Nil(t, job.Meta, "the job is patched as a copy")
+}
+
+func TestMutatePatch_Legacy(t *testing.T) {
+	job := &api.Job{ID: pointer("job")}
+	mutation, err := MutatePatch(context.Background(), &metaMutator{name: "owner", value: "platform"}, &types.Payload{Job: job})
+	require.NoError(t, err)
+	assert.Nil(t, job.Meta, "mutators changing the job in place run on a copy")
+
+	got, err := json.Marshal(mutation.Patch)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"op": "add", "path": "/Meta", "value": {"owner": "platform"}}]`, string(got))
+}
+
+func TestJobHandler_RecordsPatches(t *testing.T) {
+	j := NewJobHandler([]JobMutator{
+		&metaMutator{name: "owner", value: "team"},
+		AsMutator(&ownerPatchMutator{}),
+	}, nil, hclog.NewNullLogger(), false)
+
+	ctx, log := WithPatchLog(context.Background())
+	job, _, err := j.ApplyAdmissionControllersContext(ctx, &types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.NoError(t, err)
+	assert.Equal(t, "platform", job.Meta["owner"])
+
+	require.Len(t, log.Patches, 2)
+	doc := []byte(`{"ID": "job", "FutureField": true}`)
+	for _, patch := range log.Patches {
+		doc, err = patch.Apply(doc)
+		require.NoError(t, err)
+	}
+	assert.JSONEq(t, `{"ID": "job", "Meta": {"owner": "platform"}, "FutureField": true}`, string(doc))
+}
@@ -0,0 +1,85 @@
+// Package priority resolves the allowed job priorities, it is shared by the priority validator and mutator.
+package priority
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// DefaultPriority is used by Nomad for jobs without priority.
+const DefaultPriority = 50
+
+// Band is an inclusive range of priorities, a zero Max has no upper bound.
+type Band struct {
+	Min int
+	Max int
+}
+
+func (b Band) Contains(priority int) bool {
+	return priority >= b.Min && (b.Max == 0 || priority <= b.Max)
+}
+
+// Clamp returns the nearest priority within the band.
+func (b Band) Clamp(priority int) int {
+	if priority < b.Min {
+		return b.Min
+	}
+	if b.Max != 0 && priority > b.Max {
+		return b.Max
+	}
+	return priority
+}
+
+func (b Band) String() string {
+	if b.Max == 0 {
+		return fmt.Sprintf("%d-", b.Min)
+	}
+	return fmt.Sprintf("%d-%d", b.Min, b.Max)
+}
+
+// Policy holds the bands, token policies take precedence over namespaces and namespaces over the default.
+type Policy struct {
+	Default    Band
+	Namespaces map[string]Band
+	// TokenPolicies are the bands of Nomad ACL policies, the widest band of the submitter's policies applies
+	TokenPolicies map[string]Band
+}
+
+// Band returns the band for the job and submitter of the payload.
+func (p *Policy) Band(payload *types.Payload) Band {
+	if payload.Context != nil && payload.Context.TokenInfo != nil {
+		var band *Band
+		for _, name := range payload.Context.TokenInfo.Policies {
+			b, ok := p.TokenPolicies[name]
+			if !ok {
+				continue
+			}
+			if band == nil {
+				band = &b
+				continue
+			}
+			band.Min = min(band.Min, b.Min)
+			if band.Max != 0 && (b.Max == 0 || b.Max > band.Max) {
+				band.Max = b.Max
+			}
+		}
+		if band != nil {
+			return *band
+		}
+	}
+	if b, ok := p.Namespaces[selector.Namespace(payload.Job)]; ok {
+		return b
+	}
+	return p.Default
+}
+
+// Of returns the priority of the job, Nomad's default if unset.
+func Of(job *api.Job) int {
+	if job.Priority == nil {
+		return DefaultPriority
+	}
+	return *job.Priority
+}
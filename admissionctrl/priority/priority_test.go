@@ -0,0 +1,66 @@
+package priority
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBand(t *testing.T) {
+	band := Band{Min: 20, Max: 70}
+	assert.True(t, band.Contains(20))
+	assert.True(t, band.Contains(70))
+	assert.False(t, band.Contains(71))
+	assert.Equal(t, 70, band.Clamp(100))
+	assert.Equal(t, 20, band.Clamp(1))
+	assert.Equal(t, 50, band.Clamp(50))
+	assert.Equal(t, "20-70", band.String())
+
+	unbounded := Band{Min: 10}
+	assert.True(t, unbounded.Contains(100))
+	assert.Equal(t, "10-", unbounded.String())
+}
+
+func TestPolicyBand(t *testing.T) {
+	policy := &Policy{
+		Default:    Band{Min: 1, Max: 50},
+		Namespaces: map[string]Band{"prod": {Min: 40, Max: 80}},
+		TokenPolicies: map[string]Band{
+			"operator": {Min: 1, Max: 90},
+			"platform": {Min: 1},
+		},
+	}
+	payload := func(namespace string, policies ...string) *types.Payload {
+		p := &types.Payload{Job: &api.Job{Namespace: &namespace}}
+		if policies != nil {
+			p.Context = &config.RequestContext{TokenInfo: &api.ACLToken{Policies: policies}}
+		}
+		return p
+	}
+
+	tt := []struct {
+		name    string
+		payload *types.Payload
+		want    Band
+	}{
+		{name: "default", payload: payload("dev"), want: Band{Min: 1, Max: 50}},
+		{name: "namespace", payload: payload("prod"), want: Band{Min: 40, Max: 80}},
+		{name: "token policy", payload: payload("prod", "readonly", "operator"), want: Band{Min: 1, Max: 90}},
+		{name: "widest token policy", payload: payload("prod", "operator", "platform"), want: Band{Min: 1}},
+		{name: "unknown token policies", payload: payload("prod", "readonly"), want: Band{Min: 40, Max: 80}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, policy.Band(tc.payload))
+		})
+	}
+}
+
+func TestOf(t *testing.T) {
+	priority := 80
+	assert.Equal(t, DefaultPriority, Of(&api.Job{}))
+	assert.Equal(t, 80, Of(&api.Job{Priority: &priority}))
+}
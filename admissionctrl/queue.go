@@ -0,0 +1,50 @@
+package admissionctrl
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mxab/nacp/metrics"
+)
+
+var ErrQueueFull = errors.New("admission queue is full")
+
+// AdmissionQueue bounds the number of concurrently running admissions.
+// Up to maxQueued further admissions wait for a free slot, everything beyond is rejected.
+type AdmissionQueue struct {
+	slots   chan struct{}
+	pending chan struct{}
+}
+
+func NewAdmissionQueue(maxConcurrent, maxQueued int) *AdmissionQueue {
+	return &AdmissionQueue{
+		slots:   make(chan struct{}, maxConcurrent),
+		pending: make(chan struct{}, maxConcurrent+maxQueued),
+	}
+}
+
+// Acquire waits for a free slot and returns a function to release it again.
+// It fails immediately with ErrQueueFull if the queue has no capacity left.
+func (q *AdmissionQueue) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case q.pending <- struct{}{}:
+	default:
+		metrics.AdmissionQueueRejected.Inc()
+		return nil, ErrQueueFull
+	}
+	metrics.AdmissionQueueDepth.Inc()
+
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		<-q.pending
+		metrics.AdmissionQueueDepth.Dec()
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-q.slots
+		<-q.pending
+		metrics.AdmissionQueueDepth.Dec()
+	}, nil
+}
@@ -0,0 +1,48 @@
+package admissionctrl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmissionQueue(t *testing.T) {
+	q := NewAdmissionQueue(1, 1)
+	ctx := context.Background()
+
+	release, err := q.Acquire(ctx)
+	require.NoError(t, err)
+
+	acquired := make(chan func())
+	go func() {
+		r, err := q.Acquire(ctx)
+		assert.NoError(t, err)
+		acquired <- r
+	}()
+
+	assert.Eventually(t, func() bool { return len(q.pending) == 2 }, time.Second, time.Millisecond)
+	_, err = q.Acquire(ctx)
+	assert.ErrorIs(t, err, ErrQueueFull, "one running and one queued")
+
+	release()
+	releaseQueued := <-acquired
+	releaseQueued()
+
+	_, err = q.Acquire(ctx)
+	assert.NoError(t, err, "capacity is available again")
+}
+
+func TestAdmissionQueueHonorsContext(t *testing.T) {
+	q := NewAdmissionQueue(1, 1)
+	_, err := q.Acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = q.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, q.pending, 1, "cancelled waiter left the queue")
+}
@@ -0,0 +1,133 @@
+package admissionctrl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/metrics"
+)
+
+// ReadRule authorizes the read requests to the paths with a validator, e.g. an OPA policy.
+// The validator sees the request context but no job, its errors reject the request as forbidden.
+type ReadRule struct {
+	Validator JobValidator
+	// Paths are patterns in the syntax of path.Match, empty matches all paths
+	Paths        []string
+	ResolveToken bool
+}
+
+func (r *ReadRule) matches(p string) bool {
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range r.Paths {
+		if matched, _ := path.Match(pattern, p); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadAuthorizer applies the read rules to GET requests, the rules are replaced on reload.
+// A nil authorizer authorizes every read.
+type ReadAuthorizer struct {
+	mu     sync.RWMutex
+	rules  []*ReadRule
+	data   DataProvider
+	logger hclog.Logger
+}
+
+func NewReadAuthorizer(logger hclog.Logger, rules ...*ReadRule) *ReadAuthorizer {
+	return &ReadAuthorizer{rules: rules, logger: logger}
+}
+
+// Replace swaps the rules, e.g. after the config file was reloaded.
+func (a *ReadAuthorizer) Replace(rules []*ReadRule) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = rules
+}
+
+// UseDataSources attaches the content of the data sources to every payload.
+func (a *ReadAuthorizer) UseDataSources(data DataProvider) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.data = data
+}
+
+// matching returns the rules of the request, reads are GET and HEAD requests.
+func (a *ReadAuthorizer) matching(r *http.Request) []*ReadRule {
+	if a == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var rules []*ReadRule
+	for _, rule := range a.rules {
+		if rule.matches(r.URL.Path) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// Checks reports whether a rule authorizes the request and whether one of them needs the resolved token.
+func (a *ReadAuthorizer) Checks(r *http.Request) (checks bool, resolveToken bool) {
+	for _, rule := range a.matching(r) {
+		checks = true
+		resolveToken = resolveToken || rule.ResolveToken
+	}
+	return checks, resolveToken
+}
+
+// Authorize evaluates all rules of the request, it fails with errcode.CodeForbidden if one rejects it.
+// Rules that fail to decide reject the request as well, with the code of their failure.
+func (a *ReadAuthorizer) Authorize(ctx context.Context, r *http.Request, reqCtx *config.RequestContext) error {
+	rules := a.matching(r)
+	if len(rules) == 0 {
+		return nil
+	}
+	payload := &types.Payload{Context: reqCtx}
+	a.mu.RLock()
+	if a.data != nil {
+		payload.Data = a.data.Snapshot()
+	}
+	a.mu.RUnlock()
+
+	var errs *multierror.Error
+	for _, rule := range rules {
+		name := rule.Validator.Name()
+		if _, err := ValidateContext(ctx, rule.Validator, payload); err != nil {
+			metrics.RuleDecisions.WithLabelValues(kindReadRule, name, "", decisionRejected).Inc()
+			a.logger.Info("Read rule rejected request", "rule", name, "path", r.URL.Path, "accessorID", reqCtx.AccessorID, "error", err)
+			errs = multierror.Append(errs, forbidden(name, err))
+			continue
+		}
+		metrics.RuleDecisions.WithLabelValues(kindReadRule, name, "", decisionAccepted).Inc()
+	}
+	return errs.ErrorOrNil()
+}
+
+// forbidden gives the errors of a read rule without a code errcode.CodeForbidden, like errcode.Classify does for denials.
+func forbidden(rule string, err error) error {
+	if merr, ok := err.(*multierror.Error); ok {
+		classified := &multierror.Error{ErrorFormat: merr.ErrorFormat}
+		for _, e := range merr.Errors {
+			classified.Errors = append(classified.Errors, forbidden(rule, e))
+		}
+		return classified
+	}
+	var coded *errcode.Error
+	if errors.As(err, &coded) {
+		return errcode.Classify(rule, err)
+	}
+	return errcode.New(errcode.CodeForbidden, rule, err)
+}
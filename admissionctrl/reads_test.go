@@ -0,0 +1,56 @@
+package admissionctrl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAuthorizer(t *testing.T) {
+	rejecting := new(testutil.MockValidator)
+	rejecting.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf("namespace payments is not allowed"))
+	failing := new(testutil.MockValidator)
+	failing.On("Validate", mock.Anything).Return([]error{}, errcode.Failed("mock-validator", fmt.Errorf("policy evaluation failed")))
+
+	authorizer := NewReadAuthorizer(hclog.NewNullLogger(), &ReadRule{Validator: rejecting, Paths: []string{"/v1/allocation/*"}, ResolveToken: true})
+
+	checks, resolveToken := authorizer.Checks(httptest.NewRequest(http.MethodGet, "/v1/allocation/1234", nil))
+	assert.True(t, checks)
+	assert.True(t, resolveToken)
+	checks, _ = authorizer.Checks(httptest.NewRequest(http.MethodPost, "/v1/allocation/1234/stop", nil))
+	assert.False(t, checks, "writes are not reads")
+	checks, _ = authorizer.Checks(httptest.NewRequest(http.MethodGet, "/v1/jobs", nil))
+	assert.False(t, checks)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/allocation/1234", nil)
+	err := authorizer.Authorize(context.Background(), req, &config.RequestContext{Operation: config.OperationRead})
+	require.Error(t, err)
+	assert.Equal(t, errcode.CodeForbidden, errcode.Of(err).Code)
+	assert.Equal(t, http.StatusForbidden, errcode.Status(err))
+	rejecting.AssertCalled(t, "Validate", mock.MatchedBy(func(payload *types.Payload) bool {
+		return payload.Job == nil && payload.Context.Operation == config.OperationRead
+	}))
+
+	assert.NoError(t, authorizer.Authorize(context.Background(), httptest.NewRequest(http.MethodGet, "/v1/jobs", nil), &config.RequestContext{}))
+
+	authorizer.Replace([]*ReadRule{{Validator: failing}})
+	err = authorizer.Authorize(context.Background(), httptest.NewRequest(http.MethodGet, "/v1/jobs", nil), &config.RequestContext{})
+	require.Error(t, err)
+	assert.Equal(t, errcode.CodeInternal, errcode.Of(err).Code, "failing rules keep their code")
+
+	var nilAuthorizer *ReadAuthorizer
+	checks, _ = nilAuthorizer.Checks(req)
+	assert.False(t, checks)
+	assert.NoError(t, nilAuthorizer.Authorize(context.Background(), req, &config.RequestContext{}))
+}
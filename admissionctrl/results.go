@@ -0,0 +1,92 @@
+package admissionctrl
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// ResultValidator returns structured results instead of bare errors, results with SeverityError reject the job.
+// The error is reserved for failures of the rule itself, e.g. an unreachable service. AsValidator adds it to the
+// validators of a handler.
+type ResultValidator interface {
+	AdmissionController
+	ValidateResults(ctx context.Context, payload *types.Payload) ([]*types.Result, error)
+}
+
+// AsValidator adapts a ResultValidator to a JobValidator, the results are passed on as warnings and errors.
+func AsValidator(validator ResultValidator) JobValidator {
+	return &resultValidatorAdapter{validator: validator}
+}
+
+type resultValidatorAdapter struct {
+	validator ResultValidator
+}
+
+func (a *resultValidatorAdapter) Name() string {
+	return a.validator.Name()
+}
+
+func (a *resultValidatorAdapter) Validate(payload *types.Payload) ([]error, error) {
+	return a.ValidateContext(context.Background(), payload)
+}
+
+func (a *resultValidatorAdapter) ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error) {
+	results, err := a.validator.ValidateResults(ctx, payload)
+	if err != nil {
+		return nil, errcode.Failed(a.validator.Name(), err)
+	}
+	var warnings []error
+	var denials *multierror.Error
+	for _, result := range results {
+		if result.Severity == types.SeverityError {
+			denials = multierror.Append(denials, result)
+			continue
+		}
+		warnings = append(warnings, result)
+	}
+	return warnings, denials.ErrorOrNil()
+}
+
+func (a *resultValidatorAdapter) ValidateResults(ctx context.Context, payload *types.Payload) ([]*types.Result, error) {
+	return a.validator.ValidateResults(ctx, payload)
+}
+
+// ValidateResults returns the findings of the validator as results. The warnings and denials of validators
+// without ValidateResults are converted, denials get SeverityError, other errors are returned as failures.
+func ValidateResults(ctx context.Context, validator JobValidator, payload *types.Payload) ([]*types.Result, error) {
+	if v, ok := validator.(ResultValidator); ok {
+		return v.ValidateResults(ctx, payload)
+	}
+	warnings, err := ValidateContext(ctx, validator, payload)
+	results := types.ResultsOf(warnings)
+	denials, failures := resultsOf(validator.Name(), err)
+	return append(results, denials...), failures
+}
+
+// resultsOf splits the error of a validator into the results of its denials and the failures of the rule.
+func resultsOf(rule string, err error) ([]*types.Result, error) {
+	if err == nil {
+		return nil, nil
+	}
+	var results []*types.Result
+	var failures *multierror.Error
+	for _, coded := range errcode.Errors(errcode.Classify(rule, err)) {
+		if coded.Code != errcode.CodeDenied {
+			failures = multierror.Append(failures, coded)
+			continue
+		}
+		result := types.ResultOf(coded.Err)
+		result.Severity = types.SeverityError
+		results = append(results, result)
+	}
+	return results, failures.ErrorOrNil()
+}
+
+// Denials returns the results of the denials in the error of a handler, failures of rules are left out.
+func Denials(err error) []*types.Result {
+	denials, _ := resultsOf("", err)
+	return denials
+}
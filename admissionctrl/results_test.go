@@ -0,0 +1,79 @@
+package admissionctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// countResultValidator reports the count of the first task group.
+type countResultValidator struct {
+	results []*types.Result
+	err     error
+}
+
+func (v *countResultValidator) Name() string {
+	return "count"
+}
+
+func (v *countResultValidator) ValidateResults(ctx context.Context, payload *types.Payload) ([]*types.Result, error) {
+	return v.results, v.err
+}
+
+func TestAsValidator(t *testing.T) {
+	denial := &types.Result{Severity: types.SeverityError, Message: "count must be at least 2", Field: "TaskGroups[0].Count", Code: "min_count"}
+	advice := &types.Result{Severity: types.SeverityInfo, Message: "consider a canary"}
+	validator := AsValidator(&countResultValidator{results: []*types.Result{denial, advice}})
+	assert.Equal(t, "count", validator.Name())
+
+	warnings, err := validator.Validate(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	assert.Equal(t, []error{advice}, warnings)
+	assert.Equal(t, types.SeverityInfo, types.SeverityOf(warnings[0]))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TaskGroups[0].Count: count must be at least 2")
+
+	_, err = AsValidator(&countResultValidator{err: errors.New("no quota service")}).Validate(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	assert.Equal(t, errcode.CodeInternal, errcode.Of(err).Code, "the error is a failure of the rule")
+}
+
+func TestValidateResults_Legacy(t *testing.T) {
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return(
+		[]error{types.WithSeverity(fmt.Errorf("consider a canary"), types.SeverityInfo)},
+		multierror.Append(fmt.Errorf("missing owner"), errcode.Unreachable("", fmt.Errorf("connection refused"))),
+	)
+
+	results, err := ValidateResults(context.Background(), validator, &types.Payload{Job: &api.Job{ID: pointer("job")}})
+	assert.Equal(t, []*types.Result{
+		{Severity: types.SeverityInfo, Message: "consider a canary"},
+		{Severity: types.SeverityError, Message: "missing owner"},
+	}, results)
+	require.Error(t, err)
+	assert.Equal(t, errcode.CodeUnavailable, errcode.Of(err).Code, "failures are not results")
+	assert.Equal(t, "mock-validator", errcode.Of(err).Rule)
+}
+
+func TestJobHandler_RecordsResults(t *testing.T) {
+	recorder := &decisionRecorder{}
+	denial := &types.Result{Severity: types.SeverityError, Message: "count must be at least 2", Field: "TaskGroups[0].Count", DocsURL: "https://example.com/count"}
+	j := NewJobHandler(nil, []JobValidator{AsValidator(&countResultValidator{results: []*types.Result{denial}})}, hclog.NewNullLogger(), false)
+	j.UseDecisionSinks(recorder)
+
+	_, _, err := j.ApplyAdmissionControllers(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.Error(t, err)
+	assert.Equal(t, []*types.Result{denial}, Denials(err))
+
+	require.Len(t, recorder.decisions, 1)
+	assert.Equal(t, []*types.Result{denial}, recorder.decisions[0].Results)
+}
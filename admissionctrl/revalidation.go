@@ -0,0 +1,57 @@
+package admissionctrl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// UseRevalidation re-runs the mutators until they don't change the job anymore, at most maxPasses times,
+// so the validators always check the job a further pass of the mutators would submit.
+// A job that oscillates between states or doesn't settle within maxPasses is rejected.
+func (j *JobHandler) UseRevalidation(maxPasses int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.maxPasses = maxPasses
+}
+
+// mutateUntilStable applies the mutators until a pass returns the job unchanged.
+func (j *JobHandler) mutateUntilStable(ctx context.Context, payload *types.Payload, maxPasses int) (*api.Job, []error, error) {
+	state := jobState(payload.Job)
+	// seen maps the states of the job to the pass that produced them, to detect mutators undoing each other
+	seen := map[string]int{state: 0}
+	for pass := 1; ; pass++ {
+		job, warnings, err := j.mutate(ctx, payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		payload.Job = job
+		next := jobState(job)
+		if next == state {
+			j.logger.Debug("job is stable", "passes", pass, "job", job.ID)
+			// the warnings of the last pass belong to the final job
+			return job, warnings, nil
+		}
+		if previous, ok := seen[next]; ok {
+			return nil, nil, fmt.Errorf("mutators don't converge, pass %d reverts the job to its state after pass %d", pass, previous)
+		}
+		if pass == maxPasses {
+			return nil, nil, fmt.Errorf("mutators still change the job after %d passes", maxPasses)
+		}
+		seen[next] = pass
+		state = next
+	}
+}
+
+func jobState(job *api.Job) string {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return string(sum[:])
+}
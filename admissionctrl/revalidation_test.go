@@ -0,0 +1,93 @@
+package admissionctrl
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// toggleMutator flips the owner between a and b on every call.
+type toggleMutator struct{}
+
+func (m *toggleMutator) Name() string {
+	return "toggle"
+}
+
+func (m *toggleMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	owner := "a"
+	if payload.Job.Meta["owner"] == "a" {
+		owner = "b"
+	}
+	payload.Job.Meta = map[string]string{"owner": owner}
+	return payload.Job, nil, nil
+}
+
+// counterMutator increments a counter on every call.
+type counterMutator struct{}
+
+func (m *counterMutator) Name() string {
+	return "counter"
+}
+
+func (m *counterMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	count, _ := strconv.Atoi(payload.Job.Meta["count"])
+	payload.Job.Meta = map[string]string{"count": strconv.Itoa(count + 1)}
+	return payload.Job, nil, nil
+}
+
+func TestJobHandler_UseRevalidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		mutators  []JobMutator
+		maxPasses int
+		wantMeta  map[string]string
+		wantErr   string
+	}{
+		{name: "stable", mutators: []JobMutator{&metaMutator{name: "owner", value: "team-a"}}, maxPasses: 3, wantMeta: map[string]string{"owner": "team-a"}},
+		{name: "disabled", mutators: []JobMutator{&counterMutator{}}, maxPasses: 0, wantMeta: map[string]string{"count": "1"}},
+		{name: "oscillating", mutators: []JobMutator{&toggleMutator{}}, maxPasses: 5, wantErr: "mutators don't converge, pass 3 reverts the job to its state after pass 1"},
+		{name: "not converging", mutators: []JobMutator{&counterMutator{}}, maxPasses: 3, wantErr: "mutators still change the job after 3 passes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := new(testutil.MockValidator)
+			validator.On("Validate", mock.Anything).Return([]error{}, nil)
+			j := NewJobHandler(tt.mutators, []JobValidator{validator}, hclog.NewNullLogger(), false)
+			j.UseRevalidation(tt.maxPasses)
+
+			job, _, err := j.ApplyAdmissionControllers(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				validator.AssertNotCalled(t, "Validate", mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMeta, job.Meta)
+			validator.AssertCalled(t, "Validate", mock.MatchedBy(func(payload *types.Payload) bool {
+				return payload.Job == job
+			}))
+		})
+	}
+}
+
+func TestJobHandler_ValidatorsSeeMutatedJob(t *testing.T) {
+	// the mutator returns a new job instead of changing the payload
+	mutator := new(testutil.MockMutator)
+	mutator.On("Mutate", mock.Anything).Return(&api.Job{ID: pointer("mutated")}, []error{}, nil)
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, nil)
+
+	j := NewJobHandler([]JobMutator{mutator}, []JobValidator{validator}, hclog.NewNullLogger(), false)
+	_, _, err := j.ApplyAdmissionControllers(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.NoError(t, err)
+	validator.AssertCalled(t, "Validate", mock.MatchedBy(func(payload *types.Payload) bool {
+		return *payload.Job.ID == "mutated"
+	}))
+}
@@ -0,0 +1,92 @@
+package admissionctrl
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// ScopedValidator only runs a validator for the jobs selected by its jobs block,
+// e.g. to exempt legacy jobs from a new policy while every new job is enforced.
+type ScopedValidator struct {
+	validator JobValidator
+	jobs      *selector.JobFilter
+	logger    hclog.Logger
+}
+
+func NewScopedValidator(validator JobValidator, jobs *selector.JobFilter, logger hclog.Logger) *ScopedValidator {
+	return &ScopedValidator{
+		validator: validator,
+		jobs:      jobs,
+		logger:    logger,
+	}
+}
+
+func (s *ScopedValidator) Name() string {
+	return s.validator.Name()
+}
+
+// Unwrap returns the wrapped validator.
+func (s *ScopedValidator) Unwrap() JobValidator {
+	return s.validator
+}
+
+func (s *ScopedValidator) Validate(payload *types.Payload) ([]error, error) {
+	return s.ValidateContext(context.Background(), payload)
+}
+
+func (s *ScopedValidator) ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error) {
+	if !s.jobs.Matches(payload.Job) {
+		s.logger.Debug("job is out of scope, skipping rule", "rule", s.Name(), "job", jobID(payload.Job))
+		return nil, nil
+	}
+	return ValidateContext(ctx, s.validator, payload)
+}
+
+// ScopedMutator only runs a mutator for the jobs selected by its jobs block.
+type ScopedMutator struct {
+	mutator JobMutator
+	jobs    *selector.JobFilter
+	logger  hclog.Logger
+}
+
+func NewScopedMutator(mutator JobMutator, jobs *selector.JobFilter, logger hclog.Logger) *ScopedMutator {
+	return &ScopedMutator{
+		mutator: mutator,
+		jobs:    jobs,
+		logger:  logger,
+	}
+}
+
+func (s *ScopedMutator) Name() string {
+	return s.mutator.Name()
+}
+
+// Unwrap returns the wrapped mutator.
+func (s *ScopedMutator) Unwrap() JobMutator {
+	return s.mutator
+}
+
+func (s *ScopedMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	return s.MutateContext(context.Background(), payload)
+}
+
+func (s *ScopedMutator) MutateContext(ctx context.Context, payload *types.Payload) (*api.Job, []error, error) {
+	if !s.jobs.Matches(payload.Job) {
+		s.logger.Debug("job is out of scope, skipping rule", "rule", s.Name(), "job", jobID(payload.Job))
+		return payload.Job, nil, nil
+	}
+	return MutateContext(ctx, s.mutator, payload)
+}
+
+// MutatePatch returns an empty patch for jobs out of scope.
+func (s *ScopedMutator) MutatePatch(ctx context.Context, payload *types.Payload) (*types.Mutation, error) {
+	if !s.jobs.Matches(payload.Job) {
+		s.logger.Debug("job is out of scope, skipping rule", "rule", s.Name(), "job", jobID(payload.Job))
+		return &types.Mutation{}, nil
+	}
+	return MutatePatch(ctx, s.mutator, payload)
+}
@@ -0,0 +1,56 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopedValidator(t *testing.T) {
+	rejecting := new(testutil.MockValidator)
+	rejecting.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf("missing owner"))
+
+	jobs, err := selector.NewJobFilter(&config.Jobs{Exclude: []string{"legacy-*"}})
+	require.NoError(t, err)
+	scoped := NewScopedValidator(rejecting, jobs, hclog.NewNullLogger())
+	assert.Equal(t, "mock-validator", scoped.Name())
+
+	warnings, err := scoped.Validate(&types.Payload{Job: &api.Job{ID: pointer("legacy-billing")}})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	rejecting.AssertNotCalled(t, "Validate", mock.Anything)
+
+	_, err = scoped.Validate(&types.Payload{Job: &api.Job{ID: pointer("billing")}})
+	assert.ErrorContains(t, err, "missing owner")
+}
+
+func TestScopedMutator(t *testing.T) {
+	mutated := &api.Job{ID: pointer("payments-api"), Meta: map[string]string{"team": "payments"}}
+	mutator := new(testutil.MockMutator)
+	mutator.On("Mutate", mock.Anything).Return(mutated, []error{}, nil)
+
+	jobs, err := selector.NewJobFilter(&config.Jobs{Include: []string{"payments-*"}})
+	require.NoError(t, err)
+	scoped := NewScopedMutator(mutator, jobs, hclog.NewNullLogger())
+	assert.Equal(t, "mock-mutator", scoped.Name())
+
+	other := &api.Job{ID: pointer("web")}
+	job, warnings, err := scoped.Mutate(&types.Payload{Job: other})
+	require.NoError(t, err)
+	assert.Same(t, other, job)
+	assert.Empty(t, warnings)
+	mutator.AssertNotCalled(t, "Mutate", mock.Anything)
+
+	job, _, err = scoped.Mutate(&types.Payload{Job: &api.Job{ID: pointer("payments-api")}})
+	require.NoError(t, err)
+	assert.Same(t, mutated, job)
+}
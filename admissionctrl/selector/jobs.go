@@ -0,0 +1,93 @@
+package selector
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+)
+
+// JobFilter limits a rule to the jobs whose ID or name is included and not excluded.
+type JobFilter struct {
+	include      []string
+	exclude      []string
+	includeRegex []*regexp.Regexp
+	excludeRegex []*regexp.Regexp
+}
+
+// NewJobFilter creates a filter, without inclusions every job that is not excluded matches.
+func NewJobFilter(c *config.Jobs) (*JobFilter, error) {
+	f := &JobFilter{}
+	if c == nil {
+		return f, nil
+	}
+	for _, pattern := range append(append([]string{}, c.Include...), c.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid job pattern %q: %w", pattern, err)
+		}
+	}
+	f.include = c.Include
+	f.exclude = c.Exclude
+
+	var err error
+	if f.includeRegex, err = compileAll(c.IncludeRegex); err != nil {
+		return nil, err
+	}
+	if f.excludeRegex, err = compileAll(c.ExcludeRegex); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func compileAll(expressions []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(expressions))
+	for _, expr := range expressions {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job regex %q: %w", expr, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Matches reports whether the rule applies to the job.
+func (f *JobFilter) Matches(job *api.Job) bool {
+	names := jobNames(job)
+	if len(f.include) > 0 || len(f.includeRegex) > 0 {
+		if !matchesAny(names, f.include, f.includeRegex) {
+			return false
+		}
+	}
+	return !matchesAny(names, f.exclude, f.excludeRegex)
+}
+
+func matchesAny(names []string, globs []string, regexes []*regexp.Regexp) bool {
+	for _, name := range names {
+		for _, pattern := range globs {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		for _, re := range regexes {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jobNames returns the ID and, if it differs, the name of the job.
+func jobNames(job *api.Job) []string {
+	var names []string
+	if job.ID != nil {
+		names = append(names, *job.ID)
+	}
+	if job.Name != nil && (job.ID == nil || *job.Name != *job.ID) {
+		names = append(names, *job.Name)
+	}
+	return names
+}
@@ -0,0 +1,103 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobFilter(t *testing.T) {
+	job := func(id, name string) *api.Job {
+		return &api.Job{ID: &id, Name: &name}
+	}
+	tt := []struct {
+		name string
+		jobs *config.Jobs
+		job  *api.Job
+		want bool
+	}{
+		{
+			name: "no block matches everything",
+			job:  job("web", "web"),
+			want: true,
+		},
+		{
+			name: "excluded by glob",
+			jobs: &config.Jobs{Exclude: []string{"legacy-*"}},
+			job:  job("legacy-billing", "legacy-billing"),
+			want: false,
+		},
+		{
+			name: "not excluded",
+			jobs: &config.Jobs{Exclude: []string{"legacy-*"}},
+			job:  job("billing", "billing"),
+			want: true,
+		},
+		{
+			name: "excluded by name",
+			jobs: &config.Jobs{Exclude: []string{"legacy-*"}},
+			job:  job("billing", "legacy-billing"),
+			want: false,
+		},
+		{
+			name: "excluded by regex",
+			jobs: &config.Jobs{ExcludeRegex: []string{`^batch-[0-9]+$`}},
+			job:  job("batch-42", "batch-42"),
+			want: false,
+		},
+		{
+			name: "regex is not anchored",
+			jobs: &config.Jobs{ExcludeRegex: []string{`[0-9]+`}},
+			job:  job("web2", "web2"),
+			want: false,
+		},
+		{
+			name: "included by glob",
+			jobs: &config.Jobs{Include: []string{"payments-*"}},
+			job:  job("payments-api", "payments-api"),
+			want: true,
+		},
+		{
+			name: "not included",
+			jobs: &config.Jobs{Include: []string{"payments-*"}},
+			job:  job("web", "web"),
+			want: false,
+		},
+		{
+			name: "included by regex",
+			jobs: &config.Jobs{Include: []string{"payments-*"}, IncludeRegex: []string{`^checkout`}},
+			job:  job("checkout", "checkout"),
+			want: true,
+		},
+		{
+			name: "exclusion wins over inclusion",
+			jobs: &config.Jobs{Include: []string{"payments-*"}, Exclude: []string{"payments-legacy"}},
+			job:  job("payments-legacy", "payments-legacy"),
+			want: false,
+		},
+		{
+			name: "job without id and name",
+			jobs: &config.Jobs{Include: []string{"*"}},
+			job:  &api.Job{},
+			want: false,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := NewJobFilter(tc.jobs)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, f.Matches(tc.job))
+		})
+	}
+}
+
+func TestNewJobFilterFailsOnInvalidPatterns(t *testing.T) {
+	_, err := NewJobFilter(&config.Jobs{Include: []string{"[web"}})
+	assert.ErrorContains(t, err, "invalid job pattern")
+
+	_, err = NewJobFilter(&config.Jobs{ExcludeRegex: []string{"legacy-("}})
+	assert.ErrorContains(t, err, "invalid job regex")
+}
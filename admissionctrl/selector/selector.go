@@ -0,0 +1,75 @@
+// Package selector matches jobs by namespace, job ID pattern and meta, it is shared by the built-in rules.
+package selector
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+)
+
+type Selector struct {
+	namespaces map[string]bool
+	jobIDs     []string
+	meta       map[string]string
+}
+
+// New creates a selector, empty fields match everything.
+func New(c *config.Selector) (*Selector, error) {
+	s := &Selector{}
+	if c == nil {
+		return s, nil
+	}
+	if len(c.Namespaces) > 0 {
+		s.namespaces = make(map[string]bool, len(c.Namespaces))
+		for _, ns := range c.Namespaces {
+			s.namespaces[ns] = true
+		}
+	}
+	for _, pattern := range c.JobIDs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid job id pattern %q: %w", pattern, err)
+		}
+	}
+	s.jobIDs = c.JobIDs
+	s.meta = c.Meta
+	return s, nil
+}
+
+// Matches reports whether the job is selected.
+func (s *Selector) Matches(job *api.Job) bool {
+	if s.namespaces != nil && !s.namespaces[Namespace(job)] {
+		return false
+	}
+	if len(s.jobIDs) > 0 {
+		var id string
+		if job.ID != nil {
+			id = *job.ID
+		}
+		matched := false
+		for _, pattern := range s.jobIDs {
+			if ok, _ := path.Match(pattern, id); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for key, value := range s.meta {
+		if job.Meta[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Namespace returns the namespace of the job, unset means default.
+func Namespace(job *api.Job) string {
+	if job.Namespace == nil || *job.Namespace == "" {
+		return "default"
+	}
+	return *job.Namespace
+}
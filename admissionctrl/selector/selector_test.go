@@ -0,0 +1,86 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelector(t *testing.T) {
+	job := func(namespace, id string, meta map[string]string) *api.Job {
+		return &api.Job{ID: &id, Namespace: &namespace, Meta: meta}
+	}
+	tt := []struct {
+		name     string
+		selector *config.Selector
+		job      *api.Job
+		want     bool
+	}{
+		{
+			name: "empty selector matches everything",
+			job:  job("default", "web", nil),
+			want: true,
+		},
+		{
+			name:     "namespace",
+			selector: &config.Selector{Namespaces: []string{"system"}},
+			job:      job("system", "traefik", nil),
+			want:     true,
+		},
+		{
+			name:     "unset namespace is default",
+			selector: &config.Selector{Namespaces: []string{"default"}},
+			job:      &api.Job{ID: pointerOf("web")},
+			want:     true,
+		},
+		{
+			name:     "other namespace",
+			selector: &config.Selector{Namespaces: []string{"system"}},
+			job:      job("default", "traefik", nil),
+			want:     false,
+		},
+		{
+			name:     "job id pattern",
+			selector: &config.Selector{JobIDs: []string{"consul-*", "traefik"}},
+			job:      job("default", "consul-esm", nil),
+			want:     true,
+		},
+		{
+			name:     "job id pattern does not match",
+			selector: &config.Selector{JobIDs: []string{"consul-*"}},
+			job:      job("default", "web", nil),
+			want:     false,
+		},
+		{
+			name:     "meta",
+			selector: &config.Selector{Meta: map[string]string{"tier": "critical"}},
+			job:      job("default", "web", map[string]string{"tier": "critical", "team": "a"}),
+			want:     true,
+		},
+		{
+			name:     "meta differs",
+			selector: &config.Selector{Meta: map[string]string{"tier": "critical"}},
+			job:      job("default", "web", nil),
+			want:     false,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(tc.selector)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, s.Matches(tc.job))
+		})
+	}
+}
+
+func TestNewFailsOnInvalidPattern(t *testing.T) {
+	_, err := New(&config.Selector{JobIDs: []string{"[web"}})
+	assert.ErrorContains(t, err, "invalid job id pattern")
+}
+
+func pointerOf[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,50 @@
+package admissionctrl
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// SeverityValidator reports the errors of a validator with a lower severity,
+// so the rule advises tenants instead of rejecting their jobs.
+type SeverityValidator struct {
+	validator JobValidator
+	severity  types.Severity
+}
+
+func NewSeverityValidator(validator JobValidator, severity types.Severity) *SeverityValidator {
+	return &SeverityValidator{
+		validator: validator,
+		severity:  severity,
+	}
+}
+
+func (s *SeverityValidator) Name() string {
+	return s.validator.Name()
+}
+
+// Unwrap returns the wrapped validator.
+func (s *SeverityValidator) Unwrap() JobValidator {
+	return s.validator
+}
+
+func (s *SeverityValidator) Validate(payload *types.Payload) ([]error, error) {
+	return s.ValidateContext(context.Background(), payload)
+}
+
+func (s *SeverityValidator) ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error) {
+	warnings, err := ValidateContext(ctx, s.validator, payload)
+	if err == nil {
+		return warnings, nil
+	}
+	errs := []error{err}
+	if merr, ok := err.(*multierror.Error); ok {
+		errs = merr.Errors
+	}
+	for _, e := range errs {
+		warnings = append(warnings, types.WithSeverity(e, s.severity))
+	}
+	return warnings, nil
+}
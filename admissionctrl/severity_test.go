@@ -0,0 +1,31 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeverityValidator(t *testing.T) {
+	rejecting := new(testutil.MockValidator)
+	rejecting.On("Validate", mock.Anything).Return([]error{fmt.Errorf("count is high")},
+		multierror.Append(nil, fmt.Errorf("missing owner"), fmt.Errorf("missing team")))
+
+	validator := NewSeverityValidator(rejecting, types.SeverityInfo)
+	assert.Equal(t, "mock-validator", validator.Name())
+
+	warnings, err := validator.Validate(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.NoError(t, err)
+	require.Len(t, warnings, 3)
+	assert.Equal(t, types.SeverityWarning, types.SeverityOf(warnings[0]))
+	assert.EqualError(t, warnings[1], "missing owner")
+	assert.Equal(t, types.SeverityInfo, types.SeverityOf(warnings[1]))
+	assert.Equal(t, types.SeverityInfo, types.SeverityOf(warnings[2]))
+}
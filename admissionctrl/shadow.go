@@ -0,0 +1,183 @@
+package admissionctrl
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/metrics"
+)
+
+const (
+	DefaultShadowMaxMismatches = 100
+	// shadowMaxConcurrent bounds the background evaluations, further jobs are skipped
+	shadowMaxConcurrent = 8
+)
+
+// ShadowDecision is the outcome of a rule set for one job.
+type ShadowDecision struct {
+	Rejected bool     `json:"rejected"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	// Mutated is set if the rule set changed the job
+	Mutated bool `json:"mutated"`
+}
+
+// ShadowMismatch records a job for which the candidate rule set decided differently than the active one.
+type ShadowMismatch struct {
+	Time      time.Time      `json:"time"`
+	Namespace string         `json:"namespace"`
+	JobID     string         `json:"job_id"`
+	Active    ShadowDecision `json:"active"`
+	Candidate ShadowDecision `json:"candidate"`
+	// JobDiffers is set if both rule sets accepted the job but mutated it differently
+	JobDiffers bool `json:"job_differs"`
+}
+
+// ShadowReport summarizes the comparison of the candidate against the active rule set.
+type ShadowReport struct {
+	Evaluated  int64            `json:"evaluated"`
+	Matched    int64            `json:"matched"`
+	Mismatched int64            `json:"mismatched"`
+	Skipped    int64            `json:"skipped"`
+	Mismatches []ShadowMismatch `json:"mismatches"`
+}
+
+// Shadow evaluates a candidate rule set on live traffic without enforcing it,
+// and compares its decisions with the ones of the active rule set.
+type Shadow struct {
+	candidate     *JobHandler
+	logger        hclog.Logger
+	maxMismatches int
+	slots         chan struct{}
+	wg            sync.WaitGroup
+
+	mu     sync.Mutex
+	report ShadowReport
+}
+
+func NewShadow(candidate *JobHandler, maxMismatches int, logger hclog.Logger) *Shadow {
+	if maxMismatches <= 0 {
+		maxMismatches = DefaultShadowMaxMismatches
+	}
+	return &Shadow{
+		candidate:     candidate,
+		logger:        logger,
+		maxMismatches: maxMismatches,
+		slots:         make(chan struct{}, shadowMaxConcurrent),
+	}
+}
+
+// Candidate returns the handler of the candidate rules, e.g. to replace them on reload.
+func (s *Shadow) Candidate() *JobHandler {
+	return s.candidate
+}
+
+// Report returns a copy of the current report.
+func (s *Shadow) Report() ShadowReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.report
+	report.Mismatches = append([]ShadowMismatch{}, s.report.Mismatches...)
+	return report
+}
+
+// Reset clears the report, e.g. after the candidate rules changed.
+func (s *Shadow) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report = ShadowReport{}
+}
+
+// Compare evaluates the candidate rules for the original payload in the background
+// and records whether they decided like the active rules.
+func (s *Shadow) Compare(original *types.Payload, active ShadowDecision, activeJob *api.Job) {
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		metrics.ShadowEvaluations.WithLabelValues("skipped").Inc()
+		s.mu.Lock()
+		s.report.Skipped++
+		s.mu.Unlock()
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			<-s.slots
+			s.wg.Done()
+		}()
+		s.compare(original, active, activeJob)
+	}()
+}
+
+// Wait blocks until all running comparisons are done.
+func (s *Shadow) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Shadow) compare(original *types.Payload, active ShadowDecision, activeJob *api.Job) {
+	before := copyJob(original.Job)
+	job, warnings, err := s.candidate.ApplyAdmissionControllers(original)
+	candidate := NewShadowDecision(before, job, warnings, err)
+
+	jobDiffers := !active.Rejected && !candidate.Rejected && !sameJob(activeJob, job)
+	matched := active.Rejected == candidate.Rejected && !jobDiffers
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Evaluated++
+	if matched {
+		s.report.Matched++
+		metrics.ShadowEvaluations.WithLabelValues("match").Inc()
+		return
+	}
+	s.report.Mismatched++
+	metrics.ShadowEvaluations.WithLabelValues("mismatch").Inc()
+	mismatch := ShadowMismatch{
+		Time:       time.Now(),
+		Namespace:  namespaceOf(before),
+		JobID:      jobID(before),
+		Active:     active,
+		Candidate:  candidate,
+		JobDiffers: jobDiffers,
+	}
+	s.logger.Info("candidate rules decided differently", "job", mismatch.JobID, "namespace", mismatch.Namespace,
+		"active_rejected", active.Rejected, "candidate_rejected", candidate.Rejected, "job_differs", jobDiffers)
+	s.report.Mismatches = append(s.report.Mismatches, mismatch)
+	if len(s.report.Mismatches) > s.maxMismatches {
+		s.report.Mismatches = s.report.Mismatches[len(s.report.Mismatches)-s.maxMismatches:]
+	}
+}
+
+// NewShadowDecision summarizes the result of ApplyAdmissionControllers for the given input job.
+func NewShadowDecision(input, output *api.Job, warnings []error, err error) ShadowDecision {
+	decision := ShadowDecision{Rejected: err != nil}
+	if merr, ok := err.(*multierror.Error); ok {
+		for _, e := range merr.Errors {
+			decision.Errors = append(decision.Errors, e.Error())
+		}
+	} else if err != nil {
+		decision.Errors = []string{err.Error()}
+	} else {
+		decision.Mutated = !sameJob(input, output)
+	}
+	for _, w := range warnings {
+		decision.Warnings = append(decision.Warnings, w.Error())
+	}
+	return decision
+}
+
+func sameJob(a, b *api.Job) bool {
+	aData, aErr := json.Marshal(a)
+	bData, bErr := json.Marshal(b)
+	if aErr != nil || bErr != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(aData) == string(bData)
+}
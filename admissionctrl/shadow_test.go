@@ -0,0 +1,131 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type metaMutator struct {
+	name  string
+	value string
+}
+
+func (m *metaMutator) Name() string {
+	return m.name
+}
+
+func (m *metaMutator) Mutate(payload *types.Payload) (*api.Job, []error, error) {
+	payload.Job.Meta = map[string]string{"owner": m.value}
+	return payload.Job, nil, nil
+}
+
+func TestShadow(t *testing.T) {
+	accepting := new(testutil.MockValidator)
+	accepting.On("Validate", mock.Anything).Return([]error{}, nil)
+	rejecting := new(testutil.MockValidator)
+	rejecting.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf("missing owner"))
+
+	tt := []struct {
+		name           string
+		activeRules    []JobValidator
+		activeMutator  JobMutator
+		shadowRules    []JobValidator
+		shadowMutator  JobMutator
+		wantMatched    bool
+		wantJobDiffers bool
+	}{
+		{name: "same decision", activeRules: []JobValidator{accepting}, shadowRules: []JobValidator{accepting}, wantMatched: true},
+		{name: "candidate rejects", activeRules: []JobValidator{accepting}, shadowRules: []JobValidator{rejecting}},
+		{name: "candidate accepts", activeRules: []JobValidator{rejecting}, shadowRules: []JobValidator{accepting}},
+		{name: "both reject", activeRules: []JobValidator{rejecting}, shadowRules: []JobValidator{rejecting}, wantMatched: true},
+		{
+			name:          "same mutation",
+			activeMutator: &metaMutator{name: "owner", value: "a"}, shadowMutator: &metaMutator{name: "owner", value: "a"},
+			wantMatched: true,
+		},
+		{
+			name:          "different mutation",
+			activeMutator: &metaMutator{name: "owner", value: "a"}, shadowMutator: &metaMutator{name: "owner", value: "b"},
+			wantJobDiffers: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var activeMutators, shadowMutators []JobMutator
+			if tc.activeMutator != nil {
+				activeMutators = []JobMutator{tc.activeMutator}
+			}
+			if tc.shadowMutator != nil {
+				shadowMutators = []JobMutator{tc.shadowMutator}
+			}
+			candidate := NewJobHandler(shadowMutators, tc.shadowRules, hclog.NewNullLogger(), false)
+			shadow := NewShadow(candidate, 0, hclog.NewNullLogger())
+			active := NewJobHandler(activeMutators, tc.activeRules, hclog.NewNullLogger(), false)
+			active.UseShadow(shadow)
+
+			_, _, activeErr := active.ApplyAdmissionControllers(&types.Payload{Job: &api.Job{ID: pointer("job"), Namespace: pointer("team")}})
+			shadow.Wait()
+
+			report := shadow.Report()
+			assert.Equal(t, int64(1), report.Evaluated)
+			if tc.wantMatched {
+				assert.Equal(t, int64(1), report.Matched)
+				assert.Empty(t, report.Mismatches)
+				return
+			}
+			assert.Equal(t, int64(1), report.Mismatched)
+			require.Len(t, report.Mismatches, 1)
+			mismatch := report.Mismatches[0]
+			assert.Equal(t, "job", mismatch.JobID)
+			assert.Equal(t, "team", mismatch.Namespace)
+			assert.Equal(t, activeErr != nil, mismatch.Active.Rejected)
+			assert.Equal(t, tc.wantJobDiffers, mismatch.JobDiffers)
+			if tc.wantJobDiffers {
+				assert.True(t, mismatch.Active.Mutated)
+				assert.True(t, mismatch.Candidate.Mutated)
+			}
+
+			shadow.Reset()
+			assert.Equal(t, ShadowReport{Mismatches: []ShadowMismatch{}}, shadow.Report())
+		})
+	}
+}
+
+func TestShadowKeepsLatestMismatches(t *testing.T) {
+	rejecting := new(testutil.MockValidator)
+	rejecting.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf("missing owner"))
+	shadow := NewShadow(NewJobHandler(nil, []JobValidator{rejecting}, hclog.NewNullLogger(), false), 2, hclog.NewNullLogger())
+	active := NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	active.UseShadow(shadow)
+
+	for i := 0; i < 5; i++ {
+		_, _, err := active.ApplyAdmissionControllers(&types.Payload{Job: &api.Job{ID: pointer(fmt.Sprintf("job-%d", i))}})
+		require.NoError(t, err)
+		shadow.Wait()
+	}
+	report := shadow.Report()
+	assert.Equal(t, int64(5), report.Mismatched)
+	require.Len(t, report.Mismatches, 2)
+	assert.Equal(t, "job-3", report.Mismatches[0].JobID)
+	assert.Equal(t, "job-4", report.Mismatches[1].JobID)
+	assert.Equal(t, []string{"missing owner"}, report.Mismatches[1].Candidate.Errors)
+}
+
+func TestShadowSkipsWhenBusy(t *testing.T) {
+	shadow := NewShadow(NewJobHandler(nil, nil, hclog.NewNullLogger(), false), 0, hclog.NewNullLogger())
+	for i := 0; i < cap(shadow.slots); i++ {
+		shadow.slots <- struct{}{}
+	}
+	shadow.Compare(&types.Payload{Job: &api.Job{}}, ShadowDecision{}, &api.Job{})
+	shadow.Wait()
+	assert.Equal(t, int64(1), shadow.Report().Skipped)
+	assert.Equal(t, int64(0), shadow.Report().Evaluated)
+}
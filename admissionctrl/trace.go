@@ -0,0 +1,73 @@
+package admissionctrl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+var (
+	ErrUnknownRule  = errors.New("unknown rule")
+	ErrNotTraceable = errors.New("rule can't be traced")
+)
+
+// TracingRule explains its decisions, e.g. OPA rules with the evaluation trace of their policy.
+type TracingRule interface {
+	Trace(*types.Payload) *types.Trace
+}
+
+// wrappedMutator is implemented by mutators that decide whether another mutator runs.
+type wrappedMutator interface {
+	Unwrap() JobMutator
+}
+
+// Trace evaluates the named mutator or validator for the payload with a trace. Only this rule runs, on the payload as given,
+// and regardless of its scope, canary or exemptions.
+func (j *JobHandler) Trace(kind, name string, payload *types.Payload) (*types.Trace, error) {
+	rule, err := j.tracingRule(kind, name)
+	if err != nil {
+		return nil, err
+	}
+	j.attachData(payload)
+	return rule.Trace(payload), nil
+}
+
+func (j *JobHandler) tracingRule(kind, name string) (TracingRule, error) {
+	mutators, validators := j.rules()
+	var rule interface{}
+	for _, m := range mutators {
+		if kind != "mutator" || m.Name() != name {
+			continue
+		}
+		for {
+			wrapped, ok := m.(wrappedMutator)
+			if !ok {
+				break
+			}
+			m = wrapped.Unwrap()
+		}
+		rule = m
+	}
+	for _, v := range validators {
+		if kind != "validator" || v.Name() != name {
+			continue
+		}
+		for {
+			wrapped, ok := v.(wrappedValidator)
+			if !ok {
+				break
+			}
+			v = wrapped.Unwrap()
+		}
+		rule = v
+	}
+	if rule == nil {
+		return nil, fmt.Errorf("%w: no %s %s", ErrUnknownRule, kind, name)
+	}
+	tracing, ok := rule.(TracingRule)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s is no opa rule", ErrNotTraceable, kind, name)
+	}
+	return tracing, nil
+}
@@ -0,0 +1,47 @@
+package admissionctrl
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tracingValidator returns a trace with the job ID as only event.
+type tracingValidator struct {
+	testutil.MockValidator
+}
+
+func (v *tracingValidator) Name() string {
+	return "tracing"
+}
+
+func (v *tracingValidator) Trace(payload *types.Payload) *types.Trace {
+	return &types.Trace{Rule: v.Name(), Events: []string{*payload.Job.ID}}
+}
+
+func TestJobHandler_Trace(t *testing.T) {
+	tracing := &tracingValidator{}
+	other := new(testutil.MockValidator)
+	jobs, err := selector.NewJobFilter(&config.Jobs{Include: []string{"web-*"}})
+	require.NoError(t, err)
+
+	scoped := NewScopedValidator(NewSeverityValidator(tracing, types.SeverityWarning), jobs, hclog.NewNullLogger())
+	j := NewJobHandler(nil, []JobValidator{scoped, other}, hclog.NewNullLogger(), false)
+
+	// the scope doesn't apply to traces
+	trace, err := j.Trace("validator", "tracing", &types.Payload{Job: &api.Job{ID: pointer("api")}})
+	require.NoError(t, err)
+	assert.Equal(t, &types.Trace{Rule: "tracing", Events: []string{"api"}}, trace)
+
+	_, err = j.Trace("validator", "mock-validator", &types.Payload{Job: &api.Job{ID: pointer("api")}})
+	assert.ErrorIs(t, err, ErrNotTraceable)
+	_, err = j.Trace("mutator", "tracing", &types.Payload{Job: &api.Job{ID: pointer("api")}})
+	assert.ErrorIs(t, err, ErrUnknownRule)
+}
@@ -0,0 +1,12 @@
+package types
+
+import (
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// Mutation is the outcome of a mutator that describes its changes instead of rebuilding the job.
+type Mutation struct {
+	// Patch is a JSON patch (RFC 6902), its paths are relative to the job
+	Patch    jsonpatch.Patch
+	Warnings []error
+}
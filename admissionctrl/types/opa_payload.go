@@ -8,4 +8,6 @@ import (
 type Payload struct {
 	Job     *api.Job               `json:"job"`
 	Context *config.RequestContext `json:"context,omitempty"`
+	// Data holds the content of the configured data sources by name, OPA rules read it from data.sources instead
+	Data map[string]interface{} `json:"data,omitempty"`
 }
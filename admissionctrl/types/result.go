@@ -0,0 +1,62 @@
+package types
+
+import (
+	"errors"
+	"strings"
+)
+
+// Result is a structured finding of a validator. It is an error, so it passes through the warnings and
+// errors of the rules, ResultOf gets it back.
+type Result struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Field is the path of the job field the finding refers to, e.g. TaskGroups[0].Count
+	Field string `json:"field,omitempty"`
+	// Code identifies the finding for clients, e.g. missing_owner
+	Code string `json:"code,omitempty"`
+	// DocsURL explains the finding and how to fix the job
+	DocsURL string `json:"docs_url,omitempty"`
+}
+
+func (r *Result) Error() string {
+	var b strings.Builder
+	if r.Field != "" {
+		b.WriteString(r.Field)
+		b.WriteString(": ")
+	}
+	b.WriteString(r.Message)
+	if r.DocsURL != "" {
+		b.WriteString(", see ")
+		b.WriteString(r.DocsURL)
+	}
+	return b.String()
+}
+
+func (r *Result) findingSeverity() Severity {
+	return r.Severity
+}
+
+// ResultOf returns the result of a warning. Warnings that aren't a Result are converted with their message,
+// the severity is the one of SeverityOf, so a severity set by wrapping wins. Callers set SeverityError for denials.
+func ResultOf(err error) *Result {
+	result := &Result{Message: err.Error()}
+	var r *Result
+	if errors.As(err, &r) {
+		*result = *r
+		if msg := err.Error(); msg != r.Error() {
+			// wrapped with context, e.g. the rule version
+			result.Message = strings.Replace(msg, r.Error(), r.Message, 1)
+		}
+	}
+	result.Severity = SeverityOf(err)
+	return result
+}
+
+// ResultsOf converts findings with ResultOf.
+func ResultsOf(errs []error) []*Result {
+	var results []*Result
+	for _, err := range errs {
+		results = append(results, ResultOf(err))
+	}
+	return results
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultOf(t *testing.T) {
+	result := &Result{Severity: SeverityInfo, Message: "consider a canary", Field: "Update.Canary", Code: "canary", DocsURL: "https://example.com/canary"}
+	assert.Equal(t, "Update.Canary: consider a canary, see https://example.com/canary", result.Error())
+
+	tt := []struct {
+		name string
+		err  error
+		want *Result
+	}{
+		{
+			name: "plain warning",
+			err:  fmt.Errorf("count is high"),
+			want: &Result{Severity: SeverityWarning, Message: "count is high"},
+		},
+		{
+			name: "result",
+			err:  result,
+			want: result,
+		},
+		{
+			name: "wrapped result",
+			err:  fmt.Errorf("%w (rule@1)", result),
+			want: &Result{Severity: SeverityInfo, Message: "consider a canary (rule@1)", Field: "Update.Canary", Code: "canary", DocsURL: "https://example.com/canary"},
+		},
+		{
+			name: "severity wins",
+			err:  WithSeverity(result, SeverityWarning),
+			want: &Result{Severity: SeverityWarning, Message: "consider a canary", Field: "Update.Canary", Code: "canary", DocsURL: "https://example.com/canary"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ResultOf(tc.err))
+		})
+	}
+}
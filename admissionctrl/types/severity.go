@@ -0,0 +1,65 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Severity of a rule finding, errors reject the job, warnings and infos are advice.
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// ParseSeverity parses a configured severity, empty means error.
+func ParseSeverity(s string) (Severity, error) {
+	switch Severity(s) {
+	case "":
+		return SeverityError, nil
+	case SeverityInfo, SeverityWarning, SeverityError:
+		return Severity(s), nil
+	default:
+		return "", fmt.Errorf("unknown severity %q, must be info, warning or error", s)
+	}
+}
+
+// Finding is a warning with an explicit severity, it survives wrapping with %w.
+type Finding struct {
+	Severity Severity
+	Err      error
+}
+
+func (f *Finding) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Finding) Unwrap() error {
+	return f.Err
+}
+
+// WithSeverity marks a warning with the given severity.
+func WithSeverity(err error, severity Severity) error {
+	return &Finding{Severity: severity, Err: err}
+}
+
+func (f *Finding) findingSeverity() Severity {
+	return f.Severity
+}
+
+// severityCarrier is implemented by the warnings with a severity, Finding and Result.
+type severityCarrier interface {
+	findingSeverity() Severity
+}
+
+// SeverityOf returns the severity of a warning, warnings without one are SeverityWarning.
+// The outermost severity wins, e.g. the one of a severity validator wrapping a Result.
+func SeverityOf(err error) Severity {
+	var carrier severityCarrier
+	if errors.As(err, &carrier) && carrier.findingSeverity() != "" {
+		return carrier.findingSeverity()
+	}
+	return SeverityWarning
+}
@@ -0,0 +1,39 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeverityOf(t *testing.T) {
+	tt := []struct {
+		name string
+		err  error
+		want Severity
+	}{
+		{name: "plain warning", err: fmt.Errorf("count is high"), want: SeverityWarning},
+		{name: "info", err: WithSeverity(fmt.Errorf("consider a canary"), SeverityInfo), want: SeverityInfo},
+		{name: "wrapped info", err: fmt.Errorf("%w (rule@1)", WithSeverity(fmt.Errorf("consider a canary"), SeverityInfo)), want: SeverityInfo},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, SeverityOf(tc.err))
+		})
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	severity, err := ParseSeverity("")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityError, severity)
+
+	severity, err = ParseSeverity("info")
+	require.NoError(t, err)
+	assert.Equal(t, SeverityInfo, severity)
+
+	_, err = ParseSeverity("fatal")
+	assert.ErrorContains(t, err, "unknown severity")
+}
@@ -0,0 +1,11 @@
+package types
+
+// Trace explains the decision of a rule for a payload.
+type Trace struct {
+	Rule string `json:"rule"`
+	// Result are the bindings of the query, e.g. errors, warnings and patch
+	Result map[string]interface{} `json:"result,omitempty"`
+	// Error of the evaluation, the events still show how far it got
+	Error  string   `json:"error,omitempty"`
+	Events []string `json:"events"`
+}
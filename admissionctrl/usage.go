@@ -0,0 +1,38 @@
+package admissionctrl
+
+import (
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// UsageRecorder is implemented by validators that count admitted registrations, e.g. quotas.
+// Validate only checks the usage, it is recorded once the registration passed all rules and Nomad accepted it.
+type UsageRecorder interface {
+	JobValidator
+	RecordUsage(payload *types.Payload)
+}
+
+// RecordUsage records the accepted registration of the payload with the validators counting usage.
+func (j *JobHandler) RecordUsage(payload *types.Payload) {
+	_, validators := j.rules()
+	for _, validator := range validators {
+		recordUsage(validator, payload)
+	}
+}
+
+// recordUsage unwraps the validator until it finds a recorder, jobs out of the scope of a wrapper are not recorded.
+func recordUsage(validator JobValidator, payload *types.Payload) {
+	for {
+		if recorder, ok := validator.(UsageRecorder); ok {
+			recorder.RecordUsage(payload)
+			return
+		}
+		if scoped, ok := validator.(*ScopedValidator); ok && !scoped.jobs.Matches(payload.Job) {
+			return
+		}
+		wrapped, ok := validator.(wrappedValidator)
+		if !ok {
+			return
+		}
+		validator = wrapped.Unwrap()
+	}
+}
@@ -0,0 +1,43 @@
+package admissionctrl
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingValidator admits every job and counts the recorded ones.
+type countingValidator struct {
+	recorded []string
+}
+
+func (c *countingValidator) Name() string { return "counting" }
+
+func (c *countingValidator) Validate(*types.Payload) ([]error, error) { return nil, nil }
+
+func (c *countingValidator) RecordUsage(payload *types.Payload) {
+	c.recorded = append(c.recorded, *payload.Job.ID)
+}
+
+func TestJobHandlerRecordUsage(t *testing.T) {
+	direct := &countingValidator{}
+	scoped := &countingValidator{}
+	jobs, err := selector.NewJobFilter(&config.Jobs{Include: []string{"web-*"}})
+	require.NoError(t, err)
+	handler := NewJobHandler(nil, []JobValidator{
+		direct,
+		NewScopedValidator(scoped, jobs, hclog.NewNullLogger()),
+	}, hclog.NewNullLogger(), false)
+
+	for _, id := range []string{"web-1", "batch-1"} {
+		handler.RecordUsage(&types.Payload{Job: &api.Job{ID: &id}})
+	}
+	assert.Equal(t, []string{"web-1", "batch-1"}, direct.recorded)
+	assert.Equal(t, []string{"web-1"}, scoped.recorded, "jobs out of scope are not recorded")
+}
@@ -0,0 +1,113 @@
+package validator
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// ConnectPolicy describes the rules for Consul services, zero values disable a check.
+type ConnectPolicy struct {
+	RequireSidecar      bool
+	ServiceNamePattern  *regexp.Regexp
+	ForbidExposedChecks bool
+	// AllowedUpstreams are glob patterns of the allowed destination names
+	AllowedUpstreams []string
+}
+
+// ConnectValidator checks the Consul services of selected jobs, e.g. for clusters where the Consul
+// intentions are managed separately and jobs must not bypass the mesh.
+type ConnectValidator struct {
+	name     string
+	logger   hclog.Logger
+	mode     string
+	selector *selector.Selector
+	policy   ConnectPolicy
+}
+
+func NewConnectValidator(logger hclog.Logger, name string, mode string, selector *selector.Selector, policy ConnectPolicy) (*ConnectValidator, error) {
+	if mode == "" {
+		mode = ModeReject
+	}
+	if mode != ModeWarn && mode != ModeReject {
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+	for _, pattern := range policy.AllowedUpstreams {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid upstream pattern %q: %w", pattern, err)
+		}
+	}
+	return &ConnectValidator{
+		name:     name,
+		logger:   logger,
+		mode:     mode,
+		selector: selector,
+		policy:   policy,
+	}, nil
+}
+
+func (v *ConnectValidator) Validate(payload *types.Payload) ([]error, error) {
+	if !v.selector.Matches(payload.Job) {
+		return nil, nil
+	}
+	var problems []error
+	for _, s := range services(payload.Job) {
+		if s.service.Provider != "" && s.service.Provider != api.ServiceProviderConsul {
+			continue
+		}
+		problems = append(problems, v.check(s)...)
+	}
+	if len(problems) == 0 {
+		return nil, nil
+	}
+	if v.mode == ModeWarn {
+		return problems, nil
+	}
+	return nil, multierror.Append(nil, problems...)
+}
+
+func (v *ConnectValidator) check(s jobService) []error {
+	var problems []error
+	service := s.service
+	connect := service.Connect
+
+	if v.policy.ServiceNamePattern != nil && !v.policy.ServiceNamePattern.MatchString(service.Name) {
+		problems = append(problems, fmt.Errorf("%s does not match the naming convention %s", s, v.policy.ServiceNamePattern))
+	}
+	if v.policy.RequireSidecar && (connect == nil || (connect.SidecarService == nil && !connect.Native && connect.Gateway == nil)) {
+		problems = append(problems, fmt.Errorf("%s must use a Connect sidecar", s))
+	}
+
+	var proxy *api.ConsulProxy
+	if connect != nil && connect.SidecarService != nil {
+		proxy = connect.SidecarService.Proxy
+	}
+	if v.policy.ForbidExposedChecks {
+		for _, check := range service.Checks {
+			if check.Expose {
+				problems = append(problems, fmt.Errorf("%s must not expose check %s", s, check.Name))
+			}
+		}
+		if proxy != nil && proxy.Expose != nil && len(proxy.Expose.Paths) > 0 {
+			problems = append(problems, fmt.Errorf("%s must not expose paths via the sidecar proxy", s))
+		}
+	}
+	if v.policy.AllowedUpstreams != nil && proxy != nil {
+		for _, upstream := range proxy.Upstreams {
+			if upstream != nil && !matchesAny(v.policy.AllowedUpstreams, upstream.DestinationName) {
+				problems = append(problems, fmt.Errorf("%s must not use upstream %s", s, upstream.DestinationName))
+			}
+		}
+	}
+	return problems
+}
+
+func (v *ConnectValidator) Name() string {
+	return v.name
+}
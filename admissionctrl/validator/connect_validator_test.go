@@ -0,0 +1,126 @@
+package validator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serviceJob(groupServices []*api.Service, taskServices []*api.Service) *api.Job {
+	id, group, namespace := "example", "web", "default"
+	return &api.Job{
+		ID:        &id,
+		Namespace: &namespace,
+		TaskGroups: []*api.TaskGroup{{
+			Name:     &group,
+			Services: groupServices,
+			Tasks:    []*api.Task{{Name: "app", Services: taskServices}},
+		}},
+	}
+}
+
+func sidecar(upstreams ...string) *api.ConsulConnect {
+	proxy := &api.ConsulProxy{}
+	for _, u := range upstreams {
+		proxy.Upstreams = append(proxy.Upstreams, &api.ConsulUpstream{DestinationName: u})
+	}
+	return &api.ConsulConnect{SidecarService: &api.ConsulSidecarService{Proxy: proxy}}
+}
+
+func TestConnectValidator(t *testing.T) {
+	s, err := selector.New(&config.Selector{Namespaces: []string{"default"}})
+	require.NoError(t, err)
+	policy := ConnectPolicy{
+		RequireSidecar:      true,
+		ServiceNamePattern:  regexp.MustCompile(`^[a-z][a-z0-9-]*$`),
+		ForbidExposedChecks: true,
+		AllowedUpstreams:    []string{"db", "cache-*"},
+	}
+
+	tt := []struct {
+		name string
+		job  *api.Job
+		want []string
+	}{
+		{
+			name: "compliant",
+			job:  serviceJob([]*api.Service{{Name: "web", Connect: sidecar("db", "cache-redis")}}, nil),
+		},
+		{
+			name: "nomad services are ignored",
+			job:  serviceJob(nil, []*api.Service{{Name: "Web_UI", Provider: "nomad"}}),
+		},
+		{
+			name: "missing sidecar and bad name",
+			job:  serviceJob(nil, []*api.Service{{Name: "Web_UI"}}),
+			want: []string{
+				"service Web_UI in web/app does not match the naming convention ^[a-z][a-z0-9-]*$",
+				"service Web_UI in web/app must use a Connect sidecar",
+			},
+		},
+		{
+			name: "native connect",
+			job:  serviceJob([]*api.Service{{Name: "web", Connect: &api.ConsulConnect{Native: true}}}, nil),
+		},
+		{
+			name: "exposed checks and paths",
+			job: serviceJob([]*api.Service{{
+				Name:    "web",
+				Checks:  []api.ServiceCheck{{Name: "health", Expose: true}},
+				Connect: &api.ConsulConnect{SidecarService: &api.ConsulSidecarService{Proxy: &api.ConsulProxy{Expose: &api.ConsulExposeConfig{Paths: []*api.ConsulExposePath{{Path: "/metrics"}}}}}},
+			}}, nil),
+			want: []string{
+				"service web in web must not expose check health",
+				"service web in web must not expose paths via the sidecar proxy",
+			},
+		},
+		{
+			name: "forbidden upstream",
+			job:  serviceJob([]*api.Service{{Name: "web", Connect: sidecar("db", "payments")}}, nil),
+			want: []string{"service web in web must not use upstream payments"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			validator, err := NewConnectValidator(hclog.NewNullLogger(), "connect", ModeWarn, s, policy)
+			require.NoError(t, err)
+			warnings, err := validator.Validate(&types.Payload{Job: tc.job})
+			require.NoError(t, err)
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestConnectValidatorRejects(t *testing.T) {
+	validator, err := NewConnectValidator(hclog.NewNullLogger(), "connect", "", &selector.Selector{}, ConnectPolicy{RequireSidecar: true})
+	require.NoError(t, err)
+
+	_, err = validator.Validate(&types.Payload{Job: serviceJob([]*api.Service{{Name: "web"}}, nil)})
+	assert.ErrorContains(t, err, "must use a Connect sidecar")
+
+	otherNamespace, err := selector.New(&config.Selector{Namespaces: []string{"prod"}})
+	require.NoError(t, err)
+	validator, err = NewConnectValidator(hclog.NewNullLogger(), "connect", "", otherNamespace, ConnectPolicy{RequireSidecar: true})
+	require.NoError(t, err)
+	_, err = validator.Validate(&types.Payload{Job: serviceJob([]*api.Service{{Name: "web"}}, nil)})
+	assert.NoError(t, err, "job is not selected")
+}
+
+func TestNewConnectValidatorFailsOnInvalidConfig(t *testing.T) {
+	_, err := NewConnectValidator(hclog.NewNullLogger(), "connect", "ignore", &selector.Selector{}, ConnectPolicy{})
+	assert.ErrorContains(t, err, "unknown mode")
+
+	_, err = NewConnectValidator(hclog.NewNullLogger(), "connect", "", &selector.Selector{}, ConnectPolicy{AllowedUpstreams: []string{"[db"}})
+	assert.ErrorContains(t, err, "invalid upstream pattern")
+}
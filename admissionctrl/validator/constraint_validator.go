@@ -0,0 +1,173 @@
+package validator
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+const (
+	ModeWarn   = "warn"
+	ModeReject = "reject"
+)
+
+// ConstraintValidator detects constraints that can obviously never be satisfied, e.g. contradicting
+// attribute constraints or datacenters, node pools and node classes without any node, so a job
+// does not get stuck pending.
+type ConstraintValidator struct {
+	name      string
+	logger    hclog.Logger
+	mode      string
+	inventory InventorySource
+}
+
+// NewConstraintValidator creates the validator, inventory may be nil to skip the checks against the cluster.
+func NewConstraintValidator(logger hclog.Logger, name string, mode string, inventory InventorySource) (*ConstraintValidator, error) {
+	if mode == "" {
+		mode = ModeReject
+	}
+	if mode != ModeWarn && mode != ModeReject {
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+	return &ConstraintValidator{
+		name:      name,
+		logger:    logger,
+		mode:      mode,
+		inventory: inventory,
+	}, nil
+}
+
+func (v *ConstraintValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	problems := contradictions(job)
+
+	if v.inventory != nil {
+		inventory, err := v.inventory.Inventory()
+		if err != nil {
+			// the cluster checks are best effort, don't block deployments if the API is unavailable
+			v.logger.Warn("failed to load cluster inventory, skipping cluster checks", "rule", v.name, "error", err)
+		} else {
+			problems = append(problems, missingInCluster(job, inventory)...)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil, nil
+	}
+	if v.mode == ModeWarn {
+		return problems, nil
+	}
+	return nil, multierror.Append(nil, problems...)
+}
+
+func (v *ConstraintValidator) Name() string {
+	return v.name
+}
+
+func isEqualOperand(operand string) bool {
+	return operand == "" || operand == "=" || operand == "==" || operand == "is"
+}
+
+func isNotEqualOperand(operand string) bool {
+	return operand == "!=" || operand == "not"
+}
+
+// contradictions checks the effective constraints of every task, i.e. job, group and task level combined.
+func contradictions(job *api.Job) []error {
+	var problems []error
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			constraints := append(append(append([]*api.Constraint{}, job.Constraints...), tg.Constraints...), task.Constraints...)
+			equals := map[string]string{}
+			for _, c := range constraints {
+				if c == nil || !isEqualOperand(c.Operand) {
+					continue
+				}
+				if other, ok := equals[c.LTarget]; ok && other != c.RTarget {
+					problems = append(problems, fmt.Errorf("task %s/%s: %s can't be %q and %q at the same time", groupName(tg), task.Name, c.LTarget, other, c.RTarget))
+					continue
+				}
+				equals[c.LTarget] = c.RTarget
+			}
+			for _, c := range constraints {
+				if c == nil || !isNotEqualOperand(c.Operand) {
+					continue
+				}
+				if value, ok := equals[c.LTarget]; ok && value == c.RTarget {
+					problems = append(problems, fmt.Errorf("task %s/%s: %s must be and must not be %q", groupName(tg), task.Name, c.LTarget, c.RTarget))
+				}
+			}
+			if dc, ok := equals["${node.datacenter}"]; ok && len(job.Datacenters) > 0 && !matchesAny(job.Datacenters, dc) {
+				problems = append(problems, fmt.Errorf("task %s/%s: datacenter %q is not part of the job datacenters", groupName(tg), task.Name, dc))
+			}
+		}
+	}
+	return problems
+}
+
+func missingInCluster(job *api.Job, inventory *Inventory) []error {
+	var problems []error
+	for _, dc := range job.Datacenters {
+		found := false
+		for known := range inventory.Datacenters {
+			if matchesAny([]string{dc}, known) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Errorf("datacenter %q has no nodes", dc))
+		}
+	}
+	if job.NodePool != nil && *job.NodePool != "" && *job.NodePool != "all" && !inventory.NodePools[*job.NodePool] {
+		problems = append(problems, fmt.Errorf("node pool %q has no nodes", *job.NodePool))
+	}
+
+	classes := map[string]bool{}
+	collect := func(constraints []*api.Constraint) {
+		for _, c := range constraints {
+			if c != nil && c.LTarget == "${node.class}" && isEqualOperand(c.Operand) {
+				classes[c.RTarget] = true
+			}
+		}
+	}
+	collect(job.Constraints)
+	for _, tg := range job.TaskGroups {
+		collect(tg.Constraints)
+		for _, task := range tg.Tasks {
+			collect(task.Constraints)
+		}
+	}
+	sorted := make([]string, 0, len(classes))
+	for class := range classes {
+		sorted = append(sorted, class)
+	}
+	sort.Strings(sorted)
+	for _, class := range sorted {
+		if !inventory.NodeClasses[class] {
+			problems = append(problems, fmt.Errorf("node class %q has no nodes", class))
+		}
+	}
+	return problems
+}
+
+func groupName(tg *api.TaskGroup) string {
+	if tg.Name == nil {
+		return ""
+	}
+	return *tg.Name
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
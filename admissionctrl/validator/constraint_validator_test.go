@@ -0,0 +1,142 @@
+package validator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticInventory struct {
+	inventory *Inventory
+	err       error
+}
+
+func (s *staticInventory) Inventory() (*Inventory, error) {
+	return s.inventory, s.err
+}
+
+func constraintJob(datacenters []string, nodePool string, jobConstraints, taskConstraints []*api.Constraint) *api.Job {
+	id, group := "example", "web"
+	return &api.Job{
+		ID:          &id,
+		Datacenters: datacenters,
+		NodePool:    &nodePool,
+		Constraints: jobConstraints,
+		TaskGroups: []*api.TaskGroup{{
+			Name:  &group,
+			Tasks: []*api.Task{{Name: "app", Constraints: taskConstraints}},
+		}},
+	}
+}
+
+func TestConstraintValidator(t *testing.T) {
+	inventory := &staticInventory{inventory: &Inventory{
+		Datacenters: map[string]bool{"dc1": true, "dc2": true},
+		NodeClasses: map[string]bool{"gpu": true},
+		NodePools:   map[string]bool{"default": true},
+	}}
+
+	tt := []struct {
+		name      string
+		job       *api.Job
+		inventory InventorySource
+		want      []string
+	}{
+		{
+			name:      "satisfiable",
+			job:       constraintJob([]string{"dc*"}, "default", []*api.Constraint{api.NewConstraint("${node.class}", "=", "gpu")}, nil),
+			inventory: inventory,
+		},
+		{
+			name: "contradicting equals across levels",
+			job: constraintJob([]string{"dc1"}, "", []*api.Constraint{api.NewConstraint("${attr.kernel.name}", "=", "linux")},
+				[]*api.Constraint{api.NewConstraint("${attr.kernel.name}", "", "windows")}),
+			want: []string{`task web/app: ${attr.kernel.name} can't be "linux" and "windows" at the same time`},
+		},
+		{
+			name: "equal and not equal",
+			job: constraintJob([]string{"dc1"}, "", []*api.Constraint{api.NewConstraint("${meta.rack}", "=", "r1")},
+				[]*api.Constraint{api.NewConstraint("${meta.rack}", "!=", "r1")}),
+			want: []string{`task web/app: ${meta.rack} must be and must not be "r1"`},
+		},
+		{
+			name: "datacenter constraint outside job datacenters",
+			job:  constraintJob([]string{"dc1"}, "", []*api.Constraint{api.NewConstraint("${node.datacenter}", "=", "dc2")}, nil),
+			want: []string{`task web/app: datacenter "dc2" is not part of the job datacenters`},
+		},
+		{
+			name:      "missing in cluster",
+			job:       constraintJob([]string{"dc3"}, "frozen", nil, []*api.Constraint{api.NewConstraint("${node.class}", "=", "tpu")}),
+			inventory: inventory,
+			want:      []string{`datacenter "dc3" has no nodes`, `node pool "frozen" has no nodes`, `node class "tpu" has no nodes`},
+		},
+		{
+			name:      "inventory unavailable",
+			job:       constraintJob([]string{"dc3"}, "", nil, nil),
+			inventory: &staticInventory{err: assert.AnError},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, mode := range []string{ModeWarn, ModeReject} {
+				validator, err := NewConstraintValidator(hclog.NewNullLogger(), "constraints", mode, tc.inventory)
+				require.NoError(t, err)
+				warnings, err := validator.Validate(&types.Payload{Job: tc.job})
+
+				var got []string
+				if mode == ModeWarn {
+					require.NoError(t, err)
+					for _, w := range warnings {
+						got = append(got, w.Error())
+					}
+				} else if err != nil {
+					for _, e := range err.(interface{ WrappedErrors() []error }).WrappedErrors() {
+						got = append(got, e.Error())
+					}
+				}
+				assert.Equal(t, tc.want, got, mode)
+			}
+		})
+	}
+}
+
+func TestNewConstraintValidatorFailsOnUnknownMode(t *testing.T) {
+	_, err := NewConstraintValidator(hclog.NewNullLogger(), "constraints", "ignore", nil)
+	assert.ErrorContains(t, err, "unknown mode")
+}
+
+func TestNomadInventory(t *testing.T) {
+	calls := 0
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "/v1/nodes", r.URL.Path)
+		json.NewEncoder(w).Encode([]*api.NodeListStub{
+			{Datacenter: "dc1", NodeClass: "gpu", NodePool: "default"},
+			{Datacenter: "dc2", NodePool: "batch"},
+		})
+	}))
+	defer nomad.Close()
+	client, err := api.NewClient(&api.Config{Address: nomad.URL})
+	require.NoError(t, err)
+
+	inventory := NewNomadInventory(client, time.Minute)
+	got, err := inventory.Inventory()
+	require.NoError(t, err)
+	assert.Equal(t, &Inventory{
+		Datacenters: map[string]bool{"dc1": true, "dc2": true},
+		NodeClasses: map[string]bool{"gpu": true, "": true},
+		NodePools:   map[string]bool{"default": true, "batch": true},
+	}, got)
+
+	_, err = inventory.Inventory()
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "inventory is cached")
+}
@@ -0,0 +1,82 @@
+package validator
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+)
+
+// DeregisterPolicy decides which stops and purges of protected jobs are allowed.
+type DeregisterPolicy struct {
+	// AllowStop lets stops through, only purges are rejected
+	AllowStop bool
+	// OverridePolicies allow any stop or purge if the submitter's token holds one of them
+	OverridePolicies []string
+	// ApprovalHeader allows any stop or purge if the request carries the header, e.g. a change ticket
+	ApprovalHeader string
+}
+
+// DeregisterValidator protects selected jobs from being stopped or purged, it only checks deregistrations.
+type DeregisterValidator struct {
+	name     string
+	logger   hclog.Logger
+	selector *selector.Selector
+	policy   DeregisterPolicy
+}
+
+func NewDeregisterValidator(logger hclog.Logger, name string, selector *selector.Selector, policy DeregisterPolicy) *DeregisterValidator {
+	policy.ApprovalHeader = http.CanonicalHeaderKey(policy.ApprovalHeader)
+	return &DeregisterValidator{
+		name:     name,
+		logger:   logger,
+		selector: selector,
+		policy:   policy,
+	}
+}
+
+// Operations makes the validator an admissionctrl.OperationValidator of stops and purges.
+func (v *DeregisterValidator) Operations() []string {
+	return []string{config.OperationDeregister}
+}
+
+func (v *DeregisterValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	reqCtx := payload.Context
+	if reqCtx == nil || reqCtx.Operation != config.OperationDeregister || !v.selector.Matches(job) {
+		return nil, nil
+	}
+	var jobID string
+	if job.ID != nil {
+		jobID = *job.ID
+	}
+	action := "stopped"
+	if reqCtx.Purge {
+		action = "purged"
+	}
+	if !reqCtx.Purge && v.policy.AllowStop {
+		return nil, nil
+	}
+	for _, policy := range reqCtx.Policies {
+		if slices.Contains(v.policy.OverridePolicies, policy) {
+			v.logger.Info("protected job deregistered with override policy", "rule", v.name, "job", jobID, "purge", reqCtx.Purge, "policy", policy)
+			return nil, nil
+		}
+	}
+	if approval := reqCtx.Headers[v.policy.ApprovalHeader]; v.policy.ApprovalHeader != "" && approval != "" {
+		v.logger.Info("protected job deregistered with approval", "rule", v.name, "job", jobID, "purge", reqCtx.Purge, "approval", approval)
+		return []error{fmt.Errorf("job %s is protected, %s with approval %s", jobID, action, approval)}, nil
+	}
+	if reqCtx.Purge && v.policy.AllowStop {
+		return nil, fmt.Errorf("job %s in namespace %s is protected and must not be purged, stop it without purge", jobID, selector.Namespace(job))
+	}
+	return nil, fmt.Errorf("job %s in namespace %s is protected and must not be %s", jobID, selector.Namespace(job), action)
+}
+
+func (v *DeregisterValidator) Name() string {
+	return v.name
+}
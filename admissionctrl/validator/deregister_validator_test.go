@@ -0,0 +1,95 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeregisterValidator(t *testing.T) {
+	s, err := selector.New(&config.Selector{Namespaces: []string{"system"}})
+	require.NoError(t, err)
+
+	deregister := func(purge bool, policies []string, headers map[string]string) *config.RequestContext {
+		return &config.RequestContext{Operation: config.OperationDeregister, Purge: purge, Policies: policies, Headers: headers}
+	}
+	job := func(namespace string) *api.Job {
+		return &api.Job{ID: pointerOf("traefik"), Namespace: &namespace}
+	}
+
+	tt := []struct {
+		name         string
+		policy       DeregisterPolicy
+		job          *api.Job
+		context      *config.RequestContext
+		wantErr      string
+		wantWarnings int
+	}{
+		{
+			name:    "stop",
+			job:     job("system"),
+			context: deregister(false, nil, nil),
+			wantErr: "job traefik in namespace system is protected and must not be stopped",
+		},
+		{
+			name:    "purge",
+			job:     job("system"),
+			context: deregister(true, nil, nil),
+			wantErr: "job traefik in namespace system is protected and must not be purged",
+		},
+		{
+			name:    "allowed stop",
+			policy:  DeregisterPolicy{AllowStop: true},
+			job:     job("system"),
+			context: deregister(false, nil, nil),
+		},
+		{
+			name:    "purge with allowed stop",
+			policy:  DeregisterPolicy{AllowStop: true},
+			job:     job("system"),
+			context: deregister(true, nil, nil),
+			wantErr: "job traefik in namespace system is protected and must not be purged, stop it without purge",
+		},
+		{
+			name:    "override policy",
+			policy:  DeregisterPolicy{OverridePolicies: []string{"ops-admin"}},
+			job:     job("system"),
+			context: deregister(true, []string{"dev", "ops-admin"}, nil),
+		},
+		{
+			name:         "approval",
+			policy:       DeregisterPolicy{ApprovalHeader: "x-change-approval"},
+			job:          job("system"),
+			context:      deregister(true, nil, map[string]string{"X-Change-Approval": "CHG-42"}),
+			wantWarnings: 1,
+		},
+		{
+			name:    "other namespace",
+			job:     job("default"),
+			context: deregister(true, nil, nil),
+		},
+		{
+			name:    "register",
+			job:     job("system"),
+			context: &config.RequestContext{Operation: config.OperationRegister},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			validator := NewDeregisterValidator(hclog.NewNullLogger(), "critical", s, tc.policy)
+			warnings, err := validator.Validate(&types.Payload{Job: tc.job, Context: tc.context})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, warnings, tc.wantWarnings)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// DevicePolicy restricts device requests, zero values disable a check.
+type DevicePolicy struct {
+	// MaxGPUs is the total number of GPUs a job may request, including all instances of its groups
+	MaxGPUs int
+	// RequiredConstraints are device attributes every GPU request must constrain, e.g. ${device.attr.memory}
+	RequiredConstraints []string
+}
+
+// DeviceValidator limits the use of scarce accelerators per namespace.
+type DeviceValidator struct {
+	name       string
+	logger     hclog.Logger
+	defaults   DevicePolicy
+	namespaces map[string]DevicePolicy
+}
+
+// NewDeviceValidator creates the validator, namespaces with an own policy don't use the defaults.
+func NewDeviceValidator(logger hclog.Logger, name string, defaults DevicePolicy, namespaces map[string]DevicePolicy) *DeviceValidator {
+	return &DeviceValidator{
+		name:       name,
+		logger:     logger,
+		defaults:   defaults,
+		namespaces: namespaces,
+	}
+}
+
+func (v *DeviceValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	namespace := selector.Namespace(job)
+	policy, ok := v.namespaces[namespace]
+	if !ok {
+		policy = v.defaults
+	}
+
+	var errs error
+	gpus := 0
+	for _, tg := range job.TaskGroups {
+		instances := 1
+		if tg.Count != nil {
+			instances = *tg.Count
+		}
+		for _, task := range tg.Tasks {
+			if task.Resources == nil {
+				continue
+			}
+			for _, device := range task.Resources.Devices {
+				if device == nil || DeviceType(device.Name) != "gpu" {
+					continue
+				}
+				gpus += instances * int(deviceCount(device))
+				for _, attribute := range policy.RequiredConstraints {
+					if !constrains(device.Constraints, attribute) {
+						errs = multierror.Append(errs, fmt.Errorf("device %s of task %s/%s requires a constraint on %s", device.Name, groupName(tg), task.Name, attribute))
+					}
+				}
+			}
+		}
+	}
+	if policy.MaxGPUs > 0 && gpus > policy.MaxGPUs {
+		errs = multierror.Append(errs, fmt.Errorf("job requests %d GPUs, the limit in namespace %s is %d", gpus, namespace, policy.MaxGPUs))
+	}
+	return nil, errs
+}
+
+func (v *DeviceValidator) Name() string {
+	return v.name
+}
+
+// DeviceType returns the type of a device request name, e.g. gpu for nvidia/gpu/Tesla K80.
+func DeviceType(name string) string {
+	parts := strings.SplitN(name, "/", 3)
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return parts[1]
+}
+
+func deviceCount(device *api.RequestedDevice) uint64 {
+	if device.Count == nil {
+		return 1
+	}
+	return *device.Count
+}
+
+func constrains(constraints []*api.Constraint, attribute string) bool {
+	return slices.ContainsFunc(constraints, func(c *api.Constraint) bool {
+		return c != nil && c.LTarget == attribute
+	})
+}
@@ -0,0 +1,84 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func deviceJob(namespace string, count int, devices ...*api.RequestedDevice) *api.Job {
+	id, group := "example", "train"
+	return &api.Job{
+		ID:        &id,
+		Namespace: &namespace,
+		TaskGroups: []*api.TaskGroup{{
+			Name:  &group,
+			Count: &count,
+			Tasks: []*api.Task{{Name: "model", Resources: &api.Resources{Devices: devices}}},
+		}},
+	}
+}
+
+func TestDeviceValidator(t *testing.T) {
+	validator := NewDeviceValidator(hclog.NewNullLogger(), "devices",
+		DevicePolicy{MaxGPUs: 2, RequiredConstraints: []string{"${device.attr.memory}"}},
+		map[string]DevicePolicy{"ml": {MaxGPUs: 8}},
+	)
+	memory := []*api.Constraint{{LTarget: "${device.attr.memory}", Operand: ">=", RTarget: "16 GiB"}}
+
+	tt := []struct {
+		name string
+		job  *api.Job
+		want []string
+	}{
+		{
+			name: "within limits",
+			job:  deviceJob("default", 2, &api.RequestedDevice{Name: "nvidia/gpu", Constraints: memory}),
+		},
+		{
+			name: "other devices are ignored",
+			job:  deviceJob("default", 1, &api.RequestedDevice{Name: "intel/fpga", Count: pointerOf(uint64(4))}),
+		},
+		{
+			name: "too many gpus and missing constraint",
+			job:  deviceJob("default", 3, &api.RequestedDevice{Name: "gpu"}),
+			want: []string{
+				"device gpu of task train/model requires a constraint on ${device.attr.memory}",
+				"job requests 3 GPUs, the limit in namespace default is 2",
+			},
+		},
+		{
+			name: "namespace policy replaces the defaults",
+			job:  deviceJob("ml", 2, &api.RequestedDevice{Name: "nvidia/gpu/Tesla K80", Count: pointerOf(uint64(4))}),
+		},
+		{
+			name: "namespace limit",
+			job:  deviceJob("ml", 3, &api.RequestedDevice{Name: "nvidia/gpu", Count: pointerOf(uint64(4))}),
+			want: []string{"job requests 12 GPUs, the limit in namespace ml is 8"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.Validate(&types.Payload{Job: tc.job})
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDeviceType(t *testing.T) {
+	assert.Equal(t, "gpu", DeviceType("gpu"))
+	assert.Equal(t, "gpu", DeviceType("nvidia/gpu"))
+	assert.Equal(t, "gpu", DeviceType("nvidia/gpu/Tesla K80"))
+}
@@ -0,0 +1,121 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+)
+
+// DisruptionOperations are the disruptions of running jobs the disruption validator can restrict.
+var DisruptionOperations = []string{config.OperationAllocRestart, config.OperationAllocStop, config.OperationEvaluate, config.OperationPeriodicForce}
+
+// DisruptionPolicy restricts restarts, allocation stops and forced evaluations of running jobs.
+type DisruptionPolicy struct {
+	// Operations are the restricted disruptions, all DisruptionOperations if empty
+	Operations []string
+	// OverridePolicies exempt tokens holding one of them from the restrictions
+	OverridePolicies []string
+	// Forbid rejects the disruptions
+	Forbid bool
+	// MaxDisruptions per token and window, unlimited if 0
+	MaxDisruptions int
+	Window         time.Duration
+}
+
+// DisruptionValidator restricts disruptive actions on selected jobs, e.g. to keep tenant tokens from restarting
+// allocations in a loop. Disruptions are counted per token accessor, or per client IP for requests without token.
+// The counts are kept in memory, so every replica enforces the limit on its own.
+type DisruptionValidator struct {
+	name     string
+	logger   hclog.Logger
+	selector *selector.Selector
+	policy   DisruptionPolicy
+	now      func() time.Time
+
+	mu          sync.Mutex
+	disruptions map[string][]time.Time
+}
+
+func NewDisruptionValidator(logger hclog.Logger, name string, selector *selector.Selector, policy DisruptionPolicy) (*DisruptionValidator, error) {
+	if len(policy.Operations) == 0 {
+		policy.Operations = DisruptionOperations
+	}
+	for _, operation := range policy.Operations {
+		if !slices.Contains(DisruptionOperations, operation) {
+			return nil, fmt.Errorf("unknown disruption %q", operation)
+		}
+	}
+	if policy.MaxDisruptions < 0 {
+		return nil, fmt.Errorf("max_disruptions must not be negative")
+	}
+	if policy.MaxDisruptions > 0 && policy.Window <= 0 {
+		return nil, fmt.Errorf("max_disruptions requires a positive window")
+	}
+	return &DisruptionValidator{
+		name:        name,
+		logger:      logger,
+		selector:    selector,
+		policy:      policy,
+		now:         time.Now,
+		disruptions: make(map[string][]time.Time),
+	}, nil
+}
+
+// Operations makes the validator an admissionctrl.OperationValidator of the restricted disruptions.
+func (v *DisruptionValidator) Operations() []string {
+	return v.policy.Operations
+}
+
+func (v *DisruptionValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	reqCtx := payload.Context
+	if reqCtx == nil || !slices.Contains(v.policy.Operations, reqCtx.Operation) || !v.selector.Matches(job) {
+		return nil, nil
+	}
+	for _, policy := range reqCtx.Policies {
+		if slices.Contains(v.policy.OverridePolicies, policy) {
+			return nil, nil
+		}
+	}
+	var jobID string
+	if job.ID != nil {
+		jobID = *job.ID
+	}
+	if v.policy.Forbid {
+		return nil, fmt.Errorf("%s of job %s in namespace %s is not allowed", reqCtx.Operation, jobID, selector.Namespace(job))
+	}
+	if v.policy.MaxDisruptions == 0 {
+		return nil, nil
+	}
+
+	key := reqCtx.AccessorID
+	if key == "" {
+		key = reqCtx.ClientIP
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	active := v.disruptions[key][:0]
+	for _, at := range v.disruptions[key] {
+		if now.Sub(at) < v.policy.Window {
+			active = append(active, at)
+		}
+	}
+	if len(active) >= v.policy.MaxDisruptions {
+		v.disruptions[key] = active
+		v.logger.Warn("disruption limit exceeded", "rule", v.name, "key", key, "operation", reqCtx.Operation, "job", jobID)
+		return nil, fmt.Errorf("disruption limit %s exceeded for %s: %d of %d disruptions within %s", v.name, key, len(active), v.policy.MaxDisruptions, v.policy.Window)
+	}
+	v.disruptions[key] = append(active, now)
+	return nil, nil
+}
+
+func (v *DisruptionValidator) Name() string {
+	return v.name
+}
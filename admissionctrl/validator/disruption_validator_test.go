@@ -0,0 +1,89 @@
+package validator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func disruptionPayload(namespace, operation, accessorID string, policies ...string) *types.Payload {
+	return &types.Payload{
+		Job:     &api.Job{ID: pointerOf("web"), Namespace: &namespace},
+		Context: &config.RequestContext{Operation: operation, AccessorID: accessorID, ClientIP: "10.0.0.1", Policies: policies},
+	}
+}
+
+func TestDisruptionValidator_Forbid(t *testing.T) {
+	s, err := selector.New(&config.Selector{Namespaces: []string{"prod"}})
+	require.NoError(t, err)
+	validator, err := NewDisruptionValidator(hclog.NewNullLogger(), "restarts", s, DisruptionPolicy{
+		Operations:       []string{config.OperationAllocRestart, config.OperationAllocStop},
+		OverridePolicies: []string{"ops-admin"},
+		Forbid:           true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{config.OperationAllocRestart, config.OperationAllocStop}, validator.Operations())
+
+	tt := []struct {
+		name    string
+		payload *types.Payload
+		wantErr string
+	}{
+		{name: "restart", payload: disruptionPayload("prod", config.OperationAllocRestart, "tenant"), wantErr: "alloc_restart of job web in namespace prod is not allowed"},
+		{name: "override policy", payload: disruptionPayload("prod", config.OperationAllocStop, "ops", "ops-admin")},
+		{name: "other namespace", payload: disruptionPayload("dev", config.OperationAllocRestart, "tenant")},
+		{name: "other operation", payload: disruptionPayload("prod", config.OperationEvaluate, "tenant")},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.Validate(tc.payload)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDisruptionValidator_RateLimit(t *testing.T) {
+	s, err := selector.New(nil)
+	require.NoError(t, err)
+	validator, err := NewDisruptionValidator(hclog.NewNullLogger(), "restarts", s, DisruptionPolicy{MaxDisruptions: 2, Window: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, DisruptionOperations, validator.Operations())
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	validator.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		_, err := validator.Validate(disruptionPayload("prod", config.OperationAllocRestart, "tenant"))
+		require.NoError(t, err)
+	}
+	_, err = validator.Validate(disruptionPayload("prod", config.OperationEvaluate, "tenant"))
+	assert.EqualError(t, err, "disruption limit restarts exceeded for tenant: 2 of 2 disruptions within 1h0m0s")
+
+	_, err = validator.Validate(disruptionPayload("prod", config.OperationAllocRestart, "other"))
+	assert.NoError(t, err, "every token has its own limit")
+	_, err = validator.Validate(disruptionPayload("prod", config.OperationAllocRestart, ""))
+	assert.NoError(t, err, "requests without token are counted per client IP")
+
+	now = now.Add(time.Hour)
+	_, err = validator.Validate(disruptionPayload("prod", config.OperationAllocRestart, "tenant"))
+	assert.NoError(t, err, "the window has passed")
+}
+
+func TestNewDisruptionValidator(t *testing.T) {
+	s, err := selector.New(nil)
+	require.NoError(t, err)
+	_, err = NewDisruptionValidator(hclog.NewNullLogger(), "restarts", s, DisruptionPolicy{Operations: []string{"scale"}})
+	assert.EqualError(t, err, "unknown disruption \"scale\"")
+	_, err = NewDisruptionValidator(hclog.NewNullLogger(), "restarts", s, DisruptionPolicy{MaxDisruptions: 5})
+	assert.EqualError(t, err, "max_disruptions requires a positive window")
+}
@@ -0,0 +1,108 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// IdentityPolicy describes the rules for workload identities, zero values disable a check.
+type IdentityPolicy struct {
+	// AllowedAudiences restricts the aud claims of named identities
+	AllowedAudiences []string
+	// MaxTTL is the upper bound of the ttl of named identities, identities without ttl are rejected
+	MaxTTL time.Duration
+	// ForbidEnv rejects identities exposed as environment variable
+	ForbidEnv bool
+}
+
+// IdentityValidator enforces a consistent workload identity configuration on tasks and services.
+// The default identity of a task is only checked for env exposure, its audience and ttl are set by Nomad.
+type IdentityValidator struct {
+	name     string
+	logger   hclog.Logger
+	selector *selector.Selector
+	policy   IdentityPolicy
+}
+
+func NewIdentityValidator(logger hclog.Logger, name string, selector *selector.Selector, policy IdentityPolicy) *IdentityValidator {
+	return &IdentityValidator{
+		name:     name,
+		logger:   logger,
+		selector: selector,
+		policy:   policy,
+	}
+}
+
+func (v *IdentityValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	if !v.selector.Matches(job) {
+		return nil, nil
+	}
+
+	var errs error
+	check := func(location string, identity *api.WorkloadIdentity) {
+		if identity == nil {
+			return
+		}
+		for _, err := range v.check(identity) {
+			errs = multierror.Append(errs, fmt.Errorf("identity %s of %s: %w", identityName(identity), location, err))
+		}
+	}
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			location := fmt.Sprintf("task %s/%s", groupName(tg), task.Name)
+			check(location, task.Identity)
+			for _, identity := range task.Identities {
+				check(location, identity)
+			}
+		}
+	}
+	for _, s := range services(job) {
+		check(s.String(), s.service.Identity)
+	}
+	return nil, errs
+}
+
+func (v *IdentityValidator) check(identity *api.WorkloadIdentity) []error {
+	var problems []error
+	if v.policy.ForbidEnv && identity.Env {
+		problems = append(problems, fmt.Errorf("must not be exposed as environment variable"))
+	}
+	if identityName(identity) == "default" {
+		return problems
+	}
+	if v.policy.AllowedAudiences != nil {
+		for _, audience := range identity.Audience {
+			if !slices.Contains(v.policy.AllowedAudiences, audience) {
+				problems = append(problems, fmt.Errorf("audience %s is not allowed", audience))
+			}
+		}
+	}
+	if v.policy.MaxTTL > 0 {
+		switch {
+		case identity.TTL == 0:
+			problems = append(problems, fmt.Errorf("ttl is required"))
+		case identity.TTL > v.policy.MaxTTL:
+			problems = append(problems, fmt.Errorf("ttl %s exceeds %s", identity.TTL, v.policy.MaxTTL))
+		}
+	}
+	return problems
+}
+
+func (v *IdentityValidator) Name() string {
+	return v.name
+}
+
+func identityName(identity *api.WorkloadIdentity) string {
+	if identity.Name == "" {
+		return "default"
+	}
+	return identity.Name
+}
@@ -0,0 +1,83 @@
+package validator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityValidator(t *testing.T) {
+	all, err := selector.New(nil)
+	require.NoError(t, err)
+	validator := NewIdentityValidator(hclog.NewNullLogger(), "identity", all, IdentityPolicy{
+		AllowedAudiences: []string{"vault.io", "consul.io"},
+		MaxTTL:           time.Hour,
+		ForbidEnv:        true,
+	})
+
+	job := func(task *api.Task, services ...*api.Service) *api.Job {
+		group := "web"
+		task.Name = "app"
+		return &api.Job{TaskGroups: []*api.TaskGroup{{Name: &group, Tasks: []*api.Task{task}, Services: services}}}
+	}
+
+	tt := []struct {
+		name string
+		job  *api.Job
+		want []string
+	}{
+		{
+			name: "compliant",
+			job: job(&api.Task{
+				Identity:   &api.WorkloadIdentity{File: true},
+				Identities: []*api.WorkloadIdentity{{Name: "vault_default", Audience: []string{"vault.io"}, TTL: time.Hour, File: true}},
+			}),
+		},
+		{
+			name: "default identity in env",
+			job:  job(&api.Task{Identity: &api.WorkloadIdentity{Env: true}}),
+			want: []string{"identity default of task web/app: must not be exposed as environment variable"},
+		},
+		{
+			name: "named identity",
+			job: job(&api.Task{Identities: []*api.WorkloadIdentity{
+				{Name: "aws", Audience: []string{"sts.amazonaws.com"}, TTL: 24 * time.Hour},
+				{Name: "vault_default", Audience: []string{"vault.io"}},
+			}}),
+			want: []string{
+				"identity aws of task web/app: audience sts.amazonaws.com is not allowed",
+				"identity aws of task web/app: ttl 24h0m0s exceeds 1h0m0s",
+				"identity vault_default of task web/app: ttl is required",
+			},
+		},
+		{
+			name: "service identity",
+			job: job(&api.Task{}, &api.Service{
+				Name:     "api",
+				Identity: &api.WorkloadIdentity{Name: "consul-service_api", Audience: []string{"consul.io"}, TTL: 2 * time.Hour},
+			}),
+			want: []string{"identity consul-service_api of service api in web: ttl 2h0m0s exceeds 1h0m0s"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.Validate(&types.Payload{Job: tc.job})
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
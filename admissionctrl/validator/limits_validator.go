@@ -0,0 +1,75 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// JobLimits are the upper bounds of a job spec, zero values are not checked.
+type JobLimits struct {
+	MaxTaskGroups int
+	MaxTasks      int
+	MaxServices   int
+	// MaxBytes is the size of the JSON encoded job
+	MaxBytes int
+}
+
+// LimitsValidator protects the schedulers from pathological job specs.
+type LimitsValidator struct {
+	name       string
+	logger     hclog.Logger
+	defaults   JobLimits
+	namespaces map[string]JobLimits
+}
+
+// NewLimitsValidator creates the validator, namespaces with own limits don't use the defaults.
+func NewLimitsValidator(logger hclog.Logger, name string, defaults JobLimits, namespaces map[string]JobLimits) *LimitsValidator {
+	return &LimitsValidator{
+		name:       name,
+		logger:     logger,
+		defaults:   defaults,
+		namespaces: namespaces,
+	}
+}
+
+func (v *LimitsValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	namespace := selector.Namespace(job)
+	limits, ok := v.namespaces[namespace]
+	if !ok {
+		limits = v.defaults
+	}
+
+	tasks := 0
+	for _, tg := range job.TaskGroups {
+		tasks += len(tg.Tasks)
+	}
+
+	var errs error
+	check := func(what string, count, limit int) {
+		if limit > 0 && count > limit {
+			errs = multierror.Append(errs, fmt.Errorf("job has %d %s, the limit in namespace %s is %d", count, what, namespace, limit))
+		}
+	}
+	check("task groups", len(job.TaskGroups), limits.MaxTaskGroups)
+	check("tasks", tasks, limits.MaxTasks)
+	check("services", len(services(job)), limits.MaxServices)
+
+	if limits.MaxBytes > 0 {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode job: %w", err)
+		}
+		check("bytes", len(data), limits.MaxBytes)
+	}
+	return nil, errs
+}
+
+func (v *LimitsValidator) Name() string {
+	return v.name
+}
@@ -0,0 +1,81 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func limitsJob(namespace string, groups, tasksPerGroup int) *api.Job {
+	id := "example"
+	job := &api.Job{ID: &id, Namespace: &namespace}
+	for g := 0; g < groups; g++ {
+		tg := &api.TaskGroup{Services: []*api.Service{{Name: "web"}}}
+		for t := 0; t < tasksPerGroup; t++ {
+			tg.Tasks = append(tg.Tasks, &api.Task{Name: "task"})
+		}
+		job.TaskGroups = append(job.TaskGroups, tg)
+	}
+	return job
+}
+
+func TestLimitsValidator(t *testing.T) {
+	validator := NewLimitsValidator(hclog.NewNullLogger(), "limits",
+		JobLimits{MaxTaskGroups: 2, MaxTasks: 4, MaxServices: 2},
+		map[string]JobLimits{"batch": {MaxTaskGroups: 5}, "tiny": {MaxBytes: 100}},
+	)
+
+	tinyJob := limitsJob("tiny", 1, 1)
+	tinyJSON, err := json.Marshal(tinyJob)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name string
+		job  *api.Job
+		want []string
+	}{
+		{
+			name: "within limits",
+			job:  limitsJob("default", 2, 2),
+		},
+		{
+			name: "too many groups, tasks and services",
+			job:  limitsJob("default", 3, 2),
+			want: []string{
+				"job has 3 task groups, the limit in namespace default is 2",
+				"job has 6 tasks, the limit in namespace default is 4",
+				"job has 3 services, the limit in namespace default is 2",
+			},
+		},
+		{
+			name: "namespace limits replace the defaults",
+			job:  limitsJob("batch", 3, 0),
+		},
+		{
+			name: "spec too large",
+			job:  tinyJob,
+			want: []string{fmt.Sprintf("job has %d bytes, the limit in namespace tiny is 100", len(tinyJSON))},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.Validate(&types.Payload{Job: tc.job})
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
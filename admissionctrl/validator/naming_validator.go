@@ -0,0 +1,91 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NamingConventions are the patterns names must match, nil patterns are not checked.
+type NamingConventions struct {
+	ServiceName *regexp.Regexp
+	Tag         *regexp.Regexp
+	Hostname    *regexp.Regexp
+	// DNSCompatible requires service names and hostnames to be valid DNS labels
+	DNSCompatible bool
+}
+
+// NamingValidator enforces naming conventions on services, their tags and network hostnames.
+type NamingValidator struct {
+	name       string
+	logger     hclog.Logger
+	defaults   NamingConventions
+	namespaces map[string]NamingConventions
+}
+
+// NewNamingValidator creates the validator, namespaces with own conventions don't use the defaults.
+func NewNamingValidator(logger hclog.Logger, name string, defaults NamingConventions, namespaces map[string]NamingConventions) *NamingValidator {
+	return &NamingValidator{
+		name:       name,
+		logger:     logger,
+		defaults:   defaults,
+		namespaces: namespaces,
+	}
+}
+
+func (v *NamingValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	namespace := selector.Namespace(job)
+	conventions, ok := v.namespaces[namespace]
+	if !ok {
+		conventions = v.defaults
+	}
+
+	var errs error
+	for _, s := range services(job) {
+		if conventions.DNSCompatible && !dnsLabel.MatchString(s.service.Name) && !isInterpolated(s.service.Name) {
+			errs = multierror.Append(errs, fmt.Errorf("%s is not a valid DNS label", s))
+		}
+		if conventions.ServiceName != nil && !conventions.ServiceName.MatchString(s.service.Name) {
+			errs = multierror.Append(errs, fmt.Errorf("%s does not match %s", s, conventions.ServiceName))
+		}
+		if conventions.Tag != nil {
+			for _, tag := range append(append([]string{}, s.service.Tags...), s.service.CanaryTags...) {
+				if !conventions.Tag.MatchString(tag) {
+					errs = multierror.Append(errs, fmt.Errorf("tag %q of %s does not match %s", tag, s, conventions.Tag))
+				}
+			}
+		}
+	}
+	for _, tg := range job.TaskGroups {
+		for _, network := range tg.Networks {
+			if network == nil || network.Hostname == "" {
+				continue
+			}
+			if conventions.DNSCompatible && !dnsLabel.MatchString(network.Hostname) && !isInterpolated(network.Hostname) {
+				errs = multierror.Append(errs, fmt.Errorf("hostname %s in %s is not a valid DNS label", network.Hostname, groupName(tg)))
+			}
+			if conventions.Hostname != nil && !conventions.Hostname.MatchString(network.Hostname) {
+				errs = multierror.Append(errs, fmt.Errorf("hostname %s in %s does not match %s", network.Hostname, groupName(tg), conventions.Hostname))
+			}
+		}
+	}
+	return nil, errs
+}
+
+func (v *NamingValidator) Name() string {
+	return v.name
+}
+
+var interpolation = regexp.MustCompile(`\$\{[^}]+\}`)
+
+// isInterpolated reports whether the value uses runtime variables like ${NOMAD_ALLOC_INDEX}.
+func isInterpolated(value string) bool {
+	return interpolation.MatchString(value)
+}
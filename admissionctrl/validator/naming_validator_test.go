@@ -0,0 +1,80 @@
+package validator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamingValidator(t *testing.T) {
+	validator := NewNamingValidator(hclog.NewNullLogger(), "naming",
+		NamingConventions{
+			Tag:           regexp.MustCompile(`^[a-z0-9=._-]+$`),
+			DNSCompatible: true,
+		},
+		map[string]NamingConventions{
+			"prod": {
+				ServiceName: regexp.MustCompile(`^prod-`),
+				Hostname:    regexp.MustCompile(`^prod-`),
+			},
+		},
+	)
+
+	job := func(namespace string, hostname string, services ...*api.Service) *api.Job {
+		job := serviceJob(services, nil)
+		job.Namespace = &namespace
+		job.TaskGroups[0].Networks = []*api.NetworkResource{{Hostname: hostname}}
+		return job
+	}
+
+	tt := []struct {
+		name string
+		job  *api.Job
+		want []string
+	}{
+		{
+			name: "compliant",
+			job:  job("default", "web-${NOMAD_ALLOC_INDEX}", &api.Service{Name: "web", Tags: []string{"traefik.enable=true"}}),
+		},
+		{
+			name: "interpolated service name",
+			job:  job("default", "", &api.Service{Name: "${NOMAD_JOB_NAME}-web"}),
+		},
+		{
+			name: "defaults",
+			job:  job("default", "Web_1", &api.Service{Name: "Web_UI", Tags: []string{"Traefik Enable"}}),
+			want: []string{
+				"service Web_UI in web is not a valid DNS label",
+				`tag "Traefik Enable" of service Web_UI in web does not match ^[a-z0-9=._-]+$`,
+				"hostname Web_1 in web is not a valid DNS label",
+			},
+		},
+		{
+			name: "namespace conventions replace the defaults",
+			job:  job("prod", "web", &api.Service{Name: "web", Tags: []string{"Any Tag"}}),
+			want: []string{
+				"service web in web does not match ^prod-",
+				"hostname web in web does not match ^prod-",
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.Validate(&types.Payload{Job: tc.job})
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package validator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Inventory describes the nodes of the cluster.
+type Inventory struct {
+	Datacenters map[string]bool
+	NodeClasses map[string]bool
+	NodePools   map[string]bool
+}
+
+// InventorySource returns the current inventory of the cluster.
+type InventorySource interface {
+	Inventory() (*Inventory, error)
+}
+
+// NomadInventory builds the inventory from the node list of the Nomad API and caches it.
+type NomadInventory struct {
+	client *api.Client
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	inventory *Inventory
+	expires   time.Time
+}
+
+func NewNomadInventory(client *api.Client, ttl time.Duration) *NomadInventory {
+	return &NomadInventory{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (n *NomadInventory) Inventory() (*Inventory, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.inventory != nil && time.Now().Before(n.expires) {
+		return n.inventory, nil
+	}
+	nodes, _, err := n.client.Nodes().List(nil)
+	if err != nil {
+		return nil, err
+	}
+	inventory := &Inventory{
+		Datacenters: make(map[string]bool),
+		NodeClasses: make(map[string]bool),
+		NodePools:   make(map[string]bool),
+	}
+	for _, node := range nodes {
+		inventory.Datacenters[node.Datacenter] = true
+		inventory.NodeClasses[node.NodeClass] = true
+		inventory.NodePools[node.NodePool] = true
+	}
+	n.inventory = inventory
+	n.expires = time.Now().Add(n.ttl)
+	return inventory, nil
+}
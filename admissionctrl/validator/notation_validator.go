@@ -5,6 +5,7 @@ import (
 	"github.com/mxab/nacp/admissionctrl/types"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
 	"github.com/mxab/nacp/admissionctrl/notation"
 )
 
@@ -12,10 +13,37 @@ type NotationValidator struct {
 	logger   hclog.Logger
 	name     string
 	verifier notation.ImageVerifier
+	// parallelism bounds the concurrent verifications, notation.DefaultParallelism if not positive
+	parallelism int
 }
 
 func (v *NotationValidator) Validate(payload *types.Payload) ([]error, error) {
-	for _, tg := range payload.Job.TaskGroups {
+	return v.ValidateContext(context.Background(), payload)
+}
+
+// ValidateContext verifies the images of all tasks together, each distinct image once,
+// cancelling the context aborts the registry calls.
+func (v *NotationValidator) ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error) {
+	images := dockerImages(payload.Job)
+	if len(images) == 0 {
+		return nil, nil
+	}
+	errs := notation.VerifyImages(ctx, v.verifier, images, v.parallelism)
+
+	var warnings []error
+	for _, image := range images {
+		if err, ok := errs[image]; ok {
+			warnings = append(warnings, err)
+		}
+	}
+	return warnings, nil
+}
+
+// dockerImages returns the images of the docker tasks in the order of the tasks, each image once.
+func dockerImages(job *api.Job) []string {
+	var images []string
+	seen := map[string]bool{}
+	for _, tg := range job.TaskGroups {
 		for _, task := range tg.Tasks {
 			// check if the task driver is docker
 			// should we consider podman?
@@ -24,27 +52,25 @@ func (v *NotationValidator) Validate(payload *types.Payload) ([]error, error) {
 			}
 
 			image, ok := task.Config["image"].(string)
-			if !ok {
+			if !ok || seen[image] {
 				continue
 			}
-			err := v.verifier.VerifyImage(context.Background(), image)
-			if err != nil {
-				return []error{err}, nil
-			}
+			seen[image] = true
+			images = append(images, image)
 		}
 	}
-
-	return nil, nil
+	return images
 }
 
 func (v *NotationValidator) Name() string {
 	return v.name
 }
 
-func NewNotationValidator(logger hclog.Logger, name string, verifier notation.ImageVerifier) *NotationValidator {
+func NewNotationValidator(logger hclog.Logger, name string, verifier notation.ImageVerifier, parallelism int) *NotationValidator {
 	return &NotationValidator{
-		logger:   logger,
-		name:     name,
-		verifier: verifier,
+		logger:      logger,
+		name:        name,
+		verifier:    verifier,
+		parallelism: parallelism,
 	}
 }
@@ -3,7 +3,10 @@ package validator
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/mxab/nacp/admissionctrl/types"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
@@ -141,8 +144,9 @@ func TestNotationValidatorValidate(t *testing.T) {
 func TestNewNotationValidator(t *testing.T) {
 	mockImageVerifier := new(DummyVerifier)
 
-	notationValidator := NewNotationValidator(hclog.NewNullLogger(), "notation", mockImageVerifier)
+	notationValidator := NewNotationValidator(hclog.NewNullLogger(), "notation", mockImageVerifier, 2)
 	require.Equal(t, mockImageVerifier, notationValidator.verifier)
+	require.Equal(t, 2, notationValidator.parallelism)
 	require.Equal(t, "notation", notationValidator.name)
 	require.NotNil(t, notationValidator.logger)
 }
@@ -156,3 +160,41 @@ func TestNotationValidatorName(t *testing.T) {
 	}
 	require.Equal(t, "notation", notationValidator.Name())
 }
+
+// countingVerifier counts the verifications per image.
+type countingVerifier struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (v *countingVerifier) VerifyImage(ctx context.Context, imageReference string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.calls[imageReference]++
+	if strings.HasPrefix(imageReference, "invalid") {
+		return fmt.Errorf("%s is not signed", imageReference)
+	}
+	return nil
+}
+
+func TestNotationValidatorVerifiesImagesOnce(t *testing.T) {
+	verifier := &countingVerifier{calls: map[string]int{}}
+	notationValidator := NewNotationValidator(hclog.NewNullLogger(), "notation", verifier, 2)
+
+	task := func(image string) *api.Task {
+		return &api.Task{Driver: "docker", Config: map[string]interface{}{"image": image}}
+	}
+	payload := &types.Payload{Job: &api.Job{TaskGroups: []*api.TaskGroup{
+		{Tasks: []*api.Task{task("app:1"), task("invalid-sidecar:1")}},
+		{Tasks: []*api.Task{task("app:1"), task("invalid-proxy:1")}},
+		{Tasks: []*api.Task{task("app:1")}},
+	}}}
+
+	warnings, err := notationValidator.Validate(payload)
+	require.NoError(t, err)
+	require.Equal(t, []error{
+		fmt.Errorf("invalid-sidecar:1 is not signed"),
+		fmt.Errorf("invalid-proxy:1 is not signed"),
+	}, warnings, "all failing images are reported in the order of the tasks")
+	require.Equal(t, map[string]int{"app:1": 1, "invalid-sidecar:1": 1, "invalid-proxy:1": 1}, verifier.calls)
+}
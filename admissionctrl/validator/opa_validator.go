@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/errcode"
 	"github.com/mxab/nacp/admissionctrl/notation"
 	"github.com/mxab/nacp/admissionctrl/opa"
 	"github.com/mxab/nacp/admissionctrl/types"
@@ -17,38 +18,45 @@ type OpaValidator struct {
 }
 
 func (v *OpaValidator) Validate(payload *types.Payload) ([]error, error) {
+	return v.ValidateContext(context.Background(), payload)
+}
 
-	ctx := context.TODO()
+// ValidateContext evaluates the policy, cancelling the context aborts the evaluation.
+func (v *OpaValidator) ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error) {
 	//iterate over rulesets and evaluate
 	allErrs := &multierror.Error{}
 	allWarnings := make([]error, 0)
 
-	v.logger.Debug("Validating job", "job", payload.Job.ID)
+	v.logger.Debug("Validating job", "job", jobIDOf(payload))
 
 	// evaluate the query
 	results, err := v.query.Query(ctx, payload)
 
 	if err != nil {
-		return nil, err
+		return nil, errcode.Failed(v.Name(), err)
 	}
 
 	// aggregate warnings
 	warnings := results.GetWarnings()
 
 	if len(warnings) > 0 {
-		v.logger.Debug("Got warnings from rule", "rule", v.Name(), "warnings", warnings, "job", payload.Job.ID)
+		v.logger.Debug("Got warnings from rule", "rule", v.Name(), "warnings", warnings, "job", jobIDOf(payload))
 		for _, warn := range warnings {
-			allWarnings = append(allWarnings, fmt.Errorf("%s (%s)", warn, v.Name()))
+			allWarnings = append(allWarnings, opaFinding(warn, types.SeverityWarning, v.Name()))
 		}
 	}
 
+	for _, info := range results.GetInfos() {
+		allWarnings = append(allWarnings, opaFinding(info, types.SeverityInfo, v.Name()))
+	}
+
 	errors := results.GetErrors()
 
 	if len(errors) > 0 { // no errors is ok
-		v.logger.Debug("Got errors from rule", "rule", v.Name(), "errors", errors, "job", payload.Job.ID)
+		v.logger.Debug("Got errors from rule", "rule", v.Name(), "errors", errors, "job", jobIDOf(payload))
 		errsForRule := &multierror.Error{}
 		for _, err := range errors {
-			errsForRule = multierror.Append(errsForRule, fmt.Errorf("%s (%s)", err, v.Name()))
+			errsForRule = multierror.Append(errsForRule, opaFinding(err, types.SeverityError, v.Name()))
 		}
 		allErrs = multierror.Append(allErrs, errsForRule)
 	}
@@ -59,17 +67,51 @@ func (v *OpaValidator) Validate(payload *types.Payload) ([]error, error) {
 	return allWarnings, nil
 }
 
+// jobIDOf is the ID of the job to log, read rules are evaluated without job.
+func jobIDOf(payload *types.Payload) string {
+	if payload.Job == nil || payload.Job.ID == nil {
+		return ""
+	}
+	return *payload.Job.ID
+}
+
+// opaFinding converts an entry of the errors, warnings or infos of a policy. Objects with a message become
+// a types.Result, e.g. {"message": "missing owner", "field": "Meta.owner", "code": "owner", "docs_url": "https://..."}.
+func opaFinding(entry interface{}, severity types.Severity, rule string) error {
+	if object, ok := entry.(map[string]interface{}); ok {
+		if message, ok := object["message"].(string); ok {
+			result := &types.Result{Severity: severity, Message: fmt.Sprintf("%s (%s)", message, rule)}
+			result.Field, _ = object["field"].(string)
+			result.Code, _ = object["code"].(string)
+			result.DocsURL, _ = object["docs_url"].(string)
+			return result
+		}
+	}
+	err := fmt.Errorf("%s (%s)", entry, rule)
+	if severity == types.SeverityInfo {
+		return types.WithSeverity(err, severity)
+	}
+	return err
+}
+
 // Name
 func (v *OpaValidator) Name() string {
 	return v.name
 }
 
-func NewOpaValidator(name, filename, query string, logger hclog.Logger, imageVerifier notation.ImageVerifier) (*OpaValidator, error) {
+// Trace evaluates the policy for the payload with a full evaluation trace.
+func (v *OpaValidator) Trace(payload *types.Payload) *types.Trace {
+	trace := v.query.Trace(context.TODO(), payload)
+	trace.Rule = v.name
+	return trace
+}
+
+func NewOpaValidator(name, filename, query string, logger hclog.Logger, imageVerifier notation.ImageVerifier, opts ...opa.Option) (*OpaValidator, error) {
 
 	ctx := context.TODO()
 
 	// read the policy file
-	preparedEvalQuery, err := opa.CreateQuery(filename, query, ctx, imageVerifier)
+	preparedEvalQuery, err := opa.CreateQuery(filename, query, ctx, imageVerifier, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,7 @@ package validator
 import (
 	"github.com/mxab/nacp/admissionctrl/types"
 	"github.com/mxab/nacp/config"
+	"net/http"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
@@ -165,6 +166,48 @@ func TestOpaValidatorContext(t *testing.T) {
 			wantErr:      false,
 			wantWarnings: 1,
 		},
+		{
+			name:  "reject job with forbidden policy from the resolved token",
+			query: `errors = data.context.errors`,
+			payload: &types.Payload{
+				Job: &api.Job{},
+				Context: &config.RequestContext{
+					Policies: []string{"nomad_reject_flat"},
+				},
+			},
+			wantErr:      true,
+			wantWarnings: 0,
+		},
+		{
+			name:  "reject register with curl",
+			query: `errors = data.context.errors`,
+			payload: &types.Payload{
+				Job: &api.Job{},
+				Context: &config.RequestContext{
+					Operation: config.OperationRegister,
+					Method:    http.MethodPut,
+					Path:      "/v1/jobs",
+					Headers:   map[string]string{"User-Agent": "curl/8.5.0"},
+				},
+			},
+			wantErr:      true,
+			wantWarnings: 0,
+		},
+		{
+			name:  "allow plan with curl",
+			query: `errors = data.context.errors`,
+			payload: &types.Payload{
+				Job: &api.Job{},
+				Context: &config.RequestContext{
+					Operation: config.OperationPlan,
+					Method:    http.MethodPut,
+					Path:      "/v1/job/example/plan",
+					Headers:   map[string]string{"User-Agent": "curl/8.5.0"},
+				},
+			},
+			wantErr:      false,
+			wantWarnings: 0,
+		},
 		{
 			name:  "allow job with normal policies",
 			query: `errors = data.context.errors`,
@@ -198,3 +241,56 @@ func TestOpaValidatorContext(t *testing.T) {
 		})
 	}
 }
+
+func TestOpaValidatorInfos(t *testing.T) {
+	validator, err := NewOpaValidator("infos", testutil.Filepath(t, "opa/validators/infos.rego"),
+		"infos = data.infos.infos\nwarnings = data.infos.warnings", hclog.NewNullLogger(), nil)
+	require.NoError(t, err)
+
+	priority := 90
+	warnings, err := validator.Validate(&types.Payload{Job: &api.Job{Priority: &priority}})
+	require.NoError(t, err)
+	require.Len(t, warnings, 2)
+	assert.EqualError(t, warnings[0], "priority is high (infos)")
+	assert.Equal(t, types.SeverityWarning, types.SeverityOf(warnings[0]))
+	assert.EqualError(t, warnings[1], "priorities above 50 are reserved for platform jobs (infos)")
+	assert.Equal(t, types.SeverityInfo, types.SeverityOf(warnings[1]))
+}
+
+func TestOpaValidatorResults(t *testing.T) {
+	validator, err := NewOpaValidator("results", testutil.Filepath(t, "opa/validators/results.rego"),
+		"errors = data.results.errors\nwarnings = data.results.warnings", hclog.NewNullLogger(), nil)
+	require.NoError(t, err)
+
+	priority := 90
+	count := 1
+	warnings, err := validator.Validate(&types.Payload{Job: &api.Job{Priority: &priority, TaskGroups: []*api.TaskGroup{{Count: &count}}}})
+	require.Len(t, warnings, 1)
+	assert.Equal(t, &types.Result{Severity: types.SeverityWarning, Message: "priority is high (results)"}, types.ResultOf(warnings[0]))
+
+	require.Error(t, err)
+	var result *types.Result
+	require.ErrorAs(t, err, &result)
+	assert.Equal(t, &types.Result{
+		Severity: types.SeverityError,
+		Message:  "count must be at least 2 (results)",
+		Field:    "TaskGroups[0].Count",
+		Code:     "min_count",
+		DocsURL:  "https://example.com/count",
+	}, result)
+}
+
+func TestOpaValidatorWithoutJob(t *testing.T) {
+	validator, err := NewOpaValidator("reads", testutil.Filepath(t, "opa/validators/reads.rego"),
+		"errors = data.reads.errors", hclog.NewNullLogger(), nil)
+	require.NoError(t, err)
+
+	_, err = validator.Validate(&types.Payload{Context: &config.RequestContext{Operation: config.OperationRead, Namespace: "default"}})
+	assert.NoError(t, err)
+
+	_, err = validator.Validate(&types.Payload{Context: &config.RequestContext{Operation: config.OperationRead, Namespace: "payments"}})
+	assert.ErrorContains(t, err, "reading namespace payments requires the ops policy (reads)")
+
+	_, err = validator.Validate(&types.Payload{Context: &config.RequestContext{Operation: config.OperationRead, Namespace: "payments", Policies: []string{"ops"}}})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,112 @@
+package validator
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+const defaultOwnerMeta = "team"
+
+// OwnershipValidator rejects jobs whose declared owner doesn't match the ownership registry.
+// The registry is a data source mapping <namespace>/<job> glob patterns to teams, a pattern without
+// namespace matches all namespaces. The team is a string or an object with a team field.
+type OwnershipValidator struct {
+	name              string
+	logger            hclog.Logger
+	source            string
+	ownerMeta         string
+	requireRegistered bool
+}
+
+func NewOwnershipValidator(logger hclog.Logger, name string, source string, ownerMeta string, requireRegistered bool) *OwnershipValidator {
+	if ownerMeta == "" {
+		ownerMeta = defaultOwnerMeta
+	}
+	return &OwnershipValidator{
+		name:              name,
+		logger:            logger,
+		source:            source,
+		ownerMeta:         ownerMeta,
+		requireRegistered: requireRegistered,
+	}
+}
+
+func (v *OwnershipValidator) Validate(payload *types.Payload) ([]error, error) {
+	registry, ok := payload.Data[v.source].(map[string]interface{})
+	if !ok {
+		// fail closed, a missing registry must not let jobs pass
+		return nil, fmt.Errorf("ownership registry %s is not available", v.source)
+	}
+	job := payload.Job
+	namespace := selector.Namespace(job)
+	var id string
+	if job.ID != nil {
+		id = *job.ID
+	}
+	declared := job.Meta[v.ownerMeta]
+	owner, pattern, registered := lookupOwner(registry, namespace, id)
+	switch {
+	case !registered && v.requireRegistered:
+		return nil, fmt.Errorf("job %s in namespace %s is not registered in the ownership registry", id, namespace)
+	case !registered:
+		return nil, nil
+	case declared == "":
+		return nil, fmt.Errorf("job %s has no meta %s, it is owned by %s", id, v.ownerMeta, owner)
+	case declared != owner:
+		v.logger.Debug("owner mismatch", "job", id, "namespace", namespace, "declared", declared, "owner", owner, "entry", pattern)
+		return nil, fmt.Errorf("job %s in namespace %s is owned by %s, not %s", id, namespace, owner, declared)
+	}
+	return nil, nil
+}
+
+func (v *OwnershipValidator) Name() string {
+	return v.name
+}
+
+// lookupOwner returns the team of the most specific entry matching the job, an exact entry wins over
+// patterns and longer patterns win over shorter ones.
+func lookupOwner(registry map[string]interface{}, namespace, id string) (string, string, bool) {
+	var matches []string
+	for entry := range registry {
+		entryNamespace, entryJob, found := strings.Cut(entry, "/")
+		if !found {
+			entryNamespace, entryJob = "*", entry
+		}
+		if globMatch(entryNamespace, namespace) && globMatch(entryJob, id) {
+			matches = append(matches, entry)
+		}
+	}
+	if len(matches) == 0 {
+		return "", "", false
+	}
+	exact := namespace + "/" + id
+	sort.Slice(matches, func(i, j int) bool {
+		if (matches[i] == exact) != (matches[j] == exact) {
+			return matches[i] == exact
+		}
+		if len(matches[i]) != len(matches[j]) {
+			return len(matches[i]) > len(matches[j])
+		}
+		return matches[i] < matches[j]
+	})
+	entry := matches[0]
+	switch owner := registry[entry].(type) {
+	case string:
+		return owner, entry, true
+	case map[string]interface{}:
+		team, _ := owner["team"].(string)
+		return team, entry, true
+	}
+	return "", entry, true
+}
+
+func globMatch(pattern, s string) bool {
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
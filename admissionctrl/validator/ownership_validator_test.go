@@ -0,0 +1,81 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnershipValidator(t *testing.T) {
+	registry := map[string]interface{}{
+		"payments/billing":   "payments",
+		"payments/billing-*": "payments-batch",
+		"*/infra-*":          map[string]interface{}{"team": "platform", "slack": "#platform"},
+		"monitoring":         "observability",
+		"payments/*":         "payments",
+	}
+	data := map[string]interface{}{"owners": registry}
+
+	tt := []struct {
+		name              string
+		namespace         string
+		id                string
+		meta              map[string]string
+		requireRegistered bool
+		data              map[string]interface{}
+		wantErr           string
+	}{
+		{name: "exact entry", namespace: "payments", id: "billing", meta: map[string]string{"team": "payments"}},
+		{name: "longer pattern wins", namespace: "payments", id: "billing-nightly", meta: map[string]string{"team": "payments-batch"}},
+		{
+			name:      "owner mismatch",
+			namespace: "payments",
+			id:        "billing-nightly",
+			meta:      map[string]string{"team": "payments"},
+			wantErr:   "job billing-nightly in namespace payments is owned by payments-batch, not payments",
+		},
+		{name: "object entry", namespace: "ops", id: "infra-dns", meta: map[string]string{"team": "platform"}},
+		{name: "entry without namespace", namespace: "default", id: "monitoring", meta: map[string]string{"team": "observability"}},
+		{name: "missing owner", namespace: "payments", id: "api", wantErr: "job api has no meta team, it is owned by payments"},
+		{name: "unregistered job", namespace: "search", id: "indexer", meta: map[string]string{"team": "search"}},
+		{
+			name:              "unregistered job is rejected",
+			namespace:         "search",
+			id:                "indexer",
+			requireRegistered: true,
+			wantErr:           "job indexer in namespace search is not registered in the ownership registry",
+		},
+		{name: "registry not loaded", namespace: "payments", id: "billing", data: map[string]interface{}{}, wantErr: "ownership registry owners is not available"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewOwnershipValidator(hclog.NewNullLogger(), "ownership", "owners", "", tc.requireRegistered)
+			payloadData := data
+			if tc.data != nil {
+				payloadData = tc.data
+			}
+			job := &api.Job{ID: &tc.id, Namespace: &tc.namespace, Meta: tc.meta}
+			warnings, err := v.Validate(&types.Payload{Job: job, Data: payloadData})
+			assert.Empty(t, warnings)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestOwnershipValidatorOwnerMeta(t *testing.T) {
+	v := NewOwnershipValidator(hclog.NewNullLogger(), "ownership", "owners", "owner", false)
+	id := "billing"
+	data := map[string]interface{}{"owners": map[string]interface{}{"billing": "payments"}}
+
+	_, err := v.Validate(&types.Payload{Job: &api.Job{ID: &id, Meta: map[string]string{"owner": "payments"}}, Data: data})
+	assert.NoError(t, err)
+	_, err = v.Validate(&types.Payload{Job: &api.Job{ID: &id, Meta: map[string]string{"team": "payments"}}, Data: data})
+	assert.EqualError(t, err, "job billing has no meta owner, it is owned by payments")
+}
@@ -0,0 +1,110 @@
+package validator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/cronexpr"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// cronSamples is the number of upcoming runs used to find the shortest interval of a schedule.
+const cronSamples = 100
+
+// PeriodicPolicy describes the rules for periodic stanzas, zero values disable a check.
+type PeriodicPolicy struct {
+	// MinInterval is the shortest allowed time between two runs
+	MinInterval            time.Duration
+	RequireTimeZone        bool
+	RequireProhibitOverlap bool
+}
+
+// PeriodicValidator checks the periodic stanza of selected jobs to prevent accidental cron storms.
+type PeriodicValidator struct {
+	name     string
+	logger   hclog.Logger
+	selector *selector.Selector
+	policy   PeriodicPolicy
+	clock    func() time.Time
+}
+
+func NewPeriodicValidator(logger hclog.Logger, name string, selector *selector.Selector, policy PeriodicPolicy) *PeriodicValidator {
+	return &PeriodicValidator{
+		name:     name,
+		logger:   logger,
+		selector: selector,
+		policy:   policy,
+		clock:    time.Now,
+	}
+}
+
+func (v *PeriodicValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	periodic := job.Periodic
+	if periodic == nil || (periodic.Enabled != nil && !*periodic.Enabled) || !v.selector.Matches(job) {
+		return nil, nil
+	}
+
+	var errs error
+	location := time.UTC
+	timeZone := ""
+	if periodic.TimeZone != nil {
+		timeZone = *periodic.TimeZone
+	}
+	if timeZone == "" {
+		if v.policy.RequireTimeZone {
+			errs = multierror.Append(errs, fmt.Errorf("periodic time_zone is required"))
+		}
+	} else {
+		loc, err := time.LoadLocation(timeZone)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid periodic time_zone %s: %w", timeZone, err))
+		} else {
+			location = loc
+		}
+	}
+	if v.policy.RequireProhibitOverlap && (periodic.ProhibitOverlap == nil || !*periodic.ProhibitOverlap) {
+		errs = multierror.Append(errs, fmt.Errorf("periodic prohibit_overlap must be enabled"))
+	}
+
+	if periodic.SpecType != nil && *periodic.SpecType != "" && *periodic.SpecType != "cron" {
+		return nil, errs
+	}
+	specs := periodic.Specs
+	if periodic.Spec != nil && *periodic.Spec != "" {
+		specs = append([]string{*periodic.Spec}, specs...)
+	}
+	for _, spec := range specs {
+		expr, err := cronexpr.Parse(spec)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid cron %q: %w", spec, err))
+			continue
+		}
+		if v.policy.MinInterval <= 0 {
+			continue
+		}
+		if interval := shortestInterval(expr, v.clock().In(location)); interval > 0 && interval < v.policy.MinInterval {
+			errs = multierror.Append(errs, fmt.Errorf("cron %q runs every %s, the minimum interval is %s", spec, interval, v.policy.MinInterval))
+		}
+	}
+	return nil, errs
+}
+
+func (v *PeriodicValidator) Name() string {
+	return v.name
+}
+
+// shortestInterval returns the shortest time between the upcoming runs, 0 if the schedule runs at most once.
+func shortestInterval(expr *cronexpr.Expression, from time.Time) time.Duration {
+	runs := expr.NextN(from, cronSamples)
+	var shortest time.Duration
+	for i := 1; i < len(runs); i++ {
+		if interval := runs[i].Sub(runs[i-1]); shortest == 0 || interval < shortest {
+			shortest = interval
+		}
+	}
+	return shortest
+}
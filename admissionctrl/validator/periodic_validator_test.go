@@ -0,0 +1,93 @@
+package validator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodicValidator(t *testing.T) {
+	all, err := selector.New(nil)
+	require.NoError(t, err)
+	validator := NewPeriodicValidator(hclog.NewNullLogger(), "periodic", all, PeriodicPolicy{
+		MinInterval:            15 * time.Minute,
+		RequireTimeZone:        true,
+		RequireProhibitOverlap: true,
+	})
+	validator.clock = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	tt := []struct {
+		name     string
+		periodic *api.PeriodicConfig
+		want     []string
+	}{
+		{
+			name: "not periodic",
+		},
+		{
+			name: "compliant",
+			periodic: &api.PeriodicConfig{
+				Spec:            pointerOf("0 */2 * * *"),
+				TimeZone:        pointerOf("Europe/Berlin"),
+				ProhibitOverlap: pointerOf(true),
+			},
+		},
+		{
+			name: "too frequent and missing settings",
+			periodic: &api.PeriodicConfig{
+				Specs: []string{"0 3 * * *", "*/5 * * * *"},
+			},
+			want: []string{
+				"periodic time_zone is required",
+				"periodic prohibit_overlap must be enabled",
+				`cron "*/5 * * * *" runs every 5m0s, the minimum interval is 15m0s`,
+			},
+		},
+		{
+			name: "irregular schedule",
+			periodic: &api.PeriodicConfig{
+				Spec:            pointerOf("0,10 * * * *"),
+				TimeZone:        pointerOf("UTC"),
+				ProhibitOverlap: pointerOf(true),
+			},
+			want: []string{`cron "0,10 * * * *" runs every 10m0s, the minimum interval is 15m0s`},
+		},
+		{
+			name: "invalid cron and time zone",
+			periodic: &api.PeriodicConfig{
+				Spec:            pointerOf("every minute"),
+				TimeZone:        pointerOf("Mars/Olympus"),
+				ProhibitOverlap: pointerOf(true),
+			},
+			want: []string{
+				"invalid periodic time_zone Mars/Olympus: unknown time zone Mars/Olympus",
+				`invalid cron "every minute": missing field(s)`,
+			},
+		},
+		{
+			name:     "disabled",
+			periodic: &api.PeriodicConfig{Enabled: pointerOf(false), Spec: pointerOf("* * * * *")},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.Validate(&types.Payload{Job: &api.Job{Periodic: tc.periodic}})
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
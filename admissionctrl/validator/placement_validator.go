@@ -0,0 +1,87 @@
+package validator
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// defaultNodePool is the node pool of jobs without one.
+const defaultNodePool = "default"
+
+// PlacementPolicy restricts where the jobs of a namespace may run, nil lists don't restrict.
+type PlacementPolicy struct {
+	// AllowedDatacenters are glob patterns of datacenters
+	AllowedDatacenters []string
+	// AllowedNodePools are glob patterns of node pools
+	AllowedNodePools []string
+}
+
+// PlacementValidator rejects jobs targeting datacenters or node pools that are not allowed for their namespace.
+type PlacementValidator struct {
+	name       string
+	logger     hclog.Logger
+	defaults   PlacementPolicy
+	namespaces map[string]PlacementPolicy
+}
+
+// NewPlacementValidator creates the validator, namespaces with an own policy don't use the defaults.
+func NewPlacementValidator(logger hclog.Logger, name string, defaults PlacementPolicy, namespaces map[string]PlacementPolicy) (*PlacementValidator, error) {
+	for _, policy := range append([]PlacementPolicy{defaults}, slices.Collect(maps.Values(namespaces))...) {
+		for _, pattern := range append(slices.Clone(policy.AllowedDatacenters), policy.AllowedNodePools...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid placement pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return &PlacementValidator{
+		name:       name,
+		logger:     logger,
+		defaults:   defaults,
+		namespaces: namespaces,
+	}, nil
+}
+
+func (v *PlacementValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	namespace := selector.Namespace(job)
+	policy, ok := v.namespaces[namespace]
+	if !ok {
+		policy = v.defaults
+	}
+
+	var errs error
+	if policy.AllowedDatacenters != nil {
+		// Nomad places jobs without datacenters in any datacenter
+		datacenters := job.Datacenters
+		if len(datacenters) == 0 {
+			datacenters = []string{"*"}
+		}
+		for _, datacenter := range datacenters {
+			if !matchesAny(policy.AllowedDatacenters, datacenter) {
+				errs = multierror.Append(errs, fmt.Errorf("datacenter %s is not allowed in namespace %s, allowed are %s", datacenter, namespace, strings.Join(policy.AllowedDatacenters, ", ")))
+			}
+		}
+	}
+	if policy.AllowedNodePools != nil {
+		nodePool := defaultNodePool
+		if job.NodePool != nil && *job.NodePool != "" {
+			nodePool = *job.NodePool
+		}
+		if !matchesAny(policy.AllowedNodePools, nodePool) {
+			errs = multierror.Append(errs, fmt.Errorf("node pool %s is not allowed in namespace %s, allowed are %s", nodePool, namespace, strings.Join(policy.AllowedNodePools, ", ")))
+		}
+	}
+	return nil, errs
+}
+
+func (v *PlacementValidator) Name() string {
+	return v.name
+}
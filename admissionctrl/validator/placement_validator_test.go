@@ -0,0 +1,93 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func placementJob(namespace string, nodePool string, datacenters ...string) *api.Job {
+	return &api.Job{
+		ID:          pointerOf("example"),
+		Namespace:   &namespace,
+		NodePool:    &nodePool,
+		Datacenters: datacenters,
+	}
+}
+
+func TestPlacementValidator(t *testing.T) {
+	validator, err := NewPlacementValidator(hclog.NewNullLogger(), "placement",
+		PlacementPolicy{AllowedDatacenters: []string{"eu-*"}, AllowedNodePools: []string{"default", "shared"}},
+		map[string]PlacementPolicy{
+			"gpu":   {AllowedNodePools: []string{"gpu"}},
+			"infra": {},
+		},
+	)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name string
+		job  *api.Job
+		want []string
+	}{
+		{
+			name: "allowed",
+			job:  placementJob("default", "shared", "eu-1", "eu-2"),
+		},
+		{
+			name: "default node pool",
+			job:  placementJob("default", "", "eu-1"),
+		},
+		{
+			name: "not allowed datacenter and node pool",
+			job:  placementJob("team-a", "gpu", "eu-1", "us-1"),
+			want: []string{
+				"datacenter us-1 is not allowed in namespace team-a, allowed are eu-*",
+				"node pool gpu is not allowed in namespace team-a, allowed are default, shared",
+			},
+		},
+		{
+			name: "any datacenter",
+			job:  placementJob("default", "default"),
+			want: []string{"datacenter * is not allowed in namespace default, allowed are eu-*"},
+		},
+		{
+			name: "namespace policy",
+			job:  placementJob("gpu", "gpu", "us-1"),
+		},
+		{
+			name: "namespace policy replaces defaults",
+			job:  placementJob("gpu", "shared", "eu-1"),
+			want: []string{"node pool shared is not allowed in namespace gpu, allowed are gpu"},
+		},
+		{
+			name: "unrestricted namespace",
+			job:  placementJob("infra", "infra", "us-1"),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := validator.Validate(&types.Payload{Job: tc.job})
+			assert.Empty(t, warnings)
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNewPlacementValidatorFailsOnInvalidPattern(t *testing.T) {
+	_, err := NewPlacementValidator(hclog.NewNullLogger(), "placement", PlacementPolicy{AllowedNodePools: []string{"gpu-["}}, nil)
+	assert.ErrorContains(t, err, "invalid placement pattern \"gpu-[\"")
+}
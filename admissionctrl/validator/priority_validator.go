@@ -0,0 +1,37 @@
+package validator
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl/priority"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// PriorityValidator rejects jobs with a priority outside the allowed band of the namespace or submitter.
+type PriorityValidator struct {
+	name   string
+	logger hclog.Logger
+	policy *priority.Policy
+}
+
+func NewPriorityValidator(logger hclog.Logger, name string, policy *priority.Policy) *PriorityValidator {
+	return &PriorityValidator{
+		name:   name,
+		logger: logger,
+		policy: policy,
+	}
+}
+
+func (v *PriorityValidator) Validate(payload *types.Payload) ([]error, error) {
+	band := v.policy.Band(payload)
+	p := priority.Of(payload.Job)
+	if !band.Contains(p) {
+		return nil, fmt.Errorf("priority %d is outside the allowed range %s", p, band)
+	}
+	return nil, nil
+}
+
+func (v *PriorityValidator) Name() string {
+	return v.name
+}
@@ -0,0 +1,41 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/priority"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityValidator(t *testing.T) {
+	validator := NewPriorityValidator(hclog.NewNullLogger(), "priority", &priority.Policy{
+		Default:    priority.Band{Min: 1, Max: 60},
+		Namespaces: map[string]priority.Band{"batch": {Min: 10, Max: 30}},
+	})
+
+	tt := []struct {
+		name      string
+		namespace string
+		priority  *int
+		wantErr   string
+	}{
+		{name: "default priority", namespace: "default"},
+		{name: "too high", namespace: "default", priority: pointerOf(100), wantErr: "priority 100 is outside the allowed range 1-60"},
+		{name: "default priority outside namespace band", namespace: "batch", wantErr: "priority 50 is outside the allowed range 10-30"},
+		{name: "within namespace band", namespace: "batch", priority: pointerOf(20)},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			job := &api.Job{Namespace: &tc.namespace, Priority: tc.priority}
+			_, err := validator.Validate(&types.Payload{Job: job})
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
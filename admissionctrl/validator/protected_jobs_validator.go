@@ -0,0 +1,58 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// ProtectedJobsValidator rejects submissions of selected jobs, e.g. critical system jobs,
+// unless the job carries the override meta key or the submitter holds one of the override policies.
+type ProtectedJobsValidator struct {
+	name             string
+	logger           hclog.Logger
+	selector         *selector.Selector
+	overrideMetaKey  string
+	overridePolicies []string
+}
+
+func NewProtectedJobsValidator(logger hclog.Logger, name string, selector *selector.Selector, overrideMetaKey string, overridePolicies []string) *ProtectedJobsValidator {
+	return &ProtectedJobsValidator{
+		name:             name,
+		logger:           logger,
+		selector:         selector,
+		overrideMetaKey:  overrideMetaKey,
+		overridePolicies: overridePolicies,
+	}
+}
+
+func (v *ProtectedJobsValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	if !v.selector.Matches(job) {
+		return nil, nil
+	}
+	var jobID string
+	if job.ID != nil {
+		jobID = *job.ID
+	}
+	if v.overrideMetaKey != "" && job.Meta[v.overrideMetaKey] != "" {
+		v.logger.Info("protected job changed with override meta key", "rule", v.name, "job", jobID)
+		return []error{fmt.Errorf("job %s is protected, changed via %s", jobID, v.overrideMetaKey)}, nil
+	}
+	if payload.Context != nil && payload.Context.TokenInfo != nil {
+		for _, policy := range payload.Context.TokenInfo.Policies {
+			if slices.Contains(v.overridePolicies, policy) {
+				v.logger.Info("protected job changed with override policy", "rule", v.name, "job", jobID, "policy", policy)
+				return nil, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("job %s in namespace %s is protected and must not be changed", jobID, selector.Namespace(job))
+}
+
+func (v *ProtectedJobsValidator) Name() string {
+	return v.name
+}
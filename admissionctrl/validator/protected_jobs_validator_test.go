@@ -0,0 +1,66 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtectedJobsValidator(t *testing.T) {
+	s, err := selector.New(&config.Selector{Namespaces: []string{"system"}, JobIDs: []string{"traefik*"}})
+	require.NoError(t, err)
+	validator := NewProtectedJobsValidator(hclog.NewNullLogger(), "system_jobs", s, "nacp.override", []string{"ops-admin"})
+
+	job := func(id string, meta map[string]string) *api.Job {
+		namespace := "system"
+		return &api.Job{ID: &id, Namespace: &namespace, Meta: meta}
+	}
+
+	tt := []struct {
+		name         string
+		payload      *types.Payload
+		wantErr      string
+		wantWarnings int
+	}{
+		{
+			name:    "protected job",
+			payload: &types.Payload{Job: job("traefik", nil)},
+			wantErr: "job traefik in namespace system is protected and must not be changed",
+		},
+		{
+			name:    "token without override policy",
+			payload: &types.Payload{Job: job("traefik", nil), Context: &config.RequestContext{TokenInfo: &api.ACLToken{Policies: []string{"dev"}}}},
+			wantErr: "is protected",
+		},
+		{
+			name:    "other job",
+			payload: &types.Payload{Job: job("web", nil)},
+		},
+		{
+			name:         "override meta key",
+			payload:      &types.Payload{Job: job("traefik", map[string]string{"nacp.override": "INC-42"})},
+			wantWarnings: 1,
+		},
+		{
+			name:    "override policy",
+			payload: &types.Payload{Job: job("traefik-internal", nil), Context: &config.RequestContext{TokenInfo: &api.ACLToken{Policies: []string{"dev", "ops-admin"}}}},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := validator.Validate(tc.payload)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, warnings, tc.wantWarnings)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+)
+
+const (
+	QuotaKeyNamespace = "namespace"
+	QuotaKeyToken     = "token"
+)
+
+// QuotaExceededError is returned when a registration would exceed a quota.
+type QuotaExceededError struct {
+	Quota  string
+	Key    string
+	Limit  string
+	Used   int
+	Max    int
+	Window time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota %s exceeded for %s: %d of %d %s within %s", e.Quota, e.Key, e.Used, e.Max, e.Limit, e.Window)
+}
+
+type registration struct {
+	at   time.Time
+	size int
+}
+
+// QuotaValidator limits the number and size of job registrations per namespace or token within a sliding window.
+// Validate only checks the quota, registrations are counted by RecordUsage once Nomad accepted them, so registrations
+// rejected by a later rule or by Nomad don't use up the quota. Registrations in flight are not counted yet, concurrent
+// ones may exceed the quota by their number. Plans and validations are checked but never counted.
+// The counts are kept in memory, so every replica enforces the quota on its own. Keys without registrations in the
+// window are dropped, so tokens used once don't pile up.
+type QuotaValidator struct {
+	name             string
+	logger           hclog.Logger
+	key              string
+	window           time.Duration
+	maxRegistrations int
+	maxBytes         int
+	namespaces       map[string]bool
+	now              func() time.Time
+
+	mu            sync.Mutex
+	registrations map[string][]registration
+	// swept is when the registrations of all keys were last pruned
+	swept time.Time
+}
+
+func NewQuotaValidator(logger hclog.Logger, name string, key string, window time.Duration, maxRegistrations int, maxBytes int, namespaces []string) (*QuotaValidator, error) {
+	if key != QuotaKeyNamespace && key != QuotaKeyToken {
+		return nil, fmt.Errorf("unknown quota key %q", key)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("quota window must be positive")
+	}
+	if maxRegistrations <= 0 && maxBytes <= 0 {
+		return nil, fmt.Errorf("quota requires max_registrations or max_bytes")
+	}
+	var namespaceSet map[string]bool
+	if len(namespaces) > 0 {
+		namespaceSet = make(map[string]bool, len(namespaces))
+		for _, ns := range namespaces {
+			namespaceSet[ns] = true
+		}
+	}
+	return &QuotaValidator{
+		name:             name,
+		logger:           logger,
+		key:              key,
+		window:           window,
+		maxRegistrations: maxRegistrations,
+		maxBytes:         maxBytes,
+		namespaces:       namespaceSet,
+		now:              time.Now,
+		registrations:    make(map[string][]registration),
+	}, nil
+}
+
+func (v *QuotaValidator) Validate(payload *types.Payload) ([]error, error) {
+	key, size, limited, err := v.usage(payload)
+	if err != nil || !limited {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sweep()
+	active, usedBytes := v.active(key)
+
+	if v.maxRegistrations > 0 && len(active)+1 > v.maxRegistrations {
+		v.logger.Warn("quota exceeded", "rule", v.name, "key", key, "registrations", len(active))
+		return nil, &QuotaExceededError{Quota: v.name, Key: key, Limit: "registrations", Used: len(active), Max: v.maxRegistrations, Window: v.window}
+	}
+	if v.maxBytes > 0 && usedBytes+size > v.maxBytes {
+		v.logger.Warn("quota exceeded", "rule", v.name, "key", key, "bytes", usedBytes+size)
+		return nil, &QuotaExceededError{Quota: v.name, Key: key, Limit: "bytes", Used: usedBytes + size, Max: v.maxBytes, Window: v.window}
+	}
+	return nil, nil
+}
+
+// RecordUsage counts a registration Nomad accepted.
+func (v *QuotaValidator) RecordUsage(payload *types.Payload) {
+	if payload.Context == nil || payload.Context.Operation != config.OperationRegister {
+		return
+	}
+	key, size, limited, err := v.usage(payload)
+	if err != nil || !limited {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sweep()
+	active, _ := v.active(key)
+	v.registrations[key] = append(active, registration{at: v.now(), size: size})
+}
+
+// usage returns the key and size of the registration, limited is false for namespaces the quota doesn't apply to.
+func (v *QuotaValidator) usage(payload *types.Payload) (key string, size int, limited bool, err error) {
+	namespace := selector.Namespace(payload.Job)
+	if v.namespaces != nil && !v.namespaces[namespace] {
+		return "", 0, false, nil
+	}
+
+	key = namespace
+	if v.key == QuotaKeyToken {
+		if payload.Context == nil || payload.Context.AccessorID == "" {
+			return "", 0, false, fmt.Errorf("quota %s requires a resolved token", v.name)
+		}
+		key = payload.Context.AccessorID
+	}
+
+	data, err := json.Marshal(payload.Job)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return key, len(data), true, nil
+}
+
+// sweep prunes the registrations of all keys once per window, v.mu must be held.
+func (v *QuotaValidator) sweep() {
+	now := v.now()
+	if now.Sub(v.swept) < v.window {
+		return
+	}
+	for key := range v.registrations {
+		v.active(key)
+	}
+	v.swept = now
+}
+
+// active drops the registrations of the key that left the window and returns the others with their size,
+// the key is dropped once it has none. v.mu must be held.
+func (v *QuotaValidator) active(key string) ([]registration, int) {
+	now := v.now()
+	active := v.registrations[key][:0]
+	usedBytes := 0
+	for _, r := range v.registrations[key] {
+		if now.Sub(r.at) < v.window {
+			active = append(active, r)
+			usedBytes += r.size
+		}
+	}
+	if len(active) == 0 {
+		delete(v.registrations, key)
+		return nil, 0
+	}
+	v.registrations[key] = active
+	return active, usedBytes
+}
+
+func (v *QuotaValidator) Name() string {
+	return v.name
+}
@@ -0,0 +1,118 @@
+package validator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func quotaPayload(namespace, operation, accessorID string) *types.Payload {
+	return &types.Payload{
+		Job:     &api.Job{ID: &namespace, Namespace: &namespace},
+		Context: &config.RequestContext{Operation: operation, AccessorID: accessorID},
+	}
+}
+
+func TestQuotaValidator(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	validator, err := NewQuotaValidator(hclog.NewNullLogger(), "prod_registrations", QuotaKeyNamespace, time.Hour, 2, 0, []string{"prod"})
+	require.NoError(t, err)
+	validator.now = func() time.Time { return now }
+
+	_, err = validator.Validate(quotaPayload("prod", config.OperationRegister, ""))
+	require.NoError(t, err)
+	_, err = validator.Validate(quotaPayload("prod", config.OperationRegister, ""))
+	require.NoError(t, err, "registrations are only counted once recorded")
+
+	for i := 0; i < 2; i++ {
+		validator.RecordUsage(quotaPayload("prod", config.OperationRegister, ""))
+	}
+	validator.RecordUsage(quotaPayload("prod", config.OperationPlan, ""))
+
+	_, err = validator.Validate(quotaPayload("prod", config.OperationPlan, ""))
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr, "plans are checked")
+	assert.Equal(t, &QuotaExceededError{Quota: "prod_registrations", Key: "prod", Limit: "registrations", Used: 2, Max: 2, Window: time.Hour}, quotaErr)
+	assert.EqualError(t, err, "quota prod_registrations exceeded for prod: 2 of 2 registrations within 1h0m0s")
+
+	_, err = validator.Validate(quotaPayload("dev", config.OperationRegister, ""))
+	assert.NoError(t, err, "other namespaces are not limited")
+
+	now = now.Add(time.Hour)
+	_, err = validator.Validate(quotaPayload("prod", config.OperationRegister, ""))
+	assert.NoError(t, err, "registrations leave the window")
+}
+
+func TestQuotaValidatorPerToken(t *testing.T) {
+	validator, err := NewQuotaValidator(hclog.NewNullLogger(), "per_token", QuotaKeyToken, time.Hour, 1, 0, nil)
+	require.NoError(t, err)
+
+	for _, accessorID := range []string{"a", "b"} {
+		payload := quotaPayload("prod", config.OperationRegister, accessorID)
+		_, err = validator.Validate(payload)
+		require.NoError(t, err)
+		validator.RecordUsage(payload)
+	}
+	_, err = validator.Validate(quotaPayload("dev", config.OperationRegister, "a"))
+	assert.ErrorContains(t, err, "exceeded for a")
+	_, err = validator.Validate(quotaPayload("dev", config.OperationRegister, ""))
+	assert.ErrorContains(t, err, "requires a resolved token")
+}
+
+func TestQuotaValidatorDropsExpiredKeys(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	validator, err := NewQuotaValidator(hclog.NewNullLogger(), "per_token", QuotaKeyToken, time.Hour, 1, 0, nil)
+	require.NoError(t, err)
+	validator.now = func() time.Time { return now }
+
+	for _, accessorID := range []string{"a", "b"} {
+		validator.RecordUsage(quotaPayload("prod", config.OperationRegister, accessorID))
+	}
+	assert.Len(t, validator.registrations, 2)
+
+	now = now.Add(time.Hour)
+	validator.RecordUsage(quotaPayload("prod", config.OperationRegister, "c"))
+	assert.Len(t, validator.registrations, 1, "tokens without registrations in the window are dropped")
+
+	now = now.Add(time.Hour)
+	_, err = validator.Validate(quotaPayload("prod", config.OperationPlan, "d"))
+	require.NoError(t, err)
+	assert.Empty(t, validator.registrations)
+}
+
+func TestQuotaValidatorMaxBytes(t *testing.T) {
+	payload := quotaPayload("prod", config.OperationRegister, "")
+	validator, err := NewQuotaValidator(hclog.NewNullLogger(), "size", QuotaKeyNamespace, time.Hour, 0, 1, nil)
+	require.NoError(t, err)
+
+	_, err = validator.Validate(payload)
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "bytes", quotaErr.Limit)
+}
+
+func TestNewQuotaValidatorFailsOnInvalidConfig(t *testing.T) {
+	tt := []struct {
+		name    string
+		key     string
+		window  time.Duration
+		max     int
+		wantErr string
+	}{
+		{name: "unknown key", key: "job", window: time.Hour, max: 1, wantErr: "unknown quota key"},
+		{name: "no window", key: QuotaKeyNamespace, max: 1, wantErr: "window must be positive"},
+		{name: "no limit", key: QuotaKeyNamespace, window: time.Hour, wantErr: "requires max_registrations or max_bytes"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewQuotaValidator(hclog.NewNullLogger(), "quota", tc.key, tc.window, tc.max, 0, nil)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package validator
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+const (
+	DefaultSecretMinEntropy = 4.5
+	DefaultSecretMinLength  = 20
+)
+
+// KnownSecretPatterns are the token formats detected by default.
+var KnownSecretPatterns = map[string]*regexp.Regexp{
+	"aws_access_key": regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	"github_token":   regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	"slack_token":    regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	"private_key":    regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	"jwt":            regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]+`),
+}
+
+var secretCandidate = regexp.MustCompile(`[A-Za-z0-9+/=_\-]+`)
+
+// SecretsPolicy configures the secret scanner.
+type SecretsPolicy struct {
+	// Patterns are added to the known secret patterns, a pattern with the same name replaces the known one
+	Patterns map[string]*regexp.Regexp
+	// MinEntropy is the Shannon entropy in bits per character above which a value is considered a secret, 0 disables the check
+	MinEntropy float64
+	// MinLength is the minimal length of a value for the entropy check
+	MinLength int
+	// AllowedKeys are glob patterns of env and meta keys that are not scanned
+	AllowedKeys []string
+}
+
+// SecretsValidator scans env vars, templates and meta for plaintext credentials.
+type SecretsValidator struct {
+	name     string
+	logger   hclog.Logger
+	mode     string
+	patterns map[string]*regexp.Regexp
+	names    []string
+	policy   SecretsPolicy
+}
+
+func NewSecretsValidator(logger hclog.Logger, name string, mode string, policy SecretsPolicy) (*SecretsValidator, error) {
+	if mode == "" {
+		mode = ModeReject
+	}
+	if mode != ModeWarn && mode != ModeReject {
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+	for _, pattern := range policy.AllowedKeys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+	}
+	if policy.MinLength <= 0 {
+		policy.MinLength = DefaultSecretMinLength
+	}
+
+	patterns := make(map[string]*regexp.Regexp, len(KnownSecretPatterns)+len(policy.Patterns))
+	for n, p := range KnownSecretPatterns {
+		patterns[n] = p
+	}
+	for n, p := range policy.Patterns {
+		patterns[n] = p
+	}
+	names := make([]string, 0, len(patterns))
+	for n := range patterns {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return &SecretsValidator{
+		name:     name,
+		logger:   logger,
+		mode:     mode,
+		patterns: patterns,
+		names:    names,
+		policy:   policy,
+	}, nil
+}
+
+func (v *SecretsValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	var problems []error
+
+	problems = append(problems, v.scanMap("job meta", job.Meta)...)
+	for _, tg := range job.TaskGroups {
+		group := groupName(tg)
+		problems = append(problems, v.scanMap(fmt.Sprintf("group %s meta", group), tg.Meta)...)
+		for _, task := range tg.Tasks {
+			location := fmt.Sprintf("task %s/%s", group, task.Name)
+			problems = append(problems, v.scanMap(location+" meta", task.Meta)...)
+			problems = append(problems, v.scanMap(location+" env", task.Env)...)
+			for i, tmpl := range task.Templates {
+				if tmpl == nil || tmpl.EmbeddedTmpl == nil {
+					continue
+				}
+				where := fmt.Sprintf("%s template %s", location, templateName(tmpl, i))
+				problems = append(problems, v.scan(where, *tmpl.EmbeddedTmpl)...)
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil, nil
+	}
+	v.logger.Info("plaintext secrets found", "job", job.ID, "findings", len(problems))
+	if v.mode == ModeWarn {
+		return problems, nil
+	}
+	return nil, multierror.Append(nil, problems...)
+}
+
+func (v *SecretsValidator) scanMap(location string, values map[string]string) []error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if !v.allowedKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var problems []error
+	for _, key := range keys {
+		problems = append(problems, v.scan(fmt.Sprintf("%s %s", location, key), values[key])...)
+	}
+	return problems
+}
+
+// scan reports each finding once per value, the secret itself is never part of the message.
+func (v *SecretsValidator) scan(location, value string) []error {
+	var problems []error
+	for _, name := range v.names {
+		if v.patterns[name].MatchString(value) {
+			problems = append(problems, fmt.Errorf("%s contains a plaintext secret (%s)", location, name))
+		}
+	}
+	if len(problems) > 0 || v.policy.MinEntropy <= 0 {
+		return problems
+	}
+	for _, candidate := range secretCandidate.FindAllString(value, -1) {
+		if len(candidate) >= v.policy.MinLength && entropy(candidate) >= v.policy.MinEntropy {
+			return []error{fmt.Errorf("%s contains a high entropy value that looks like a secret", location)}
+		}
+	}
+	return nil
+}
+
+func (v *SecretsValidator) allowedKey(key string) bool {
+	for _, pattern := range v.policy.AllowedKeys {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *SecretsValidator) Name() string {
+	return v.name
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	var result float64
+	length := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / length
+		result -= p * math.Log2(p)
+	}
+	return result
+}
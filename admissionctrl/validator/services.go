@@ -0,0 +1,37 @@
+package validator
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// jobService is a service stanza together with its location in the job, e.g. web or web/app.
+type jobService struct {
+	location string
+	service  *api.Service
+}
+
+func (s jobService) String() string {
+	return fmt.Sprintf("service %s in %s", s.service.Name, s.location)
+}
+
+// services returns the group and task level services of the job.
+func services(job *api.Job) []jobService {
+	var result []jobService
+	for _, tg := range job.TaskGroups {
+		for _, service := range tg.Services {
+			if service != nil {
+				result = append(result, jobService{location: groupName(tg), service: service})
+			}
+		}
+		for _, task := range tg.Tasks {
+			for _, service := range task.Services {
+				if service != nil {
+					result = append(result, jobService{location: groupName(tg) + "/" + task.Name, service: service})
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,209 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	From int
+	To   int
+}
+
+// ParsePortRange parses a single port like 8080 or a range like 20000-20100.
+func ParsePortRange(s string) (PortRange, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	start, err := strconv.Atoi(from)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	end := start
+	if isRange {
+		end, err = strconv.Atoi(to)
+		if err != nil || end < start {
+			return PortRange{}, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	return PortRange{From: start, To: end}, nil
+}
+
+func (r PortRange) Contains(port int) bool {
+	return port >= r.From && port <= r.To
+}
+
+// AllocatedPortsSource returns the running jobs per allocated host port.
+type AllocatedPortsSource interface {
+	AllocatedPorts() (map[int][]string, error)
+}
+
+// NomadAllocatedPorts reads the ports of all running allocations from the Nomad API and caches them.
+type NomadAllocatedPorts struct {
+	client *api.Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	ports   map[int][]string
+	expires time.Time
+}
+
+func NewNomadAllocatedPorts(client *api.Client, ttl time.Duration) *NomadAllocatedPorts {
+	return &NomadAllocatedPorts{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (n *NomadAllocatedPorts) AllocatedPorts() (map[int][]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ports != nil && time.Now().Before(n.expires) {
+		return n.ports, nil
+	}
+	allocs, _, err := n.client.Allocations().List(&api.QueryOptions{
+		Namespace: "*",
+		Params:    map[string]string{"resources": "true"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ports := make(map[int][]string)
+	for _, alloc := range allocs {
+		if alloc.ClientStatus != api.AllocClientStatusRunning && alloc.ClientStatus != api.AllocClientStatusPending {
+			continue
+		}
+		if alloc.AllocatedResources == nil {
+			continue
+		}
+		job := alloc.Namespace + "/" + alloc.JobID
+		for _, port := range alloc.AllocatedResources.Shared.Ports {
+			if !slices.Contains(ports[port.Value], job) {
+				ports[port.Value] = append(ports[port.Value], job)
+			}
+		}
+	}
+	n.ports = ports
+	n.expires = time.Now().Add(n.ttl)
+	return ports, nil
+}
+
+// StaticPortValidator restricts static ports to the allowed ranges of the namespace and
+// warns if a static port is already allocated by another job.
+type StaticPortValidator struct {
+	name            string
+	logger          hclog.Logger
+	defaultRanges   []PortRange
+	namespaceRanges map[string][]PortRange
+	allocated       AllocatedPortsSource
+}
+
+// NewStaticPortValidator creates the validator, without ranges for a namespace static ports are not restricted.
+// allocated may be nil to skip the collision check.
+func NewStaticPortValidator(logger hclog.Logger, name string, defaultRanges []PortRange, namespaceRanges map[string][]PortRange, allocated AllocatedPortsSource) *StaticPortValidator {
+	return &StaticPortValidator{
+		name:            name,
+		logger:          logger,
+		defaultRanges:   defaultRanges,
+		namespaceRanges: namespaceRanges,
+		allocated:       allocated,
+	}
+}
+
+func (v *StaticPortValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	namespace := selector.Namespace(job)
+	ports := staticPorts(job)
+	if len(ports) == 0 {
+		return nil, nil
+	}
+
+	ranges, ok := v.namespaceRanges[namespace]
+	if !ok {
+		ranges = v.defaultRanges
+	}
+	var errs error
+	if len(ranges) > 0 {
+		for _, port := range ports {
+			if !inRanges(ranges, port.Value) {
+				errs = multierror.Append(errs, fmt.Errorf("static port %s=%d is not allowed in namespace %s", port.Label, port.Value, namespace))
+			}
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	if v.allocated == nil {
+		return nil, nil
+	}
+	allocated, err := v.allocated.AllocatedPorts()
+	if err != nil {
+		v.logger.Warn("failed to load allocated ports, skipping collision check", "rule", v.name, "error", err)
+		return nil, nil
+	}
+	self := namespace + "/"
+	if job.ID != nil {
+		self += *job.ID
+	}
+	var warnings []error
+	for _, port := range ports {
+		var others []string
+		for _, other := range allocated[port.Value] {
+			if other != self {
+				others = append(others, other)
+			}
+		}
+		if len(others) > 0 {
+			sort.Strings(others)
+			warnings = append(warnings, fmt.Errorf("static port %s=%d is already allocated by %s", port.Label, port.Value, strings.Join(others, ", ")))
+		}
+	}
+	return warnings, nil
+}
+
+func (v *StaticPortValidator) Name() string {
+	return v.name
+}
+
+// staticPorts returns the reserved ports of the group and the deprecated task networks.
+func staticPorts(job *api.Job) []api.Port {
+	var ports []api.Port
+	for _, tg := range job.TaskGroups {
+		for _, network := range tg.Networks {
+			if network != nil {
+				ports = append(ports, network.ReservedPorts...)
+			}
+		}
+		for _, task := range tg.Tasks {
+			if task.Resources == nil {
+				continue
+			}
+			for _, network := range task.Resources.Networks {
+				if network != nil {
+					ports = append(ports, network.ReservedPorts...)
+				}
+			}
+		}
+	}
+	return ports
+}
+
+func inRanges(ranges []PortRange, port int) bool {
+	for _, r := range ranges {
+		if r.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
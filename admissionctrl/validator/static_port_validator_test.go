@@ -0,0 +1,138 @@
+package validator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticAllocatedPorts map[int][]string
+
+func (s staticAllocatedPorts) AllocatedPorts() (map[int][]string, error) {
+	return s, nil
+}
+
+func portJob(namespace string, ports ...int) *api.Job {
+	id, group := "web", "web"
+	network := &api.NetworkResource{}
+	for _, port := range ports {
+		network.ReservedPorts = append(network.ReservedPorts, api.Port{Label: "http", Value: port})
+	}
+	return &api.Job{
+		ID:        &id,
+		Namespace: &namespace,
+		TaskGroups: []*api.TaskGroup{{
+			Name:     &group,
+			Networks: []*api.NetworkResource{network},
+			Tasks:    []*api.Task{{Name: "app", Resources: &api.Resources{Networks: []*api.NetworkResource{{ReservedPorts: []api.Port{{Label: "legacy", Value: 9999}}}}}}},
+		}},
+	}
+}
+
+func TestStaticPortValidator(t *testing.T) {
+	validator := NewStaticPortValidator(hclog.NewNullLogger(), "ports",
+		[]PortRange{{From: 20000, To: 20100}, {From: 9999, To: 9999}},
+		map[string][]PortRange{"prod": {{From: 30000, To: 30100}, {From: 9999, To: 9999}}},
+		staticAllocatedPorts{20001: {"default/other", "default/web"}, 30000: {"prod/web"}},
+	)
+
+	tt := []struct {
+		name         string
+		job          *api.Job
+		wantErr      string
+		wantWarnings []string
+	}{
+		{
+			name: "no static ports",
+			job:  &api.Job{},
+		},
+		{
+			name: "default range",
+			job:  portJob("default", 20050),
+		},
+		{
+			name:    "outside default range",
+			job:     portJob("default", 8080),
+			wantErr: "static port http=8080 is not allowed in namespace default",
+		},
+		{
+			name:    "namespace range",
+			job:     portJob("prod", 20050),
+			wantErr: "static port http=20050 is not allowed in namespace prod",
+		},
+		{
+			name:         "collision with other job",
+			job:          portJob("default", 20001),
+			wantWarnings: []string{"static port http=20001 is already allocated by default/other"},
+		},
+		{
+			name: "own allocation is no collision",
+			job:  portJob("prod", 30000),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := validator.Validate(&types.Payload{Job: tc.job})
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.Error())
+			}
+			assert.Equal(t, tc.wantWarnings, got)
+		})
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	r, err := ParsePortRange("20000-20100")
+	require.NoError(t, err)
+	assert.Equal(t, PortRange{From: 20000, To: 20100}, r)
+
+	r, err = ParsePortRange("8080")
+	require.NoError(t, err)
+	assert.Equal(t, PortRange{From: 8080, To: 8080}, r)
+
+	for _, invalid := range []string{"http", "20100-20000", "1-x"} {
+		_, err := ParsePortRange(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestNomadAllocatedPorts(t *testing.T) {
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/allocations", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("resources"))
+		assert.Equal(t, "*", r.URL.Query().Get("namespace"))
+		ports := func(values ...int) *api.AllocatedResources {
+			res := &api.AllocatedResources{}
+			for _, v := range values {
+				res.Shared.Ports = append(res.Shared.Ports, api.PortMapping{Value: v})
+			}
+			return res
+		}
+		json.NewEncoder(w).Encode([]*api.AllocationListStub{
+			{Namespace: "default", JobID: "web", ClientStatus: "running", AllocatedResources: ports(8080, 8081)},
+			{Namespace: "default", JobID: "web", ClientStatus: "running", AllocatedResources: ports(8080)},
+			{Namespace: "default", JobID: "old", ClientStatus: "complete", AllocatedResources: ports(9090)},
+		})
+	}))
+	defer nomad.Close()
+	client, err := api.NewClient(&api.Config{Address: nomad.URL})
+	require.NoError(t, err)
+
+	ports, err := NewNomadAllocatedPorts(client, time.Minute).AllocatedPorts()
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]string{8080: {"default/web"}, 8081: {"default/web"}}, ports)
+}
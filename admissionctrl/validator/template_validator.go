@@ -0,0 +1,106 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// vaultPath finds the paths of the Vault functions of consul-template, e.g. {{ with secret "kv/data/app" }}.
+var vaultPath = regexp.MustCompile("\\b(?:secret|secrets|pkiCert)\\s+[\"`]([^\"`]+)[\"`]")
+
+// TemplatePolicy describes the rules for template stanzas, zero values disable a check.
+type TemplatePolicy struct {
+	DenyPatterns         []*regexp.Regexp
+	AllowedVaultPrefixes []string
+	MaxSplay             time.Duration
+	AllowedChangeModes   []string
+}
+
+// TemplateValidator inspects the template stanzas of all tasks.
+type TemplateValidator struct {
+	name   string
+	logger hclog.Logger
+	policy TemplatePolicy
+}
+
+func NewTemplateValidator(logger hclog.Logger, name string, policy TemplatePolicy) *TemplateValidator {
+	return &TemplateValidator{
+		name:   name,
+		logger: logger,
+		policy: policy,
+	}
+}
+
+func (v *TemplateValidator) Validate(payload *types.Payload) ([]error, error) {
+	var errs error
+	for _, tg := range payload.Job.TaskGroups {
+		for _, task := range tg.Tasks {
+			for i, tmpl := range task.Templates {
+				if tmpl == nil {
+					continue
+				}
+				location := fmt.Sprintf("template %s in %s/%s", templateName(tmpl, i), groupName(tg), task.Name)
+				for _, err := range v.check(tmpl) {
+					errs = multierror.Append(errs, fmt.Errorf("%s: %w", location, err))
+				}
+			}
+		}
+	}
+	return nil, errs
+}
+
+func (v *TemplateValidator) check(tmpl *api.Template) []error {
+	var problems []error
+	var content string
+	if tmpl.EmbeddedTmpl != nil {
+		content = *tmpl.EmbeddedTmpl
+	}
+
+	for _, pattern := range v.policy.DenyPatterns {
+		if pattern.MatchString(content) {
+			problems = append(problems, fmt.Errorf("content matches forbidden pattern %s", pattern))
+		}
+	}
+	if v.policy.AllowedVaultPrefixes != nil {
+		for _, match := range vaultPath.FindAllStringSubmatch(content, -1) {
+			if !hasAnyPrefix(match[1], v.policy.AllowedVaultPrefixes) {
+				problems = append(problems, fmt.Errorf("vault path %s is not allowed", match[1]))
+			}
+		}
+	}
+	if v.policy.MaxSplay > 0 && tmpl.Splay != nil && *tmpl.Splay > v.policy.MaxSplay {
+		problems = append(problems, fmt.Errorf("splay %s exceeds %s", *tmpl.Splay, v.policy.MaxSplay))
+	}
+	if v.policy.AllowedChangeModes != nil && tmpl.ChangeMode != nil && *tmpl.ChangeMode != "" && !slices.Contains(v.policy.AllowedChangeModes, *tmpl.ChangeMode) {
+		problems = append(problems, fmt.Errorf("change_mode %s is not allowed", *tmpl.ChangeMode))
+	}
+	return problems
+}
+
+func (v *TemplateValidator) Name() string {
+	return v.name
+}
+
+func templateName(tmpl *api.Template, index int) string {
+	if tmpl.DestPath != nil && *tmpl.DestPath != "" {
+		return *tmpl.DestPath
+	}
+	return fmt.Sprintf("#%d", index)
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package validator
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func templateJob(templates ...*api.Template) *api.Job {
+	id, group := "example", "web"
+	return &api.Job{
+		ID: &id,
+		TaskGroups: []*api.TaskGroup{{
+			Name:  &group,
+			Tasks: []*api.Task{{Name: "app", Templates: templates}},
+		}},
+	}
+}
+
+func TestTemplateValidator(t *testing.T) {
+	validator := NewTemplateValidator(hclog.NewNullLogger(), "templates", TemplatePolicy{
+		DenyPatterns:         []*regexp.Regexp{regexp.MustCompile(`(?i)password\s*=\s*[^{\s]+`)},
+		AllowedVaultPrefixes: []string{"kv/data/apps/"},
+		MaxSplay:             time.Minute,
+		AllowedChangeModes:   []string{"restart", "signal"},
+	})
+
+	tt := []struct {
+		name      string
+		templates []*api.Template
+		want      []string
+	}{
+		{
+			name: "compliant",
+			templates: []*api.Template{{
+				DestPath:     pointerOf("local/config.env"),
+				EmbeddedTmpl: pointerOf(`{{ with secret "kv/data/apps/web" }}PASSWORD={{ .Data.data.password }}{{ end }}`),
+				ChangeMode:   pointerOf("restart"),
+				Splay:        pointerOf(5 * time.Second),
+			}},
+		},
+		{
+			name: "plaintext secret",
+			templates: []*api.Template{{
+				DestPath:     pointerOf("local/config.env"),
+				EmbeddedTmpl: pointerOf("password = hunter2"),
+			}},
+			want: []string{`template local/config.env in web/app: content matches forbidden pattern (?i)password\s*=\s*[^{\s]+`},
+		},
+		{
+			name: "vault path outside prefixes",
+			templates: []*api.Template{{
+				EmbeddedTmpl: pointerOf("{{ with secret `kv/data/other/db` }}{{ end }}{{ range secrets \"kv/metadata/apps/\" }}{{ end }}"),
+			}},
+			want: []string{
+				"template #0 in web/app: vault path kv/data/other/db is not allowed",
+				"template #0 in web/app: vault path kv/metadata/apps/ is not allowed",
+			},
+		},
+		{
+			name: "splay and change mode",
+			templates: []*api.Template{nil, {
+				ChangeMode: pointerOf("script"),
+				Splay:      pointerOf(time.Hour),
+			}},
+			want: []string{
+				"template #1 in web/app: splay 1h0m0s exceeds 1m0s",
+				"template #1 in web/app: change_mode script is not allowed",
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.Validate(&types.Payload{Job: templateJob(tc.templates...)})
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func pointerOf[T any](v T) *T {
+	return &v
+}
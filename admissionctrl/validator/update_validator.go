@@ -0,0 +1,112 @@
+package validator
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+const healthCheckManual = "manual"
+
+// UpdatePolicy describes the required update and migrate settings, zero values disable a check.
+type UpdatePolicy struct {
+	MinParallel int
+	MaxParallel int
+	// RequireHealthChecks forbids health_check = "manual"
+	RequireHealthChecks bool
+	RequireAutoRevert   bool
+}
+
+// UpdateValidator enforces sane update and migrate stanzas on the task groups of selected
+// service and system jobs, batch jobs have no deployments and are ignored.
+type UpdateValidator struct {
+	name     string
+	logger   hclog.Logger
+	selector *selector.Selector
+	policy   UpdatePolicy
+}
+
+func NewUpdateValidator(logger hclog.Logger, name string, selector *selector.Selector, policy UpdatePolicy) *UpdateValidator {
+	return &UpdateValidator{
+		name:     name,
+		logger:   logger,
+		selector: selector,
+		policy:   policy,
+	}
+}
+
+func (v *UpdateValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	if !v.selector.Matches(job) {
+		return nil, nil
+	}
+	jobType := api.JobTypeService
+	if job.Type != nil && *job.Type != "" {
+		jobType = *job.Type
+	}
+	if jobType != api.JobTypeService && jobType != api.JobTypeSystem {
+		return nil, nil
+	}
+
+	var errs error
+	for _, tg := range job.TaskGroups {
+		// the group settings take precedence over the job settings, unset values fall back to the Nomad defaults
+		update := api.DefaultUpdateStrategy()
+		update.AutoRevert = nil
+		update.Merge(job.Update)
+		update.Merge(tg.Update)
+		for _, err := range v.checkUpdate(update) {
+			errs = multierror.Append(errs, fmt.Errorf("update of %s: %w", groupName(tg), err))
+		}
+
+		if jobType != api.JobTypeService {
+			continue
+		}
+		migrate := api.DefaultMigrateStrategy()
+		if tg.Migrate != nil {
+			migrate.Merge(tg.Migrate)
+		}
+		for _, err := range v.checkMigrate(migrate) {
+			errs = multierror.Append(errs, fmt.Errorf("migrate of %s: %w", groupName(tg), err))
+		}
+	}
+	return nil, errs
+}
+
+func (v *UpdateValidator) checkUpdate(update *api.UpdateStrategy) []error {
+	problems := v.checkParallel(*update.MaxParallel)
+	if v.policy.RequireHealthChecks && *update.HealthCheck == healthCheckManual {
+		problems = append(problems, fmt.Errorf("health_check must not be %s", healthCheckManual))
+	}
+	if v.policy.RequireAutoRevert && (update.AutoRevert == nil || !*update.AutoRevert) {
+		problems = append(problems, fmt.Errorf("auto_revert must be enabled"))
+	}
+	return problems
+}
+
+func (v *UpdateValidator) checkMigrate(migrate *api.MigrateStrategy) []error {
+	problems := v.checkParallel(*migrate.MaxParallel)
+	if v.policy.RequireHealthChecks && *migrate.HealthCheck == healthCheckManual {
+		problems = append(problems, fmt.Errorf("health_check must not be %s", healthCheckManual))
+	}
+	return problems
+}
+
+func (v *UpdateValidator) checkParallel(maxParallel int) []error {
+	var problems []error
+	if v.policy.MinParallel > 0 && maxParallel < v.policy.MinParallel {
+		problems = append(problems, fmt.Errorf("max_parallel %d is below %d", maxParallel, v.policy.MinParallel))
+	}
+	if v.policy.MaxParallel > 0 && maxParallel > v.policy.MaxParallel {
+		problems = append(problems, fmt.Errorf("max_parallel %d exceeds %d", maxParallel, v.policy.MaxParallel))
+	}
+	return problems
+}
+
+func (v *UpdateValidator) Name() string {
+	return v.name
+}
@@ -0,0 +1,92 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateValidator(t *testing.T) {
+	prod, err := selector.New(&config.Selector{Namespaces: []string{"prod"}})
+	require.NoError(t, err)
+	validator := NewUpdateValidator(hclog.NewNullLogger(), "update", prod, UpdatePolicy{
+		MinParallel:         1,
+		MaxParallel:         3,
+		RequireHealthChecks: true,
+		RequireAutoRevert:   true,
+	})
+
+	job := func(namespace, jobType string, update *api.UpdateStrategy, group *api.TaskGroup) *api.Job {
+		id, name := "example", "web"
+		if group == nil {
+			group = &api.TaskGroup{}
+		}
+		group.Name = &name
+		return &api.Job{ID: &id, Namespace: &namespace, Type: &jobType, Update: update, TaskGroups: []*api.TaskGroup{group}}
+	}
+
+	tt := []struct {
+		name string
+		job  *api.Job
+		want []string
+	}{
+		{
+			name: "compliant job update",
+			job:  job("prod", "service", &api.UpdateStrategy{MaxParallel: pointerOf(2), AutoRevert: pointerOf(true)}, nil),
+		},
+		{
+			name: "group overrides job",
+			job: job("prod", "service", &api.UpdateStrategy{AutoRevert: pointerOf(true)}, &api.TaskGroup{
+				Update: &api.UpdateStrategy{MaxParallel: pointerOf(10), HealthCheck: pointerOf("manual")},
+			}),
+			want: []string{
+				"update of web: max_parallel 10 exceeds 3",
+				"update of web: health_check must not be manual",
+			},
+		},
+		{
+			name: "missing update stanza",
+			job:  job("prod", "service", nil, nil),
+			want: []string{"update of web: auto_revert must be enabled"},
+		},
+		{
+			name: "migrate",
+			job: job("prod", "service", &api.UpdateStrategy{AutoRevert: pointerOf(true)}, &api.TaskGroup{
+				Migrate: &api.MigrateStrategy{MaxParallel: pointerOf(0), HealthCheck: pointerOf("manual")},
+			}),
+			want: []string{
+				"migrate of web: max_parallel 0 is below 1",
+				"migrate of web: health_check must not be manual",
+			},
+		},
+		{
+			name: "batch jobs are ignored",
+			job:  job("prod", "batch", nil, nil),
+		},
+		{
+			name: "other namespaces are ignored",
+			job:  job("dev", "service", nil, nil),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.Validate(&types.Payload{Job: tc.job})
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package validator
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// VolumePolicy restricts the volumes of a namespace, zero values disable a check.
+type VolumePolicy struct {
+	// AllowedSources are glob patterns of host volume names and CSI volume IDs
+	AllowedSources []string
+	// AllowedPlugins are the CSI plugins whose volumes may be mounted
+	AllowedPlugins []string
+	// ReadOnly forbids writable volumes
+	ReadOnly bool
+}
+
+// VolumePluginSource returns the plugin of a CSI volume.
+type VolumePluginSource interface {
+	PluginID(namespace, volumeID string) (string, error)
+}
+
+// NomadVolumePlugins reads the CSI volumes from the Nomad API and caches their plugin.
+type NomadVolumePlugins struct {
+	client *api.Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	plugins map[string]cachedPlugin
+}
+
+type cachedPlugin struct {
+	id      string
+	expires time.Time
+}
+
+func NewNomadVolumePlugins(client *api.Client, ttl time.Duration) *NomadVolumePlugins {
+	return &NomadVolumePlugins{
+		client:  client,
+		ttl:     ttl,
+		plugins: make(map[string]cachedPlugin),
+	}
+}
+
+func (n *NomadVolumePlugins) PluginID(namespace, volumeID string) (string, error) {
+	key := namespace + "/" + volumeID
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if cached, ok := n.plugins[key]; ok && time.Now().Before(cached.expires) {
+		return cached.id, nil
+	}
+	volume, _, err := n.client.CSIVolumes().Info(volumeID, &api.QueryOptions{Namespace: namespace})
+	if err != nil {
+		return "", err
+	}
+	n.plugins[key] = cachedPlugin{id: volume.PluginID, expires: time.Now().Add(n.ttl)}
+	return volume.PluginID, nil
+}
+
+// VolumeValidator restricts which host and CSI volumes a namespace may mount and whether they may be written,
+// volume access is effectively a data access decision.
+type VolumeValidator struct {
+	name       string
+	logger     hclog.Logger
+	defaults   VolumePolicy
+	namespaces map[string]VolumePolicy
+	plugins    VolumePluginSource
+}
+
+// NewVolumeValidator creates the validator, namespaces with an own policy don't use the defaults.
+// The plugins source is only needed if a policy restricts the CSI plugins.
+func NewVolumeValidator(logger hclog.Logger, name string, defaults VolumePolicy, namespaces map[string]VolumePolicy, plugins VolumePluginSource) (*VolumeValidator, error) {
+	for _, policy := range append([]VolumePolicy{defaults}, slices.Collect(maps.Values(namespaces))...) {
+		for _, pattern := range policy.AllowedSources {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid source pattern %q: %w", pattern, err)
+			}
+		}
+		if policy.AllowedPlugins != nil && plugins == nil {
+			return nil, fmt.Errorf("allowed plugins require a volume plugin source")
+		}
+	}
+	return &VolumeValidator{
+		name:       name,
+		logger:     logger,
+		defaults:   defaults,
+		namespaces: namespaces,
+		plugins:    plugins,
+	}, nil
+}
+
+func (v *VolumeValidator) Validate(payload *types.Payload) ([]error, error) {
+	job := payload.Job
+	namespace := selector.Namespace(job)
+	policy, ok := v.namespaces[namespace]
+	if !ok {
+		policy = v.defaults
+	}
+
+	var warnings []error
+	var errs error
+	for _, tg := range job.TaskGroups {
+		for _, name := range slices.Sorted(maps.Keys(tg.Volumes)) {
+			volume := tg.Volumes[name]
+			if volume == nil {
+				continue
+			}
+			location := fmt.Sprintf("volume %s of %s", name, groupName(tg))
+			if policy.AllowedSources != nil && !matchesAny(policy.AllowedSources, volume.Source) {
+				errs = multierror.Append(errs, fmt.Errorf("%s: source %s is not allowed in namespace %s", location, volume.Source, namespace))
+			}
+			if policy.ReadOnly && writable(volume, tg, name) {
+				errs = multierror.Append(errs, fmt.Errorf("%s: must be read only in namespace %s", location, namespace))
+			}
+			if policy.AllowedPlugins != nil && volume.Type == "csi" {
+				volumeID := volume.Source
+				if volume.PerAlloc {
+					volumeID += "[0]"
+				}
+				plugin, err := v.plugins.PluginID(namespace, volumeID)
+				if err != nil {
+					warnings = append(warnings, fmt.Errorf("%s: failed to look up the CSI plugin: %w", location, err))
+					continue
+				}
+				if !slices.Contains(policy.AllowedPlugins, plugin) {
+					errs = multierror.Append(errs, fmt.Errorf("%s: CSI plugin %s is not allowed in namespace %s", location, plugin, namespace))
+				}
+			}
+		}
+	}
+	return warnings, errs
+}
+
+func (v *VolumeValidator) Name() string {
+	return v.name
+}
+
+// writable reports whether a task can write to the volume.
+func writable(volume *api.VolumeRequest, tg *api.TaskGroup, name string) bool {
+	if volume.ReadOnly {
+		return false
+	}
+	mounted := false
+	for _, task := range tg.Tasks {
+		for _, mount := range task.VolumeMounts {
+			if mount == nil || mount.Volume == nil || *mount.Volume != name {
+				continue
+			}
+			mounted = true
+			if mount.ReadOnly == nil || !*mount.ReadOnly {
+				return true
+			}
+		}
+	}
+	// volumes without read only task mounts, e.g. used by a CSI plugin directly
+	return !mounted
+}
@@ -0,0 +1,131 @@
+package validator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticVolumePlugins map[string]string
+
+func (s staticVolumePlugins) PluginID(namespace, volumeID string) (string, error) {
+	plugin, ok := s[namespace+"/"+volumeID]
+	if !ok {
+		return "", fmt.Errorf("volume %s not found", volumeID)
+	}
+	return plugin, nil
+}
+
+func volumeJob(namespace string, volumes map[string]*api.VolumeRequest, mounts ...*api.VolumeMount) *api.Job {
+	id, group := "example", "db"
+	return &api.Job{
+		ID:        &id,
+		Namespace: &namespace,
+		TaskGroups: []*api.TaskGroup{{
+			Name:    &group,
+			Volumes: volumes,
+			Tasks:   []*api.Task{{Name: "postgres", VolumeMounts: mounts}},
+		}},
+	}
+}
+
+func TestVolumeValidator(t *testing.T) {
+	validator, err := NewVolumeValidator(hclog.NewNullLogger(), "volumes",
+		VolumePolicy{AllowedSources: []string{"shared-*"}, ReadOnly: true},
+		map[string]VolumePolicy{"data": {AllowedPlugins: []string{"ebs"}}},
+		staticVolumePlugins{"data/pg[0]": "ebs", "data/nfs": "nfs"},
+	)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name         string
+		job          *api.Job
+		want         []string
+		wantWarnings []string
+	}{
+		{
+			name: "read only shared volume",
+			job: volumeJob("default", map[string]*api.VolumeRequest{"certs": {Type: "host", Source: "shared-certs"}},
+				&api.VolumeMount{Volume: pointerOf("certs"), ReadOnly: pointerOf(true)}),
+		},
+		{
+			name: "writable and not allowed source",
+			job: volumeJob("default", map[string]*api.VolumeRequest{
+				"certs": {Type: "host", Source: "shared-certs"},
+				"data":  {Type: "host", Source: "pg-data", ReadOnly: true},
+			}, &api.VolumeMount{Volume: pointerOf("certs")}),
+			want: []string{
+				"volume certs of db: must be read only in namespace default",
+				"volume data of db: source pg-data is not allowed in namespace default",
+			},
+		},
+		{
+			name: "allowed csi plugin",
+			job:  volumeJob("data", map[string]*api.VolumeRequest{"pg": {Type: "csi", Source: "pg", PerAlloc: true}}),
+		},
+		{
+			name: "forbidden csi plugin",
+			job:  volumeJob("data", map[string]*api.VolumeRequest{"files": {Type: "csi", Source: "nfs"}}),
+			want: []string{"volume files of db: CSI plugin nfs is not allowed in namespace data"},
+		},
+		{
+			name:         "unknown csi volume",
+			job:          volumeJob("data", map[string]*api.VolumeRequest{"files": {Type: "csi", Source: "missing"}}),
+			wantWarnings: []string{"volume files of db: failed to look up the CSI plugin: volume missing not found"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := validator.Validate(&types.Payload{Job: tc.job})
+			var gotWarnings []string
+			for _, w := range warnings {
+				gotWarnings = append(gotWarnings, w.Error())
+			}
+			assert.Equal(t, tc.wantWarnings, gotWarnings)
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var got []string
+			for _, e := range err.(*multierror.Error).Errors {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNewVolumeValidatorRequiresPluginSource(t *testing.T) {
+	_, err := NewVolumeValidator(hclog.NewNullLogger(), "volumes", VolumePolicy{AllowedPlugins: []string{"ebs"}}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestNomadVolumePlugins(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/v1/volume/csi/pg", r.URL.Path)
+		assert.Equal(t, "data", r.URL.Query().Get("namespace"))
+		fmt.Fprint(w, `{"ID": "pg", "PluginID": "ebs"}`)
+	}))
+	defer server.Close()
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	plugins := NewNomadVolumePlugins(client, time.Minute)
+	for i := 0; i < 2; i++ {
+		plugin, err := plugins.PluginID("data", "pg")
+		require.NoError(t, err)
+		assert.Equal(t, "ebs", plugin)
+	}
+	assert.Equal(t, 1, requests)
+}
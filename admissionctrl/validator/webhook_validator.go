@@ -2,9 +2,12 @@ package validator
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/mxab/nacp/admissionctrl/errcode"
 	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/pkg/webhook"
 	"net/http"
 	"net/url"
 
@@ -17,57 +20,79 @@ type WebhookValidator struct {
 	logger   hclog.Logger
 	method   string
 	name     string
+	// maxResponseSize bounds the response, webhook.DefaultMaxResponseSize if not positive
+	maxResponseSize int64
 }
 
-type validationWebhookResponse struct {
-	Errors   []string `json:"errors"`
-	Warnings []string `json:"warnings"`
+func (w *WebhookValidator) Validate(payload *types.Payload) ([]error, error) {
+	return w.ValidateContext(context.Background(), payload)
 }
 
-func (w *WebhookValidator) Validate(payload *types.Payload) ([]error, error) {
+// ValidateContext calls the webhook, cancelling the context aborts the call.
+func (w *WebhookValidator) ValidateContext(ctx context.Context, payload *types.Payload) ([]error, error) {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(w.method, w.endpoint.String(), bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, w.method, w.endpoint.String(), bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
 
+	req.Header.Set(webhook.HeaderContractVersion, webhook.Version)
 	// Add context headers and body if available
 	if payload.Context != nil {
 		// Add standard headers for backward compatibility
 		if payload.Context.ClientIP != "" {
-			req.Header.Set("X-Forwarded-For", payload.Context.ClientIP) // Standard proxy header
-			req.Header.Set("NACP-Client-IP", payload.Context.ClientIP)  // NACP specific
+			req.Header.Set("X-Forwarded-For", payload.Context.ClientIP)      // Standard proxy header
+			req.Header.Set(webhook.HeaderClientIP, payload.Context.ClientIP) // NACP specific
 		}
 		if payload.Context.AccessorID != "" {
-			req.Header.Set("NACP-Accessor-ID", payload.Context.AccessorID)
+			req.Header.Set(webhook.HeaderAccessorID, payload.Context.AccessorID)
 		}
 	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, errcode.Unreachable(w.name, err)
 	}
+	defer resp.Body.Close()
 
-	valdationResult := &validationWebhookResponse{}
-	err = json.NewDecoder(resp.Body).Decode(valdationResult)
+	valdationResult := &webhook.ValidationResponse{}
+	err = webhook.DecodeResponse(resp.Body, w.maxResponseSize, valdationResult)
 
 	if err != nil {
-		return nil, err
+		return nil, errcode.Failed(w.name, err)
+	}
+
+	var warnings []error
+	var denials []error
+	for _, r := range valdationResult.Results {
+		severity, err := types.ParseSeverity(r.Severity)
+		if err != nil {
+			return nil, errcode.Failed(w.name, err)
+		}
+		result := &types.Result{Severity: severity, Message: r.Message, Field: r.Field, Code: r.Code, DocsURL: r.DocsURL}
+		if severity == types.SeverityError {
+			denials = append(denials, result)
+		} else {
+			warnings = append(warnings, result)
+		}
 	}
 
-	if len(valdationResult.Errors) > 0 {
-		w.logger.Error("validation errors", "errors", valdationResult.Errors, "rule", w.name, "job", payload.Job.ID)
+	if len(valdationResult.Errors) > 0 || len(denials) > 0 {
+		w.logger.Error("validation errors", "errors", valdationResult.Errors, "results", denials, "rule", w.name, "job", payload.Job.ID)
 		oneError := &multierror.Error{}
 		for _, e := range valdationResult.Errors {
 			oneError = multierror.Append(oneError, fmt.Errorf("%v", e))
 		}
+		oneError = multierror.Append(oneError, denials...)
 		return nil, oneError
 	}
 
-	var warnings []error
+	for _, info := range valdationResult.Infos {
+		warnings = append(warnings, types.WithSeverity(fmt.Errorf("%v", info), types.SeverityInfo))
+	}
 	if len(valdationResult.Warnings) > 0 {
 
 		for _, w := range valdationResult.Warnings {
@@ -81,7 +106,7 @@ func (w *WebhookValidator) Validate(payload *types.Payload) ([]error, error) {
 func (w *WebhookValidator) Name() string {
 	return w.name
 }
-func NewWebhookValidator(name string, endpoint string, method string, logger hclog.Logger) (*WebhookValidator, error) {
+func NewWebhookValidator(name string, endpoint string, method string, maxResponseSize int64, logger hclog.Logger) (*WebhookValidator, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
@@ -91,5 +116,7 @@ func NewWebhookValidator(name string, endpoint string, method string, logger hcl
 		logger:   logger,
 		endpoint: u,
 		method:   method,
+
+		maxResponseSize: maxResponseSize,
 	}, nil
 }
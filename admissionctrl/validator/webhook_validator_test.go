@@ -1,13 +1,17 @@
 package validator
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/mxab/nacp/admissionctrl/errcode"
 	"github.com/mxab/nacp/admissionctrl/types"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
@@ -64,6 +68,15 @@ func TestWebhookValidator(t *testing.T) {
 			wantErr:      nil,
 			wantWarnings: []error{fmt.Errorf("warning1"), fmt.Errorf("warning2")},
 		},
+		{
+			name:         "infos",
+			endpointPath: "/validate",
+
+			method:       "POST",
+			response:     `{"errors": [], "warnings": ["warning1"], "infos": ["info1"]}`,
+			wantErr:      nil,
+			wantWarnings: []error{types.WithSeverity(fmt.Errorf("info1"), types.SeverityInfo), fmt.Errorf("warning1")},
+		},
 	}
 
 	for _, tc := range tt {
@@ -89,7 +102,7 @@ func TestWebhookValidator(t *testing.T) {
 			}))
 			defer server.Close()
 
-			validator, err := NewWebhookValidator("test", server.URL+tc.endpointPath, tc.method, hclog.NewNullLogger())
+			validator, err := NewWebhookValidator("test", server.URL+tc.endpointPath, tc.method, 0, hclog.NewNullLogger())
 			require.NoError(t, err)
 
 			payload := &types.Payload{Job: &api.Job{ID: &tc.name}}
@@ -101,3 +114,77 @@ func TestWebhookValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestWebhookValidator_RejectsOversizedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors": [], "warnings": ["` + strings.Repeat("x", 1024) + `"]}`))
+	}))
+	defer server.Close()
+
+	validator, err := NewWebhookValidator("test", server.URL, "POST", 512, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	warnings, err := validator.Validate(&types.Payload{Job: &api.Job{ID: pointerOf("test")}})
+	assert.EqualError(t, err, "webhook response exceeds the limit of 512 bytes")
+	assert.Nil(t, warnings)
+}
+
+func TestWebhookValidator_ClassifiesFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`not json`))
+	}))
+	validator, err := NewWebhookValidator("test", server.URL, "POST", 0, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	_, err = validator.Validate(&types.Payload{Job: &api.Job{ID: pointerOf("test")}})
+	assert.Equal(t, errcode.CodeInternal, errcode.Of(err).Code, "an invalid response is a failure of the rule")
+
+	server.Close()
+	_, err = validator.Validate(&types.Payload{Job: &api.Job{ID: pointerOf("test")}})
+	assert.Equal(t, errcode.CodeUnavailable, errcode.Of(err).Code)
+	assert.True(t, errcode.Of(err).Retriable)
+}
+
+func TestWebhookValidator_CancelledByContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	validator, err := NewWebhookValidator("test", server.URL, "POST", 0, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = validator.ValidateContext(ctx, &types.Payload{Job: &api.Job{ID: pointerOf("test")}})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, errcode.CodeTimeout, errcode.Of(err).Code)
+}
+
+func TestWebhookValidator_Results(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [
+			{"message": "count must be at least 2", "field": "TaskGroups[0].Count", "code": "min_count", "docsURL": "https://example.com/count"},
+			{"severity": "info", "message": "consider a canary"}
+		]}`))
+	}))
+	defer server.Close()
+	validator, err := NewWebhookValidator("test", server.URL, "POST", 0, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	_, err = validator.Validate(&types.Payload{Job: &api.Job{ID: pointerOf("test")}})
+	require.Error(t, err)
+	var result *types.Result
+	require.ErrorAs(t, err, &result)
+	assert.Equal(t, &types.Result{Severity: types.SeverityError, Message: "count must be at least 2", Field: "TaskGroups[0].Count", Code: "min_count", DocsURL: "https://example.com/count"}, result)
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"severity": "info", "message": "consider a canary"}]}`))
+	})
+	warnings, err := validator.Validate(&types.Payload{Job: &api.Job{ID: pointerOf("test")}})
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.Equal(t, types.SeverityInfo, types.SeverityOf(warnings[0]))
+}
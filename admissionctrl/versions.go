@@ -0,0 +1,95 @@
+package admissionctrl
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/metrics"
+)
+
+const (
+	kindMutator   = "mutator"
+	kindValidator = "validator"
+	kindReadRule  = "read_rule"
+
+	decisionAccepted = "accepted"
+	decisionWarned   = "warned"
+	decisionRejected = "rejected"
+)
+
+// RuleVersions maps rule names to the version of their definition, e.g. a
+// hash of the config block and policy file, so decisions can be traced back to a policy revision.
+type RuleVersions struct {
+	Mutators   map[string]string `json:"mutators"`
+	Validators map[string]string `json:"validators"`
+}
+
+func (v RuleVersions) version(kind, rule string) string {
+	if kind == kindMutator {
+		return v.Mutators[rule]
+	}
+	return v.Validators[rule]
+}
+
+// UseRuleVersions sets the versions of the active rules, they are added to
+// warnings, errors, decision logs and metrics.
+func (j *JobHandler) UseRuleVersions(versions RuleVersions) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.versions = versions
+}
+
+// RuleVersions returns the versions of the active rules.
+func (j *JobHandler) RuleVersions() RuleVersions {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.versions
+}
+
+// decide logs and counts the outcome of a rule and tags its warnings and errors with the rule version.
+func (j *JobHandler) decide(kind, rule string, job *api.Job, warnings []error, err error) ([]error, error) {
+	j.mu.RLock()
+	version := j.versions.version(kind, rule)
+	j.mu.RUnlock()
+
+	decision := decisionAccepted
+	switch {
+	case err != nil:
+		decision = decisionRejected
+	case len(warnings) > 0:
+		decision = decisionWarned
+	}
+	metrics.RuleDecisions.WithLabelValues(kind, rule, version, decision).Inc()
+
+	fields := []interface{}{kind, rule, "version", version, "decision", decision, "job", jobID(job)}
+	if decision == decisionAccepted {
+		j.logger.Debug("rule decision", fields...)
+	} else {
+		j.logger.Info("rule decision", append(fields, "warnings", len(warnings), "error", err)...)
+	}
+
+	if version == "" {
+		return warnings, err
+	}
+	tagged := make([]error, 0, len(warnings))
+	for _, w := range warnings {
+		tagged = append(tagged, tagVersion(w, rule, version))
+	}
+	if err != nil {
+		if merr, ok := err.(*multierror.Error); ok {
+			var errs *multierror.Error
+			for _, e := range merr.Errors {
+				errs = multierror.Append(errs, tagVersion(e, rule, version))
+			}
+			err = errs
+		} else {
+			err = tagVersion(err, rule, version)
+		}
+	}
+	return tagged, err
+}
+
+func tagVersion(err error, rule, version string) error {
+	return fmt.Errorf("%w (%s@%s)", err, rule, version)
+}
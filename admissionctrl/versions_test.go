@@ -0,0 +1,62 @@
+package admissionctrl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/metrics"
+	"github.com/mxab/nacp/testutil"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobHandler_UseRuleVersions(t *testing.T) {
+	mutator := new(testutil.MockMutator)
+	mutator.On("Mutate", mock.Anything).Return(&api.Job{}, []error{fmt.Errorf("mutated")}, nil)
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf("careful")},
+		multierror.Append(nil, fmt.Errorf("missing owner"), fmt.Errorf("missing team")))
+
+	j := NewJobHandler([]JobMutator{mutator}, []JobValidator{validator}, hclog.NewNullLogger(), false)
+	versions := RuleVersions{
+		Mutators:   map[string]string{"mock-mutator": "aaaa"},
+		Validators: map[string]string{"mock-validator": "bbbb"},
+	}
+	j.UseRuleVersions(versions)
+	assert.Equal(t, versions, j.RuleVersions())
+
+	rejected := metrics.RuleDecisions.WithLabelValues("validator", "mock-validator", "bbbb", "rejected")
+	before := promtestutil.ToFloat64(rejected)
+
+	_, warnings, err := j.AdmissionMutators(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.EqualError(t, warnings[0], "mutated (mock-mutator@aaaa)")
+
+	warnings, err = j.AdmissionValidators(&types.Payload{Job: &api.Job{ID: pointer("job")}})
+	require.Len(t, warnings, 1)
+	assert.EqualError(t, warnings[0], "careful (mock-validator@bbbb)")
+	merr, ok := err.(*multierror.Error)
+	require.True(t, ok)
+	require.Len(t, merr.Errors, 2)
+	assert.EqualError(t, merr.Errors[0], "missing owner (mock-validator@bbbb)")
+	assert.EqualError(t, merr.Errors[1], "missing team (mock-validator@bbbb)")
+
+	assert.Equal(t, before+1, promtestutil.ToFloat64(rejected))
+}
+
+func TestJobHandler_WithoutRuleVersions(t *testing.T) {
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{fmt.Errorf("careful")}, nil)
+	j := NewJobHandler(nil, []JobValidator{validator}, hclog.NewNullLogger(), false)
+
+	warnings, err := j.AdmissionValidators(&types.Payload{Job: &api.Job{}})
+	assert.NoError(t, err)
+	assert.Equal(t, []error{fmt.Errorf("careful")}, warnings, "warnings are not tagged without versions")
+}
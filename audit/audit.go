@@ -0,0 +1,97 @@
+// Package audit exports the rule decisions of NACP to external systems, e.g. a SIEM.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/metrics"
+)
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// Writer delivers one decision, a failed write is retried with the same decision.
+type Writer interface {
+	Write(ctx context.Context, d admissionctrl.Decision) error
+	Close() error
+}
+
+// Exporter buffers the decisions and writes them in the background, so a slow or unavailable
+// receiver never delays an admission. Decisions are dropped if the buffer is full.
+type Exporter struct {
+	name      string
+	writer    Writer
+	decisions map[string]bool
+	buffer    chan admissionctrl.Decision
+	logger    hclog.Logger
+}
+
+// NewExporter exports the decisions with one of the outcomes, all if decisions is empty.
+func NewExporter(name string, writer Writer, decisions []string, bufferSize int, logger hclog.Logger) *Exporter {
+	e := &Exporter{
+		name:   name,
+		writer: writer,
+		buffer: make(chan admissionctrl.Decision, bufferSize),
+		logger: logger,
+	}
+	if len(decisions) > 0 {
+		e.decisions = make(map[string]bool, len(decisions))
+		for _, d := range decisions {
+			e.decisions[d] = true
+		}
+	}
+	return e
+}
+
+// Record queues the decision without blocking.
+func (e *Exporter) Record(d admissionctrl.Decision) {
+	if e.decisions != nil && !e.decisions[d.Decision] {
+		return
+	}
+	select {
+	case e.buffer <- d:
+	default:
+		metrics.DecisionExports.WithLabelValues(e.name, "dropped").Inc()
+		e.logger.Warn("Export buffer is full, dropping decision", "rule", d.Rule, "job", d.JobID)
+	}
+}
+
+// Run writes the queued decisions until the context is done, decisions still buffered then are lost.
+func (e *Exporter) Run(ctx context.Context) {
+	defer e.writer.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-e.buffer:
+			if !e.write(ctx, d) {
+				return
+			}
+		}
+	}
+}
+
+// write retries the decision with backoff until it is written or the context is done.
+func (e *Exporter) write(ctx context.Context, d admissionctrl.Decision) bool {
+	delay := minRetryDelay
+	for {
+		err := e.writer.Write(ctx, d)
+		if err == nil {
+			metrics.DecisionExports.WithLabelValues(e.name, "sent").Inc()
+			return true
+		}
+		metrics.DecisionExports.WithLabelValues(e.name, "failed").Inc()
+		e.logger.Warn("Failed to export decision, retrying", "error", err, "retry_in", delay)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
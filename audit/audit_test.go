@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/metrics"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWriter fails the first failures writes.
+type fakeWriter struct {
+	mu       sync.Mutex
+	failures int
+	written  []admissionctrl.Decision
+	closed   bool
+}
+
+func (w *fakeWriter) Write(ctx context.Context, d admissionctrl.Decision) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		return fmt.Errorf("receiver unavailable")
+	}
+	w.written = append(w.written, d)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *fakeWriter) Written() []admissionctrl.Decision {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]admissionctrl.Decision{}, w.written...)
+}
+
+func TestExporter_Filter(t *testing.T) {
+	tests := []struct {
+		name      string
+		decisions []string
+		want      []string
+	}{
+		{name: "all by default", want: []string{"accepted", "warned", "rejected"}},
+		{name: "only denials", decisions: []string{"rejected"}, want: []string{"rejected"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExporter("test", &fakeWriter{}, tt.decisions, 10, hclog.NewNullLogger())
+			for _, d := range []string{"accepted", "warned", "rejected"} {
+				e.Record(admissionctrl.Decision{Decision: d})
+			}
+			close(e.buffer)
+			var got []string
+			for d := range e.buffer {
+				got = append(got, d.Decision)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExporter_DropsWhenFull(t *testing.T) {
+	dropped := metrics.DecisionExports.WithLabelValues("full", "dropped")
+	before := promtestutil.ToFloat64(dropped)
+
+	e := NewExporter("full", &fakeWriter{}, nil, 1, hclog.NewNullLogger())
+	e.Record(admissionctrl.Decision{Rule: "first"})
+	e.Record(admissionctrl.Decision{Rule: "second"})
+
+	assert.Len(t, e.buffer, 1)
+	assert.Equal(t, before+1, promtestutil.ToFloat64(dropped))
+}
+
+func TestExporter_RetriesFailedWrites(t *testing.T) {
+	writer := &fakeWriter{failures: 1}
+	e := NewExporter("retry", writer, nil, 10, hclog.NewNullLogger())
+	e.Record(admissionctrl.Decision{Rule: "first"})
+	e.Record(admissionctrl.Decision{Rule: "second"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return len(writer.Written()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	written := writer.Written()
+	assert.Equal(t, "first", written[0].Rule, "the failed decision is retried before the next one")
+	assert.Equal(t, "second", written[1].Rule)
+	assert.True(t, writer.closed)
+}
@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"encoding/json"
+
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// eventJSON is the JSON of a decision published to an event bus, without the secret of the submitter's token.
+func eventJSON(d admissionctrl.Decision) ([]byte, error) {
+	if d.Context != nil && d.Context.TokenInfo != nil {
+		ctx := *d.Context
+		token := *ctx.TokenInfo
+		token.SecretID = ""
+		ctx.TokenInfo = &token
+		d.Context = &ctx
+	}
+	return json.Marshal(d)
+}
+
+// eventKey keeps the events of a job in order, e.g. on one Kafka partition.
+func eventKey(d admissionctrl.Decision) string {
+	return d.Namespace + "/" + d.JobID
+}
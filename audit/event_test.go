@@ -0,0 +1,23 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventJSON_RedactsTokenSecret(t *testing.T) {
+	d := testDecision
+	d.Context = &config.RequestContext{TokenInfo: &api.ACLToken{Name: "ci", SecretID: "9d7f"}}
+	d.Patch = json.RawMessage(`{"Meta":{"team":"a"}}`)
+
+	raw, err := eventJSON(d)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "9d7f")
+	assert.Contains(t, string(raw), `"patch":{"Meta":{"team":"a"}}`)
+	assert.Equal(t, "9d7f", d.Context.TokenInfo.SecretID, "the decision passed to other sinks is unchanged")
+}
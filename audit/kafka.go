@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept      = "application/vnd.kafka.v2+json"
+	kafkaTimeout     = 10 * time.Second
+)
+
+// KafkaWriter produces decisions as JSON records via the v2 API of a Kafka REST proxy, e.g. the Confluent REST Proxy,
+// the Redpanda HTTP proxy or the Strimzi Kafka Bridge. A decision counts as written once the proxy returns its offset.
+type KafkaWriter struct {
+	endpoint string
+	client   *http.Client
+	username string
+	password string
+}
+
+func NewKafkaWriter(address *url.URL, topic string, client *http.Client, username, password string) *KafkaWriter {
+	return &KafkaWriter{
+		endpoint: address.JoinPath("topics", topic).String(),
+		client:   client,
+		username: username,
+		password: password,
+	}
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (w *KafkaWriter) Write(ctx context.Context, d admissionctrl.Decision) error {
+	value, err := eventJSON(d)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": {{Key: eventKey(d), Value: value}}})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, kafkaTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", kafkaAccept)
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("kafka rest proxy returned %s: %s", resp.Status, msg)
+	}
+	var result struct {
+		Offsets []struct {
+			Error *string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid kafka rest proxy response: %w", err)
+	}
+	for _, offset := range result.Offsets {
+		if offset.Error != nil && *offset.Error != "" {
+			return fmt.Errorf("failed to produce record: %s", *offset.Error)
+		}
+	}
+	return nil
+}
+
+func (w *KafkaWriter) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
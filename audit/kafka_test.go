@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		wantErr  string
+	}{
+		{name: "produced", status: http.StatusOK, response: `{"offsets":[{"partition":0,"offset":42,"error_code":null,"error":null}]}`},
+		{name: "record error", status: http.StatusOK, response: `{"offsets":[{"partition":null,"offset":null,"error_code":50003,"error":"broker unavailable"}]}`, wantErr: "failed to produce record: broker unavailable"},
+		{name: "unknown topic", status: http.StatusNotFound, response: `{"error_code":40401,"message":"Topic not found"}`, wantErr: "kafka rest proxy returned 404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string][]map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/kafka/topics/nacp-decisions", r.URL.Path)
+				assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+				user, pass, ok := r.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "nacp", user)
+				assert.Equal(t, "secret", pass)
+				raw, _ := io.ReadAll(r.Body)
+				require.NoError(t, json.Unmarshal(raw, &body))
+				w.Header().Set("Content-Type", "application/vnd.kafka.v2+json")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+			address, err := url.Parse(server.URL + "/kafka")
+			require.NoError(t, err)
+
+			w := NewKafkaWriter(address, "nacp-decisions", server.Client(), "nacp", "secret")
+			err = w.Write(context.Background(), testDecision)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			require.Len(t, body["records"], 1)
+			record := body["records"][0]
+			assert.Equal(t, "team-a/web", record["key"])
+			assert.Equal(t, "costcenter", record["value"].(map[string]interface{})["rule"])
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+const natsTimeout = 10 * time.Second
+
+// NATSWriter publishes decisions as JSON to a JetStream subject and waits for the stream's ack,
+// so every decision is stored at least once. The Nats-Msg-Id header lets the stream drop duplicates of retries.
+type NATSWriter struct {
+	address   *url.URL
+	subject   string
+	tlsConfig *tls.Config
+	// connect holds the credentials of the CONNECT message
+	connect map[string]interface{}
+
+	conn   net.Conn
+	reader *bufio.Reader
+	inbox  string
+}
+
+// NewNATSWriter connects lazily to the nats:// or tls:// address, with TLS if tlsConfig is set, the scheme is tls or the server requires it.
+func NewNATSWriter(address *url.URL, subject string, tlsConfig *tls.Config, username, password, token, version string) *NATSWriter {
+	connect := map[string]interface{}{
+		"verbose":       false,
+		"pedantic":      false,
+		"name":          product,
+		"lang":          "go",
+		"version":       version,
+		"protocol":      1,
+		"headers":       true,
+		"no_responders": true,
+	}
+	if username != "" {
+		connect["user"], connect["pass"] = username, password
+	}
+	if token != "" {
+		connect["auth_token"] = token
+	}
+	return &NATSWriter{
+		address:   address,
+		subject:   subject,
+		tlsConfig: tlsConfig,
+		connect:   connect,
+	}
+}
+
+func (w *NATSWriter) Write(ctx context.Context, d admissionctrl.Decision) error {
+	payload, err := eventJSON(d)
+	if err != nil {
+		return err
+	}
+	if w.conn == nil {
+		if err := w.dial(ctx); err != nil {
+			w.Close()
+			return fmt.Errorf("failed to connect to %s: %w", w.address.Host, err)
+		}
+	}
+	if err := w.publish(payload); err != nil {
+		// reconnect on the next write, the connection is in an unknown state
+		w.Close()
+		return err
+	}
+	return nil
+}
+
+func (w *NATSWriter) publish(payload []byte) error {
+	sum := sha256.Sum256(payload)
+	header := "NATS/1.0\r\nNats-Msg-Id: " + hex.EncodeToString(sum[:16]) + "\r\n\r\n"
+	w.conn.SetDeadline(time.Now().Add(natsTimeout))
+	if _, err := fmt.Fprintf(w.conn, "HPUB %s %s %d %d\r\n%s%s\r\n", w.subject, w.inbox, len(header), len(header)+len(payload), header, payload); err != nil {
+		return err
+	}
+	for {
+		line, err := w.readLine()
+		if err != nil {
+			return err
+		}
+		switch op, args, _ := strings.Cut(line, " "); strings.ToUpper(op) {
+		case "PING":
+			if _, err := fmt.Fprint(w.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case "-ERR":
+			return fmt.Errorf("nats error: %s", args)
+		case "MSG", "HMSG":
+			return w.ack(strings.ToUpper(op), strings.Fields(args))
+		}
+	}
+}
+
+// ack reads the reply of the stream, MSG <subject> <sid> <size> or HMSG <subject> <sid> <header size> <total size>.
+func (w *NATSWriter) ack(op string, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("invalid nats %s", op)
+	}
+	total, err := strconv.Atoi(args[len(args)-1])
+	if err != nil {
+		return fmt.Errorf("invalid nats %s: %w", op, err)
+	}
+	headerSize := 0
+	if op == "HMSG" {
+		if headerSize, err = strconv.Atoi(args[len(args)-2]); err != nil {
+			return fmt.Errorf("invalid nats %s: %w", op, err)
+		}
+	}
+	msg := make([]byte, total+2)
+	if _, err := io.ReadFull(w.reader, msg); err != nil {
+		return err
+	}
+	header, body := string(msg[:headerSize]), msg[headerSize:total]
+	if strings.HasPrefix(header, "NATS/1.0 503") {
+		return fmt.Errorf("no stream captures the subject %s", w.subject)
+	}
+	var reply struct {
+		Stream string `json:"stream"`
+		Error  *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return fmt.Errorf("invalid jetstream ack: %w", err)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("jetstream error: %s", reply.Error.Description)
+	}
+	return nil
+}
+
+// dial connects and subscribes to the inbox receiving the acks.
+func (w *NATSWriter) dial(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, natsTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", w.address.Host)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	w.reader = bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+
+	line, err := w.readLine()
+	if err != nil {
+		return err
+	}
+	op, infoJSON, _ := strings.Cut(line, " ")
+	if op != "INFO" {
+		return fmt.Errorf("unexpected nats greeting %q", op)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		return fmt.Errorf("invalid nats info: %w", err)
+	}
+	if w.tlsConfig != nil || info.TLSRequired || w.address.Scheme == "tls" {
+		tlsConfig := w.tlsConfig.Clone()
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = w.address.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		w.conn = tlsConn
+		w.reader = bufio.NewReader(tlsConn)
+		w.connect["tls_required"] = true
+	}
+
+	connect, err := json.Marshal(w.connect)
+	if err != nil {
+		return err
+	}
+	w.inbox = "_INBOX.nacp." + randomID()
+	if _, err := fmt.Fprintf(w.conn, "CONNECT %s\r\nPING\r\nSUB %s 1\r\n", connect, w.inbox); err != nil {
+		return err
+	}
+	for {
+		line, err := w.readLine()
+		if err != nil {
+			return err
+		}
+		switch op, args, _ := strings.Cut(line, " "); strings.ToUpper(op) {
+		case "PONG":
+			return nil
+		case "-ERR":
+			return fmt.Errorf("nats error: %s", args)
+		}
+	}
+}
+
+func (w *NATSWriter) readLine() (string, error) {
+	line, err := w.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (w *NATSWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	w.reader = nil
+	return err
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
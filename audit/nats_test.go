@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type natsPublish struct {
+	connect map[string]interface{}
+	subject string
+	header  string
+	payload string
+}
+
+// fakeNATS accepts one connection, answers the handshake and replies to the first publish with reply.
+func fakeNATS(t *testing.T, reply func(inbox string) string) (*url.URL, <-chan natsPublish) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	published := make(chan natsPublish, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"headers\":true}\r\n")
+		r := bufio.NewReader(conn)
+		var p natsPublish
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+			switch op {
+			case "CONNECT":
+				_ = json.Unmarshal([]byte(args), &p.connect)
+			case "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case "HPUB":
+				fields := strings.Fields(args)
+				headerSize, _ := strconv.Atoi(fields[2])
+				total, _ := strconv.Atoi(fields[3])
+				msg := make([]byte, total+2)
+				if _, err := io.ReadFull(r, msg); err != nil {
+					return
+				}
+				p.subject = fields[0]
+				p.header = string(msg[:headerSize])
+				p.payload = string(msg[headerSize:total])
+				// the server may ping at any time
+				fmt.Fprint(conn, "PING\r\n")
+				fmt.Fprint(conn, reply(fields[1]))
+				published <- p
+			}
+		}
+	}()
+	return &url.URL{Scheme: "nats", Host: listener.Addr().String()}, published
+}
+
+func TestNATSWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   func(inbox string) string
+		wantErr string
+	}{
+		{
+			name: "acked",
+			reply: func(inbox string) string {
+				ack := `{"stream":"NACP","seq":1}`
+				return fmt.Sprintf("MSG %s 1 %d\r\n%s\r\n", inbox, len(ack), ack)
+			},
+		},
+		{
+			name: "jetstream error",
+			reply: func(inbox string) string {
+				ack := `{"error":{"code":503,"description":"insufficient resources"}}`
+				return fmt.Sprintf("MSG %s 1 %d\r\n%s\r\n", inbox, len(ack), ack)
+			},
+			wantErr: "jetstream error: insufficient resources",
+		},
+		{
+			name: "no stream",
+			reply: func(inbox string) string {
+				header := "NATS/1.0 503\r\n\r\n"
+				return fmt.Sprintf("HMSG %s 1 %d %d\r\n%s\r\n", inbox, len(header), len(header), header)
+			},
+			wantErr: "no stream captures the subject nacp.decisions",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, published := fakeNATS(t, tt.reply)
+			w := NewNATSWriter(address, "nacp.decisions", nil, "", "", "s3cr3t", "1.2.3")
+			defer w.Close()
+
+			err := w.Write(context.Background(), testDecision)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, w.conn, "the connection is reset after an error")
+			} else {
+				require.NoError(t, err)
+			}
+
+			p := <-published
+			assert.Equal(t, "s3cr3t", p.connect["auth_token"])
+			assert.Equal(t, true, p.connect["headers"])
+			assert.Equal(t, "nacp.decisions", p.subject)
+			assert.Regexp(t, `^NATS/1.0\r\nNats-Msg-Id: [0-9a-f]{32}\r\n\r\n$`, p.header)
+			var d admissionctrl.Decision
+			require.NoError(t, json.Unmarshal([]byte(p.payload), &d))
+			assert.Equal(t, "costcenter", d.Rule)
+		})
+	}
+}
+
+func TestNATSWriter_FailsWithoutServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	w := NewNATSWriter(&url.URL{Scheme: "nats", Host: address}, "nacp.decisions", nil, "", "", "", "dev")
+	assert.ErrorContains(t, w.Write(context.Background(), testDecision), "failed to connect to "+address)
+}
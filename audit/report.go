@@ -0,0 +1,237 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+const (
+	// maxReasons bounds the distinct denial reasons counted per rule, further ones are counted as otherReason
+	maxReasons  = 1000
+	otherReason = "(other)"
+	postTimeout = 10 * time.Second
+)
+
+// Count is a value with the number of its occurrences.
+type Count struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// RuleReport summarizes the decisions of one rule.
+type RuleReport struct {
+	Kind      string `json:"kind"`
+	Rule      string `json:"rule"`
+	Evaluated int64  `json:"evaluated"`
+	Warned    int64  `json:"warned"`
+	Rejected  int64  `json:"rejected"`
+	// TopReasons are the most frequent errors of the rejections
+	TopReasons []Count `json:"top_denial_reasons,omitempty"`
+	// TopNamespaces are the namespaces with the most rejections
+	TopNamespaces []Count `json:"top_offending_namespaces,omitempty"`
+	// SampleJobs are <namespace>/<job> of rejected jobs, sampled uniformly from all rejections
+	SampleJobs []string `json:"sample_jobs,omitempty"`
+}
+
+// Report summarizes the decisions of one replica in a period.
+type Report struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Replica string       `json:"replica"`
+	Rules   []RuleReport `json:"rules"`
+}
+
+type ruleStats struct {
+	kind, rule                  string
+	evaluated, warned, rejected int64
+	reasons, namespaces         map[string]int64
+	samples                     []string
+}
+
+// Reporter aggregates the decisions and periodically logs a report or posts it to a webhook.
+type Reporter struct {
+	interval time.Duration
+	webhook  string
+	top      int
+	client   *http.Client
+	logger   hclog.Logger
+	replica  string
+
+	mu    sync.Mutex
+	from  time.Time
+	rules map[string]*ruleStats
+}
+
+// NewReporter creates a reporter, the report is only logged if webhook is empty.
+func NewReporter(interval time.Duration, webhook string, top int, client *http.Client, logger hclog.Logger) *Reporter {
+	replica, _ := os.Hostname()
+	return &Reporter{
+		interval: interval,
+		webhook:  webhook,
+		top:      top,
+		client:   client,
+		logger:   logger,
+		replica:  replica,
+		from:     time.Now(),
+		rules:    map[string]*ruleStats{},
+	}
+}
+
+func (r *Reporter) Record(d admissionctrl.Decision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := d.Kind + "/" + d.Rule
+	stats, ok := r.rules[key]
+	if !ok {
+		stats = &ruleStats{kind: d.Kind, rule: d.Rule, reasons: map[string]int64{}, namespaces: map[string]int64{}}
+		r.rules[key] = stats
+	}
+	stats.evaluated++
+	switch d.Decision {
+	case "warned":
+		stats.warned++
+	case "rejected":
+		stats.rejected++
+		stats.namespaces[d.Namespace]++
+		r.sample(stats, eventKey(d))
+		for _, reason := range d.Errors {
+			if _, ok := stats.reasons[reason]; !ok && len(stats.reasons) >= maxReasons {
+				reason = otherReason
+			}
+			stats.reasons[reason]++
+		}
+	}
+}
+
+// sample keeps a uniform sample of the rejected jobs (reservoir sampling).
+func (r *Reporter) sample(stats *ruleStats, job string) {
+	if len(stats.samples) < r.top {
+		stats.samples = append(stats.samples, job)
+		return
+	}
+	if i := rand.Int63n(stats.rejected); i < int64(r.top) {
+		stats.samples[i] = job
+	}
+}
+
+// Run sends a report every interval until the context is done.
+func (r *Reporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.send(ctx, r.Flush())
+		}
+	}
+}
+
+// Flush returns the report since the last flush and starts a new period.
+func (r *Reporter) Flush() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	report := Report{From: r.from, To: now, Replica: r.replica, Rules: []RuleReport{}}
+	for _, stats := range r.rules {
+		report.Rules = append(report.Rules, RuleReport{
+			Kind:          stats.kind,
+			Rule:          stats.rule,
+			Evaluated:     stats.evaluated,
+			Warned:        stats.warned,
+			Rejected:      stats.rejected,
+			TopReasons:    topCounts(stats.reasons, r.top),
+			TopNamespaces: topCounts(stats.namespaces, r.top),
+			SampleJobs:    stats.samples,
+		})
+	}
+	// the rules rejecting most jobs first
+	sort.Slice(report.Rules, func(i, j int) bool {
+		a, b := report.Rules[i], report.Rules[j]
+		if a.Rejected != b.Rejected {
+			return a.Rejected > b.Rejected
+		}
+		if a.Warned != b.Warned {
+			return a.Warned > b.Warned
+		}
+		return a.Kind+a.Rule < b.Kind+b.Rule
+	})
+	r.from = now
+	r.rules = map[string]*ruleStats{}
+	return report
+}
+
+func (r *Reporter) send(ctx context.Context, report Report) {
+	if r.webhook == "" {
+		r.log(report)
+		return
+	}
+	if err := r.post(ctx, report); err != nil {
+		r.logger.Error("Failed to post decision report, logging it instead", "webhook", r.webhook, "error", err)
+		r.log(report)
+	}
+}
+
+func (r *Reporter) log(report Report) {
+	r.logger.Info("Decision report", "from", report.From, "to", report.To, "rules", len(report.Rules))
+	for _, rule := range report.Rules {
+		r.logger.Info("Rule report", "kind", rule.Kind, "rule", rule.Rule, "evaluated", rule.Evaluated, "warned", rule.Warned, "rejected", rule.Rejected,
+			"top_denial_reasons", rule.TopReasons, "top_offending_namespaces", rule.TopNamespaces, "sample_jobs", rule.SampleJobs)
+	}
+}
+
+func (r *Reporter) post(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, postTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// topCounts returns the n most frequent values, ties are ordered by value.
+func topCounts(counts map[string]int64, n int) []Count {
+	top := make([]Count, 0, len(counts))
+	for value, count := range counts {
+		top = append(top, Count{Value: value, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Value < top[j].Value
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	if len(top) == 0 {
+		return nil
+	}
+	return top
+}
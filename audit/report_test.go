@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rejection(rule, namespace, job, reason string) admissionctrl.Decision {
+	return admissionctrl.Decision{Kind: "validator", Rule: rule, Decision: "rejected", Namespace: namespace, JobID: job, Errors: []string{reason}}
+}
+
+func TestReporter_Flush(t *testing.T) {
+	r := NewReporter(time.Hour, "", 2, http.DefaultClient, hclog.NewNullLogger())
+	r.Record(admissionctrl.Decision{Kind: "mutator", Rule: "meta", Decision: "warned"})
+	r.Record(admissionctrl.Decision{Kind: "validator", Rule: "costcenter", Decision: "accepted"})
+	r.Record(rejection("costcenter", "team-a", "web", "missing costcenter"))
+	r.Record(rejection("costcenter", "team-a", "api", "missing costcenter"))
+	r.Record(rejection("costcenter", "team-b", "db", "unknown costcenter"))
+	r.Record(rejection("costcenter", "team-c", "cache", "invalid costcenter"))
+
+	report := r.Flush()
+	assert.False(t, report.To.Before(report.From))
+	require.Len(t, report.Rules, 2)
+
+	costcenter := report.Rules[0]
+	assert.Equal(t, "costcenter", costcenter.Rule, "the rule rejecting most jobs comes first")
+	assert.Equal(t, int64(5), costcenter.Evaluated)
+	assert.Equal(t, int64(4), costcenter.Rejected)
+	assert.Equal(t, []Count{{"missing costcenter", 2}, {"invalid costcenter", 1}}, costcenter.TopReasons)
+	assert.Equal(t, []Count{{"team-a", 2}, {"team-b", 1}}, costcenter.TopNamespaces)
+	assert.Len(t, costcenter.SampleJobs, 2)
+	assert.Subset(t, []string{"team-a/web", "team-a/api", "team-b/db", "team-c/cache"}, costcenter.SampleJobs)
+
+	assert.Equal(t, RuleReport{Kind: "mutator", Rule: "meta", Evaluated: 1, Warned: 1}, report.Rules[1])
+
+	next := r.Flush()
+	assert.Empty(t, next.Rules, "a flush starts a new period")
+	assert.Equal(t, report.To, next.From)
+}
+
+func TestReporter_BoundsReasons(t *testing.T) {
+	r := NewReporter(time.Hour, "", 1, http.DefaultClient, hclog.NewNullLogger())
+	for i := 0; i < maxReasons+10; i++ {
+		r.Record(rejection("costcenter", "default", "web", fmt.Sprintf("reason %d", i)))
+	}
+	r.Record(rejection("costcenter", "default", "web", "reason 1"))
+	stats := r.rules["validator/costcenter"]
+	assert.Len(t, stats.reasons, maxReasons+1)
+	assert.Equal(t, int64(10), stats.reasons[otherReason])
+	assert.Equal(t, int64(2), stats.reasons["reason 1"], "known reasons are still counted")
+}
+
+func TestReporter_Send(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{name: "posted", status: http.StatusNoContent},
+		{name: "webhook fails", status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received Report
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			r := NewReporter(time.Hour, server.URL, 5, server.Client(), hclog.NewNullLogger())
+			r.Record(rejection("costcenter", "team-a", "web", "missing costcenter"))
+			report := r.Flush()
+			if tt.status >= 300 {
+				assert.ErrorContains(t, r.post(context.Background(), report), "webhook returned 500")
+			}
+			r.send(context.Background(), report)
+
+			require.Len(t, received.Rules, 1)
+			assert.Equal(t, int64(1), received.Rules[0].Rejected)
+			assert.Equal(t, []string{"team-a/web"}, received.Rules[0].SampleJobs)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+const (
+	vendor        = "mxab"
+	product       = "nacp"
+	syslogTimeout = 10 * time.Second
+)
+
+// Formatter renders a decision as the message of a syslog event.
+type Formatter func(d admissionctrl.Decision, version string) string
+
+// syslogSeverity maps the decisions to syslog severities: warning, notice and informational.
+var syslogSeverity = map[string]int{"rejected": 4, "warned": 5, "accepted": 6}
+
+// cefSeverity maps the decisions to the CEF severities from 0 to 10.
+var cefSeverity = map[string]int{"rejected": 7, "warned": 4, "accepted": 1}
+
+// SyslogWriter sends decisions as RFC 5424 messages over TCP or TLS, framed by octet counting (RFC 6587).
+type SyslogWriter struct {
+	address   string
+	tlsConfig *tls.Config
+	facility  int
+	format    Formatter
+	version   string
+	hostname  string
+
+	conn net.Conn
+}
+
+// NewSyslogWriter connects lazily to the address, with TLS if tlsConfig is set.
+func NewSyslogWriter(address string, tlsConfig *tls.Config, facility int, format Formatter, version string) *SyslogWriter {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &SyslogWriter{
+		address:   address,
+		tlsConfig: tlsConfig,
+		facility:  facility,
+		format:    format,
+		version:   version,
+		hostname:  hostname,
+	}
+}
+
+func (w *SyslogWriter) Write(ctx context.Context, d admissionctrl.Decision) error {
+	if w.conn == nil {
+		conn, err := w.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", w.address, err)
+		}
+		w.conn = conn
+	}
+	msg := w.message(d)
+	w.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := fmt.Fprintf(w.conn, "%d %s", len(msg), msg); err != nil {
+		// reconnect on the next write, the receiver may have closed the connection
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *SyslogWriter) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, syslogTimeout)
+	defer cancel()
+	if w.tlsConfig != nil {
+		dialer := &tls.Dialer{Config: w.tlsConfig}
+		return dialer.DialContext(ctx, "tcp", w.address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", w.address)
+}
+
+func (w *SyslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// message is <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG.
+func (w *SyslogWriter) message(d admissionctrl.Decision) string {
+	priority := w.facility*8 + syslogSeverity[d.Decision]
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s", priority, d.Time.UTC().Format(time.RFC3339Nano), w.hostname, product, os.Getpid(), w.format(d, w.version))
+}
+
+// FormatCEF renders a decision in the ArcSight Common Event Format.
+func FormatCEF(d admissionctrl.Decision, version string) string {
+	header := []string{
+		"CEF:0",
+		cefHeader(vendor),
+		cefHeader(product),
+		cefHeader(version),
+		cefHeader(d.Kind + "-" + d.Decision),
+		cefHeader(fmt.Sprintf("Job %s by %s %s", d.Decision, d.Kind, d.Rule)),
+		strconv.Itoa(cefSeverity[d.Decision]),
+	}
+	var ext []string
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefValue(value))
+		}
+	}
+	add("rt", strconv.FormatInt(d.Time.UnixMilli(), 10))
+	add("act", d.Decision)
+	add("cs1Label", "rule")
+	add("cs1", d.Rule)
+	add("cs2Label", "ruleVersion")
+	add("cs2", d.Version)
+	add("cs3Label", "namespace")
+	add("cs3", d.Namespace)
+	add("cs4Label", "job")
+	add("cs4", d.JobID)
+	add("reason", d.ErrorCode)
+	if ctx := d.Context; ctx != nil {
+		add("cs5Label", "operation")
+		add("cs5", ctx.Operation)
+		add("suser", submitter(d))
+		add("suid", ctx.AccessorID)
+		if net.ParseIP(ctx.ClientIP) != nil {
+			add("src", ctx.ClientIP)
+		}
+		add("requestMethod", ctx.Method)
+		add("request", ctx.Path)
+	}
+	add("msg", message(d))
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+// FormatLEEF renders a decision in the IBM QRadar Log Event Extended Format 2.0 with tab separated attributes.
+func FormatLEEF(d admissionctrl.Decision, version string) string {
+	header := []string{
+		"LEEF:2.0",
+		leefHeader(vendor),
+		leefHeader(product),
+		leefHeader(version),
+		leefHeader(d.Kind + "-" + d.Decision),
+		"x09",
+		"",
+	}
+	var attrs []string
+	add := func(key, value string) {
+		if value != "" {
+			attrs = append(attrs, key+"="+leefValue(value))
+		}
+	}
+	add("devTime", d.Time.UTC().Format("Jan 02 2006 15:04:05.000 MST"))
+	add("devTimeFormat", "MMM dd yyyy HH:mm:ss.SSS z")
+	add("cat", d.Kind)
+	add("sev", strconv.Itoa(cefSeverity[d.Decision]))
+	add("action", d.Decision)
+	add("policy", d.Rule)
+	add("policyVersion", d.Version)
+	add("namespace", d.Namespace)
+	add("resource", d.JobID)
+	add("reason", d.ErrorCode)
+	if ctx := d.Context; ctx != nil {
+		add("operation", ctx.Operation)
+		add("usrName", submitter(d))
+		add("accessorID", ctx.AccessorID)
+		if net.ParseIP(ctx.ClientIP) != nil {
+			add("src", ctx.ClientIP)
+		}
+		add("method", ctx.Method)
+		add("url", ctx.Path)
+	}
+	add("msg", message(d))
+	return strings.Join(header, "|") + strings.Join(attrs, "\t")
+}
+
+// submitter is the resolved identity, or the name of the Nomad token.
+func submitter(d admissionctrl.Decision) string {
+	if d.Context.Identity != "" {
+		return d.Context.Identity
+	}
+	if d.Context.TokenInfo != nil {
+		return d.Context.TokenInfo.Name
+	}
+	return ""
+}
+
+// message joins the errors of a rejection or the warnings.
+func message(d admissionctrl.Decision) string {
+	if len(d.Errors) > 0 {
+		return strings.Join(d.Errors, "; ")
+	}
+	return strings.Join(d.Warnings, "; ")
+}
+
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func leefHeader(s string) string {
+	return strings.NewReplacer("|", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// leefValue replaces the attribute delimiter and line breaks, LEEF has no escaping.
+func leefValue(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
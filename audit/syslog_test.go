@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDecision = admissionctrl.Decision{
+	Time:      time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC),
+	Kind:      "validator",
+	Rule:      "costcenter",
+	Version:   "ab12",
+	Decision:  "rejected",
+	Namespace: "team-a",
+	JobID:     "web",
+	Errors:    []string{"missing meta costcenter=", "pipe | and\nnewline"},
+	Context: &config.RequestContext{
+		Operation:  "register",
+		ClientIP:   "10.0.0.7",
+		AccessorID: "8a1f",
+		TokenInfo:  &api.ACLToken{Name: "ci"},
+		Method:     "PUT",
+		Path:       "/v1/jobs",
+	},
+}
+
+func TestFormatCEF(t *testing.T) {
+	assert.Equal(t,
+		`CEF:0|mxab|nacp|1.2.3|validator-rejected|Job rejected by validator costcenter|7|`+
+			`rt=1772368200000 act=rejected cs1Label=rule cs1=costcenter cs2Label=ruleVersion cs2=ab12 `+
+			`cs3Label=namespace cs3=team-a cs4Label=job cs4=web cs5Label=operation cs5=register suser=ci suid=8a1f `+
+			`src=10.0.0.7 requestMethod=PUT request=/v1/jobs msg=missing meta costcenter\=; pipe | and\nnewline`,
+		FormatCEF(testDecision, "1.2.3"))
+}
+
+func TestFormatCEF_EscapesHeader(t *testing.T) {
+	d := admissionctrl.Decision{Kind: "validator", Rule: `a|b\c`, Decision: "accepted"}
+	assert.True(t, strings.HasPrefix(FormatCEF(d, "dev"), `CEF:0|mxab|nacp|dev|validator-accepted|Job accepted by validator a\|b\\c|1|`))
+}
+
+func TestFormatLEEF(t *testing.T) {
+	assert.Equal(t,
+		"LEEF:2.0|mxab|nacp|1.2.3|validator-rejected|x09|"+
+			"devTime=Mar 01 2026 12:30:00.000 UTC\tdevTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tcat=validator\tsev=7\t"+
+			"action=rejected\tpolicy=costcenter\tpolicyVersion=ab12\tnamespace=team-a\tresource=web\toperation=register\t"+
+			"usrName=ci\taccessorID=8a1f\tsrc=10.0.0.7\tmethod=PUT\turl=/v1/jobs\tmsg=missing meta costcenter=; pipe | and newline",
+		FormatLEEF(testDecision, "1.2.3"))
+}
+
+// readFrame reads one octet counted syslog message.
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	length, err := r.ReadString(' ')
+	require.NoError(t, err)
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	require.NoError(t, err)
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r, msg)
+	require.NoError(t, err)
+	return string(msg)
+}
+
+func TestSyslogWriter(t *testing.T) {
+	tests := []struct {
+		name string
+		tls  bool
+	}{
+		{name: "tcp"},
+		{name: "tls", tls: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listener net.Listener
+			var clientTLS *tls.Config
+			var err error
+			if tt.tls {
+				// borrow the certificate of a httptest server, it is valid for 127.0.0.1
+				server := httptest.NewTLSServer(nil)
+				cert := server.TLS.Certificates[0]
+				pool := x509.NewCertPool()
+				pool.AddCert(server.Certificate())
+				server.Close()
+				clientTLS = &tls.Config{RootCAs: pool}
+				listener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+			} else {
+				listener, err = net.Listen("tcp", "127.0.0.1:0")
+			}
+			require.NoError(t, err)
+			defer listener.Close()
+
+			w := NewSyslogWriter(listener.Addr().String(), clientTLS, 16, FormatCEF, "1.2.3")
+			w.hostname = "nacp-1"
+			defer w.Close()
+
+			received := make(chan []string, 1)
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				received <- []string{readFrame(t, r), readFrame(t, r)}
+			}()
+
+			accepted := testDecision
+			accepted.Decision = "accepted"
+			require.NoError(t, w.Write(context.Background(), testDecision))
+			require.NoError(t, w.Write(context.Background(), accepted))
+
+			select {
+			case msgs := <-received:
+				assert.True(t, strings.HasPrefix(msgs[0], "<132>1 2026-03-01T12:30:00Z nacp-1 nacp "), msgs[0])
+				assert.Contains(t, msgs[0], " - - CEF:0|mxab|nacp|1.2.3|validator-rejected|")
+				assert.True(t, strings.HasPrefix(msgs[1], "<134>1 "), msgs[1])
+			case <-time.After(5 * time.Second):
+				t.Fatal("no messages received")
+			}
+		})
+	}
+}
+
+func TestSyslogWriter_FailsWithoutReceiver(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	w := NewSyslogWriter(address, nil, 16, FormatCEF, "dev")
+	assert.ErrorContains(t, w.Write(context.Background(), testDecision), "failed to connect to "+address)
+}
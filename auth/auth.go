@@ -0,0 +1,288 @@
+// Package auth logs in browser users with OIDC in front of the Nomad UI
+// and sends the Nomad token of their session upstream.
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/metrics"
+	"golang.org/x/oauth2"
+)
+
+const (
+	PathPrefix   = "/v1/nacp/auth/"
+	LoginPath    = PathPrefix + "login"
+	CallbackPath = PathPrefix + "callback"
+	LogoutPath   = PathPrefix + "logout"
+
+	sessionCookie = "nacp_session"
+	stateCookie   = "nacp_auth_state"
+	defaultNext   = "/ui/"
+	tokenHeader   = "X-Nomad-Token"
+)
+
+// User is the verified identity of a session.
+type User struct {
+	Identity string
+	Groups   []string
+	// IDToken is the raw ID token, e.g. for a token exchange
+	IDToken string
+}
+
+type contextKeyUser struct{}
+
+// UserFromContext returns the user of the session the request was sent with.
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(contextKeyUser{}).(User)
+	return user, ok
+}
+
+type Config struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	IdentityClaim string
+	GroupsClaim   string
+	SessionTTL    time.Duration
+}
+
+// Authenticator handles the OIDC flow and the sessions of the browser users.
+type Authenticator struct {
+	oauth         oauth2.Config
+	verifier      *oidc.IDTokenVerifier
+	identityClaim string
+	groupsClaim   string
+	sessionTTL    time.Duration
+	secure        bool
+	tokens        TokenSource
+	sessions      *Sessions
+	logger        hclog.Logger
+}
+
+// NewAuthenticator discovers the endpoints of the issuer.
+func NewAuthenticator(ctx context.Context, c Config, tokens TokenSource, logger hclog.Logger) (*Authenticator, error) {
+	provider, err := oidc.NewProvider(ctx, c.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc issuer %s: %w", c.Issuer, err)
+	}
+	return &Authenticator{
+		oauth: oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       c.Scopes,
+		},
+		verifier:      provider.Verifier(&oidc.Config{ClientID: c.ClientID}),
+		identityClaim: c.IdentityClaim,
+		groupsClaim:   c.GroupsClaim,
+		sessionTTL:    c.SessionTTL,
+		secure:        strings.HasPrefix(c.RedirectURL, "https://"),
+		tokens:        tokens,
+		sessions:      NewSessions(),
+		logger:        logger,
+	}, nil
+}
+
+// Handler serves the login, callback and logout endpoints below PathPrefix.
+func (a *Authenticator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+LoginPath, a.login)
+	mux.HandleFunc("GET "+CallbackPath, a.callback)
+	mux.HandleFunc("POST "+LogoutPath, a.logout)
+	return mux
+}
+
+// Middleware sends the Nomad token of the session upstream. Requests with an own token are passed through,
+// page loads without a session are redirected to the login, other requests continue anonymously.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(tokenHeader) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if session, ok := a.session(r); ok {
+			r = r.Clone(context.WithValue(r.Context(), contextKeyUser{}, session.User))
+			r.Header.Set(tokenHeader, session.Token)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, LoginPath+"?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Authenticator) session(r *http.Request) (Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return Session{}, false
+	}
+	return a.sessions.Get(cookie.Value)
+}
+
+// loginState is kept in a cookie during the login, the state parameter protects the callback against CSRF.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+}
+
+func (a *Authenticator) login(w http.ResponseWriter, r *http.Request) {
+	state, err := randomString(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ls := loginState{State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier(), Next: safeNext(r.URL.Query().Get("next"))}
+	data, err := json.Marshal(ls)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.setCookie(w, stateCookie, base64.RawURLEncoding.EncodeToString(data), 10*time.Minute)
+	http.Redirect(w, r, a.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(ls.Verifier)), http.StatusFound)
+}
+
+func (a *Authenticator) callback(w http.ResponseWriter, r *http.Request) {
+	ls, err := readLoginState(r)
+	a.setCookie(w, stateCookie, "", -1)
+	if err != nil || ls.State != r.URL.Query().Get("state") {
+		a.fail(w, http.StatusBadRequest, "invalid login state", err)
+		return
+	}
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		a.fail(w, http.StatusUnauthorized, "login was denied by the identity provider", errors.New(reason))
+		return
+	}
+	user, err := a.verify(r.Context(), r.URL.Query().Get("code"), ls)
+	if err != nil {
+		a.fail(w, http.StatusUnauthorized, "login failed", err)
+		return
+	}
+	token, tokenExpires, err := a.tokens.Token(r.Context(), user)
+	if err != nil {
+		a.fail(w, http.StatusForbidden, "no nomad access for "+user.Identity, err)
+		return
+	}
+	expires := time.Now().Add(a.sessionTTL)
+	if !tokenExpires.IsZero() && tokenExpires.Before(expires) {
+		expires = tokenExpires
+	}
+	id, err := a.sessions.Create(Session{User: user, Token: token, Expires: expires})
+	if err != nil {
+		a.fail(w, http.StatusInternalServerError, "failed to create session", err)
+		return
+	}
+	metrics.AuthLogins.WithLabelValues("success").Inc()
+	a.logger.Info("User logged in", "identity", user.Identity, "expires", expires)
+	a.setCookie(w, sessionCookie, id, time.Until(expires))
+	http.Redirect(w, r, ls.Next, http.StatusFound)
+}
+
+func (a *Authenticator) verify(ctx context.Context, code string, ls loginState) (User, error) {
+	oauthToken, err := a.oauth.Exchange(ctx, code, oauth2.VerifierOption(ls.Verifier))
+	if err != nil {
+		return User{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok {
+		return User{}, fmt.Errorf("token response contains no id_token")
+	}
+	idToken, err := a.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return User{}, err
+	}
+	if idToken.Nonce != ls.Nonce {
+		return User{}, fmt.Errorf("nonce of the id token does not match")
+	}
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return User{}, err
+	}
+	identity, _ := claims[a.identityClaim].(string)
+	if identity == "" {
+		return User{}, fmt.Errorf("id token has no %s claim", a.identityClaim)
+	}
+	var groups []string
+	if values, ok := claims[a.groupsClaim].([]interface{}); ok {
+		for _, v := range values {
+			if group, ok := v.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+	}
+	return User{Identity: identity, Groups: groups, IDToken: rawIDToken}, nil
+}
+
+func (a *Authenticator) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		a.sessions.Delete(cookie.Value)
+	}
+	a.setCookie(w, sessionCookie, "", -1)
+	http.Redirect(w, r, defaultNext, http.StatusFound)
+}
+
+func (a *Authenticator) fail(w http.ResponseWriter, status int, msg string, err error) {
+	metrics.AuthLogins.WithLabelValues("failure").Inc()
+	a.logger.Warn("Login failed", "reason", msg, "error", err)
+	http.Error(w, msg, status)
+}
+
+func (a *Authenticator) setCookie(w http.ResponseWriter, name, value string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   a.secure,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(maxAge.Seconds()),
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+func readLoginState(r *http.Request) (loginState, error) {
+	var ls loginState
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil {
+		return ls, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return ls, err
+	}
+	err = json.Unmarshal(data, &ls)
+	return ls, err
+}
+
+// safeNext only allows local paths as target after the login.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return defaultNext
+	}
+	return next
+}
@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIssuer issues ID tokens for the nonce of the last authorization request.
+type fakeIssuer struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	nonce  string
+	claims map[string]interface{}
+}
+
+func newFakeIssuer(t *testing.T, claims map[string]interface{}) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	issuer := &fakeIssuer{key: key, claims: claims}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.URL,
+			"authorization_endpoint":                issuer.URL + "/authorize",
+			"token_endpoint":                        issuer.URL + "/token",
+			"jwks_uri":                              issuer.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "valid" || r.FormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     issuer.idToken(t),
+		})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (i *fakeIssuer) idToken(t *testing.T) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: i.key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+	require.NoError(t, err)
+	claims := map[string]interface{}{
+		"iss":   i.URL,
+		"aud":   "nacp",
+		"sub":   "1234",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": i.nonce,
+	}
+	for k, v := range i.claims {
+		claims[k] = v
+	}
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed, err := signer.Sign(payload)
+	require.NoError(t, err)
+	raw, err := signed.CompactSerialize()
+	require.NoError(t, err)
+	return raw
+}
+
+func newTestAuthenticator(t *testing.T, issuer *fakeIssuer) *Authenticator {
+	t.Helper()
+	a, err := NewAuthenticator(context.Background(), Config{
+		Issuer:        issuer.URL,
+		ClientID:      "nacp",
+		ClientSecret:  "secret",
+		RedirectURL:   "http://nacp.example.com" + CallbackPath,
+		Scopes:        []string{"openid"},
+		IdentityClaim: "email",
+		GroupsClaim:   "groups",
+		SessionTTL:    time.Hour,
+	}, StaticTokens{{Name: "ops", Groups: []string{"ops"}, Token: "ops-token"}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	return a
+}
+
+// login runs the login until the callback and returns its response.
+func login(t *testing.T, a *Authenticator, issuer *fakeIssuer, code string) *http.Response {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, LoginPath+"?next=/ui/jobs", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+	authorize, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, issuer.URL+"/authorize", authorize.Scheme+"://"+authorize.Host+authorize.Path)
+	assert.Equal(t, "S256", authorize.Query().Get("code_challenge_method"))
+	issuer.nonce = authorize.Query().Get("nonce")
+
+	req := httptest.NewRequest(http.MethodGet, CallbackPath+"?code="+code+"&state="+authorize.Query().Get("state"), nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func sessionCookieOf(resp *http.Response) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookie && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestLogin(t *testing.T) {
+	tt := []struct {
+		name       string
+		claims     map[string]interface{}
+		code       string
+		wantStatus int
+	}{
+		{name: "mapped group", claims: map[string]interface{}{"email": "jane@example.com", "groups": []string{"dev", "ops"}}, code: "valid", wantStatus: http.StatusFound},
+		{name: "unmapped user", claims: map[string]interface{}{"email": "joe@example.com", "groups": []string{"dev"}}, code: "valid", wantStatus: http.StatusForbidden},
+		{name: "missing identity claim", claims: map[string]interface{}{"groups": []string{"ops"}}, code: "valid", wantStatus: http.StatusUnauthorized},
+		{name: "invalid code", claims: map[string]interface{}{"email": "jane@example.com"}, code: "stolen", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			issuer := newFakeIssuer(t, tc.claims)
+			a := newTestAuthenticator(t, issuer)
+
+			resp := login(t, a, issuer, tc.code)
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			if tc.wantStatus != http.StatusFound {
+				assert.Nil(t, sessionCookieOf(resp))
+				return
+			}
+			assert.Equal(t, "/ui/jobs", resp.Header.Get("Location"))
+			cookie := sessionCookieOf(resp)
+			require.NotNil(t, cookie)
+			assert.True(t, cookie.HttpOnly)
+		})
+	}
+}
+
+func TestCallbackRejectsForeignState(t *testing.T) {
+	issuer := newFakeIssuer(t, map[string]interface{}{"email": "jane@example.com", "groups": []string{"ops"}})
+	a := newTestAuthenticator(t, issuer)
+
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, CallbackPath+"?code=valid&state=forged", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestMiddleware(t *testing.T) {
+	issuer := newFakeIssuer(t, map[string]interface{}{"email": "jane@example.com", "groups": []string{"ops"}})
+	a := newTestAuthenticator(t, issuer)
+	cookie := sessionCookieOf(login(t, a, issuer, "valid"))
+	require.NotNil(t, cookie)
+
+	tt := []struct {
+		name         string
+		token        string
+		cookie       *http.Cookie
+		accept       string
+		wantStatus   int
+		wantToken    string
+		wantIdentity string
+	}{
+		{name: "session token is injected", cookie: cookie, wantStatus: http.StatusOK, wantToken: "ops-token", wantIdentity: "jane@example.com"},
+		{name: "own token wins", token: "cli-token", cookie: cookie, wantStatus: http.StatusOK, wantToken: "cli-token"},
+		{name: "page load without session logs in", accept: "text/html", wantStatus: http.StatusFound},
+		{name: "api call without session is anonymous", accept: "application/json", wantStatus: http.StatusOK},
+		{name: "unknown session", cookie: &http.Cookie{Name: sessionCookie, Value: "guessed"}, wantStatus: http.StatusOK},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotToken, gotIdentity string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotToken = r.Header.Get(tokenHeader)
+				if user, ok := UserFromContext(r.Context()); ok {
+					gotIdentity = user.Identity
+				}
+			})
+			req := httptest.NewRequest(http.MethodGet, "/ui/jobs", nil)
+			if tc.token != "" {
+				req.Header.Set(tokenHeader, tc.token)
+			}
+			if tc.cookie != nil {
+				req.AddCookie(tc.cookie)
+			}
+			req.Header.Set("Accept", tc.accept)
+			rec := httptest.NewRecorder()
+
+			a.Middleware(next).ServeHTTP(rec, req)
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			assert.Equal(t, tc.wantToken, gotToken)
+			assert.Equal(t, tc.wantIdentity, gotIdentity)
+			if tc.wantStatus == http.StatusFound {
+				assert.Equal(t, LoginPath+"?next=%2Fui%2Fjobs", rec.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	issuer := newFakeIssuer(t, map[string]interface{}{"email": "jane@example.com", "groups": []string{"ops"}})
+	a := newTestAuthenticator(t, issuer)
+	cookie := sessionCookieOf(login(t, a, issuer, "valid"))
+	require.NotNil(t, cookie)
+
+	req := httptest.NewRequest(http.MethodGet, LogoutPath, nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	_, ok := a.sessions.Get(cookie.Value)
+	assert.True(t, ok, "only a POST ends the session")
+
+	req = httptest.NewRequest(http.MethodPost, LogoutPath, nil)
+	req.AddCookie(cookie)
+	a.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	_, ok = a.sessions.Get(cookie.Value)
+	assert.False(t, ok)
+}
+
+func TestSafeNext(t *testing.T) {
+	tt := []struct {
+		next string
+		want string
+	}{
+		{next: "/ui/jobs?namespace=*", want: "/ui/jobs?namespace=*"},
+		{next: "", want: defaultNext},
+		{next: "https://evil.example.com", want: defaultNext},
+		{next: "//evil.example.com", want: defaultNext},
+		{next: "/\\evil.example.com", want: defaultNext},
+	}
+	for _, tc := range tt {
+		t.Run(tc.next, func(t *testing.T) {
+			assert.Equal(t, tc.want, safeNext(tc.next))
+		})
+	}
+}
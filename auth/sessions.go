@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// Session of a logged in browser user.
+type Session struct {
+	User    User
+	Token   string
+	Expires time.Time
+}
+
+// Sessions are kept in memory, users have to log in again after a restart or on another replica without sticky sessions.
+type Sessions struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+	now      func() time.Time
+}
+
+func NewSessions() *Sessions {
+	return &Sessions{
+		sessions: map[string]Session{},
+		now:      time.Now,
+	}
+}
+
+// Create stores the session and returns its random ID, expired sessions are dropped.
+func (s *Sessions) Create(session Session) (string, error) {
+	id, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for existing, other := range s.sessions {
+		if !other.Expires.After(now) {
+			delete(s.sessions, existing)
+		}
+	}
+	s.sessions[id] = session
+	return id, nil
+}
+
+// Get returns the session if it exists and has not expired.
+func (s *Sessions) Get(id string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	if !session.Expires.After(s.now()) {
+		delete(s.sessions, id)
+		return Session{}, false
+	}
+	return session, true
+}
+
+func (s *Sessions) Delete(id string) {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
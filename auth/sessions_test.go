@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	sessions := NewSessions()
+	sessions.now = func() time.Time { return now }
+
+	expired, err := sessions.Create(Session{Token: "old", Expires: now.Add(time.Minute)})
+	require.NoError(t, err)
+	active, err := sessions.Create(Session{Token: "new", Expires: now.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.NotEqual(t, expired, active)
+
+	now = now.Add(2 * time.Minute)
+	_, ok := sessions.Get(expired)
+	assert.False(t, ok, "expired sessions are not returned")
+	session, ok := sessions.Get(active)
+	assert.True(t, ok)
+	assert.Equal(t, "new", session.Token)
+
+	sessions.Delete(active)
+	_, ok = sessions.Get(active)
+	assert.False(t, ok)
+}
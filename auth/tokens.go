@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+)
+
+// ErrNoToken is returned if no Nomad token is configured for a user.
+var ErrNoToken = errors.New("no nomad token for user")
+
+// TokenSource provides the Nomad token of a verified user.
+type TokenSource interface {
+	// Token returns the secret ID of the token and when it expires, the zero time if it doesn't.
+	Token(ctx context.Context, user User) (string, time.Time, error)
+}
+
+// StaticTokens maps identities and groups to configured tokens.
+type StaticTokens []config.TokenMapping
+
+func (s StaticTokens) Token(_ context.Context, user User) (string, time.Time, error) {
+	for _, mapping := range s {
+		if slices.Contains(mapping.Identities, user.Identity) {
+			return mapping.Token, time.Time{}, nil
+		}
+		for _, group := range user.Groups {
+			if slices.Contains(mapping.Groups, group) {
+				return mapping.Token, time.Time{}, nil
+			}
+		}
+	}
+	return "", time.Time{}, ErrNoToken
+}
+
+// NomadTokenExchange logs in to a Nomad JWT auth method with the ID token of the user,
+// the binding rules of the auth method decide the policies of the token.
+type NomadTokenExchange struct {
+	Client     *api.Client
+	AuthMethod string
+}
+
+func (e *NomadTokenExchange) Token(ctx context.Context, user User) (string, time.Time, error) {
+	token, _, err := e.Client.ACLAuth().Login(&api.ACLLoginRequest{
+		AuthMethodName: e.AuthMethod,
+		LoginToken:     user.IDToken,
+	}, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to exchange the id token at auth method %s: %w", e.AuthMethod, err)
+	}
+	var expires time.Time
+	if token.ExpirationTime != nil {
+		expires = *token.ExpirationTime
+	}
+	return token.SecretID, expires, nil
+}
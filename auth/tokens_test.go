@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticTokens(t *testing.T) {
+	tokens := StaticTokens{
+		{Name: "admins", Identities: []string{"jane@example.com"}, Token: "admin-token"},
+		{Name: "ops", Groups: []string{"ops", "sre"}, Token: "ops-token"},
+	}
+	tt := []struct {
+		name    string
+		user    User
+		want    string
+		wantErr error
+	}{
+		{name: "by identity", user: User{Identity: "jane@example.com", Groups: []string{"ops"}}, want: "admin-token"},
+		{name: "by group", user: User{Identity: "joe@example.com", Groups: []string{"dev", "sre"}}, want: "ops-token"},
+		{name: "unmapped", user: User{Identity: "joe@example.com", Groups: []string{"dev"}}, wantErr: ErrNoToken},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			token, expires, err := tokens.Token(context.Background(), tc.user)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.want, token)
+			assert.True(t, expires.IsZero())
+		})
+	}
+}
+
+func TestNomadTokenExchange(t *testing.T) {
+	expires := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/acl/login", r.URL.Path)
+		req := &api.ACLLoginRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		assert.Equal(t, "sso", req.AuthMethodName)
+		assert.Equal(t, "id-token", req.LoginToken)
+		_ = json.NewEncoder(w).Encode(&api.ACLToken{SecretID: "exchanged", ExpirationTime: &expires})
+	}))
+	defer nomad.Close()
+
+	client, err := api.NewClient(&api.Config{Address: nomad.URL})
+	require.NoError(t, err)
+	exchange := &NomadTokenExchange{Client: client, AuthMethod: "sso"}
+
+	token, gotExpires, err := exchange.Token(context.Background(), User{Identity: "jane@example.com", IDToken: "id-token"})
+	require.NoError(t, err)
+	assert.Equal(t, "exchanged", token)
+	assert.True(t, expires.Equal(gotExpires))
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/metrics"
+)
+
+var (
+	ErrUnknownRole   = errors.New("unknown role")
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrClaimMismatch = errors.New("claims do not match the role")
+	ErrPolicyDenied  = errors.New("denied by the policy of the role")
+)
+
+// VendingIssuer is a CI system issuing OIDC tokens, e.g. GitHub Actions or GitLab.
+type VendingIssuer struct {
+	Name     string
+	URL      string
+	Audience string
+}
+
+// VendingRole grants a Nomad token with its policies if the bound claims match the CI token.
+type VendingRole struct {
+	Name   string
+	Issuer string
+	// BoundClaims values are glob patterns
+	BoundClaims map[string]string
+	Policies    []string
+	TTL         time.Duration
+	// Policy decides on the exchange after the bound claims matched, optional
+	Policy ClaimsPolicy
+}
+
+// ClaimsPolicy decides whether the verified claims of a CI token are exchanged for a Nomad token with the policies,
+// e.g. an OPA policy of NACP.
+type ClaimsPolicy interface {
+	Authorize(ctx context.Context, subject string, claims map[string]interface{}, policies []string) error
+}
+
+// ACLTokenCreator creates Nomad ACL tokens, e.g. api.ACLTokens.
+type ACLTokenCreator interface {
+	Create(token *api.ACLToken, q *api.WriteOptions) (*api.ACLToken, *api.WriteMeta, error)
+}
+
+// TokenVendor exchanges verified CI tokens for short-lived Nomad tokens, so pipelines hold no long-lived tokens.
+type TokenVendor struct {
+	verifiers map[string]*oidc.IDTokenVerifier
+	roles     map[string]VendingRole
+	tokens    ACLTokenCreator
+	logger    hclog.Logger
+}
+
+// NewTokenVendor discovers the keys of the issuers.
+func NewTokenVendor(ctx context.Context, issuers []VendingIssuer, roles []VendingRole, tokens ACLTokenCreator, logger hclog.Logger) (*TokenVendor, error) {
+	v := &TokenVendor{
+		verifiers: map[string]*oidc.IDTokenVerifier{},
+		roles:     map[string]VendingRole{},
+		tokens:    tokens,
+		logger:    logger,
+	}
+	for _, issuer := range issuers {
+		provider, err := oidc.NewProvider(ctx, issuer.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover issuer %s: %w", issuer.Name, err)
+		}
+		v.verifiers[issuer.Name] = provider.Verifier(&oidc.Config{ClientID: issuer.Audience})
+	}
+	for _, role := range roles {
+		if _, ok := v.verifiers[role.Issuer]; !ok {
+			return nil, fmt.Errorf("role %s uses the unknown issuer %s", role.Name, role.Issuer)
+		}
+		v.roles[role.Name] = role
+	}
+	return v, nil
+}
+
+// Vend verifies the CI token and creates a client token with the policies of the role.
+func (v *TokenVendor) Vend(ctx context.Context, roleName, jwt string) (*api.ACLToken, error) {
+	label := roleName
+	if _, ok := v.roles[roleName]; !ok {
+		// keeps the cardinality of the metric bounded
+		label = "unknown"
+	}
+	token, err := v.vend(ctx, roleName, jwt)
+	if err != nil {
+		metrics.VendedTokens.WithLabelValues(label, "failure").Inc()
+		v.logger.Warn("Refused to vend token", "role", roleName, "error", err)
+		return nil, err
+	}
+	metrics.VendedTokens.WithLabelValues(label, "success").Inc()
+	return token, nil
+}
+
+func (v *TokenVendor) vend(ctx context.Context, roleName, jwt string) (*api.ACLToken, error) {
+	role, ok := v.roles[roleName]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRole, roleName)
+	}
+	idToken, err := v.verifiers[role.Issuer].Verify(ctx, jwt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if err := matchClaims(role.BoundClaims, claims); err != nil {
+		return nil, err
+	}
+	if role.Policy != nil {
+		if err := role.Policy.Authorize(ctx, idToken.Subject, claims, role.Policies); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrPolicyDenied, err)
+		}
+	}
+
+	created, _, err := v.tokens.Create(&api.ACLToken{
+		Name:          fmt.Sprintf("nacp %s: %s", role.Name, idToken.Subject),
+		Type:          "client",
+		Policies:      role.Policies,
+		ExpirationTTL: role.TTL,
+	}, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+	v.logger.Info("Vended token", "role", role.Name, "subject", idToken.Subject, "accessor_id", created.AccessorID, "expires", created.ExpirationTime)
+	return created, nil
+}
+
+func matchClaims(bound map[string]string, claims map[string]interface{}) error {
+	for name, pattern := range bound {
+		value, ok := claims[name]
+		if !ok {
+			return fmt.Errorf("%w: %s is missing", ErrClaimMismatch, name)
+		}
+		if matched, _ := path.Match(pattern, fmt.Sprint(value)); !matched {
+			return fmt.Errorf("%w: %s is %v", ErrClaimMismatch, name, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTokenCreator struct {
+	created *api.ACLToken
+}
+
+func (f *fakeTokenCreator) Create(token *api.ACLToken, _ *api.WriteOptions) (*api.ACLToken, *api.WriteMeta, error) {
+	f.created = token
+	created := *token
+	created.AccessorID = "accessor"
+	created.SecretID = "secret"
+	return &created, nil, nil
+}
+
+// denyingPolicy rejects every exchange and records the claims it was asked about.
+type denyingPolicy struct {
+	subject  string
+	claims   map[string]interface{}
+	policies []string
+}
+
+func (d *denyingPolicy) Authorize(_ context.Context, subject string, claims map[string]interface{}, policies []string) error {
+	d.subject, d.claims, d.policies = subject, claims, policies
+	return errors.New("main only")
+}
+
+func TestTokenVendor(t *testing.T) {
+	issuer := newFakeIssuer(t, map[string]interface{}{
+		"aud":        "nacp-ci",
+		"sub":        "repo:acme/app:ref:refs/heads/main",
+		"repository": "acme/app",
+		"ref":        "refs/heads/main",
+	})
+	roles := []VendingRole{
+		{Name: "deploy-app", Issuer: "github", BoundClaims: map[string]string{"repository": "acme/app", "ref": "refs/heads/*"}, Policies: []string{"deploy-app"}, TTL: 15 * time.Minute},
+		{Name: "deploy-infra", Issuer: "github", BoundClaims: map[string]string{"repository": "acme/infra"}, Policies: []string{"deploy-infra"}, TTL: 15 * time.Minute},
+		{Name: "deploy-tagged", Issuer: "github", BoundClaims: map[string]string{"repository": "acme/app", "environment": "prod"}, Policies: []string{"deploy-app"}, TTL: 15 * time.Minute},
+		{Name: "deploy-denied", Issuer: "github", BoundClaims: map[string]string{"repository": "acme/app"}, Policies: []string{"deploy-app"}, TTL: 15 * time.Minute, Policy: &denyingPolicy{}},
+	}
+	tt := []struct {
+		name     string
+		role     string
+		jwt      func() string
+		wantErr  error
+		wantName string
+	}{
+		{name: "matching claims", role: "deploy-app", wantName: "nacp deploy-app: repo:acme/app:ref:refs/heads/main"},
+		{name: "other repository", role: "deploy-infra", wantErr: ErrClaimMismatch},
+		{name: "missing claim", role: "deploy-tagged", wantErr: ErrClaimMismatch},
+		{name: "unknown role", role: "admin", wantErr: ErrUnknownRole},
+		{name: "denied by policy", role: "deploy-denied", wantErr: ErrPolicyDenied},
+		{name: "forged token", role: "deploy-app", jwt: func() string { return "eyJhbGciOiJub25lIn0.e30." }, wantErr: ErrInvalidToken},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			creator := &fakeTokenCreator{}
+			vendor, err := NewTokenVendor(context.Background(), []VendingIssuer{{Name: "github", URL: issuer.URL, Audience: "nacp-ci"}}, roles, creator, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			jwt := issuer.idToken(t)
+			if tc.jwt != nil {
+				jwt = tc.jwt()
+			}
+			token, err := vendor.Vend(context.Background(), tc.role, jwt)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.Nil(t, creator.created, "no token is created")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "secret", token.SecretID)
+			assert.Equal(t, &api.ACLToken{
+				Name:          tc.wantName,
+				Type:          "client",
+				Policies:      []string{"deploy-app"},
+				ExpirationTTL: 15 * time.Minute,
+			}, creator.created)
+		})
+	}
+}
+
+func TestTokenVendorPassesClaimsToPolicy(t *testing.T) {
+	issuer := newFakeIssuer(t, map[string]interface{}{
+		"aud":        "nacp-ci",
+		"sub":        "repo:acme/app:ref:refs/heads/main",
+		"repository": "acme/app",
+	})
+	policy := &denyingPolicy{}
+	roles := []VendingRole{{Name: "deploy-app", Issuer: "github", BoundClaims: map[string]string{"repository": "acme/*"}, Policies: []string{"deploy-app"}, TTL: time.Minute, Policy: policy}}
+	vendor, err := NewTokenVendor(context.Background(), []VendingIssuer{{Name: "github", URL: issuer.URL, Audience: "nacp-ci"}}, roles, &fakeTokenCreator{}, hclog.NewNullLogger())
+	require.NoError(t, err)
+
+	_, err = vendor.Vend(context.Background(), "deploy-app", issuer.idToken(t))
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	assert.ErrorContains(t, err, "main only")
+	assert.Equal(t, "repo:acme/app:ref:refs/heads/main", policy.subject)
+	assert.Equal(t, "acme/app", policy.claims["repository"])
+	assert.Equal(t, []string{"deploy-app"}, policy.policies)
+}
+
+func TestNewTokenVendorFailsOnUnknownIssuer(t *testing.T) {
+	_, err := NewTokenVendor(context.Background(), nil, []VendingRole{{Name: "deploy", Issuer: "gitlab"}}, &fakeTokenCreator{}, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "role deploy uses the unknown issuer gitlab")
+}
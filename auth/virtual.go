@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// VirtualTokenPrefix marks the credentials NACP issues, clients send them as X-Nomad-Token or bearer token.
+const VirtualTokenPrefix = "nacp_"
+
+// virtualTokenCreateTimeout bounds the creation of a Nomad token, it is shared by all requests waiting for it.
+const virtualTokenCreateTimeout = 30 * time.Second
+
+var ErrUnknownCredential = errors.New("unknown credential")
+
+// VirtualCredential is a credential of a client that NACP maps to a Nomad token with the policies.
+type VirtualCredential struct {
+	Name string
+	// SecretHash is the hex encoded SHA-256 of the secret, NACP never stores the secret itself
+	SecretHash string
+	Policies   []string
+}
+
+// ACLTokenManager creates and revokes Nomad ACL tokens, e.g. api.ACLTokens.
+type ACLTokenManager interface {
+	ACLTokenCreator
+	Delete(accessorID string, q *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+// ManagedToken is the Nomad token currently backing a credential, without its secret.
+type ManagedToken struct {
+	Credential string     `json:"credential"`
+	AccessorID string     `json:"accessor_id"`
+	Policies   []string   `json:"policies"`
+	Expires    *time.Time `json:"expires,omitempty"`
+}
+
+// VirtualTokens translates the credentials of clients into short-lived Nomad tokens NACP creates, replaces
+// before they expire and revokes, so clients never hold a Nomad token.
+type VirtualTokens struct {
+	credentials map[string]VirtualCredential
+	tokens      ACLTokenManager
+	ttl         time.Duration
+	renewBefore time.Duration
+	// exclusive rejects requests with other tokens than NACP's credentials
+	exclusive bool
+	logger    hclog.Logger
+	now       func() time.Time
+
+	mu     sync.Mutex
+	issued map[string]*api.ACLToken
+	// creating shares the creation of a credential's token between concurrent requests
+	creating singleflight.Group
+}
+
+func NewVirtualTokens(credentials []VirtualCredential, tokens ACLTokenManager, ttl, renewBefore time.Duration, exclusive bool, logger hclog.Logger) *VirtualTokens {
+	v := &VirtualTokens{
+		credentials: map[string]VirtualCredential{},
+		tokens:      tokens,
+		ttl:         ttl,
+		renewBefore: renewBefore,
+		exclusive:   exclusive,
+		logger:      logger,
+		now:         time.Now,
+		issued:      map[string]*api.ACLToken{},
+	}
+	for _, credential := range credentials {
+		v.credentials[strings.ToLower(credential.SecretHash)] = credential
+	}
+	return v
+}
+
+// Middleware replaces the credential of the request with the Nomad token backing it. Requests without token
+// pass anonymously, requests with a Nomad token are passed through unless only credentials are accepted.
+// Like Nomad, it reads the X-Nomad-Token header first and an Authorization bearer token otherwise.
+func (v *VirtualTokens) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(tokenHeader)
+		bearer, hasBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if v.exclusive {
+			for _, sent := range []string{secret, bearer} {
+				if sent != "" && !strings.HasPrefix(sent, VirtualTokenPrefix) {
+					http.Error(w, "only NACP credentials are accepted", http.StatusUnauthorized)
+					return
+				}
+			}
+		}
+		if secret == "" {
+			secret = bearer
+		}
+		if !strings.HasPrefix(secret, VirtualTokenPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, err := v.Token(r.Context(), secret)
+		switch {
+		case errors.Is(err, ErrUnknownCredential):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			v.logger.Error("Creating the Nomad token of a credential failed", "error", err)
+			http.Error(w, "failed to create the nomad token of the credential", http.StatusBadGateway)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.Header.Set(tokenHeader, token.SecretID)
+		if hasBearer {
+			// the credential never reaches Nomad
+			r.Header.Del("Authorization")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Token returns the Nomad token of the credential's secret, it is created if missing or about to expire.
+// Concurrent requests share one creation, the replaced token is revoked once the new one is issued.
+// The creation doesn't end with the request that started it, as the others still wait for it.
+func (v *VirtualTokens) Token(ctx context.Context, secret string) (*api.ACLToken, error) {
+	hash := sha256.Sum256([]byte(secret))
+	credential, ok := v.credentials[hex.EncodeToString(hash[:])]
+	if !ok {
+		return nil, ErrUnknownCredential
+	}
+
+	v.mu.Lock()
+	token, ok := v.issued[credential.Name]
+	v.mu.Unlock()
+	if ok && v.valid(token) {
+		return token, nil
+	}
+	created, err, _ := v.creating.Do(credential.Name, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), virtualTokenCreateTimeout)
+		defer cancel()
+		return v.replace(ctx, credential)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created.(*api.ACLToken), nil
+}
+
+// replace creates a new token of the credential without holding the lock and revokes the one it replaces.
+func (v *VirtualTokens) replace(ctx context.Context, credential VirtualCredential) (*api.ACLToken, error) {
+	v.mu.Lock()
+	if token, ok := v.issued[credential.Name]; ok && v.valid(token) {
+		v.mu.Unlock()
+		return token, nil
+	}
+	v.mu.Unlock()
+
+	token, _, err := v.tokens.Create(&api.ACLToken{
+		Name:          fmt.Sprintf("nacp virtual token: %s", credential.Name),
+		Type:          "client",
+		Policies:      credential.Policies,
+		ExpirationTTL: v.ttl,
+	}, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		metrics.VirtualTokens.WithLabelValues(credential.Name, "failure").Inc()
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+	metrics.VirtualTokens.WithLabelValues(credential.Name, "success").Inc()
+	v.logger.Info("Created token of credential", "credential", credential.Name, "accessor_id", token.AccessorID, "expires", token.ExpirationTime)
+
+	v.mu.Lock()
+	replaced, ok := v.issued[credential.Name]
+	v.issued[credential.Name] = token
+	v.mu.Unlock()
+	if ok {
+		if _, err := v.tokens.Delete(replaced.AccessorID, (&api.WriteOptions{}).WithContext(ctx)); err != nil {
+			v.logger.Warn("Revoking the replaced token of credential failed, it expires on its own", "credential", credential.Name, "accessor_id", replaced.AccessorID, "error", err)
+		} else {
+			v.logger.Info("Revoked replaced token of credential", "credential", credential.Name, "accessor_id", replaced.AccessorID)
+		}
+	}
+	return token, nil
+}
+
+// valid reports whether the token is used for more requests, it is replaced renewBefore its expiry.
+func (v *VirtualTokens) valid(token *api.ACLToken) bool {
+	return token.ExpirationTime == nil || v.now().Add(v.renewBefore).Before(*token.ExpirationTime)
+}
+
+// List returns the Nomad tokens currently backing the credentials, sorted by credential.
+func (v *VirtualTokens) List() []ManagedToken {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	managed := make([]ManagedToken, 0, len(v.issued))
+	for name, token := range v.issued {
+		managed = append(managed, ManagedToken{Credential: name, AccessorID: token.AccessorID, Policies: token.Policies, Expires: token.ExpirationTime})
+	}
+	slices.SortFunc(managed, func(a, b ManagedToken) int {
+		return strings.Compare(a.Credential, b.Credential)
+	})
+	return managed
+}
+
+// Revoke deletes the Nomad token of the credential, the next request of the credential creates a new one.
+// It reports whether the credential had a token.
+func (v *VirtualTokens) Revoke(ctx context.Context, name string) (bool, error) {
+	v.mu.Lock()
+	token, ok := v.issued[name]
+	v.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if _, err := v.tokens.Delete(token.AccessorID, (&api.WriteOptions{}).WithContext(ctx)); err != nil {
+		return true, fmt.Errorf("failed to revoke token of credential %s: %w", name, err)
+	}
+	v.mu.Lock()
+	if v.issued[name] == token {
+		delete(v.issued, name)
+	}
+	v.mu.Unlock()
+	v.logger.Info("Revoked token of credential", "credential", name, "accessor_id", token.AccessorID)
+	return true, nil
+}
+
+// RevokeAll deletes the Nomad tokens of all credentials, e.g. on shutdown.
+func (v *VirtualTokens) RevokeAll(ctx context.Context) error {
+	var errs *multierror.Error
+	for _, managed := range v.List() {
+		if _, err := v.Revoke(ctx, managed.Credential); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTokenManager creates tokens expiring after their TTL and records the deleted ones.
+type fakeTokenManager struct {
+	now     time.Time
+	created int
+	deleted []string
+}
+
+func (f *fakeTokenManager) Create(token *api.ACLToken, _ *api.WriteOptions) (*api.ACLToken, *api.WriteMeta, error) {
+	f.created++
+	created := *token
+	created.AccessorID = fmt.Sprintf("accessor-%d", f.created)
+	created.SecretID = fmt.Sprintf("secret-%d", f.created)
+	expires := f.now.Add(token.ExpirationTTL)
+	created.ExpirationTime = &expires
+	return &created, nil, nil
+}
+
+func (f *fakeTokenManager) Delete(accessorID string, _ *api.WriteOptions) (*api.WriteMeta, error) {
+	f.deleted = append(f.deleted, accessorID)
+	return nil, nil
+}
+
+func secretHash(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestVirtualTokens(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	manager := &fakeTokenManager{now: now}
+	tokens := NewVirtualTokens([]VirtualCredential{
+		{Name: "ci", SecretHash: secretHash("nacp_ci-secret"), Policies: []string{"deploy"}},
+	}, manager, time.Hour, 10*time.Minute, false, hclog.NewNullLogger())
+	tokens.now = func() time.Time { return now }
+
+	token, err := tokens.Token(context.Background(), "nacp_ci-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-1", token.SecretID)
+	assert.Equal(t, []string{"deploy"}, token.Policies)
+	assert.Equal(t, "client", token.Type)
+
+	now = now.Add(45 * time.Minute)
+	token, err = tokens.Token(context.Background(), "nacp_ci-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-1", token.SecretID, "the token is reused until it is about to expire")
+
+	now = now.Add(10 * time.Minute)
+	manager.now = now
+	token, err = tokens.Token(context.Background(), "nacp_ci-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-2", token.SecretID, "the token is replaced before it expires")
+	assert.Equal(t, []string{"accessor-1"}, manager.deleted, "the replaced token is revoked")
+
+	_, err = tokens.Token(context.Background(), "nacp_other")
+	assert.ErrorIs(t, err, ErrUnknownCredential)
+
+	assert.Equal(t, []ManagedToken{{Credential: "ci", AccessorID: "accessor-2", Policies: []string{"deploy"}, Expires: token.ExpirationTime}}, tokens.List())
+	revoked, err := tokens.Revoke(context.Background(), "ci")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	assert.Equal(t, []string{"accessor-1", "accessor-2"}, manager.deleted)
+	assert.Empty(t, tokens.List())
+}
+
+// blockingTokenManager creates tokens once release is closed, unless the context of the creation ended.
+type blockingTokenManager struct {
+	fakeTokenManager
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func (b *blockingTokenManager) Create(token *api.ACLToken, q *api.WriteOptions) (*api.ACLToken, *api.WriteMeta, error) {
+	<-b.release
+	if err := q.Context().Err(); err != nil {
+		return nil, nil, err
+	}
+	if _, ok := q.Context().Deadline(); !ok {
+		return nil, nil, fmt.Errorf("creation without deadline")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.fakeTokenManager.Create(token, q)
+}
+
+func TestVirtualTokensConcurrentCreation(t *testing.T) {
+	manager := &blockingTokenManager{fakeTokenManager: fakeTokenManager{now: time.Now()}, release: make(chan struct{})}
+	tokens := NewVirtualTokens([]VirtualCredential{
+		{Name: "ci", SecretHash: secretHash("nacp_ci-secret"), Policies: []string{"deploy"}},
+	}, manager, time.Hour, 10*time.Minute, false, hclog.NewNullLogger())
+
+	var wg sync.WaitGroup
+	secrets := make([]string, 5)
+	for i := range secrets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tokens.Token(context.Background(), "nacp_ci-secret")
+			if assert.NoError(t, err) {
+				secrets[i] = token.SecretID
+			}
+		}()
+	}
+	assert.Empty(t, tokens.List(), "the lock is not held while the token is created")
+	close(manager.release)
+	wg.Wait()
+
+	assert.Equal(t, 1, manager.created)
+	for _, secret := range secrets {
+		assert.Equal(t, "secret-1", secret)
+	}
+}
+
+func TestVirtualTokensCreationOutlivesRequest(t *testing.T) {
+	manager := &blockingTokenManager{fakeTokenManager: fakeTokenManager{now: time.Now()}, release: make(chan struct{})}
+	tokens := NewVirtualTokens([]VirtualCredential{
+		{Name: "ci", SecretHash: secretHash("nacp_ci-secret"), Policies: []string{"deploy"}},
+	}, manager, time.Hour, 10*time.Minute, false, hclog.NewNullLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	close(manager.release)
+	token, err := tokens.Token(ctx, "nacp_ci-secret")
+	require.NoError(t, err, "a canceled request doesn't fail the creation other requests wait for")
+	assert.Equal(t, "secret-1", token.SecretID)
+}
+
+func TestVirtualTokensMiddleware(t *testing.T) {
+	credentials := []VirtualCredential{{Name: "ci", SecretHash: secretHash("nacp_ci-secret"), Policies: []string{"deploy"}}}
+	tests := []struct {
+		name       string
+		exclusive  bool
+		token      string
+		bearer     string
+		wantStatus int
+		wantToken  string
+	}{
+		{name: "credential", token: "nacp_ci-secret", wantStatus: http.StatusOK, wantToken: "secret-1"},
+		{name: "unknown credential", token: "nacp_guessed", wantStatus: http.StatusForbidden},
+		{name: "nomad token", token: "6f1c1d6e-0000-0000-0000-000000000000", wantStatus: http.StatusOK, wantToken: "6f1c1d6e-0000-0000-0000-000000000000"},
+		{name: "nomad token when exclusive", exclusive: true, token: "6f1c1d6e-0000-0000-0000-000000000000", wantStatus: http.StatusUnauthorized},
+		{name: "anonymous when exclusive", exclusive: true, wantStatus: http.StatusOK},
+		{name: "bearer credential", bearer: "nacp_ci-secret", wantStatus: http.StatusOK, wantToken: "secret-1"},
+		{name: "bearer nomad token when exclusive", exclusive: true, bearer: "6f1c1d6e-0000-0000-0000-000000000000", wantStatus: http.StatusUnauthorized},
+		{name: "credential with bearer nomad token when exclusive", exclusive: true, token: "nacp_ci-secret", bearer: "6f1c1d6e-0000-0000-0000-000000000000", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := NewVirtualTokens(credentials, &fakeTokenManager{now: time.Now()}, time.Hour, 10*time.Minute, tt.exclusive, hclog.NewNullLogger())
+			var gotToken, gotAuthorization string
+			handler := tokens.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotToken = r.Header.Get("X-Nomad-Token")
+				gotAuthorization = r.Header.Get("Authorization")
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/jobs", nil)
+			if tt.token != "" {
+				req.Header.Set("X-Nomad-Token", tt.token)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantToken, gotToken)
+			assert.NotContains(t, gotAuthorization, "nacp_", "the credential is never forwarded")
+		})
+	}
+}
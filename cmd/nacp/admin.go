@@ -0,0 +1,418 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/auth"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/metrics"
+)
+
+const (
+	adminPathPrefix = "/v1/nacp/"
+	// healthPath is outside of the admin prefix, load balancers and service discovery expect it at the root
+	healthPath = "/healthz"
+)
+
+// rulesetStatus tracks a fingerprint of the active config and rule files,
+// so operators can detect replicas enforcing different policy versions.
+type rulesetStatus struct {
+	mu   sync.RWMutex
+	hash string
+}
+
+// Update computes the hash of the given config and all rule files it references.
+func (s *rulesetStatus) Update(c *config.Config) {
+	hash := rulesetHash(c)
+	s.mu.Lock()
+	s.hash = hash
+	s.mu.Unlock()
+	metrics.SetRulesetHash(hash)
+}
+
+func (s *rulesetStatus) Hash() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hash
+}
+
+// rulesetConfig are the parts of the config deciding on requests, listeners, upstreams and logging leave the hash unchanged.
+type rulesetConfig struct {
+	StrictPolicies    bool
+	ContextHeaders    []string
+	ResponseScrubbing *config.ResponseScrubbing
+	TokenVending      *config.TokenVending
+	Shadow            *config.Shadow
+	Exemptions        *config.Exemptions
+	Time              *config.PolicyTime
+	OpaLimits         *config.OpaLimits
+	PatchPolicy       *config.PatchPolicy
+	MutatorConflicts  *config.MutatorConflicts
+	DataSources       []config.DataSource
+	Validators        []config.Validator
+	Mutators          []config.Mutator
+	ReadRules         []config.ReadRule
+}
+
+func rulesetHash(c *config.Config) string {
+	h := sha256.New()
+	configData, _ := json.Marshal(rulesetConfig{
+		StrictPolicies:    c.StrictPolicies,
+		ContextHeaders:    c.ContextHeaders,
+		ResponseScrubbing: c.ResponseScrubbing,
+		TokenVending:      c.TokenVending,
+		Shadow:            c.Shadow,
+		Exemptions:        c.Exemptions,
+		Time:              c.Time,
+		OpaLimits:         c.OpaLimits,
+		PatchPolicy:       c.PatchPolicy,
+		MutatorConflicts:  c.MutatorConflicts,
+		DataSources:       c.DataSources,
+		Validators:        c.Validators,
+		Mutators:          c.Mutators,
+		ReadRules:         c.ReadRules,
+	})
+	h.Write(configData)
+
+	var rules []*config.OpaRule
+	for _, v := range c.Validators {
+		rules = append(rules, v.OpaRule)
+	}
+	for _, m := range c.Mutators {
+		rules = append(rules, m.OpaRule)
+	}
+	for _, r := range c.ReadRules {
+		rules = append(rules, r.OpaRule)
+	}
+	if c.TokenVending != nil {
+		for _, r := range c.TokenVending.Roles {
+			rules = append(rules, r.OpaRule)
+		}
+	}
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		h.Write([]byte(rule.Filename))
+		if data, err := os.ReadFile(rule.Filename); err == nil {
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// adminAuth guards the admin API, it changes NACP at runtime and reveals its state.
+// Next to the Nomad API every request needs an admin token, on the dedicated admin listener only if tokens are configured.
+// A nil adminAuth rejects every request.
+type adminAuth struct {
+	// tokens are the hex encoded SHA-256 of the admin tokens
+	tokens map[string]bool
+	// dedicated is set if the admin API is served on its own listener
+	dedicated bool
+}
+
+func buildAdminAuth(c *config.Config) *adminAuth {
+	a := &adminAuth{tokens: map[string]bool{}, dedicated: c.AdminBind != ""}
+	for _, token := range c.AdminTokenSHA256 {
+		a.tokens[strings.ToLower(token)] = true
+	}
+	return a
+}
+
+// check returns the status rejecting the request, 0 if it is allowed.
+func (a *adminAuth) check(r *http.Request) (int, string) {
+	if a == nil || (len(a.tokens) == 0 && !a.dedicated) {
+		return http.StatusForbidden, "the admin API requires admin_token_sha256 or admin_bind"
+	}
+	if len(a.tokens) == 0 {
+		return 0, ""
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return http.StatusUnauthorized, "missing admin token"
+	}
+	hash := sha256.Sum256([]byte(token))
+	if !a.tokens[hex.EncodeToString(hash[:])] {
+		return http.StatusForbidden, "invalid admin token"
+	}
+	return 0, ""
+}
+
+func (a *adminAuth) middleware(next http.Handler, appLogger hclog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, reason := a.check(r); status != 0 {
+			appLogger.Warn("Rejected admin request", "path", r.URL.Path, "method", r.Method, "remote", r.RemoteAddr, "reason", reason)
+			http.Error(w, reason, status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type statusResponse struct {
+	RulesetHash    string `json:"ruleset_hash"`
+	Degraded       bool   `json:"degraded"`
+	DegradedReason string `json:"degraded_reason,omitempty"`
+	Leader         bool   `json:"leader"`
+
+	RuleVersions admissionctrl.RuleVersions `json:"rule_versions"`
+}
+
+// NewAdminHandler serves NACP's own endpoints below /v1/nacp/, all of them require admin access.
+func NewAdminHandler(nacp *nacpServer, appLogger hclog.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+adminPathPrefix+"metrics", metrics.Handler())
+	mux.HandleFunc("GET "+adminPathPrefix+"status", func(w http.ResponseWriter, r *http.Request) {
+		response := &statusResponse{
+			RulesetHash:  nacp.status.Hash(),
+			Leader:       nacp.elector.IsLeader(),
+			RuleVersions: nacp.handler.RuleVersions(),
+		}
+		if degraded := nacp.handler.Degraded(); degraded != nil {
+			response.Degraded = true
+			response.DegradedReason = degraded.Error()
+		}
+		writeJson(w, http.StatusOK, response, appLogger)
+	})
+	mux.HandleFunc("GET "+adminPathPrefix+"version", func(w http.ResponseWriter, r *http.Request) {
+		info := currentBuild()
+		info.Features = nacp.features
+		writeJson(w, http.StatusOK, info, appLogger)
+	})
+	if nacp.faults != nil {
+		registerFaultEndpoints(mux, nacp.faults, appLogger)
+	}
+	if nacp.policyTrace {
+		registerTraceEndpoint(mux, nacp.handler, appLogger)
+	}
+	if nacp.exemptions != nil {
+		registerExemptionEndpoints(mux, nacp.exemptions, appLogger)
+	}
+	if nacp.virtualTokens != nil {
+		registerVirtualTokenEndpoints(mux, nacp.virtualTokens, appLogger)
+	}
+	if nacp.maintenance != nil {
+		registerMaintenanceEndpoints(mux, nacp.maintenance, appLogger)
+	}
+	if nacp.shadow != nil {
+		mux.HandleFunc("GET "+adminPathPrefix+"shadow", func(w http.ResponseWriter, r *http.Request) {
+			writeJson(w, http.StatusOK, nacp.shadow.Report(), appLogger)
+		})
+		mux.HandleFunc("DELETE "+adminPathPrefix+"shadow", func(w http.ResponseWriter, r *http.Request) {
+			nacp.shadow.Reset()
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	return nacp.admin.middleware(mux, appLogger)
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewHealthHandler reports NACP as unhealthy while it passes jobs through unchecked,
+// so clients discovering it are only sent to instances enforcing the rules.
+func NewHealthHandler(handler *admissionctrl.JobHandler, appLogger hclog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if degraded := handler.Degraded(); degraded != nil {
+			writeJson(w, http.StatusServiceUnavailable, &healthResponse{Status: "degraded", Reason: degraded.Error()}, appLogger)
+			return
+		}
+		writeJson(w, http.StatusOK, &healthResponse{Status: "ok"}, appLogger)
+	}
+}
+
+type faultSpec struct {
+	Delay        string  `json:"delay,omitempty"`
+	ErrorPercent float64 `json:"error_percent"`
+}
+
+func registerFaultEndpoints(mux *http.ServeMux, faults *admissionctrl.FaultInjector, appLogger hclog.Logger) {
+	mux.HandleFunc("GET "+adminPathPrefix+"faults", func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]faultSpec{}
+		for rule, fault := range faults.Faults() {
+			spec := faultSpec{ErrorPercent: fault.ErrorPercent}
+			if fault.Delay > 0 {
+				spec.Delay = fault.Delay.String()
+			}
+			response[rule] = spec
+		}
+		writeJson(w, http.StatusOK, response, appLogger)
+	})
+	mux.HandleFunc("DELETE "+adminPathPrefix+"faults", func(w http.ResponseWriter, r *http.Request) {
+		faults.Clear()
+		appLogger.Warn("Removed all injected faults")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("PUT "+adminPathPrefix+"faults/{rule}", func(w http.ResponseWriter, r *http.Request) {
+		rule := r.PathValue("rule")
+		request := &faultSpec{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid fault: %v", err), http.StatusBadRequest)
+			return
+		}
+		fault := admissionctrl.Fault{ErrorPercent: request.ErrorPercent}
+		if request.Delay != "" {
+			delay, err := time.ParseDuration(request.Delay)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid delay: %v", err), http.StatusBadRequest)
+				return
+			}
+			fault.Delay = delay
+		}
+		if err := faults.Set(rule, fault); err != nil {
+			http.Error(w, fmt.Sprintf("invalid fault: %v", err), http.StatusBadRequest)
+			return
+		}
+		appLogger.Warn("Injecting fault", "rule", rule, "delay", fault.Delay, "error_percent", fault.ErrorPercent)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE "+adminPathPrefix+"faults/{rule}", func(w http.ResponseWriter, r *http.Request) {
+		rule := r.PathValue("rule")
+		faults.Remove(rule)
+		appLogger.Warn("Removed injected fault", "rule", rule)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type exemptionSpec struct {
+	Rule      string `json:"rule"`
+	Namespace string `json:"namespace,omitempty"`
+	Job       string `json:"job,omitempty"`
+	Expires   string `json:"expires"`
+	Reason    string `json:"reason"`
+}
+
+func registerExemptionEndpoints(mux *http.ServeMux, exemptions *admissionctrl.Exemptions, appLogger hclog.Logger) {
+	mux.HandleFunc("GET "+adminPathPrefix+"exemptions", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, exemptions.List(), appLogger)
+	})
+	mux.HandleFunc("POST "+adminPathPrefix+"exemptions", func(w http.ResponseWriter, r *http.Request) {
+		request := &exemptionSpec{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid exemption: %v", err), http.StatusBadRequest)
+			return
+		}
+		expires, err := config.ParseExpiry(request.Expires)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid expires: %v", err), http.StatusBadRequest)
+			return
+		}
+		exemption, err := exemptions.Add(admissionctrl.Exemption{
+			Rule:      request.Rule,
+			Namespace: request.Namespace,
+			Job:       request.Job,
+			Expires:   expires,
+			Reason:    request.Reason,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid exemption: %v", err), http.StatusBadRequest)
+			return
+		}
+		appLogger.Warn("Added exemption", "id", exemption.ID, "rule", exemption.Rule, "namespace", exemption.Namespace, "job", exemption.Job, "expires", exemption.Expires, "reason", exemption.Reason)
+		writeJson(w, http.StatusCreated, exemption, appLogger)
+	})
+	mux.HandleFunc("DELETE "+adminPathPrefix+"exemptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		removed, err := exemptions.Remove(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, fmt.Sprintf("no exemption %s added via the API", id), http.StatusNotFound)
+			return
+		}
+		appLogger.Warn("Removed exemption", "id", id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type maintenanceRequest struct {
+	Message string `json:"message"`
+}
+
+func registerMaintenanceEndpoints(mux *http.ServeMux, maintenance *maintenanceMode, appLogger hclog.Logger) {
+	mux.HandleFunc("GET "+adminPathPrefix+"maintenance", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, maintenance.State(), appLogger)
+	})
+	mux.HandleFunc("PUT "+adminPathPrefix+"maintenance", func(w http.ResponseWriter, r *http.Request) {
+		request := &maintenanceRequest{}
+		// the message is optional, so is the body
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		maintenance.Enable(request.Message)
+		writeJson(w, http.StatusOK, maintenance.State(), appLogger)
+	})
+	mux.HandleFunc("DELETE "+adminPathPrefix+"maintenance", func(w http.ResponseWriter, r *http.Request) {
+		maintenance.Disable()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type vendingRequest struct {
+	Role string `json:"role"`
+	JWT  string `json:"jwt"`
+}
+
+// registerTokenVendingEndpoints serves the CI login next to the Nomad API, it is authenticated by the CI system's JWT, not by admin access.
+func registerTokenVendingEndpoints(mux *http.ServeMux, vendor *auth.TokenVendor, appLogger hclog.Logger) {
+	mux.HandleFunc("POST "+adminPathPrefix+"ci/login", func(w http.ResponseWriter, r *http.Request) {
+		request := &vendingRequest{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+			return
+		}
+		token, err := vendor.Vend(r.Context(), request.Role, request.JWT)
+		switch {
+		case errors.Is(err, auth.ErrInvalidToken):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrUnknownRole), errors.Is(err, auth.ErrClaimMismatch), errors.Is(err, auth.ErrPolicyDenied):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			writeJson(w, http.StatusOK, token, appLogger)
+		}
+	})
+}
+
+func registerVirtualTokenEndpoints(mux *http.ServeMux, tokens *auth.VirtualTokens, appLogger hclog.Logger) {
+	mux.HandleFunc("GET "+adminPathPrefix+"virtual-tokens", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, tokens.List(), appLogger)
+	})
+	mux.HandleFunc("DELETE "+adminPathPrefix+"virtual-tokens/{credential}", func(w http.ResponseWriter, r *http.Request) {
+		revoked, err := tokens.Revoke(r.Context(), r.PathValue("credential"))
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		case !revoked:
+			http.Error(w, "credential has no token", http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}, appLogger hclog.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		appLogger.Error("Writing response failed", "error", err)
+	}
+}
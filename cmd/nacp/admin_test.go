@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/auth"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/leader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dedicatedAdmin allows every admin request, like the admin listener without admin tokens.
+var dedicatedAdmin = &adminAuth{dedicated: true}
+
+func TestRulesetHash(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.rego")
+	require.NoError(t, os.WriteFile(policyFile, []byte("package one"), 0644))
+
+	c := config.DefaultConfig()
+	c.Validators = []config.Validator{
+		{Type: "opa", Name: "policy", OpaRule: &config.OpaRule{Filename: policyFile, Query: "errors = data.one.errors"}},
+	}
+	first := rulesetHash(c)
+	assert.Equal(t, first, rulesetHash(c), "hash is stable")
+
+	require.NoError(t, os.WriteFile(policyFile, []byte("package two"), 0644))
+	assert.NotEqual(t, first, rulesetHash(c), "hash covers the policy content")
+
+	second := rulesetHash(c)
+	c.Port = 1234
+	c.Bind = "127.0.0.1"
+	assert.Equal(t, second, rulesetHash(c), "hash ignores the listener")
+
+	c.Validators[0].OpaRule.Query = "errors = data.two.errors"
+	assert.NotEqual(t, second, rulesetHash(c), "hash covers the rules")
+
+	readFile := filepath.Join(t.TempDir(), "read.rego")
+	require.NoError(t, os.WriteFile(readFile, []byte("package read"), 0644))
+	c.ReadRules = []config.ReadRule{{Name: "read", OpaRule: &config.OpaRule{Filename: readFile, Query: "errors = data.read.errors"}}}
+	third := rulesetHash(c)
+	require.NoError(t, os.WriteFile(readFile, []byte("package read.two"), 0644))
+	assert.NotEqual(t, third, rulesetHash(c), "hash covers the policies of read rules")
+}
+
+func TestAdminAuth(t *testing.T) {
+	hash := sha256.Sum256([]byte("admin-secret"))
+	withToken := &config.Config{AdminTokenSHA256: []string{hex.EncodeToString(hash[:])}}
+	tt := []struct {
+		name       string
+		config     *config.Config
+		token      string
+		wantStatus int
+	}{
+		{name: "next to the nomad api without tokens", config: &config.Config{}, wantStatus: http.StatusForbidden},
+		{name: "dedicated listener without tokens", config: &config.Config{AdminBind: "127.0.0.1:6465"}, wantStatus: http.StatusOK},
+		{name: "missing token", config: withToken, wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", config: withToken, token: "guessed", wantStatus: http.StatusForbidden},
+		{name: "admin token", config: withToken, token: "admin-secret", wantStatus: http.StatusOK},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+			nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: buildAdminAuth(tc.config)}
+			req := httptest.NewRequest(http.MethodGet, "/v1/nacp/status", nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rr := httptest.NewRecorder()
+			NewAdminHandler(nacp, hclog.NewNullLogger()).ServeHTTP(rr, req)
+			assert.Equal(t, tc.wantStatus, rr.Code)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	NewAdminHandler(&nacpServer{}, hclog.NewNullLogger()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/nacp/status", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code, "no admin auth rejects every request")
+}
+
+func TestBuildServerAdminBind(t *testing.T) {
+	c := config.DefaultConfig()
+	c.AdminBind = "127.0.0.1:0"
+	nacp, err := buildServer(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	require.NotNil(t, nacp.adminServer)
+
+	rr := httptest.NewRecorder()
+	nacp.adminServer.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/nacp/status", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "proxied", http.StatusNotFound)
+	}))
+	defer nomad.Close()
+	c.Nomad.Address = nomad.URL
+	nacp, err = buildServer(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	nacp.server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/nacp/status", nil))
+	assert.Equal(t, "proxied\n", rr.Body.String(), "the admin API is not served next to the nomad api")
+}
+
+func TestAdminStatus(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	status := &rulesetStatus{}
+	status.Update(config.DefaultConfig())
+
+	nacp := &nacpServer{handler: handler, status: status, elector: leader.Static{}, admin: dedicatedAdmin}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	getStatus := func() *statusResponse {
+		res, err := http.Get(server.URL + "/v1/nacp/status")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		response := &statusResponse{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(response))
+		return response
+	}
+
+	assert.Equal(t, &statusResponse{RulesetHash: status.Hash(), Leader: true}, getStatus())
+
+	handler.PassThrough(fmt.Errorf("broken"))
+	assert.Equal(t, &statusResponse{RulesetHash: status.Hash(), Degraded: true, DegradedReason: "broken", Leader: true}, getStatus())
+
+	res, err := http.Get(server.URL + "/v1/nacp/metrics")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, readClosterToString(t, res.Body), "nacp_ruleset_info")
+}
+
+func TestAdminVersion(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: dedicatedAdmin, features: []string{"cors", "shadow"}}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/v1/nacp/version")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	info := buildInfo{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&info))
+	assert.Equal(t, version, info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, []string{"cors", "shadow"}, info.Features)
+}
+
+func TestAdminFaults(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: dedicatedAdmin}
+
+	disabled := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer disabled.Close()
+	res, err := http.Get(disabled.URL + "/v1/nacp/faults")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode, "endpoints only exist if fault injection is enabled")
+
+	nacp.faults = admissionctrl.NewFaultInjector()
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	send := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	getFaults := func() map[string]faultSpec {
+		res := send("GET", "/v1/nacp/faults", "")
+		defer res.Body.Close()
+		faults := map[string]faultSpec{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&faults))
+		return faults
+	}
+
+	assert.Equal(t, http.StatusNoContent, send("PUT", "/v1/nacp/faults/costcenter", `{"delay":"1.5s","error_percent":25}`).StatusCode)
+	assert.Equal(t, http.StatusNoContent, send("PUT", "/v1/nacp/faults/hello", `{"error_percent":100}`).StatusCode)
+	assert.Equal(t, map[string]faultSpec{
+		"costcenter": {Delay: "1.5s", ErrorPercent: 25},
+		"hello":      {ErrorPercent: 100},
+	}, getFaults())
+
+	assert.Equal(t, http.StatusBadRequest, send("PUT", "/v1/nacp/faults/x", `{"delay":"soon"}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, send("PUT", "/v1/nacp/faults/x", `{"error_percent":200}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, send("PUT", "/v1/nacp/faults/x", `not json`).StatusCode)
+
+	assert.Equal(t, http.StatusNoContent, send("DELETE", "/v1/nacp/faults/hello", "").StatusCode)
+	assert.Equal(t, map[string]faultSpec{"costcenter": {Delay: "1.5s", ErrorPercent: 25}}, getFaults())
+
+	assert.Equal(t, http.StatusNoContent, send("DELETE", "/v1/nacp/faults", "").StatusCode)
+	assert.Empty(t, getFaults())
+}
+
+func TestAdminFaultsRequireAdminToken(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	faults := admissionctrl.NewFaultInjector()
+	hash := sha256.Sum256([]byte("admin-secret"))
+	admin := buildAdminAuth(&config.Config{AdminTokenSHA256: []string{hex.EncodeToString(hash[:])}})
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: admin, faults: faults}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	send := func(method, token string) int {
+		req, err := http.NewRequest(method, server.URL+"/v1/nacp/faults/costcenter", strings.NewReader(`{"error_percent":100}`))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodPut, ""))
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPut, "guessed"))
+	assert.Empty(t, faults.Faults(), "rejected requests inject no fault")
+
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPut, "admin-secret"))
+	assert.Len(t, faults.Faults(), 1)
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodDelete, ""))
+	assert.Len(t, faults.Faults(), 1)
+}
+
+func TestAdminExemptions(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	exemptions, err := admissionctrl.NewExemptions("", time.Hour, hclog.NewNullLogger())
+	require.NoError(t, err)
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: dedicatedAdmin, exemptions: exemptions}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	send := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	list := func() []admissionctrl.Exemption {
+		res := send("GET", "/v1/nacp/exemptions", "")
+		defer res.Body.Close()
+		var list []admissionctrl.Exemption
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+		return list
+	}
+
+	res := send("POST", "/v1/nacp/exemptions", `{"rule":"costcenter","namespace":"billing","job":"legacy-*","expires":"2099-12-31","reason":"migration"}`)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	added := admissionctrl.Exemption{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&added))
+	assert.Equal(t, time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), added.Expires)
+	assert.Equal(t, []admissionctrl.Exemption{added}, list())
+
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/v1/nacp/exemptions", `{"rule":"costcenter","expires":"soon","reason":"x"}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/v1/nacp/exemptions", `{"rule":"costcenter","expires":"2099-12-31"}`).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/v1/nacp/exemptions", `not json`).StatusCode)
+
+	assert.Equal(t, http.StatusNotFound, send("DELETE", "/v1/nacp/exemptions/unknown", "").StatusCode)
+	assert.Equal(t, http.StatusNoContent, send("DELETE", "/v1/nacp/exemptions/"+added.ID, "").StatusCode)
+	assert.Empty(t, list())
+}
+
+func TestAdminExemptionsRequireAdminToken(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	exemptions, err := admissionctrl.NewExemptions("", time.Hour, hclog.NewNullLogger())
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte("admin-secret"))
+	admin := buildAdminAuth(&config.Config{AdminTokenSHA256: []string{hex.EncodeToString(hash[:])}})
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: admin, exemptions: exemptions}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	exempt := func(token string) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/nacp/exemptions",
+			strings.NewReader(`{"rule":"costcenter","job":"mine","expires":"2099-12-31","reason":"skip the rules"}`))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, exempt(""))
+	assert.Equal(t, http.StatusForbidden, exempt("guessed"))
+	assert.Empty(t, exemptions.List(), "rejected requests add no exemption")
+
+	assert.Equal(t, http.StatusCreated, exempt("admin-secret"))
+	assert.Len(t, exemptions.List(), 1)
+}
+
+func TestAdminTokenVending(t *testing.T) {
+	vendor, err := auth.NewTokenVendor(context.Background(), nil, nil, nil, hclog.NewNullLogger())
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	registerTokenVendingEndpoints(mux, vendor, hclog.NewNullLogger())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tt := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "unknown role", body: `{"role":"deploy","jwt":"ey..."}`, wantStatus: http.StatusForbidden},
+		{name: "invalid request", body: `not json`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := http.Post(server.URL+"/v1/nacp/ci/login", "application/json", strings.NewReader(tc.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, tc.wantStatus, res.StatusCode)
+		})
+	}
+}
+
+// fakeACLTokens creates tokens with the accessor of their name and forgets deleted ones.
+type fakeACLTokens struct {
+	deleted []string
+}
+
+func (f *fakeACLTokens) Create(token *api.ACLToken, _ *api.WriteOptions) (*api.ACLToken, *api.WriteMeta, error) {
+	created := *token
+	created.AccessorID = "accessor-" + token.Name
+	created.SecretID = "secret"
+	return &created, nil, nil
+}
+
+func (f *fakeACLTokens) Delete(accessorID string, _ *api.WriteOptions) (*api.WriteMeta, error) {
+	f.deleted = append(f.deleted, accessorID)
+	return nil, nil
+}
+
+func TestAdminVirtualTokens(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	hash := sha256.Sum256([]byte("nacp_ci-secret"))
+	aclTokens := &fakeACLTokens{}
+	tokens := auth.NewVirtualTokens([]auth.VirtualCredential{{Name: "ci", SecretHash: hex.EncodeToString(hash[:]), Policies: []string{"deploy"}}},
+		aclTokens, time.Hour, 10*time.Minute, false, hclog.NewNullLogger())
+	_, err := tokens.Token(context.Background(), "nacp_ci-secret")
+	require.NoError(t, err)
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: dedicatedAdmin, virtualTokens: tokens}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/v1/nacp/virtual-tokens")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	var managed []auth.ManagedToken
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&managed))
+	assert.Equal(t, []auth.ManagedToken{{Credential: "ci", AccessorID: "accessor-nacp virtual token: ci", Policies: []string{"deploy"}}}, managed)
+
+	revoke := func() int {
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/v1/nacp/virtual-tokens/ci", nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusNoContent, revoke())
+	assert.Equal(t, []string{"accessor-nacp virtual token: ci"}, aclTokens.deleted)
+	assert.Equal(t, http.StatusNotFound, revoke())
+}
+
+func TestAdminVirtualTokensRequireAdminAccess(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	hash := sha256.Sum256([]byte("nacp_ci-secret"))
+	aclTokens := &fakeACLTokens{}
+	tokens := auth.NewVirtualTokens([]auth.VirtualCredential{{Name: "ci", SecretHash: hex.EncodeToString(hash[:]), Policies: []string{"deploy"}}},
+		aclTokens, time.Hour, 10*time.Minute, false, hclog.NewNullLogger())
+	_, err := tokens.Token(context.Background(), "nacp_ci-secret")
+	require.NoError(t, err)
+	// served next to the Nomad API without admin tokens
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: &adminAuth{}, virtualTokens: tokens}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/v1/nacp/virtual-tokens")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/v1/nacp/virtual-tokens/ci", nil)
+	require.NoError(t, err)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Empty(t, aclTokens.deleted)
+	assert.Len(t, tokens.List(), 1)
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	maintenance, err := buildMaintenance(&config.Config{Maintenance: &config.Maintenance{Message: "frozen", Operations: []string{"register"}}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: dedicatedAdmin, maintenance: maintenance}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	send := func(method, body string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+"/v1/nacp/maintenance", strings.NewReader(body))
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	state := func() maintenanceState {
+		res := send("GET", "")
+		defer res.Body.Close()
+		state := maintenanceState{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&state))
+		return state
+	}
+
+	assert.Equal(t, maintenanceState{Message: "frozen", Operations: []string{"register"}}, state())
+
+	assert.Equal(t, http.StatusOK, send("PUT", "").StatusCode)
+	assert.True(t, state().Enabled)
+	assert.Equal(t, "frozen", state().Message)
+
+	assert.Equal(t, http.StatusOK, send("PUT", `{"message":"deploy freeze until monday"}`).StatusCode)
+	assert.Equal(t, "deploy freeze until monday", state().Message)
+	assert.NotNil(t, state().Since)
+
+	assert.Equal(t, http.StatusBadRequest, send("PUT", `not json`).StatusCode)
+
+	assert.Equal(t, http.StatusNoContent, send("DELETE", "").StatusCode)
+	assert.False(t, state().Enabled)
+}
+
+func TestAdminMaintenanceRequiresAdminToken(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	maintenance, err := buildMaintenance(&config.Config{Maintenance: &config.Maintenance{Operations: []string{"register"}}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte("admin-secret"))
+	admin := buildAdminAuth(&config.Config{AdminTokenSHA256: []string{hex.EncodeToString(hash[:])}})
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: admin, maintenance: maintenance}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/v1/nacp/maintenance", nil)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.False(t, maintenance.State().Enabled)
+
+	req, err = http.NewRequest(http.MethodPut, server.URL+"/v1/nacp/maintenance", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, maintenance.State().Enabled)
+}
+
+func TestAdminWritesRequireAdminAccess(t *testing.T) {
+	hash := sha256.Sum256([]byte("admin-secret"))
+	withToken := buildAdminAuth(&config.Config{AdminTokenSHA256: []string{hex.EncodeToString(hash[:])}})
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	exemptions, err := admissionctrl.NewExemptions("", time.Hour, hclog.NewNullLogger())
+	require.NoError(t, err)
+	maintenance, err := buildMaintenance(&config.Config{Maintenance: &config.Maintenance{Operations: []string{"register"}}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	tokens := auth.NewVirtualTokens(nil, &fakeACLTokens{}, time.Hour, 10*time.Minute, false, hclog.NewNullLogger())
+	nacp := &nacpServer{
+		handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, policyTrace: true,
+		faults: admissionctrl.NewFaultInjector(), exemptions: exemptions, maintenance: maintenance, virtualTokens: tokens,
+		shadow: admissionctrl.NewShadow(handler, 0, hclog.NewNullLogger()),
+	}
+	// every endpoint changing NACP at runtime, the gate must come with the endpoint
+	writes := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodPut, path: "/v1/nacp/faults/costcenter"},
+		{method: http.MethodDelete, path: "/v1/nacp/faults/costcenter"},
+		{method: http.MethodDelete, path: "/v1/nacp/faults"},
+		{method: http.MethodPost, path: "/v1/nacp/exemptions"},
+		{method: http.MethodDelete, path: "/v1/nacp/exemptions/1"},
+		{method: http.MethodPut, path: "/v1/nacp/maintenance"},
+		{method: http.MethodDelete, path: "/v1/nacp/maintenance"},
+		{method: http.MethodDelete, path: "/v1/nacp/virtual-tokens/ci"},
+		{method: http.MethodDelete, path: "/v1/nacp/shadow"},
+		{method: http.MethodPost, path: "/v1/nacp/trace/validator/costcenter"},
+	}
+	for _, admin := range []struct {
+		name       string
+		auth       *adminAuth
+		wantStatus int
+	}{
+		{name: "without admin token", auth: withToken, wantStatus: http.StatusUnauthorized},
+		{name: "next to the nomad api without tokens", auth: &adminAuth{}, wantStatus: http.StatusForbidden},
+	} {
+		nacp.admin = admin.auth
+		server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+		for _, write := range writes {
+			t.Run(admin.name+" "+write.method+" "+write.path, func(t *testing.T) {
+				req, err := http.NewRequest(write.method, server.URL+write.path, strings.NewReader(`{}`))
+				require.NoError(t, err)
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				res.Body.Close()
+				assert.Equal(t, admin.wantStatus, res.StatusCode)
+			})
+		}
+		server.Close()
+	}
+	assert.False(t, maintenance.State().Enabled)
+	assert.Empty(t, exemptions.List())
+	assert.Empty(t, nacp.faults.Faults())
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/metrics"
+)
+
+// The Nomad API groups of the apis block.
+const (
+	apiJobs       = "jobs"
+	apiVolumes    = "volumes"
+	apiVariables  = "variables"
+	apiACL        = "acl"
+	apiNamespaces = "namespaces"
+)
+
+// apiGroupPrefixes are the paths of the API groups other than jobs, e.g. /v1/volume/csi/<id> or /v1/var/<path>.
+var apiGroupPrefixes = []struct {
+	group  string
+	prefix string
+}{
+	{apiVolumes, "/v1/volumes"},
+	{apiVolumes, "/v1/volume/"},
+	{apiVariables, "/v1/vars"},
+	{apiVariables, "/v1/var/"},
+	{apiACL, "/v1/acl/"},
+	{apiNamespaces, "/v1/namespaces"},
+	{apiNamespaces, "/v1/namespace/"},
+}
+
+// apiGroupOf returns the API group of the request, it is empty for requests of no group, e.g. quotas or node metadata.
+func apiGroupOf(r *http.Request) string {
+	if matchRoute(r).Operation != "" {
+		return apiJobs
+	}
+	p := r.URL.Path
+	if p == "/v1/jobs" || strings.HasPrefix(p, "/v1/jobs/") || strings.HasPrefix(p, "/v1/job/") || p == "/v1/validate/job" {
+		return apiJobs
+	}
+	for _, g := range apiGroupPrefixes {
+		if strings.HasPrefix(p, g.prefix) {
+			return g.group
+		}
+	}
+	return ""
+}
+
+type apiGroup struct {
+	enabled bool
+	audit   bool
+}
+
+// apiPolicy decides which API groups NACP handles, a nil policy handles and enforces all of them.
+type apiPolicy struct {
+	groups map[string]apiGroup
+	logger hclog.Logger
+}
+
+// buildAPIPolicy returns the policy of the apis block, it is nil if the block is missing.
+// Jobs are handled unless disabled, the other groups only if their block is present.
+func buildAPIPolicy(c *config.Config, logger hclog.Logger) *apiPolicy {
+	if c.APIs == nil {
+		return nil
+	}
+	p := &apiPolicy{
+		groups: map[string]apiGroup{apiJobs: {enabled: true}},
+		logger: logger,
+	}
+	for name, group := range map[string]*config.APIGroup{
+		apiJobs:       c.APIs.Jobs,
+		apiVolumes:    c.APIs.Volumes,
+		apiVariables:  c.APIs.Variables,
+		apiACL:        c.APIs.ACL,
+		apiNamespaces: c.APIs.Namespaces,
+	} {
+		if group == nil {
+			continue
+		}
+		p.groups[name] = apiGroup{
+			enabled: group.Enabled == nil || *group.Enabled,
+			audit:   group.Enforcement == "audit",
+		}
+	}
+	return p
+}
+
+// handles reports whether requests of the group are checked, requests of no group always are.
+func (p *apiPolicy) handles(group string) bool {
+	if p == nil || group == "" {
+		return true
+	}
+	return p.groups[group].enabled
+}
+
+// audits reports whether rejections of requests of the group are only logged.
+func (p *apiPolicy) audits(group string) bool {
+	if p == nil || group == "" {
+		return false
+	}
+	return p.groups[group].audit
+}
+
+// WithAPIs only handles the requests of the enabled API groups, the ones of audited groups are never rejected.
+func WithAPIs(policy *apiPolicy) ProxyOption {
+	return func(o *proxyOptions) {
+		o.apis = policy
+	}
+}
+
+// auditedAdmission runs the admission of a request of an audited group, a rejection is logged and the
+// original request is passed on instead.
+func auditedAdmission(r *http.Request, group string, policy *apiPolicy, admit func(*http.Request) (*http.Request, error)) (*http.Request, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return r, err
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	admitted, err := admit(r.Clone(r.Context()))
+	if err == nil {
+		return admitted, nil
+	}
+	metrics.APIAuditedRejections.WithLabelValues(group).Inc()
+	policy.logger.Warn("Request would be rejected, passing it on as the API is audited", "group", group, "path", r.URL.Path, "method", r.Method, "error", err)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return r, nil
+}
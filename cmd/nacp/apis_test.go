@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIGroupOf(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodPut, "/v1/jobs", apiJobs},
+		{http.MethodGet, "/v1/job/web/allocations", apiJobs},
+		{http.MethodPost, "/v1/allocation/1234/stop", apiJobs},
+		{http.MethodPut, "/v1/volume/csi/data", apiVolumes},
+		{http.MethodGet, "/v1/volumes", apiVolumes},
+		{http.MethodPut, "/v1/var/nomad/jobs/web", apiVariables},
+		{http.MethodGet, "/v1/vars", apiVariables},
+		{http.MethodPost, "/v1/acl/policy/deploy", apiACL},
+		{http.MethodPut, "/v1/namespace/team-a", apiNamespaces},
+		{http.MethodGet, "/v1/namespaces", apiNamespaces},
+		{http.MethodPut, "/v1/quota/default", ""},
+		{http.MethodGet, "/v1/jobsfoo", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, apiGroupOf(httptest.NewRequest(tt.method, tt.path, nil)))
+		})
+	}
+}
+
+func TestBuildAPIPolicy(t *testing.T) {
+	assert.Nil(t, buildAPIPolicy(&config.Config{}, hclog.NewNullLogger()))
+	var missing *apiPolicy
+	assert.True(t, missing.handles(apiVolumes))
+	assert.False(t, missing.audits(apiJobs))
+
+	disabled := false
+	policy := buildAPIPolicy(&config.Config{APIs: &config.APIs{
+		Variables:  &config.APIGroup{Enforcement: "audit"},
+		Namespaces: &config.APIGroup{Enabled: &disabled},
+	}}, hclog.NewNullLogger())
+	assert.True(t, policy.handles(apiJobs), "jobs are handled unless disabled")
+	assert.False(t, policy.audits(apiJobs))
+	assert.True(t, policy.handles(apiVariables))
+	assert.True(t, policy.audits(apiVariables))
+	assert.False(t, policy.handles(apiVolumes), "groups are opt-in")
+	assert.False(t, policy.handles(apiNamespaces))
+	assert.True(t, policy.handles(""), "requests of no group are handled")
+}
+
+func TestProxyAPIs(t *testing.T) {
+	var upstreamBody string
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		upstreamBody = string(body)
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, errors.New("denied"))
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger(), false)
+	volumes, err := NewPathInterceptor("volumes", "/v1/volume/csi/*", http.MethodPut)
+	require.NoError(t, err)
+	volumes.OnRequest = func(r *http.Request) (*http.Request, error) {
+		return r, errors.New("volume denied")
+	}
+	job := registerRequestJson(t, testutil.ReadJob(t, "job.json"))
+	disabled := false
+
+	tests := []struct {
+		name       string
+		apis       *config.APIs
+		path       string
+		wantStatus int
+	}{
+		{name: "jobs without apis block", path: "/v1/jobs", wantStatus: http.StatusInternalServerError},
+		{name: "jobs enforced", apis: &config.APIs{}, path: "/v1/jobs", wantStatus: http.StatusInternalServerError},
+		{name: "jobs disabled", apis: &config.APIs{Jobs: &config.APIGroup{Enabled: &disabled}}, path: "/v1/jobs", wantStatus: http.StatusOK},
+		{name: "jobs audited", apis: &config.APIs{Jobs: &config.APIGroup{Enforcement: "audit"}}, path: "/v1/jobs", wantStatus: http.StatusOK},
+		{name: "volumes without apis block", path: "/v1/volume/csi/data", wantStatus: http.StatusInternalServerError},
+		{name: "volumes not enabled", apis: &config.APIs{}, path: "/v1/volume/csi/data", wantStatus: http.StatusOK},
+		{name: "volumes enabled", apis: &config.APIs{Volumes: &config.APIGroup{}}, path: "/v1/volume/csi/data", wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamBody = ""
+			opts := []ProxyOption{WithInterceptor(volumes)}
+			if tt.apis != nil {
+				opts = append(opts, WithAPIs(buildAPIPolicy(&config.Config{APIs: tt.apis}, hclog.NewNullLogger())))
+			}
+			proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, opts...)
+
+			rr := httptest.NewRecorder()
+			proxy(rr, httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(job)))
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.JSONEq(t, job, upstreamBody, "the original request is passed on")
+			} else {
+				assert.Empty(t, upstreamBody)
+			}
+		})
+	}
+}
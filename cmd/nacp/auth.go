@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/auth"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/pkg/admission"
+)
+
+// buildAuthenticator discovers the OIDC issuer, nil if the auth block is missing.
+func buildAuthenticator(c *config.Config, logger hclog.Logger) (*auth.Authenticator, error) {
+	if c.Auth == nil {
+		return nil, nil
+	}
+	sessionTTL, err := time.ParseDuration(c.Auth.SessionTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth session_ttl: %w", err)
+	}
+	var tokens auth.TokenSource = auth.StaticTokens(c.Auth.TokenMappings)
+	if c.Auth.TokenExchange != nil {
+		client, err := admission.NomadClient(c)
+		if err != nil {
+			return nil, err
+		}
+		tokens = &auth.NomadTokenExchange{Client: client, AuthMethod: c.Auth.TokenExchange.AuthMethod}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), nomadTimeout)
+	defer cancel()
+	oidc := c.Auth.OIDC
+	return auth.NewAuthenticator(ctx, auth.Config{
+		Issuer:        oidc.Issuer,
+		ClientID:      oidc.ClientID,
+		ClientSecret:  oidc.ClientSecret,
+		RedirectURL:   oidc.RedirectURL,
+		Scopes:        oidc.Scopes,
+		IdentityClaim: oidc.IdentityClaim,
+		GroupsClaim:   oidc.GroupsClaim,
+		SessionTTL:    sessionTTL,
+	}, tokens, logger)
+}
+
+// buildTokenVendor discovers the CI issuers, nil if the token_vending block is missing.
+// The Nomad token of NACP needs the permission to create tokens.
+func buildTokenVendor(c *config.Config, logger hclog.Logger) (*auth.TokenVendor, error) {
+	if c.TokenVending == nil {
+		return nil, nil
+	}
+	var issuers []auth.VendingIssuer
+	for _, issuer := range c.TokenVending.Issuers {
+		issuers = append(issuers, auth.VendingIssuer{Name: issuer.Name, URL: issuer.URL, Audience: issuer.Audience})
+	}
+	policies, err := admission.BuildVendingPolicies(c, logger)
+	if err != nil {
+		return nil, err
+	}
+	var roles []auth.VendingRole
+	for _, role := range c.TokenVending.Roles {
+		ttl, err := time.ParseDuration(role.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl of token_vending role %s: %w", role.Name, err)
+		}
+		vendingRole := auth.VendingRole{
+			Name:        role.Name,
+			Issuer:      role.Issuer,
+			BoundClaims: role.BoundClaims,
+			Policies:    role.Policies,
+			TTL:         ttl,
+		}
+		if policy, ok := policies[role.Name]; ok {
+			vendingRole.Policy = &vendingPolicy{validator: policy}
+		}
+		roles = append(roles, vendingRole)
+	}
+	client, err := admission.NomadClient(c)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), nomadTimeout)
+	defer cancel()
+	return auth.NewTokenVendor(ctx, issuers, roles, client.ACLTokens(), logger)
+}
+
+// vendingPolicy evaluates the OPA policy of a token_vending role, the claims are passed as identityClaims and the
+// policies of the role as policies of the request context.
+type vendingPolicy struct {
+	validator admissionctrl.JobValidator
+}
+
+func (p *vendingPolicy) Authorize(ctx context.Context, subject string, claims map[string]interface{}, policies []string) error {
+	identityClaims := make(map[string]string, len(claims))
+	for name, value := range claims {
+		identityClaims[name] = fmt.Sprint(value)
+	}
+	payload := &types.Payload{Context: &config.RequestContext{
+		Operation:      config.OperationTokenVending,
+		Identity:       subject,
+		IdentityClaims: identityClaims,
+		Policies:       policies,
+	}}
+	_, err := admissionctrl.ValidateContext(ctx, p.validator, payload)
+	return err
+}
+
+// buildVirtualTokens returns the token translation of the virtual_tokens block, nil if the block is missing.
+// The Nomad token of NACP needs the permission to create and delete tokens.
+func buildVirtualTokens(c *config.Config, logger hclog.Logger) (*auth.VirtualTokens, error) {
+	if c.VirtualTokens == nil {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(c.VirtualTokens.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid virtual_tokens ttl: %w", err)
+	}
+	renewBefore, err := time.ParseDuration(c.VirtualTokens.RenewBefore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid virtual_tokens renew_before: %w", err)
+	}
+	var credentials []auth.VirtualCredential
+	for _, credential := range c.VirtualTokens.Credentials {
+		credentials = append(credentials, auth.VirtualCredential{
+			Name:       credential.Name,
+			SecretHash: credential.SecretSHA256,
+			Policies:   credential.Policies,
+		})
+	}
+	client, err := admission.NomadClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewVirtualTokens(credentials, client.ACLTokens(), ttl, renewBefore, c.VirtualTokens.Exclusive, logger), nil
+}
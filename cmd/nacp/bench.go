@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/pkg/admission"
+)
+
+const benchUsage = "usage: nacp bench -config nacp.hcl [-n 100] <job.json|dir>..."
+
+var benchMetrics = []string{"/gc/heap/allocs:bytes", "/gc/heap/allocs:objects"}
+
+// benchResult collects the measurements of one rule.
+type benchResult struct {
+	kind      string
+	name      string
+	durations []time.Duration
+	bytes     uint64
+	objects   uint64
+	failures  int
+}
+
+// runBench implements "nacp bench", it replays a corpus of jobs through the rules of a config and reports their latencies.
+func runBench(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	configFile := flags.String("config", defaultConfigPath(), "nacp config file")
+	iterations := flags.Int("n", 100, "how often every job is replayed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *configFile == "" || flags.NArg() == 0 || *iterations < 1 {
+		return errors.New(benchUsage)
+	}
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	corpus, err := loadCorpus(flags.Args())
+	if err != nil {
+		return err
+	}
+	mutators, validators, _, err := admission.BuildRules(c, hclog.NewNullLogger())
+	if err != nil {
+		return err
+	}
+	results := bench(mutators, validators, corpus, *iterations)
+	writeBenchReport(stdout, results, len(corpus), *iterations)
+	return nil
+}
+
+// loadCorpus reads the payloads of the given files and the .json files of the given directories.
+// A file holds a job, a job register request or a payload with job and context.
+func loadCorpus(paths []string) ([]*types.Payload, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("the corpus contains no jobs")
+	}
+	corpus := make([]*types.Payload, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := decodePayload(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		corpus = append(corpus, payload)
+	}
+	return corpus, nil
+}
+
+// bench runs the rules like the job handler, the mutators in order on the mutated job, then every validator.
+// Rejections are counted as failures, the rules still run on.
+func bench(mutators []admissionctrl.JobMutator, validators []admissionctrl.JobValidator, corpus []*types.Payload, iterations int) []*benchResult {
+	var results []*benchResult
+	mutatorResults := make([]*benchResult, len(mutators))
+	for i, m := range mutators {
+		mutatorResults[i] = &benchResult{kind: "mutator", name: m.Name()}
+	}
+	validatorResults := make([]*benchResult, len(validators))
+	for i, v := range validators {
+		validatorResults[i] = &benchResult{kind: "validator", name: v.Name()}
+	}
+	results = append(mutatorResults, validatorResults...)
+
+	samples := make([]metrics.Sample, len(benchMetrics))
+	for i, name := range benchMetrics {
+		samples[i].Name = name
+	}
+	measure := func(result *benchResult, run func() error) {
+		metrics.Read(samples)
+		bytes, objects := samples[0].Value.Uint64(), samples[1].Value.Uint64()
+		start := time.Now()
+		err := run()
+		result.durations = append(result.durations, time.Since(start))
+		metrics.Read(samples)
+		result.bytes += samples[0].Value.Uint64() - bytes
+		result.objects += samples[1].Value.Uint64() - objects
+		if err != nil {
+			result.failures++
+		}
+	}
+
+	for n := 0; n < iterations; n++ {
+		for _, original := range corpus {
+			payload := &types.Payload{Job: copyJob(original.Job), Context: original.Context, Data: original.Data}
+			for i, m := range mutators {
+				measure(mutatorResults[i], func() error {
+					job, _, err := m.Mutate(payload)
+					if err == nil {
+						payload = &types.Payload{Job: job, Context: payload.Context, Data: payload.Data}
+					}
+					return err
+				})
+			}
+			for i, v := range validators {
+				measure(validatorResults[i], func() error {
+					_, err := v.Validate(payload)
+					return err
+				})
+			}
+		}
+	}
+	return results
+}
+
+// copyJob gives every run its own job, mutators may change the job in place.
+func copyJob(job *api.Job) *api.Job {
+	data, _ := json.Marshal(job)
+	copied := &api.Job{}
+	_ = json.Unmarshal(data, copied)
+	return copied
+}
+
+func writeBenchReport(w io.Writer, results []*benchResult, jobs, iterations int) {
+	fmt.Fprintf(w, "%d jobs, %d iterations\n\n", jobs, iterations)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tRUNS\tP50\tP95\tALLOCS/OP\tBYTES/OP\tFAILURES")
+	for _, r := range results {
+		runs := len(r.durations)
+		slices.Sort(r.durations)
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%d\t%d\t%d\n", r.kind, r.name, runs,
+			percentile(r.durations, 50), percentile(r.durations, 95),
+			r.objects/uint64(runs), r.bytes/uint64(runs), r.failures)
+	}
+	tw.Flush()
+}
+
+// percentile of sorted durations with the nearest rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
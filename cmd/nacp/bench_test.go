@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunBench(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "nacp.hcl")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+validator "opa" "errors" {
+  opa_rule {
+    query    = "errors = data.dummy.errors"
+    filename = "%s"
+  }
+}
+mutator "meta" "meta" {
+  meta {
+    key "team" {
+      default = "platform"
+    }
+  }
+}
+`, testutil.Filepath(t, "opa/errors.rego"))), 0644))
+	corpus := filepath.Join(dir, "corpus")
+	require.NoError(t, os.Mkdir(corpus, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(corpus, "job.json"), []byte(`{"ID": "app", "Meta": {"Team": "a"}}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(corpus, "register.json"), []byte(`{"Job": {"ID": "api"}}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(corpus, "payload.json"), []byte(`{"job": {"ID": "web"}, "context": {"clientIP": "127.0.0.1"}}`), 0644))
+
+	out := &bytes.Buffer{}
+	require.NoError(t, runBench([]string{"-config", configFile, "-n", "3", corpus}, out))
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 5)
+	assert.Equal(t, "3 jobs, 3 iterations", string(lines[0]))
+	assert.Regexp(t, `^KIND\s+NAME\s+RUNS\s+P50\s+P95\s+ALLOCS/OP\s+BYTES/OP\s+FAILURES$`, string(lines[2]))
+	assert.Regexp(t, `^mutator\s+meta\s+9\s+\S+\s+\S+\s+\d+\s+\d+\s+0$`, string(lines[3]))
+	assert.Regexp(t, `^validator\s+errors\s+9\s+\S+\s+\S+\s+\d+\s+\d+\s+9$`, string(lines[4]))
+
+	assert.EqualError(t, runBench([]string{"-config", configFile}, out), benchUsage)
+	assert.Error(t, runBench([]string{"-config", configFile, filepath.Join(dir, "missing")}, out))
+}
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 1; i <= 20; i++ {
+		durations = append(durations, time.Duration(i))
+	}
+	assert.Equal(t, time.Duration(10), percentile(durations, 50))
+	assert.Equal(t, time.Duration(19), percentile(durations, 95))
+	assert.Equal(t, time.Duration(1), percentile(durations[:1], 95))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"path"
+	"slices"
+
+	"github.com/mxab/nacp/config"
+)
+
+// certPolicies grants virtual policies to verified client certificates, so rules can tell submitters apart without Nomad ACLs.
+type certPolicies struct {
+	bindings []config.CertBinding
+}
+
+// buildCertPolicies returns the bindings of the client_cert block, it is nil if the block is missing.
+func buildCertPolicies(c *config.Config) *certPolicies {
+	if c.ClientCert == nil {
+		return nil
+	}
+	return &certPolicies{bindings: c.ClientCert.Bindings}
+}
+
+// resolve returns the sorted policies of all bindings matching the verified client certificate of the connection.
+func (p *certPolicies) resolve(state *tls.ConnectionState) []string {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	cert := state.VerifiedChains[0][0]
+	sans := certSANs(cert)
+	var policies []string
+	for _, binding := range p.bindings {
+		if matchesAnySAN(binding.SANs, sans) && (len(binding.OUs) == 0 || containsAny(binding.OUs, cert.Subject.OrganizationalUnit)) {
+			policies = append(policies, binding.Policies...)
+		}
+	}
+	slices.Sort(policies)
+	return slices.Compact(policies)
+}
+
+func certSANs(cert *x509.Certificate) []string {
+	sans := slices.Concat(cert.DNSNames, cert.EmailAddresses)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+func matchesAnySAN(patterns, sans []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, san := range sans {
+			if ok, _ := path.Match(pattern, san); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsAny(wanted, values []string) bool {
+	for _, value := range values {
+		if slices.Contains(wanted, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func verifiedConnection(cert *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestCertPolicies_Resolve(t *testing.T) {
+	ci, err := url.Parse("spiffe://example.com/ci/deployer")
+	require.NoError(t, err)
+	policies := buildCertPolicies(&config.Config{ClientCert: &config.ClientCert{Bindings: []config.CertBinding{
+		{SANs: []string{"*.ci.example.com", "spiffe://example.com/ci/*"}, Policies: []string{"deploy"}},
+		{OUs: []string{"platform"}, Policies: []string{"ops-admin", "deploy"}},
+		{SANs: []string{"*.ci.example.com"}, OUs: []string{"platform"}, Policies: []string{"ci-admin"}},
+	}}})
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want []string
+	}{
+		{name: "dns san", cert: &x509.Certificate{DNSNames: []string{"runner-1.ci.example.com"}}, want: []string{"deploy"}},
+		{name: "uri san", cert: &x509.Certificate{URIs: []*url.URL{ci}}, want: []string{"deploy"}},
+		{name: "ou", cert: &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"platform"}}}, want: []string{"deploy", "ops-admin"}},
+		{
+			name: "san and ou",
+			cert: &x509.Certificate{DNSNames: []string{"runner-1.ci.example.com"}, Subject: pkix.Name{OrganizationalUnit: []string{"platform"}}},
+			want: []string{"ci-admin", "deploy", "ops-admin"},
+		},
+		{name: "no match", cert: &x509.Certificate{DNSNames: []string{"laptop.example.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policies.resolve(verifiedConnection(tt.cert)))
+		})
+	}
+
+	assert.Nil(t, policies.resolve(nil), "plain http")
+	assert.Nil(t, policies.resolve(&tls.ConnectionState{}), "no verified certificate")
+}
+
+func TestProxyAddsCertPolicies(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.MatchedBy(func(payload *types.Payload) bool {
+		return assert.ObjectsAreEqual([]string{"deploy"}, payload.Context.CertPolicies) &&
+			assert.ObjectsAreEqual([]string{"deploy"}, payload.Context.Policies)
+	})).Return([]error{}, nil)
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger(), false)
+	policies := buildCertPolicies(&config.Config{ClientCert: &config.ClientCert{Bindings: []config.CertBinding{
+		{SANs: []string{"*.ci.example.com"}, Policies: []string{"deploy"}},
+	}}})
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithCertPolicies(policies))
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/jobs", strings.NewReader(registerRequestJson(t, testutil.ReadJob(t, "job.json"))))
+	req.TLS = verifiedConnection(&x509.Certificate{DNSNames: []string{"runner-1.ci.example.com"}})
+	rr := httptest.NewRecorder()
+	proxy(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	validator.AssertExpectations(t)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mxab/nacp/admissionctrl/opa"
+	"github.com/mxab/nacp/config"
+)
+
+const configUsage = "usage: nacp config schema | nacp config validate <config file>"
+
+// runConfigCommand implements "nacp config schema", it prints the JSON schema of the config file,
+// and "nacp config validate", it loads a config file and lints its OPA policies in strict mode.
+func runConfigCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+	switch {
+	case args[0] == "schema" && len(args) == 1:
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(config.Schema())
+	case args[0] == "validate" && len(args) == 2:
+		return validateConfig(args[1], stdout)
+	}
+	return errors.New(configUsage)
+}
+
+// validateConfig reports every failing policy, not only the first one.
+func validateConfig(path string, stdout io.Writer) error {
+	c, err := config.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	var rules []*config.OpaRule
+	for _, m := range c.Mutators {
+		rules = append(rules, m.OpaRule)
+	}
+	for _, v := range c.Validators {
+		rules = append(rules, v.OpaRule)
+	}
+	failed := 0
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		if err := opa.Lint(context.Background(), rule.Filename, rule.Query); err != nil {
+			fmt.Fprintln(stdout, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("policies failing the lint: %d", failed)
+	}
+	fmt.Fprintf(stdout, "%s is valid\n", path)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunConfigCommand(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.NoError(t, runConfigCommand([]string{"schema"}, out))
+
+	schema := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &schema))
+	assert.Equal(t, "NACP configuration", schema["title"])
+	assert.Contains(t, schema["properties"], "validator")
+
+	assert.Error(t, runConfigCommand(nil, out))
+	assert.Error(t, runConfigCommand([]string{"validate"}, out))
+	assert.Error(t, runConfigCommand([]string{"lint", "nacp.hcl"}, out))
+}
+
+func TestRunConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	deprecated := filepath.Join(dir, "deprecated.rego")
+	require.NoError(t, os.WriteFile(deprecated, []byte(`package deprecated
+errors[msg] {
+	any([true])
+	msg := "x"
+}`), 0644))
+
+	writeConfig := func(policy, query string) string {
+		path := filepath.Join(dir, "nacp.hcl")
+		require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+validator "opa" "library" {
+  opa_rule {
+    query    = "errors = data.library.errors"
+    filename = "%s"
+  }
+}
+mutator "opa_json_patch" "other" {
+  opa_rule {
+    query    = "%s"
+    filename = "%s"
+  }
+}
+`, testutil.Filepath(t, "opa/library.rego"), query, policy)), 0644))
+		return path
+	}
+
+	out := &bytes.Buffer{}
+	valid := writeConfig(testutil.Filepath(t, "opa/library.rego"), "patch = data.library.errors")
+	require.NoError(t, runConfigCommand([]string{"validate", valid}, out))
+	assert.Contains(t, out.String(), "is valid")
+
+	out.Reset()
+	invalid := writeConfig(deprecated, "patch = data.deprecated.patch")
+	err := runConfigCommand([]string{"validate", invalid}, out)
+	assert.EqualError(t, err, "policies failing the lint: 1")
+	assert.Contains(t, out.String(), deprecated+":3: deprecated built-in function calls in expression: any")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxab/nacp/config"
+)
+
+var (
+	corsMethods = strings.Join([]string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions}, ", ")
+	// corsExposedHeaders are read by the Nomad UI for blocking queries
+	corsExposedHeaders = strings.Join([]string{"X-Nomad-Index", "X-Nomad-KnownLeader", "X-Nomad-LastContact"}, ", ")
+)
+
+// corsPolicy answers preflight requests itself and replaces the CORS headers of Nomad's responses with the configured ones.
+type corsPolicy struct {
+	origins     []string
+	headers     string
+	credentials bool
+	maxAge      string
+}
+
+func newCorsPolicy(c *config.CORS) *corsPolicy {
+	maxAge, _ := time.ParseDuration(c.MaxAge)
+	return &corsPolicy{
+		origins:     c.AllowedOrigins,
+		headers:     strings.Join(c.AllowedHeaders, ", "),
+		credentials: c.AllowCredentials,
+		maxAge:      strconv.Itoa(int(maxAge.Seconds())),
+	}
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	return origin != "" && (slices.Contains(p.origins, "*") || slices.Contains(p.origins, origin))
+}
+
+// apply sets the CORS headers for the origin of the request.
+func (p *corsPolicy) apply(h http.Header, origin string) {
+	dropCorsHeaders(h)
+	h.Add("Vary", "Origin")
+	if !p.allowed(origin) {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflight answers a preflight request, it returns false for all other requests.
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	p.apply(w.Header(), origin)
+	if !p.allowed(origin) {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+	w.Header().Set("Access-Control-Allow-Headers", p.headers)
+	w.Header().Set("Access-Control-Max-Age", p.maxAge)
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// dropCorsHeaders removes the CORS headers, e.g. the permissive ones Nomad sets on some endpoints.
+func dropCorsHeaders(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(name, "Access-Control-") {
+			h.Del(name)
+		}
+	}
+}
+
+// WithCORS allows browsers of other origins to call Nomad through the proxy.
+func WithCORS(policy *corsPolicy) ProxyOption {
+	return func(o *proxyOptions) {
+		o.cors = policy
+	}
+}
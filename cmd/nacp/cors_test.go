@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorsPolicyPreflight(t *testing.T) {
+	policy := newCorsPolicy(&config.CORS{
+		AllowedOrigins:   []string{"https://ui.example.com"},
+		AllowedHeaders:   config.DefaultCORSHeaders,
+		AllowCredentials: true,
+		MaxAge:           "10m",
+	})
+	tt := []struct {
+		name          string
+		method        string
+		origin        string
+		requestMethod string
+		wantHandled   bool
+		wantStatus    int
+		wantOrigin    string
+	}{
+		{name: "allowed origin", method: http.MethodOptions, origin: "https://ui.example.com", requestMethod: http.MethodPost, wantHandled: true, wantStatus: http.StatusNoContent, wantOrigin: "https://ui.example.com"},
+		{name: "other origin", method: http.MethodOptions, origin: "https://evil.example.com", requestMethod: http.MethodPost, wantHandled: true, wantStatus: http.StatusForbidden},
+		{name: "plain options request", method: http.MethodOptions, origin: "https://ui.example.com"},
+		{name: "no preflight", method: http.MethodGet, origin: "https://ui.example.com"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/v1/jobs", nil)
+			req.Header.Set("Origin", tc.origin)
+			if tc.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tc.requestMethod)
+			}
+			rec := httptest.NewRecorder()
+
+			assert.Equal(t, tc.wantHandled, policy.preflight(rec, req))
+			if !tc.wantHandled {
+				return
+			}
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			assert.Equal(t, tc.wantOrigin, rec.Header().Get("Access-Control-Allow-Origin"))
+			if tc.wantOrigin != "" {
+				assert.Equal(t, "Content-Type, X-Nomad-Token", rec.Header().Get("Access-Control-Allow-Headers"))
+				assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+				assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+			}
+		})
+	}
+}
+
+func TestCorsPolicyApply(t *testing.T) {
+	policy := newCorsPolicy(&config.CORS{AllowedOrigins: []string{"*"}, MaxAge: "10m"})
+
+	h := http.Header{}
+	h.Set("Access-Control-Allow-Methods", "HEAD, GET")
+	policy.apply(h, "https://ui.example.com")
+
+	assert.Equal(t, "https://ui.example.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Nomad-Index, X-Nomad-KnownLeader, X-Nomad-LastContact", h.Get("Access-Control-Expose-Headers"))
+	assert.Empty(t, h.Get("Access-Control-Allow-Methods"))
+	assert.Empty(t, h.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin", h.Get("Vary"))
+}
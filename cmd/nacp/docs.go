@@ -0,0 +1,127 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/pkg/admission"
+)
+
+//go:embed docs/*.tmpl
+var docsTemplates embed.FS
+
+type docsSection struct {
+	Title string
+	Rules []admission.RuleDoc
+}
+
+type docsParams struct {
+	Generated string
+	Sections  []docsSection
+}
+
+var docsFuncs = map[string]interface{}{
+	"scope": describeScope,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return string(data), err
+	},
+	"exemption": func(e config.Exemption) string {
+		target := "all jobs"
+		if e.Job != "" {
+			target = "jobs matching " + e.Job
+		}
+		if e.Namespace != "" {
+			target += " in namespace " + e.Namespace
+		}
+		return target + " until " + e.Expires + ": " + e.Reason
+	},
+}
+
+// runDocs implements "nacp docs", it writes the documentation of the rules of a config for tenants.
+func runDocs(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("docs", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	configFile := flags.String("config", defaultConfigPath(), "nacp config file")
+	format := flags.String("format", "markdown", "markdown or html")
+	out := flags.String("out", "", "output file, defaults to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *configFile == "" {
+		return errors.New("usage: nacp docs -config nacp.hcl [-format markdown|html] [-out file]")
+	}
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	docs, err := admission.Docs(c)
+	if err != nil {
+		return err
+	}
+	params := docsParams{Generated: time.Now().UTC().Format(time.DateOnly)}
+	validators := docsSection{Title: "Validators"}
+	mutators := docsSection{Title: "Mutators"}
+	for _, doc := range docs {
+		if doc.Kind == "validator" {
+			validators.Rules = append(validators.Rules, doc)
+		} else {
+			mutators.Rules = append(mutators.Rules, doc)
+		}
+	}
+	params.Sections = []docsSection{validators, mutators}
+
+	var t interface {
+		Execute(io.Writer, interface{}) error
+	}
+	switch *format {
+	case "markdown":
+		t, err = template.New("policies.md.tmpl").Funcs(docsFuncs).ParseFS(docsTemplates, "docs/policies.md.tmpl")
+	case "html":
+		t, err = htmltemplate.New("policies.html.tmpl").Funcs(docsFuncs).ParseFS(docsTemplates, "docs/policies.html.tmpl")
+	default:
+		return errors.New("unsupported format " + *format + ", use markdown or html")
+	}
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return t.Execute(stdout, params)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	err = t.Execute(f, params)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// describeScope tells which jobs a rule applies to.
+func describeScope(jobs *config.Jobs) string {
+	if jobs == nil {
+		return "all jobs"
+	}
+	var parts []string
+	if include := append(append([]string{}, jobs.Include...), jobs.IncludeRegex...); len(include) > 0 {
+		parts = append(parts, "jobs matching "+strings.Join(include, ", "))
+	} else {
+		parts = append(parts, "all jobs")
+	}
+	if exclude := append(append([]string{}, jobs.Exclude...), jobs.ExcludeRegex...); len(exclude) > 0 {
+		parts = append(parts, "except "+strings.Join(exclude, ", "))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const docsConfig = `
+validator "opa" "costcenter" {
+  opa_rule {
+    query    = "errors = data.costcenter.errors"
+    filename = "%s"
+  }
+  jobs {
+    exclude = ["legacy-*"]
+  }
+}
+validator "priority" "priority" {
+  severity = "warning"
+  priority {
+    max = 70
+  }
+}
+mutator "json_patch_webhook" "hook" {
+  webhook {
+    endpoint = "http://localhost:8080"
+    method   = "POST"
+  }
+}
+exemptions {
+  exemption "costcenter" {
+    job     = "batch-*"
+    expires = "2030-01-01"
+    reason  = "migration"
+  }
+}
+`
+
+const docsPolicy = `# METADATA
+# title: Cost center
+# description: Every job must be billed to a <cost center>.
+package costcenter
+
+# METADATA
+# title: Missing cost center
+errors[msg] {
+	not input.job.Meta.costcenter
+	msg := "missing costcenter"
+}
+`
+
+func writeDocsConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	policy := filepath.Join(dir, "costcenter.rego")
+	require.NoError(t, os.WriteFile(policy, []byte(docsPolicy), 0644))
+	configFile := filepath.Join(dir, "nacp.hcl")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(docsConfig, policy)), 0644))
+	return configFile
+}
+
+func TestRunDocsMarkdown(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.NoError(t, runDocs([]string{"-config", writeDocsConfig(t)}, out))
+
+	md := out.String()
+	assert.Contains(t, md, "## Validators\n\n### Cost center\n")
+	assert.Contains(t, md, "- Enforcement: **deny**\n- Applies to: all jobs except legacy-*\n")
+	assert.Contains(t, md, "Every job must be billed to a <cost center>.")
+	assert.Contains(t, md, "Messages:\n\n- Missing cost center\n")
+	assert.Contains(t, md, "- jobs matching batch-* until 2030-01-01: migration")
+	assert.Contains(t, md, "- Enforcement: **warn**")
+	assert.Contains(t, md, "```json\n{\n  \"max\": 70\n}\n```")
+	assert.Contains(t, md, "\n\n## Mutators\n\n### hook\n")
+	assert.NotContains(t, md, "localhost:8080", "webhook endpoints are not published")
+	assert.NotContains(t, md, "\n\n\n")
+}
+
+func TestRunDocsHTML(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "policies.html")
+	require.NoError(t, runDocs([]string{"-config", writeDocsConfig(t), "-format", "html", "-out", outFile}, &bytes.Buffer{}))
+
+	data, err := os.ReadFile(outFile)
+	require.NoError(t, err)
+	html := string(data)
+	assert.Contains(t, html, `<section id="costcenter">`)
+	assert.Contains(t, html, "<p>Every job must be billed to a &lt;cost center&gt;.</p>")
+	assert.Contains(t, html, "<li>Enforcement: <strong>warn</strong></li>")
+}
+
+func TestRunDocsFails(t *testing.T) {
+	configFile := writeDocsConfig(t)
+	tt := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "no config", args: []string{"-config", ""}, want: "usage: nacp docs"},
+		{name: "missing config", args: []string{"-config", "missing.hcl"}, want: "missing.hcl"},
+		{name: "unknown format", args: []string{"-config", configFile, "-format", "pdf"}, want: "unsupported format pdf"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorContains(t, runDocs(tc.args, &bytes.Buffer{}), tc.want)
+		})
+	}
+}
+
+func TestDescribeScope(t *testing.T) {
+	tt := []struct {
+		jobs *config.Jobs
+		want string
+	}{
+		{want: "all jobs"},
+		{jobs: &config.Jobs{Include: []string{"web-*"}, IncludeRegex: []string{"^api"}}, want: "jobs matching web-*, ^api"},
+		{jobs: &config.Jobs{Include: []string{"web-*"}, Exclude: []string{"web-legacy"}}, want: "jobs matching web-* except web-legacy"},
+		{jobs: &config.Jobs{ExcludeRegex: []string{"-test$"}}, want: "all jobs except -test$"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, describeScope(tc.jobs))
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/audit"
+	"github.com/mxab/nacp/config"
+)
+
+// buildEventBus creates the exporter of the event_bus block, it is nil if the block is missing.
+func buildEventBus(c *config.Config, logger hclog.Logger) (*audit.Exporter, error) {
+	b := c.EventBus
+	if b == nil {
+		return nil, nil
+	}
+	address, err := url.Parse(b.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event_bus address: %w", err)
+	}
+	var tlsConfig *tls.Config
+	if b.TLS != nil {
+		tlsConfig, err = buildClientTLS(b.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create event_bus tls config: %w", err)
+		}
+	}
+	var writer audit.Writer
+	switch b.Backend {
+	case config.EventBusNATS:
+		writer = audit.NewNATSWriter(address, b.Topic, tlsConfig, b.Username, b.Password, b.Token, currentBuild().Version)
+	case config.EventBusKafka:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig
+		}
+		writer = audit.NewKafkaWriter(address, b.Topic, &http.Client{Transport: transport}, b.Username, b.Password)
+	}
+	return audit.NewExporter("event_bus", writer, b.Decisions, b.BufferSize, logger), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEventBus(t *testing.T) {
+	tests := []struct {
+		name     string
+		eventBus *config.EventBus
+		want     bool
+		wantErr  string
+	}{
+		{name: "no event_bus block"},
+		{
+			name:     "nats",
+			eventBus: &config.EventBus{Backend: "nats", Address: "nats://localhost:4222", Topic: "nacp.decisions", BufferSize: 10},
+			want:     true,
+		},
+		{
+			name:     "kafka",
+			eventBus: &config.EventBus{Backend: "kafka", Address: "https://kafka-rest:8082", Topic: "nacp-decisions", BufferSize: 10, TLS: &config.ClientTLS{ServerName: "kafka-rest"}},
+			want:     true,
+		},
+		{
+			name:     "missing ca file",
+			eventBus: &config.EventBus{Backend: "kafka", Address: "https://kafka-rest:8082", Topic: "nacp-decisions", BufferSize: 10, TLS: &config.ClientTLS{CaFile: "does-not-exist.pem"}},
+			wantErr:  "failed to create event_bus tls config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter, err := buildEventBus(&config.Config{EventBus: tt.eventBus}, hclog.NewNullLogger())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, exporter != nil)
+		})
+	}
+}
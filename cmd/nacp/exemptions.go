@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+)
+
+// buildExemptions creates the exemption registry, nil if the exemptions block is missing.
+func buildExemptions(c *config.Config, logger hclog.Logger) (*admissionctrl.Exemptions, error) {
+	if c.Exemptions == nil {
+		return nil, nil
+	}
+	warnBefore, err := time.ParseDuration(c.Exemptions.WarnBefore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exemptions warn_before: %w", err)
+	}
+	exemptions, err := admissionctrl.NewExemptions(c.Exemptions.File, warnBefore, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := setConfiguredExemptions(exemptions, c); err != nil {
+		return nil, err
+	}
+	return exemptions, nil
+}
+
+// setConfiguredExemptions replaces the exemptions of the config file, the ones added via the admin API are kept.
+func setConfiguredExemptions(exemptions *admissionctrl.Exemptions, c *config.Config) error {
+	var configured []admissionctrl.Exemption
+	if c.Exemptions != nil {
+		for _, e := range c.Exemptions.Exemptions {
+			expires, err := config.ParseExpiry(e.Expires)
+			if err != nil {
+				return fmt.Errorf("invalid expires of exemption for %s: %w", e.Rule, err)
+			}
+			configured = append(configured, admissionctrl.Exemption{
+				Rule:      e.Rule,
+				Namespace: e.Namespace,
+				Job:       e.Job,
+				Expires:   expires,
+				Reason:    e.Reason,
+			})
+		}
+	}
+	return exemptions.SetConfigured(configured)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExemptionsReload(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.hcl")
+	writeConfig := func(job string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(`
+exemptions {
+  file = "`+filepath.Join(dir, "exemptions.json")+`"
+  exemption "costcenter" {
+    job     = "`+job+`"
+    expires = "2099-12-31"
+    reason  = "migration"
+  }
+}
+`), 0o600))
+	}
+	writeConfig("legacy-*")
+
+	c, err := config.LoadConfig(configFile)
+	require.NoError(t, err)
+	exemptions, err := buildExemptions(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	managed, err := exemptions.Add(admissionctrl.Exemption{Rule: "naming", Expires: time.Now().Add(time.Hour), Reason: "rename pending"})
+	require.NoError(t, err)
+
+	list := exemptions.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, admissionctrl.Exemption{
+		ID:      "config-0",
+		Rule:    "costcenter",
+		Job:     "legacy-*",
+		Expires: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		Reason:  "migration",
+		Source:  admissionctrl.ExemptionSourceConfig,
+	}, list[0])
+
+	writeConfig("old-*")
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	reloader := newPolicyReloader(configFile, "", handler, &rulesetStatus{}, hclog.NewNullLogger())
+	reloader.exemptions = exemptions
+	require.NoError(t, reloader.Reload())
+
+	list = exemptions.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "old-*", list[0].Job)
+	assert.Equal(t, managed, list[1], "exemptions added via the API survive a reload")
+}
+
+func TestBuildExemptionsWithoutBlock(t *testing.T) {
+	exemptions, err := buildExemptions(config.DefaultConfig(), hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Nil(t, exemptions)
+}
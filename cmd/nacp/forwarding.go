@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	"github.com/mxab/nacp/config"
+)
+
+// forwardedHeaders controls the X-Forwarded-For and X-Real-IP headers sent to Nomad.
+type forwardedHeaders struct {
+	trusted []*net.IPNet
+	replace bool
+	realIP  bool
+}
+
+func newForwardedHeaders(trusted []*net.IPNet, c *config.ForwardedHeaders) *forwardedHeaders {
+	return &forwardedHeaders{
+		trusted: trusted,
+		replace: c.XForwardedFor == config.ForwardedForReplace,
+		realIP:  c.XRealIP,
+	}
+}
+
+// parseCIDRs accepts CIDRs and single addresses, errors name the setting they belong to.
+func parseCIDRs(setting string, values []string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid %s address %q", setting, value)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s address %q: %w", setting, value, err)
+		}
+		result = append(result, cidr)
+	}
+	return result, nil
+}
+
+func trusts(trusted []*net.IPNet, address string) bool {
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range trusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// apply sets the headers of the outgoing request, the client ip is the one NACP determined for the request.
+// Without configuration the incoming chain is always kept and the peer appended, like a plain reverse proxy.
+func (f *forwardedHeaders) apply(pr *httputil.ProxyRequest, clientIP string) {
+	peer := remoteIP(pr.In)
+	keepChain := f == nil || trusts(f.trusted, peer)
+	if keepChain {
+		// the reverse proxy removes them before the rewrite
+		for _, header := range []string{"Forwarded", "X-Forwarded-Host", "X-Forwarded-Proto"} {
+			if v := pr.In.Header.Values(header); len(v) > 0 {
+				pr.Out.Header[header] = v
+			}
+		}
+	}
+
+	switch {
+	case f != nil && f.replace:
+		pr.Out.Header.Set("X-Forwarded-For", clientIP)
+	case keepChain && len(pr.In.Header.Values("X-Forwarded-For")) > 0:
+		chain := strings.Join(pr.In.Header.Values("X-Forwarded-For"), ", ")
+		pr.Out.Header.Set("X-Forwarded-For", chain+", "+peer)
+	default:
+		pr.Out.Header.Set("X-Forwarded-For", peer)
+	}
+
+	if f != nil && f.realIP {
+		pr.Out.Header.Set("X-Real-IP", clientIP)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	tt := []struct {
+		name           string
+		trustedProxies []string
+		headers        *config.ForwardedHeaders
+		wantFor        string
+		wantRealIP     string
+		wantProto      string
+	}{
+		{
+			name:      "not configured keeps the chain",
+			wantFor:   "203.0.113.7, 127.0.0.1",
+			wantProto: "https",
+		},
+		{
+			name:           "append from trusted proxy",
+			trustedProxies: []string{"127.0.0.0/8"},
+			headers:        &config.ForwardedHeaders{XForwardedFor: config.ForwardedForAppend},
+			wantFor:        "203.0.113.7, 127.0.0.1",
+			wantProto:      "https",
+		},
+		{
+			name:      "append from untrusted peer drops the chain",
+			headers:   &config.ForwardedHeaders{XForwardedFor: config.ForwardedForAppend},
+			wantFor:   "127.0.0.1",
+			wantProto: "",
+		},
+		{
+			name:           "replace",
+			trustedProxies: []string{"127.0.0.1"},
+			headers:        &config.ForwardedHeaders{XForwardedFor: config.ForwardedForReplace, XRealIP: true},
+			wantFor:        "203.0.113.7",
+			wantRealIP:     "203.0.113.7",
+			wantProto:      "https",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				_ = json.NewEncoder(rw).Encode(map[string]string{
+					"for":    req.Header.Get("X-Forwarded-For"),
+					"realIP": req.Header.Get("X-Real-IP"),
+					"proto":  req.Header.Get("X-Forwarded-Proto"),
+				})
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			var opts []ProxyOption
+			if tc.headers != nil {
+				trusted, err := parseCIDRs("trusted_proxies", tc.trustedProxies)
+				require.NoError(t, err)
+				opts = append(opts, WithTrustedProxies(trusted), WithForwardedHeaders(newForwardedHeaders(trusted, tc.headers)))
+			}
+			jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+			proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, opts...)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			req, err := http.NewRequest(http.MethodGet, proxyServer.URL+"/v1/jobs", nil)
+			require.NoError(t, err)
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("X-Real-IP", "198.51.100.1")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			got := map[string]string{}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, tc.wantFor, got["for"])
+			assert.Equal(t, tc.wantProto, got["proto"])
+			if tc.wantRealIP != "" {
+				assert.Equal(t, tc.wantRealIP, got["realIP"])
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	trusted, err := parseCIDRs("trusted_proxies", []string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	require.NoError(t, err)
+	assert.True(t, trusts(trusted, "10.1.2.3"))
+	assert.True(t, trusts(trusted, "192.168.1.1"))
+	assert.False(t, trusts(trusted, "192.168.1.2"))
+	assert.True(t, trusts(trusted, "::1"))
+	assert.False(t, trusts(trusted, "not an ip"))
+
+	_, err = parseCIDRs("trusted_proxies", []string{"10.0.0.0/33"})
+	assert.ErrorContains(t, err, "invalid trusted_proxies address \"10.0.0.0/33\"")
+	_, err = parseCIDRs("trusted_proxies", []string{"lb.example.com"})
+	assert.ErrorContains(t, err, "invalid trusted_proxies address \"lb.example.com\"")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/mxab/nacp/config"
+)
+
+// upstreamHeaderRule changes the headers of the requests sent to Nomad for matching paths and methods.
+type upstreamHeaderRule struct {
+	paths   []string
+	methods []string
+	remove  []string
+	set     map[string]string
+	add     map[string]string
+}
+
+// matches reports whether the rule applies to the client's request, rules without paths or methods match all.
+func (h *upstreamHeaderRule) matches(r *http.Request) bool {
+	if len(h.methods) > 0 && !slices.Contains(h.methods, r.Method) {
+		return false
+	}
+	if len(h.paths) == 0 {
+		return true
+	}
+	for _, pattern := range h.paths {
+		if matched, _ := path.Match(pattern, r.URL.Path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *upstreamHeaderRule) apply(header http.Header) {
+	for _, name := range h.remove {
+		header.Del(name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(h.set)) {
+		header.Set(name, h.set[name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(h.add)) {
+		header.Add(name, h.add[name])
+	}
+}
+
+// upstreamHeaders are the rules of the upstream_headers block.
+type upstreamHeaders struct {
+	rules []*upstreamHeaderRule
+}
+
+// buildUpstreamHeaders returns the rules of the upstream_headers block, it is nil if the block is missing.
+func buildUpstreamHeaders(c *config.Config) *upstreamHeaders {
+	if c.UpstreamHeaders == nil {
+		return nil
+	}
+	u := &upstreamHeaders{}
+	for _, rule := range c.UpstreamHeaders.Rules {
+		u.rules = append(u.rules, &upstreamHeaderRule{
+			paths:   rule.Paths,
+			methods: rule.Methods,
+			remove:  rule.Remove,
+			set:     rule.Set,
+			add:     rule.Add,
+		})
+	}
+	return u
+}
+
+// apply changes the headers of the outgoing request by all rules matching the incoming one, in order.
+func (u *upstreamHeaders) apply(in *http.Request, out http.Header) {
+	if u == nil {
+		return
+	}
+	for _, rule := range u.rules {
+		if rule.matches(in) {
+			rule.apply(out)
+		}
+	}
+}
+
+// WithUpstreamHeaders strips, sets or adds headers of the requests sent to Nomad.
+func WithUpstreamHeaders(headers *upstreamHeaders) ProxyOption {
+	return func(o *proxyOptions) {
+		o.upstreamHeaders = headers
+	}
+}
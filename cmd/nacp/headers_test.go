@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyUpstreamHeaders(t *testing.T) {
+	var got http.Header
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		got = req.Header.Clone()
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	headers := buildUpstreamHeaders(&config.Config{UpstreamHeaders: &config.UpstreamHeaders{Rules: []*config.HeaderRule{
+		{Remove: []string{"Authorization"}, Add: map[string]string{"X-Via": "nacp"}},
+		{
+			Paths:   []string{"/v1/job/*/scale", "/v1/job/*/dispatch"},
+			Methods: []string{http.MethodPut, http.MethodPost},
+			Set:     map[string]string{"X-Nomad-Token": "management"},
+		},
+	}}})
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithUpstreamHeaders(headers))
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		wantToken string
+	}{
+		{name: "matching write", method: http.MethodPost, path: "/v1/job/web/scale", wantToken: "management"},
+		{name: "read keeps the token", method: http.MethodGet, path: "/v1/job/web/scale", wantToken: "client"},
+		{name: "other path keeps the token", method: http.MethodPut, path: "/v1/job/web/revert", wantToken: "client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("X-Nomad-Token", "client")
+			req.Header.Set("X-Via", "lb")
+			proxy(httptest.NewRecorder(), req)
+
+			assert.Empty(t, got.Get("Authorization"))
+			assert.Equal(t, []string{"lb", "nacp"}, got.Values("X-Via"))
+			assert.Equal(t, []string{tt.wantToken}, got.Values("X-Nomad-Token"))
+		})
+	}
+}
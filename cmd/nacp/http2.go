@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// enableH2C serves HTTP/2 without TLS next to HTTP/1.1, a shutdown also drains the HTTP/2 connections.
+func enableH2C(server *http.Server) error {
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		return err
+	}
+	server.Handler = h2c.NewHandler(server.Handler, h2s)
+	return nil
+}
+
+// useUpstreamH2C sends proxied requests to plain http upstreams with HTTP/2 prior knowledge,
+// the dialer of the transport is kept so unix sockets and discovered servers work the same.
+func useUpstreamH2C(transport *http.Transport) {
+	dial := transport.DialContext
+	h2t := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		},
+	}
+	transport.RegisterProtocol("http", h2cRoundTripper{h2t})
+}
+
+// h2cRoundTripper leaves connection upgrades like websockets to the HTTP/1.1 transport.
+type h2cRoundTripper struct {
+	*http2.Transport
+}
+
+func (rt h2cRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Upgrade") != "" {
+		return nil, http.ErrSkipAltProtocol
+	}
+	return rt.Transport.RoundTrip(req)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func protoHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = rw.Write([]byte(r.Proto))
+	})
+}
+
+func newH2CServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewUnstartedServer(protoHandler())
+	require.NoError(t, enableH2C(backend.Config))
+	backend.Start()
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+func readProto(t *testing.T, client *http.Client, req *http.Request) string {
+	t.Helper()
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	proto, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(proto)
+}
+
+func TestEnableH2C(t *testing.T) {
+	server := newH2CServer(t)
+
+	tt := []struct {
+		name   string
+		client *http.Client
+		want   string
+	}{
+		{name: "http/2 with prior knowledge", client: h2cClient(), want: "HTTP/2.0"},
+		{name: "http/1.1 is still served", client: server.Client(), want: "HTTP/1.1"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, readProto(t, tc.client, req))
+		})
+	}
+}
+
+func TestUseUpstreamH2C(t *testing.T) {
+	backend := newH2CServer(t)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialed := 0
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed++
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	useUpstreamH2C(transport)
+	client := &http.Client{Transport: transport}
+
+	tt := []struct {
+		name    string
+		upgrade string
+		want    string
+	}{
+		{name: "http/2 with prior knowledge", want: "HTTP/2.0"},
+		{name: "upgrades use http/1.1", upgrade: "websocket", want: "HTTP/1.1"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, backend.URL, nil)
+			require.NoError(t, err)
+			if tc.upgrade != "" {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", tc.upgrade)
+			}
+			assert.Equal(t, tc.want, readProto(t, client, req))
+		})
+	}
+	assert.Equal(t, 2, dialed, "the transport's dialer is used for both protocols")
+}
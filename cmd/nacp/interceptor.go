@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path"
+)
+
+type contextKeyInterceptors struct{}
+
+var ctxInterceptors = contextKeyInterceptors{}
+
+// Interceptor checks or transforms requests to Nomad APIs other than job submissions, e.g. quota writes or node meta.
+// The request context of the rules is available in the request's context as "request_context".
+type Interceptor interface {
+	Name() string
+	// Matches selects the requests the interceptor handles
+	Matches(r *http.Request) bool
+	// InterceptRequest may rewrite the request before it is sent to Nomad, an error rejects it
+	InterceptRequest(r *http.Request) (*http.Request, error)
+	// InterceptResponse may rewrite Nomad's response of a matched request
+	InterceptResponse(resp *http.Response) error
+}
+
+// WithInterceptor adds an interceptor to the proxy. All matching interceptors run in the order they were added,
+// after the admission of jobs, their responses in reverse order.
+func WithInterceptor(interceptor Interceptor) ProxyOption {
+	return func(o *proxyOptions) {
+		o.interceptors = append(o.interceptors, interceptor)
+	}
+}
+
+// PathInterceptor matches requests by method and path pattern, e.g. PUT /v1/quota/*.
+// Patterns use the syntax of path.Match, so * doesn't match slashes.
+type PathInterceptor struct {
+	name    string
+	methods []string
+	pattern string
+
+	// OnRequest and OnResponse are optional
+	OnRequest  func(r *http.Request) (*http.Request, error)
+	OnResponse func(resp *http.Response) error
+}
+
+func NewPathInterceptor(name, pattern string, methods ...string) (*PathInterceptor, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return &PathInterceptor{name: name, methods: methods, pattern: pattern}, nil
+}
+
+func (p *PathInterceptor) Name() string {
+	return p.name
+}
+
+// Matches reports whether the path matches the pattern and the method is one of the methods, any method if none are given.
+func (p *PathInterceptor) Matches(r *http.Request) bool {
+	if matched, _ := path.Match(p.pattern, r.URL.Path); !matched {
+		return false
+	}
+	if len(p.methods) == 0 {
+		return true
+	}
+	for _, method := range p.methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PathInterceptor) InterceptRequest(r *http.Request) (*http.Request, error) {
+	if p.OnRequest == nil {
+		return r, nil
+	}
+	return p.OnRequest(r)
+}
+
+func (p *PathInterceptor) InterceptResponse(resp *http.Response) error {
+	if p.OnResponse == nil {
+		return nil
+	}
+	return p.OnResponse(resp)
+}
+
+// interceptRequest runs the matching interceptors and remembers them for the response.
+func interceptRequest(r *http.Request, interceptors []Interceptor) (*http.Request, error) {
+	var matched []Interceptor
+	for _, interceptor := range interceptors {
+		if !interceptor.Matches(r) {
+			continue
+		}
+		var err error
+		r, err = interceptor.InterceptRequest(r)
+		if err != nil {
+			return r, err
+		}
+		matched = append(matched, interceptor)
+	}
+	if len(matched) == 0 {
+		return r, nil
+	}
+	return r.WithContext(context.WithValue(r.Context(), ctxInterceptors, matched)), nil
+}
+
+// interceptResponse runs the interceptors that matched the request, the last one added sees Nomad's response first.
+func interceptResponse(resp *http.Response) error {
+	matched, _ := resp.Request.Context().Value(ctxInterceptors).([]Interceptor)
+	for i := len(matched) - 1; i >= 0; i-- {
+		if err := matched[i].InterceptResponse(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
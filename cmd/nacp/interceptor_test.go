@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathInterceptorMatches(t *testing.T) {
+	interceptor, err := NewPathInterceptor("quota", "/v1/quota/*", http.MethodPut, http.MethodPost)
+	require.NoError(t, err)
+
+	assert.True(t, interceptor.Matches(httptest.NewRequest(http.MethodPut, "/v1/quota/default", nil)))
+	assert.False(t, interceptor.Matches(httptest.NewRequest(http.MethodGet, "/v1/quota/default", nil)))
+	assert.False(t, interceptor.Matches(httptest.NewRequest(http.MethodPut, "/v1/quota/default/usage", nil)))
+	assert.False(t, interceptor.Matches(httptest.NewRequest(http.MethodPut, "/v1/quotas", nil)))
+
+	anyMethod, err := NewPathInterceptor("node meta", "/v1/client/metadata")
+	require.NoError(t, err)
+	assert.True(t, anyMethod.Matches(httptest.NewRequest(http.MethodPost, "/v1/client/metadata", nil)))
+
+	_, err = NewPathInterceptor("broken", "/v1/[")
+	assert.Error(t, err)
+}
+
+func TestProxyInterceptors(t *testing.T) {
+	var gotHeader string
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		gotHeader = req.Header.Get("X-Quota-Checked")
+		_, _ = rw.Write([]byte(`{"Index": 1}`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	var order []string
+	quota, err := NewPathInterceptor("quota", "/v1/quota/*", http.MethodPut)
+	require.NoError(t, err)
+	quota.OnRequest = func(r *http.Request) (*http.Request, error) {
+		reqCtx := r.Context().Value("request_context").(*config.RequestContext)
+		if reqCtx.ClientIP != "127.0.0.1" {
+			return r, errors.New("unexpected client")
+		}
+		if r.URL.Path == "/v1/quota/forbidden" {
+			return r, errors.New("quota forbidden must not be changed")
+		}
+		r.Header.Set("X-Quota-Checked", "true")
+		order = append(order, "quota request")
+		return r, nil
+	}
+	quota.OnResponse = func(resp *http.Response) error {
+		order = append(order, "quota response")
+		resp.Header.Set("X-Intercepted", "quota")
+		return nil
+	}
+	audit, err := NewPathInterceptor("audit", "/v1/*/*")
+	require.NoError(t, err)
+	audit.OnResponse = func(resp *http.Response) error {
+		order = append(order, "audit response")
+		return nil
+	}
+
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithInterceptor(quota), WithInterceptor(audit))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	res, err := sendPut(t, proxyServer.URL+"/v1/quota/default", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "quota", res.Header.Get("X-Intercepted"))
+	assert.Equal(t, "true", gotHeader)
+	assert.Equal(t, []string{"quota request", "audit response", "quota response"}, order)
+
+	order = nil
+	res, err = sendPut(t, proxyServer.URL+"/v1/quota/forbidden", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "quota forbidden must not be changed", string(body))
+	assert.Empty(t, order)
+}
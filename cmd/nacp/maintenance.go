@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/metrics"
+)
+
+// maintenanceSubresources are the job subresources the maintenance mode can reject.
+var maintenanceSubresources = map[string]string{
+	"/scale":    "scale",
+	"/dispatch": "dispatch",
+	"/revert":   "revert",
+}
+
+// maintenanceOperation returns the job write of the request, it is empty for reads, plans and anything else.
+func maintenanceOperation(r *http.Request) string {
+	switch matchRoute(r).Operation {
+	case config.OperationRegister:
+		return "register"
+	case config.OperationDeregister:
+		return "deregister"
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		return ""
+	}
+	id, ok := strings.CutPrefix(r.URL.Path, "/v1/job/")
+	if !ok {
+		return ""
+	}
+	// like Nomad, the first matching suffix decides
+	for _, suffix := range jobSubresources {
+		if strings.HasSuffix(id, suffix) {
+			return maintenanceSubresources[suffix]
+		}
+	}
+	return ""
+}
+
+type maintenanceState struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message"`
+	Since      *time.Time `json:"since,omitempty"`
+	Operations []string   `json:"operations"`
+}
+
+// maintenanceMode rejects job writes with a 503 while enabled, it is toggled via the admin API.
+// The state is kept per instance, replicas are toggled one by one.
+type maintenanceMode struct {
+	operations     []string
+	defaultMessage string
+	retryAfter     time.Duration
+	logger         hclog.Logger
+
+	mu      sync.RWMutex
+	enabled bool
+	message string
+	since   time.Time
+}
+
+// buildMaintenance returns the maintenance mode of the maintenance block, it is nil if the block is missing.
+func buildMaintenance(c *config.Config, logger hclog.Logger) (*maintenanceMode, error) {
+	if c.Maintenance == nil {
+		return nil, nil
+	}
+	m := &maintenanceMode{
+		operations:     c.Maintenance.Operations,
+		defaultMessage: c.Maintenance.Message,
+		logger:         logger,
+	}
+	if c.Maintenance.RetryAfter != "" {
+		retryAfter, err := time.ParseDuration(c.Maintenance.RetryAfter)
+		if err != nil {
+			return nil, err
+		}
+		m.retryAfter = retryAfter
+	}
+	if c.Maintenance.Enabled {
+		m.Enable("")
+	}
+	return m, nil
+}
+
+func (m *maintenanceMode) State() maintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state := maintenanceState{Enabled: m.enabled, Message: m.defaultMessage, Operations: m.operations}
+	if m.enabled {
+		since := m.since
+		state.Message = m.message
+		state.Since = &since
+	}
+	return state
+}
+
+// Enable starts rejecting writes with the message, an empty message uses the configured one.
+func (m *maintenanceMode) Enable(message string) {
+	if message == "" {
+		message = m.defaultMessage
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.enabled {
+		m.since = time.Now()
+	}
+	m.enabled = true
+	m.message = message
+	m.logger.Warn("Maintenance mode enabled on this instance, job writes are rejected", "operations", m.operations, "message", message)
+}
+
+func (m *maintenanceMode) Disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.enabled {
+		m.logger.Warn("Maintenance mode disabled on this instance", "duration", time.Since(m.since))
+	}
+	m.enabled = false
+}
+
+// reject answers the request with a 503 if it is a write the maintenance mode blocks.
+func (m *maintenanceMode) reject(w http.ResponseWriter, r *http.Request) bool {
+	m.mu.RLock()
+	enabled, message := m.enabled, m.message
+	m.mu.RUnlock()
+	if !enabled {
+		return false
+	}
+	operation := maintenanceOperation(r)
+	if operation == "" || !slices.Contains(m.operations, operation) {
+		return false
+	}
+	metrics.MaintenanceRejections.WithLabelValues(operation).Inc()
+	m.logger.Info("Rejected write during maintenance", "operation", operation, "path", r.URL.Path)
+	if m.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(m.retryAfter.Seconds())))
+	}
+	http.Error(w, message, http.StatusServiceUnavailable)
+	return true
+}
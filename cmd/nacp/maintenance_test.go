@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceOperation(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodPut, path: "/v1/jobs", want: "register"},
+		{method: http.MethodPost, path: "/v1/job/web", want: "register"},
+		{method: http.MethodPost, path: "/v1/job/web/scale", want: "scale"},
+		{method: http.MethodPost, path: "/v1/job/batch/dispatch", want: "dispatch"},
+		{method: http.MethodPost, path: "/v1/job/web/revert", want: "revert"},
+		{method: http.MethodDelete, path: "/v1/job/web", want: "deregister"},
+		{method: http.MethodPost, path: "/v1/job/web/plan"},
+		{method: http.MethodGet, path: "/v1/job/web/scale"},
+		{method: http.MethodGet, path: "/v1/jobs"},
+		{method: http.MethodPut, path: "/v1/validate/job"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, maintenanceOperation(httptest.NewRequest(tt.method, tt.path, nil)))
+		})
+	}
+}
+
+func TestProxyRejectsWritesDuringMaintenance(t *testing.T) {
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer nomad.Close()
+	nomadURL, _ := url.Parse(nomad.URL)
+
+	maintenance, err := buildMaintenance(&config.Config{Maintenance: &config.Maintenance{
+		Enabled:    true,
+		Message:    "deploy freeze",
+		Operations: []string{"register", "scale"},
+		RetryAfter: "5m",
+	}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomadURL, jobHandler, hclog.NewNullLogger(), nil, WithMaintenance(maintenance))
+
+	rr := httptest.NewRecorder()
+	proxy(rr, httptest.NewRequest(http.MethodPost, "/v1/job/web/scale", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "deploy freeze\n", rr.Body.String())
+	assert.Equal(t, "300", rr.Header().Get("Retry-After"))
+
+	rr = httptest.NewRecorder()
+	proxy(rr, httptest.NewRequest(http.MethodGet, "/v1/jobs", nil))
+	assert.Equal(t, http.StatusOK, rr.Code, "reads are proxied")
+
+	rr = httptest.NewRecorder()
+	proxy(rr, httptest.NewRequest(http.MethodPost, "/v1/job/batch/dispatch", nil))
+	assert.Equal(t, http.StatusOK, rr.Code, "dispatch is not frozen")
+
+	maintenance.Disable()
+	rr = httptest.NewRecorder()
+	proxy(rr, httptest.NewRequest(http.MethodPost, "/v1/job/web/scale", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestBuildMaintenance(t *testing.T) {
+	maintenance, err := buildMaintenance(&config.Config{}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Nil(t, maintenance)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mxab/nacp/pkg/middleware"
+)
+
+// WithMiddleware adds a middleware to the stage of the proxy's handler chain.
+func WithMiddleware(stage middleware.Stage, name string, mw middleware.Middleware) ProxyOption {
+	return func(o *proxyOptions) {
+		o.middlewares = append(o.middlewares, middleware.Entry{Stage: stage, Name: name, Middleware: mw})
+	}
+}
+
+type contextKeyRoute struct{}
+
+var ctxRoute = contextKeyRoute{}
+
+// routeFromContext returns the route the audit stage matched, requests passed through unchecked have none.
+func routeFromContext(ctx context.Context) route {
+	rt, _ := ctx.Value(ctxRoute).(route)
+	return rt
+}
+
+func corsMiddleware(policy *corsPolicy) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if policy.preflight(w, r) {
+				return
+			}
+			// also rejections of NACP must be readable by the browser
+			policy.apply(w.Header(), r.Header.Get("Origin"))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func networkACLMiddleware(acl *networkACL, options *proxyOptions) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if acl.reject(w, r, getClientIP(r, options.trustedProxies)) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func maintenanceMiddleware(maintenance *maintenanceMode) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maintenance.reject(w, r) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
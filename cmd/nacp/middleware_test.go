@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recording appends its name to the order before calling the next handler.
+func recording(name string, order *[]string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*order = append(*order, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestProxyMiddlewares(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`[]`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	var order []string
+	var clientIP string
+	audit := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// built-in middlewares of a stage run first, so the request context is there
+			clientIP = r.Context().Value("request_context").(*config.RequestContext).ClientIP
+			next.ServeHTTP(w, r)
+		})
+	}
+	reject := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/nodes" {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil,
+		WithMiddleware(middleware.StageAudit, "audit", audit),
+		WithMiddleware(middleware.StageRateLimit, "limit", reject),
+		WithMiddleware(middleware.StageAuth, "auth", recording("auth", &order)),
+	)
+	server := httptest.NewServer(http.HandlerFunc(proxy))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/v1/jobs")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "127.0.0.1", clientIP)
+	assert.Equal(t, []string{"auth"}, order)
+
+	clientIP = ""
+	res, err = http.Get(server.URL + "/v1/nodes")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Empty(t, clientIP, "rejected before the audit stage")
+	assert.Equal(t, []string{"auth", "auth"}, order)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/mirror"
+)
+
+// buildMirror creates the mirror of the mirror block, it is nil if the block is missing.
+func buildMirror(c *config.Config, logger hclog.Logger) (*mirror.Mirror, error) {
+	m := c.Mirror
+	if m == nil {
+		return nil, nil
+	}
+	nomadConfig := &api.Config{
+		Address:  m.Address,
+		SecretID: m.Token,
+	}
+	if m.TLS != nil {
+		nomadConfig.TLSConfig = &api.TLSConfig{
+			CACert:        m.TLS.CaFile,
+			ClientCert:    m.TLS.CertFile,
+			ClientKey:     m.TLS.KeyFile,
+			Insecure:      m.TLS.InsecureSkipVerify,
+			TLSServerName: m.TLS.ServerName,
+		}
+	}
+	client, err := api.NewClient(nomadConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mirror client: %w", err)
+	}
+	redact := m.Redact
+	if redact == nil {
+		redact = mirror.DefaultRedact
+	}
+	scrub := mirror.Scrubbing{
+		Namespaces:  m.Namespaces,
+		Datacenters: m.Datacenters,
+		Region:      m.Region,
+		Redact:      redact,
+	}
+	return mirror.New(client, m.Mode, scrub, m.BufferSize, logger), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMirror(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirror  *config.Mirror
+		want    bool
+		wantErr string
+	}{
+		{name: "no mirror block"},
+		{
+			name:   "mirror",
+			mirror: &config.Mirror{Address: "https://nomad.staging:4646", Mode: "plan", BufferSize: 10, TLS: &config.ClientTLS{ServerName: "nomad.staging"}},
+			want:   true,
+		},
+		{
+			name:    "missing ca file",
+			mirror:  &config.Mirror{Address: "https://nomad.staging:4646", Mode: "register", BufferSize: 10, TLS: &config.ClientTLS{CaFile: "does-not-exist.pem"}},
+			wantErr: "failed to create mirror client",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := buildMirror(&config.Config{Mirror: tt.mirror}, hclog.NewNullLogger())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m != nil)
+		})
+	}
+}
+
+func TestProxyMirrorsRegisteredJobs(t *testing.T) {
+	staged := make(chan *api.Job, 1)
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body api.JobRegisterRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		staged <- body.Job
+		w.Write([]byte(`{}`))
+	}))
+	defer staging.Close()
+
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"EvalID":"eval"}`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	m, err := buildMirror(&config.Config{Mirror: &config.Mirror{
+		Address:    staging.URL,
+		Mode:       "register",
+		Namespaces: map[string]string{"*": "staging"},
+		BufferSize: 10,
+	}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithMirror(m))
+
+	id, namespace := "web", "prod"
+	job := &api.Job{ID: &id, Namespace: &namespace}
+	data, err := json.Marshal(&api.JobRegisterRequest{Job: job})
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	proxy(rr, httptest.NewRequest(http.MethodPut, "/v1/jobs", bytes.NewReader(data)))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	select {
+	case mirrored := <-staged:
+		assert.Equal(t, "web", *mirrored.ID)
+		assert.Equal(t, "staging", *mirrored.Namespace)
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not mirrored")
+	}
+}
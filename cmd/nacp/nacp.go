@@ -1,61 +1,87 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/mxab/nacp/admissionctrl/types"
 	"io"
+	"maps"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
-	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/coreos/go-systemd/v22/daemon"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/nomad/api"
 	"github.com/hashicorp/nomad/helper"
 	"github.com/mxab/nacp/admissionctrl"
-	"github.com/mxab/nacp/admissionctrl/mutator"
-	"github.com/mxab/nacp/admissionctrl/notation"
-	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/opa"
+	"github.com/mxab/nacp/audit"
+	"github.com/mxab/nacp/auth"
 	"github.com/mxab/nacp/config"
-	"github.com/notaryproject/notation-go/dir"
-	"github.com/notaryproject/notation-go/verifier/truststore"
+	"github.com/mxab/nacp/datasource"
+	"github.com/mxab/nacp/discovery"
+	"github.com/mxab/nacp/identity"
+	"github.com/mxab/nacp/leader"
+	"github.com/mxab/nacp/metrics"
+	"github.com/mxab/nacp/mirror"
+	"github.com/mxab/nacp/pkg/admission"
+	"github.com/mxab/nacp/pkg/middleware"
 )
 
 type contextKeyWarnings struct{}
 type contextKeyValidationError struct{}
+type contextKeyAdmittedJob struct{}
+type contextKeyAdmittedPayload struct{}
 
 var (
 	ctxWarnings        = contextKeyWarnings{}
 	ctxValidationError = contextKeyValidationError{}
-	jobPathRegex       = regexp.MustCompile(`^/v1/job/[a-zA-Z]+[a-z-Z0-9\-]*$`)
-	jobPlanPathRegex   = regexp.MustCompile(`^/v1/job/[a-zA-Z]+[a-z-Z0-9\-]*/plan$`)
+	ctxAdmittedJob     = contextKeyAdmittedJob{}
+	// ctxAdmittedPayload is the admitted registration, its usage is recorded once Nomad accepted it
+	ctxAdmittedPayload = contextKeyAdmittedPayload{}
 
 	nomadTimeout = 310 * time.Second
+	// deregisterTimeout bounds how long stopping waits for the consul deregistration
+	deregisterTimeout = 5 * time.Second
+
+	configPath  = flag.String("config", defaultConfigPath(), "point to a nacp config file")
+	showVersion = flag.Bool("version", false, "print the version and exit")
 )
 
-// New function to get client IP
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		return strings.Split(forwarded, ",")[0]
+// getClientIP honors X-Forwarded-For only if the peer is a trusted proxy, the client is the last
+// address in the chain that is not a trusted proxy itself.
+func getClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := remoteIP(r)
+	if !trusts(trusted, ip) {
+		return ip
+	}
+	var chain []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		chain = append(chain, strings.Split(header, ",")...)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(chain[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !trusts(trusted, hop) {
+			break
+		}
 	}
-
-	// Fall back to RemoteAddr
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
 	return ip
 }
 
@@ -98,133 +124,415 @@ func resolveTokenAccessor(transport http.RoundTripper, nomadAddress *url.URL, to
 
 	return &aclToken, nil
 }
-func NewProxyHandler(nomadAddress *url.URL, jobHandler *admissionctrl.JobHandler, appLogger hclog.Logger, transport *http.Transport) func(http.ResponseWriter, *http.Request) {
 
-	proxy := httputil.NewSingleHostReverseProxy(nomadAddress)
-	if transport != nil {
-		proxy.Transport = transport
+// ProxyOption customizes the proxy handler.
+type ProxyOption func(*proxyOptions)
+
+type proxyOptions struct {
+	identity         *identity.Resolver
+	upstream         *discovery.Upstream
+	forwardedHeaders *forwardedHeaders
+	upstreamHeaders  *upstreamHeaders
+	scrubbing        *responseScrubbing
+	trustedProxies   []*net.IPNet
+	contextHeaders   []string
+	maxResponseSize  int64
+	cors             *corsPolicy
+	logNearMisses    bool
+	mirror           *mirror.Mirror
+	tokens           *tokenCache
+	retry            *retryPolicy
+	maintenance      *maintenanceMode
+	networkACL       *networkACL
+	apis             *apiPolicy
+	reads            *admissionctrl.ReadAuthorizer
+	certPolicies     *certPolicies
+	// preserveUnknownFields patches the submitted job requests instead of re-encoding them
+	preserveUnknownFields bool
+	interceptors          []Interceptor
+	middlewares           []middleware.Entry
+}
+
+// WithCertPolicies adds the virtual policies of the client certificate to the policies of the request context.
+func WithCertPolicies(policies *certPolicies) ProxyOption {
+	return func(o *proxyOptions) {
+		o.certPolicies = policies
 	}
+}
 
-	originalDirector := proxy.Director
+// WithNetworkACL rejects requests of clients from unexpected networks.
+func WithNetworkACL(acl *networkACL) ProxyOption {
+	return func(o *proxyOptions) {
+		o.networkACL = acl
+	}
+}
 
-	proxy.Director = func(r *http.Request) {
-		originalDirector(r)
+// WithMaintenance rejects job writes while the maintenance mode is enabled.
+func WithMaintenance(maintenance *maintenanceMode) ProxyOption {
+	return func(o *proxyOptions) {
+		o.maintenance = maintenance
 	}
+}
 
-	proxy.ModifyResponse = func(resp *http.Response) error {
+// WithRetry retries proxied requests that failed transiently.
+func WithRetry(policy *retryPolicy) ProxyOption {
+	return func(o *proxyOptions) {
+		o.retry = policy
+	}
+}
 
-		var err error
+// WithTokenCache caches the token lookups and optionally resolves the policies of the tokens.
+func WithTokenCache(cache *tokenCache) ProxyOption {
+	return func(o *proxyOptions) {
+		o.tokens = cache
+	}
+}
 
-		if isRegister(resp.Request) {
-			err = handRegisterResponse(resp, appLogger)
-		} else if isPlan(resp.Request) {
-			err = handleJobPlanResponse(resp, appLogger)
-		} else if isValidate(resp.Request) {
-			err = handleJobValdidateResponse(resp, appLogger)
-		}
-		if err != nil {
-			appLogger.Error("Preparing response failed", "error", err)
-			return err
-		}
+// resolveToken looks up the token, via the token cache if configured.
+func (o *proxyOptions) resolveToken(transport *http.Transport, nomadAddress *url.URL, token string) (*api.ACLToken, map[string]string, error) {
+	if o.tokens == nil {
+		tokenInfo, err := resolveTokenAccessor(transport, nomadAddress, token)
+		return tokenInfo, nil, err
+	}
+	if token == "" {
+		return nil, nil, nil
+	}
+	return o.tokens.resolve(func(path string, v interface{}) (bool, error) {
+		return getFromNomad(transport, nomadAddress, token, path, "", "", v)
+	}, token)
+}
 
-		return nil
+// WithMirror copies the jobs Nomad registered after admission to a secondary cluster.
+func WithMirror(m *mirror.Mirror) ProxyOption {
+	return func(o *proxyOptions) {
+		o.mirror = m
 	}
+}
 
-	return func(w http.ResponseWriter, r *http.Request) {
+// WithNearMissLogging logs writes that resemble intercepted requests but are passed through.
+func WithNearMissLogging() ProxyOption {
+	return func(o *proxyOptions) {
+		o.logNearMisses = true
+	}
+}
 
-		ctx := r.Context()
-		reqCtx := &config.RequestContext{
-			ClientIP: getClientIP(r),
-		}
+// WithMaxResponseSize limits the size of the upstream responses NACP adds its warnings to.
+func WithMaxResponseSize(size int64) ProxyOption {
+	return func(o *proxyOptions) {
+		o.maxResponseSize = size
+	}
+}
 
-		token := r.Header.Get("X-Nomad-Token")
-		if jobHandler.ResolveToken() {
-			tokenInfo, err := resolveTokenAccessor(transport, nomadAddress, token)
-			if err != nil {
-				appLogger.Error("Resolving token failed", "error", err)
-			}
-			if tokenInfo != nil {
-				reqCtx.AccessorID = tokenInfo.AccessorID
-				reqCtx.TokenInfo = tokenInfo
-			}
-		}
+func (o *proxyOptions) responseLimit() int64 {
+	if o.maxResponseSize <= 0 {
+		return defaultMaxResponseSize
+	}
+	return o.maxResponseSize
+}
 
-		// Even tho we have resolveToken set to true, the initial connection will be issued without a token for the auth
-		// so it's better to validate whether it's populated or not
-		if reqCtx.TokenInfo != nil {
-			appLogger.Info("Request received", "path", r.URL.Path, "method", r.Method, "clientIP", reqCtx.ClientIP, "accessorID", reqCtx.AccessorID)
-		} else {
-			appLogger.Info("Request received", "path", r.URL.Path, "method", r.Method, "clientIP", reqCtx.ClientIP)
-		}
+// WithContextHeaders passes these request headers to the rules as context.headers.
+func WithContextHeaders(headers []string) ProxyOption {
+	return func(o *proxyOptions) {
+		o.contextHeaders = headers
+	}
+}
 
-		// Store context
-		ctx = context.WithValue(ctx, "request_context", reqCtx)
-		r = r.WithContext(ctx)
+// WithTrustedProxies honors the X-Forwarded-For header of these load balancers for the client ip.
+func WithTrustedProxies(trusted []*net.IPNet) ProxyOption {
+	return func(o *proxyOptions) {
+		o.trustedProxies = trusted
+	}
+}
 
-		var err error
-		if isRegister(r) {
-			r, err = handleRegister(r, appLogger, jobHandler)
+// WithForwardedHeaders controls the client ip headers sent to Nomad, by default the peer is appended to X-Forwarded-For.
+func WithForwardedHeaders(headers *forwardedHeaders) ProxyOption {
+	return func(o *proxyOptions) {
+		o.forwardedHeaders = headers
+	}
+}
+
+// WithUpstream sends proxied requests to the discovered Nomad servers instead of the static address.
+func WithUpstream(upstream *discovery.Upstream) ProxyOption {
+	return func(o *proxyOptions) {
+		o.upstream = upstream
+	}
+}
 
-		} else if isPlan(r) {
-			r, err = handlePlan(r, appLogger, jobHandler)
+// backend returns the server for the next request, the static address if no servers are discovered.
+func (o *proxyOptions) backend(static *url.URL) *url.URL {
+	if o.upstream == nil {
+		return static
+	}
+	target, err := o.upstream.Pick()
+	if err != nil {
+		return static
+	}
+	return target
+}
 
-		} else if isValidate(r) {
-			r, err = handleValidate(r, appLogger, jobHandler)
+// WithIdentityResolver adds the identity and groups of the submitter to the request context.
+func WithIdentityResolver(resolver *identity.Resolver) ProxyOption {
+	return func(o *proxyOptions) {
+		o.identity = resolver
+	}
+}
 
+// contextHeaders returns the given headers of the request by canonical name, missing headers are left out.
+func contextHeaders(r *http.Request, names []string) map[string]string {
+	var headers map[string]string
+	for _, name := range names {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
 		}
-		if err != nil {
-			appLogger.Warn("Error applying admission controllers", "error", err)
-			writeError(w, err)
-
-		} else {
-			proxy.ServeHTTP(w, r)
+		if headers == nil {
+			headers = make(map[string]string, len(names))
 		}
+		headers[http.CanonicalHeaderKey(name)] = strings.Join(values, ", ")
+	}
+	return headers
+}
 
+func NewProxyHandler(nomadAddress *url.URL, jobHandler *admissionctrl.JobHandler, appLogger hclog.Logger, transport *http.Transport, opts ...ProxyOption) func(http.ResponseWriter, *http.Request) {
+
+	options := &proxyOptions{}
+	for _, opt := range opts {
+		opt(options)
 	}
 
-}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(options.backend(nomadAddress))
+			pr.Out.Host = pr.In.Host
+			clientIP := remoteIP(pr.In)
+			if reqCtx, ok := pr.In.Context().Value("request_context").(*config.RequestContext); ok {
+				clientIP = reqCtx.ClientIP
+			}
+			options.forwardedHeaders.apply(pr, clientIP)
+			options.upstreamHeaders.apply(pr.In, pr.Out.Header)
+		},
+	}
+	if transport != nil {
+		proxy.Transport = transport
+	}
+	if options.retry != nil {
+		next := proxy.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		proxy.Transport = newRetryTransport(next, options.retry, appLogger.Named("retry"))
+	}
 
-func handRegisterResponse(resp *http.Response, appLogger hclog.Logger) error {
+	proxy.ModifyResponse = func(resp *http.Response) error {
+
+		var err error
+
+		if options.cors != nil {
+			// the headers for the client are already set by the handler
+			dropCorsHeaders(resp.Header)
+		}
+
+		switch matchRoute(resp.Request).Operation {
+		case config.OperationRegister:
+			if resp.StatusCode == http.StatusOK {
+				if payload, ok := resp.Request.Context().Value(ctxAdmittedPayload).(*types.Payload); ok {
+					jobHandler.RecordUsage(payload)
+				}
+			}
+			if options.mirror != nil && resp.StatusCode == http.StatusOK {
+				if job, ok := resp.Request.Context().Value(ctxAdmittedJob).(*api.Job); ok {
+					options.mirror.Mirror(job)
+				}
+			}
+			err = handRegisterResponse(resp, options.responseLimit(), appLogger)
+		case config.OperationPlan:
+			err = handleJobPlanResponse(resp, options.responseLimit(), appLogger)
+		case config.OperationValidate:
+			err = handleJobValdidateResponse(resp, appLogger)
+		}
+		if err == nil {
+			err = interceptResponse(resp)
+		}
+		if err == nil {
+			err = options.scrubbing.scrubResponse(resp, options.responseLimit())
+		}
+		if err != nil {
+			appLogger.Error("Preparing response failed", "error", err)
+			return err
+		}
 
-	warnings, ok := resp.Request.Context().Value(ctxWarnings).([]error)
-	if !ok && len(warnings) == 0 {
 		return nil
 	}
 
-	response := &api.JobRegisterResponse{}
-	reader := resp.Body
-
-	isGzip, reader, err := checkIfGzipAndTransformReader(resp, reader)
-	if err != nil {
-		return err
+	stack := &middleware.Stack{}
+	if options.cors != nil {
+		stack.Use(middleware.StageAccess, "cors", corsMiddleware(options.cors))
 	}
-	defer reader.Close()
-	if err := json.NewDecoder(reader).Decode(response); err != nil {
-		return err
+	if options.networkACL != nil {
+		stack.Use(middleware.StageNetwork, "network_acl", networkACLMiddleware(options.networkACL, options))
+	}
+	if options.maintenance != nil {
+		stack.Use(middleware.StageAccess, "maintenance", maintenanceMiddleware(options.maintenance))
+	}
+	stack.Use(middleware.StageAudit, "request_context", requestContextMiddleware(nomadAddress, jobHandler, appLogger, transport, options))
+	stack.Use(middleware.StageAdmission, "read_authorization", readAuthorizationMiddleware(appLogger, options))
+	stack.Use(middleware.StageAdmission, "admission", admissionMiddleware(nomadAddress, jobHandler, appLogger, transport, options))
+	for _, e := range options.middlewares {
+		stack.Use(e.Stage, e.Name, e.Middleware)
 	}
+	return stack.Handler(proxy).ServeHTTP
+}
+
+// requestContextMiddleware matches the route and builds the request context the rules receive, e.g. client IP, token and identity.
+func requestContextMiddleware(nomadAddress *url.URL, jobHandler *admissionctrl.JobHandler, appLogger hclog.Logger, transport *http.Transport, options *proxyOptions) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			rt := matchRoute(r)
+			if slices.Contains(config.JobOperations, rt.Operation) && !jobHandler.ChecksOperation(rt.Operation) {
+				// stops, purges and disruptions are only intercepted if a validator checks them
+				rt = route{}
+			}
+			if rt.Operation != "" && !options.apis.handles(apiJobs) {
+				rt = route{}
+			}
+			forwardNamespace(r, rt)
+			reqCtx := &config.RequestContext{
+				ClientIP:  getClientIP(r, options.trustedProxies),
+				Operation: rt.Operation,
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Headers:   contextHeaders(r, options.contextHeaders),
+				// Nomad only reads the idempotency token from the query, which is passed on as is
+				IdempotencyToken: r.URL.Query().Get("idempotency_token"),
+			}
+			checksRead, readResolvesToken := options.reads.Checks(r)
+			if checksRead {
+				reqCtx.Operation = config.OperationRead
+				reqCtx.Namespace, reqCtx.NamespaceSource = readNamespace(r)
+			}
+			if options.logNearMisses && isNearMiss(r) {
+				metrics.NearMissRequests.Inc()
+				appLogger.Warn("Request resembles a job submission but is not checked", "path", r.URL.Path, "method", r.Method, "clientIP", reqCtx.ClientIP)
+			}
+
+			token := r.Header.Get("X-Nomad-Token")
+			needsToken := options.identity != nil && options.identity.NeedsToken() && reqCtx.Operation != ""
+			if jobHandler.ResolveToken() || needsToken || readResolvesToken {
+				tokenInfo, policyRules, err := options.resolveToken(transport, options.backend(nomadAddress), token)
+				if err != nil {
+					appLogger.Error("Resolving token failed", "error", err)
+				}
+				if tokenInfo != nil {
+					reqCtx.AccessorID = tokenInfo.AccessorID
+					reqCtx.TokenInfo = tokenInfo
+					reqCtx.Policies = tokenInfo.Policies
+				}
+				if policyRules != nil {
+					// also the policies of the token's roles
+					reqCtx.Policies = slices.Sorted(maps.Keys(policyRules))
+					reqCtx.PolicyRules = policyRules
+				}
+			}
+			if options.certPolicies != nil {
+				if certPolicies := options.certPolicies.resolve(r.TLS); len(certPolicies) > 0 {
+					reqCtx.CertPolicies = certPolicies
+					policies := slices.Concat(reqCtx.Policies, certPolicies)
+					slices.Sort(policies)
+					reqCtx.Policies = slices.Compact(policies)
+				}
+			}
+			if options.identity != nil && reqCtx.Operation != "" {
+				reqCtx.Identity, reqCtx.Groups = options.identity.Resolve(ctx, r, reqCtx.TokenInfo)
+				reqCtx.IdentityClaims = options.identity.Claims(r)
+			}
+			if user, ok := auth.UserFromContext(ctx); ok && reqCtx.Identity == "" {
+				// logged in via NACP's OIDC login
+				reqCtx.Identity, reqCtx.Groups = user.Identity, user.Groups
+			}
 
-	response.Warnings = buildFullWarningMsg(response.Warnings, warnings)
+			// Even tho we have resolveToken set to true, the initial connection will be issued without a token for the auth
+			// so it's better to validate whether it's populated or not
+			if reqCtx.TokenInfo != nil {
+				appLogger.Info("Request received", "path", r.URL.Path, "method", r.Method, "clientIP", reqCtx.ClientIP, "accessorID", reqCtx.AccessorID)
+			} else {
+				appLogger.Info("Request received", "path", r.URL.Path, "method", r.Method, "clientIP", reqCtx.ClientIP)
+			}
 
-	responeData, err := json.Marshal(response)
+			// Store context
+			ctx = context.WithValue(ctx, "request_context", reqCtx)
+			ctx = context.WithValue(ctx, ctxRoute, rt)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-	if err != nil {
-		return err
+// admissionMiddleware applies the rules to the job of the route and runs the interceptors, errors reject the request.
+func admissionMiddleware(nomadAddress *url.URL, jobHandler *admissionctrl.JobHandler, appLogger hclog.Logger, transport *http.Transport, options *proxyOptions) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			group := apiGroupOf(r)
+			if !options.apis.handles(group) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			admit := func(r *http.Request) (*http.Request, error) {
+				rt := routeFromContext(r.Context())
+				var err error
+				switch rt.Operation {
+				case config.OperationRegister:
+					r, err = handleRegister(r, rt, appLogger, jobHandler, options.preserveUnknownFields)
+				case config.OperationPlan:
+					r, err = handlePlan(r, rt, appLogger, jobHandler, options.preserveUnknownFields)
+				case config.OperationValidate:
+					r, err = handleValidate(r, appLogger, jobHandler)
+				case config.OperationDeregister, config.OperationAllocRestart, config.OperationAllocStop, config.OperationEvaluate, config.OperationPeriodicForce:
+					token := r.Header.Get("X-Nomad-Token")
+					r, err = handleJobOperation(r, rt, appLogger, jobHandler, func(rt route) (*api.Job, string, error) {
+						return lookupJob(transport, options.backend(nomadAddress), token, rt)
+					})
+				}
+				if err == nil && len(options.interceptors) > 0 {
+					r, err = interceptRequest(r, options.interceptors)
+				}
+				return r, err
+			}
+			var err error
+			if options.apis.audits(group) {
+				r, err = auditedAdmission(r, group, options.apis, admit)
+			} else {
+				r, err = admit(r)
+			}
+			if err != nil {
+				appLogger.Warn("Error applying admission controllers", "error", err)
+				writeError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
 	}
+}
 
-	if isGzip {
-		rewriteResponseGzip(resp, responeData)
-	} else {
-		rewriteResponse(resp, responeData)
+func handRegisterResponse(resp *http.Response, maxSize int64, appLogger hclog.Logger) error {
+
+	warnings, ok := resp.Request.Context().Value(ctxWarnings).([]error)
+	if !ok && len(warnings) == 0 {
+		return nil
 	}
 
-	return nil
+	return patchResponse(resp, maxSize, appLogger, func(fields map[string]json.RawMessage) error {
+		if err := patchWarnings(fields, warnings); err != nil {
+			return err
+		}
+		return patchResults(fields, warnings)
+	})
 }
 
 func checkIfGzipAndTransformReader(resp *http.Response, reader io.ReadCloser) (bool, io.ReadCloser, error) {
 	enc := resp.Header.Get("Content-Encoding")
 	isGzip := enc == "gzip"
 	if isGzip {
-		gzipReader, err := gzip.NewReader(resp.Body)
+		gzipReader, err := newPooledGzipReader(resp.Body)
 		if err != nil {
 			return false, nil, err
 		}
@@ -233,38 +541,33 @@ func checkIfGzipAndTransformReader(resp *http.Response, reader io.ReadCloser) (b
 	}
 	return isGzip, reader, nil
 }
-func handleJobPlanResponse(resp *http.Response, appLogger hclog.Logger) error {
+func handleJobPlanResponse(resp *http.Response, maxSize int64, appLogger hclog.Logger) error {
 	warnings, ok := resp.Request.Context().Value(ctxWarnings).([]error)
 	if !ok && len(warnings) == 0 {
 		return nil
 	}
 
-	isGzip, reader, err := checkIfGzipAndTransformReader(resp, resp.Body)
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-
-	response := &api.JobPlanResponse{}
-	if err := json.NewDecoder(reader).Decode(response); err != nil {
-		return err
-	}
-
-	response.Warnings = buildFullWarningMsg(response.Warnings, warnings)
-
-	responeData, err := json.Marshal(response)
-
-	if err != nil {
-		return err
-	}
+	return patchResponse(resp, maxSize, appLogger, func(fields map[string]json.RawMessage) error {
+		if err := patchWarnings(fields, warnings); err != nil {
+			return err
+		}
+		if err := patchResults(fields, warnings); err != nil {
+			return err
+		}
+		return annotatePlanDiff(fields, warnings)
+	})
+}
 
-	if isGzip {
-		rewriteResponseGzip(resp, responeData)
-	} else {
-		rewriteResponse(resp, responeData)
-	}
-	return nil
+// validateResponse extends Nomad's validate response with NACP's findings by severity,
+// the errors are in ValidationErrors and all findings are also part of Warnings for the Nomad CLI.
+type validateResponse struct {
+	api.JobValidateResponse
+	NACPWarnings []string `json:"NACPWarnings,omitempty"`
+	NACPInfos    []string `json:"NACPInfos,omitempty"`
+	// NACPResults are the errors and warnings with their severity, field, code and docs URL
+	NACPResults []*types.Result `json:"NACPResults,omitempty"`
 }
+
 func handleJobValdidateResponse(resp *http.Response, appLogger hclog.Logger) error {
 
 	ctx := resp.Request.Context()
@@ -274,7 +577,7 @@ func handleJobValdidateResponse(resp *http.Response, appLogger hclog.Logger) err
 		return nil
 	}
 
-	response := &api.JobValidateResponse{}
+	response := &validateResponse{}
 	isGzip, reader, err := checkIfGzipAndTransformReader(resp, resp.Body)
 	if err != nil {
 		return err
@@ -300,25 +603,25 @@ func handleJobValdidateResponse(resp *http.Response, appLogger hclog.Logger) err
 
 		response.ValidationErrors = validationErrors
 		response.Error = validationError
+		response.NACPResults = admissionctrl.Denials(validationErr)
 	}
 
 	if len(warnings) > 0 {
 		response.Warnings = buildFullWarningMsg(response.Warnings, warnings)
+		for _, w := range warnings {
+			if types.SeverityOf(w) == types.SeverityInfo {
+				response.NACPInfos = append(response.NACPInfos, w.Error())
+			} else {
+				response.NACPWarnings = append(response.NACPWarnings, w.Error())
+			}
+		}
+		response.NACPResults = append(response.NACPResults, types.ResultsOf(warnings)...)
 	}
 
-	responeData, err := json.Marshal(response)
-
-	if err != nil {
+	if err := rewriteResponse(resp, response, isGzip); err != nil {
 		appLogger.Error("Error marshalling job", "error", err)
 		return err
 	}
-
-	if isGzip {
-		rewriteResponseGzip(resp, responeData)
-	} else {
-		rewriteResponse(resp, responeData)
-	}
-
 	return nil
 }
 
@@ -328,42 +631,25 @@ func buildFullWarningMsg(upstreamResponseWarnings string, warnings []error) stri
 	if upstreamResponseWarnings != "" {
 		multierror.Append(allWarnings, fmt.Errorf("%s", upstreamResponseWarnings))
 	}
-	allWarnings = multierror.Append(allWarnings, warnings...)
+	for _, w := range warnings {
+		allWarnings = multierror.Append(allWarnings, fmt.Errorf("[%s] %w", types.SeverityOf(w), w))
+	}
 	warningMsg := helper.MergeMultierrorWarnings(allWarnings)
 	return warningMsg
 }
 
-func rewriteResponse(resp *http.Response, newResponeData []byte) {
-	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(newResponeData)))
-
-	resp.ContentLength = int64(len(newResponeData))
-	resp.Body = io.NopCloser(bytes.NewBuffer(newResponeData))
-}
-func rewriteResponseGzip(resp *http.Response, newResponeData []byte) {
-
-	var compressed bytes.Buffer
-	gz := gzip.NewWriter(&compressed)
-	gz.Write(newResponeData)
-	gz.Close()
-
-	resp.Header.Set("Content-Length", strconv.Itoa(compressed.Len()))
-	resp.ContentLength = int64(compressed.Len())
-
-	resp.Body = io.NopCloser(&compressed)
-}
-func rewriteRequest(r *http.Request, data []byte) {
-
-	r.ContentLength = int64(len(data))
-	r.Body = io.NopCloser(bytes.NewBuffer(data))
-}
-
-func handleRegister(r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler) (*http.Request, error) {
-	body := r.Body
+func handleRegister(r *http.Request, rt route, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, preserve bool) (*http.Request, error) {
 	jobRegisterRequest := &api.JobRegisterRequest{}
 
-	if err := json.NewDecoder(body).Decode(jobRegisterRequest); err != nil {
-
-		return r, fmt.Errorf("failed decoding job, skipping admission controller: %w", err)
+	raw, err := decodeJobRequest(r, jobRegisterRequest, preserve)
+	if err != nil {
+		return r, errcode.New(errcode.CodeInvalidRequest, "", fmt.Errorf("failed decoding job, skipping admission controller: %w", err))
+	}
+	source := applyRouteScope(jobRegisterRequest.Job, rt, jobRegisterRequest.WriteRequest)
+	scopeContext(r, jobRegisterRequest.Job, source)
+	if reqCtx, ok := r.Context().Value("request_context").(*config.RequestContext); ok {
+		reqCtx.EnforceIndex = jobRegisterRequest.EnforceIndex
+		reqCtx.JobModifyIndex = jobRegisterRequest.JobModifyIndex
 	}
 	orginalJob := jobRegisterRequest.Job
 	payload := &types.Payload{
@@ -374,35 +660,40 @@ func handleRegister(r *http.Request, appLogger hclog.Logger, jobHandler *admissi
 		payload.Context = reqCtx
 	}
 
-	job, warnings, err := jobHandler.ApplyAdmissionControllers(payload)
+	admitCtx, err := raw.admit(r.Context(), jobRegisterRequest)
 	if err != nil {
-		return r, fmt.Errorf("admission controllers send an error, returning error: %w", err)
+		return r, err
 	}
-	jobRegisterRequest.Job = job
-
-	data, err := json.Marshal(jobRegisterRequest)
-
+	job, warnings, err := jobHandler.ApplyAdmissionControllersContext(admitCtx, payload)
 	if err != nil {
-		return r, fmt.Errorf("error marshalling job: %w", err)
+		return r, fmt.Errorf("admission controllers send an error, returning error: %w", err)
 	}
+	// only the job is replaced, EnforceIndex, JobModifyIndex and the other fields of the request are kept
+	jobRegisterRequest.Job = job
 
-	ctx := r.Context()
+	ctx := context.WithValue(r.Context(), ctxAdmittedJob, job)
+	ctx = context.WithValue(ctx, ctxAdmittedPayload, &types.Payload{Job: job, Context: payload.Context})
 	if len(warnings) > 0 {
 		ctx = context.WithValue(ctx, ctxWarnings, warnings)
 	}
 
-	appLogger.Debug("Job after admission controllers", "job", string(data))
 	r = r.WithContext(ctx)
-	rewriteRequest(r, data)
+	data, err := rewriteJobRequest(r, jobRegisterRequest, raw, appLogger)
+	if err != nil {
+		return r, fmt.Errorf("error marshalling job: %w", err)
+	}
+	appLogger.Debug("Job after admission controllers", "job", data)
 	return r, nil
 }
-func handlePlan(r *http.Request, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler) (*http.Request, error) {
-	body := r.Body
+func handlePlan(r *http.Request, rt route, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, preserve bool) (*http.Request, error) {
 	jobPlanRequest := &api.JobPlanRequest{}
 
-	if err := json.NewDecoder(body).Decode(jobPlanRequest); err != nil {
-		return r, fmt.Errorf("failed decoding job, skipping admission controller: %w", err)
+	raw, err := decodeJobRequest(r, jobPlanRequest, preserve)
+	if err != nil {
+		return r, errcode.New(errcode.CodeInvalidRequest, "", fmt.Errorf("failed decoding job, skipping admission controller: %w", err))
 	}
+	source := applyRouteScope(jobPlanRequest.Job, rt, jobPlanRequest.WriteRequest)
+	scopeContext(r, jobPlanRequest.Job, source)
 	orginalJob := jobPlanRequest.Job
 	payload := &types.Payload{
 		Job: orginalJob,
@@ -412,26 +703,28 @@ func handlePlan(r *http.Request, appLogger hclog.Logger, jobHandler *admissionct
 		payload.Context = reqCtx
 	}
 
-	job, warnings, err := jobHandler.ApplyAdmissionControllers(payload)
+	admitCtx, err := raw.admit(r.Context(), jobPlanRequest)
+	if err != nil {
+		return r, err
+	}
+	job, warnings, err := jobHandler.ApplyAdmissionControllersContext(admitCtx, payload)
 	if err != nil {
 		return r, fmt.Errorf("admission controllers send an error, returning error: %w", err)
 	}
 
 	jobPlanRequest.Job = job
 
-	data, err := json.Marshal(jobPlanRequest)
-
-	if err != nil {
-		return r, fmt.Errorf("error marshalling job: %w", err)
-	}
 	ctx := r.Context()
 	if len(warnings) > 0 {
 		ctx = context.WithValue(ctx, ctxWarnings, warnings)
 
 	}
 	r = r.WithContext(ctx)
-	appLogger.Debug("Job after admission controllers", "job", string(data))
-	rewriteRequest(r, data)
+	data, err := rewriteJobRequest(r, jobPlanRequest, raw, appLogger)
+	if err != nil {
+		return r, fmt.Errorf("error marshalling job: %w", err)
+	}
+	appLogger.Debug("Job after admission controllers", "job", data)
 	return r, nil
 }
 
@@ -441,9 +734,11 @@ func handleValidate(r *http.Request, appLogger hclog.Logger, jobHandler *admissi
 	jobValidateRequest := &api.JobValidateRequest{}
 	err := json.NewDecoder(body).Decode(jobValidateRequest)
 	if err != nil {
-		return r, err
+		return r, errcode.New(errcode.CodeInvalidRequest, "", err)
 	}
 	job := jobValidateRequest.Job
+	// Nomad validates the job in its own namespace regardless of the query
+	scopeContext(r, job, config.NamespaceSourceJob)
 	payload := &types.Payload{
 		Job: job,
 	}
@@ -452,14 +747,14 @@ func handleValidate(r *http.Request, appLogger hclog.Logger, jobHandler *admissi
 		payload.Context = reqCtx
 	}
 
-	job, mutateWarnings, err := jobHandler.AdmissionMutators(payload)
+	job, mutateWarnings, err := jobHandler.AdmissionMutatorsContext(r.Context(), payload)
 	if err != nil {
 		return r, err
 	}
 	jobValidateRequest.Job = job
 	payload.Job = job
 
-	validateWarnings, err := jobHandler.AdmissionValidators(payload)
+	validateWarnings, err := jobHandler.AdmissionValidatorsContext(r.Context(), payload)
 	//copied from https: //github.com/hashicorp/nomad/blob/v1.5.0/nomad/job_endpoint.go#L574
 
 	ctx := r.Context()
@@ -467,78 +762,285 @@ func handleValidate(r *http.Request, appLogger hclog.Logger, jobHandler *admissi
 
 	validateWarnings = append(validateWarnings, mutateWarnings...)
 
-	data, err := json.Marshal(jobValidateRequest)
-	if err != nil {
-		return r, err
-	}
-
 	if len(validateWarnings) > 0 {
 		ctx = context.WithValue(ctx, ctxWarnings, validateWarnings)
 
 	}
 	r = r.WithContext(ctx)
-	rewriteRequest(r, data)
+	if _, err := rewriteRequest(r, jobValidateRequest); err != nil {
+		return r, err
+	}
 	return r, nil
 
 }
 
+// Headers of rejected requests, so clients can tell a denied job from a failing rule without parsing the message.
+const (
+	headerErrorCode = "NACP-Error-Code"
+	headerRule      = "NACP-Rule"
+)
+
+// writeError rejects the request with the status of the error's code, retriable errors ask the client to retry.
 func writeError(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusInternalServerError)
+	coded := errcode.Of(err)
+	w.Header().Set(headerErrorCode, string(coded.Code))
+	if coded.Rule != "" {
+		w.Header().Set(headerRule, coded.Rule)
+	}
+	if coded.Retriable {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(coded.Code.Status())
 	w.Write([]byte(err.Error()))
 }
-func isRegister(r *http.Request) bool {
-	isRegister := isCreate(r) || isUpdate(r)
-	return isRegister
-}
-
-// cli does PUT, browser does POST :/
-func isCreate(r *http.Request) bool {
-	return (r.Method == "PUT" || r.Method == "POST") && r.URL.Path == "/v1/jobs"
-}
-func isUpdate(r *http.Request) bool {
-
-	return (r.Method == "PUT" || r.Method == "POST") && jobPathRegex.MatchString(r.URL.Path)
-}
-func isPlan(r *http.Request) bool {
-
-	return (r.Method == "PUT" || r.Method == "POST") && jobPlanPathRegex.MatchString(r.URL.Path)
-}
-func isValidate(r *http.Request) bool {
-
-	return (r.Method == "PUT" || r.Method == "POST") && r.URL.Path == "/v1/validate/job"
-}
 
 // https://www.codedodle.com/go-reverse-proxy-example.html
 // https://joshsoftware.wordpress.com/2021/05/25/simple-and-powerful-reverseproxy-in-go/
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "scaffold" {
+		if err := runScaffold(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "docs" {
+		if err := runDocs(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfigCommand(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		if err := runServiceCommand(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	flag.Parse()
+	if *showVersion {
+		printVersion(os.Stdout)
+		return
+	}
 
+	output, err := logOutput()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	appLogger := hclog.New(&hclog.LoggerOptions{
 		Name:   "nacp",
 		Level:  hclog.LevelFromString("DEBUG"),
-		Output: os.Stdout,
+		Output: output,
 	})
 
 	c := buildConfig(appLogger)
 	appLogger.SetLevel(hclog.LevelFromString(c.LogLevel))
-	server, err := buildServer(c, appLogger)
 
+	run := func(stop <-chan struct{}) error {
+		return runServer(c, appLogger, stop)
+	}
+	if isWindowsService() {
+		err = runWindowsService(run)
+	} else {
+		err = run(nil)
+	}
 	if err != nil {
-		appLogger.Error("Failed to build server", "error", err)
+		appLogger.Error("NACP stopped", "error", err)
 		os.Exit(1)
 	}
+}
+
+// runServer serves until the server fails, the listener was handed over to a new process or stop is closed.
+func runServer(c *config.Config, appLogger hclog.Logger, stop <-chan struct{}) error {
+	nacp, err := buildServer(c, appLogger)
+	if err != nil {
+		return fmt.Errorf("failed to build server: %w", err)
+	}
+	server := nacp.server
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go nacp.elector.Run(ctx)
+	if nacp.dataSources != nil {
+		go nacp.dataSources.Run(ctx)
+	}
+	if nacp.upstream != nil {
+		go nacp.upstream.Run(ctx)
+	}
+	if nacp.siem != nil {
+		go nacp.siem.Run(ctx)
+	}
+	if nacp.eventBus != nil {
+		go nacp.eventBus.Run(ctx)
+	}
+	if nacp.reporter != nil {
+		go nacp.reporter.Run(ctx)
+	}
+	if nacp.mirror != nil {
+		go nacp.mirror.Run(ctx)
+	}
+	if nacp.virtualTokens != nil {
+		defer func() {
+			revokeCtx, cancelRevoke := context.WithTimeout(context.Background(), nomadTimeout)
+			defer cancelRevoke()
+			if err := nacp.virtualTokens.RevokeAll(revokeCtx); err != nil {
+				appLogger.Warn("Revoking the virtual tokens failed", "error", err)
+			}
+		}()
+	}
+
+	reloader := newPolicyReloader(*configPath, c.DegradedMode, nacp.handler, nacp.status, appLogger.Named("reloader"), nacp.ruleOptions...)
+	reloader.shadow = nacp.shadow
+	reloader.exemptions = nacp.exemptions
+	reloader.reads = nacp.reads
+	go reloader.watchSignals()
+
+	listener, err := listen(c, server.Addr, appLogger)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	if nacp.adminServer != nil {
+		adminListener, err := net.Listen("tcp", nacp.adminServer.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on admin_bind: %w", err)
+		}
+		go serveAdmin(nacp.adminServer, adminListener, c, appLogger.Named("admin"))
+		defer nacp.adminServer.Close()
+	}
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		registered, err := runRegistration(ctx, c, addr.Port, appLogger.Named("consul"))
+		if err != nil {
+			return err
+		}
+		if registered != nil {
+			defer func() {
+				cancel()
+				select {
+				case <-registered:
+				case <-time.After(deregisterTimeout):
+				}
+			}()
+		}
+	}
+
+	upgraded := make(chan struct{})
+	if c.Upgrade != nil {
+		go func() {
+			if watchUpgrade(server, listener, drainTimeout(c), appLogger.Named("upgrade")) {
+				close(upgraded)
+			}
+		}()
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		select {
+		case <-upgraded:
+			appLogger.Info("Handed over to a new process")
+		case <-stop:
+			notify(appLogger, daemon.SdNotifyStopping)
+			if err := drain(server, drainTimeout(c), appLogger); err != nil {
+				appLogger.Error("Failed to drain in-flight requests", "error", err)
+			}
+		}
+	}()
+
+	if err := signalReady(); err != nil {
+		appLogger.Error("Failed to signal readiness to the previous process", "error", err)
+	}
+	notify(appLogger, daemon.SdNotifyReady)
+	go watchdog(ctx, appLogger)
 
 	var end error
 	if c.Tls != nil {
 		appLogger.Info("Starting NACP with TLS", "bind", c.Bind, "port", c.Port)
-		end = server.ListenAndServeTLS(c.Tls.CertFile, c.Tls.KeyFile)
+		end = server.ServeTLS(listener, c.Tls.CertFile, c.Tls.KeyFile)
 	} else {
 		appLogger.Info("Starting NACP", "bind", c.Bind, "port", c.Port)
-		end = server.ListenAndServe()
+		end = server.Serve(listener)
+	}
+	if errors.Is(end, http.ErrServerClosed) {
+		<-drained
+		appLogger.Info("NACP stopped")
+		return nil
+	}
+	return end
+}
+
+// serveAdmin serves the admin API on its own listener until it is closed, with the TLS settings of the proxy.
+func serveAdmin(server *http.Server, listener net.Listener, c *config.Config, appLogger hclog.Logger) {
+	var err error
+	if c.Tls != nil {
+		appLogger.Info("Starting admin API with TLS", "bind", server.Addr)
+		err = server.ServeTLS(listener, c.Tls.CertFile, c.Tls.KeyFile)
+	} else {
+		appLogger.Info("Starting admin API", "bind", server.Addr)
+		err = server.Serve(listener)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		appLogger.Error("Admin API stopped", "error", err)
 	}
-	appLogger.Error("NACP stopped", "error", end)
 }
 
-func buildServer(c *config.Config, appLogger hclog.Logger) (*http.Server, error) {
+// nacpServer bundles the http server with the components that change at runtime.
+type nacpServer struct {
+	server *http.Server
+	// adminServer is only set if the admin API has its own listener
+	adminServer *http.Server
+	admin       *adminAuth
+	handler     *admissionctrl.JobHandler
+	status      *rulesetStatus
+	elector     leader.Elector
+	dataSources *datasource.Manager
+	// upstream is only set if the nomad servers are discovered
+	upstream *discovery.Upstream
+	// faults is only set if the fault injection mode is enabled
+	faults *admissionctrl.FaultInjector
+	// policyTrace serves traces of OPA rules via the admin API
+	policyTrace bool
+	// shadow is only set if a candidate rule set is configured
+	shadow *admissionctrl.Shadow
+	// exemptions is only set if the exemptions block is configured
+	exemptions *admissionctrl.Exemptions
+	// siem is only set if the siem block is configured
+	siem *audit.Exporter
+	// eventBus is only set if the event_bus block is configured
+	eventBus *audit.Exporter
+	// reporter is only set if the decision_report block is configured
+	reporter *audit.Reporter
+	// mirror is only set if the mirror block is configured
+	mirror *mirror.Mirror
+	// vendor is only set if the token_vending block is configured
+	vendor *auth.TokenVendor
+	// virtualTokens is only set if the virtual_tokens block is configured
+	virtualTokens *auth.VirtualTokens
+	// maintenance is only set if the maintenance block is configured
+	maintenance *maintenanceMode
+	// reads applies the read rules, it has no rules if none are configured
+	reads *admissionctrl.ReadAuthorizer
+	// ruleOptions are passed to all OPA rules, also after a reload
+	ruleOptions []opa.Option
+	// features are the optional features enabled by the config, reported by the version endpoint
+	features []string
+}
+
+func buildServer(c *config.Config, appLogger hclog.Logger) (*nacpServer, error) {
 	backend, err := url.Parse(c.Nomad.Address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse nomad address: %w", err)
@@ -549,6 +1051,15 @@ func buildServer(c *config.Config, appLogger hclog.Logger) (*http.Server, error)
 		KeepAlive: nomadTimeout,
 	}).DialContext
 	proxyTransport.TLSHandshakeTimeout = nomadTimeout
+	if backend.Scheme == "unix" {
+		// e.g. the nomad task api socket
+		socket := backend.Path
+		dialer := &net.Dialer{Timeout: nomadTimeout}
+		proxyTransport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		backend = &url.URL{Scheme: "http", Host: "localhost"}
+	}
 
 	if c.Nomad.TLS != nil {
 		nomadTlsConfig, err := buildTlsConfig(*c.Nomad.TLS)
@@ -558,20 +1069,27 @@ func buildServer(c *config.Config, appLogger hclog.Logger) (*http.Server, error)
 		}
 		proxyTransport.TLSClientConfig = nomadTlsConfig
 	}
-
-	jobMutators, resolveTokenMutators, err := createMutators(c, appLogger.Named("mutators"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create mutators: %w", err)
+	if c.HTTP2 != nil && c.HTTP2.UpstreamH2C {
+		useUpstreamH2C(proxyTransport)
 	}
 
-	jobValidators, resolveTokenValidators, err := createValidators(c, appLogger.Named("validators"))
+	dataSources, err := buildDataSources(c, appLogger.Named("data_sources"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create validators: %w", err)
+		return nil, err
+	}
+	var ruleOptions []opa.Option
+	if dataSources != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), nomadTimeout)
+		defer cancel()
+		if err := dataSources.Load(ctx); err != nil {
+			return nil, err
+		}
+		ruleOptions = append(ruleOptions, opa.WithStore(dataSources.Store()))
 	}
 
-	var resolveToken bool
-	if resolveTokenMutators || resolveTokenValidators {
-		resolveToken = true
+	jobMutators, jobValidators, resolveToken, err := admission.BuildRules(c, appLogger, ruleOptions...)
+	if err != nil && c.DegradedMode != config.DegradedModePassThrough {
+		return nil, err
 	}
 
 	handler := admissionctrl.NewJobHandler(
@@ -581,8 +1099,228 @@ func buildServer(c *config.Config, appLogger hclog.Logger) (*http.Server, error)
 		appLogger.Named("handler"),
 		resolveToken,
 	)
+	if err != nil {
+		appLogger.Error("Failed to load rules, starting in pass-through mode", "error", err)
+		handler.PassThrough(err)
+	} else {
+		handler.UseRuleVersions(admission.RuleVersions(c))
+	}
+	if dataSources != nil {
+		handler.UseDataSources(dataSources)
+	}
+	var faults *admissionctrl.FaultInjector
+	if c.FaultInjection != nil && c.FaultInjection.Enabled {
+		appLogger.Warn("Fault injection mode is enabled, rules can be delayed and failed via the admin API")
+		faults = admissionctrl.NewFaultInjector()
+		handler.UseFaultInjector(faults)
+	}
+	exemptions, err := buildExemptions(c, appLogger.Named("exemptions"))
+	if err != nil {
+		return nil, err
+	}
+	if exemptions != nil {
+		handler.UseExemptions(exemptions)
+	}
+	if c.Revalidation != nil {
+		handler.UseRevalidation(c.Revalidation.MaxPasses)
+	}
+	if c.MutatorConflicts != nil {
+		handler.UseConflictStrategy(admissionctrl.ConflictStrategy(c.MutatorConflicts.Strategy))
+	}
+	var shadow *admissionctrl.Shadow
+	if c.Shadow != nil {
+		var data admissionctrl.DataProvider
+		if dataSources != nil {
+			data = dataSources
+		}
+		shadow, err = buildShadow(c, appLogger.Named("shadow"), data, ruleOptions...)
+		if err != nil {
+			return nil, err
+		}
+		handler.UseShadow(shadow)
+	}
+	readRules, err := admission.BuildReadRules(c, appLogger.Named("read_rules"), ruleOptions...)
+	if err != nil {
+		if c.DegradedMode != config.DegradedModePassThrough {
+			return nil, fmt.Errorf("failed to create read rules: %w", err)
+		}
+		appLogger.Error("Failed to load read rules, reads are NOT checked", "error", err)
+	}
+	reads := admissionctrl.NewReadAuthorizer(appLogger.Named("read_rules"), readRules...)
+	if dataSources != nil {
+		reads.UseDataSources(dataSources)
+	}
+
+	siem, err := buildSIEM(c, appLogger.Named("siem"))
+	if err != nil {
+		return nil, err
+	}
+	eventBus, err := buildEventBus(c, appLogger.Named("event_bus"))
+	if err != nil {
+		return nil, err
+	}
+	var sinks []admissionctrl.DecisionSink
+	if siem != nil {
+		sinks = append(sinks, siem)
+	}
+	if eventBus != nil {
+		sinks = append(sinks, eventBus)
+	}
+	reporter := buildReporter(c, appLogger.Named("report"))
+	if reporter != nil {
+		sinks = append(sinks, reporter)
+	}
+	if len(sinks) > 0 {
+		handler.UseDecisionSinks(sinks...)
+	}
+
+	proxyOpts := []ProxyOption{WithReadAuthorizer(reads)}
+	if c.Identity != nil {
+		resolver, err := buildIdentityResolver(c.Identity, appLogger.Named("identity"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create identity resolver: %w", err)
+		}
+		proxyOpts = append(proxyOpts, WithIdentityResolver(resolver))
+	}
+
+	trustedProxies, err := parseCIDRs("trusted_proxies", c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	proxyOpts = append(proxyOpts, WithTrustedProxies(trustedProxies))
+	contextHeaders := c.ContextHeaders
+	if contextHeaders == nil {
+		contextHeaders = config.DefaultContextHeaders
+	}
+	proxyOpts = append(proxyOpts, WithContextHeaders(contextHeaders))
+	proxyOpts = append(proxyOpts, WithMaxResponseSize(c.MaxResponseSize))
+	if c.LogNearMisses {
+		proxyOpts = append(proxyOpts, WithNearMissLogging())
+	}
+	if c.CORS != nil {
+		proxyOpts = append(proxyOpts, WithCORS(newCorsPolicy(c.CORS)))
+	}
+	if c.ForwardedHeaders != nil {
+		proxyOpts = append(proxyOpts, WithForwardedHeaders(newForwardedHeaders(trustedProxies, c.ForwardedHeaders)))
+	}
+	if headers := buildUpstreamHeaders(c); headers != nil {
+		proxyOpts = append(proxyOpts, WithUpstreamHeaders(headers))
+	}
+	if scrubbing := buildResponseScrubbing(c); scrubbing != nil {
+		proxyOpts = append(proxyOpts, WithResponseScrubbing(scrubbing))
+	}
+
+	upstream, err := buildUpstream(c, appLogger.Named("upstream"))
+	if err != nil {
+		return nil, err
+	}
+	if upstream != nil {
+		proxyOpts = append(proxyOpts, WithUpstream(upstream))
+	}
+	retry, err := buildRetryPolicy(c)
+	if err != nil {
+		return nil, err
+	}
+	if retry != nil {
+		proxyOpts = append(proxyOpts, WithRetry(retry))
+	}
+	if c.Nomad.PreserveUnknownFields {
+		proxyOpts = append(proxyOpts, WithPreservedUnknownFields())
+	}
+	tokens, err := buildTokenCache(c)
+	if err != nil {
+		return nil, err
+	}
+	if tokens != nil {
+		proxyOpts = append(proxyOpts, WithTokenCache(tokens))
+	}
+	if certPolicies := buildCertPolicies(c); certPolicies != nil {
+		proxyOpts = append(proxyOpts, WithCertPolicies(certPolicies))
+	}
+	networkACL, err := buildNetworkACL(c, appLogger.Named("network_acl"))
+	if err != nil {
+		return nil, err
+	}
+	if networkACL != nil {
+		proxyOpts = append(proxyOpts, WithNetworkACL(networkACL))
+	}
+	maintenance, err := buildMaintenance(c, appLogger.Named("maintenance"))
+	if err != nil {
+		return nil, err
+	}
+	if maintenance != nil {
+		proxyOpts = append(proxyOpts, WithMaintenance(maintenance))
+	}
+	if apis := buildAPIPolicy(c, appLogger.Named("apis")); apis != nil {
+		proxyOpts = append(proxyOpts, WithAPIs(apis))
+	}
+	jobMirror, err := buildMirror(c, appLogger.Named("mirror"))
+	if err != nil {
+		return nil, err
+	}
+	if jobMirror != nil {
+		proxyOpts = append(proxyOpts, WithMirror(jobMirror))
+	}
+
+	if c.AdmissionQueue != nil {
+		queue := admissionctrl.NewAdmissionQueue(c.AdmissionQueue.MaxConcurrent, c.AdmissionQueue.MaxQueued)
+		proxyOpts = append(proxyOpts, WithMiddleware(middleware.StageRateLimit, "admission_queue", admissionQueueMiddleware(queue, appLogger.Named("queue"))))
+	}
+	virtualTokens, err := buildVirtualTokens(c, appLogger.Named("virtual_tokens"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create virtual tokens: %w", err)
+	}
+	if virtualTokens != nil {
+		// before the login, so the session tokens of browser users are not taken for client tokens
+		proxyOpts = append(proxyOpts, WithMiddleware(middleware.StageAuth, "virtual_tokens", virtualTokens.Middleware))
+	}
+	authenticator, err := buildAuthenticator(c, appLogger.Named("auth"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticator: %w", err)
+	}
+	if authenticator != nil {
+		proxyOpts = append(proxyOpts, WithMiddleware(middleware.StageAuth, "oidc_login", authenticator.Middleware))
+	}
+
+	proxy := NewProxyHandler(backend, handler, appLogger, proxyTransport, proxyOpts...)
+
+	status := &rulesetStatus{}
+	status.Update(c)
+	build := currentBuild()
+	metrics.SetBuildInfo(build.Version, build.Commit, build.GoVersion)
 
-	proxy := NewProxyHandler(backend, handler, appLogger, proxyTransport)
+	elector, err := buildElector(c, appLogger.Named("leader"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create leader election: %w", err)
+	}
+
+	vendor, err := buildTokenVendor(c, appLogger.Named("token_vending"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token vending: %w", err)
+	}
+
+	nacp := &nacpServer{
+		features:      enabledFeatures(c),
+		handler:       handler,
+		status:        status,
+		elector:       elector,
+		dataSources:   dataSources,
+		upstream:      upstream,
+		faults:        faults,
+		policyTrace:   c.PolicyTrace != nil && c.PolicyTrace.Enabled,
+		exemptions:    exemptions,
+		reads:         reads,
+		shadow:        shadow,
+		siem:          siem,
+		eventBus:      eventBus,
+		reporter:      reporter,
+		mirror:        jobMirror,
+		vendor:        vendor,
+		virtualTokens: virtualTokens,
+		maintenance:   maintenance,
+		admin:         buildAdminAuth(c),
+		ruleOptions:   ruleOptions,
+	}
 
 	bind := fmt.Sprintf("%s:%d", c.Bind, c.Port)
 	var tlsConfig *tls.Config
@@ -595,19 +1333,47 @@ func buildServer(c *config.Config, appLogger hclog.Logger) (*http.Server, error)
 		}
 	}
 
+	mux := http.NewServeMux()
+	admin := NewAdminHandler(nacp, appLogger.Named("admin"))
+	if c.AdminBind != "" {
+		nacp.adminServer = &http.Server{
+			Addr:         c.AdminBind,
+			TLSConfig:    tlsConfig,
+			Handler:      admin,
+			ReadTimeout:  nomadTimeout,
+			WriteTimeout: nomadTimeout,
+		}
+	} else {
+		mux.Handle(adminPathPrefix, admin)
+	}
+	mux.Handle("GET "+healthPath, NewHealthHandler(handler, appLogger.Named("admin")))
+	if authenticator != nil {
+		mux.Handle(auth.PathPrefix, authenticator.Handler())
+	}
+	if vendor != nil {
+		registerTokenVendingEndpoints(mux, vendor, appLogger.Named("admin"))
+	}
+	mux.HandleFunc("/", proxy)
+
 	server := &http.Server{
 		Addr:         bind,
 		TLSConfig:    tlsConfig,
-		Handler:      http.HandlerFunc(proxy),
+		Handler:      mux,
 		ReadTimeout:  nomadTimeout,
 		WriteTimeout: nomadTimeout,
 	}
-	return server, nil
+	if c.HTTP2 != nil && c.HTTP2.H2C {
+		if err := enableH2C(server); err != nil {
+			return nil, fmt.Errorf("failed to enable h2c: %w", err)
+		}
+	}
+	nacp.server = server
+	return nacp, nil
 }
 
 func buildConfig(logger hclog.Logger) *config.Config {
 
-	configPtr := flag.String("config", "", "point to a nacp config file")
+	configPtr := configPath
 	flag.Parse()
 	var c *config.Config
 
@@ -622,6 +1388,10 @@ func buildConfig(logger hclog.Logger) *config.Config {
 		logger.Info("No config file found, using default config")
 		c = config.DefaultConfig()
 	}
+	if err := applySidecar(c, logger); err != nil {
+		logger.Error("Failed to apply sidecar settings", "error", err)
+		os.Exit(1)
+	}
 	return c
 }
 
@@ -644,98 +1414,105 @@ func createTlsConfig(caFile string, noClientCert bool) (*tls.Config, error) {
 	return tlsConfig, nil
 }
 
-func createMutators(c *config.Config, logger hclog.Logger) ([]admissionctrl.JobMutator, bool, error) {
-	var jobMutators []admissionctrl.JobMutator
-	var resolveToken bool
-	for _, m := range c.Mutators {
-		if m.ResolveToken {
-			resolveToken = true
+func buildIdentityResolver(c *config.Identity, logger hclog.Logger) (*identity.Resolver, error) {
+	var groups identity.GroupResolver
+	if c.LDAP != nil {
+		cacheTTL, err := time.ParseDuration(c.LDAP.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ldap cache_ttl: %w", err)
+		}
+		groups = identity.NewLDAPGroupResolver(identity.LDAPConfig{
+			URL:            c.LDAP.URL,
+			BindDN:         c.LDAP.BindDN,
+			BindPassword:   c.LDAP.BindPassword,
+			BaseDN:         c.LDAP.BaseDN,
+			UserFilter:     c.LDAP.UserFilter,
+			GroupAttribute: c.LDAP.GroupAttribute,
+			CacheTTL:       cacheTTL,
+		})
+	}
+	opts := []identity.Option{identity.WithGroupsHeader(c.GroupsHeader), identity.WithClaimHeaders(c.ClaimHeaders)}
+	if len(c.TrustedPeers) > 0 || c.TrustedCAFile != "" {
+		trust := &identity.HeaderTrust{}
+		peers, err := parseCIDRs("identity trusted_peers", c.TrustedPeers)
+		if err != nil {
+			return nil, err
 		}
-		switch m.Type {
-		case "opa_json_patch":
-			notationVerifier, err := buildVerifierIfEnabled(m.OpaRule.Notation, logger.Named("notation_verifier"))
+		trust.Peers = peers
+		if c.TrustedCAFile != "" {
+			pem, err := os.ReadFile(c.TrustedCAFile)
 			if err != nil {
-				return nil, resolveToken, err
+				return nil, fmt.Errorf("failed to read identity trusted_ca_file: %w", err)
 			}
-			mutator, err := mutator.NewOpaJsonPatchMutator(m.Name, m.OpaRule.Filename, m.OpaRule.Query, logger.Named("opa_mutator"), notationVerifier)
-			if err != nil {
-				return nil, resolveToken, err
+			trust.Roots = x509.NewCertPool()
+			if !trust.Roots.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in identity trusted_ca_file %s", c.TrustedCAFile)
 			}
-			jobMutators = append(jobMutators, mutator)
-
-		case "json_patch_webhook":
-			mutator, err := mutator.NewJsonPatchWebhookMutator(m.Name, m.Webhook.Endpoint, m.Webhook.Method, logger.Named("json_patch_webhook_mutator"))
-			if err != nil {
-				return nil, resolveToken, err
-			}
-			jobMutators = append(jobMutators, mutator)
-
-		default:
-			return nil, resolveToken, fmt.Errorf("unknown mutator type %s", m.Type)
 		}
-
+		opts = append(opts, identity.WithHeaderTrust(trust))
 	}
-	return jobMutators, resolveToken, nil
+	return identity.NewResolver(c.Source, c.Header, groups, logger, opts...)
 }
-func createValidators(c *config.Config, logger hclog.Logger) ([]admissionctrl.JobValidator, bool, error) {
-	var jobValidators []admissionctrl.JobValidator
-	var resolveToken bool
-	for _, v := range c.Validators {
-		if v.ResolveToken {
-			resolveToken = true
-		}
-		switch v.Type {
-		case "opa":
-			notationVerifier, err := buildVerifierIfEnabled(v.Notation, logger.Named("notation_verifier"))
-			if err != nil {
-				return nil, resolveToken, err
-			}
-			opaValidator, err := validator.NewOpaValidator(v.Name, v.OpaRule.Filename, v.OpaRule.Query, logger.Named("opa_validator"), notationVerifier)
-			if err != nil {
-				return nil, resolveToken, err
-			}
-			jobValidators = append(jobValidators, opaValidator)
 
-		case "webhook":
-			validator, err := validator.NewWebhookValidator(v.Name, v.Webhook.Endpoint, v.Webhook.Method, logger.Named("webhook_validator"))
+func buildDataSources(c *config.Config, logger hclog.Logger) (*datasource.Manager, error) {
+	if len(c.DataSources) == 0 {
+		return nil, nil
+	}
+	manager := datasource.NewManager(logger)
+	for _, ds := range c.DataSources {
+		var interval time.Duration
+		if ds.Interval != "" {
+			var err error
+			interval, err = time.ParseDuration(ds.Interval)
 			if err != nil {
-				return nil, resolveToken, err
+				return nil, fmt.Errorf("invalid interval for data source %s: %w", ds.Name, err)
 			}
-			jobValidators = append(jobValidators, validator)
-		case "notation":
-			notationVerifier, err := buildVerifier(v.Notation, logger.Named("notation_verifier"))
+		}
+		var source datasource.Source
+		switch ds.Type {
+		case "file":
+			source = &datasource.FileSource{Path: ds.Path}
+		case "http":
+			source = &datasource.HTTPSource{URL: ds.URL, Client: &http.Client{Timeout: nomadTimeout}}
+		case "consul_kv":
+			client, err := admission.ConsulClient(c)
 			if err != nil {
-				return nil, resolveToken, err
+				return nil, fmt.Errorf("failed to create consul client for data source %s: %w", ds.Name, err)
 			}
-			validator := validator.NewNotationValidator(logger.Named("notation_validator"), v.Name, notationVerifier)
-
-			jobValidators = append(jobValidators, validator)
-
+			source = &datasource.ConsulKVSource{KV: client.KV(), Prefix: ds.Prefix}
 		default:
-			return nil, resolveToken, fmt.Errorf("unknown validator type %s", v.Type)
+			return nil, fmt.Errorf("unknown data source type %s", ds.Type)
 		}
-
+		manager.Add(ds.Name, source, interval)
 	}
-	return jobValidators, resolveToken, nil
+	return manager, nil
 }
-func buildVerifierIfEnabled(notationVerifierConfig *config.NotationVerifierConfig, logger hclog.Logger) (notation.ImageVerifier, error) {
-	if notationVerifierConfig == nil {
-		return nil, nil
-	}
-	return buildVerifier(notationVerifierConfig, logger)
-}
-func buildVerifier(notationVerifierConfig *config.NotationVerifierConfig, logger hclog.Logger) (notation.ImageVerifier, error) {
 
-	if notationVerifierConfig == nil {
-		return nil, fmt.Errorf("notation verifier config is nil")
+func buildElector(c *config.Config, logger hclog.Logger) (leader.Elector, error) {
+	election := c.LeaderElection
+	if election == nil {
+		return leader.Static{}, nil
 	}
-	policy, err := notation.LoadTrustPolicyDocument(notationVerifierConfig.TrustPolicyFile)
+	ttl, err := time.ParseDuration(election.TTL)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid ttl: %w", err)
+	}
+	switch election.Backend {
+	case "nomad":
+		client, err := admission.NomadClient(c)
+		if err != nil {
+			return nil, err
+		}
+		return leader.NewNomadElector(client, election.Path, ttl, logger)
+	case "consul":
+		client, err := admission.ConsulClient(c)
+		if err != nil {
+			return nil, err
+		}
+		return leader.NewConsulElector(client, election.Path, ttl, logger)
+	default:
+		return nil, fmt.Errorf("unknown leader election backend %s", election.Backend)
 	}
-	ts := truststore.NewX509TrustStore(dir.NewSysFS(notationVerifierConfig.TrustStoreDir))
-
-	return notation.NewImageVerifier(policy, ts, notationVerifierConfig.RepoPlainHTTP, notationVerifierConfig.MaxSigAttempts, notationVerifierConfig.CredentialStoreFile, logger)
 }
 
 func buildTlsConfig(config config.NomadServerTLS) (*tls.Config, error) {
@@ -761,6 +1538,7 @@ func buildTlsConfig(config config.NomadServerTLS) (*tls.Config, error) {
 
 		Certificates: []tls.Certificate{cert},
 		RootCAs:      caCertPool,
+		ServerName:   config.ServerName,
 	}
 	return tlsConfig, err
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bufio"
 	"compress/gzip"
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"errors"
@@ -12,8 +14,10 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-multierror"
@@ -23,9 +27,11 @@ import (
 	"github.com/hashicorp/nomad/helper/tlsutil"
 	"github.com/hashicorp/nomad/lib/file"
 	"github.com/mxab/nacp/admissionctrl"
-	"github.com/mxab/nacp/admissionctrl/mutator"
+	"github.com/mxab/nacp/admissionctrl/errcode"
+	"github.com/mxab/nacp/admissionctrl/types"
 	"github.com/mxab/nacp/admissionctrl/validator"
 	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/identity"
 	"github.com/mxab/nacp/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -108,7 +114,7 @@ func TestProxy(t *testing.T) {
 
 			wantProxyResponse: &api.JobPlanResponse{
 				// TODO: rework error concatination
-				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* some warning",
+				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* [warning] some warning",
 			},
 
 			nomadResponse: toJson(t, &api.JobPlanResponse{
@@ -133,7 +139,7 @@ func TestProxy(t *testing.T) {
 
 			wantProxyResponse: &api.JobPlanResponse{
 				// TODO: rework error concatination
-				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* some warning",
+				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* [warning] some warning",
 			},
 
 			nomadResponse: toJson(t, &api.JobPlanResponse{
@@ -158,7 +164,7 @@ func TestProxy(t *testing.T) {
 			wantNomadRequestJson: registerRequestJson(t, testutil.ReadJob(t, "job.json")),
 
 			wantProxyResponse: &api.JobRegisterResponse{
-				Warnings: "1 warning:\n\n* some warning",
+				Warnings: "1 warning:\n\n* [warning] some warning",
 			},
 
 			nomadResponse: toJson(t, &api.JobRegisterResponse{}),
@@ -180,7 +186,7 @@ func TestProxy(t *testing.T) {
 
 			wantProxyResponse: &api.JobRegisterResponse{
 				// TODO: rework error concatination
-				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* some warning",
+				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* [warning] some warning",
 			},
 
 			nomadResponse: toJson(t, &api.JobRegisterResponse{
@@ -204,7 +210,7 @@ func TestProxy(t *testing.T) {
 
 			wantProxyResponse: &api.JobRegisterResponse{
 				// TODO: rework error concatination
-				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* some warning",
+				Warnings: "2 warnings:\n\n* 1 error occurred:\n\t* some warning\n* [warning] some warning",
 			},
 
 			nomadResponse: toJson(t, &api.JobRegisterResponse{
@@ -227,7 +233,7 @@ func TestProxy(t *testing.T) {
 			wantNomadRequestJson: planRequestJson(t, testutil.ReadJob(t, "job.json")),
 
 			wantProxyResponse: &api.JobPlanResponse{
-				Warnings: "1 warning:\n\n* some warning",
+				Warnings: "1 warning:\n\n* [warning] some warning",
 			},
 
 			nomadResponse: toJson(t, &api.JobPlanResponse{}),
@@ -236,6 +242,35 @@ func TestProxy(t *testing.T) {
 			},
 			mutators: []admissionctrl.JobMutator{},
 		},
+		{
+			name:   "plan job adds warnings to the diff",
+			path:   "/v1/job/example/plan",
+			method: "PUT",
+			requestSender: func(c *api.Client) (interface{}, *api.WriteMeta, error) {
+				return c.Jobs().Plan(testutil.ReadJob(t, "job.json"), true, nil)
+			},
+
+			wantNomadRequestJson: planRequestJsonWithDiff(t, testutil.ReadJob(t, "job.json")),
+
+			wantProxyResponse: &api.JobPlanResponse{
+				Warnings: "1 warning:\n\n* [warning] some warning",
+				Diff: &api.JobDiff{
+					Type: "Edited",
+					ID:   "example",
+					Objects: []*api.ObjectDiff{{
+						Type:   "None",
+						Name:   "NACP",
+						Fields: []*api.FieldDiff{{Type: "None", Name: "Warning", New: "some warning"}},
+					}},
+				},
+			},
+
+			nomadResponse: toJson(t, &api.JobPlanResponse{Diff: &api.JobDiff{Type: "Edited", ID: "example"}}),
+			validators: []admissionctrl.JobValidator{
+				mockValidatorReturningWarnings("some warning"),
+			},
+			mutators: []admissionctrl.JobMutator{},
+		},
 		{
 			name:   "validate job adds hello meta",
 			path:   "/v1/validate/job",
@@ -265,7 +300,7 @@ func TestProxy(t *testing.T) {
 			wantNomadRequestJson: toJson(t, &api.JobValidateRequest{Job: &api.Job{}}),
 
 			wantProxyResponse: &api.JobValidateResponse{
-				Warnings: helper.MergeMultierrorWarnings(errors.New("some warning")),
+				Warnings: helper.MergeMultierrorWarnings(errors.New("[warning] some warning")),
 			},
 
 			nomadResponse: toJson(t, &api.JobValidateResponse{}),
@@ -306,7 +341,7 @@ func TestProxy(t *testing.T) {
 			wantNomadRequestJson: toJson(t, &api.JobValidateRequest{Job: &api.Job{}}),
 
 			wantProxyResponse: &api.JobValidateResponse{
-				Warnings: helper.MergeMultierrorWarnings(errors.New("some warning")),
+				Warnings: helper.MergeMultierrorWarnings(errors.New("[warning] some warning")),
 			},
 
 			nomadResponse:         toJson(t, &api.JobValidateResponse{}),
@@ -331,7 +366,7 @@ func TestProxy(t *testing.T) {
 			wantNomadRequestJson: toJson(t, &api.JobValidateRequest{Job: &api.Job{}}),
 
 			wantProxyResponse: &api.JobValidateResponse{
-				Warnings: helper.MergeMultierrorWarnings(errors.New("some warning")),
+				Warnings: helper.MergeMultierrorWarnings(errors.New("[warning] some warning")),
 			},
 
 			nomadResponse:         toJson(t, &api.JobValidateResponse{}),
@@ -562,6 +597,15 @@ func planRequestJson(t *testing.T, wantJob *api.Job) string {
 
 }
 
+func planRequestJsonWithDiff(t *testing.T, wantJob *api.Job) string {
+	t.Helper()
+	plan := &api.JobPlanRequest{
+		Job:  wantJob,
+		Diff: true,
+	}
+	return toJson(t, plan)
+}
+
 func TestAdmissionControllerErrors(t *testing.T) {
 	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 
@@ -595,7 +639,283 @@ func TestAdmissionControllerErrors(t *testing.T) {
 	assert.Equal(t, 500, res.StatusCode, "Should return 400")
 	_, err = io.ReadAll(res.Body)
 	require.NoError(t, err)
+	assert.Equal(t, "denied", res.Header.Get("NACP-Error-Code"))
+	assert.Equal(t, "mock-validator", res.Header.Get("NACP-Rule"))
+	assert.Empty(t, res.Header.Get("Retry-After"), "denials are final")
+
+}
+
+func TestWriteError(t *testing.T) {
+	tt := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantCode       string
+		wantRule       string
+		wantRetryAfter string
+	}{
+		{name: "uncoded", err: fmt.Errorf("boom"), wantStatus: http.StatusInternalServerError, wantCode: "internal"},
+		{name: "invalid request", err: errcode.New(errcode.CodeInvalidRequest, "", fmt.Errorf("bad json")), wantStatus: http.StatusBadRequest, wantCode: "invalid_request"},
+		{name: "unavailable webhook", err: fmt.Errorf("admission controllers send an error, returning error: %w", errcode.Unreachable("hook", fmt.Errorf("connection refused"))), wantStatus: http.StatusServiceUnavailable, wantCode: "unavailable", wantRule: "hook", wantRetryAfter: "1"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, tc.err)
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			assert.Equal(t, tc.wantCode, rec.Header().Get(headerErrorCode))
+			assert.Equal(t, tc.wantRule, rec.Header().Get(headerRule))
+			assert.Equal(t, tc.wantRetryAfter, rec.Header().Get("Retry-After"))
+			assert.Equal(t, tc.err.Error(), rec.Body.String())
+		})
+	}
+}
+
+type staticGroups map[string][]string
+
+func (s staticGroups) Groups(_ context.Context, identity string) ([]string, error) {
+	return s[identity], nil
+}
+
+func TestProxyAddsIdentity(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.MatchedBy(func(payload *types.Payload) bool {
+		return payload.Context.Identity == "alice" && assert.ObjectsAreEqual([]string{"team-a"}, payload.Context.Groups)
+	})).Return([]error{}, nil)
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger(), false)
+	_, loopback, err := net.ParseCIDR("127.0.0.1/32")
+	require.NoError(t, err)
+	resolver, err := identity.NewResolver(identity.SourceHeader, "X-Forwarded-User", staticGroups{"alice": {"team-a"}}, hclog.NewNullLogger(),
+		identity.WithHeaderTrust(&identity.HeaderTrust{Peers: []*net.IPNet{loopback}}))
+	require.NoError(t, err)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithIdentityResolver(resolver))
 
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, testutil.ReadJob(t, "job.json"))))
+	require.NoError(t, err)
+	req.Header.Set("X-Forwarded-User", "alice")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	validator.AssertExpectations(t)
+}
+
+func TestProxyAddsRequestContext(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.MatchedBy(func(payload *types.Payload) bool {
+		return payload.Context.Operation == config.OperationRegister &&
+			payload.Context.Method == http.MethodPut &&
+			payload.Context.Path == "/v1/jobs" &&
+			assert.ObjectsAreEqual(map[string]string{"User-Agent": "nomad", "X-Request-Id": "a, b"}, payload.Context.Headers)
+	})).Return([]error{}, nil)
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithContextHeaders([]string{"user-agent", "X-Request-Id", "X-Missing"}))
+
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, testutil.ReadJob(t, "job.json"))))
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "nomad")
+	req.Header.Set("X-Nomad-Token", "secret")
+	req.Header.Add("X-Request-Id", "a")
+	req.Header.Add("X-Request-Id", "b")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	validator.AssertExpectations(t)
+}
+
+func TestProxyNamespaceOverride(t *testing.T) {
+	var forwarded string
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		forwarded = req.URL.Query().Get("namespace")
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.MatchedBy(func(payload *types.Payload) bool {
+		return *payload.Job.Namespace == "billing" &&
+			payload.Context.Namespace == "billing" &&
+			payload.Context.NamespaceSource == config.NamespaceSourceHeader
+	})).Return([]error{}, nil)
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger(), false)
+	proxyServer := httptest.NewServer(http.HandlerFunc(NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)))
+	defer proxyServer.Close()
+
+	req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs", strings.NewReader(registerRequestJson(t, testutil.ReadJob(t, "job.json"))))
+	require.NoError(t, err)
+	req.Header.Set("X-Nomad-Namespace", "billing")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "billing", forwarded)
+	validator.AssertExpectations(t)
+}
+
+func TestProxyKeepsCheckAndSet(t *testing.T) {
+	var forwarded *api.JobRegisterRequest
+	var token string
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		token = req.URL.Query().Get("idempotency_token")
+		forwarded = &api.JobRegisterRequest{}
+		_ = json.NewDecoder(req.Body).Decode(forwarded)
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+
+	mutated := testutil.ReadJob(t, "job.json")
+	mutated.Meta = map[string]string{"mutated": "true"}
+	mutator := new(testutil.MockMutator)
+	mutator.On("Mutate", mock.MatchedBy(func(payload *types.Payload) bool {
+		return payload.Context.IdempotencyToken == "deploy-42" &&
+			payload.Context.EnforceIndex &&
+			payload.Context.JobModifyIndex == 42
+	})).Return(mutated, []error{}, nil)
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{mutator}, nil, hclog.NewNullLogger(), false)
+	proxyServer := httptest.NewServer(http.HandlerFunc(NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)))
+	defer proxyServer.Close()
+
+	body := toJson(t, &api.JobRegisterRequest{
+		Job:            testutil.ReadJob(t, "job.json"),
+		EnforceIndex:   true,
+		JobModifyIndex: 42,
+		PreserveCounts: true,
+	})
+	req, err := http.NewRequest(http.MethodPut, proxyServer.URL+"/v1/jobs?idempotency_token=deploy-42", strings.NewReader(body))
+	require.NoError(t, err)
+	// the namespace header rewrites the query, the token must survive it
+	req.Header.Set("X-Nomad-Namespace", "billing")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	mutator.AssertExpectations(t)
+
+	assert.Equal(t, "deploy-42", token)
+	require.NotNil(t, forwarded)
+	assert.True(t, forwarded.EnforceIndex)
+	assert.Equal(t, uint64(42), forwarded.JobModifyIndex)
+	assert.True(t, forwarded.PreserveCounts)
+	assert.Equal(t, "true", forwarded.Job.Meta["mutated"])
+}
+
+func TestProxyRecordsQuotaUsageOfAcceptedRegistrations(t *testing.T) {
+	accept := false
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !accept {
+			rw.WriteHeader(http.StatusInternalServerError)
+			_, _ = rw.Write([]byte("job registration failed"))
+			return
+		}
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+
+	quota, err := validator.NewQuotaValidator(hclog.NewNullLogger(), "registrations", validator.QuotaKeyNamespace, time.Hour, 1, 0, nil)
+	require.NoError(t, err)
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{quota}, hclog.NewNullLogger(), false)
+	proxyServer := httptest.NewServer(http.HandlerFunc(NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)))
+	defer proxyServer.Close()
+
+	register := func() int {
+		res, err := http.Post(proxyServer.URL+"/v1/jobs", "application/json", strings.NewReader(registerRequestJson(t, testutil.ReadJob(t, "job.json"))))
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusInternalServerError, register())
+	accept = true
+	assert.Equal(t, http.StatusOK, register(), "the registration Nomad rejected is not counted")
+	assert.NotEqual(t, http.StatusOK, register(), "the accepted registration is counted")
+}
+
+func TestValidateResponseSeverities(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`{"DriverConfigValidated": true}`))
+	}))
+	defer nomadDummy.Close()
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{
+		fmt.Errorf("count is high"),
+		types.WithSeverity(fmt.Errorf("consider a canary"), types.SeverityInfo),
+	}, nil)
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger(), false)
+	proxyServer := httptest.NewServer(http.HandlerFunc(NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)))
+	defer proxyServer.Close()
+
+	body := toJson(t, &api.JobValidateRequest{Job: testutil.ReadJob(t, "job.json")})
+	res, err := sendPut(t, proxyServer.URL+"/v1/validate/job", strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	response := &validateResponse{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(response))
+	assert.True(t, response.DriverConfigValidated)
+	assert.Equal(t, "2 warnings:\n\n* [warning] count is high\n* [info] consider a canary", response.Warnings)
+	assert.Equal(t, []string{"count is high"}, response.NACPWarnings)
+	assert.Equal(t, []string{"consider a canary"}, response.NACPInfos)
+	assert.Equal(t, []*types.Result{
+		{Severity: types.SeverityWarning, Message: "count is high"},
+		{Severity: types.SeverityInfo, Message: "consider a canary"},
+	}, response.NACPResults)
+}
+
+func TestValidateResponseResults(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte(`{"DriverConfigValidated": true}`))
+	}))
+	defer nomadDummy.Close()
+
+	denial := &types.Result{Severity: types.SeverityError, Message: "count must be at least 2", Field: "TaskGroups[0].Count", Code: "min_count", DocsURL: "https://example.com/count"}
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, denial)
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger(), false)
+	proxyServer := httptest.NewServer(http.HandlerFunc(NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)))
+	defer proxyServer.Close()
+
+	body := toJson(t, &api.JobValidateRequest{Job: testutil.ReadJob(t, "job.json")})
+	res, err := sendPut(t, proxyServer.URL+"/v1/validate/job", strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	response := &validateResponse{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(response))
+	assert.Equal(t, []string{"TaskGroups[0].Count: count must be at least 2, see https://example.com/count"}, response.ValidationErrors)
+	assert.Equal(t, []*types.Result{denial}, response.NACPResults)
 }
 
 func sendPut(t *testing.T, url string, body io.Reader) (*http.Response, error) {
@@ -611,12 +931,32 @@ func sendPut(t *testing.T, url string, body io.Reader) (*http.Response, error) {
 func TestDefaultBuildServer(t *testing.T) {
 	logger := hclog.NewNullLogger()
 	c := buildConfig(logger)
-	server, err := buildServer(c, logger)
+	nacp, err := buildServer(c, logger)
 	assert.NoError(t, err)
 
-	assert.NotNil(t, server)
+	assert.NotNil(t, nacp.server)
 
 }
+
+func TestRunServerDrainsOnStop(t *testing.T) {
+	c := config.DefaultConfig()
+	c.Bind = "127.0.0.1"
+	c.Port = 0
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- runServer(c, hclog.NewNullLogger(), stop)
+	}()
+	close(stop)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
 func TestBuildServerFailsOnInvalidNomadUrl(t *testing.T) {
 	logger := hclog.NewNullLogger()
 	c := config.DefaultConfig()
@@ -643,193 +983,28 @@ func TestBuildServerFailsInvalidMutatorTypes(t *testing.T) {
 	_, err := buildServer(c, logger)
 	assert.Error(t, err, "failed to create mutators: unknown mutator type doesnotexit")
 }
-func TestCreateValidators(t *testing.T) {
+func TestBuildDataSources(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "teams.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"team-a": {}}`), 0644))
 
-	tt := []struct {
-		name       string
-		validators config.Validator
-		want       admissionctrl.JobValidator
-		wantErr    bool
-	}{
-
-		{
-			name: "opa validator",
-			validators: config.Validator{
-
-				Type: "opa",
-				Name: "test",
-				OpaRule: &config.OpaRule{
-					Query:    "errors = data.dummy.errors",
-					Filename: testutil.Filepath(t, "opa/errors.rego"),
-				},
-			},
-			want: &validator.OpaValidator{},
-		},
-		{
-			name: "webhook validator",
-			validators: config.Validator{
-
-				Type: "webhook",
-				Name: "test",
-				Webhook: &config.Webhook{
-					Endpoint: "http://example.com",
-					Method:   "PUT",
-				},
-			},
-			want: &validator.WebhookValidator{},
-		},
-		{
-			name: "invalid validator type",
-			validators: config.Validator{
-
-				Type: "invalid",
-				Name: "test",
-				OpaRule: &config.OpaRule{
-					Query:    "errors = data.dummy.errors",
-					Filename: testutil.Filepath(t, "opa/errors.rego"),
-				},
-			},
-			wantErr: true,
-		},
-	}
-
-	for _, tc := range tt {
-		t.Run(tc.name, func(t *testing.T) {
-			c := &config.Config{
-				Validators: []config.Validator{tc.validators},
-			}
-
-			validators, _, err := createValidators(c, hclog.NewNullLogger())
-
-			if tc.wantErr {
-				assert.Error(t, err)
-				return
-			}
-
-			assert.IsType(t, tc.want, validators[0])
-
-		})
-
-	}
-}
-func TestNotationValidatorConfig(t *testing.T) {
-
-	policyDir := t.TempDir()
-
-	policyJson := `
-	{
-		"version": "1.0",
-		"trustPolicies": [
-			{
-				"name": "wabbit-networks-images",
-				"registryScopes": [ "*" ],
-				"signatureVerification": {
-					"level" : "strict"
-				},
-				"trustStores": [ "ca:wabbit-networks.io" ],
-				"trustedIdentities": [
-					"*"
-				]
-			}
-		]
-	}`
-
-	policyPath := fmt.Sprintf("%s/policy.json", policyDir)
-	err := os.WriteFile(policyPath, []byte(policyJson), 0644)
-	if err != nil {
-		t.Fatal(err)
-	}
-	truststoreDir := t.TempDir()
-
-	c := &config.Config{
-		Validators: []config.Validator{
-			{
-
-				Type: "notation",
-				Name: "test",
-				Notation: &config.NotationVerifierConfig{
-					TrustPolicyFile: policyPath,
-					TrustStoreDir:   truststoreDir,
-					RepoPlainHTTP:   true,
-					MaxSigAttempts:  1,
-				},
-			},
-		},
-	}
-
-	validators, _, err := createValidators(c, hclog.NewNullLogger())
-
-	assert.NoError(t, err)
-	assert.IsType(t, &validator.NotationValidator{}, validators[0])
-
-}
-
-func TestCreateMutatators(t *testing.T) {
-	tt := []struct {
-		name     string
-		mutators config.Mutator
-		want     admissionctrl.JobMutator
-		wantErr  bool
-	}{
-		{
-			name: "opa json patch mutator",
-			mutators: config.Mutator{
-
-				Type: "opa_json_patch",
-				Name: "test",
-				OpaRule: &config.OpaRule{
-					Query:    "errors = data.dummy.errors",
-					Filename: testutil.Filepath(t, "opa/errors.rego"),
-				},
-			},
-			want: &mutator.OpaJsonPatchMutator{},
-		},
-		{
-			name: "webhook json patch mutator",
-			mutators: config.Mutator{
-
-				Type: "json_patch_webhook",
-				Name: "test",
-				Webhook: &config.Webhook{
-					Endpoint: "http://example.com",
-					Method:   "PUT",
-				},
-			},
-			want: &mutator.JsonPatchWebhookMutator{},
-		},
-		{
-			name: "invalid mutator type",
-			mutators: config.Mutator{
-
-				Type: "invalid",
-				Name: "test",
-				OpaRule: &config.OpaRule{
-					Query:    "errors = data.dummy.errors",
-					Filename: testutil.Filepath(t, "opa/errors.rego"),
-				},
-			},
-			wantErr: true,
-		},
-	}
-
-	for _, tc := range tt {
-		t.Run(tc.name, func(t *testing.T) {
-			c := &config.Config{
-				Mutators: []config.Mutator{tc.mutators},
-			}
-
-			mutators, _, err := createMutators(c, hclog.NewNullLogger())
-
-			if tc.wantErr {
-				assert.Error(t, err)
-				return
-			}
+	c := config.DefaultConfig()
+	manager, err := buildDataSources(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Nil(t, manager, "no manager without data sources")
 
-			assert.IsType(t, tc.want, mutators[0])
+	c.DataSources = []config.DataSource{{Type: "file", Name: "teams", Path: file}}
+	manager, err = buildDataSources(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	require.NoError(t, manager.Load(context.Background()))
+	assert.Equal(t, map[string]interface{}{"teams": map[string]interface{}{"team-a": map[string]interface{}{}}}, manager.Snapshot())
 
-		})
+	c.DataSources = []config.DataSource{{Type: "ftp", Name: "teams"}}
+	_, err = buildDataSources(c, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "unknown data source type ftp")
 
-	}
+	c.DataSources = []config.DataSource{{Type: "file", Name: "teams", Path: file, Interval: "often"}}
+	_, err = buildDataSources(c, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "invalid interval")
 }
 
 func TestCreateTlsConfig(t *testing.T) {
@@ -939,3 +1114,149 @@ func writeTLSStuff(t *testing.T, name, data string) {
 		t.Fatal(err)
 	}
 }
+
+func TestGetClientIP(t *testing.T) {
+	tt := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		trusted    []string
+		want       string
+	}{
+		{
+			name:       "no forwarded header",
+			remoteAddr: "10.0.0.1:1234",
+			trusted:    []string{"10.0.0.0/8"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "header ignored without trusted proxies",
+			remoteAddr: "198.51.100.9:1234",
+			forwarded:  []string{"203.0.113.7"},
+			want:       "198.51.100.9",
+		},
+		{
+			name:       "header ignored from untrusted peer",
+			remoteAddr: "198.51.100.9:1234",
+			forwarded:  []string{"203.0.113.7"},
+			trusted:    []string{"10.0.0.0/8"},
+			want:       "198.51.100.9",
+		},
+		{
+			name:       "header honored from trusted peer",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"203.0.113.7"},
+			trusted:    []string{"10.0.0.0/8"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed entries before the last untrusted hop are ignored",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"1.2.3.4, 203.0.113.7", "10.0.0.2"},
+			trusted:    []string{"10.0.0.0/8"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "only trusted hops",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"10.0.0.3, 10.0.0.2"},
+			trusted:    []string{"10.0.0.0/8"},
+			want:       "10.0.0.3",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			trusted, err := parseCIDRs("trusted_proxies", tc.trusted)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPut, "/v1/jobs", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, v := range tc.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			assert.Equal(t, tc.want, getClientIP(req, trusted))
+		})
+	}
+}
+
+func TestProxyCORS(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Access-Control-Allow-Origin", "*")
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer nomadDummy.Close()
+
+	validator := new(testutil.MockValidator)
+	validator.On("Validate", mock.Anything).Return([]error{}, fmt.Errorf("count is too high"))
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{validator}, hclog.NewNullLogger(), false)
+	policy := newCorsPolicy(&config.CORS{AllowedOrigins: []string{"https://ui.example.com"}, MaxAge: "10m"})
+	proxyServer := httptest.NewServer(http.HandlerFunc(NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithCORS(policy))))
+	defer proxyServer.Close()
+
+	tt := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "nomad response", method: http.MethodGet, path: "/v1/jobs", wantStatus: http.StatusOK},
+		{name: "rejection", method: http.MethodPost, path: "/v1/jobs", body: registerRequestJson(t, testutil.ReadJob(t, "job.json")), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, proxyServer.URL+tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Origin", "https://ui.example.com")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, res.StatusCode)
+			assert.Equal(t, []string{"https://ui.example.com"}, res.Header.Values("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestProxyUpgradeOutlivesWriteTimeout(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		conn, brw, err := http.NewResponseController(rw).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		_ = brw.Flush()
+		// answer after the write timeout of the proxy
+		time.Sleep(300 * time.Millisecond)
+		_, _ = brw.WriteString("pong")
+		_ = brw.Flush()
+	}))
+	defer nomadDummy.Close()
+
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxyServer := httptest.NewUnstartedServer(http.HandlerFunc(NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)))
+	proxyServer.Config.WriteTimeout = 100 * time.Millisecond
+	proxyServer.Start()
+	defer proxyServer.Close()
+
+	conn, err := net.Dial("tcp", proxyServer.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /v1/client/allocation/1/exec HTTP/1.1\r\nHost: nomad\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+
+	pong := make([]byte, 4)
+	_, err = io.ReadFull(reader, pong)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(pong))
+}
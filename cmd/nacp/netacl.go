@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/metrics"
+)
+
+type networkRules struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// permits reports whether the client may send requests of the class, missing rules permit every client.
+func (n *networkRules) permits(clientIP string) bool {
+	if n == nil {
+		return true
+	}
+	if trusts(n.deny, clientIP) {
+		return false
+	}
+	return len(n.allow) == 0 || trusts(n.allow, clientIP)
+}
+
+// networkACL rejects clients of unexpected networks before anything else is done with their requests.
+type networkACL struct {
+	writes *networkRules
+	reads  *networkRules
+	logger hclog.Logger
+}
+
+// buildNetworkACL returns the ACL of the network_acl block, it is nil if the block is missing.
+func buildNetworkACL(c *config.Config, logger hclog.Logger) (*networkACL, error) {
+	if c.NetworkACL == nil {
+		return nil, nil
+	}
+	writes, err := buildNetworkRules(c.NetworkACL.Writes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network_acl writes: %w", err)
+	}
+	reads, err := buildNetworkRules(c.NetworkACL.Reads)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network_acl reads: %w", err)
+	}
+	return &networkACL{writes: writes, reads: reads, logger: logger}, nil
+}
+
+func buildNetworkRules(rules *config.NetworkRules) (*networkRules, error) {
+	if rules == nil {
+		return nil, nil
+	}
+	allow, err := parseCIDRs("allow", rules.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseCIDRs("deny", rules.Deny)
+	if err != nil {
+		return nil, err
+	}
+	return &networkRules{allow: allow, deny: deny}, nil
+}
+
+// reject answers the request with a 403 if the client is not permitted to send it.
+func (a *networkACL) reject(w http.ResponseWriter, r *http.Request, clientIP string) bool {
+	class, rules := "reads", a.reads
+	switch r.Method {
+	case http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete:
+		class, rules = "writes", a.writes
+	}
+	if rules.permits(clientIP) {
+		return false
+	}
+	metrics.NetworkACLRejections.WithLabelValues(class).Inc()
+	a.logger.Warn("Rejected request from unexpected network", "class", class, "clientIP", clientIP, "method", r.Method, "path", r.URL.Path)
+	http.Error(w, fmt.Sprintf("%s from %s are not allowed", class, clientIP), http.StatusForbidden)
+	return true
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkRules_Permits(t *testing.T) {
+	rules, err := buildNetworkRules(&config.NetworkRules{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.66.0.0/16"}})
+	require.NoError(t, err)
+	assert.True(t, rules.permits("10.1.2.3"))
+	assert.False(t, rules.permits("10.66.1.1"), "deny takes precedence")
+	assert.False(t, rules.permits("192.168.1.1"))
+
+	denyOnly, err := buildNetworkRules(&config.NetworkRules{Deny: []string{"192.168.0.0/16"}})
+	require.NoError(t, err)
+	assert.True(t, denyOnly.permits("10.1.2.3"))
+	assert.False(t, denyOnly.permits("192.168.1.1"))
+
+	var missing *networkRules
+	assert.True(t, missing.permits("192.168.1.1"))
+}
+
+func TestProxyRejectsUnexpectedNetworks(t *testing.T) {
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer nomad.Close()
+	nomadURL, _ := url.Parse(nomad.URL)
+
+	acl, err := buildNetworkACL(&config.Config{NetworkACL: &config.NetworkACL{
+		Writes: &config.NetworkRules{Allow: []string{"10.0.0.0/8"}},
+		Reads:  &config.NetworkRules{Deny: []string{"172.16.0.0/12"}},
+	}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	trusted, err := parseCIDRs("trusted_proxies", []string{"10.0.0.1"})
+	require.NoError(t, err)
+	// no rules, so a rejected request never reaches them
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomadURL, jobHandler, hclog.NewNullLogger(), nil, WithTrustedProxies(trusted), WithNetworkACL(acl))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		remoteAddr string
+		forwarded  string
+		wantStatus int
+	}{
+		{name: "allowed write", method: http.MethodPost, path: "/v1/job/web/scale", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK},
+		{name: "unexpected write", method: http.MethodPut, path: "/v1/jobs", remoteAddr: "192.168.1.1:1234", wantStatus: http.StatusForbidden},
+		{name: "unexpected write via trusted proxy", method: http.MethodDelete, path: "/v1/job/web", remoteAddr: "10.0.0.1:1234", forwarded: "192.168.1.1", wantStatus: http.StatusForbidden},
+		{name: "read", method: http.MethodGet, path: "/v1/jobs", remoteAddr: "192.168.1.1:1234", wantStatus: http.StatusOK},
+		{name: "denied read", method: http.MethodGet, path: "/v1/jobs", remoteAddr: "172.16.1.1:1234", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			rr := httptest.NewRecorder()
+			proxy(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestBuildNetworkACL(t *testing.T) {
+	acl, err := buildNetworkACL(&config.Config{}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Nil(t, acl)
+
+	_, err = buildNetworkACL(&config.Config{NetworkACL: &config.NetworkACL{
+		Writes: &config.NetworkRules{Deny: []string{"ci.example.com"}},
+	}}, hclog.NewNullLogger())
+	assert.EqualError(t, err, `invalid network_acl writes: invalid deny address "ci.example.com"`)
+}
+
+func TestNetworkACLRunsBeforeAuth(t *testing.T) {
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer nomad.Close()
+	nomadURL, _ := url.Parse(nomad.URL)
+
+	acl, err := buildNetworkACL(&config.Config{NetworkACL: &config.NetworkACL{
+		Reads: &config.NetworkRules{Deny: []string{"172.16.0.0/12"}},
+	}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	var authenticated []string
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomadURL, jobHandler, hclog.NewNullLogger(), nil, WithNetworkACL(acl),
+		WithMiddleware(middleware.StageAuth, "auth", recording("auth", &authenticated)))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/jobs", nil)
+	req.RemoteAddr = "172.16.1.1:1234"
+	rr := httptest.NewRecorder()
+	proxy(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Empty(t, authenticated, "denied clients never reach the auth stage, e.g. a token lookup")
+}
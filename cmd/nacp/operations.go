@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+)
+
+// jobLookup returns the registered job of the route and the namespace it lives in, the job is nil if it doesn't exist.
+type jobLookup func(rt route) (*api.Job, string, error)
+
+// handleJobOperation applies the validators of the operation, e.g. a stop, purge or allocation restart, to the registered job.
+// The job is looked up with the token of the request, jobs and allocations that don't exist are left to Nomad.
+func handleJobOperation(r *http.Request, rt route, appLogger hclog.Logger, jobHandler *admissionctrl.JobHandler, lookup jobLookup) (*http.Request, error) {
+	job, namespace, err := lookup(rt)
+	if err != nil {
+		return r, fmt.Errorf("failed to look up the job for the %s checks: %w", rt.Operation, err)
+	}
+	if job == nil {
+		return r, nil
+	}
+	job.Namespace = &namespace
+
+	payload := &types.Payload{Job: job}
+	if reqCtx, ok := r.Context().Value("request_context").(*config.RequestContext); ok {
+		reqCtx.Namespace = namespace
+		switch {
+		case rt.AllocID != "":
+			// allocations are looked up by ID, their namespace is the one of the job
+			reqCtx.NamespaceSource = config.NamespaceSourceJob
+		case rt.NamespaceFromHeader:
+			reqCtx.NamespaceSource = config.NamespaceSourceHeader
+		case rt.Namespace != "":
+			reqCtx.NamespaceSource = config.NamespaceSourceQuery
+		}
+		reqCtx.Purge = rt.Operation == config.OperationDeregister && r.URL.Query().Get("purge") == "true"
+		reqCtx.AllocID = rt.AllocID
+		payload.Context = reqCtx
+	}
+
+	warnings, err := jobHandler.AdmissionOperationContext(r.Context(), payload)
+	if err != nil {
+		return r, fmt.Errorf("admission controllers send an error, returning error: %w", err)
+	}
+	// the responses of these operations have no warnings, they are only logged
+	for _, warning := range warnings {
+		appLogger.Warn("Job operation warning", "operation", rt.Operation, "job", pointerValue(job.ID), "namespace", namespace, "warning", warning)
+	}
+	return r, nil
+}
+
+// lookupJob reads the job, or the allocation and its job, from Nomad with the token of the request,
+// so NACP can't reveal jobs the token can't read.
+func lookupJob(transport *http.Transport, nomadAddress *url.URL, token string, rt route) (*api.Job, string, error) {
+	namespace := firstNonEmpty(rt.Namespace, api.DefaultNamespace)
+	if rt.AllocID == "" {
+		job := &api.Job{}
+		found, err := getFromNomad(transport, nomadAddress, token, "/v1/job/"+rt.JobID, namespace, rt.Region, job)
+		if err != nil || !found {
+			return nil, "", err
+		}
+		return job, namespace, nil
+	}
+	alloc := &api.Allocation{}
+	found, err := getFromNomad(transport, nomadAddress, token, "/v1/allocation/"+rt.AllocID, rt.Namespace, rt.Region, alloc)
+	if err != nil || !found || alloc.Job == nil {
+		return nil, "", err
+	}
+	return alloc.Job, alloc.Namespace, nil
+}
+
+// getFromNomad decodes the response of a GET request into v, it reports false if Nomad doesn't know the object.
+func getFromNomad(transport *http.Transport, nomadAddress *url.URL, token, path, namespace, region string, v interface{}) (bool, error) {
+	client := http.DefaultClient
+	if transport != nil {
+		client = &http.Client{Transport: transport}
+	}
+
+	getURL := *nomadAddress
+	getURL.Path = path
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("namespace", namespace)
+	}
+	if region != "" {
+		query.Set("region", region)
+	}
+	getURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, getURL.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	if token != "" {
+		req.Header.Set("X-Nomad-Token", token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status code: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyChecksDeregister(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		header         http.Header
+		wantStatus     int
+		wantDeregister bool
+	}{
+		{name: "stop", target: "/v1/job/traefik?namespace=system", wantStatus: http.StatusOK, wantDeregister: true},
+		{name: "purge", target: "/v1/job/traefik?namespace=system&purge=true", wantStatus: http.StatusInternalServerError},
+		{
+			name:           "purge with approval",
+			target:         "/v1/job/traefik?namespace=system&purge=true",
+			header:         http.Header{"X-Change-Approval": {"CHG-42"}},
+			wantStatus:     http.StatusOK,
+			wantDeregister: true,
+		},
+		{name: "unprotected job", target: "/v1/job/traefik?purge=true", wantStatus: http.StatusOK, wantDeregister: true},
+		{name: "unknown job", target: "/v1/job/missing?namespace=system&purge=true", wantStatus: http.StatusOK, wantDeregister: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deregistered := false
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v1/job/traefik":
+					id, namespace := "traefik", r.URL.Query().Get("namespace")
+					json.NewEncoder(w).Encode(&api.Job{ID: &id, Namespace: &namespace})
+				case r.Method == http.MethodGet:
+					http.NotFound(w, r)
+				case r.Method == http.MethodDelete:
+					deregistered = true
+					w.Write([]byte(`{"EvalID":"eval"}`))
+				}
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			s, err := selector.New(&config.Selector{Namespaces: []string{"system"}})
+			require.NoError(t, err)
+			critical := validator.NewDeregisterValidator(hclog.NewNullLogger(), "critical", s, validator.DeregisterPolicy{AllowStop: true, ApprovalHeader: "X-Change-Approval"})
+			jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{critical}, hclog.NewNullLogger(), false)
+			proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithContextHeaders([]string{"X-Change-Approval"}))
+
+			req := httptest.NewRequest(http.MethodDelete, tt.target, nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rr := httptest.NewRecorder()
+			proxy(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantDeregister, deregistered)
+		})
+	}
+}
+
+func TestProxySkipsJobLookupWithoutOperationValidators(t *testing.T) {
+	var methods []string
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Write([]byte(`{"EvalID":"eval"}`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+	rr := httptest.NewRecorder()
+	proxy(rr, httptest.NewRequest(http.MethodDelete, "/v1/job/traefik", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{http.MethodDelete}, methods)
+}
+
+func TestProxyChecksDisruptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		wantStatus  int
+		wantForward bool
+	}{
+		{name: "alloc restart", method: http.MethodPut, target: "/v1/client/allocation/5456bd7a/restart", wantStatus: http.StatusInternalServerError},
+		{name: "alloc of other namespace", method: http.MethodPut, target: "/v1/client/allocation/2b2c3e1d/restart", wantStatus: http.StatusOK, wantForward: true},
+		{name: "force evaluation", method: http.MethodPost, target: "/v1/job/web/evaluate?namespace=prod", wantStatus: http.StatusInternalServerError},
+		{name: "not restricted alloc stop", method: http.MethodPost, target: "/v1/allocation/5456bd7a/stop", wantStatus: http.StatusOK, wantForward: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded := false
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id, prod, dev := "web", "prod", "dev"
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v1/allocation/5456bd7a":
+					json.NewEncoder(w).Encode(&api.Allocation{ID: "5456bd7a", Namespace: prod, Job: &api.Job{ID: &id, Namespace: &prod}})
+				case r.Method == http.MethodGet && r.URL.Path == "/v1/allocation/2b2c3e1d":
+					json.NewEncoder(w).Encode(&api.Allocation{ID: "2b2c3e1d", Namespace: dev, Job: &api.Job{ID: &id, Namespace: &dev}})
+				case r.Method == http.MethodGet && r.URL.Path == "/v1/job/web":
+					json.NewEncoder(w).Encode(&api.Job{ID: &id, Namespace: &prod})
+				case r.Method == http.MethodGet:
+					http.NotFound(w, r)
+				default:
+					forwarded = true
+					w.Write([]byte(`{}`))
+				}
+			}))
+			defer nomadDummy.Close()
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+
+			s, err := selector.New(&config.Selector{Namespaces: []string{"prod"}})
+			require.NoError(t, err)
+			restarts, err := validator.NewDisruptionValidator(hclog.NewNullLogger(), "restarts", s, validator.DisruptionPolicy{
+				Operations: []string{config.OperationAllocRestart, config.OperationEvaluate},
+				Forbid:     true,
+			})
+			require.NoError(t, err)
+			jobHandler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{restarts}, hclog.NewNullLogger(), false)
+			proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil)
+
+			rr := httptest.NewRecorder()
+			proxy(rr, httptest.NewRequest(tt.method, tt.target, nil))
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantForward, forwarded)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/metrics"
+)
+
+// defaultMaxResponseSize bounds the upstream responses NACP buffers to add its warnings.
+const defaultMaxResponseSize = 16 << 20
+
+// patchResponse lets patch change the top level fields of a JSON response without decoding the nested objects,
+// e.g. the diff of a plan. Responses larger than maxSize are passed through unchanged, so huge plans don't cause memory spikes.
+func patchResponse(resp *http.Response, maxSize int64, appLogger hclog.Logger, patch func(fields map[string]json.RawMessage) error) error {
+	if resp.ContentLength > maxSize {
+		skipPatch(resp, appLogger)
+		return nil
+	}
+	isGzip, reader, err := checkIfGzipAndTransformReader(resp, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	buf := getBuffer()
+	n, err := buf.ReadFrom(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		putBuffer(buf)
+		reader.Close()
+		return err
+	}
+	if n > maxSize {
+		// hand out what was read followed by the rest of the body, decompressed as the gzip stream was already consumed
+		resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(buf.Bytes()), reader), buf: buf, body: reader}
+		if isGzip {
+			resp.Header.Del("Content-Encoding")
+			resp.Header.Del("Content-Length")
+			resp.ContentLength = -1
+		}
+		skipPatch(resp, appLogger)
+		return nil
+	}
+	reader.Close()
+
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(buf.Bytes(), &fields)
+	putBuffer(buf)
+	if err != nil {
+		return err
+	}
+	if err := patch(fields); err != nil {
+		return err
+	}
+	return rewriteResponse(resp, fields, isGzip)
+}
+
+func skipPatch(resp *http.Response, appLogger hclog.Logger) {
+	metrics.OversizedResponses.Inc()
+	appLogger.Warn("Response is too large, passing it through without NACP's warnings", "path", resp.Request.URL.Path, "content_length", resp.ContentLength)
+}
+
+// prefixedBody serves the already buffered start of a body followed by its rest.
+type prefixedBody struct {
+	io.Reader
+	buf  *bytes.Buffer
+	body io.Closer
+}
+
+func (b *prefixedBody) Close() error {
+	if b.buf != nil {
+		putBuffer(b.buf)
+		b.buf = nil
+	}
+	return b.body.Close()
+}
+
+// patchWarnings merges the warnings into the Warnings field of a register, plan or validate response.
+func patchWarnings(fields map[string]json.RawMessage, warnings []error) error {
+	var upstream string
+	if raw, ok := fields["Warnings"]; ok {
+		if err := json.Unmarshal(raw, &upstream); err != nil {
+			return err
+		}
+	}
+	encoded, err := json.Marshal(buildFullWarningMsg(upstream, warnings))
+	if err != nil {
+		return err
+	}
+	fields["Warnings"] = encoded
+	return nil
+}
+
+// patchResults adds the warnings as structured results to a register or plan response, like the NACPResults of the validate response.
+func patchResults(fields map[string]json.RawMessage, warnings []error) error {
+	encoded, err := json.Marshal(types.ResultsOf(warnings))
+	if err != nil {
+		return err
+	}
+	fields["NACPResults"] = encoded
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchResponse(t *testing.T) {
+	body := `{"EvalID":"eval-1","Warnings":"upstream warning"}`
+	tt := []struct {
+		name         string
+		isGzip       bool
+		maxSize      int64
+		unknownSize  bool
+		wantBody     string
+		wantWarnings string
+	}{
+		{name: "patched", maxSize: 1024, wantWarnings: "2 warnings:\n\n* upstream warning\n* [warning] count is high"},
+		{name: "patched gzip", isGzip: true, maxSize: 1024, wantWarnings: "2 warnings:\n\n* upstream warning\n* [warning] count is high"},
+		{name: "oversized by content length", maxSize: 10, wantBody: body},
+		{name: "oversized while reading", maxSize: 10, unknownSize: true, wantBody: body},
+		{name: "oversized gzip while reading", isGzip: true, maxSize: 10, unknownSize: true, wantBody: body},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := []byte(body)
+			if tc.isGzip {
+				var gzipped bytes.Buffer
+				gz := gzip.NewWriter(&gzipped)
+				_, err := gz.Write(payload)
+				require.NoError(t, err)
+				require.NoError(t, gz.Close())
+				payload = gzipped.Bytes()
+			}
+			resp := &http.Response{
+				Header:        http.Header{},
+				Body:          io.NopCloser(bytes.NewReader(payload)),
+				ContentLength: int64(len(payload)),
+				Request:       httptest.NewRequest(http.MethodPost, "/v1/jobs", nil),
+			}
+			resp.Header.Set("Content-Length", strconv.Itoa(len(payload)))
+			if tc.isGzip {
+				resp.Header.Set("Content-Encoding", "gzip")
+			}
+			if tc.unknownSize {
+				resp.ContentLength = -1
+				resp.Header.Del("Content-Length")
+			}
+
+			err := patchResponse(resp, tc.maxSize, hclog.NewNullLogger(), func(fields map[string]json.RawMessage) error {
+				return patchWarnings(fields, []error{fmt.Errorf("count is high")})
+			})
+			require.NoError(t, err)
+
+			reader := resp.Body
+			if resp.Header.Get("Content-Encoding") == "gzip" {
+				reader, err = gzip.NewReader(resp.Body)
+				require.NoError(t, err)
+			}
+			got, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, string(got))
+				if tc.isGzip && tc.unknownSize {
+					assert.Empty(t, resp.Header.Get("Content-Encoding"))
+					assert.Equal(t, int64(-1), resp.ContentLength)
+				}
+				return
+			}
+			assert.Equal(t, strconv.FormatInt(resp.ContentLength, 10), resp.Header.Get("Content-Length"))
+			fields := map[string]string{}
+			require.NoError(t, json.Unmarshal(got, &fields))
+			assert.Equal(t, "eval-1", fields["EvalID"])
+			assert.Equal(t, tc.wantWarnings, fields["Warnings"])
+		})
+	}
+}
+
+func TestPatchWarnings(t *testing.T) {
+	fields := map[string]json.RawMessage{"Warnings": json.RawMessage("null")}
+	require.NoError(t, patchWarnings(fields, []error{fmt.Errorf("count is high")}))
+	assert.True(t, strings.Contains(string(fields["Warnings"]), "[warning] count is high"))
+}
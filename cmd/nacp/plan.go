@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// planDiffObject is the name of the object listing NACP's findings in the plan diff.
+const planDiffObject = "NACP"
+
+// annotatePlanDiff adds the warnings of the rules as an object to the job diff of a plan response,
+// so `nomad plan` shows them inline with the changes they refer to.
+// The diff is only present if the client requested it, only the diff's objects are decoded.
+func annotatePlanDiff(fields map[string]json.RawMessage, warnings []error) error {
+	raw, ok := fields["Diff"]
+	if !ok || len(warnings) == 0 || string(raw) == "null" {
+		return nil
+	}
+	diff := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &diff); err != nil {
+		return err
+	}
+	var objects []json.RawMessage
+	if rawObjects, ok := diff["Objects"]; ok {
+		if err := json.Unmarshal(rawObjects, &objects); err != nil {
+			return err
+		}
+	}
+	findings, err := json.Marshal(planFindings(warnings))
+	if err != nil {
+		return err
+	}
+	if diff["Objects"], err = json.Marshal(append(objects, findings)); err != nil {
+		return err
+	}
+	fields["Diff"], err = json.Marshal(diff)
+	return err
+}
+
+// planFindings lists the warnings by severity as diff object.
+func planFindings(warnings []error) *api.ObjectDiff {
+	findings := &api.ObjectDiff{
+		Type: "None",
+		Name: planDiffObject,
+	}
+	for _, w := range warnings {
+		name := "Warning"
+		if types.SeverityOf(w) == types.SeverityInfo {
+			name = "Info"
+		}
+		findings.Fields = append(findings.Fields, &api.FieldDiff{
+			Type: "None",
+			Name: name,
+			New:  w.Error(),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotatePlanDiff(t *testing.T) {
+	tt := []struct {
+		name     string
+		diff     *api.JobDiff
+		warnings []error
+		want     *api.JobDiff
+	}{
+		{
+			name:     "no diff requested",
+			warnings: []error{fmt.Errorf("count is high")},
+		},
+		{
+			name: "no warnings",
+			diff: &api.JobDiff{Type: "Edited", ID: "example"},
+			want: &api.JobDiff{Type: "Edited", ID: "example"},
+		},
+		{
+			name: "warnings are added as object",
+			diff: &api.JobDiff{
+				Type:    "Edited",
+				ID:      "example",
+				Objects: []*api.ObjectDiff{{Type: "Added", Name: "Meta"}},
+			},
+			warnings: []error{fmt.Errorf("count is high"), types.WithSeverity(fmt.Errorf("consider a canary"), types.SeverityInfo)},
+			want: &api.JobDiff{
+				Type: "Edited",
+				ID:   "example",
+				Objects: []*api.ObjectDiff{
+					{Type: "Added", Name: "Meta"},
+					{
+						Type: "None",
+						Name: "NACP",
+						Fields: []*api.FieldDiff{
+							{Type: "None", Name: "Warning", New: "count is high"},
+							{Type: "None", Name: "Info", New: "consider a canary"},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := map[string]json.RawMessage{}
+			if tc.diff != nil {
+				fields["Diff"], _ = json.Marshal(tc.diff)
+			}
+			require.NoError(t, annotatePlanDiff(fields, tc.warnings))
+
+			var got *api.JobDiff
+			if raw, ok := fields["Diff"]; ok {
+				require.NoError(t, json.Unmarshal(raw, &got))
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
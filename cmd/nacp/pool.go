@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxPooledBufferSize keeps single huge jobs from pinning memory in the pool.
+const maxPooledBufferSize = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+var gzipReaderPool sync.Pool
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// pooledBody is a request or response body backed by a pooled buffer, the buffer goes back to the pool on Close.
+// The transport may close a request body while it is still being read, so access is synchronized.
+type pooledBody struct {
+	mu  sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf == nil {
+		return 0, io.EOF
+	}
+	return b.buf.Read(p)
+}
+
+func (b *pooledBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf != nil {
+		putBuffer(b.buf)
+		b.buf = nil
+	}
+	return nil
+}
+
+// String returns the unread content, it is used for debug logging.
+func (b *pooledBody) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf == nil {
+		return ""
+	}
+	return b.buf.String()
+}
+
+// encodeJson encodes v into a pooled buffer.
+func encodeJson(v interface{}) (*bytes.Buffer, error) {
+	buf := getBuffer()
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// rewriteRequest replaces the request body with v encoded as JSON.
+func rewriteRequest(r *http.Request, v interface{}) (*pooledBody, error) {
+	buf, err := encodeJson(v)
+	if err != nil {
+		return nil, err
+	}
+	body := &pooledBody{buf: buf}
+	r.ContentLength = int64(buf.Len())
+	r.Body = body
+	return body, nil
+}
+
+// rewriteResponse replaces the response body with v encoded as JSON, compressed if the upstream response was.
+func rewriteResponse(resp *http.Response, v interface{}, isGzip bool) error {
+	buf, err := encodeJson(v)
+	if err != nil {
+		return err
+	}
+	if isGzip {
+		compressed := getBuffer()
+		gz := gzipWriterPool.Get().(*gzip.Writer)
+		gz.Reset(compressed)
+		_, err = gz.Write(buf.Bytes())
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+		gzipWriterPool.Put(gz)
+		putBuffer(buf)
+		if err != nil {
+			putBuffer(compressed)
+			return err
+		}
+		buf = compressed
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(buf.Len()))
+	resp.ContentLength = int64(buf.Len())
+	resp.Body = &pooledBody{buf: buf}
+	return nil
+}
+
+// pooledGzipReader decompresses an upstream response body, Close closes the body and returns the reader to the pool.
+type pooledGzipReader struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func newPooledGzipReader(body io.ReadCloser) (*pooledGzipReader, error) {
+	gz, ok := gzipReaderPool.Get().(*gzip.Reader)
+	var err error
+	if ok {
+		err = gz.Reset(body)
+	} else {
+		gz, err = gzip.NewReader(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pooledGzipReader{Reader: gz, body: body}, nil
+}
+
+func (r *pooledGzipReader) Close() error {
+	if r.Reader == nil {
+		return nil
+	}
+	err := r.Reader.Close()
+	gzipReaderPool.Put(r.Reader)
+	r.Reader = nil
+	if bodyErr := r.body.Close(); err == nil {
+		err = bodyErr
+	}
+	return err
+}
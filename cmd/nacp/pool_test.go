@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPooledBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/v1/jobs", nil)
+	job := &api.JobRegisterRequest{Job: &api.Job{ID: helperString("my-job")}}
+
+	body, err := rewriteRequest(req, job)
+	require.NoError(t, err)
+	assert.Contains(t, body.String(), `"ID":"my-job"`)
+	assert.Equal(t, int64(len(body.String())), req.ContentLength)
+
+	got := &api.JobRegisterRequest{}
+	require.NoError(t, json.NewDecoder(req.Body).Decode(got))
+	assert.Equal(t, "my-job", *got.Job.ID)
+
+	require.NoError(t, req.Body.Close())
+	require.NoError(t, req.Body.Close(), "close is idempotent")
+	n, err := req.Body.Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Empty(t, body.String())
+}
+
+func TestRewriteResponse(t *testing.T) {
+	tt := []struct {
+		name   string
+		isGzip bool
+	}{
+		{name: "plain", isGzip: false},
+		{name: "gzip", isGzip: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			want := &api.JobRegisterResponse{Warnings: "some warning"}
+
+			require.NoError(t, rewriteResponse(resp, want, tc.isGzip))
+
+			var reader io.Reader = resp.Body
+			if tc.isGzip {
+				gz, err := gzip.NewReader(resp.Body)
+				require.NoError(t, err)
+				reader = gz
+			}
+			got := &api.JobRegisterResponse{}
+			require.NoError(t, json.NewDecoder(reader).Decode(got))
+			assert.Equal(t, want.Warnings, got.Warnings)
+			assert.Equal(t, fmt.Sprint(resp.ContentLength), resp.Header.Get("Content-Length"))
+			require.NoError(t, resp.Body.Close())
+		})
+	}
+}
+
+// warningValidator always warns so the benchmark covers the response rewrite.
+type warningValidator struct{}
+
+func (warningValidator) Name() string {
+	return "warning"
+}
+
+func (warningValidator) Validate(_ *types.Payload) ([]error, error) {
+	return []error{errors.New("some warning")}, nil
+}
+
+func TestPooledGzipReaderClosesBody(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte("hello"))
+	require.NoError(t, gz.Close())
+
+	for i := 0; i < 2; i++ {
+		body := &closeRecorder{Reader: bytes.NewReader(gzipped.Bytes())}
+		reader, err := newPooledGzipReader(body)
+		require.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+		require.NoError(t, reader.Close())
+		require.NoError(t, reader.Close(), "close is idempotent")
+		assert.Equal(t, 1, body.closed)
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed++
+	return nil
+}
+
+func helperString(s string) *string {
+	return &s
+}
+
+func BenchmarkProxyRegister(b *testing.B) {
+	tt := []struct {
+		name   string
+		isGzip bool
+	}{
+		{name: "plain", isGzip: false},
+		{name: "gzip", isGzip: true},
+	}
+	for _, tc := range tt {
+		b.Run(tc.name, func(b *testing.B) {
+			resp := []byte(`{"EvalID":"eval","Warnings":""}`)
+			var gzipped bytes.Buffer
+			gz := gzip.NewWriter(&gzipped)
+			_, _ = gz.Write(resp)
+			require.NoError(b, gz.Close())
+
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				_, _ = io.Copy(io.Discard, req.Body)
+				if tc.isGzip {
+					rw.Header().Set("Content-Encoding", "gzip")
+					_, _ = rw.Write(gzipped.Bytes())
+					return
+				}
+				_, _ = rw.Write(resp)
+			}))
+			defer nomadDummy.Close()
+
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(b, err)
+			jobHandler := admissionctrl.NewJobHandler(
+				[]admissionctrl.JobMutator{},
+				[]admissionctrl.JobValidator{warningValidator{}},
+				hclog.NewNullLogger(),
+				false,
+			)
+			transport := &http.Transport{DisableCompression: true}
+			proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), transport)
+			proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+			defer proxyServer.Close()
+
+			jobJson, err := os.ReadFile("../../testdata/job.json")
+			require.NoError(b, err)
+			job := &api.Job{}
+			require.NoError(b, json.Unmarshal(jobJson, job))
+			data, err := json.Marshal(&api.JobRegisterRequest{Job: job})
+			require.NoError(b, err)
+			client := proxyServer.Client()
+			url := proxyServer.URL + "/v1/jobs"
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(string(data)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if tc.isGzip {
+					req.Header.Set("Accept-Encoding", "gzip")
+				}
+				res, err := client.Do(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, _ = io.Copy(io.Discard, res.Body)
+				_ = res.Body.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/pkg/middleware"
+)
+
+// admissionQueueMiddleware limits the concurrent admissions, other requests are passed through directly.
+func admissionQueueMiddleware(queue *admissionctrl.AdmissionQueue, appLogger hclog.Logger) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !(isRegister(r) || isPlan(r) || isValidate(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			release, err := queue.Acquire(r.Context())
+			if err != nil {
+				if errors.Is(err, admissionctrl.ErrQueueFull) {
+					appLogger.Warn("Rejecting request, admission queue is full", "path", r.URL.Path)
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusTooManyRequests)
+					w.Write([]byte("admission queue is full, retry later"))
+				}
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
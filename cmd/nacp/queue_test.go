@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmissionQueueMiddleware(t *testing.T) {
+	queue := admissionctrl.NewAdmissionQueue(1, 0)
+	release, err := queue.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	called := false
+	handler := admissionQueueMiddleware(queue, hclog.NewNullLogger())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("PUT", "/v1/jobs", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.False(t, called)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/jobs", nil))
+	assert.True(t, called, "reads are not queued")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+)
+
+// WithPreservedUnknownFields applies the changes of NACP to the submitted job requests as JSON patches instead of
+// re-encoding them, so fields the Nomad API client doesn't know reach Nomad, e.g. those of a newer Nomad version.
+func WithPreservedUnknownFields() ProxyOption {
+	return func(o *proxyOptions) {
+		o.preserveUnknownFields = true
+	}
+}
+
+// rawRequest is a job request as it was submitted.
+type rawRequest struct {
+	body []byte
+	// decoded is the request as the API client decoded it, admitted as it was passed to the rules
+	decoded  []byte
+	admitted []byte
+	patches  *admissionctrl.PatchLog
+}
+
+// decodeJobRequest decodes the body into v, if preserve is set the submitted body is kept.
+func decodeJobRequest(r *http.Request, v interface{}, preserve bool) (*rawRequest, error) {
+	if !preserve {
+		return nil, json.NewDecoder(r.Body).Decode(v)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, err
+	}
+	decoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &rawRequest{body: body, decoded: decoded}, nil
+}
+
+// admit remembers the request as it is passed to the rules and returns the context recording the patches of the mutators.
+// Changes made before, e.g. the namespace of a scoped route, are diffed.
+func (raw *rawRequest) admit(ctx context.Context, v interface{}) (context.Context, error) {
+	if raw == nil {
+		return ctx, nil
+	}
+	admitted, err := json.Marshal(v)
+	if err != nil {
+		return ctx, err
+	}
+	raw.admitted = admitted
+	ctx, raw.patches = admissionctrl.WithPatchLog(ctx)
+	return ctx, nil
+}
+
+// patched applies the changes to the submitted body. It fails if the result doesn't decode to v, the admitted request,
+// e.g. because a patch path doesn't exist in the submitted JSON.
+func (raw *rawRequest) patched(v interface{}) ([]byte, error) {
+	if raw.admitted == nil {
+		return nil, errors.New("the request was not admitted")
+	}
+	patch, err := admissionctrl.DiffPatch(raw.decoded, raw.admitted)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := patch.Apply(raw.body)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range raw.patches.Patches {
+		p, err = prefixPatch(p, "/Job")
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = p.Apply(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	check := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+	if err := json.Unmarshal(doc, check); err != nil {
+		return nil, err
+	}
+	got, err := json.Marshal(check)
+	if err != nil {
+		return nil, err
+	}
+	want, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(got, want) {
+		return nil, errors.New("the patched request differs from the admitted one")
+	}
+	return doc, nil
+}
+
+// prefixPatch moves the paths of the patch below the prefix, e.g. from the job to the job of a request.
+func prefixPatch(patch jsonpatch.Patch, prefix string) (jsonpatch.Patch, error) {
+	prefixed := make(jsonpatch.Patch, len(patch))
+	for i, op := range patch {
+		prefixed[i] = jsonpatch.Operation{}
+		for key, value := range op {
+			if (key == "path" || key == "from") && value != nil {
+				var path string
+				if err := json.Unmarshal(*value, &path); err != nil {
+					return nil, err
+				}
+				data, err := json.Marshal(prefix + path)
+				if err != nil {
+					return nil, err
+				}
+				raw := json.RawMessage(data)
+				value = &raw
+			}
+			prefixed[i][key] = value
+		}
+	}
+	return prefixed, nil
+}
+
+// rewriteJobRequest replaces the body with the admitted request v, the patched submitted body if it was kept.
+func rewriteJobRequest(r *http.Request, v interface{}, raw *rawRequest, logger hclog.Logger) (*pooledBody, error) {
+	if raw != nil {
+		doc, err := raw.patched(v)
+		if err == nil {
+			return rewriteRequest(r, json.RawMessage(doc))
+		}
+		logger.Warn("failed to apply the changes to the submitted request, sending it re-encoded", "error", err)
+	}
+	return rewriteRequest(r, v)
+}
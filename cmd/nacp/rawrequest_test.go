@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyPreservesUnknownFields(t *testing.T) {
+	tt := []struct {
+		name     string
+		options  []ProxyOption
+		preserve bool
+	}{
+		{name: "re-encoded"},
+		{name: "preserved", options: []ProxyOption{WithPreservedUnknownFields()}, preserve: true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var forwarded map[string]interface{}
+			nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				_ = json.NewDecoder(req.Body).Decode(&forwarded)
+				_, _ = rw.Write([]byte(`{}`))
+			}))
+			defer nomadDummy.Close()
+
+			mutated := testutil.ReadJob(t, "job.json")
+			mutated.Meta = map[string]string{"mutated": "true"}
+			mutator := new(testutil.MockMutator)
+			mutator.On("Mutate", mock.Anything).Return(mutated, []error{}, nil)
+
+			nomad, err := url.Parse(nomadDummy.URL)
+			require.NoError(t, err)
+			jobHandler := admissionctrl.NewJobHandler([]admissionctrl.JobMutator{mutator}, nil, hclog.NewNullLogger(), false)
+			proxyServer := httptest.NewServer(http.HandlerFunc(NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, tc.options...)))
+			defer proxyServer.Close()
+
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(toJson(t, &api.JobRegisterRequest{Job: testutil.ReadJob(t, "job.json")})), &body))
+			body["Job"].(map[string]interface{})["FutureField"] = "kept"
+
+			res, err := http.Post(proxyServer.URL+"/v1/jobs", "application/json", strings.NewReader(toJson(t, body)))
+			require.NoError(t, err)
+			_, _ = io.Copy(io.Discard, res.Body)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+
+			require.NotNil(t, forwarded)
+			job := forwarded["Job"].(map[string]interface{})
+			assert.Equal(t, map[string]interface{}{"mutated": "true"}, job["Meta"])
+			if tc.preserve {
+				assert.Equal(t, "kept", job["FutureField"])
+			} else {
+				assert.NotContains(t, job, "FutureField")
+			}
+		})
+	}
+}
+
+func TestRawRequestPatched(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v1/jobs", strings.NewReader(`{"Job": {"ID": "job", "FutureField": 1}}`))
+	register := &api.JobRegisterRequest{}
+	raw, err := decodeJobRequest(req, register, true)
+	require.NoError(t, err)
+
+	// changed before the rules, e.g. by a scoped route
+	register.Job.Namespace = helperString("billing")
+	_, err = raw.admit(req.Context(), register)
+	require.NoError(t, err)
+
+	doc, err := raw.patched(register)
+	require.NoError(t, err)
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(doc, &got))
+	assert.Equal(t, "billing", got["Job"].(map[string]interface{})["Namespace"])
+	assert.Equal(t, float64(1), got["Job"].(map[string]interface{})["FutureField"])
+
+	// a change the patches don't describe is detected
+	register.Job.Name = helperString("other")
+	_, err = raw.patched(register)
+	assert.EqualError(t, err, "the patched request differs from the admitted one")
+}
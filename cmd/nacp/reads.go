@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/pkg/middleware"
+)
+
+// WithReadAuthorizer applies the read rules to GET requests, rejected reads are answered with 403.
+func WithReadAuthorizer(reads *admissionctrl.ReadAuthorizer) ProxyOption {
+	return func(o *proxyOptions) {
+		o.reads = reads
+	}
+}
+
+// readNamespace returns the namespace Nomad reads from and where it comes from. Nomad only reads the namespace
+// of the query, so like for writes one of the X-Nomad-Namespace header is copied into the query, the rules check
+// the namespace Nomad serves. Without either Nomad reads the default namespace.
+func readNamespace(r *http.Request) (string, string) {
+	query := r.URL.Query()
+	if namespace := query.Get("namespace"); namespace != "" {
+		return namespace, config.NamespaceSourceQuery
+	}
+	if namespace := r.Header.Get(namespaceHeader); namespace != "" {
+		query.Set("namespace", namespace)
+		r.URL.RawQuery = query.Encode()
+		return namespace, config.NamespaceSourceHeader
+	}
+	return api.DefaultNamespace, ""
+}
+
+// readAuthorizationMiddleware applies the read rules to the reads the request context was built for.
+func readAuthorizationMiddleware(appLogger hclog.Logger, options *proxyOptions) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			group := apiGroupOf(r)
+			reqCtx, ok := r.Context().Value("request_context").(*config.RequestContext)
+			if !ok || reqCtx.Operation != config.OperationRead || !options.apis.handles(group) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			authorize := func(r *http.Request) (*http.Request, error) {
+				return r, options.reads.Authorize(r.Context(), r, reqCtx)
+			}
+			var err error
+			if options.apis.audits(group) {
+				r, err = auditedAdmission(r, group, options.apis, authorize)
+			} else {
+				r, err = authorize(r)
+			}
+			if err != nil {
+				appLogger.Warn("Read rules rejected request", "path", r.URL.Path, "clientIP", reqCtx.ClientIP, "error", err)
+				writeError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
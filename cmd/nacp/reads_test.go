@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyReadAuthorization(t *testing.T) {
+	upstreamCalled := false
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstreamCalled = true
+		_, _ = rw.Write([]byte(`[]`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	rule, err := validator.NewOpaValidator("namespaces", testutil.Filepath(t, "opa/validators/reads.rego"), "errors = data.reads.errors", hclog.NewNullLogger(), nil)
+	require.NoError(t, err)
+	reads := admissionctrl.NewReadAuthorizer(hclog.NewNullLogger(), &admissionctrl.ReadRule{Validator: rule, Paths: []string{"/v1/jobs", "/v1/allocations"}})
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	disabled := false
+
+	tests := []struct {
+		name       string
+		path       string
+		namespace  string
+		apis       *config.APIs
+		wantStatus int
+	}{
+		{name: "default namespace", path: "/v1/jobs", wantStatus: http.StatusOK},
+		{name: "other namespace", path: "/v1/jobs?namespace=payments", wantStatus: http.StatusForbidden},
+		{name: "other namespace by header", path: "/v1/allocations", namespace: "payments", wantStatus: http.StatusForbidden},
+		{name: "path without read rule", path: "/v1/nodes?namespace=payments", wantStatus: http.StatusOK},
+		{name: "jobs disabled", path: "/v1/jobs?namespace=payments", apis: &config.APIs{Jobs: &config.APIGroup{Enabled: &disabled}}, wantStatus: http.StatusOK},
+		{name: "jobs audited", path: "/v1/jobs?namespace=payments", apis: &config.APIs{Jobs: &config.APIGroup{Enforcement: "audit"}}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamCalled = false
+			opts := []ProxyOption{WithReadAuthorizer(reads)}
+			if tt.apis != nil {
+				opts = append(opts, WithAPIs(buildAPIPolicy(&config.Config{APIs: tt.apis}, hclog.NewNullLogger())))
+			}
+			proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, opts...)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.namespace != "" {
+				req.Header.Set("X-Nomad-Namespace", tt.namespace)
+			}
+			rr := httptest.NewRecorder()
+			proxy(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantStatus == http.StatusOK, upstreamCalled)
+			if tt.wantStatus == http.StatusForbidden {
+				assert.Equal(t, "forbidden", rr.Header().Get(headerErrorCode))
+				assert.Equal(t, "namespaces", rr.Header().Get(headerRule))
+				assert.Contains(t, rr.Body.String(), "reading namespace payments requires the ops policy")
+			}
+		})
+	}
+}
+
+// namespaceRule only allows reads of one namespace.
+type namespaceRule struct {
+	allowed string
+}
+
+func (n namespaceRule) Name() string {
+	return "namespace"
+}
+
+func (n namespaceRule) Validate(payload *types.Payload) ([]error, error) {
+	if payload.Context.Namespace != n.allowed {
+		return nil, fmt.Errorf("namespace %s is not allowed", payload.Context.Namespace)
+	}
+	return nil, nil
+}
+
+func TestProxyReadNamespaceFromHeader(t *testing.T) {
+	var upstreamNamespace string
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstreamNamespace = req.URL.Query().Get("namespace")
+		_, _ = rw.Write([]byte(`[]`))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	reads := admissionctrl.NewReadAuthorizer(hclog.NewNullLogger(), &admissionctrl.ReadRule{Validator: namespaceRule{allowed: "payments"}})
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithReadAuthorizer(reads))
+
+	tests := []struct {
+		name          string
+		path          string
+		header        string
+		wantStatus    int
+		wantNamespace string
+	}{
+		{name: "header is forwarded", path: "/v1/jobs", header: "payments", wantStatus: http.StatusOK, wantNamespace: "payments"},
+		{name: "query wins over header", path: "/v1/jobs?namespace=default", header: "payments", wantStatus: http.StatusForbidden},
+		{name: "default namespace", path: "/v1/jobs", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamNamespace = ""
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Nomad-Namespace", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			proxy(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantNamespace, upstreamNamespace, "nomad serves the namespace the rules checked")
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/discovery"
+	"github.com/mxab/nacp/pkg/admission"
+)
+
+// consulService returns the service NACP registers as, nil if it does not register itself.
+func consulService(c *config.Config) *config.ConsulService {
+	if c.ConsulService != nil {
+		return c.ConsulService
+	}
+	if c.Sidecar != nil && c.Sidecar.Register {
+		return config.DefaultConsulService()
+	}
+	return nil
+}
+
+// runRegistration keeps NACP registered in the local Consul agent until the context is done.
+// The port is the one actually listened on, it can differ from the configured one, e.g. with socket activation.
+// The returned channel is closed after deregistration, it is nil if NACP does not register itself.
+func runRegistration(ctx context.Context, c *config.Config, port int, logger hclog.Logger) (<-chan struct{}, error) {
+	service := consulService(c)
+	if service == nil {
+		return nil, nil
+	}
+	client, err := admission.ConsulClient(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consul client: %w", err)
+	}
+	registration := discovery.NewRegistration(client.Agent(), serviceRegistration(c, service, port), logger)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		registration.Run(ctx)
+	}()
+	return done, nil
+}
+
+func serviceRegistration(c *config.Config, service *config.ConsulService, port int) *consulapi.AgentServiceRegistration {
+	host := c.Bind
+	address := host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		// consul uses the agent's address for the service, the local agent reaches us on loopback
+		host = "127.0.0.1"
+		address = ""
+	}
+	if service.Address != "" {
+		address = service.Address
+	}
+	hostPort := net.JoinHostPort(host, strconv.Itoa(port))
+
+	check := &consulapi.AgentServiceCheck{
+		Name:     "NACP health",
+		Interval: service.CheckInterval,
+		Timeout:  "5s",
+		// cleans up after crashed instances
+		DeregisterCriticalServiceAfter: "1m",
+	}
+	switch {
+	case c.Tls != nil && c.Tls.CaFile != "" && !c.Tls.NoClientCert:
+		// consul can't present a client certificate in http checks
+		check.TCP = hostPort
+	case c.Tls != nil:
+		check.HTTP = "https://" + hostPort + healthPath
+		check.TLSSkipVerify = true
+	default:
+		check.HTTP = "http://" + hostPort + healthPath
+	}
+
+	return &consulapi.AgentServiceRegistration{
+		// unique per process, so a binary upgrade does not deregister the new process
+		ID:      fmt.Sprintf("%s-%d-%d", service.Name, port, os.Getpid()),
+		Name:    service.Name,
+		Tags:    service.Tags,
+		Meta:    service.Meta,
+		Address: address,
+		Port:    port,
+		Check:   check,
+	}
+}
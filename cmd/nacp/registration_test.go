@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceRegistration(t *testing.T) {
+	tt := []struct {
+		name        string
+		bind        string
+		tls         *config.ProxyTLS
+		address     string
+		wantAddress string
+		wantHTTP    string
+		wantTCP     string
+	}{
+		{
+			name:     "wildcard bind",
+			bind:     "0.0.0.0",
+			wantHTTP: "http://127.0.0.1:6464/healthz",
+		},
+		{
+			name:        "specific bind",
+			bind:        "10.0.0.5",
+			wantAddress: "10.0.0.5",
+			wantHTTP:    "http://10.0.0.5:6464/healthz",
+		},
+		{
+			name:        "advertised address",
+			bind:        "0.0.0.0",
+			address:     "nacp.example.com",
+			wantAddress: "nacp.example.com",
+			wantHTTP:    "http://127.0.0.1:6464/healthz",
+		},
+		{
+			name:     "tls",
+			bind:     "0.0.0.0",
+			tls:      &config.ProxyTLS{CertFile: "cert.pem", KeyFile: "key.pem"},
+			wantHTTP: "https://127.0.0.1:6464/healthz",
+		},
+		{
+			name:    "mutual tls",
+			bind:    "0.0.0.0",
+			tls:     &config.ProxyTLS{CertFile: "cert.pem", KeyFile: "key.pem", CaFile: "ca.pem"},
+			wantTCP: "127.0.0.1:6464",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := config.DefaultConfig()
+			c.Bind = tc.bind
+			c.Tls = tc.tls
+
+			consul := &config.ConsulService{
+				Name:          "policy-proxy",
+				Tags:          []string{"nacp"},
+				Meta:          map[string]string{"team": "platform"},
+				Address:       tc.address,
+				CheckInterval: "30s",
+			}
+
+			service := serviceRegistration(c, consul, 6464)
+			assert.Equal(t, "policy-proxy", service.Name)
+			assert.Equal(t, fmt.Sprintf("policy-proxy-6464-%d", os.Getpid()), service.ID)
+			assert.Equal(t, []string{"nacp"}, service.Tags)
+			assert.Equal(t, map[string]string{"team": "platform"}, service.Meta)
+			assert.Equal(t, "30s", service.Check.Interval)
+			assert.Equal(t, 6464, service.Port)
+			assert.Equal(t, tc.wantAddress, service.Address)
+			assert.Equal(t, tc.wantHTTP, service.Check.HTTP)
+			assert.Equal(t, tc.wantTCP, service.Check.TCP)
+		})
+	}
+}
+
+func TestConsulService(t *testing.T) {
+	c := config.DefaultConfig()
+	assert.Nil(t, consulService(c), "no registration by default")
+
+	c.Sidecar = &config.Sidecar{Register: true}
+	assert.Equal(t, config.DefaultConsulService(), consulService(c))
+
+	c.ConsulService = &config.ConsulService{Name: "custom"}
+	assert.Equal(t, "custom", consulService(c).Name)
+}
+
+func TestHealthHandler(t *testing.T) {
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	health := NewHealthHandler(handler, hclog.NewNullLogger())
+
+	rec := httptest.NewRecorder()
+	health(rec, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+
+	handler.PassThrough(errors.New("broken policy"))
+	rec = httptest.NewRecorder()
+	health(rec, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"status":"degraded","reason":"broken policy"}`, rec.Body.String())
+}
+
+func TestHealthEndpointIsServed(t *testing.T) {
+	nacp, err := buildServer(config.DefaultConfig(), hclog.NewNullLogger())
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	nacp.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/opa"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/pkg/admission"
+)
+
+// policyReloader rebuilds the rules from the config file and swaps them into the running job handler.
+// If the rules can't be loaded it falls back to the configured degraded mode instead of refusing traffic.
+type policyReloader struct {
+	configPath   string
+	degradedMode string
+	handler      *admissionctrl.JobHandler
+	status       *rulesetStatus
+	logger       hclog.Logger
+	opaOptions   []opa.Option
+	// shadow gets its candidate rules reloaded as well if set
+	shadow *admissionctrl.Shadow
+	// exemptions get the exemptions of the config file replaced if set
+	exemptions *admissionctrl.Exemptions
+	// reads gets its read rules replaced if set
+	reads *admissionctrl.ReadAuthorizer
+}
+
+func newPolicyReloader(configPath, degradedMode string, handler *admissionctrl.JobHandler, status *rulesetStatus, logger hclog.Logger, opaOptions ...opa.Option) *policyReloader {
+	return &policyReloader{
+		configPath:   configPath,
+		degradedMode: degradedMode,
+		handler:      handler,
+		status:       status,
+		logger:       logger,
+		opaOptions:   opaOptions,
+	}
+}
+
+// Reload loads the config file again and replaces the active rule set.
+// Only the rules are reloaded, listener and upstream settings require a restart.
+func (r *policyReloader) Reload() error {
+	if r.configPath == "" {
+		return fmt.Errorf("no config file given, nothing to reload")
+	}
+	c, err := config.LoadConfig(r.configPath)
+	if err != nil {
+		return r.fail(fmt.Errorf("failed to load config: %w", err))
+	}
+	if err := applySidecar(c, r.logger); err != nil {
+		return r.fail(err)
+	}
+	r.degradedMode = c.DegradedMode
+
+	mutators, validators, resolveToken, err := admission.BuildRules(c, r.logger, r.opaOptions...)
+	if err != nil {
+		return r.fail(err)
+	}
+	readRules, err := admission.BuildReadRules(c, r.logger, r.opaOptions...)
+	if err != nil {
+		return r.fail(err)
+	}
+	if r.exemptions != nil {
+		if err := setConfiguredExemptions(r.exemptions, c); err != nil {
+			return r.fail(err)
+		}
+	}
+	r.handler.Replace(mutators, validators, resolveToken)
+	if r.reads != nil {
+		r.reads.Replace(readRules)
+	}
+	r.handler.UseRuleVersions(admission.RuleVersions(c))
+	r.status.Update(c)
+	r.logger.Info("Reloaded rules", "mutators", len(mutators), "validators", len(validators), "read_rules", len(readRules))
+	r.reloadShadow(c)
+	return nil
+}
+
+// reloadShadow replaces the candidate rules, failures only keep the previous candidate rules.
+func (r *policyReloader) reloadShadow(c *config.Config) {
+	if r.shadow == nil || c.Shadow == nil {
+		return
+	}
+	mutators, validators, resolveToken, err := buildShadowRules(c, r.logger, r.opaOptions...)
+	if err != nil {
+		r.logger.Error("Reloading shadow rules failed, keeping previous candidate rules", "error", err)
+		return
+	}
+	r.shadow.Candidate().Replace(mutators, validators, resolveToken)
+	r.shadow.Reset()
+	r.logger.Info("Reloaded shadow rules", "mutators", len(mutators), "validators", len(validators))
+}
+
+func (r *policyReloader) fail(err error) error {
+	switch r.degradedMode {
+	case config.DegradedModePassThrough:
+		r.logger.Error("Reloading rules failed, switching to PASS-THROUGH mode, jobs are NOT checked anymore", "error", err)
+		r.handler.PassThrough(err)
+	default:
+		r.logger.Error("Reloading rules failed, keeping last known good rules", "error", err)
+	}
+	return err
+}
+
+// watchSignals triggers a reload on every SIGHUP.
+func (r *policyReloader) watchSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		r.logger.Info("Received SIGHUP, reloading rules")
+		notify(r.logger, daemon.SdNotifyReloading)
+		_ = r.Reload()
+		notify(r.logger, daemon.SdNotifyReady)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyReloader(t *testing.T) {
+	validConfig := fmt.Sprintf(`
+degraded_mode = "%%s"
+validator "opa" "errors" {
+  opa_rule {
+    query = "errors = data.dummy.errors"
+    filename = "%s"
+  }
+}
+`, testutil.Filepath(t, "opa/errors.rego"))
+	brokenConfig := `
+degraded_mode = "%s"
+validator "opa" "errors" {
+  opa_rule {
+    query = "errors = data.dummy.errors"
+    filename = "/does/not/exist.rego"
+  }
+}
+`
+	tt := []struct {
+		name              string
+		mode              string
+		wantRulesEnforced bool
+		wantDegraded      bool
+	}{
+		{
+			name:              "last known good keeps rules",
+			mode:              "last_known_good",
+			wantRulesEnforced: true,
+			wantDegraded:      false,
+		},
+		{
+			name:              "pass through drops rules",
+			mode:              "pass_through",
+			wantRulesEnforced: false,
+			wantDegraded:      true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "nacp.hcl")
+			require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(validConfig, tc.mode)), 0644))
+
+			handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+			reloader := newPolicyReloader(configFile, tc.mode, handler, &rulesetStatus{}, hclog.NewNullLogger())
+
+			require.NoError(t, reloader.Reload())
+			assert.Nil(t, handler.Degraded())
+
+			require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(brokenConfig, tc.mode)), 0644))
+			assert.Error(t, reloader.Reload())
+
+			assert.Equal(t, tc.wantDegraded, handler.Degraded() != nil)
+			_, err := handler.AdmissionValidators(&types.Payload{Job: testutil.ReadJob(t, "job.json")})
+			assert.Equal(t, tc.wantRulesEnforced, err != nil)
+
+			require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(validConfig, tc.mode)), 0644))
+			require.NoError(t, reloader.Reload())
+			assert.Nil(t, handler.Degraded(), "a successful reload leaves the degraded mode")
+		})
+	}
+}
+
+func TestPolicyReloaderReadRules(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "nacp.hcl")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+read_rule "namespaces" {
+  paths = ["/v1/jobs"]
+  opa_rule {
+    query = "errors = data.reads.errors"
+    filename = "%s"
+  }
+}
+`, testutil.Filepath(t, "opa/validators/reads.rego"))), 0644))
+
+	reads := admissionctrl.NewReadAuthorizer(hclog.NewNullLogger())
+	reloader := newPolicyReloader(configFile, "last_known_good", admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false), &rulesetStatus{}, hclog.NewNullLogger())
+	reloader.reads = reads
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/jobs", nil)
+	checks, _ := reads.Checks(req)
+	require.False(t, checks)
+	require.NoError(t, reloader.Reload())
+	checks, _ = reads.Checks(req)
+	assert.True(t, checks, "the read rules of the config file are applied")
+}
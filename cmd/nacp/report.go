@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/audit"
+	"github.com/mxab/nacp/config"
+)
+
+// buildReporter creates the reporter of the decision_report block, it is nil if the block is missing.
+func buildReporter(c *config.Config, logger hclog.Logger) *audit.Reporter {
+	r := c.DecisionReport
+	if r == nil {
+		return nil
+	}
+	// validated by LoadConfig
+	interval, _ := time.ParseDuration(r.Interval)
+	return audit.NewReporter(interval, r.Webhook, r.Top, &http.Client{}, logger)
+}
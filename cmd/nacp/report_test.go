@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildReporter(t *testing.T) {
+	assert.Nil(t, buildReporter(&config.Config{}, hclog.NewNullLogger()))
+	assert.NotNil(t, buildReporter(&config.Config{DecisionReport: &config.DecisionReport{Interval: "24h", Top: 5}}, hclog.NewNullLogger()))
+}
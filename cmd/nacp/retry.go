@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/metrics"
+)
+
+const (
+	// retryBudgetReserve is the number of retries available without any requests, the budget never exceeds it.
+	retryBudgetReserve = 10
+	// noLeaderPeekSize is the part of a 500 response that is searched for the missing leader.
+	noLeaderPeekSize = 512
+)
+
+// retryPolicy decides which proxied requests are retried and how long to wait between the attempts.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	budget         float64
+	methods        []string
+}
+
+// buildRetryPolicy returns the policy of the nomad retry block, it is nil if the block is missing.
+func buildRetryPolicy(c *config.Config) (*retryPolicy, error) {
+	if c.Nomad == nil || c.Nomad.Retry == nil {
+		return nil, nil
+	}
+	r := c.Nomad.Retry
+	initial, err := time.ParseDuration(r.InitialBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid initial backoff: %w", err)
+	}
+	max, err := time.ParseDuration(r.MaxBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max backoff: %w", err)
+	}
+	return &retryPolicy{
+		maxAttempts:    r.MaxAttempts,
+		initialBackoff: initial,
+		maxBackoff:     max,
+		budget:         r.Budget,
+		methods:        r.Methods,
+	}, nil
+}
+
+// backoff returns a random duration up to the exponential backoff of the attempt, attempts start at 1.
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.maxBackoff
+	if shift := attempt - 1; shift < 32 && p.initialBackoff<<shift < p.maxBackoff {
+		backoff = p.initialBackoff << shift
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// retryBudget limits the retries to a share of the requests, so retries don't pile up on a failing cluster.
+type retryBudget struct {
+	mu      sync.Mutex
+	ratio   float64
+	balance float64
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.balance = min(b.balance+b.ratio, retryBudgetReserve)
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.balance < 1 {
+		return false
+	}
+	b.balance--
+	return true
+}
+
+// retryTransport retries requests with idempotent methods that failed transiently, e.g. during a leader election.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy *retryPolicy
+	budget *retryBudget
+	logger hclog.Logger
+}
+
+func newRetryTransport(next http.RoundTripper, policy *retryPolicy, logger hclog.Logger) *retryTransport {
+	return &retryTransport{
+		next:   next,
+		policy: policy,
+		budget: &retryBudget{ratio: policy.budget, balance: retryBudgetReserve},
+		logger: logger,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !slices.Contains(t.policy.methods, req.Method) || !idempotentEndpoint(req) {
+		return t.next.RoundTrip(req)
+	}
+	t.budget.deposit()
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		out := req.Clone(req.Context())
+		if body != nil {
+			out.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.next.RoundTrip(out)
+		retry, reason := t.retryable(req.Context(), resp, err)
+		if !retry || attempt >= t.policy.maxAttempts {
+			return resp, err
+		}
+		if !t.budget.withdraw() {
+			metrics.UpstreamRetries.WithLabelValues("budget_exhausted").Inc()
+			t.logger.Warn("Retry budget exhausted, not retrying request", "method", req.Method, "path", req.URL.Path, "reason", reason)
+			return resp, err
+		}
+
+		backoff := t.policy.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok && after <= t.policy.maxBackoff {
+				backoff = after
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		metrics.UpstreamRetries.WithLabelValues("retried").Inc()
+		t.logger.Debug("Retrying request", "method", req.Method, "path", req.URL.Path, "attempt", attempt, "reason", reason, "backoff", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// idempotentOperations are the intercepted job writes that can be repeated, plans and validations don't change any state
+// and deregistering a stopped job again has no further effect. Registrations, evaluations and forced periodic runs
+// create a new job version or evaluation on every attempt.
+var idempotentOperations = []string{config.OperationPlan, config.OperationValidate, config.OperationDeregister}
+
+// idempotentWrites are the other write endpoints that upsert or delete an object by the name in their path.
+var idempotentWrites = []struct {
+	method string
+	prefix string
+}{
+	{method: http.MethodPut, prefix: "/v1/var/"},
+	{method: http.MethodDelete, prefix: "/v1/var/"},
+	{method: http.MethodPut, prefix: "/v1/namespace/"},
+	{method: http.MethodDelete, prefix: "/v1/namespace/"},
+}
+
+// idempotentEndpoint reports whether repeating the request has no other effect than the first attempt.
+// Writes are only repeated if they are known to be idempotent, e.g. ACL token and role creates, job scaling
+// and reverts are not.
+func idempotentEndpoint(req *http.Request) bool {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+		return true
+	}
+	if operation := matchRoute(req).Operation; operation != "" {
+		return slices.Contains(idempotentOperations, operation)
+	}
+	for _, write := range idempotentWrites {
+		if req.Method == write.method && strings.HasPrefix(req.URL.Path, write.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryable reports whether the attempt failed transiently and why.
+func (t *retryTransport) retryable(ctx context.Context, resp *http.Response, err error) (bool, string) {
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return false, ""
+		}
+		return true, err.Error()
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, resp.Status
+	case http.StatusInternalServerError:
+		// e.g. during a leader election, other errors of nomad are 500s as well
+		peek := make([]byte, noLeaderPeekSize)
+		n, _ := io.ReadFull(resp.Body, peek)
+		peek = peek[:n]
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(peek), resp.Body), resp.Body}
+		if bytes.Contains(peek, []byte("No cluster leader")) {
+			return true, "no cluster leader"
+		}
+	}
+	return false, ""
+}
+
+// retryAfter returns the delay of the Retry-After header in seconds.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRetryPolicy() *retryPolicy {
+	return &retryPolicy{
+		maxAttempts:    3,
+		initialBackoff: time.Millisecond,
+		maxBackoff:     5 * time.Millisecond,
+		budget:         0.2,
+		methods:        config.IdempotentMethods,
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		failures     int
+		status       int
+		body         string
+		wantStatus   int
+		wantAttempts int32
+	}{
+		{name: "leader election", method: http.MethodPut, failures: 2, status: http.StatusInternalServerError, body: "No cluster leader", wantStatus: http.StatusOK, wantAttempts: 3},
+		{name: "too many requests", method: http.MethodGet, failures: 1, status: http.StatusTooManyRequests, wantStatus: http.StatusOK, wantAttempts: 2},
+		{name: "unavailable", method: http.MethodDelete, failures: 1, status: http.StatusServiceUnavailable, wantStatus: http.StatusOK, wantAttempts: 2},
+		{name: "attempts exhausted", method: http.MethodGet, failures: 5, status: http.StatusBadGateway, wantStatus: http.StatusBadGateway, wantAttempts: 3},
+		{name: "other server error", method: http.MethodPut, failures: 1, status: http.StatusInternalServerError, body: "job validation failed", wantStatus: http.StatusInternalServerError, wantAttempts: 1},
+		{name: "not idempotent", method: http.MethodPost, failures: 1, status: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, "job", string(body), "the body is sent on every attempt")
+				if int(attempts.Add(1)) <= tt.failures {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer nomad.Close()
+
+			client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, testRetryPolicy(), hclog.NewNullLogger())}
+			req, err := http.NewRequest(tt.method, nomad.URL+"/v1/var/app", strings.NewReader("job"))
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantAttempts, attempts.Load())
+			if tt.wantStatus == http.StatusInternalServerError {
+				body, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, tt.body, string(body), "the peeked body is kept")
+			}
+		})
+	}
+}
+
+func TestRetryTransport_NonIdempotentEndpoints(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		retry  bool
+	}{
+		{method: http.MethodPut, path: "/v1/jobs"},
+		{method: http.MethodPut, path: "/v1/job/example"},
+		{method: http.MethodPut, path: "/v1/job/example/dispatch"},
+		{method: http.MethodPut, path: "/v1/job/example/evaluate"},
+		{method: http.MethodPut, path: "/v1/job/example/periodic/force"},
+		{method: http.MethodPut, path: "/v1/job/example/scale"},
+		{method: http.MethodPut, path: "/v1/job/example/revert"},
+		{method: http.MethodPut, path: "/v1/job/team/example"},
+		{method: http.MethodPut, path: "/v1/job/team/example/evaluate"},
+		{method: http.MethodPut, path: "/v1/acl/token"},
+		{method: http.MethodPut, path: "/v1/acl/role"},
+		{method: http.MethodPut, path: "/v1/acl/policy/readonly"},
+		{method: http.MethodDelete, path: "/v1/job/example/versions/v1/tag"},
+		{method: http.MethodDelete, path: "/v1/job/example", retry: true},
+		{method: http.MethodDelete, path: "/v1/job/team/example", retry: true},
+		{method: http.MethodPut, path: "/v1/job/team/example/plan", retry: true},
+		{method: http.MethodPut, path: "/v1/validate/job", retry: true},
+		{method: http.MethodPut, path: "/v1/var/app", retry: true},
+		{method: http.MethodDelete, path: "/v1/namespace/team", retry: true},
+		{method: http.MethodGet, path: "/v1/job/example", retry: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var attempts atomic.Int32
+			nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer nomad.Close()
+
+			client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, testRetryPolicy(), hclog.NewNullLogger())}
+			req, err := http.NewRequest(tt.method, nomad.URL+tt.path, strings.NewReader("job"))
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			if tt.retry {
+				assert.Equal(t, int32(2), attempts.Load())
+			} else {
+				assert.Equal(t, int32(1), attempts.Load(), "the write is not repeated even if the method is retried")
+			}
+		})
+	}
+}
+
+func TestRetryTransport_Budget(t *testing.T) {
+	var attempts atomic.Int32
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer nomad.Close()
+
+	policy := testRetryPolicy()
+	policy.budget = 0
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, policy, hclog.NewNullLogger())}
+	for i := 0; i < 10; i++ {
+		resp, err := client.Get(nomad.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	// the reserve allows 10 retries, the first 5 requests use 2 each
+	assert.Equal(t, int32(20), attempts.Load())
+}
+
+func TestRetryTransport_RetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}))
+	defer nomad.Close()
+
+	policy := testRetryPolicy()
+	policy.maxBackoff = 2 * time.Second
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, policy, hclog.NewNullLogger())}
+	start := time.Now()
+	resp, err := client.Get(nomad.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &retryPolicy{initialBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, policy.backoff(1), 100*time.Millisecond)
+		assert.LessOrEqual(t, policy.backoff(3), 400*time.Millisecond)
+		assert.LessOrEqual(t, policy.backoff(64), time.Second)
+	}
+}
+
+func TestBuildRetryPolicy(t *testing.T) {
+	policy, err := buildRetryPolicy(&config.Config{Nomad: &config.NomadServer{}})
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = buildRetryPolicy(&config.Config{Nomad: &config.NomadServer{Retry: &config.NomadRetry{
+		MaxAttempts:    3,
+		InitialBackoff: "100ms",
+		MaxBackoff:     "2s",
+		Budget:         0.2,
+		Methods:        []string{"GET"},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, &retryPolicy{
+		maxAttempts:    3,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     2 * time.Second,
+		budget:         0.2,
+		methods:        []string{"GET"},
+	}, policy)
+}
+
+func TestProxyRetriesUpstream(t *testing.T) {
+	var attempts atomic.Int32
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer nomad.Close()
+	nomadURL, _ := url.Parse(nomad.URL)
+
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomadURL, jobHandler, hclog.NewNullLogger(), nil, WithRetry(testRetryPolicy()))
+	rr := httptest.NewRecorder()
+	proxy(rr, httptest.NewRequest(http.MethodGet, "/v1/nodes", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int32(2), attempts.Load())
+}
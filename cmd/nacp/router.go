@@ -0,0 +1,191 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+)
+
+// jobSubresources are the suffixes Nomad routes to other handlers than the job itself, in Nomad's order of matching.
+// PUT and POST to /v1/job/<id> with any other suffix register the job, job IDs may contain slashes.
+var jobSubresources = []string{
+	"/evaluate", "/allocations", "/evaluations", "/periodic/force", "/plan", "/summary", "/dispatch", "/versions",
+	"/revert", "/deployments", "/deployment", "/stable", "/scale", "/services", "/submission", "/actions", "/action", "/tag",
+}
+
+// jobSubresourceOperations are the subresources of jobs NACP intercepts, the others are passed through.
+var jobSubresourceOperations = map[string]string{
+	"/plan":           config.OperationPlan,
+	"/evaluate":       config.OperationEvaluate,
+	"/periodic/force": config.OperationPeriodicForce,
+}
+
+// namespaceHeader is an alternative to the namespace query parameter, Nomad itself only reads the query.
+const namespaceHeader = "X-Nomad-Namespace"
+
+// route of an intercepted request, the operation is empty for requests passed through unchecked.
+type route struct {
+	Operation string
+	// JobID from the path, empty for /v1/jobs and /v1/validate/job
+	JobID string
+	// AllocID of an allocation restart or stop
+	AllocID string
+	// Namespace and Region from the query, they take precedence over the ones of the job
+	Namespace string
+	Region    string
+	// NamespaceFromHeader is set if the namespace is only given by the X-Nomad-Namespace header
+	NamespaceFromHeader bool
+}
+
+// matchRoute matches the request like Nomad's HTTP server does, so no write of a job passes unchecked.
+func matchRoute(r *http.Request) route {
+	deregister := r.Method == http.MethodDelete
+	if r.Method != http.MethodPut && r.Method != http.MethodPost && !deregister {
+		return route{}
+	}
+	rt := route{
+		Namespace: r.URL.Query().Get("namespace"),
+		Region:    r.URL.Query().Get("region"),
+	}
+	if rt.Namespace == "" && r.Header.Get(namespaceHeader) != "" {
+		rt.Namespace = r.Header.Get(namespaceHeader)
+		rt.NamespaceFromHeader = true
+	}
+	p := r.URL.Path
+	switch {
+	case deregister:
+		// DELETE /v1/job/<id> stops or purges the job, job IDs may contain slashes like for registers
+		id, ok := strings.CutPrefix(p, "/v1/job/")
+		if !ok || id == "" {
+			return route{}
+		}
+		for _, suffix := range jobSubresources {
+			if strings.HasSuffix(id, suffix) {
+				return route{}
+			}
+		}
+		rt.Operation = config.OperationDeregister
+		rt.JobID = id
+	case p == "/v1/jobs":
+		// cli does PUT, browser does POST :/
+		rt.Operation = config.OperationRegister
+	case p == "/v1/validate/job":
+		rt.Operation = config.OperationValidate
+	case strings.HasPrefix(p, "/v1/client/allocation/") && strings.HasSuffix(p, "/restart"):
+		rt.Operation = config.OperationAllocRestart
+		rt.AllocID = strings.TrimSuffix(strings.TrimPrefix(p, "/v1/client/allocation/"), "/restart")
+	case strings.HasPrefix(p, "/v1/allocation/") && strings.HasSuffix(p, "/stop"):
+		rt.Operation = config.OperationAllocStop
+		rt.AllocID = strings.TrimSuffix(strings.TrimPrefix(p, "/v1/allocation/"), "/stop")
+	case strings.HasPrefix(p, "/v1/job/"):
+		id := strings.TrimPrefix(p, "/v1/job/")
+		for _, suffix := range jobSubresources {
+			if strings.HasSuffix(id, suffix) {
+				operation, ok := jobSubresourceOperations[suffix]
+				if !ok {
+					return route{}
+				}
+				rt.Operation = operation
+				rt.JobID = strings.TrimSuffix(id, suffix)
+				return rt
+			}
+		}
+		rt.Operation = config.OperationRegister
+		rt.JobID = id
+	default:
+		return route{}
+	}
+	return rt
+}
+
+// isNearMiss reports writes that are not intercepted but would be after normalizing case, slashes or method,
+// e.g. PUT /v1/jobs/ or PATCH /v1/jobs. Nomad rejects them, they hint at clients or proxies rewriting paths.
+func isNearMiss(r *http.Request) bool {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost && r.Method != http.MethodPatch {
+		return false
+	}
+	if matchRoute(r).Operation != "" {
+		return false
+	}
+	normalized := &http.Request{
+		Method: http.MethodPut,
+		URL:    &url.URL{Path: strings.TrimSuffix(strings.ToLower(path.Clean("/"+r.URL.Path)), "/")},
+	}
+	return matchRoute(normalized).Operation != ""
+}
+
+// forwardNamespace adds the namespace of the X-Nomad-Namespace header to the query,
+// so Nomad writes the job to the namespace the rules have seen.
+func forwardNamespace(r *http.Request, rt route) {
+	if !rt.NamespaceFromHeader || rt.Operation == "" {
+		return
+	}
+	query := r.URL.Query()
+	query.Set("namespace", rt.Namespace)
+	r.URL.RawQuery = query.Encode()
+}
+
+// applyRouteScope sets the namespace and region Nomad will use on the job, so the rules see the effective ones.
+// Like Nomad, the query takes precedence over the request body, which takes precedence over the job.
+// It returns where the effective namespace comes from, one of the config.NamespaceSource values.
+func applyRouteScope(job *api.Job, rt route, write api.WriteRequest) string {
+	if job == nil {
+		return ""
+	}
+	source := config.NamespaceSourceJob
+	switch {
+	case rt.NamespaceFromHeader:
+		source = config.NamespaceSourceHeader
+	case rt.Namespace != "":
+		source = config.NamespaceSourceQuery
+	case write.Namespace != "":
+		source = config.NamespaceSourceRequest
+	}
+	if namespace := firstNonEmpty(rt.Namespace, write.Namespace); namespace != "" {
+		job.Namespace = &namespace
+	}
+	if region := firstNonEmpty(rt.Region, write.Region); region != "" && job.Multiregion == nil {
+		job.Region = &region
+	}
+	return source
+}
+
+// scopeContext records the effective namespace of the job and where it comes from in the request context.
+func scopeContext(r *http.Request, job *api.Job, source string) {
+	reqCtx, ok := r.Context().Value("request_context").(*config.RequestContext)
+	if !ok || job == nil {
+		return
+	}
+	reqCtx.Namespace = firstNonEmpty(pointerValue(job.Namespace), api.DefaultNamespace)
+	reqCtx.NamespaceSource = source
+}
+
+func pointerValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func isRegister(r *http.Request) bool {
+	return matchRoute(r).Operation == config.OperationRegister
+}
+func isPlan(r *http.Request) bool {
+	return matchRoute(r).Operation == config.OperationPlan
+}
+func isValidate(r *http.Request) bool {
+	return matchRoute(r).Operation == config.OperationValidate
+}
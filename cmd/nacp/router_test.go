@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/hashicorp/nomad/helper/pointer"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRoute(t *testing.T) {
+	tt := []struct {
+		name   string
+		method string
+		target string
+		header string
+		want   route
+	}{
+		{name: "create", method: http.MethodPut, target: "/v1/jobs", want: route{Operation: config.OperationRegister}},
+		{name: "create from the browser", method: http.MethodPost, target: "/v1/jobs", want: route{Operation: config.OperationRegister}},
+		{name: "list", method: http.MethodGet, target: "/v1/jobs"},
+		{name: "parse", method: http.MethodPost, target: "/v1/jobs/parse"},
+		{name: "update", method: http.MethodPut, target: "/v1/job/example", want: route{Operation: config.OperationRegister, JobID: "example"}},
+		{name: "update with dots and underscores", method: http.MethodPost, target: "/v1/job/my_job.v2", want: route{Operation: config.OperationRegister, JobID: "my_job.v2"}},
+		{name: "update with leading digit", method: http.MethodPost, target: "/v1/job/2fa", want: route{Operation: config.OperationRegister, JobID: "2fa"}},
+		{name: "update with encoded slash", method: http.MethodPut, target: "/v1/job/team%2Fapi", want: route{Operation: config.OperationRegister, JobID: "team/api"}},
+		{name: "update with encoded space", method: http.MethodPut, target: "/v1/job/my%20job", want: route{Operation: config.OperationRegister, JobID: "my job"}},
+		{name: "update without id", method: http.MethodPut, target: "/v1/job/", want: route{Operation: config.OperationRegister}},
+		{name: "read", method: http.MethodGet, target: "/v1/job/example"},
+		{name: "stop", method: http.MethodDelete, target: "/v1/job/example", want: route{Operation: config.OperationDeregister, JobID: "example"}},
+		{name: "purge", method: http.MethodDelete, target: "/v1/job/team%2Fapi?purge=true&namespace=billing", want: route{Operation: config.OperationDeregister, JobID: "team/api", Namespace: "billing"}},
+		{name: "delete without id", method: http.MethodDelete, target: "/v1/job/"},
+		{name: "delete subresource", method: http.MethodDelete, target: "/v1/job/example/tag"},
+		{name: "delete other api", method: http.MethodDelete, target: "/v1/namespace/billing"},
+		{name: "plan", method: http.MethodPost, target: "/v1/job/example/plan", want: route{Operation: config.OperationPlan, JobID: "example"}},
+		{name: "plan with encoded name", method: http.MethodPut, target: "/v1/job/team%2Fapi.v2/plan", want: route{Operation: config.OperationPlan, JobID: "team/api.v2"}},
+		{name: "dispatch", method: http.MethodPut, target: "/v1/job/example/dispatch"},
+		{name: "force evaluation", method: http.MethodPut, target: "/v1/job/example/evaluate", want: route{Operation: config.OperationEvaluate, JobID: "example"}},
+		{name: "force periodic launch", method: http.MethodPost, target: "/v1/job/example/periodic/force", want: route{Operation: config.OperationPeriodicForce, JobID: "example"}},
+		{name: "alloc restart", method: http.MethodPut, target: "/v1/client/allocation/5456bd7a/restart", want: route{Operation: config.OperationAllocRestart, AllocID: "5456bd7a"}},
+		{name: "alloc stop", method: http.MethodPost, target: "/v1/allocation/5456bd7a/stop", want: route{Operation: config.OperationAllocStop, AllocID: "5456bd7a"}},
+		{name: "alloc read", method: http.MethodGet, target: "/v1/allocation/5456bd7a"},
+		{name: "alloc signal", method: http.MethodPut, target: "/v1/client/allocation/5456bd7a/signal"},
+		{name: "scale", method: http.MethodPost, target: "/v1/job/example/scale"},
+		{name: "revert", method: http.MethodPut, target: "/v1/job/example/revert"},
+		{name: "validate", method: http.MethodPut, target: "/v1/validate/job", want: route{Operation: config.OperationValidate}},
+		{
+			name:   "namespace and region from the query",
+			method: http.MethodPut,
+			target: "/v1/job/example?namespace=billing&region=eu",
+			want:   route{Operation: config.OperationRegister, JobID: "example", Namespace: "billing", Region: "eu"},
+		},
+		{
+			name:   "namespace from the header",
+			method: http.MethodPut,
+			target: "/v1/jobs",
+			header: "billing",
+			want:   route{Operation: config.OperationRegister, Namespace: "billing", NamespaceFromHeader: true},
+		},
+		{
+			name:   "query wins over the header",
+			method: http.MethodPut,
+			target: "/v1/jobs?namespace=ops",
+			header: "billing",
+			want:   route{Operation: config.OperationRegister, Namespace: "ops"},
+		},
+		{name: "other api", method: http.MethodPut, target: "/v1/namespace/billing"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+			if tc.header != "" {
+				r.Header.Set(namespaceHeader, tc.header)
+			}
+			assert.Equal(t, tc.want, matchRoute(r))
+		})
+	}
+}
+
+func TestIsNearMiss(t *testing.T) {
+	tt := []struct {
+		method string
+		target string
+		want   bool
+	}{
+		{method: http.MethodPut, target: "/v1/jobs/", want: true},
+		{method: http.MethodPut, target: "/V1/Jobs", want: true},
+		{method: http.MethodPatch, target: "/v1/jobs", want: true},
+		{method: http.MethodPost, target: "/v1/validate/job/", want: true},
+		{method: http.MethodPut, target: "/v1/jobs"},
+		{method: http.MethodGet, target: "/v1/jobs/"},
+		{method: http.MethodPut, target: "/v1/job/example/dispatch"},
+		{method: http.MethodPost, target: "/v1/jobs/parse"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.method+" "+tc.target, func(t *testing.T) {
+			assert.Equal(t, tc.want, isNearMiss(httptest.NewRequest(tc.method, tc.target, nil)))
+		})
+	}
+}
+
+func TestApplyRouteScope(t *testing.T) {
+	tt := []struct {
+		name          string
+		job           *api.Job
+		rt            route
+		write         api.WriteRequest
+		wantNamespace *string
+		wantRegion    *string
+		wantSource    string
+	}{
+		{name: "job values are kept", job: &api.Job{Namespace: pointer.Of("dev"), Region: pointer.Of("us")}, wantNamespace: pointer.Of("dev"), wantRegion: pointer.Of("us"), wantSource: config.NamespaceSourceJob},
+		{name: "query wins", job: &api.Job{Namespace: pointer.Of("dev")}, rt: route{Namespace: "billing", Region: "eu"}, write: api.WriteRequest{Namespace: "ops"}, wantNamespace: pointer.Of("billing"), wantRegion: pointer.Of("eu"), wantSource: config.NamespaceSourceQuery},
+		{name: "header wins", job: &api.Job{Namespace: pointer.Of("dev")}, rt: route{Namespace: "billing", NamespaceFromHeader: true}, write: api.WriteRequest{Namespace: "ops"}, wantNamespace: pointer.Of("billing"), wantSource: config.NamespaceSourceHeader},
+		{name: "request body wins over job", job: &api.Job{Namespace: pointer.Of("dev")}, write: api.WriteRequest{Namespace: "ops", Region: "ap"}, wantNamespace: pointer.Of("ops"), wantRegion: pointer.Of("ap"), wantSource: config.NamespaceSourceRequest},
+		{name: "multiregion keeps its region", job: &api.Job{Multiregion: &api.Multiregion{}}, rt: route{Region: "eu"}, wantSource: config.NamespaceSourceJob},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantSource, applyRouteScope(tc.job, tc.rt, tc.write))
+			assert.Equal(t, tc.wantNamespace, tc.job.Namespace)
+			assert.Equal(t, tc.wantRegion, tc.job.Region)
+		})
+	}
+}
+
+func TestForwardNamespace(t *testing.T) {
+	tt := []struct {
+		name      string
+		target    string
+		header    string
+		wantQuery string
+	}{
+		{name: "header is added to the query", target: "/v1/jobs", header: "billing", wantQuery: "namespace=billing"},
+		{name: "query is kept", target: "/v1/jobs?namespace=ops", header: "billing", wantQuery: "namespace=ops"},
+		{name: "other apis are not touched", target: "/v1/job/example/dispatch", header: "billing"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, tc.target, nil)
+			r.Header.Set(namespaceHeader, tc.header)
+			forwardNamespace(r, matchRoute(r))
+			assert.Equal(t, tc.wantQuery, r.URL.RawQuery)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+)
+
+//go:embed scaffold/*.tmpl
+var scaffoldTemplates embed.FS
+
+// scaffoldFiles are the generated files per language, mapped to their template.
+var scaffoldFiles = map[string]map[string]string{
+	"go": {
+		"main.go":  "go_main.go.tmpl",
+		"go.mod":   "go.mod.tmpl",
+		"nacp.hcl": "nacp.hcl.tmpl",
+	},
+	"python": {
+		"server.py": "server.py.tmpl",
+		"nacp.hcl":  "nacp.hcl.tmpl",
+	},
+}
+
+var scaffoldName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+type scaffoldParams struct {
+	Name string
+	Kind string
+	Port int
+}
+
+// runScaffold implements "nacp scaffold webhook", it writes a minimal webhook server implementing the webhook contract.
+func runScaffold(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "webhook" {
+		return errors.New("usage: nacp scaffold webhook [-lang go|python] [-kind validator|mutator] [-name name] [-port port] [-out dir]")
+	}
+	flags := flag.NewFlagSet("scaffold webhook", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	lang := flags.String("lang", "go", "language of the webhook server, go or python")
+	kind := flags.String("kind", "validator", "validator or mutator (json patch)")
+	name := flags.String("name", "my-webhook", "name of the webhook")
+	port := flags.Int("port", 8080, "port the webhook server listens on")
+	out := flags.String("out", "", "output directory, defaults to the name")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	files, ok := scaffoldFiles[*lang]
+	if !ok {
+		return fmt.Errorf("unsupported language %s", *lang)
+	}
+	if *kind != "validator" && *kind != "mutator" {
+		return fmt.Errorf("unsupported kind %s", *kind)
+	}
+	if !scaffoldName.MatchString(*name) {
+		return fmt.Errorf("invalid name %q, use lower case letters, digits, - and _", *name)
+	}
+	dir := *out
+	if dir == "" {
+		dir = *name
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for file := range files {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			return fmt.Errorf("%s already exists", filepath.Join(dir, file))
+		}
+	}
+
+	params := scaffoldParams{Name: *name, Kind: *kind, Port: *port}
+	for file, tmpl := range files {
+		target := filepath.Join(dir, file)
+		t, err := template.ParseFS(scaffoldTemplates, "scaffold/"+tmpl)
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		err = t.Execute(f, params)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+	}
+	fmt.Fprintf(stdout, "created %s %s webhook in %s\n", *lang, *kind, dir)
+	if *lang == "go" {
+		fmt.Fprintf(stdout, "run it with: cd %s && go mod tidy && go run .\n", dir)
+	} else {
+		fmt.Fprintf(stdout, "run it with: python3 %s\n", filepath.Join(dir, "server.py"))
+	}
+	fmt.Fprintf(stdout, "register it in NACP with the block in %s\n", filepath.Join(dir, "nacp.hcl"))
+	return nil
+}
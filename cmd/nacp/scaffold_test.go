@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaffoldWebhook(t *testing.T) {
+	tt := []struct {
+		lang      string
+		kind      string
+		wantFiles []string
+		wantType  string
+	}{
+		{lang: "go", kind: "validator", wantFiles: []string{"main.go", "go.mod", "nacp.hcl"}, wantType: "webhook"},
+		{lang: "go", kind: "mutator", wantFiles: []string{"main.go", "go.mod", "nacp.hcl"}, wantType: "json_patch_webhook"},
+		{lang: "python", kind: "validator", wantFiles: []string{"server.py", "nacp.hcl"}, wantType: "webhook"},
+		{lang: "python", kind: "mutator", wantFiles: []string{"server.py", "nacp.hcl"}, wantType: "json_patch_webhook"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.lang+"_"+tc.kind, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "hook")
+			out := &bytes.Buffer{}
+
+			err := runScaffold([]string{"webhook", "-lang", tc.lang, "-kind", tc.kind, "-name", "hook", "-port", "9090", "-out", dir}, out)
+			require.NoError(t, err)
+			assert.Contains(t, out.String(), "created "+tc.lang+" "+tc.kind+" webhook")
+
+			for _, file := range tc.wantFiles {
+				assert.FileExists(t, filepath.Join(dir, file))
+			}
+			if tc.lang == "go" {
+				_, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, "main.go"), nil, parser.AllErrors)
+				assert.NoError(t, err, "generated go code parses")
+			} else {
+				server, err := os.ReadFile(filepath.Join(dir, "server.py"))
+				require.NoError(t, err)
+				assert.Contains(t, string(server), "def review(request):")
+				assert.Contains(t, string(server), `HTTPServer(("", 9090), Handler)`)
+			}
+
+			c, err := config.LoadConfig(filepath.Join(dir, "nacp.hcl"))
+			require.NoError(t, err, "generated config snippet loads")
+			var types []string
+			var endpoint string
+			for _, v := range c.Validators {
+				types = append(types, v.Type)
+				endpoint = v.Webhook.Endpoint
+			}
+			for _, m := range c.Mutators {
+				types = append(types, m.Type)
+				endpoint = m.Webhook.Endpoint
+			}
+			assert.Equal(t, []string{tc.wantType}, types)
+			assert.Equal(t, "http://localhost:9090/"+tc.kind, endpoint)
+		})
+	}
+}
+
+func TestScaffoldWebhookErrors(t *testing.T) {
+	existing := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(existing, "main.go"), []byte("package main"), 0644))
+
+	tt := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "missing subcommand", args: nil, wantErr: "usage: nacp scaffold webhook"},
+		{name: "unknown subcommand", args: []string{"policy"}, wantErr: "usage: nacp scaffold webhook"},
+		{name: "unknown language", args: []string{"webhook", "-lang", "rust"}, wantErr: "unsupported language rust"},
+		{name: "unknown kind", args: []string{"webhook", "-kind", "both"}, wantErr: "unsupported kind both"},
+		{name: "invalid name", args: []string{"webhook", "-name", "My Hook"}, wantErr: `invalid name "My Hook"`},
+		{name: "does not overwrite", args: []string{"webhook", "-out", existing}, wantErr: "already exists"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := runScaffold(tc.args, &bytes.Buffer{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
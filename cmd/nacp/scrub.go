@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/metrics"
+)
+
+// redacted replaces the values of masked fields.
+const redacted = "<redacted>"
+
+// streamedPaths are the prefixes of Nomad's endpoints that stream their response, they are never buffered to be scrubbed.
+var streamedPaths = []string{"/v1/event/stream", "/v1/client/fs/stream/", "/v1/client/fs/logs/"}
+
+func isStreamed(r *http.Request) bool {
+	for _, prefix := range streamedPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubRule redacts fields of the responses of read requests to matching paths.
+type scrubRule struct {
+	name  string
+	paths []string
+	// fields are split into their segments, each a path.Match pattern on an object key or array index
+	fields [][]string
+	mask   bool
+}
+
+func (s *scrubRule) matches(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if len(s.paths) == 0 {
+		return true
+	}
+	for _, pattern := range s.paths {
+		if matched, _ := path.Match(pattern, r.URL.Path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// scrub removes or masks the fields matching the segments below the value, it returns the number of redacted fields.
+func (s *scrubRule) scrub(value interface{}, segments []string) int {
+	if len(segments) == 0 {
+		return 0
+	}
+	pattern, last := segments[0], len(segments) == 1
+	redactedFields := 0
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if matched, _ := path.Match(pattern, key); !matched {
+				continue
+			}
+			if !last {
+				redactedFields += s.scrub(child, segments[1:])
+				continue
+			}
+			if s.mask {
+				v[key] = redacted
+			} else {
+				delete(v, key)
+			}
+			redactedFields++
+		}
+	case []interface{}:
+		for i, child := range v {
+			if matched, _ := path.Match(pattern, strconv.Itoa(i)); !matched {
+				continue
+			}
+			if !last {
+				redactedFields += s.scrub(child, segments[1:])
+				continue
+			}
+			// array elements are always masked, removing them would shift the indexes
+			v[i] = redacted
+			redactedFields++
+		}
+	}
+	return redactedFields
+}
+
+// responseScrubbing are the rules of the response_scrubbing block.
+type responseScrubbing struct {
+	rules []*scrubRule
+}
+
+// buildResponseScrubbing returns the rules of the response_scrubbing block, it is nil if the block is missing.
+func buildResponseScrubbing(c *config.Config) *responseScrubbing {
+	if c.ResponseScrubbing == nil {
+		return nil
+	}
+	s := &responseScrubbing{}
+	for _, rule := range c.ResponseScrubbing.Rules {
+		fields := make([][]string, 0, len(rule.Fields))
+		for _, field := range rule.Fields {
+			fields = append(fields, strings.Split(field, "."))
+		}
+		s.rules = append(s.rules, &scrubRule{
+			name:   rule.Name,
+			paths:  rule.Paths,
+			fields: fields,
+			mask:   rule.Action == config.ScrubActionMask,
+		})
+	}
+	return s
+}
+
+// WithResponseScrubbing redacts fields of the responses of read requests.
+func WithResponseScrubbing(scrubbing *responseScrubbing) ProxyOption {
+	return func(o *proxyOptions) {
+		o.scrubbing = scrubbing
+	}
+}
+
+// scrubResponse redacts the fields of all rules matching the request from a successful JSON response.
+// Other content types, like the UI's assets, and streamed responses pass through unchanged.
+// Unlike NACP's warnings, JSON responses larger than maxSize are rejected, so no field passes unredacted.
+func (s *responseScrubbing) scrubResponse(resp *http.Response, maxSize int64) error {
+	if s == nil || resp.StatusCode != http.StatusOK || isStreamed(resp.Request) {
+		return nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "application/json" {
+		return nil
+	}
+	var rules []*scrubRule
+	for _, rule := range s.rules {
+		if rule.matches(resp.Request) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	if resp.ContentLength > maxSize {
+		return fmt.Errorf("response of %s to scrub is larger than %d bytes", resp.Request.URL.Path, maxSize)
+	}
+	isGzip, reader, err := checkIfGzipAndTransformReader(resp, resp.Body)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	n, err := buf.ReadFrom(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if n > maxSize {
+		return fmt.Errorf("response of %s to scrub is larger than %d bytes", resp.Request.URL.Path, maxSize)
+	}
+
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	// keeps indexes and other large integers exact
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		redactedFields := 0
+		for _, field := range rule.fields {
+			redactedFields += rule.scrub(body, field)
+		}
+		if redactedFields > 0 {
+			metrics.ScrubbedFields.WithLabelValues(rule.name).Add(float64(redactedFields))
+		}
+	}
+	return rewriteResponse(resp, body, isGzip)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const scrubbedJob = `{
+	"ID": "web",
+	"JobModifyIndex": 9007199254740993,
+	"Meta": {"owner": "team-a", "db_secret": "hunter2"},
+	"TaskGroups": [{"Tasks": [
+		{"Name": "app", "Vault": {"Policies": ["db"]}, "Env": {"API_TOKEN": "abc", "PORT": "8080"}},
+		{"Name": "sidecar"}
+	]}]
+}`
+
+func TestProxyScrubsResponses(t *testing.T) {
+	gzipped := false
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		if !gzipped {
+			_, _ = rw.Write([]byte(scrubbedJob))
+			return
+		}
+		rw.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(rw)
+		_, _ = gz.Write([]byte(scrubbedJob))
+		_ = gz.Close()
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	scrubbing := buildResponseScrubbing(&config.Config{ResponseScrubbing: &config.ResponseScrubbing{Rules: []*config.ScrubRule{
+		{Name: "secrets", Paths: []string{"/v1/job/*"}, Fields: []string{"Meta.*_secret", "TaskGroups.*.Tasks.*.Vault"}, Action: config.ScrubActionRemove},
+		{Name: "env", Paths: []string{"/v1/job/*"}, Fields: []string{"TaskGroups.*.Tasks.*.Env.*_TOKEN"}, Action: config.ScrubActionMask},
+	}}})
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+
+	want := `{
+		"ID": "web",
+		"JobModifyIndex": 9007199254740993,
+		"Meta": {"owner": "team-a"},
+		"TaskGroups": [{"Tasks": [
+			{"Name": "app", "Env": {"API_TOKEN": "<redacted>", "PORT": "8080"}},
+			{"Name": "sidecar"}
+		]}]
+	}`
+	tests := []struct {
+		name    string
+		gzipped bool
+		path    string
+		limit   int64
+		want    string
+		status  int
+	}{
+		{name: "job", path: "/v1/job/web", want: want, status: http.StatusOK},
+		{name: "gzipped job", gzipped: true, path: "/v1/job/web", want: want, status: http.StatusOK},
+		{name: "other path", path: "/v1/job/web/versions", want: scrubbedJob, status: http.StatusOK},
+		{name: "too large to scrub", path: "/v1/job/web", limit: 16, status: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gzipped = tt.gzipped
+			opts := []ProxyOption{WithResponseScrubbing(scrubbing)}
+			if tt.limit > 0 {
+				opts = append(opts, WithMaxResponseSize(tt.limit))
+			}
+			proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, opts...)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.gzipped {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			rr := httptest.NewRecorder()
+			proxy(rr, req)
+			require.Equal(t, tt.status, rr.Code)
+			if tt.status != http.StatusOK {
+				assert.NotContains(t, rr.Body.String(), "hunter2")
+				return
+			}
+			var body io.Reader = rr.Body
+			if tt.gzipped {
+				body, err = gzip.NewReader(bytes.NewReader(rr.Body.Bytes()))
+				require.NoError(t, err)
+			}
+			got, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+			assert.Contains(t, string(got), "9007199254740993")
+		})
+	}
+}
+
+func TestProxyScrubbingPassesThroughOtherResponses(t *testing.T) {
+	nomadDummy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v1/event/stream" {
+			rw.Header().Set("Content-Type", "application/json")
+			_, _ = rw.Write([]byte("{\"Index\": 1, \"Events\": [{\"Payload\": {\"db_secret\": \"hunter2\"}}]}\n"))
+			rw.(http.Flusher).Flush()
+			_, _ = rw.Write([]byte("{}\n"))
+			return
+		}
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = rw.Write([]byte("<html>nomad</html>"))
+	}))
+	defer nomadDummy.Close()
+	nomad, err := url.Parse(nomadDummy.URL)
+	require.NoError(t, err)
+
+	scrubbing := buildResponseScrubbing(&config.Config{ResponseScrubbing: &config.ResponseScrubbing{Rules: []*config.ScrubRule{
+		{Name: "all", Fields: []string{"*.*.Payload.db_secret"}, Action: config.ScrubActionRemove},
+	}}})
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(nomad, jobHandler, hclog.NewNullLogger(), nil, WithResponseScrubbing(scrubbing), WithMaxResponseSize(16))
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "ui", path: "/ui/jobs", want: "<html>nomad</html>"},
+		{name: "event stream", path: "/v1/event/stream", want: "{\"Index\": 1, \"Events\": [{\"Payload\": {\"db_secret\": \"hunter2\"}}]}\n{}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			proxy(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.want, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// defaultConfigPath is empty, without a config file NACP starts with the default config.
+func defaultConfigPath() string {
+	return ""
+}
+
+func isWindowsService() bool {
+	return false
+}
+
+func logOutput() (io.Writer, error) {
+	return os.Stdout, nil
+}
+
+func runWindowsService(run func(stop <-chan struct{}) error) error {
+	return run(nil)
+}
+
+func runServiceCommand(_ []string, _ io.Writer) error {
+	return errors.New("services can only be managed on windows, use the init system instead, e.g. systemd")
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceCommandNotSupported(t *testing.T) {
+	var out bytes.Buffer
+	err := runServiceCommand([]string{"install"}, &out)
+	assert.ErrorContains(t, err, "only be managed on windows")
+	assert.Empty(t, out.String())
+}
+
+func TestRunWithoutWindowsService(t *testing.T) {
+	assert.False(t, isWindowsService())
+	assert.Empty(t, defaultConfigPath())
+
+	called := false
+	require.NoError(t, runWindowsService(func(stop <-chan struct{}) error {
+		called = true
+		assert.Nil(t, stop)
+		return nil
+	}))
+	assert.True(t, called)
+}
@@ -0,0 +1,152 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName        = "nacp"
+	serviceDisplayName = "Nomad Admission Control Proxy"
+)
+
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return `C:\ProgramData`
+}
+
+func defaultConfigPath() string {
+	return filepath.Join(programData(), "nacp", "nacp.hcl")
+}
+
+func defaultLogPath() string {
+	return filepath.Join(programData(), "nacp", "nacp.log")
+}
+
+func isWindowsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// logOutput is stdout, unless NACP runs as service, which has no console to write to.
+func logOutput() (io.Writer, error) {
+	if !isWindowsService() {
+		return os.Stdout, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(defaultLogPath()), 0o750); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(defaultLogPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+}
+
+// windowsService runs NACP under the service control manager, stop and shutdown requests drain the server.
+type windowsService struct {
+	run func(stop <-chan struct{}) error
+}
+
+func (s *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.run(stop)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-errs:
+			return serviceExitCode(err)
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				close(stop)
+				return serviceExitCode(<-errs)
+			}
+		}
+	}
+}
+
+func serviceExitCode(err error) (bool, uint32) {
+	if err != nil {
+		return true, 1
+	}
+	return false, 0
+}
+
+func runWindowsService(run func(stop <-chan struct{}) error) error {
+	return svc.Run(serviceName, &windowsService{run: run})
+}
+
+// runServiceCommand manages the windows service: nacp service install|uninstall|start|stop [-config file]
+func runServiceCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("service", flag.ContinueOnError)
+	configFile := flags.String("config", defaultConfigPath(), "config file the service runs with")
+	if len(args) == 0 {
+		return errors.New("usage: nacp service install|uninstall|start|stop [-config file]")
+	}
+	command := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if command == "install" {
+		executable, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		s, err := m.CreateService(serviceName, executable, mgr.Config{
+			DisplayName: serviceDisplayName,
+			Description: "Enforces admission rules on jobs submitted to Nomad",
+			StartType:   mgr.StartAutomatic,
+		}, "-config", *configFile)
+		if err != nil {
+			return fmt.Errorf("failed to install service: %w", err)
+		}
+		defer s.Close()
+		fmt.Fprintf(stdout, "Installed service %s with config %s\n", serviceName, *configFile)
+		return nil
+	}
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	switch command {
+	case "uninstall":
+		err = s.Delete()
+	case "start":
+		err = s.Start()
+	case "stop":
+		_, err = s.Control(svc.Stop)
+	default:
+		return fmt.Errorf("unknown service command %q", command)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s service: %w", command, err)
+	}
+	fmt.Fprintf(stdout, "Service %s: %s\n", serviceName, command)
+	return nil
+}
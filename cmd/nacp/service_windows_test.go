@@ -0,0 +1,61 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/windows/svc"
+)
+
+func TestWindowsServiceStops(t *testing.T) {
+	tt := []struct {
+		name     string
+		cmd      svc.Cmd
+		err      error
+		wantCode uint32
+	}{
+		{name: "stop", cmd: svc.Stop, wantCode: 0},
+		{name: "shutdown", cmd: svc.Shutdown, wantCode: 0},
+		{name: "failed drain", cmd: svc.Stop, err: errors.New("boom"), wantCode: 1},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			service := &windowsService{run: func(stop <-chan struct{}) error {
+				<-stop
+				return tc.err
+			}}
+			requests := make(chan svc.ChangeRequest, 1)
+			status := make(chan svc.Status, 10)
+			requests <- svc.ChangeRequest{Cmd: tc.cmd}
+
+			_, code := service.Execute(nil, requests, status)
+			assert.Equal(t, tc.wantCode, code)
+
+			var states []svc.State
+			close(status)
+			for s := range status {
+				states = append(states, s.State)
+			}
+			assert.Equal(t, []svc.State{svc.StartPending, svc.Running, svc.StopPending}, states)
+		})
+	}
+}
+
+func TestWindowsServiceFails(t *testing.T) {
+	service := &windowsService{run: func(_ <-chan struct{}) error {
+		return errors.New("failed to listen")
+	}}
+	status := make(chan svc.Status, 10)
+	hasCode, code := service.Execute(nil, make(chan svc.ChangeRequest), status)
+	assert.True(t, hasCode)
+	assert.Equal(t, uint32(1), code)
+}
+
+func TestDefaultPaths(t *testing.T) {
+	t.Setenv("ProgramData", `D:\Data`)
+	assert.Equal(t, `D:\Data\nacp\nacp.hcl`, defaultConfigPath())
+	assert.Equal(t, `D:\Data\nacp\nacp.log`, defaultLogPath())
+}
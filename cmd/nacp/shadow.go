@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/opa"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/pkg/admission"
+)
+
+// buildShadowRules builds the candidate rules of the shadow config, all other settings are taken from the main config.
+func buildShadowRules(c *config.Config, logger hclog.Logger, opaOptions ...opa.Option) ([]admissionctrl.JobMutator, []admissionctrl.JobValidator, bool, error) {
+	shadowConfig, err := config.LoadConfig(c.Shadow.Config)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to load shadow config: %w", err)
+	}
+	candidate := *c
+	candidate.Mutators = shadowConfig.Mutators
+	candidate.Validators = shadowConfig.Validators
+	mutators, validators, resolveToken, err := admission.BuildRules(&candidate, logger, opaOptions...)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to build shadow rules: %w", err)
+	}
+	return mutators, validators, resolveToken, nil
+}
+
+func buildShadow(c *config.Config, logger hclog.Logger, data admissionctrl.DataProvider, opaOptions ...opa.Option) (*admissionctrl.Shadow, error) {
+	mutators, validators, resolveToken, err := buildShadowRules(c, logger, opaOptions...)
+	if err != nil {
+		return nil, err
+	}
+	candidate := admissionctrl.NewJobHandler(mutators, validators, logger.Named("handler"), resolveToken)
+	if data != nil {
+		candidate.UseDataSources(data)
+	}
+	return admissionctrl.NewShadow(candidate, c.Shadow.MaxMismatches, logger), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/leader"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowRules(t *testing.T) {
+	dir := t.TempDir()
+	shadowConfig := filepath.Join(dir, "candidate.hcl")
+	require.NoError(t, os.WriteFile(shadowConfig, []byte(fmt.Sprintf(`
+validator "opa" "errors" {
+  opa_rule {
+    query = "errors = data.dummy.errors"
+    filename = "%s"
+  }
+}
+`, testutil.Filepath(t, "opa/errors.rego"))), 0644))
+	configFile := filepath.Join(dir, "nacp.hcl")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(`
+shadow {
+  config = "%s"
+}
+`, shadowConfig)), 0644))
+
+	c, err := config.LoadConfig(configFile)
+	require.NoError(t, err)
+	shadow, err := buildShadow(c, hclog.NewNullLogger(), nil)
+	require.NoError(t, err)
+
+	handler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	handler.UseShadow(shadow)
+	_, _, err = handler.ApplyAdmissionControllers(&types.Payload{Job: testutil.ReadJob(t, "job.json")})
+	require.NoError(t, err, "candidate rules are not enforced")
+	shadow.Wait()
+
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: dedicatedAdmin, shadow: shadow}
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/v1/nacp/shadow")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	report := admissionctrl.ShadowReport{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(t, int64(1), report.Mismatched)
+	require.Len(t, report.Mismatches, 1)
+	assert.Equal(t, []string{"This is a error message (errors)"}, report.Mismatches[0].Candidate.Errors)
+
+	// reloading an empty candidate config resets the report and drops the candidate rules
+	require.NoError(t, os.WriteFile(shadowConfig, []byte(""), 0644))
+	reloader := newPolicyReloader(configFile, "", handler, &rulesetStatus{}, hclog.NewNullLogger())
+	reloader.shadow = shadow
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, int64(0), shadow.Report().Evaluated)
+
+	_, _, err = handler.ApplyAdmissionControllers(&types.Payload{Job: testutil.ReadJob(t, "job.json")})
+	require.NoError(t, err)
+	shadow.Wait()
+	assert.Equal(t, int64(1), shadow.Report().Matched)
+
+	req, err := http.NewRequest("DELETE", server.URL+"/v1/nacp/shadow", nil)
+	require.NoError(t, err)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, int64(0), shadow.Report().Evaluated)
+}
+
+func TestShadowRulesInvalidConfig(t *testing.T) {
+	c := config.DefaultConfig()
+	c.Shadow = &config.Shadow{Config: "/does/not/exist.hcl"}
+	_, err := buildShadow(c, hclog.NewNullLogger(), nil)
+	assert.ErrorContains(t, err, "failed to load shadow config")
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/discovery"
+)
+
+// applySidecar replaces the nomad address with the discovered local agent.
+func applySidecar(c *config.Config, logger hclog.Logger) error {
+	if c.Sidecar == nil {
+		return nil
+	}
+	address, err := discovery.NomadAddress(discovery.NomadOptions{ConfigDir: c.Sidecar.NomadConfigDir})
+	if err != nil {
+		return fmt.Errorf("failed to discover local nomad agent: %w", err)
+	}
+	logger.Info("Discovered local nomad agent", "address", address)
+	c.Nomad.Address = address
+	return nil
+}
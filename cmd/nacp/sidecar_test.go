@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplySidecar(t *testing.T) {
+	t.Setenv("NOMAD_SECRETS_DIR", "")
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nomad.hcl"), []byte(`ports { http = 5656 }`), 0o600))
+
+	c := config.DefaultConfig()
+	require.NoError(t, applySidecar(c, hclog.NewNullLogger()))
+	assert.Equal(t, "http://localhost:4646", c.Nomad.Address, "no sidecar block, nothing changes")
+
+	c.Sidecar = &config.Sidecar{NomadConfigDir: dir}
+	require.NoError(t, applySidecar(c, hclog.NewNullLogger()))
+	assert.Equal(t, "http://127.0.0.1:5656", c.Nomad.Address)
+}
+
+func TestProxyToUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "nacp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "api.sock")
+
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	nomadDummy := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte("via socket " + req.URL.Path))
+	}))
+	nomadDummy.Listener = l
+	nomadDummy.Start()
+	defer nomadDummy.Close()
+
+	c := config.DefaultConfig()
+	c.Nomad.Address = "unix://" + socket
+	nacp, err := buildServer(c, hclog.NewNullLogger())
+	require.NoError(t, err)
+	proxyServer := httptest.NewServer(nacp.server.Handler)
+	defer proxyServer.Close()
+
+	res, err := http.Get(proxyServer.URL + "/v1/jobs")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "via socket /v1/jobs", string(body))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/audit"
+	"github.com/mxab/nacp/config"
+)
+
+// buildSIEM creates the exporter of the siem block, it is nil if the block is missing.
+func buildSIEM(c *config.Config, logger hclog.Logger) (*audit.Exporter, error) {
+	if c.SIEM == nil {
+		return nil, nil
+	}
+	var tlsConfig *tls.Config
+	if c.SIEM.TLS != nil {
+		var err error
+		tlsConfig, err = buildClientTLS(c.SIEM.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create siem tls config: %w", err)
+		}
+	} else {
+		logger.Warn("SIEM export has no tls block, decisions are sent unencrypted", "address", c.SIEM.Address)
+	}
+	format := audit.FormatCEF
+	if c.SIEM.Format == config.SIEMFormatLEEF {
+		format = audit.FormatLEEF
+	}
+	writer := audit.NewSyslogWriter(c.SIEM.Address, tlsConfig, config.SyslogFacilities[c.SIEM.Facility], format, currentBuild().Version)
+	return audit.NewExporter("siem", writer, c.SIEM.Decisions, c.SIEM.BufferSize, logger), nil
+}
+
+func buildClientTLS(t *config.ClientTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		ServerName:         t.ServerName,
+	}
+	if t.CaFile != "" {
+		caCert, err := os.ReadFile(t.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSIEM(t *testing.T) {
+	tests := []struct {
+		name    string
+		siem    *config.SIEM
+		want    bool
+		wantErr string
+	}{
+		{name: "no siem block"},
+		{
+			name: "tcp",
+			siem: &config.SIEM{Format: "leef", Address: "localhost:514", Facility: "local0", BufferSize: 10},
+			want: true,
+		},
+		{
+			name: "tls with system roots",
+			siem: &config.SIEM{Format: "cef", Address: "localhost:6514", Facility: "local0", BufferSize: 10, TLS: &config.ClientTLS{ServerName: "siem"}},
+			want: true,
+		},
+		{
+			name:    "missing ca file",
+			siem:    &config.SIEM{Format: "cef", Address: "localhost:6514", Facility: "local0", BufferSize: 10, TLS: &config.ClientTLS{CaFile: "does-not-exist.pem"}},
+			wantErr: "failed to create siem tls config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter, err := buildSIEM(&config.Config{SIEM: tt.siem}, hclog.NewNullLogger())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, exporter != nil)
+		})
+	}
+}
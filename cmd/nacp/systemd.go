@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/hashicorp/go-hclog"
+)
+
+// systemdListener returns the socket passed by systemd socket activation, nil if NACP was not socket activated.
+func systemdListener(appLogger hclog.Logger) (net.Listener, error) {
+	listeners, err := activation.Listeners()
+	if err != nil {
+		return nil, fmt.Errorf("failed to use systemd sockets: %w", err)
+	}
+	var l net.Listener
+	for _, candidate := range listeners {
+		if candidate == nil {
+			// not a stream socket
+			continue
+		}
+		if l != nil {
+			appLogger.Warn("More than one socket passed by systemd, only the first is used", "ignored", candidate.Addr().String())
+			_ = candidate.Close()
+			continue
+		}
+		l = candidate
+	}
+	return l, nil
+}
+
+// notify sends a state to systemd, it is a no-op unless NACP runs as a systemd service with Type=notify.
+func notify(appLogger hclog.Logger, state string) {
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		appLogger.Warn("Failed to notify systemd", "state", state, "error", err)
+	}
+}
+
+// watchdog pings the systemd watchdog at half its interval, it returns immediately if the watchdog is not enabled.
+func watchdog(ctx context.Context, appLogger hclog.Logger) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		appLogger.Warn("Failed to read systemd watchdog settings", "error", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			notify(appLogger, daemon.SdNotifyWatchdog)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifySocket listens like systemd for sd_notify messages
+func notifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+	// unix socket paths are limited in length, t.TempDir() can be too long
+	dir, err := os.MkdirTemp("", "nacp")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func readNotification(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := notifySocket(t)
+
+	notify(hclog.NewNullLogger(), daemon.SdNotifyReady)
+	assert.Equal(t, "READY=1", readNotification(t, conn))
+}
+
+func TestNotifyWithoutSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	// must not fail or block
+	notify(hclog.NewNullLogger(), daemon.SdNotifyReady)
+}
+
+func TestWatchdog(t *testing.T) {
+	conn := notifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchdog(ctx, hclog.NewNullLogger())
+
+	assert.Equal(t, "WATCHDOG=1", readNotification(t, conn))
+}
+
+func TestWatchdogDisabled(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	done := make(chan struct{})
+	go func() {
+		watchdog(context.Background(), hclog.NewNullLogger())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watchdog should return if it is not enabled")
+	}
+}
+
+// systemdChildEnv turns the test binary into a socket activated process for TestListenSystemdSocket
+const systemdChildEnv = "NACP_TEST_SYSTEMD_CHILD"
+
+func runSystemdChild() {
+	// systemd sets the pid of the activated process, the parent can't know it in advance
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	l, err := listen(config.DefaultConfig(), "127.0.0.1:0", hclog.NewNullLogger())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print(l.Addr().String())
+}
+
+func TestListenSystemdSocket(t *testing.T) {
+	socket, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer socket.Close()
+	f, err := socket.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer f.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), systemdChildEnv+"=1")
+	// systemd passes sockets starting at fd 3
+	cmd.ExtraFiles = []*os.File{f}
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, socket.Addr().String(), string(out))
+}
+
+func TestListenWithoutSystemd(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "")
+	l, err := systemdListener(hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Nil(t, l)
+}
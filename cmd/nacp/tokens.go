@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+)
+
+// maxCachedTokens is the size from which expired tokens are pruned on every store.
+const maxCachedTokens = 1024
+
+// nomadGetter decodes a GET of the Nomad API into v with the token of the request, it reports false for unknown objects.
+type nomadGetter func(path string, v interface{}) (bool, error)
+
+type cachedToken struct {
+	token *api.ACLToken
+	// policies are the names of the policies of the token and its roles, only set if policies are resolved
+	policies []string
+	expires  time.Time
+}
+
+type cachedPolicy struct {
+	rules   string
+	expires time.Time
+}
+
+// tokenCache caches the token self lookups and optionally the ACL policies of the tokens including their rules.
+// Tokens and policies expire after the ttl, the roles of a token are only resolved again if its modify index changed.
+type tokenCache struct {
+	ttl             time.Duration
+	resolvePolicies bool
+	now             func() time.Time
+
+	mu       sync.Mutex
+	tokens   map[string]cachedToken
+	policies map[string]cachedPolicy
+}
+
+func newTokenCache(ttl time.Duration, resolvePolicies bool) *tokenCache {
+	return &tokenCache{
+		ttl:             ttl,
+		resolvePolicies: resolvePolicies,
+		now:             time.Now,
+		tokens:          make(map[string]cachedToken),
+		policies:        make(map[string]cachedPolicy),
+	}
+}
+
+// buildTokenCache creates the cache of the token_cache block, it is nil if the block is missing.
+func buildTokenCache(c *config.Config) (*tokenCache, error) {
+	if c.TokenCache == nil {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(c.TokenCache.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token_cache ttl: %w", err)
+	}
+	return newTokenCache(ttl, c.TokenCache.ResolvePolicies), nil
+}
+
+// resolve returns the token of the secret and, if policies are resolved, the rules of its policies by name.
+// The token is returned even if its policies can't be resolved.
+func (c *tokenCache) resolve(get nomadGetter, secret string) (*api.ACLToken, map[string]string, error) {
+	sum := sha256.Sum256([]byte(secret))
+	key := hex.EncodeToString(sum[:])
+	now := c.now()
+
+	c.mu.Lock()
+	entry, cached := c.tokens[key]
+	c.mu.Unlock()
+
+	if !cached || !now.Before(entry.expires) {
+		token := &api.ACLToken{}
+		found, err := get("/v1/acl/token/self", token)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("token not found")
+		}
+		policies := entry.policies
+		if c.resolvePolicies && (!cached || entry.token.ModifyIndex != token.ModifyIndex) {
+			policies, err = c.policyNames(get, token)
+			if err != nil {
+				return token, nil, err
+			}
+		}
+		entry = cachedToken{token: token, policies: policies, expires: now.Add(c.ttl)}
+		c.storeToken(key, entry, now)
+	}
+	if !c.resolvePolicies {
+		return entry.token, nil, nil
+	}
+	rules, err := c.rules(get, entry.policies, now)
+	return entry.token, rules, err
+}
+
+// policyNames returns the names of the policies of the token and its roles.
+func (c *tokenCache) policyNames(get nomadGetter, token *api.ACLToken) ([]string, error) {
+	names := slices.Clone(token.Policies)
+	for _, link := range token.Roles {
+		role := &api.ACLRole{}
+		found, err := get("/v1/acl/role/"+link.ID, role)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read role %s: %w", link.Name, err)
+		}
+		if !found {
+			continue
+		}
+		for _, policy := range role.Policies {
+			names = append(names, policy.Name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+func (c *tokenCache) rules(get nomadGetter, names []string, now time.Time) (map[string]string, error) {
+	rules := make(map[string]string, len(names))
+	for _, name := range names {
+		c.mu.Lock()
+		cached, ok := c.policies[name]
+		c.mu.Unlock()
+		if ok && now.Before(cached.expires) {
+			rules[name] = cached.rules
+			continue
+		}
+		policy := &api.ACLPolicy{}
+		found, err := get("/v1/acl/policy/"+name, policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy %s: %w", name, err)
+		}
+		if !found {
+			// deleted policies grant nothing
+			continue
+		}
+		c.mu.Lock()
+		c.policies[name] = cachedPolicy{rules: policy.Rules, expires: now.Add(c.ttl)}
+		c.mu.Unlock()
+		rules[name] = policy.Rules
+	}
+	return rules, nil
+}
+
+func (c *tokenCache) storeToken(key string, entry cachedToken, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.tokens) >= maxCachedTokens {
+		for k, e := range c.tokens {
+			if !now.Before(e.expires) {
+				delete(c.tokens, k)
+			}
+		}
+	}
+	c.tokens[key] = entry
+}
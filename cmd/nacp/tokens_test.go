@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeACL serves the ACL objects by path and counts the requests.
+type fakeACL struct {
+	objects map[string]interface{}
+	calls   map[string]int
+}
+
+func (f *fakeACL) get(path string, v interface{}) (bool, error) {
+	f.calls[path]++
+	object, ok := f.objects[path]
+	if !ok {
+		return false, nil
+	}
+	switch target := v.(type) {
+	case *api.ACLToken:
+		*target = *object.(*api.ACLToken)
+	case *api.ACLRole:
+		*target = *object.(*api.ACLRole)
+	case *api.ACLPolicy:
+		*target = *object.(*api.ACLPolicy)
+	}
+	return true, nil
+}
+
+func newFakeACL() *fakeACL {
+	return &fakeACL{
+		objects: map[string]interface{}{
+			"/v1/acl/token/self": &api.ACLToken{
+				AccessorID:  "accessor",
+				Policies:    []string{"dev"},
+				Roles:       []*api.ACLTokenRoleLink{{ID: "role-id", Name: "ops"}},
+				ModifyIndex: 1,
+			},
+			"/v1/acl/role/role-id": &api.ACLRole{
+				Policies: []*api.ACLRolePolicyLink{{Name: "ops"}, {Name: "dev"}},
+			},
+			"/v1/acl/policy/dev": &api.ACLPolicy{Name: "dev", Rules: `namespace "dev" { policy = "write" }`},
+			"/v1/acl/policy/ops": &api.ACLPolicy{Name: "ops", Rules: `node { policy = "write" }`},
+		},
+		calls: map[string]int{},
+	}
+}
+
+func TestTokenCache_Resolve(t *testing.T) {
+	acl := newFakeACL()
+	now := time.Unix(0, 0)
+	cache := newTokenCache(time.Minute, true)
+	cache.now = func() time.Time { return now }
+
+	token, rules, err := cache.resolve(acl.get, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "accessor", token.AccessorID)
+	assert.Equal(t, map[string]string{
+		"dev": `namespace "dev" { policy = "write" }`,
+		"ops": `node { policy = "write" }`,
+	}, rules)
+
+	// cached
+	_, _, err = cache.resolve(acl.get, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, 1, acl.calls["/v1/acl/token/self"])
+	assert.Equal(t, 1, acl.calls["/v1/acl/role/role-id"])
+	assert.Equal(t, 1, acl.calls["/v1/acl/policy/dev"])
+
+	// expired but unchanged token, the roles are not resolved again
+	now = now.Add(2 * time.Minute)
+	_, _, err = cache.resolve(acl.get, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, 2, acl.calls["/v1/acl/token/self"])
+	assert.Equal(t, 1, acl.calls["/v1/acl/role/role-id"])
+	assert.Equal(t, 2, acl.calls["/v1/acl/policy/dev"])
+
+	// modified token
+	acl.objects["/v1/acl/token/self"] = &api.ACLToken{AccessorID: "accessor", Policies: []string{"dev"}, ModifyIndex: 2}
+	now = now.Add(2 * time.Minute)
+	_, rules, err = cache.resolve(acl.get, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"dev": `namespace "dev" { policy = "write" }`}, rules)
+}
+
+func TestTokenCache_ResolveWithoutPolicies(t *testing.T) {
+	acl := newFakeACL()
+	cache := newTokenCache(time.Minute, false)
+
+	token, rules, err := cache.resolve(acl.get, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "accessor", token.AccessorID)
+	assert.Nil(t, rules)
+	assert.Zero(t, acl.calls["/v1/acl/role/role-id"])
+	assert.Zero(t, acl.calls["/v1/acl/policy/dev"])
+}
+
+func TestTokenCache_ResolveUnknownToken(t *testing.T) {
+	acl := &fakeACL{objects: map[string]interface{}{}, calls: map[string]int{}}
+	cache := newTokenCache(time.Minute, true)
+
+	token, _, err := cache.resolve(acl.get, "secret")
+	assert.EqualError(t, err, "token not found")
+	assert.Nil(t, token)
+}
+
+func TestBuildTokenCache(t *testing.T) {
+	cache, err := buildTokenCache(&config.Config{})
+	require.NoError(t, err)
+	assert.Nil(t, cache)
+
+	cache, err = buildTokenCache(&config.Config{TokenCache: &config.TokenCache{TTL: "1m", ResolvePolicies: true}})
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, cache.ttl)
+	assert.True(t, cache.resolvePolicies)
+}
+
+func TestProxyOptions_ResolveTokenWithCache(t *testing.T) {
+	calls := 0
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "/v1/acl/token/self", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Nomad-Token"))
+		w.Write([]byte(`{"AccessorID":"accessor","Policies":["dev"]}`))
+	}))
+	defer nomad.Close()
+	nomadURL, _ := url.Parse(nomad.URL)
+
+	options := &proxyOptions{}
+	WithTokenCache(newTokenCache(time.Minute, false))(options)
+	for i := 0; i < 2; i++ {
+		token, _, err := options.resolveToken(nil, nomadURL, "secret")
+		require.NoError(t, err)
+		assert.Equal(t, "accessor", token.AccessorID)
+	}
+	assert.Equal(t, 1, calls)
+
+	token, _, err := options.resolveToken(nil, nomadURL, "")
+	require.NoError(t, err)
+	assert.Nil(t, token)
+}
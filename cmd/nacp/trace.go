@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+)
+
+// decodePayload reads a job, a job register request or a payload with job and context.
+func decodePayload(data []byte) (*types.Payload, error) {
+	// the job field of payloads and register requests is matched case insensitive
+	payload := &types.Payload{}
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, err
+	}
+	if payload.Job == nil {
+		payload.Job = &api.Job{}
+		if err := json.Unmarshal(data, payload.Job); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+func registerTraceEndpoint(mux *http.ServeMux, handler *admissionctrl.JobHandler, appLogger hclog.Logger) {
+	mux.HandleFunc("POST "+adminPathPrefix+"trace/{kind}/{rule}", func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		payload, err := decodePayload(data)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid job: %v", err), http.StatusBadRequest)
+			return
+		}
+		trace, err := handler.Trace(r.PathValue("kind"), r.PathValue("rule"), payload)
+		switch {
+		case errors.Is(err, admissionctrl.ErrUnknownRule):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, admissionctrl.ErrNotTraceable):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			appLogger.Info("Traced rule", "kind", r.PathValue("kind"), "rule", trace.Rule, "remote", r.RemoteAddr)
+			writeJson(w, http.StatusOK, trace, appLogger)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/leader"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminTrace(t *testing.T) {
+	opaValidator, err := validator.NewOpaValidator("errors", testutil.Filepath(t, "opa/errors.rego"), "errors = data.dummy.errors", hclog.NewNullLogger(), nil)
+	require.NoError(t, err)
+	handler := admissionctrl.NewJobHandler(nil, []admissionctrl.JobValidator{opaValidator, new(testutil.MockValidator)}, hclog.NewNullLogger(), false)
+	nacp := &nacpServer{handler: handler, status: &rulesetStatus{}, elector: leader.Static{}, admin: dedicatedAdmin}
+
+	disabled := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer disabled.Close()
+	res, err := http.Post(disabled.URL+"/v1/nacp/trace/validator/errors", "application/json", strings.NewReader(`{"ID": "app"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode, "endpoint only exists if policy tracing is enabled")
+
+	nacp.policyTrace = true
+	server := httptest.NewServer(NewAdminHandler(nacp, hclog.NewNullLogger()))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "job", path: "validator/errors", body: `{"ID": "app"}`, wantStatus: http.StatusOK},
+		{name: "payload", path: "validator/errors", body: `{"job": {"ID": "app"}, "context": {"clientIP": "127.0.0.1"}}`, wantStatus: http.StatusOK},
+		{name: "invalid job", path: "validator/errors", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "unknown rule", path: "mutator/errors", body: `{"ID": "app"}`, wantStatus: http.StatusNotFound},
+		{name: "no opa rule", path: "validator/mock-validator", body: `{"ID": "app"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Post(server.URL+"/v1/nacp/trace/"+tt.path, "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			trace := &types.Trace{}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(trace))
+			assert.Equal(t, "errors", trace.Rule)
+			assert.Equal(t, []interface{}{"This is a error message"}, trace.Result["errors"])
+			assert.NotEmpty(t, trace.Events)
+		})
+	}
+}
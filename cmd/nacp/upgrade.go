@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+)
+
+const (
+	// upgradeEnv marks a process that was started by an upgrade, it inherits the listener and a ready pipe
+	upgradeEnv = "NACP_UPGRADE"
+	// inherited files start after stdin, stdout and stderr
+	upgradeListenerFd = 3
+	upgradeReadyFd    = 4
+
+	// upgradeStartTimeout is how long the old process waits for the new one to become ready
+	upgradeStartTimeout = 1 * time.Minute
+)
+
+var errNotUpgraded = errors.New("process was not started by an upgrade")
+
+// listen returns the listener handed over by the previous process or systemd, or binds a new one.
+func listen(c *config.Config, bind string, appLogger hclog.Logger) (net.Listener, error) {
+	l, err := inheritedListener()
+	if err == nil {
+		appLogger.Info("Using listener of the previous process", "address", l.Addr().String())
+		return l, nil
+	}
+	if !errors.Is(err, errNotUpgraded) {
+		return nil, err
+	}
+
+	l, err = systemdListener(appLogger)
+	if err != nil {
+		return nil, err
+	}
+	if l != nil {
+		appLogger.Info("Using socket passed by systemd", "address", l.Addr().String())
+		return l, nil
+	}
+
+	lc := net.ListenConfig{}
+	if c.Upgrade != nil && c.Upgrade.ReusePort {
+		lc.Control = reusePort
+	}
+	return lc.Listen(context.Background(), "tcp", bind)
+}
+
+func inheritedListener() (net.Listener, error) {
+	if os.Getenv(upgradeEnv) == "" {
+		return nil, errNotUpgraded
+	}
+	f := os.NewFile(upgradeListenerFd, "listener")
+	if f == nil {
+		return nil, fmt.Errorf("inherited listener fd %d is not valid", upgradeListenerFd)
+	}
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use inherited listener: %w", err)
+	}
+	return l, nil
+}
+
+// signalReady tells the previous process that this one is serving, so it can start draining.
+func signalReady() error {
+	if os.Getenv(upgradeEnv) == "" {
+		return nil
+	}
+	f := os.NewFile(upgradeReadyFd, "ready")
+	if f == nil {
+		return fmt.Errorf("inherited ready fd %d is not valid", upgradeReadyFd)
+	}
+	defer f.Close()
+	_, err := f.Write([]byte{1})
+	return err
+}
+
+// startUpgrade starts the current executable with the same arguments and hands over the listener.
+// It returns the pid of the new process once it is ready, or an error if it failed to start, the old process keeps serving then.
+func startUpgrade(l net.Listener, appLogger hclog.Logger) (int, error) {
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return 0, fmt.Errorf("listener %T can't be handed over", l)
+	}
+	lf, err := fl.File()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get listener file: %w", err)
+	}
+	defer lf.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), upgradeEnv+"=1")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{lf, readyW}
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start new process: %w", err)
+	}
+	appLogger.Info("Started new process, waiting for it to become ready", "pid", cmd.Process.Pid)
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		if errors.Is(err, io.EOF) {
+			err = errors.New("new process exited before it was ready")
+		}
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(upgradeStartTimeout):
+		err = fmt.Errorf("new process was not ready after %s", upgradeStartTimeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	// the new process is not our child anymore in terms of lifecycle
+	return pid, cmd.Process.Release()
+}
+
+// drain stops accepting connections and waits for in-flight requests.
+func drain(server *http.Server, timeout time.Duration, appLogger hclog.Logger) error {
+	appLogger.Info("Draining in-flight requests", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+func drainTimeout(c *config.Config) time.Duration {
+	if c.Upgrade != nil && c.Upgrade.DrainTimeout != "" {
+		// validated when loading the config
+		if d, err := time.ParseDuration(c.Upgrade.DrainTimeout); err == nil {
+			return d
+		}
+	}
+	return nomadTimeout
+}
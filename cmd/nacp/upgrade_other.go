@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// watchUpgrade is a no-op, listener handoff needs unix signals and fd inheritance.
+func watchUpgrade(_ *http.Server, _ net.Listener, _ time.Duration, appLogger hclog.Logger) bool {
+	appLogger.Warn("Binary upgrades are not supported on this platform")
+	return false
+}
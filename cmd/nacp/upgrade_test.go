@@ -0,0 +1,117 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// upgradeChildEnv turns the test binary into the new process of TestStartUpgrade
+const upgradeChildEnv = "NACP_TEST_UPGRADE_CHILD"
+
+func TestMain(m *testing.M) {
+	switch {
+	case os.Getenv(upgradeChildEnv) != "":
+		runUpgradeChild()
+	case os.Getenv(systemdChildEnv) != "":
+		runSystemdChild()
+	default:
+		os.Exit(m.Run())
+	}
+}
+
+func runUpgradeChild() {
+	// never outlive the test
+	time.AfterFunc(10*time.Second, func() { os.Exit(1) })
+	l, err := inheritedListener()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if os.Getenv(upgradeChildEnv) == "fail" {
+		os.Exit(1)
+	}
+	if err := signalReady(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("new"))
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			os.Exit(0)
+		}()
+	})}
+	_ = server.Serve(l)
+}
+
+func TestStartUpgrade(t *testing.T) {
+	t.Setenv(upgradeChildEnv, "ok")
+	l, err := listen(config.DefaultConfig(), "127.0.0.1:0", hclog.NewNullLogger())
+	require.NoError(t, err)
+	defer l.Close()
+
+	pid, err := startUpgrade(l, hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.NotEqual(t, os.Getpid(), pid)
+	// stop accepting in the old process, the new one owns the socket now
+	require.NoError(t, l.Close())
+
+	res, err := http.Get("http://" + l.Addr().String())
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(body))
+}
+
+func TestStartUpgradeFailsIfNewProcessExits(t *testing.T) {
+	t.Setenv(upgradeChildEnv, "fail")
+	l, err := listen(config.DefaultConfig(), "127.0.0.1:0", hclog.NewNullLogger())
+	require.NoError(t, err)
+	defer l.Close()
+
+	_, err = startUpgrade(l, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "exited before it was ready")
+}
+
+func TestListenReusePort(t *testing.T) {
+	c := config.DefaultConfig()
+	c.Upgrade = &config.Upgrade{ReusePort: true}
+
+	first, err := listen(c, "127.0.0.1:0", hclog.NewNullLogger())
+	require.NoError(t, err)
+	defer first.Close()
+
+	second, err := listen(c, first.Addr().String(), hclog.NewNullLogger())
+	require.NoError(t, err, "second listener can bind the same port")
+	defer second.Close()
+
+	_, err = net.Listen("tcp", first.Addr().String())
+	assert.Error(t, err, "without reuse_port the port is taken")
+}
+
+func TestSignalReadyWithoutUpgrade(t *testing.T) {
+	assert.NoError(t, signalReady())
+	_, err := inheritedListener()
+	assert.ErrorIs(t, err, errNotUpgraded)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	c := config.DefaultConfig()
+	assert.Equal(t, nomadTimeout, drainTimeout(c))
+
+	c.Upgrade = &config.Upgrade{DrainTimeout: "10s"}
+	assert.Equal(t, 10*time.Second, drainTimeout(c))
+}
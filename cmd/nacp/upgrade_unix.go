@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// watchUpgrade hands the listener to a new process on SIGUSR2 and drains this one once the new process is ready.
+// It returns true after the handover.
+func watchUpgrade(server *http.Server, l net.Listener, timeout time.Duration, appLogger hclog.Logger) bool {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	for range signals {
+		appLogger.Info("Received SIGUSR2, upgrading")
+		pid, err := startUpgrade(l, appLogger)
+		if err != nil {
+			appLogger.Error("Upgrade failed, keep serving", "error", err)
+			continue
+		}
+		signal.Stop(signals)
+		// let systemd follow the new process
+		notify(appLogger, fmt.Sprintf("MAINPID=%d", pid))
+		if err := drain(server, timeout, appLogger); err != nil {
+			appLogger.Error("Failed to drain in-flight requests", "error", err)
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/discovery"
+	"github.com/mxab/nacp/pkg/admission"
+)
+
+// buildUpstream resolves the Nomad servers once, so NACP does not start without any server to proxy to.
+// It returns nil if the static address is used.
+func buildUpstream(c *config.Config, logger hclog.Logger) (*discovery.Upstream, error) {
+	if c.Nomad == nil || c.Nomad.Discovery == nil {
+		return nil, nil
+	}
+	d := c.Nomad.Discovery
+	interval, err := time.ParseDuration(d.RefreshInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refresh interval: %w", err)
+	}
+
+	var resolver discovery.Resolver
+	if d.ConsulService != "" {
+		client, err := admission.ConsulClient(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create consul client: %w", err)
+		}
+		resolver = discovery.NewConsulResolver(client.Health(), d.ConsulService, d.ConsulTag, d.Scheme)
+	} else {
+		resolver = discovery.NewSRVResolver(nil, d.SRVRecord, d.Scheme)
+	}
+
+	upstream := discovery.NewUpstream(resolver, interval, logger)
+	ctx, cancel := context.WithTimeout(context.Background(), nomadTimeout)
+	defer cancel()
+	if err := upstream.Refresh(ctx); err != nil {
+		return nil, fmt.Errorf("failed to discover nomad servers: %w", err)
+	}
+	return upstream, nil
+}
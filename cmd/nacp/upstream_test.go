@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/discovery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedResolver []*url.URL
+
+func (r fixedResolver) Resolve(_ context.Context) ([]*url.URL, error) {
+	return r, nil
+}
+
+func TestProxyBalancesOverDiscoveredServers(t *testing.T) {
+	var targets fixedResolver
+	for _, name := range []string{"first", "second"} {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			_, _ = rw.Write([]byte(name))
+		}))
+		defer server.Close()
+		target, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		targets = append(targets, target)
+	}
+	upstream := discovery.NewUpstream(targets, 0, hclog.NewNullLogger())
+	require.NoError(t, upstream.Refresh(context.Background()))
+
+	static, err := url.Parse("http://127.0.0.1:1")
+	require.NoError(t, err)
+	jobHandler := admissionctrl.NewJobHandler(nil, nil, hclog.NewNullLogger(), false)
+	proxy := NewProxyHandler(static, jobHandler, hclog.NewNullLogger(), nil, WithUpstream(upstream))
+	proxyServer := httptest.NewServer(http.HandlerFunc(proxy))
+	defer proxyServer.Close()
+
+	var answers []string
+	for i := 0; i < 4; i++ {
+		res, err := http.Get(proxyServer.URL + "/v1/jobs")
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		res.Body.Close()
+		answers = append(answers, string(body))
+	}
+	assert.Equal(t, []string{"first", "second", "first", "second"}, answers)
+}
+
+func TestBuildUpstreamWithoutDiscovery(t *testing.T) {
+	upstream, err := buildUpstream(config.DefaultConfig(), hclog.NewNullLogger())
+	require.NoError(t, err)
+	assert.Nil(t, upstream)
+}
+
+func TestBuildUpstreamFailsWithoutServers(t *testing.T) {
+	c := config.DefaultConfig()
+	c.Nomad.Discovery = &config.NomadDiscovery{
+		SRVRecord:       "_http._tcp.nomad.invalid",
+		Scheme:          "http",
+		RefreshInterval: "30s",
+	}
+	_, err := buildUpstream(c, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "failed to discover nomad servers")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/mxab/nacp/config"
+)
+
+// Set by the release build via -ldflags "-X main.version=... -X main.commit=... -X main.date=...".
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	// Features are the optional features enabled by the config, only set for a running server
+	Features []string `json:"features,omitempty"`
+}
+
+// currentBuild returns the build info, the commit falls back to the VCS info Go embeds in local builds.
+func currentBuild() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			// go install github.com/mxab/nacp/cmd/nacp@v1.2.3
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.Date == "":
+				info.Date = s.Value
+			}
+		}
+	}
+	return info
+}
+
+func (b buildInfo) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "nacp %s", b.Version)
+	if b.Commit != "" {
+		fmt.Fprintf(&sb, " (%s)", b.Commit)
+	}
+	fmt.Fprintf(&sb, "\nbuilt with %s for %s", b.GoVersion, b.Platform)
+	if b.Date != "" {
+		fmt.Fprintf(&sb, " at %s", b.Date)
+	}
+	return sb.String()
+}
+
+func printVersion(w io.Writer) {
+	fmt.Fprintln(w, currentBuild())
+}
+
+// enabledFeatures lists the optional features the config enables, in a stable order.
+func enabledFeatures(c *config.Config) []string {
+	features := []struct {
+		name    string
+		enabled bool
+	}{
+		{"tls", c.Tls != nil},
+		{"h2c", c.HTTP2 != nil && c.HTTP2.H2C},
+		{"cors", c.CORS != nil},
+		{"oidc_login", c.Auth != nil && c.Auth.OIDC != nil},
+		{"token_vending", c.TokenVending != nil},
+		{"virtual_tokens", c.VirtualTokens != nil},
+		{"identity", c.Identity != nil},
+		{"leader_election", c.LeaderElection != nil},
+		{"admission_queue", c.AdmissionQueue != nil},
+		{"fault_injection", c.FaultInjection != nil},
+		{"policy_trace", c.PolicyTrace != nil && c.PolicyTrace.Enabled},
+		{"shadow", c.Shadow != nil},
+		{"exemptions", c.Exemptions != nil},
+		{"siem", c.SIEM != nil},
+		{"event_bus", c.EventBus != nil},
+		{"decision_report", c.DecisionReport != nil},
+		{"opa_limits", c.OpaLimits != nil},
+		{"patch_policy", c.PatchPolicy != nil},
+		{"revalidation", c.Revalidation != nil},
+		{"mutator_conflicts", c.MutatorConflicts != nil},
+		{"mirror", c.Mirror != nil},
+		{"token_cache", c.TokenCache != nil},
+		{"nomad_retry", c.Nomad != nil && c.Nomad.Retry != nil},
+		{"maintenance", c.Maintenance != nil},
+		{"network_acl", c.NetworkACL != nil},
+		{"response_scrubbing", c.ResponseScrubbing != nil},
+		{"read_rules", len(c.ReadRules) > 0},
+		{"client_cert", c.ClientCert != nil},
+		{"upgrade", c.Upgrade != nil},
+		{"sidecar", c.Sidecar != nil},
+		{"consul_service", c.ConsulService != nil},
+		{"data_sources", len(c.DataSources) > 0},
+		{"upstream_discovery", c.Nomad != nil && c.Nomad.Discovery != nil},
+	}
+	var enabled []string
+	for _, f := range features {
+		if f.enabled {
+			enabled = append(enabled, f.name)
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInfoString(t *testing.T) {
+	tt := []struct {
+		name string
+		info buildInfo
+		want string
+	}{
+		{
+			name: "dev build",
+			info: buildInfo{Version: "dev", GoVersion: "go1.23.2", Platform: "linux/arm64"},
+			want: "nacp dev\nbuilt with go1.23.2 for linux/arm64",
+		},
+		{
+			name: "release build",
+			info: buildInfo{Version: "1.2.3", Commit: "abc123", Date: "2024-10-16T12:00:00Z", GoVersion: "go1.23.2", Platform: "linux/amd64"},
+			want: "nacp 1.2.3 (abc123)\nbuilt with go1.23.2 for linux/amd64 at 2024-10-16T12:00:00Z",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.info.String())
+		})
+	}
+}
+
+func TestPrintVersion(t *testing.T) {
+	out := &bytes.Buffer{}
+	printVersion(out)
+	assert.Contains(t, out.String(), "nacp "+version)
+	assert.Contains(t, out.String(), runtime.GOOS+"/"+runtime.GOARCH)
+}
+
+func TestEnabledFeatures(t *testing.T) {
+	c := config.DefaultConfig()
+	assert.Empty(t, enabledFeatures(c))
+
+	c.CORS = &config.CORS{AllowedOrigins: []string{"https://nomad.example.com"}}
+	c.HTTP2 = &config.HTTP2{UpstreamH2C: true}
+	c.Shadow = &config.Shadow{}
+	c.Nomad.Discovery = &config.NomadDiscovery{}
+	assert.Equal(t, []string{"cors", "shadow", "upstream_discovery"}, enabledFeatures(c))
+
+	c.HTTP2.H2C = true
+	assert.Equal(t, []string{"h2c", "cors", "shadow", "upstream_discovery"}, enabledFeatures(c))
+}
@@ -1,6 +1,17 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsimple"
 	"github.com/hashicorp/nomad/api"
@@ -9,11 +20,238 @@ import (
 type Webhook struct {
 	Endpoint string `hcl:"endpoint"`
 	Method   string `hcl:"method"`
+	// MaxResponseSize bounds the size of the response, defaults to 1MiB
+	MaxResponseSize int64 `hcl:"max_response_size,optional"`
 }
 type OpaRule struct {
 	Query    string                  `hcl:"query"`
 	Filename string                  `hcl:"filename"`
 	Notation *NotationVerifierConfig `hcl:"notation,block"`
+	// PartialEvaluation evaluates the input independent parts of the policy once when it is loaded
+	PartialEvaluation bool `hcl:"partial_evaluation,optional"`
+}
+
+// Selector selects jobs for the built-in rules, empty fields match every job.
+type Selector struct {
+	Namespaces []string `hcl:"namespaces,optional"`
+	// JobIDs are glob patterns, e.g. consul-*
+	JobIDs []string          `hcl:"job_ids,optional"`
+	Meta   map[string]string `hcl:"meta,optional"`
+}
+
+// Jobs limits a rule to a subset of the jobs, patterns match the job ID or name and exclusions win over inclusions.
+type Jobs struct {
+	// Include and Exclude are glob patterns, e.g. legacy-*
+	Include []string `hcl:"include,optional"`
+	Exclude []string `hcl:"exclude,optional"`
+	// IncludeRegex and ExcludeRegex are regular expressions, they are not anchored
+	IncludeRegex []string `hcl:"include_regex,optional"`
+	ExcludeRegex []string `hcl:"exclude_regex,optional"`
+}
+type ProtectedJobs struct {
+	Selector *Selector `hcl:"selector,block"`
+	// OverrideMetaKey allows changes if the submitted job carries this meta key
+	OverrideMetaKey string `hcl:"override_meta_key,optional"`
+	// OverridePolicies allows changes if the submitter's token holds one of these policies, requires resolve_token
+	OverridePolicies []string `hcl:"override_policies,optional"`
+}
+type Deregister struct {
+	// Selector selects the protected jobs
+	Selector *Selector `hcl:"selector,block"`
+	// AllowStop lets stops through, only purges are rejected
+	AllowStop bool `hcl:"allow_stop,optional"`
+	// OverridePolicies allow any stop or purge if the submitter's token holds one of them, requires resolve_token
+	OverridePolicies []string `hcl:"override_policies,optional"`
+	// ApprovalHeader allows any stop or purge if the request carries the header, it must be one of the context_headers
+	ApprovalHeader string `hcl:"approval_header,optional"`
+}
+type Disruption struct {
+	// Selector selects the jobs whose disruptions are restricted
+	Selector *Selector `hcl:"selector,block"`
+	// Operations are alloc_restart, alloc_stop, evaluate and periodic_force, defaults to all of them
+	Operations []string `hcl:"operations,optional"`
+	// OverridePolicies exempt tokens holding one of them, requires resolve_token
+	OverridePolicies []string `hcl:"override_policies,optional"`
+	// Forbid rejects the disruptions
+	Forbid bool `hcl:"forbid,optional"`
+	// MaxDisruptions per token accessor, or client IP without token, and window, e.g. 5 per 1h
+	MaxDisruptions int    `hcl:"max_disruptions,optional"`
+	Window         string `hcl:"window,optional"`
+}
+type Constraints struct {
+	// Mode is either reject (default) or warn
+	Mode string `hcl:"mode,optional"`
+	// CheckCluster compares datacenters, node pools and node classes with the nodes of the cluster
+	CheckCluster bool `hcl:"check_cluster,optional"`
+}
+type StaticPortNamespace struct {
+	Name          string   `hcl:"name,label"`
+	AllowedRanges []string `hcl:"allowed_ranges"`
+}
+type StaticPorts struct {
+	// AllowedRanges like 20000-20100 apply to all namespaces without own ranges, static ports are not restricted if empty
+	AllowedRanges []string              `hcl:"allowed_ranges,optional"`
+	Namespaces    []StaticPortNamespace `hcl:"namespace,block"`
+	// CheckAllocated warns if a static port is already allocated by another job
+	CheckAllocated bool `hcl:"check_allocated,optional"`
+}
+type Connect struct {
+	Selector *Selector `hcl:"selector,block"`
+	// Mode is either reject (default) or warn
+	Mode                string `hcl:"mode,optional"`
+	RequireSidecar      bool   `hcl:"require_sidecar,optional"`
+	ServiceNamePattern  string `hcl:"service_name_pattern,optional"`
+	ForbidExposedChecks bool   `hcl:"forbid_exposed_checks,optional"`
+	// AllowedUpstreams are glob patterns of destination names, upstreams are not restricted if unset
+	AllowedUpstreams []string `hcl:"allowed_upstreams,optional"`
+}
+type NamingNamespace struct {
+	Name          string `hcl:"name,label"`
+	ServiceName   string `hcl:"service_name,optional"`
+	Tag           string `hcl:"tag,optional"`
+	Hostname      string `hcl:"hostname,optional"`
+	DNSCompatible bool   `hcl:"dns_compatible,optional"`
+}
+type Naming struct {
+	// ServiceName, Tag and Hostname are regular expressions, the defaults for namespaces without own conventions
+	ServiceName   string `hcl:"service_name,optional"`
+	Tag           string `hcl:"tag,optional"`
+	Hostname      string `hcl:"hostname,optional"`
+	DNSCompatible bool   `hcl:"dns_compatible,optional"`
+
+	Namespaces []NamingNamespace `hcl:"namespace,block"`
+}
+type TemplatePolicy struct {
+	// DenyPatterns are regular expressions that must not match the embedded template content
+	DenyPatterns []string `hcl:"deny_patterns,optional"`
+	// AllowedVaultPrefixes restricts the paths of secret, secrets and pkiCert lookups
+	AllowedVaultPrefixes []string `hcl:"allowed_vault_prefixes,optional"`
+	// MaxSplay is the upper bound of the splay setting, e.g. 30s
+	MaxSplay           string   `hcl:"max_splay,optional"`
+	AllowedChangeModes []string `hcl:"allowed_change_modes,optional"`
+}
+type Secrets struct {
+	// Mode is either reject (default) or warn
+	Mode string `hcl:"mode,optional"`
+	// Patterns are additional named regular expressions of secret formats
+	Patterns map[string]string `hcl:"patterns,optional"`
+	// MinEntropy in bits per character, defaults to 4.5
+	MinEntropy     float64 `hcl:"min_entropy,optional"`
+	MinLength      int     `hcl:"min_length,optional"`
+	DisableEntropy bool    `hcl:"disable_entropy,optional"`
+	// AllowedKeys are glob patterns of env and meta keys that are not scanned
+	AllowedKeys []string `hcl:"allowed_keys,optional"`
+}
+type LimitsNamespace struct {
+	Name          string `hcl:"name,label"`
+	MaxTaskGroups int    `hcl:"max_task_groups,optional"`
+	MaxTasks      int    `hcl:"max_tasks,optional"`
+	MaxServices   int    `hcl:"max_services,optional"`
+	MaxBytes      int    `hcl:"max_bytes,optional"`
+}
+type Limits struct {
+	// MaxTaskGroups, MaxTasks, MaxServices and MaxBytes are the defaults for namespaces without own limits
+	MaxTaskGroups int `hcl:"max_task_groups,optional"`
+	MaxTasks      int `hcl:"max_tasks,optional"`
+	MaxServices   int `hcl:"max_services,optional"`
+	// MaxBytes is the size of the JSON encoded job
+	MaxBytes int `hcl:"max_bytes,optional"`
+
+	Namespaces []LimitsNamespace `hcl:"namespace,block"`
+}
+type Update struct {
+	Selector *Selector `hcl:"selector,block"`
+	// MinParallel and MaxParallel bound max_parallel of the update and migrate stanzas
+	MinParallel         int  `hcl:"min_parallel,optional"`
+	MaxParallel         int  `hcl:"max_parallel,optional"`
+	RequireHealthChecks bool `hcl:"require_health_checks,optional"`
+	RequireAutoRevert   bool `hcl:"require_auto_revert,optional"`
+}
+type DevicesNamespace struct {
+	Name                string   `hcl:"name,label"`
+	MaxGPUs             int      `hcl:"max_gpus,optional"`
+	RequiredConstraints []string `hcl:"required_constraints,optional"`
+}
+type Devices struct {
+	// MaxGPUs and RequiredConstraints are the defaults for namespaces without own policy
+	MaxGPUs int `hcl:"max_gpus,optional"`
+	// RequiredConstraints are device attributes every GPU request must constrain
+	RequiredConstraints []string `hcl:"required_constraints,optional"`
+
+	Namespaces []DevicesNamespace `hcl:"namespace,block"`
+}
+type PriorityBand struct {
+	Name string `hcl:"name,label"`
+	Min  int    `hcl:"min,optional"`
+	// Max of 0 means no upper bound
+	Max int `hcl:"max,optional"`
+}
+type Priority struct {
+	// Min and Max are the band for namespaces without own band
+	Min int `hcl:"min,optional"`
+	Max int `hcl:"max,optional"`
+
+	Namespaces []PriorityBand `hcl:"namespace,block"`
+	// Policies are the bands of Nomad ACL policies, they take precedence over namespaces and require resolve_token
+	Policies []PriorityBand `hcl:"policy,block"`
+}
+type Periodic struct {
+	Selector *Selector `hcl:"selector,block"`
+	// MinInterval is the shortest allowed time between two runs, e.g. 15m
+	MinInterval            string `hcl:"min_interval,optional"`
+	RequireTimeZone        bool   `hcl:"require_time_zone,optional"`
+	RequireProhibitOverlap bool   `hcl:"require_prohibit_overlap,optional"`
+}
+type VolumesNamespace struct {
+	Name           string   `hcl:"name,label"`
+	AllowedSources []string `hcl:"allowed_sources,optional"`
+	AllowedPlugins []string `hcl:"allowed_plugins,optional"`
+	ReadOnly       bool     `hcl:"read_only,optional"`
+}
+type PlacementNamespace struct {
+	Name               string   `hcl:"name,label"`
+	AllowedDatacenters []string `hcl:"allowed_datacenters,optional"`
+	AllowedNodePools   []string `hcl:"allowed_node_pools,optional"`
+}
+
+// PlacementAllowlist restricts the datacenters and node pools jobs may target, a namespace block replaces the defaults.
+type PlacementAllowlist struct {
+	// AllowedDatacenters are glob patterns of datacenters, datacenters are not restricted if unset
+	AllowedDatacenters []string `hcl:"allowed_datacenters,optional"`
+	// AllowedNodePools are glob patterns of node pools, jobs without node pool use default
+	AllowedNodePools []string `hcl:"allowed_node_pools,optional"`
+
+	Namespaces []PlacementNamespace `hcl:"namespace,block"`
+}
+type Volumes struct {
+	// AllowedSources are glob patterns of host volume names and CSI volume IDs
+	AllowedSources []string `hcl:"allowed_sources,optional"`
+	// AllowedPlugins are CSI plugin IDs, the volumes are looked up in Nomad
+	AllowedPlugins []string `hcl:"allowed_plugins,optional"`
+	// ReadOnly forbids writable volumes
+	ReadOnly bool `hcl:"read_only,optional"`
+
+	Namespaces []VolumesNamespace `hcl:"namespace,block"`
+}
+type WorkloadIdentity struct {
+	Selector *Selector `hcl:"selector,block"`
+	// AllowedAudiences restricts the aud claims of named identities
+	AllowedAudiences []string `hcl:"allowed_audiences,optional"`
+	// MaxTTL is the upper bound of the ttl of named identities, e.g. 1h
+	MaxTTL    string `hcl:"max_ttl,optional"`
+	ForbidEnv bool   `hcl:"forbid_env,optional"`
+}
+type Quota struct {
+	// Key is either namespace or token (the accessor ID, requires resolve_token)
+	Key string `hcl:"key"`
+	// Window of the limits, e.g. 1h
+	Window string `hcl:"window"`
+	// MaxRegistrations is the number of job registrations per key and window
+	MaxRegistrations int `hcl:"max_registrations,optional"`
+	// MaxBytes is the total size of the registered job definitions per key and window
+	MaxBytes int `hcl:"max_bytes,optional"`
+	// Namespaces limits the quota to the given namespaces, all namespaces if empty
+	Namespaces []string `hcl:"namespaces,optional"`
 }
 
 type Validator struct {
@@ -22,8 +260,100 @@ type Validator struct {
 	OpaRule      *OpaRule `hcl:"opa_rule,block"`
 	Webhook      *Webhook `hcl:"webhook,block"`
 	ResolveToken bool     `hcl:"resolve_token,optional"`
+	Canary       *Canary  `hcl:"canary,block"`
+	Jobs         *Jobs    `hcl:"jobs,block"`
+	// Severity of the errors, info or warning only advise instead of rejecting the job, defaults to error
+	Severity string `hcl:"severity,optional"`
 
 	Notation *NotationVerifierConfig `hcl:"notation,block"`
+	Quota    *Quota                  `hcl:"quota,block"`
+
+	ProtectedJobs *ProtectedJobs      `hcl:"protected_jobs,block"`
+	Deregister    *Deregister         `hcl:"deregister,block"`
+	Disruption    *Disruption         `hcl:"disruption,block"`
+	Constraints   *Constraints        `hcl:"constraints,block"`
+	StaticPorts   *StaticPorts        `hcl:"static_ports,block"`
+	Connect       *Connect            `hcl:"connect,block"`
+	Naming        *Naming             `hcl:"naming,block"`
+	Template      *TemplatePolicy     `hcl:"template,block"`
+	Secrets       *Secrets            `hcl:"secrets,block"`
+	Limits        *Limits             `hcl:"limits,block"`
+	Update        *Update             `hcl:"update,block"`
+	Devices       *Devices            `hcl:"devices,block"`
+	Priority      *Priority           `hcl:"priority,block"`
+	Periodic      *Periodic           `hcl:"periodic,block"`
+	Volumes       *Volumes            `hcl:"volumes,block"`
+	Placement     *PlacementAllowlist `hcl:"placement,block"`
+
+	WorkloadIdentity *WorkloadIdentity `hcl:"workload_identity,block"`
+	Ownership        *Ownership        `hcl:"ownership,block"`
+}
+
+// Ownership checks the declared owner of a job against an ownership registry loaded as data source.
+type Ownership struct {
+	// Source is the data source of the registry, it maps <namespace>/<job> glob patterns to the owning team
+	Source string `hcl:"source"`
+	// OwnerMeta is the job meta key declaring the owner, defaults to team
+	OwnerMeta string `hcl:"owner_meta,optional"`
+	// RequireRegistered rejects jobs without an entry in the registry
+	RequireRegistered bool `hcl:"require_registered,optional"`
+}
+
+// Canary enforces a validator only for a percentage of the jobs, the others only get warnings
+type Canary struct {
+	Percent float64 `hcl:"percent"`
+}
+type ConsulIntentions struct {
+	// DryRun only reports missing intentions as warnings
+	DryRun bool `hcl:"dry_run,optional"`
+}
+type SpreadTarget struct {
+	Value   string `hcl:"value,label"`
+	Percent int    `hcl:"percent"`
+}
+type Spread struct {
+	// Attribute is the node attribute, e.g. $${node.datacenter} (escaped from HCL interpolation)
+	Attribute string         `hcl:"attribute"`
+	Weight    int            `hcl:"weight,optional"`
+	Targets   []SpreadTarget `hcl:"target,block"`
+}
+type Placement struct {
+	Selector *Selector `hcl:"selector,block"`
+	NodePool string    `hcl:"node_pool,optional"`
+	Spreads  []Spread  `hcl:"spread,block"`
+}
+type DeviceVendor struct {
+	Name string            `hcl:"name,label"`
+	Env  map[string]string `hcl:"env,optional"`
+	Meta map[string]string `hcl:"meta,optional"`
+}
+type DeviceInjection struct {
+	Vendors []DeviceVendor `hcl:"vendor,block"`
+}
+
+// MetaStandard enforces a canonical set of job meta keys.
+type MetaStandard struct {
+	Keys []MetaKey `hcl:"key,block"`
+	// Namespaces replace the required keys for jobs of the namespace
+	Namespaces []MetaNamespace `hcl:"namespace,block"`
+}
+type MetaKey struct {
+	Name string `hcl:"name,label"`
+	// Aliases are other spellings renamed to the key, keys differing only in case are always renamed
+	Aliases []string `hcl:"aliases,optional"`
+	// Required rejects jobs without the key after the defaults are filled
+	Required bool `hcl:"required,optional"`
+	// Default is used if the job has no value and From has none either
+	Default string `hcl:"default,optional"`
+	// From fills a missing value from the request: identity, group, token_name, header:<name> or
+	// data:<source>.<path>, where {key} in the path is replaced by the value of another meta key
+	From string `hcl:"from,optional"`
+	// Lowercase normalizes the value to lower case
+	Lowercase bool `hcl:"lowercase,optional"`
+}
+type MetaNamespace struct {
+	Name     string   `hcl:"name,label"`
+	Required []string `hcl:"required"`
 }
 type Mutator struct {
 	Type         string   `hcl:"type,label"`
@@ -31,24 +361,640 @@ type Mutator struct {
 	OpaRule      *OpaRule `hcl:"opa_rule,block"`
 	Webhook      *Webhook `hcl:"webhook,block"`
 	ResolveToken bool     `hcl:"resolve_token,optional"`
+	Jobs         *Jobs    `hcl:"jobs,block"`
+
+	ConsulIntentions *ConsulIntentions `hcl:"consul_intentions,block"`
+	Placement        *Placement        `hcl:"placement,block"`
+	Devices          *DeviceInjection  `hcl:"devices,block"`
+	Priority         *Priority         `hcl:"priority,block"`
+	Meta             *MetaStandard     `hcl:"meta,block"`
 }
 
+const (
+	OperationRegister = "register"
+	OperationPlan     = "plan"
+	OperationValidate = "validate"
+	// OperationDeregister is a stop or purge of a job
+	OperationDeregister = "deregister"
+	// Disruptions of running jobs, only intercepted if a validator checks them
+	OperationAllocRestart  = "alloc_restart"
+	OperationAllocStop     = "alloc_stop"
+	OperationEvaluate      = "evaluate"
+	OperationPeriodicForce = "periodic_force"
+	// OperationRead is a GET request checked by read rules
+	OperationRead = "read"
+	// OperationTokenVending is the exchange of a CI token, checked by the opa_rule of the token_vending role
+	OperationTokenVending = "token_vending"
+)
+
+// JobOperations are the operations on registered jobs, they are only checked by validators of the operation.
+var JobOperations = []string{OperationDeregister, OperationAllocRestart, OperationAllocStop, OperationEvaluate, OperationPeriodicForce}
+
+// Sources of the namespace of a job, Nomad uses the first one set of query, request body and job.
+const (
+	NamespaceSourceQuery   = "query"
+	NamespaceSourceHeader  = "header"
+	NamespaceSourceRequest = "request"
+	NamespaceSourceJob     = "job"
+)
+
 type RequestContext struct {
+	// Operation is one of register, plan, validate, one of the JobOperations or read
+	Operation    string        `json:"operation,omitempty"`
 	ClientIP     string        `json:"clientIP"`
 	AccessorID   string        `json:"accessorID"`
 	ResolveToken bool          `json:"resolveToken"`
 	TokenInfo    *api.ACLToken `json:"tokenInfo,omitempty"`
+	// Identity and Groups of the submitter if an identity resolver is configured
+	Identity string   `json:"identity,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	// Method and Path of the Nomad API request
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// Policies of the submitter's token, only set if the token is resolved
+	Policies []string `json:"policies,omitempty"`
+	// Headers holds the context_headers of the request by canonical name, repeated headers are joined by ", "
+	Headers map[string]string `json:"headers,omitempty"`
+	// Namespace the job is written to and NamespaceSource where it comes from,
+	// anything but job means the namespace of the job was overridden by the request
+	Namespace       string `json:"namespace,omitempty"`
+	NamespaceSource string `json:"namespaceSource,omitempty"`
+	// IdempotencyToken of the idempotency_token query parameter
+	IdempotencyToken string `json:"idempotencyToken,omitempty"`
+	// EnforceIndex and JobModifyIndex of a check-and-set register, the job is only registered
+	// if its current modify index matches, an index of 0 only registers new jobs
+	EnforceIndex   bool   `json:"enforceIndex,omitempty"`
+	JobModifyIndex uint64 `json:"jobModifyIndex,omitempty"`
+	// Purge is set if a deregistered job is purged instead of only stopped
+	Purge bool `json:"purge,omitempty"`
+	// AllocID of an allocation restart or stop
+	AllocID string `json:"allocID,omitempty"`
+	// PolicyRules are the rules of the token's policies by name, only set if the token_cache resolves policies
+	PolicyRules map[string]string `json:"policyRules,omitempty"`
+	// CertPolicies are the virtual policies of the client certificate, they are also added to the Policies
+	CertPolicies []string `json:"certPolicies,omitempty"`
+	// IdentityClaims are the values of the identity claim_headers set by a trusted proxy
+	IdentityClaims map[string]string `json:"identityClaims,omitempty"`
 }
 
+// DefaultContextHeaders are passed to the rules if context_headers is not set.
+var DefaultContextHeaders = []string{"User-Agent", "X-Request-Id"}
+
+// sensitiveHeaders carry credentials and are never passed to the rules.
+var sensitiveHeaders = []string{"X-Nomad-Token", "Authorization", "Proxy-Authorization", "Cookie"}
+
 type NomadServerTLS struct {
 	CaFile             string `hcl:"ca_file"`
 	CertFile           string `hcl:"cert_file"`
 	KeyFile            string `hcl:"key_file"`
 	InsecureSkipVerify bool   `hcl:"insecure_skip_verify,optional"`
+	// ServerName is verified instead of the host, e.g. server.global.nomad for discovered servers
+	ServerName string `hcl:"server_name,optional"`
 }
 type NomadServer struct {
 	Address string          `hcl:"address"`
 	TLS     *NomadServerTLS `hcl:"tls,block"`
+	// Token is used for NACP's own calls against the Nomad API, not for proxied requests
+	Token string `hcl:"token,optional"`
+	// LookupCacheTTL defines how long results of the nomad.* rego functions are cached
+	LookupCacheTTL string `hcl:"lookup_cache_ttl,optional"`
+	// Discovery finds the servers proxied requests are sent to, the address is still used for NACP's own calls
+	Discovery *NomadDiscovery `hcl:"discovery,block"`
+	// Retry retries proxied requests that failed transiently, e.g. during a leader election
+	Retry *NomadRetry `hcl:"retry,block"`
+	// PreserveUnknownFields applies the changes of the mutators to the submitted job registrations and plans as JSON patches,
+	// so fields of a newer Nomad version than NACP's API client reach Nomad
+	PreserveUnknownFields bool `hcl:"preserve_unknown_fields,optional"`
+}
+
+// NomadRetry retries proxied requests with idempotent methods on connection errors, 429 and 502-504 responses and
+// 500 responses without a cluster leader
+type NomadRetry struct {
+	// MaxAttempts includes the first attempt, defaults to 3
+	MaxAttempts int `hcl:"max_attempts,optional"`
+	// InitialBackoff doubles with every retry up to MaxBackoff, the actual backoff is a random share of it, defaults to 100ms and 2s
+	InitialBackoff string `hcl:"initial_backoff,optional"`
+	MaxBackoff     string `hcl:"max_backoff,optional"`
+	// Budget is the share of the requests that may be retried, on top of a reserve of 10 retries, defaults to 0.2
+	Budget float64 `hcl:"budget,optional"`
+	// Methods that are retried, defaults to GET, HEAD and OPTIONS, PUT and DELETE may be added. Job registrations,
+	// dispatches, evaluations and periodic forces are never retried.
+	Methods []string `hcl:"methods,optional"`
+}
+
+// NomadDiscovery resolves the Nomad servers from Consul or a DNS SRV record and refreshes them periodically
+type NomadDiscovery struct {
+	// ConsulService is the name of the Nomad servers' Consul service, the consul block configures the client
+	ConsulService string `hcl:"consul_service,optional"`
+	// ConsulTag filters the service instances, defaults to http
+	ConsulTag string `hcl:"consul_tag,optional"`
+	// SRVRecord is a DNS SRV record, e.g. _http._tcp.nomad.service.consul
+	SRVRecord string `hcl:"srv_record,optional"`
+	// Scheme of the discovered servers, defaults to https if tls is configured
+	Scheme string `hcl:"scheme,optional"`
+	// RefreshInterval defaults to 30s
+	RefreshInterval string `hcl:"refresh_interval,optional"`
+}
+type Consul struct {
+	Address string `hcl:"address,optional"`
+	Token   string `hcl:"token,optional"`
+}
+
+const (
+	// ForwardedForAppend keeps the X-Forwarded-For chain of trusted proxies and appends the peer
+	ForwardedForAppend = "append"
+	// ForwardedForReplace sends only the client ip
+	ForwardedForReplace = "replace"
+)
+
+// ForwardedHeaders controls which client ip headers are sent to Nomad
+type ForwardedHeaders struct {
+	// XForwardedFor is append (default) or replace
+	XForwardedFor string `hcl:"x_forwarded_for,optional"`
+	// XRealIP sets X-Real-IP to the client ip
+	XRealIP bool `hcl:"x_real_ip,optional"`
+}
+
+// UpstreamHeaders strip, set or add headers of the requests sent to Nomad, e.g. to replace the client's token
+type UpstreamHeaders struct {
+	Rules []*HeaderRule `hcl:"rule,block"`
+}
+
+// HeaderRule changes the headers of the matching requests, all matching rules apply in order
+type HeaderRule struct {
+	// Paths are patterns in the syntax of path.Match, e.g. /v1/job/*, empty matches all paths
+	Paths []string `hcl:"paths,optional"`
+	// Methods the rule applies to, empty matches all methods
+	Methods []string `hcl:"methods,optional"`
+	// Remove, Set and Add are applied in this order, Set replaces all values of the header
+	Remove []string          `hcl:"remove,optional"`
+	Set    map[string]string `hcl:"set,optional"`
+	Add    map[string]string `hcl:"add,optional"`
+}
+
+// ResponseScrubbing redacts fields of the responses of read requests, e.g. secrets in the meta of jobs
+type ResponseScrubbing struct {
+	Rules []*ScrubRule `hcl:"rule,block"`
+}
+
+// ScrubRule redacts fields of the JSON responses of GET requests to the paths
+type ScrubRule struct {
+	Name string `hcl:"name,label"`
+	// Paths are patterns in the syntax of path.Match, e.g. /v1/job/*, empty matches all paths
+	Paths []string `hcl:"paths,optional"`
+	// Fields are dot separated paths into the response, each segment is a path.Match pattern on an object key
+	// or array index, e.g. TaskGroups.*.Tasks.*.Vault or Meta.*_secret
+	Fields []string `hcl:"fields"`
+	// Action is remove or mask, mask replaces the values with <redacted>, defaults to remove
+	Action string `hcl:"action,optional"`
+}
+
+// ReadRule authorizes GET requests to the paths with an OPA policy, it sees the request context but no job
+type ReadRule struct {
+	Name string `hcl:"name,label"`
+	// Paths are patterns in the syntax of path.Match, e.g. /v1/allocation/*, empty matches all paths
+	Paths        []string `hcl:"paths,optional"`
+	OpaRule      *OpaRule `hcl:"opa_rule,block"`
+	ResolveToken bool     `hcl:"resolve_token,optional"`
+}
+
+const (
+	ScrubActionRemove = "remove"
+	ScrubActionMask   = "mask"
+)
+
+// CORS allows browsers on other origins, e.g. a separately hosted Nomad UI, to call the API through NACP
+type CORS struct {
+	// AllowedOrigins like https://nomad.example.com, * allows every origin
+	AllowedOrigins []string `hcl:"allowed_origins"`
+	// AllowedHeaders defaults to DefaultCORSHeaders
+	AllowedHeaders   []string `hcl:"allowed_headers,optional"`
+	AllowCredentials bool     `hcl:"allow_credentials,optional"`
+	// MaxAge browsers cache the preflight response, defaults to 10m
+	MaxAge string `hcl:"max_age,optional"`
+}
+
+// DefaultCORSHeaders are the request headers the Nomad UI sends
+var DefaultCORSHeaders = []string{"Content-Type", "X-Nomad-Token"}
+
+// Auth lets NACP log in browser users with OIDC and send their Nomad token upstream, requests with a token are passed through
+type Auth struct {
+	OIDC *OIDC `hcl:"oidc,block"`
+	// SessionTTL defaults to 8h, sessions end earlier if the Nomad token expires
+	SessionTTL string `hcl:"session_ttl,optional"`
+	// TokenExchange or TokenMappings provide the Nomad token of a user
+	TokenExchange *TokenExchange `hcl:"token_exchange,block"`
+	TokenMappings []TokenMapping `hcl:"token_mapping,block"`
+}
+type OIDC struct {
+	Issuer       string `hcl:"issuer"`
+	ClientID     string `hcl:"client_id"`
+	ClientSecret string `hcl:"client_secret"`
+	// RedirectURL is the external URL of NACP's callback, e.g. https://nacp.example.com/v1/nacp/auth/callback
+	RedirectURL string `hcl:"redirect_url"`
+	// Scopes defaults to openid, profile and email
+	Scopes []string `hcl:"scopes,optional"`
+	// IdentityClaim defaults to email, GroupsClaim to groups
+	IdentityClaim string `hcl:"identity_claim,optional"`
+	GroupsClaim   string `hcl:"groups_claim,optional"`
+}
+
+// TokenExchange logs in to a Nomad JWT auth method with the ID token of the user
+type TokenExchange struct {
+	AuthMethod string `hcl:"auth_method"`
+}
+
+// TokenMapping assigns a Nomad token to users by identity or group, the first matching mapping is used
+type TokenMapping struct {
+	Name       string   `hcl:"name,label"`
+	Identities []string `hcl:"identities,optional"`
+	Groups     []string `hcl:"groups,optional"`
+	Token      string   `hcl:"token"`
+}
+
+// TokenVending exchanges OIDC tokens of CI systems for short-lived Nomad tokens
+type TokenVending struct {
+	Issuers []VendingIssuer `hcl:"issuer,block"`
+	Roles   []VendingRole   `hcl:"role,block"`
+}
+type VendingIssuer struct {
+	Name string `hcl:"name,label"`
+	// URL of the issuer, e.g. https://token.actions.githubusercontent.com
+	URL      string `hcl:"url"`
+	Audience string `hcl:"audience"`
+}
+
+// VendingRole grants a token with the policies if the claims of the CI token match, e.g. repository and ref
+type VendingRole struct {
+	Name   string `hcl:"name,label"`
+	Issuer string `hcl:"issuer"`
+	// BoundClaims values are glob patterns, all of them must match
+	BoundClaims map[string]string `hcl:"bound_claims"`
+	Policies    []string          `hcl:"policies"`
+	// TTL of the Nomad token, defaults to 15m
+	TTL string `hcl:"ttl,optional"`
+	// OpaRule decides on the exchange with the claims of the CI token, it sees no job
+	OpaRule *OpaRule `hcl:"opa_rule,block"`
+}
+
+// VirtualTokens lets clients authenticate with credentials issued by NACP, NACP sends Nomad tokens it manages instead
+type VirtualTokens struct {
+	// TTL of the Nomad tokens, defaults to 1h
+	TTL string `hcl:"ttl,optional"`
+	// RenewBefore is how long before their expiry the tokens are replaced, defaults to 10m
+	RenewBefore string `hcl:"renew_before,optional"`
+	// Exclusive rejects requests with Nomad tokens, only the credentials and anonymous requests are accepted
+	Exclusive   bool                `hcl:"exclusive,optional"`
+	Credentials []VirtualCredential `hcl:"credential,block"`
+}
+
+// VirtualCredential maps a client's secret to a Nomad token with the policies
+type VirtualCredential struct {
+	Name string `hcl:"name,label"`
+	// SecretSHA256 is the hex encoded SHA-256 of the secret, the secret starts with nacp_
+	SecretSHA256 string   `hcl:"secret_sha256"`
+	Policies     []string `hcl:"policies"`
+}
+
+// HTTP2 enables HTTP/2 without TLS, with TLS it is negotiated anyway
+type HTTP2 struct {
+	// H2C accepts HTTP/2 without TLS on the listener, e.g. behind a load balancer that terminates TLS
+	H2C bool `hcl:"h2c,optional"`
+	// UpstreamH2C talks HTTP/2 with prior knowledge to plain http Nomad upstreams
+	UpstreamH2C bool `hcl:"upstream_h2c,optional"`
+}
+type AdmissionQueue struct {
+	MaxConcurrent int `hcl:"max_concurrent"`
+	MaxQueued     int `hcl:"max_queued,optional"`
+}
+
+// FaultInjection enables the admin endpoints to delay or fail rules, it is off by default and the endpoints require admin access.
+type FaultInjection struct {
+	Enabled bool `hcl:"enabled"`
+}
+
+// PolicyTrace enables the admin endpoint evaluating a job with a full trace of an OPA rule, traces include data sources and the policy.
+type PolicyTrace struct {
+	Enabled bool `hcl:"enabled"`
+}
+
+// ClientCert maps the client certificates of mTLS to virtual policies, which are added to the policies of the request context
+type ClientCert struct {
+	Bindings []CertBinding `hcl:"binding,block"`
+}
+
+// CertBinding grants its policies if a SAN matches one of the sans and the subject has one of the ous, a missing list matches any certificate.
+type CertBinding struct {
+	// SANs are glob patterns of the DNS, URI, email and IP SANs, e.g. *.ci.example.com or spiffe://example.com/ci/*
+	SANs []string `hcl:"sans,optional"`
+	// OUs are organizational units of the subject
+	OUs      []string `hcl:"ous,optional"`
+	Policies []string `hcl:"policies"`
+}
+
+// NetworkACL rejects requests from unexpected networks before any rule is evaluated
+type NetworkACL struct {
+	// Writes apply to PUT, POST, PATCH and DELETE requests, e.g. job registrations
+	Writes *NetworkRules `hcl:"writes,block"`
+	// Reads apply to all other requests
+	Reads *NetworkRules `hcl:"reads,block"`
+}
+
+// NetworkRules are CIDRs or addresses of clients, denied clients are rejected even if they are allowed, without allow all clients not denied are allowed
+type NetworkRules struct {
+	Allow []string `hcl:"allow,optional"`
+	Deny  []string `hcl:"deny,optional"`
+}
+
+// Maintenance answers writes of jobs with a 503 while enabled, e.g. as a deploy freeze, reads are still proxied
+type Maintenance struct {
+	// Enabled is the state at start, the admin API toggles it at runtime
+	Enabled bool `hcl:"enabled,optional"`
+	// Message is the body of the 503 responses, the admin API can replace it
+	Message string `hcl:"message,optional"`
+	// Operations that are rejected, any of register, scale, dispatch, revert and deregister, defaults to register, scale and dispatch
+	Operations []string `hcl:"operations,optional"`
+	// RetryAfter is sent as Retry-After header if set
+	RetryAfter string `hcl:"retry_after,optional"`
+}
+
+// MaintenanceOperations are the writes a maintenance can reject.
+var MaintenanceOperations = []string{"register", "scale", "dispatch", "revert", "deregister"}
+
+// APIs enumerates the Nomad API groups NACP handles. Without the block the jobs and all interceptors are handled as
+// before, with it only the listed groups are, jobs unless disabled.
+type APIs struct {
+	// Jobs are registrations, plans, validations, stops and the other job operations the rules check
+	Jobs *APIGroup `hcl:"jobs,block"`
+	// Volumes, Variables, ACL and Namespaces are handled by the interceptors of their paths
+	Volumes    *APIGroup `hcl:"volumes,block"`
+	Variables  *APIGroup `hcl:"variables,block"`
+	ACL        *APIGroup `hcl:"acl,block"`
+	Namespaces *APIGroup `hcl:"namespaces,block"`
+}
+
+// APIGroup configures how NACP handles the requests of a Nomad API group
+type APIGroup struct {
+	// Enabled defaults to true, requests of disabled groups are passed through unchecked
+	Enabled *bool `hcl:"enabled,optional"`
+	// Enforcement is enforce or audit, audit logs rejections but passes the original request on, defaults to enforce
+	Enforcement string `hcl:"enforcement,optional"`
+}
+
+// APIEnforcements are the enforcement modes of an API group.
+var APIEnforcements = []string{"enforce", "audit"}
+
+// Exemptions suppress the denials of a validator for some jobs until they expire
+type Exemptions struct {
+	// File keeps the exemptions added via the admin API across restarts, it is created if missing
+	File string `hcl:"file,optional"`
+	// WarnBefore is how long before the expiry a used exemption adds a warning, defaults to 168h
+	WarnBefore string      `hcl:"warn_before,optional"`
+	Exemptions []Exemption `hcl:"exemption,block"`
+}
+
+// Exemption turns the errors of a validator into warnings for the matching jobs
+type Exemption struct {
+	Rule string `hcl:"rule,label"`
+	// Namespace and Job narrow the exemption, Job is a glob pattern on the job ID, empty matches all
+	Namespace string `hcl:"namespace,optional"`
+	Job       string `hcl:"job,optional"`
+	// Expires is a date, valid until the end of that day in UTC, or an RFC 3339 time
+	Expires string `hcl:"expires"`
+	Reason  string `hcl:"reason"`
+}
+
+// ParseExpiry parses the expiry of an exemption.
+func ParseExpiry(expires string) (time.Time, error) {
+	if day, err := time.Parse(time.DateOnly, expires); err == nil {
+		return day.AddDate(0, 0, 1), nil
+	}
+	return time.Parse(time.RFC3339, expires)
+}
+
+// Shadow evaluates the rules of a candidate config on live traffic without enforcing them
+type Shadow struct {
+	// Config is a config file, only its validator and mutator blocks are used
+	Config        string `hcl:"config"`
+	MaxMismatches int    `hcl:"max_mismatches,optional"`
+}
+
+const (
+	SIEMFormatCEF  = "cef"
+	SIEMFormatLEEF = "leef"
+)
+
+// SIEM exports the rule decisions as CEF or LEEF events via syslog, e.g. to Splunk or QRadar
+type SIEM struct {
+	// Format is cef or leef
+	Format string `hcl:"format"`
+	// Address of the syslog receiver as host:port
+	Address string `hcl:"address"`
+	// TLS of the syslog connection, without it the events are sent unencrypted via TCP
+	TLS *ClientTLS `hcl:"tls,block"`
+	// Facility of the syslog messages, defaults to local0
+	Facility string `hcl:"facility,optional"`
+	// Decisions are the exported outcomes, defaults to accepted, warned and rejected
+	Decisions []string `hcl:"decisions,optional"`
+	// BufferSize is the number of events kept while the receiver is unavailable, defaults to 1000
+	BufferSize int `hcl:"buffer_size,optional"`
+}
+
+// ClientTLS verifies the server against the system roots unless a CA is set, a certificate is only presented if set
+type ClientTLS struct {
+	CaFile             string `hcl:"ca_file,optional"`
+	CertFile           string `hcl:"cert_file,optional"`
+	KeyFile            string `hcl:"key_file,optional"`
+	InsecureSkipVerify bool   `hcl:"insecure_skip_verify,optional"`
+	ServerName         string `hcl:"server_name,optional"`
+}
+
+const (
+	EventBusNATS  = "nats"
+	EventBusKafka = "kafka"
+)
+
+// EventBus publishes every rule decision, including the changes of mutators, as JSON event
+type EventBus struct {
+	// Backend is nats, publishing to a JetStream stream, or kafka, producing via a Kafka REST proxy
+	Backend string `hcl:"backend"`
+	// Address is the NATS server, e.g. nats://localhost:4222, or the URL of the Kafka REST proxy
+	Address string `hcl:"address"`
+	// Topic is the NATS subject or the Kafka topic
+	Topic    string `hcl:"topic"`
+	Username string `hcl:"username,optional"`
+	Password string `hcl:"password,optional"`
+	// Token authenticates against NATS
+	Token string     `hcl:"token,optional"`
+	TLS   *ClientTLS `hcl:"tls,block"`
+	// Decisions are the published outcomes, defaults to accepted, warned and rejected
+	Decisions []string `hcl:"decisions,optional"`
+	// BufferSize is the number of events kept while the backend is unavailable, defaults to 1000
+	BufferSize int `hcl:"buffer_size,optional"`
+}
+
+// Mirror copies admitted job registrations to a secondary Nomad cluster, e.g. for staging or capacity simulations
+type Mirror struct {
+	Address string     `hcl:"address"`
+	Token   string     `hcl:"token,optional"`
+	TLS     *ClientTLS `hcl:"tls,block"`
+	// Mode is register or plan, plan doesn't schedule anything on the secondary cluster, defaults to register
+	Mode string `hcl:"mode,optional"`
+	// Namespaces maps the namespaces of the jobs to the ones of the secondary cluster, * matches every other namespace
+	Namespaces map[string]string `hcl:"namespaces,optional"`
+	// Datacenters and Region replace the ones of the job if set
+	Datacenters []string `hcl:"datacenters,optional"`
+	Region      string   `hcl:"region,optional"`
+	// Redact are glob patterns of env, meta and driver config keys whose values are redacted, defaults to common secret names
+	Redact []string `hcl:"redact,optional"`
+	// BufferSize is the number of jobs waiting to be mirrored, further jobs are dropped, defaults to 100
+	BufferSize int `hcl:"buffer_size,optional"`
+}
+
+// DecisionReport periodically summarizes the rule decisions of the replica
+type DecisionReport struct {
+	// Interval between two reports, defaults to 168h
+	Interval string `hcl:"interval,optional"`
+	// Webhook receives the report as JSON POST, without it the report is logged
+	Webhook string `hcl:"webhook,optional"`
+	// Top is the number of denial reasons, namespaces and sample jobs listed per rule, defaults to 5
+	Top int `hcl:"top,optional"`
+}
+
+// SyslogFacilities are the facilities a SIEM export may use
+var SyslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "daemon": 3, "auth": 4, "syslog": 5, "authpriv": 10,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Upgrade allows replacing the binary in place, on SIGUSR2 the listener is handed to a new process and the old one drains
+type Upgrade struct {
+	// ReusePort sets SO_REUSEPORT, so a new process can also bind the port while the old one still runs
+	ReusePort bool `hcl:"reuse_port,optional"`
+	// DrainTimeout is how long the old process waits for in-flight requests, defaults to the nomad timeout
+	DrainTimeout string `hcl:"drain_timeout,optional"`
+}
+
+// Sidecar discovers the local Nomad agent instead of using the nomad address, e.g. if NACP runs next to every Nomad server
+type Sidecar struct {
+	// NomadConfigDir is read for the agent's http address if NACP does not run as Nomad task, defaults to /etc/nomad.d
+	NomadConfigDir string `hcl:"nomad_config_dir,optional"`
+	// Register registers NACP as service in the local Consul agent, with the consul_service settings if present
+	Register bool `hcl:"register,optional"`
+}
+
+// ConsulService registers NACP in the local Consul agent, so clients can discover it instead of the Nomad address
+type ConsulService struct {
+	Name string            `hcl:"name,optional"`
+	Tags []string          `hcl:"tags,optional"`
+	Meta map[string]string `hcl:"meta,optional"`
+	// Address is advertised instead of the bind address, defaults to the address of the Consul agent if NACP binds to all interfaces
+	Address string `hcl:"address,optional"`
+	// CheckInterval of the /healthz check, defaults to 10s
+	CheckInterval string `hcl:"check_interval,optional"`
+}
+
+// DefaultConsulService is used if the sidecar registers itself without a consul_service block
+func DefaultConsulService() *ConsulService {
+	return &ConsulService{Name: "nacp", CheckInterval: "10s"}
+}
+
+type LeaderElection struct {
+	// Backend is either nomad (variable lock) or consul (session lock)
+	Backend string `hcl:"backend"`
+	Path    string `hcl:"path,optional"`
+	TTL     string `hcl:"ttl,optional"`
+}
+type DataSource struct {
+	// Type is one of file, http or consul_kv
+	Type string `hcl:"type,label"`
+	Name string `hcl:"name,label"`
+	// Path of the JSON file for the file type
+	Path string `hcl:"path,optional"`
+	// URL of the JSON document for the http type
+	URL string `hcl:"url,optional"`
+	// Prefix of the keys for the consul_kv type
+	Prefix string `hcl:"prefix,optional"`
+	// Interval to poll the source, the source is loaded only once if unset
+	Interval string `hcl:"interval,optional"`
+}
+type LDAP struct {
+	URL          string `hcl:"url"`
+	BindDN       string `hcl:"bind_dn,optional"`
+	BindPassword string `hcl:"bind_password,optional"`
+	BaseDN       string `hcl:"base_dn"`
+	// UserFilter finds the user entry, %s is replaced by the escaped identity, defaults to (uid=%s)
+	UserFilter string `hcl:"user_filter,optional"`
+	// GroupAttribute of the user entry listing the groups, defaults to memberOf
+	GroupAttribute string `hcl:"group_attribute,optional"`
+	CacheTTL       string `hcl:"cache_ttl,optional"`
+}
+type Identity struct {
+	// Source is either token_name or header
+	Source string `hcl:"source"`
+	Header string `hcl:"header,optional"`
+	LDAP   *LDAP  `hcl:"ldap,block"`
+	// GroupsHeader holds the comma separated groups set by the proxy, it can't be combined with ldap
+	GroupsHeader string `hcl:"groups_header,optional"`
+	// ClaimHeaders maps the names of the identityClaims of the request context to headers, e.g. email = "X-Forwarded-Email"
+	ClaimHeaders map[string]string `hcl:"claim_headers,optional"`
+	// TrustedPeers are CIDRs or addresses of the proxies whose identity headers are used
+	TrustedPeers []string `hcl:"trusted_peers,optional"`
+	// TrustedCAFile issues the client certificates of the proxies whose identity headers are used
+	TrustedCAFile string `hcl:"trusted_ca_file,optional"`
+}
+type Calendar struct {
+	Name string `hcl:"name,label"`
+	// Dates in YYYY-MM-DD format
+	Dates []string `hcl:"dates,optional"`
+	// File with one YYYY-MM-DD date per line, lines starting with # are ignored
+	File string `hcl:"file,optional"`
+}
+
+// OpaLimits bound every evaluation of an embedded OPA policy, so a pathological policy can't hang or OOM NACP
+type OpaLimits struct {
+	// Timeout of one evaluation, defaults to 5s
+	Timeout string `hcl:"timeout,optional"`
+	// MaxSteps aborts an evaluation after the number of evaluation steps, 0 is unlimited
+	MaxSteps int `hcl:"max_steps,optional"`
+	// MaxHeapBytes aborts evaluations while the heap of NACP exceeds the size, 0 is unlimited
+	MaxHeapBytes int64 `hcl:"max_heap_bytes,optional"`
+}
+
+// MutatorConflicts detects mutators changing the same paths of a job
+type MutatorConflicts struct {
+	// Strategy is fail, first_wins or last_wins, defaults to fail
+	Strategy string `hcl:"strategy,optional"`
+}
+
+// Revalidation re-runs the mutators until the job is stable before the validators check it
+type Revalidation struct {
+	// MaxPasses of the mutators, a job still changing after them is rejected, defaults to 3
+	MaxPasses int `hcl:"max_passes,optional"`
+}
+
+// TokenCache caches the token lookups of NACP and optionally resolves the ACL policies of the tokens
+type TokenCache struct {
+	// TTL of the cached tokens and policies, defaults to 30s
+	TTL string `hcl:"ttl,optional"`
+	// ResolvePolicies passes the rules of the token's policies, including the ones of its roles, to the rules as context.policyRules
+	ResolvePolicies bool `hcl:"resolve_policies,optional"`
+}
+
+// PatchPolicy guards the JSON patches of json_patch_webhook and opa_json_patch mutators
+type PatchPolicy struct {
+	// ProtectedPaths are JSON pointers a patch must not change, * matches every key or index, defaults to the job ID, namespace and vault settings
+	ProtectedPaths []string `hcl:"protected_paths,optional"`
+	// MaxOperations of a patch, 0 is unlimited
+	MaxOperations int `hcl:"max_operations,optional"`
+	// TypeChecks rejects operations replacing a value with one of another JSON type
+	TypeChecks bool `hcl:"type_checks,optional"`
+}
+
+type PolicyTime struct {
+	// Timezone of the cluster, e.g. Europe/Berlin, defaults to the local time zone
+	Timezone  string     `hcl:"timezone,optional"`
+	Calendars []Calendar `hcl:"calendar,block"`
 }
 type ProxyTLS struct {
 	CertFile     string `hcl:"cert_file"`
@@ -57,13 +1003,53 @@ type ProxyTLS struct {
 	NoClientCert bool   `hcl:"no_client_cert,optional"`
 }
 type NotationVerifierConfig struct {
-	TrustPolicyFile     string `hcl:"trust_policy_file"`
+	// TrustPolicyFile applies to the images no image_policy matches, one of them is required
+	TrustPolicyFile     string `hcl:"trust_policy_file,optional"`
 	TrustStoreDir       string `hcl:"trust_store_dir"`
 	RepoPlainHTTP       bool   `hcl:"repo_plain_http,optional"`
 	MaxSigAttempts      int    `hcl:"max_sig_attempts,optional"`
 	CredentialStoreFile string `hcl:"credential_store_file,optional"`
+	// Parallelism bounds the images the notation validator verifies at once, defaults to 4
+	Parallelism int `hcl:"parallelism,optional"`
+	// Mirrors look up the images and signatures of a registry at a mirror, e.g. a pull-through cache
+	Mirrors []*RegistryMirror `hcl:"mirror,block"`
+	// ProxyURL is the HTTP proxy of the registry calls, the HTTPS_PROXY and HTTP_PROXY variables are used if empty
+	ProxyURL string `hcl:"proxy_url,optional"`
+	// ImagePolicies require signers per registry or repository, the first matching policy applies
+	ImagePolicies []*ImagePolicy `hcl:"image_policy,block"`
+}
+
+// ImagePolicy is a trust policy for the images of registries and repositories.
+type ImagePolicy struct {
+	Name string `hcl:"name,label"`
+	// Registries match the registry host of an image, e.g. registry.example.com
+	Registries []string `hcl:"registries,optional"`
+	// Repositories are glob patterns of the repository including the registry, e.g. ghcr.io/acme/*
+	Repositories []string `hcl:"repositories,optional"`
+	// TrustStores hold the certificates of the signers, e.g. ca:acme
+	TrustStores []string `hcl:"trust_stores"`
+	// Identities are the trusted signer identities, e.g. "x509.subject: C=US, ST=WA, O=Acme, CN=release", or "*"
+	Identities []string `hcl:"identities"`
+	// Level is strict (default), permissive, audit or skip
+	Level string `hcl:"level,optional"`
+}
+
+// RegistryMirror serves the repositories of the registry, the trust policy still applies to the original references.
+type RegistryMirror struct {
+	Registry string `hcl:"registry,label"`
+	// Endpoint is the host of the mirror, optionally followed by a repository prefix, e.g. mirror.example.com/dockerhub
+	Endpoint  string `hcl:"endpoint"`
+	PlainHTTP bool   `hcl:"plain_http,optional"`
 }
 
+const (
+	// DegradedModeLastKnownGood keeps enforcing the previously loaded rules
+	// when a policy reload fails.
+	DegradedModeLastKnownGood = "last_known_good"
+	// DegradedModePassThrough disables all rules when policies cannot be loaded.
+	DegradedModePassThrough = "pass_through"
+)
+
 type Config struct {
 	Port int    `hcl:"port,optional"`
 	Bind string `hcl:"bind,optional"`
@@ -71,9 +1057,67 @@ type Config struct {
 	LogLevel string    `hcl:"log_level,optional"`
 	Tls      *ProxyTLS `hcl:"tls,block"`
 
-	Nomad      *NomadServer `hcl:"nomad,block"`
-	Validators []Validator  `hcl:"validator,block"`
-	Mutators   []Mutator    `hcl:"mutator,block"`
+	// AdminBind serves the admin API below /v1/nacp/ on its own listener, e.g. 127.0.0.1:6465, instead of next to the Nomad API
+	AdminBind string `hcl:"admin_bind,optional"`
+	// AdminTokenSHA256 are the hex encoded SHA-256 of the admin tokens, required for the admin API next to the Nomad API
+	AdminTokenSHA256 []string `hcl:"admin_token_sha256,optional"`
+
+	// DegradedMode defines what happens if the rules can't be loaded, defaults to last_known_good
+	DegradedMode string `hcl:"degraded_mode,optional"`
+	// PolicyCacheDir keeps a copy of the last good policy files if set
+	PolicyCacheDir string `hcl:"policy_cache_dir,optional"`
+	// StrictPolicies lints the OPA policies when they are loaded and compiles them in OPA's strict mode
+	StrictPolicies bool `hcl:"strict_policies,optional"`
+
+	// TrustedProxies are CIDRs or addresses of load balancers in front of NACP, their forwarded headers are honored
+	TrustedProxies   []string          `hcl:"trusted_proxies,optional"`
+	ForwardedHeaders *ForwardedHeaders `hcl:"forwarded_headers,block"`
+	UpstreamHeaders  *UpstreamHeaders  `hcl:"upstream_headers,block"`
+	// ResponseScrubbing is applied to responses up to MaxResponseSize, larger ones of matching requests are rejected
+	ResponseScrubbing *ResponseScrubbing `hcl:"response_scrubbing,block"`
+	// MaxResponseSize in bytes of the Nomad responses NACP adds its warnings to, larger responses are passed through without them
+	MaxResponseSize int64 `hcl:"max_response_size,optional"`
+	// ContextHeaders are request headers passed to the rules as context.headers, defaults to DefaultContextHeaders
+	ContextHeaders []string `hcl:"context_headers,optional"`
+	// LogNearMisses logs writes that resemble job submissions but are not checked, e.g. PUT /v1/jobs/
+	LogNearMisses bool           `hcl:"log_near_misses,optional"`
+	HTTP2         *HTTP2         `hcl:"http2,block"`
+	CORS          *CORS          `hcl:"cors,block"`
+	Auth          *Auth          `hcl:"auth,block"`
+	TokenVending  *TokenVending  `hcl:"token_vending,block"`
+	VirtualTokens *VirtualTokens `hcl:"virtual_tokens,block"`
+
+	Nomad            *NomadServer      `hcl:"nomad,block"`
+	Consul           *Consul           `hcl:"consul,block"`
+	LeaderElection   *LeaderElection   `hcl:"leader_election,block"`
+	AdmissionQueue   *AdmissionQueue   `hcl:"admission_queue,block"`
+	FaultInjection   *FaultInjection   `hcl:"fault_injection,block"`
+	PolicyTrace      *PolicyTrace      `hcl:"policy_trace,block"`
+	Shadow           *Shadow           `hcl:"shadow,block"`
+	Exemptions       *Exemptions       `hcl:"exemptions,block"`
+	SIEM             *SIEM             `hcl:"siem,block"`
+	EventBus         *EventBus         `hcl:"event_bus,block"`
+	DecisionReport   *DecisionReport   `hcl:"decision_report,block"`
+	Upgrade          *Upgrade          `hcl:"upgrade,block"`
+	Sidecar          *Sidecar          `hcl:"sidecar,block"`
+	ConsulService    *ConsulService    `hcl:"consul_service,block"`
+	Time             *PolicyTime       `hcl:"time,block"`
+	OpaLimits        *OpaLimits        `hcl:"opa_limits,block"`
+	PatchPolicy      *PatchPolicy      `hcl:"patch_policy,block"`
+	Revalidation     *Revalidation     `hcl:"revalidation,block"`
+	MutatorConflicts *MutatorConflicts `hcl:"mutator_conflicts,block"`
+	Mirror           *Mirror           `hcl:"mirror,block"`
+	TokenCache       *TokenCache       `hcl:"token_cache,block"`
+	Maintenance      *Maintenance      `hcl:"maintenance,block"`
+	NetworkACL       *NetworkACL       `hcl:"network_acl,block"`
+	APIs             *APIs             `hcl:"apis,block"`
+	ClientCert       *ClientCert       `hcl:"client_cert,block"`
+	DataSources      []DataSource      `hcl:"data_source,block"`
+	Identity         *Identity         `hcl:"identity,block"`
+	Validators       []Validator       `hcl:"validator,block"`
+	Mutators         []Mutator         `hcl:"mutator,block"`
+	// ReadRules authorize read requests, e.g. for clusters relying on NACP instead of fine-grained Nomad ACLs
+	ReadRules []ReadRule `hcl:"read_rule,block"`
 }
 
 func DefaultConfig() *Config {
@@ -83,9 +1127,10 @@ func DefaultConfig() *Config {
 		Nomad: &NomadServer{
 			Address: "http://localhost:4646",
 		},
-		LogLevel:   "info",
-		Validators: []Validator{},
-		Mutators:   []Mutator{},
+		LogLevel:        "info",
+		MaxResponseSize: 16 << 20,
+		Validators:      []Validator{},
+		Mutators:        []Mutator{},
 	}
 	return c
 }
@@ -99,13 +1144,744 @@ func LoadConfig(name string) (*Config, error) {
 		return nil, err
 	}
 
+	for _, token := range c.AdminTokenSHA256 {
+		if hash, err := hex.DecodeString(token); err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("admin_token_sha256 must be hex encoded SHA-256 hashes, not the tokens")
+		}
+	}
+
+	switch c.DegradedMode {
+	case "", DegradedModeLastKnownGood, DegradedModePassThrough:
+	default:
+		return nil, fmt.Errorf("unknown degraded_mode %q", c.DegradedMode)
+	}
+
+	if c.Time != nil && c.Time.Timezone != "" {
+		if _, err := time.LoadLocation(c.Time.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", c.Time.Timezone, err)
+		}
+	}
+
+	if l := c.OpaLimits; l != nil {
+		if l.Timeout == "" {
+			l.Timeout = "5s"
+		}
+		if timeout, err := time.ParseDuration(l.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid opa_limits timeout %q", l.Timeout)
+		}
+		if l.MaxSteps < 0 || l.MaxHeapBytes < 0 {
+			return nil, fmt.Errorf("opa_limits max_steps and max_heap_bytes must not be negative")
+		}
+	}
+
+	if p := c.PatchPolicy; p != nil {
+		if p.ProtectedPaths == nil {
+			p.ProtectedPaths = []string{"/ID", "/Namespace", "/VaultNamespace", "/VaultToken", "/TaskGroups/*/Tasks/*/Vault"}
+		}
+		for _, path := range p.ProtectedPaths {
+			if !strings.HasPrefix(path, "/") {
+				return nil, fmt.Errorf("patch_policy protected path %q must be a JSON pointer starting with /", path)
+			}
+		}
+		if p.MaxOperations < 0 {
+			return nil, fmt.Errorf("patch_policy max_operations must not be negative")
+		}
+	}
+
+	if c.Mirror != nil {
+		if err := validateMirror(c.Mirror); err != nil {
+			return nil, err
+		}
+	}
+
+	if cc := c.ClientCert; cc != nil {
+		if c.Tls == nil || c.Tls.CaFile == "" || c.Tls.NoClientCert {
+			return nil, fmt.Errorf("client_cert needs a tls block with ca_file that verifies client certificates")
+		}
+		for _, binding := range cc.Bindings {
+			for _, pattern := range binding.SANs {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("invalid client_cert san pattern %q: %w", pattern, err)
+				}
+			}
+			if len(binding.Policies) == 0 {
+				return nil, fmt.Errorf("client_cert binding must grant policies")
+			}
+		}
+	}
+
+	if a := c.NetworkACL; a != nil {
+		if err := validateNetworkRules("writes", a.Writes); err != nil {
+			return nil, err
+		}
+		if err := validateNetworkRules("reads", a.Reads); err != nil {
+			return nil, err
+		}
+	}
+
+	if m := c.Maintenance; m != nil {
+		if err := validateMaintenance(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if u := c.UpstreamHeaders; u != nil {
+		if err := validateUpstreamHeaders(u); err != nil {
+			return nil, err
+		}
+	}
+
+	if r := c.ResponseScrubbing; r != nil {
+		if err := validateResponseScrubbing(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateReadRules(c.ReadRules); err != nil {
+		return nil, err
+	}
+
+	if a := c.APIs; a != nil {
+		if err := validateAPIs(a); err != nil {
+			return nil, err
+		}
+	}
+
+	if t := c.TokenCache; t != nil {
+		if t.TTL == "" {
+			t.TTL = "30s"
+		}
+		if ttl, err := time.ParseDuration(t.TTL); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid token_cache ttl %q, must be a positive duration", t.TTL)
+		}
+	}
+
+	if m := c.MutatorConflicts; m != nil {
+		if m.Strategy == "" {
+			m.Strategy = "fail"
+		}
+		switch m.Strategy {
+		case "fail", "first_wins", "last_wins":
+		default:
+			return nil, fmt.Errorf("invalid mutator_conflicts strategy %q, must be fail, first_wins or last_wins", m.Strategy)
+		}
+	}
+
+	if r := c.Revalidation; r != nil {
+		if r.MaxPasses == 0 {
+			r.MaxPasses = 3
+		}
+		if r.MaxPasses < 2 {
+			return nil, fmt.Errorf("revalidation max_passes must be at least 2, a job is stable once a pass doesn't change it")
+		}
+	}
+
+	if c.Upgrade != nil && c.Upgrade.DrainTimeout != "" {
+		if _, err := time.ParseDuration(c.Upgrade.DrainTimeout); err != nil {
+			return nil, fmt.Errorf("invalid upgrade drain_timeout %q: %w", c.Upgrade.DrainTimeout, err)
+		}
+	}
+
+	if c.ForwardedHeaders != nil {
+		switch c.ForwardedHeaders.XForwardedFor {
+		case "":
+			c.ForwardedHeaders.XForwardedFor = ForwardedForAppend
+		case ForwardedForAppend, ForwardedForReplace:
+		default:
+			return nil, fmt.Errorf("unknown forwarded_headers x_forwarded_for %q", c.ForwardedHeaders.XForwardedFor)
+		}
+	}
+
+	if c.HTTP2 != nil && c.HTTP2.H2C && c.Tls != nil {
+		return nil, fmt.Errorf("http2 h2c can't be combined with tls, HTTP/2 is negotiated with TLS")
+	}
+
+	if c.CORS != nil {
+		if len(c.CORS.AllowedOrigins) == 0 {
+			return nil, fmt.Errorf("cors allowed_origins must not be empty")
+		}
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" && c.CORS.AllowCredentials {
+				return nil, fmt.Errorf("cors allow_credentials can't be combined with the * origin")
+			}
+		}
+		if c.CORS.AllowedHeaders == nil {
+			c.CORS.AllowedHeaders = DefaultCORSHeaders
+		}
+		if c.CORS.MaxAge == "" {
+			c.CORS.MaxAge = "10m"
+		}
+		if _, err := time.ParseDuration(c.CORS.MaxAge); err != nil {
+			return nil, fmt.Errorf("invalid cors max_age %q: %w", c.CORS.MaxAge, err)
+		}
+	}
+
+	if c.Auth != nil {
+		if err := validateAuth(c.Auth); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.TokenVending != nil {
+		if err := validateTokenVending(c.TokenVending); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.VirtualTokens != nil {
+		if err := validateVirtualTokens(c.VirtualTokens); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Exemptions != nil {
+		if c.Exemptions.WarnBefore == "" {
+			c.Exemptions.WarnBefore = "168h"
+		}
+		if _, err := time.ParseDuration(c.Exemptions.WarnBefore); err != nil {
+			return nil, fmt.Errorf("invalid exemptions warn_before %q: %w", c.Exemptions.WarnBefore, err)
+		}
+		for _, e := range c.Exemptions.Exemptions {
+			if _, err := ParseExpiry(e.Expires); err != nil {
+				return nil, fmt.Errorf("invalid expires %q of exemption for %s: %w", e.Expires, e.Rule, err)
+			}
+		}
+	}
+
+	if c.SIEM != nil {
+		if err := validateSIEM(c.SIEM); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.EventBus != nil {
+		if err := validateEventBus(c.EventBus); err != nil {
+			return nil, err
+		}
+	}
+
+	if r := c.DecisionReport; r != nil {
+		if r.Interval == "" {
+			r.Interval = "168h"
+		}
+		if interval, err := time.ParseDuration(r.Interval); err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid decision_report interval %q", r.Interval)
+		}
+		if r.Top == 0 {
+			r.Top = 5
+		}
+		if r.Top < 0 {
+			return nil, fmt.Errorf("decision_report top must not be negative")
+		}
+		if r.Webhook != "" {
+			if u, err := url.Parse(r.Webhook); err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid decision_report webhook %q, must be a URL", r.Webhook)
+			}
+		}
+	}
+
+	for _, header := range c.ContextHeaders {
+		for _, sensitive := range sensitiveHeaders {
+			if strings.EqualFold(header, sensitive) {
+				return nil, fmt.Errorf("context_headers must not contain the credential header %q", header)
+			}
+		}
+	}
+
+	contextHeaders := c.ContextHeaders
+	if contextHeaders == nil {
+		contextHeaders = DefaultContextHeaders
+	}
+	for _, v := range c.Validators {
+		if v.Deregister == nil || v.Deregister.ApprovalHeader == "" {
+			continue
+		}
+		if !slices.ContainsFunc(contextHeaders, func(header string) bool { return strings.EqualFold(header, v.Deregister.ApprovalHeader) }) {
+			return nil, fmt.Errorf("approval_header %q of validator %s must be one of the context_headers", v.Deregister.ApprovalHeader, v.Name)
+		}
+	}
+
+	if c.Nomad != nil && c.Nomad.Discovery != nil {
+		d := c.Nomad.Discovery
+		if (d.ConsulService == "") == (d.SRVRecord == "") {
+			return nil, fmt.Errorf("nomad discovery needs either consul_service or srv_record")
+		}
+		if d.ConsulService != "" && d.ConsulTag == "" {
+			d.ConsulTag = "http"
+		}
+		if d.Scheme == "" {
+			d.Scheme = "http"
+			if c.Nomad.TLS != nil {
+				d.Scheme = "https"
+			}
+		}
+		if d.RefreshInterval == "" {
+			d.RefreshInterval = "30s"
+		}
+		if _, err := time.ParseDuration(d.RefreshInterval); err != nil {
+			return nil, fmt.Errorf("invalid nomad discovery refresh_interval %q: %w", d.RefreshInterval, err)
+		}
+	}
+
+	if c.Nomad != nil && c.Nomad.Retry != nil {
+		if err := validateNomadRetry(c.Nomad.Retry); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Sidecar != nil && c.Sidecar.NomadConfigDir == "" {
+		c.Sidecar.NomadConfigDir = "/etc/nomad.d"
+	}
+
+	if c.ConsulService != nil {
+		if c.ConsulService.Name == "" {
+			c.ConsulService.Name = "nacp"
+		}
+		if c.ConsulService.CheckInterval == "" {
+			c.ConsulService.CheckInterval = "10s"
+		}
+		if _, err := time.ParseDuration(c.ConsulService.CheckInterval); err != nil {
+			return nil, fmt.Errorf("invalid consul_service check_interval %q: %w", c.ConsulService.CheckInterval, err)
+		}
+	}
+
+	if c.LeaderElection != nil {
+		if c.LeaderElection.Path == "" {
+			c.LeaderElection.Path = "nacp/leader"
+		}
+		if c.LeaderElection.TTL == "" {
+			c.LeaderElection.TTL = "15s"
+		}
+	}
+
+	if id := c.Identity; id != nil {
+		if id.GroupsHeader != "" && id.LDAP != nil {
+			return nil, fmt.Errorf("identity groups_header can't be combined with ldap")
+		}
+		if err := validateAddresses("identity trusted_peers", id.TrustedPeers); err != nil {
+			return nil, err
+		}
+		headers := id.Source == "header" || id.GroupsHeader != "" || len(id.ClaimHeaders) > 0
+		if headers && len(id.TrustedPeers) == 0 && id.TrustedCAFile == "" {
+			return nil, fmt.Errorf("identity headers require trusted_peers or trusted_ca_file, otherwise any client can set them")
+		}
+		if id.TrustedCAFile != "" && (c.Tls == nil || c.Tls.CaFile == "" || c.Tls.NoClientCert) {
+			return nil, fmt.Errorf("identity trusted_ca_file needs a tls block with ca_file that verifies client certificates")
+		}
+	}
+
+	if c.Identity != nil && c.Identity.LDAP != nil {
+		if c.Identity.LDAP.UserFilter == "" {
+			c.Identity.LDAP.UserFilter = "(uid=%s)"
+		}
+		if c.Identity.LDAP.GroupAttribute == "" {
+			c.Identity.LDAP.GroupAttribute = "memberOf"
+		}
+		if c.Identity.LDAP.CacheTTL == "" {
+			c.Identity.LDAP.CacheTTL = "5m"
+		}
+	}
+
+	for _, w := range ruleWebhooks(c) {
+		if w.MaxResponseSize < 0 {
+			return nil, fmt.Errorf("webhook max_response_size of %s must not be negative", w.Endpoint)
+		}
+		if w.MaxResponseSize == 0 {
+			w.MaxResponseSize = 1 << 20
+		}
+	}
+
 	// set default on all Notation Verifiers, is there a better way to do this?
 	for _, v := range c.Validators {
 		if v.Notation != nil && v.Notation.MaxSigAttempts == 0 {
 			v.Notation.MaxSigAttempts = 50
 
 		}
+		if v.Notation != nil {
+			if err := validateNotation(v.Notation); err != nil {
+				return nil, fmt.Errorf("notation of validator %s: %w", v.Name, err)
+			}
+		}
+	}
+	for _, m := range c.Mutators {
+		if m.OpaRule != nil && m.OpaRule.Notation != nil {
+			if err := validateNotation(m.OpaRule.Notation); err != nil {
+				return nil, fmt.Errorf("notation of mutator %s: %w", m.Name, err)
+			}
+		}
 	}
 
 	return c, nil
 }
+
+// ruleWebhooks returns the webhooks of all mutators and validators.
+func ruleWebhooks(c *Config) []*Webhook {
+	var webhooks []*Webhook
+	for _, m := range c.Mutators {
+		if m.Webhook != nil {
+			webhooks = append(webhooks, m.Webhook)
+		}
+	}
+	for _, v := range c.Validators {
+		if v.Webhook != nil {
+			webhooks = append(webhooks, v.Webhook)
+		}
+	}
+	return webhooks
+}
+
+func validateAuth(a *Auth) error {
+	if a.OIDC == nil {
+		return fmt.Errorf("auth requires an oidc block")
+	}
+	if a.OIDC.Issuer == "" || a.OIDC.ClientID == "" || a.OIDC.RedirectURL == "" {
+		return fmt.Errorf("auth oidc requires issuer, client_id and redirect_url")
+	}
+	if !strings.HasSuffix(a.OIDC.RedirectURL, "/v1/nacp/auth/callback") {
+		return fmt.Errorf("auth oidc redirect_url must point to /v1/nacp/auth/callback of NACP")
+	}
+	if len(a.OIDC.Scopes) == 0 {
+		a.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+	if a.OIDC.IdentityClaim == "" {
+		a.OIDC.IdentityClaim = "email"
+	}
+	if a.OIDC.GroupsClaim == "" {
+		a.OIDC.GroupsClaim = "groups"
+	}
+	if a.SessionTTL == "" {
+		a.SessionTTL = "8h"
+	}
+	if _, err := time.ParseDuration(a.SessionTTL); err != nil {
+		return fmt.Errorf("invalid auth session_ttl %q: %w", a.SessionTTL, err)
+	}
+	if (a.TokenExchange == nil) == (len(a.TokenMappings) == 0) {
+		return fmt.Errorf("auth requires either token_exchange or token_mapping blocks")
+	}
+	return nil
+}
+
+func validateTokenVending(v *TokenVending) error {
+	issuers := map[string]bool{}
+	for _, issuer := range v.Issuers {
+		issuers[issuer.Name] = true
+	}
+	for i, role := range v.Roles {
+		if !issuers[role.Issuer] {
+			return fmt.Errorf("token_vending role %s uses the unknown issuer %q", role.Name, role.Issuer)
+		}
+		// without bound claims every pipeline of the issuer, e.g. of all GitHub repositories, would get a token
+		if len(role.BoundClaims) == 0 {
+			return fmt.Errorf("token_vending role %s requires bound_claims", role.Name)
+		}
+		if len(role.Policies) == 0 {
+			return fmt.Errorf("token_vending role %s requires policies", role.Name)
+		}
+		if role.TTL == "" {
+			v.Roles[i].TTL = "15m"
+		}
+		if _, err := time.ParseDuration(v.Roles[i].TTL); err != nil {
+			return fmt.Errorf("invalid ttl %q of token_vending role %s: %w", role.TTL, role.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateVirtualTokens(v *VirtualTokens) error {
+	if v.TTL == "" {
+		v.TTL = "1h"
+	}
+	if v.RenewBefore == "" {
+		v.RenewBefore = "10m"
+	}
+	ttl, err := time.ParseDuration(v.TTL)
+	if err != nil || ttl < time.Minute {
+		return fmt.Errorf("invalid virtual_tokens ttl %q, must be a duration of at least 1m", v.TTL)
+	}
+	renewBefore, err := time.ParseDuration(v.RenewBefore)
+	if err != nil || renewBefore < 0 || renewBefore >= ttl {
+		return fmt.Errorf("invalid virtual_tokens renew_before %q, must be a duration shorter than the ttl", v.RenewBefore)
+	}
+	secrets := map[string]bool{}
+	for _, credential := range v.Credentials {
+		if hash, err := hex.DecodeString(credential.SecretSHA256); err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf("virtual_tokens credential %s requires a hex encoded secret_sha256", credential.Name)
+		}
+		if secrets[strings.ToLower(credential.SecretSHA256)] {
+			return fmt.Errorf("virtual_tokens credential %s reuses the secret of another credential", credential.Name)
+		}
+		secrets[strings.ToLower(credential.SecretSHA256)] = true
+		if len(credential.Policies) == 0 {
+			return fmt.Errorf("virtual_tokens credential %s requires policies", credential.Name)
+		}
+	}
+	return nil
+}
+
+func validateSIEM(s *SIEM) error {
+	switch s.Format {
+	case SIEMFormatCEF, SIEMFormatLEEF:
+	default:
+		return fmt.Errorf("unknown siem format %q, must be cef or leef", s.Format)
+	}
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return fmt.Errorf("invalid siem address %q: %w", s.Address, err)
+	}
+	if s.Facility == "" {
+		s.Facility = "local0"
+	}
+	if _, ok := SyslogFacilities[s.Facility]; !ok {
+		return fmt.Errorf("unknown siem facility %q", s.Facility)
+	}
+	return validateExport("siem", &s.Decisions, &s.BufferSize, s.TLS)
+}
+
+func validateEventBus(b *EventBus) error {
+	switch b.Backend {
+	case EventBusNATS, EventBusKafka:
+	default:
+		return fmt.Errorf("unknown event_bus backend %q, must be nats or kafka", b.Backend)
+	}
+	u, err := url.Parse(b.Address)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid event_bus address %q, must be a URL", b.Address)
+	}
+	if b.Topic == "" {
+		return fmt.Errorf("event_bus requires a topic")
+	}
+	if b.Token != "" && b.Username != "" {
+		return fmt.Errorf("event_bus token can't be combined with username")
+	}
+	return validateExport("event_bus", &b.Decisions, &b.BufferSize, b.TLS)
+}
+
+func validateNetworkRules(class string, rules *NetworkRules) error {
+	if rules == nil {
+		return nil
+	}
+	return validateAddresses("network_acl "+class, slices.Concat(rules.Allow, rules.Deny))
+}
+
+// validateAddresses checks that the values are addresses or CIDRs.
+func validateAddresses(name string, values []string) error {
+	for _, value := range values {
+		if net.ParseIP(value) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return fmt.Errorf("invalid %s address %q, must be an address or CIDR", name, value)
+		}
+	}
+	return nil
+}
+
+func validateMaintenance(m *Maintenance) error {
+	if m.Message == "" {
+		m.Message = "NACP is in maintenance mode, job changes are frozen"
+	}
+	if len(m.Operations) == 0 {
+		m.Operations = []string{"register", "scale", "dispatch"}
+	}
+	for _, operation := range m.Operations {
+		if !slices.Contains(MaintenanceOperations, operation) {
+			return fmt.Errorf("unknown maintenance operation %q, must be one of %s", operation, strings.Join(MaintenanceOperations, ", "))
+		}
+	}
+	if m.RetryAfter != "" {
+		if after, err := time.ParseDuration(m.RetryAfter); err != nil || after < time.Second {
+			return fmt.Errorf("invalid maintenance retry_after %q, must be a duration of at least 1s", m.RetryAfter)
+		}
+	}
+	return nil
+}
+
+func validateUpstreamHeaders(u *UpstreamHeaders) error {
+	for i, rule := range u.Rules {
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid upstream_headers path pattern %q: %w", pattern, err)
+			}
+		}
+		if len(rule.Remove) == 0 && len(rule.Set) == 0 && len(rule.Add) == 0 {
+			return fmt.Errorf("upstream_headers rule %d must remove, set or add headers", i+1)
+		}
+	}
+	return nil
+}
+
+func validateReadRules(rules []ReadRule) error {
+	for _, rule := range rules {
+		if rule.OpaRule == nil {
+			return fmt.Errorf("read_rule %s requires an opa_rule block", rule.Name)
+		}
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid path pattern %q of read_rule %s: %w", pattern, rule.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateResponseScrubbing(r *ResponseScrubbing) error {
+	for _, rule := range r.Rules {
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid path pattern %q of response_scrubbing rule %s: %w", pattern, rule.Name, err)
+			}
+		}
+		if len(rule.Fields) == 0 {
+			return fmt.Errorf("response_scrubbing rule %s requires fields", rule.Name)
+		}
+		for _, field := range rule.Fields {
+			for _, segment := range strings.Split(field, ".") {
+				if _, err := path.Match(segment, ""); err != nil || segment == "" {
+					return fmt.Errorf("invalid field %q of response_scrubbing rule %s", field, rule.Name)
+				}
+			}
+		}
+		if rule.Action == "" {
+			rule.Action = ScrubActionRemove
+		}
+		if rule.Action != ScrubActionRemove && rule.Action != ScrubActionMask {
+			return fmt.Errorf("unknown action %q of response_scrubbing rule %s, must be remove or mask", rule.Action, rule.Name)
+		}
+	}
+	return nil
+}
+
+func validateAPIs(a *APIs) error {
+	groups := map[string]*APIGroup{"jobs": a.Jobs, "volumes": a.Volumes, "variables": a.Variables, "acl": a.ACL, "namespaces": a.Namespaces}
+	for name, group := range groups {
+		if group == nil {
+			continue
+		}
+		if group.Enforcement == "" {
+			group.Enforcement = "enforce"
+		}
+		if !slices.Contains(APIEnforcements, group.Enforcement) {
+			return fmt.Errorf("invalid apis %s enforcement %q, must be one of %s", name, group.Enforcement, strings.Join(APIEnforcements, ", "))
+		}
+	}
+	return nil
+}
+
+// IdempotentMethods can be retried by the nomad retry.
+var IdempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete}
+
+// DefaultRetryMethods are retried by the nomad retry without methods, writes are only retried if enabled.
+var DefaultRetryMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+func validateNomadRetry(r *NomadRetry) error {
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = 3
+	}
+	if r.MaxAttempts < 1 {
+		return fmt.Errorf("nomad retry max_attempts must be at least 1")
+	}
+	if r.InitialBackoff == "" {
+		r.InitialBackoff = "100ms"
+	}
+	if r.MaxBackoff == "" {
+		r.MaxBackoff = "2s"
+	}
+	initial, err := time.ParseDuration(r.InitialBackoff)
+	if err != nil || initial <= 0 {
+		return fmt.Errorf("invalid nomad retry initial_backoff %q, must be a positive duration", r.InitialBackoff)
+	}
+	max, err := time.ParseDuration(r.MaxBackoff)
+	if err != nil || max < initial {
+		return fmt.Errorf("invalid nomad retry max_backoff %q, must be a duration of at least the initial_backoff", r.MaxBackoff)
+	}
+	if r.Budget == 0 {
+		r.Budget = 0.2
+	}
+	if r.Budget < 0 || r.Budget > 1 {
+		return fmt.Errorf("nomad retry budget must be between 0 and 1")
+	}
+	if len(r.Methods) == 0 {
+		r.Methods = slices.Clone(DefaultRetryMethods)
+	}
+	for i, method := range r.Methods {
+		r.Methods[i] = strings.ToUpper(method)
+		if !slices.Contains(IdempotentMethods, r.Methods[i]) {
+			return fmt.Errorf("nomad retry method %s is not idempotent, must be one of %s", method, strings.Join(IdempotentMethods, ", "))
+		}
+	}
+	return nil
+}
+
+func validateNotation(n *NotationVerifierConfig) error {
+	if n.TrustPolicyFile == "" && len(n.ImagePolicies) == 0 {
+		return fmt.Errorf("a trust_policy_file or image_policy is required")
+	}
+	for _, p := range n.ImagePolicies {
+		if len(p.Registries) == 0 && len(p.Repositories) == 0 {
+			return fmt.Errorf("image_policy %s must match registries or repositories", p.Name)
+		}
+		for _, pattern := range p.Repositories {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid repository pattern %q of image_policy %s: %w", pattern, p.Name, err)
+			}
+		}
+		switch p.Level {
+		case "", "strict", "permissive", "audit", "skip":
+		default:
+			return fmt.Errorf("unknown level %q of image_policy %s, must be strict, permissive, audit or skip", p.Level, p.Name)
+		}
+	}
+	return nil
+}
+
+func validateMirror(m *Mirror) error {
+	u, err := url.Parse(m.Address)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid mirror address %q, must be a URL", m.Address)
+	}
+	switch m.Mode {
+	case "":
+		m.Mode = "register"
+	case "register", "plan":
+	default:
+		return fmt.Errorf("unknown mirror mode %q, must be register or plan", m.Mode)
+	}
+	for _, pattern := range m.Redact {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid mirror redact pattern %q: %w", pattern, err)
+		}
+	}
+	if m.BufferSize == 0 {
+		m.BufferSize = 100
+	}
+	if m.BufferSize < 0 {
+		return fmt.Errorf("mirror buffer_size must not be negative")
+	}
+	if m.TLS != nil && (m.TLS.CertFile == "") != (m.TLS.KeyFile == "") {
+		return fmt.Errorf("mirror tls requires both cert_file and key_file or none")
+	}
+	return nil
+}
+
+// validateExport defaults and checks the settings shared by the decision exports.
+func validateExport(block string, decisions *[]string, bufferSize *int, tls *ClientTLS) error {
+	if *decisions == nil {
+		*decisions = []string{"accepted", "warned", "rejected"}
+	}
+	for _, d := range *decisions {
+		switch d {
+		case "accepted", "warned", "rejected":
+		default:
+			return fmt.Errorf("unknown %s decision %q, must be accepted, warned or rejected", block, d)
+		}
+	}
+	if *bufferSize == 0 {
+		*bufferSize = 1000
+	}
+	if *bufferSize < 0 {
+		return fmt.Errorf("%s buffer_size must not be negative", block)
+	}
+	if tls != nil && (tls.CertFile == "") != (tls.KeyFile == "") {
+		return fmt.Errorf("%s tls requires both cert_file and key_file or none", block)
+	}
+	return nil
+}
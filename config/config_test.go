@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,9 +25,10 @@ func TestLoadConfig(t *testing.T) {
 			name: "default config",
 			args: args{name: "testdata/simple.hcl"},
 			want: &Config{
-				Port:     port,
-				Bind:     bind,
-				LogLevel: "info",
+				Port:            port,
+				Bind:            bind,
+				LogLevel:        "info",
+				MaxResponseSize: 16 << 20,
 				Nomad: &NomadServer{
 					Address: nomadAddr,
 				},
@@ -45,9 +47,10 @@ func TestLoadConfig(t *testing.T) {
 			name: "with admission controllers",
 			args: args{name: "testdata/with_admission.hcl"},
 			want: &Config{
-				Port:     port,
-				Bind:     bind,
-				LogLevel: "info",
+				Port:            port,
+				Bind:            bind,
+				LogLevel:        "info",
+				MaxResponseSize: 16 << 20,
 				Nomad: &NomadServer{
 					Address: nomadAddr,
 				},
@@ -100,3 +103,521 @@ func TestLoadConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfigFailsOnUnknownDegradedMode(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_degraded_mode.hcl")
+	assert.ErrorContains(t, err, "unknown degraded_mode")
+}
+
+func TestLoadConfigFailsOnInvalidTimezone(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_timezone.hcl")
+	assert.ErrorContains(t, err, "invalid timezone")
+}
+
+func TestLoadConfigFailsOnInvalidDrainTimeout(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_drain_timeout.hcl")
+	assert.ErrorContains(t, err, "invalid upgrade drain_timeout")
+}
+
+func TestLoadConfigConsulServiceDefaults(t *testing.T) {
+	c, err := LoadConfig("testdata/consul_service.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &ConsulService{Name: "nacp", Tags: []string{"policy"}, CheckInterval: "10s"}, c.ConsulService)
+}
+
+func TestLoadConfigFailsOnInvalidCheckInterval(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_check_interval.hcl")
+	assert.ErrorContains(t, err, "invalid consul_service check_interval")
+}
+
+func TestLoadConfigNomadDiscoveryDefaults(t *testing.T) {
+	c, err := LoadConfig("testdata/nomad_discovery.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &NomadDiscovery{
+		ConsulService:   "nomad",
+		ConsulTag:       "http",
+		Scheme:          "https",
+		RefreshInterval: "30s",
+	}, c.Nomad.Discovery)
+}
+
+func TestLoadConfigFailsOnAmbiguousNomadDiscovery(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_nomad_discovery.hcl")
+	assert.ErrorContains(t, err, "either consul_service or srv_record")
+}
+
+func TestLoadConfigNomadRetry(t *testing.T) {
+	c, err := LoadConfig("testdata/nomad_retry.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &NomadRetry{
+		MaxAttempts:    4,
+		InitialBackoff: "100ms",
+		MaxBackoff:     "2s",
+		Budget:         0.2,
+		Methods:        []string{"GET", "PUT"},
+	}, c.Nomad.Retry)
+}
+
+func TestLoadConfigNomadRetryDefaults(t *testing.T) {
+	c, err := LoadConfig("testdata/nomad_retry_defaults.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &NomadRetry{
+		MaxAttempts:    3,
+		InitialBackoff: "100ms",
+		MaxBackoff:     "2s",
+		Budget:         0.2,
+		Methods:        []string{"GET", "HEAD", "OPTIONS"},
+	}, c.Nomad.Retry)
+}
+
+func TestLoadConfigFailsOnNonIdempotentRetryMethod(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_nomad_retry.hcl")
+	assert.ErrorContains(t, err, "nomad retry method POST is not idempotent")
+}
+
+func TestLoadConfigFailsOnUnknownForwardedForMode(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_forwarded_headers.hcl")
+	assert.ErrorContains(t, err, "unknown forwarded_headers x_forwarded_for")
+}
+
+func TestLoadConfigFailsOnH2CWithTLS(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_http2.hcl")
+	assert.ErrorContains(t, err, "http2 h2c can't be combined with tls")
+}
+
+func TestLoadConfigCORS(t *testing.T) {
+	c, err := LoadConfig("testdata/cors.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &CORS{
+		AllowedOrigins: []string{"https://nomad.example.com"},
+		AllowedHeaders: DefaultCORSHeaders,
+		MaxAge:         "10m",
+	}, c.CORS)
+}
+
+func TestLoadConfigFailsOnCredentialsForAnyOrigin(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_cors.hcl")
+	assert.ErrorContains(t, err, "cors allow_credentials can't be combined with the * origin")
+}
+
+func TestLoadConfigAuth(t *testing.T) {
+	c, err := LoadConfig("testdata/auth.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &Auth{
+		OIDC: &OIDC{
+			Issuer:        "https://sso.example.com",
+			ClientID:      "nacp",
+			ClientSecret:  "secret",
+			RedirectURL:   "https://nacp.example.com/v1/nacp/auth/callback",
+			Scopes:        []string{"openid", "profile", "email"},
+			IdentityClaim: "email",
+			GroupsClaim:   "groups",
+		},
+		SessionTTL:    "8h",
+		TokenMappings: []TokenMapping{{Name: "ops", Groups: []string{"ops"}, Token: "ops-token"}},
+	}, c.Auth)
+}
+
+func TestLoadConfigFailsOnAuthWithoutTokens(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_auth.hcl")
+	assert.ErrorContains(t, err, "auth requires either token_exchange or token_mapping blocks")
+}
+
+func TestLoadConfigTokenVending(t *testing.T) {
+	c, err := LoadConfig("testdata/token_vending.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &TokenVending{
+		Issuers: []VendingIssuer{{Name: "github", URL: "https://token.actions.githubusercontent.com", Audience: "nacp"}},
+		Roles: []VendingRole{{
+			Name:        "deploy-app",
+			Issuer:      "github",
+			BoundClaims: map[string]string{"repository": "acme/app", "ref": "refs/heads/main"},
+			Policies:    []string{"deploy-app"},
+			TTL:         "15m",
+			OpaRule:     &OpaRule{Query: "errors = data.vending.errors", Filename: "vending.rego"},
+		}},
+	}, c.TokenVending)
+}
+
+func TestLoadConfigFailsOnUnboundVendingRole(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_token_vending.hcl")
+	assert.ErrorContains(t, err, "token_vending role deploy-app requires bound_claims")
+}
+
+func TestLoadConfigVirtualTokens(t *testing.T) {
+	c, err := LoadConfig("testdata/virtual_tokens.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &VirtualTokens{
+		TTL:         "1h",
+		RenewBefore: "10m",
+		Exclusive:   true,
+		Credentials: []VirtualCredential{{
+			Name:         "ci",
+			SecretSHA256: "8a279a73bd3a092854604a2e74e124834d89da2e87ee7facc40582a65a7c6f3e",
+			Policies:     []string{"deploy"},
+		}},
+	}, c.VirtualTokens)
+}
+
+func TestLoadConfigFailsOnPlainVirtualTokenSecret(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_virtual_tokens.hcl")
+	assert.ErrorContains(t, err, "virtual_tokens credential ci requires a hex encoded secret_sha256")
+}
+
+func TestLoadConfigAdmin(t *testing.T) {
+	c, err := LoadConfig("testdata/admin.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:6465", c.AdminBind)
+	assert.Equal(t, []string{"8a279a73bd3a092854604a2e74e124834d89da2e87ee7facc40582a65a7c6f3e"}, c.AdminTokenSHA256)
+}
+
+func TestLoadConfigFailsOnPlainAdminToken(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_admin.hcl")
+	assert.ErrorContains(t, err, "admin_token_sha256 must be hex encoded SHA-256 hashes")
+}
+
+func TestLoadConfigFailsOnSensitiveContextHeader(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_context_headers.hcl")
+	assert.ErrorContains(t, err, "context_headers must not contain the credential header \"x-nomad-token\"")
+}
+
+func TestLoadConfigExemptions(t *testing.T) {
+	c, err := LoadConfig("testdata/exemptions.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &Exemptions{
+		WarnBefore: "168h",
+		Exemptions: []Exemption{{Rule: "costcenter", Job: "legacy-*", Expires: "2026-12-31", Reason: "migration"}},
+	}, c.Exemptions)
+}
+
+func TestLoadConfigFailsOnInvalidExemptionExpiry(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_exemption.hcl")
+	assert.ErrorContains(t, err, "invalid expires \"next week\" of exemption for costcenter")
+}
+
+func TestLoadConfigSIEM(t *testing.T) {
+	c, err := LoadConfig("testdata/siem.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &SIEM{
+		Format:     "cef",
+		Address:    "siem.example.com:6514",
+		TLS:        &ClientTLS{CaFile: "/etc/nacp/siem-ca.pem"},
+		Facility:   "local0",
+		Decisions:  []string{"accepted", "warned", "rejected"},
+		BufferSize: 1000,
+	}, c.SIEM)
+}
+
+func TestLoadConfigFailsOnUnknownSIEMFormat(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_siem.hcl")
+	assert.ErrorContains(t, err, "unknown siem format \"json\", must be cef or leef")
+}
+
+func TestLoadConfigEventBus(t *testing.T) {
+	c, err := LoadConfig("testdata/event_bus.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &EventBus{
+		Backend:    "nats",
+		Address:    "nats://nats.service.consul:4222",
+		Topic:      "nacp.decisions",
+		Token:      "s3cr3t",
+		Decisions:  []string{"accepted", "warned", "rejected"},
+		BufferSize: 1000,
+	}, c.EventBus)
+}
+
+func TestLoadConfigFailsOnEventBusAddressWithoutScheme(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_event_bus.hcl")
+	assert.ErrorContains(t, err, "invalid event_bus address \"nats.service.consul:4222\", must be a URL")
+}
+
+func TestLoadConfigDecisionReport(t *testing.T) {
+	c, err := LoadConfig("testdata/decision_report.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &DecisionReport{Interval: "168h", Webhook: "https://hooks.example.com/nacp", Top: 5}, c.DecisionReport)
+}
+
+func TestLoadConfigFailsOnInvalidReportInterval(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_decision_report.hcl")
+	assert.ErrorContains(t, err, "invalid decision_report interval \"weekly\"")
+}
+
+func TestLoadConfigOpaLimits(t *testing.T) {
+	c, err := LoadConfig("testdata/opa_limits.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &OpaLimits{Timeout: "5s", MaxSteps: 1000000, MaxHeapBytes: 1073741824}, c.OpaLimits)
+}
+
+func TestLoadConfigNotationMirrors(t *testing.T) {
+	c, err := LoadConfig("testdata/notation_mirror.hcl")
+	require.NoError(t, err)
+	require.Len(t, c.Validators, 1)
+	notation := c.Validators[0].Notation
+	assert.Equal(t, 8, notation.Parallelism)
+	assert.Equal(t, "http://proxy.example.com:3128", notation.ProxyURL)
+	assert.Equal(t, []*RegistryMirror{
+		{Registry: "docker.io", Endpoint: "mirror.example.com/dockerhub"},
+		{Registry: "ghcr.io", Endpoint: "mirror.example.com:5000", PlainHTTP: true},
+	}, notation.Mirrors)
+}
+
+func TestLoadConfigImagePolicies(t *testing.T) {
+	c, err := LoadConfig("testdata/image_policy.hcl")
+	require.NoError(t, err)
+	policies := c.Validators[0].Notation.ImagePolicies
+	require.Len(t, policies, 2)
+	assert.Equal(t, &ImagePolicy{
+		Name:        "internal",
+		Registries:  []string{"registry.example.com"},
+		TrustStores: []string{"ca:internal"},
+		Identities:  []string{"*"},
+	}, policies[0])
+	assert.Equal(t, []string{"ghcr.io/acme/*"}, policies[1].Repositories)
+	assert.Equal(t, "audit", policies[1].Level)
+}
+
+func TestLoadConfigFailsOnInvalidImagePolicy(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_image_policy.hcl")
+	assert.ErrorContains(t, err, `unknown level "lenient" of image_policy acme`)
+
+	_, err = LoadConfig("testdata/invalid_notation.hcl")
+	assert.ErrorContains(t, err, "a trust_policy_file or image_policy is required")
+}
+
+func TestLoadConfigFailsOnInvalidOpaTimeout(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_opa_limits.hcl")
+	assert.ErrorContains(t, err, "invalid opa_limits timeout \"forever\"")
+}
+
+func TestLoadConfigWebhookResponseSize(t *testing.T) {
+	c, err := LoadConfig("testdata/webhook_limits.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1<<20), c.Validators[0].Webhook.MaxResponseSize)
+	assert.Equal(t, int64(4096), c.Mutators[0].Webhook.MaxResponseSize)
+}
+
+func TestLoadConfigFailsOnNegativeWebhookResponseSize(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_webhook_limits.hcl")
+	assert.ErrorContains(t, err, "webhook max_response_size of http://localhost:8080/validate must not be negative")
+}
+
+func TestLoadConfigPatchPolicy(t *testing.T) {
+	c, err := LoadConfig("testdata/patch_policy.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &PatchPolicy{
+		ProtectedPaths: []string{"/ID", "/Namespace", "/VaultNamespace", "/VaultToken", "/TaskGroups/*/Tasks/*/Vault"},
+		MaxOperations:  20,
+		TypeChecks:     true,
+	}, c.PatchPolicy)
+}
+
+func TestLoadConfigFailsOnInvalidProtectedPath(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_patch_policy.hcl")
+	assert.ErrorContains(t, err, "patch_policy protected path \"Namespace\" must be a JSON pointer starting with /")
+}
+
+func TestLoadConfigRevalidation(t *testing.T) {
+	c, err := LoadConfig("testdata/revalidation.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &Revalidation{MaxPasses: 3}, c.Revalidation)
+}
+
+func TestLoadConfigFailsOnSinglePassRevalidation(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_revalidation.hcl")
+	assert.ErrorContains(t, err, "revalidation max_passes must be at least 2")
+}
+
+func TestLoadConfigMutatorConflicts(t *testing.T) {
+	c, err := LoadConfig("testdata/mutator_conflicts.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &MutatorConflicts{Strategy: "fail"}, c.MutatorConflicts)
+}
+
+func TestLoadConfigFailsOnInvalidConflictStrategy(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_mutator_conflicts.hcl")
+	assert.ErrorContains(t, err, "invalid mutator_conflicts strategy \"merge\"")
+}
+
+func TestLoadConfigMirror(t *testing.T) {
+	c, err := LoadConfig("testdata/mirror.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &Mirror{
+		Address:     "https://nomad.staging:4646",
+		Token:       "staging-token",
+		Mode:        "plan",
+		Namespaces:  map[string]string{"prod": "staging", "*": "sandbox"},
+		Datacenters: []string{"staging-1"},
+		BufferSize:  100,
+	}, c.Mirror)
+}
+
+func TestLoadConfigFailsOnUnknownMirrorMode(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_mirror.hcl")
+	assert.ErrorContains(t, err, "unknown mirror mode \"shadow\", must be register or plan")
+}
+
+func TestLoadConfigTokenCache(t *testing.T) {
+	c, err := LoadConfig("testdata/token_cache.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &TokenCache{TTL: "30s", ResolvePolicies: true}, c.TokenCache)
+}
+
+func TestLoadConfigFailsOnInvalidTokenCacheTTL(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_token_cache.hcl")
+	assert.ErrorContains(t, err, "invalid token_cache ttl \"-1m\", must be a positive duration")
+}
+
+func TestLoadConfigMaintenance(t *testing.T) {
+	c, err := LoadConfig("testdata/maintenance.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &Maintenance{
+		Enabled:    true,
+		Message:    "NACP is in maintenance mode, job changes are frozen",
+		Operations: []string{"register", "scale", "dispatch"},
+		RetryAfter: "10m",
+	}, c.Maintenance)
+}
+
+func TestLoadConfigFailsOnUnknownMaintenanceOperation(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_maintenance.hcl")
+	assert.ErrorContains(t, err, "unknown maintenance operation \"plan\"")
+}
+
+func TestLoadConfigUpstreamHeaders(t *testing.T) {
+	c, err := LoadConfig("testdata/upstream_headers.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &UpstreamHeaders{Rules: []*HeaderRule{
+		{Remove: []string{"Authorization"}},
+		{
+			Paths:   []string{"/v1/jobs", "/v1/job/*"},
+			Methods: []string{"PUT", "POST"},
+			Set:     map[string]string{"X-Nomad-Token": "management-token"},
+		},
+	}}, c.UpstreamHeaders)
+}
+
+func TestLoadConfigFailsOnUpstreamHeaderRuleWithoutChanges(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_upstream_headers.hcl")
+	assert.ErrorContains(t, err, "upstream_headers rule 1 must remove, set or add headers")
+}
+
+func TestLoadConfigResponseScrubbing(t *testing.T) {
+	c, err := LoadConfig("testdata/response_scrubbing.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &ResponseScrubbing{Rules: []*ScrubRule{
+		{Name: "job-secrets", Paths: []string{"/v1/job/*"}, Fields: []string{"Meta.*_secret", "TaskGroups.*.Tasks.*.Vault"}, Action: ScrubActionRemove},
+		{Name: "env", Fields: []string{"TaskGroups.*.Tasks.*.Env.*_TOKEN"}, Action: ScrubActionMask},
+	}}, c.ResponseScrubbing)
+}
+
+func TestLoadConfigFailsOnInvalidScrubField(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_response_scrubbing.hcl")
+	assert.ErrorContains(t, err, `invalid field "Meta..secret" of response_scrubbing rule job-secrets`)
+}
+
+func TestLoadConfigReadRules(t *testing.T) {
+	c, err := LoadConfig("testdata/read_rules.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, []ReadRule{{
+		Name:         "namespaces",
+		Paths:        []string{"/v1/jobs", "/v1/allocations", "/v1/allocation/*"},
+		OpaRule:      &OpaRule{Query: "errors = data.reads.errors", Filename: "reads.rego"},
+		ResolveToken: true,
+	}}, c.ReadRules)
+}
+
+func TestLoadConfigFailsOnReadRuleWithoutPolicy(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_read_rules.hcl")
+	assert.ErrorContains(t, err, "read_rule namespaces requires an opa_rule block")
+}
+
+func TestLoadConfigAPIs(t *testing.T) {
+	c, err := LoadConfig("testdata/apis.hcl")
+	require.NoError(t, err)
+	disabled := false
+	assert.Equal(t, &APIs{
+		Jobs:       &APIGroup{Enforcement: "audit"},
+		Variables:  &APIGroup{Enforcement: "enforce"},
+		Namespaces: &APIGroup{Enabled: &disabled, Enforcement: "enforce"},
+	}, c.APIs)
+}
+
+func TestLoadConfigFailsOnUnknownAPIEnforcement(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_apis.hcl")
+	assert.ErrorContains(t, err, "invalid apis volumes enforcement \"warn\", must be one of enforce, audit")
+}
+
+func TestLoadConfigNetworkACL(t *testing.T) {
+	c, err := LoadConfig("testdata/network_acl.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &NetworkACL{
+		Writes: &NetworkRules{Allow: []string{"10.0.0.0/8", "192.168.1.10"}, Deny: []string{"10.66.0.0/16"}},
+	}, c.NetworkACL)
+}
+
+func TestLoadConfigFailsOnInvalidNetworkACL(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_network_acl.hcl")
+	assert.ErrorContains(t, err, "invalid network_acl reads address \"office\", must be an address or CIDR")
+}
+
+func TestLoadConfigClientCert(t *testing.T) {
+	c, err := LoadConfig("testdata/client_cert.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &ClientCert{Bindings: []CertBinding{
+		{SANs: []string{"*.ci.example.com"}, Policies: []string{"deploy"}},
+		{OUs: []string{"platform"}, Policies: []string{"ops-admin"}},
+	}}, c.ClientCert)
+}
+
+func TestLoadConfigFailsOnClientCertWithoutTLS(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_client_cert.hcl")
+	assert.ErrorContains(t, err, "client_cert needs a tls block with ca_file")
+}
+
+func TestLoadConfigIdentityHeaders(t *testing.T) {
+	c, err := LoadConfig("testdata/identity_headers.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Source:       "header",
+		Header:       "X-Boundary-User",
+		GroupsHeader: "X-Boundary-Groups",
+		ClaimHeaders: map[string]string{"email": "X-Boundary-Email"},
+		TrustedPeers: []string{"10.0.5.0/24"},
+	}, c.Identity)
+}
+
+func TestLoadConfigFailsOnInvalidIdentityTrustedPeer(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_identity_headers.hcl")
+	assert.ErrorContains(t, err, "invalid identity trusted_peers address \"boundary.example.com\"")
+}
+
+func TestLoadConfigFailsOnUntrustedIdentityHeaders(t *testing.T) {
+	_, err := LoadConfig("testdata/untrusted_identity_headers.hcl")
+	assert.ErrorContains(t, err, "identity headers require trusted_peers or trusted_ca_file")
+}
+
+func TestLoadConfigDeregister(t *testing.T) {
+	c, err := LoadConfig("testdata/deregister.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, &Deregister{
+		Selector:         &Selector{Namespaces: []string{"system"}},
+		AllowStop:        true,
+		OverridePolicies: []string{"ops-admin"},
+		ApprovalHeader:   "X-Change-Approval",
+	}, c.Validators[0].Deregister)
+}
+
+func TestLoadConfigFailsOnApprovalHeaderWithoutContextHeader(t *testing.T) {
+	_, err := LoadConfig("testdata/invalid_deregister.hcl")
+	assert.ErrorContains(t, err, "approval_header \"X-Change-Approval\" of validator critical must be one of the context_headers")
+}
+
+func TestParseExpiry(t *testing.T) {
+	expires, err := ParseExpiry("2026-12-31")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), expires, "a date is valid until the end of the day")
+
+	expires, err = ParseExpiry("2026-12-31T08:00:00+01:00")
+	require.NoError(t, err)
+	assert.True(t, expires.Equal(time.Date(2026, 12, 31, 7, 0, 0, 0, time.UTC)))
+}
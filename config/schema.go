@@ -0,0 +1,113 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ValidatorTypes and MutatorTypes are the rule types pkg/admission builds, keep them in sync.
+var (
+	ValidatorTypes = []string{
+		"opa", "webhook", "notation", "quota", "protected_jobs", "constraints", "static_ports", "connect", "naming",
+		"template", "secrets", "limits", "update", "devices", "priority", "periodic", "volumes", "workload_identity",
+		"ownership", "placement", "deregister", "disruption",
+	}
+	MutatorTypes = []string{
+		"opa_json_patch", "json_patch_webhook", "consul_intentions", "placement", "devices", "priority", "meta",
+	}
+)
+
+// labelValues restricts the first label of a block to the known values.
+var labelValues = map[reflect.Type][]string{
+	reflect.TypeOf(Validator{}): ValidatorTypes,
+	reflect.TypeOf(Mutator{}):   MutatorTypes,
+}
+
+// Schema returns a JSON schema of the config in the JSON syntax of HCL, e.g. a config.json or
+// the output of hcl2json. Labeled blocks are objects keyed by their labels, repeated blocks may be arrays.
+func Schema() map[string]interface{} {
+	s := bodySchema(reflect.TypeOf(Config{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "NACP configuration"
+	return s
+}
+
+// bodySchema describes the attributes and blocks of a struct decoded by gohcl.
+func bodySchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		name, kind, _ := strings.Cut(t.Field(i).Tag.Get("hcl"), ",")
+		if name == "" {
+			continue
+		}
+		switch kind {
+		case "label":
+		case "block":
+			properties[name] = blockSchema(t.Field(i).Type)
+		case "optional":
+			properties[name] = attributeSchema(t.Field(i).Type)
+		default:
+			properties[name] = attributeSchema(t.Field(i).Type)
+			required = append(required, name)
+		}
+	}
+	s := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// blockSchema nests the body in one object per label, e.g. validator "opa" "name" { ... }
+// is {"validator": {"opa": {"name": { ... }}}}.
+func blockSchema(t reflect.Type) map[string]interface{} {
+	repeated := t.Kind() == reflect.Slice
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var labels int
+	for i := 0; i < t.NumField(); i++ {
+		if strings.HasSuffix(t.Field(i).Tag.Get("hcl"), ",label") {
+			labels++
+		}
+	}
+	s := bodySchema(t)
+	for i := labels - 1; i >= 0; i-- {
+		s = map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": s,
+		}
+		if values, ok := labelValues[t]; ok && i == 0 {
+			s["propertyNames"] = map[string]interface{}{"enum": values}
+		}
+	}
+	if !repeated {
+		return s
+	}
+	return map[string]interface{}{
+		"anyOf": []interface{}{s, map[string]interface{}{"type": "array", "items": s}},
+	}
+}
+
+func attributeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": attributeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": attributeSchema(t.Elem())}
+	}
+	return map[string]interface{}{}
+}
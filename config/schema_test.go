@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaJSON is the schema as a config pipeline would read it.
+func schemaJSON(t *testing.T) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(Schema())
+	require.NoError(t, err)
+	s := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(data, &s))
+	return s
+}
+
+// checkSchema validates v against the subset of JSON schema Schema uses.
+func checkSchema(s map[string]interface{}, v interface{}, path string) error {
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		for _, alt := range anyOf {
+			if checkSchema(alt.(map[string]interface{}), v, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s matches none of the alternatives", path)
+	}
+	switch s["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+		properties, _ := s["properties"].(map[string]interface{})
+		required, _ := s["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		for key, value := range obj {
+			if names, ok := s["propertyNames"].(map[string]interface{}); ok && !slices.Contains(names["enum"].([]interface{}), any(key)) {
+				return fmt.Errorf("%s.%s is not allowed", path, key)
+			}
+			sub, ok := properties[key].(map[string]interface{})
+			if !ok {
+				sub, ok = s["additionalProperties"].(map[string]interface{})
+			}
+			if !ok {
+				return fmt.Errorf("%s.%s is unknown", path, key)
+			}
+			if err := checkSchema(sub, value, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		for i, item := range items {
+			if err := checkSchema(s["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string", "boolean", "integer", "number":
+		ok := false
+		switch v.(type) {
+		case string:
+			ok = s["type"] == "string"
+		case bool:
+			ok = s["type"] == "boolean"
+		case float64:
+			ok = s["type"] == "number" || s["type"] == "integer" && v.(float64) == float64(int64(v.(float64)))
+		}
+		if !ok {
+			return fmt.Errorf("%s must be of type %s", path, s["type"])
+		}
+	}
+	return nil
+}
+
+func TestSchema(t *testing.T) {
+	s := schemaJSON(t)
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", s["$schema"])
+
+	properties := s["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "integer"}, properties["port"])
+	assert.Equal(t, map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}, properties["trusted_proxies"])
+
+	nomad := properties["nomad"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"address"}, nomad["required"])
+
+	validator := properties["validator"].(map[string]interface{})["anyOf"].([]interface{})[0].(map[string]interface{})
+	assert.Len(t, validator["propertyNames"].(map[string]interface{})["enum"], len(ValidatorTypes))
+	body := validator["additionalProperties"].(map[string]interface{})["additionalProperties"].(map[string]interface{})
+	assert.Contains(t, body["properties"], "opa_rule")
+	assert.NotContains(t, body["properties"], "type", "labels are keys, not attributes")
+}
+
+func TestSchemaMatchesConfig(t *testing.T) {
+	s := schemaJSON(t)
+
+	data, err := os.ReadFile("testdata/with_admission.json")
+	require.NoError(t, err)
+	doc := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.NoError(t, checkSchema(s, doc, "config"))
+
+	// the schema describes what LoadConfig accepts
+	c, err := LoadConfig("testdata/with_admission.json")
+	require.NoError(t, err)
+	assert.Equal(t, "costcenter", c.Validators[0].Name)
+	assert.Equal(t, "opa_json_patch", c.Mutators[0].Type)
+
+	tt := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{name: "unknown attribute", doc: `{"prot": 6464}`, want: "config.prot is unknown"},
+		{name: "wrong type", doc: `{"port": "6464"}`, want: "config.port must be of type integer"},
+		{name: "missing required attribute", doc: `{"nomad": {}}`, want: "config.nomad.address is required"},
+		{name: "unknown rule type", doc: `{"validator": {"opaa": {"x": {}}}}`, want: "config.validator matches none of the alternatives"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal([]byte(tc.doc), &doc))
+			assert.EqualError(t, checkSchema(s, doc, "config"), tc.want)
+		})
+	}
+}
@@ -0,0 +1,9 @@
+apis {
+  jobs {
+    enforcement = "audit"
+  }
+  variables {}
+  namespaces {
+    enabled = false
+  }
+}
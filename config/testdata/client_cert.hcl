@@ -0,0 +1,16 @@
+tls {
+  cert_file = "cert.pem"
+  key_file  = "key.pem"
+  ca_file   = "ca.pem"
+}
+
+client_cert {
+  binding {
+    sans     = ["*.ci.example.com"]
+    policies = ["deploy"]
+  }
+  binding {
+    ous      = ["platform"]
+    policies = ["ops-admin"]
+  }
+}
@@ -0,0 +1,3 @@
+cors {
+  allowed_origins = ["https://nomad.example.com"]
+}
@@ -0,0 +1,3 @@
+decision_report {
+  webhook = "https://hooks.example.com/nacp"
+}
@@ -0,0 +1,14 @@
+context_headers = ["X-Request-Id", "X-Change-Approval"]
+
+validator "deregister" "critical" {
+  resolve_token = true
+
+  deregister {
+    selector {
+      namespaces = ["system"]
+    }
+    allow_stop        = true
+    override_policies = ["ops-admin"]
+    approval_header   = "X-Change-Approval"
+  }
+}
@@ -0,0 +1,6 @@
+event_bus {
+  backend = "nats"
+  address = "nats://nats.service.consul:4222"
+  topic   = "nacp.decisions"
+  token   = "s3cr3t"
+}
@@ -0,0 +1,7 @@
+exemptions {
+  exemption "costcenter" {
+    job     = "legacy-*"
+    expires = "2026-12-31"
+    reason  = "migration"
+  }
+}
@@ -0,0 +1,9 @@
+identity {
+  source        = "header"
+  header        = "X-Boundary-User"
+  groups_header = "X-Boundary-Groups"
+  claim_headers = {
+    email = "X-Boundary-Email"
+  }
+  trusted_peers = ["10.0.5.0/24"]
+}
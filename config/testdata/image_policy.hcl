@@ -0,0 +1,18 @@
+validator "notation" "signed_images" {
+  notation {
+    trust_store_dir = "trust_store"
+
+    image_policy "internal" {
+      registries   = ["registry.example.com"]
+      trust_stores = ["ca:internal"]
+      identities   = ["*"]
+    }
+
+    image_policy "acme" {
+      repositories = ["ghcr.io/acme/*"]
+      trust_stores = ["ca:acme"]
+      identities   = ["x509.subject: C=US, ST=WA, O=Acme, CN=release"]
+      level        = "audit"
+    }
+  }
+}
@@ -0,0 +1 @@
+admin_token_sha256 = ["s3cr3t"]
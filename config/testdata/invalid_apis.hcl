@@ -0,0 +1,5 @@
+apis {
+  volumes {
+    enforcement = "warn"
+  }
+}
@@ -0,0 +1,8 @@
+auth {
+  oidc {
+    issuer        = "https://sso.example.com"
+    client_id     = "nacp"
+    client_secret = "secret"
+    redirect_url  = "https://nacp.example.com/v1/nacp/auth/callback"
+  }
+}
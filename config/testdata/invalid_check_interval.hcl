@@ -0,0 +1,3 @@
+consul_service {
+  check_interval = "often"
+}
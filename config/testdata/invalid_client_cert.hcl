@@ -0,0 +1,6 @@
+client_cert {
+  binding {
+    ous      = ["platform"]
+    policies = ["ops-admin"]
+  }
+}
@@ -0,0 +1 @@
+context_headers = ["User-Agent", "x-nomad-token"]
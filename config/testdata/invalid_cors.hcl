@@ -0,0 +1,4 @@
+cors {
+  allowed_origins   = ["*"]
+  allow_credentials = true
+}
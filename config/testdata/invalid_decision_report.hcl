@@ -0,0 +1,3 @@
+decision_report {
+  interval = "weekly"
+}
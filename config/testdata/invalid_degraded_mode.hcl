@@ -0,0 +1 @@
+degraded_mode = "ignore_everything"
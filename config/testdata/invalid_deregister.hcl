@@ -0,0 +1,5 @@
+validator "deregister" "critical" {
+  deregister {
+    approval_header = "X-Change-Approval"
+  }
+}
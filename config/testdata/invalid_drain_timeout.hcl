@@ -0,0 +1,3 @@
+upgrade {
+  drain_timeout = "soon"
+}
@@ -0,0 +1,5 @@
+event_bus {
+  backend = "nats"
+  address = "nats.service.consul:4222"
+  topic   = "nacp.decisions"
+}
@@ -0,0 +1,6 @@
+exemptions {
+  exemption "costcenter" {
+    expires = "next week"
+    reason  = "migration"
+  }
+}
@@ -0,0 +1,3 @@
+forwarded_headers {
+  x_forwarded_for = "prepend"
+}
@@ -0,0 +1,8 @@
+tls {
+  cert_file = "cert.pem"
+  key_file  = "key.pem"
+  ca_file   = "ca.pem"
+}
+http2 {
+  h2c = true
+}
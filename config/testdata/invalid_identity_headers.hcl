@@ -0,0 +1,5 @@
+identity {
+  source        = "header"
+  header        = "X-Boundary-User"
+  trusted_peers = ["boundary.example.com"]
+}
@@ -0,0 +1,12 @@
+validator "notation" "signed_images" {
+  notation {
+    trust_store_dir = "trust_store"
+
+    image_policy "acme" {
+      repositories = ["ghcr.io/acme/*"]
+      trust_stores = ["ca:acme"]
+      identities   = ["*"]
+      level        = "lenient"
+    }
+  }
+}
@@ -0,0 +1,3 @@
+maintenance {
+  operations = ["register", "plan"]
+}
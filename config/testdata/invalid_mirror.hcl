@@ -0,0 +1,4 @@
+mirror {
+  address = "https://nomad.staging:4646"
+  mode    = "shadow"
+}
@@ -0,0 +1,3 @@
+mutator_conflicts {
+  strategy = "merge"
+}
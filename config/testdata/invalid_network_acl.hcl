@@ -0,0 +1,5 @@
+network_acl {
+  reads {
+    allow = ["office"]
+  }
+}
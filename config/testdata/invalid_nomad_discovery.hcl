@@ -0,0 +1,7 @@
+nomad {
+  address = "http://localhost:4646"
+  discovery {
+    consul_service = "nomad"
+    srv_record     = "_http._tcp.nomad.service.consul"
+  }
+}
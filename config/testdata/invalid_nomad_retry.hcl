@@ -0,0 +1,6 @@
+nomad {
+  address = "http://localhost:4646"
+  retry {
+    methods = ["POST"]
+  }
+}
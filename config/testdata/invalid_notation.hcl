@@ -0,0 +1,5 @@
+validator "notation" "signed_images" {
+  notation {
+    trust_store_dir = "trust_store"
+  }
+}
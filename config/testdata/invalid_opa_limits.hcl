@@ -0,0 +1,3 @@
+opa_limits {
+  timeout = "forever"
+}
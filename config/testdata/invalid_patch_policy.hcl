@@ -0,0 +1,3 @@
+patch_policy {
+  protected_paths = ["Namespace"]
+}
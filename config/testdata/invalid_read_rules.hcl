@@ -0,0 +1,3 @@
+read_rule "namespaces" {
+  paths = ["/v1/jobs"]
+}
@@ -0,0 +1,5 @@
+response_scrubbing {
+  rule "job-secrets" {
+    fields = ["Meta..secret"]
+  }
+}
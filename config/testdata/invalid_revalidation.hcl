@@ -0,0 +1,3 @@
+revalidation {
+  max_passes = 1
+}
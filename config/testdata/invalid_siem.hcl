@@ -0,0 +1,4 @@
+siem {
+  format  = "json"
+  address = "siem.example.com:6514"
+}
@@ -0,0 +1,3 @@
+time {
+  timezone = "Mars/Olympus_Mons"
+}
@@ -0,0 +1,3 @@
+token_cache {
+  ttl = "-1m"
+}
@@ -0,0 +1,11 @@
+token_vending {
+  issuer "github" {
+    url      = "https://token.actions.githubusercontent.com"
+    audience = "nacp"
+  }
+  role "deploy-app" {
+    issuer       = "github"
+    bound_claims = {}
+    policies     = ["deploy-app"]
+  }
+}
@@ -0,0 +1,5 @@
+upstream_headers {
+  rule {
+    paths = ["/v1/job/*"]
+  }
+}
@@ -0,0 +1,6 @@
+virtual_tokens {
+  credential "ci" {
+    secret_sha256 = "nacp_example"
+    policies      = ["deploy"]
+  }
+}
@@ -0,0 +1,7 @@
+validator "webhook" "owner" {
+  webhook {
+    endpoint          = "http://localhost:8080/validate"
+    method            = "POST"
+    max_response_size = -1
+  }
+}
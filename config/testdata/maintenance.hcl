@@ -0,0 +1,4 @@
+maintenance {
+  enabled     = true
+  retry_after = "10m"
+}
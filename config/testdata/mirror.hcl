@@ -0,0 +1,11 @@
+mirror {
+  address = "https://nomad.staging:4646"
+  token   = "staging-token"
+  mode    = "plan"
+
+  namespaces = {
+    "prod" = "staging"
+    "*"    = "sandbox"
+  }
+  datacenters = ["staging-1"]
+}
@@ -0,0 +1 @@
+mutator_conflicts {}
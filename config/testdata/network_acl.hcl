@@ -0,0 +1,6 @@
+network_acl {
+  writes {
+    allow = ["10.0.0.0/8", "192.168.1.10"]
+    deny  = ["10.66.0.0/16"]
+  }
+}
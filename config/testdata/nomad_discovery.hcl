@@ -0,0 +1,11 @@
+nomad {
+  address = "http://localhost:4646"
+  tls {
+    ca_file   = "ca.pem"
+    cert_file = "cert.pem"
+    key_file  = "key.pem"
+  }
+  discovery {
+    consul_service = "nomad"
+  }
+}
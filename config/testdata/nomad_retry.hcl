@@ -0,0 +1,7 @@
+nomad {
+  address = "http://localhost:4646"
+  retry {
+    max_attempts = 4
+    methods      = ["get", "PUT"]
+  }
+}
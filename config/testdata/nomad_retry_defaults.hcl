@@ -0,0 +1,4 @@
+nomad {
+  address = "http://localhost:4646"
+  retry {}
+}
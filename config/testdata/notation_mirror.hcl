@@ -0,0 +1,17 @@
+validator "notation" "signed_images" {
+  notation {
+    trust_policy_file = "trust_policy.json"
+    trust_store_dir   = "trust_store"
+    parallelism       = 8
+
+    mirror "docker.io" {
+      endpoint = "mirror.example.com/dockerhub"
+    }
+    mirror "ghcr.io" {
+      endpoint   = "mirror.example.com:5000"
+      plain_http = true
+    }
+
+    proxy_url = "http://proxy.example.com:3128"
+  }
+}
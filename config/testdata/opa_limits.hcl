@@ -0,0 +1,4 @@
+opa_limits {
+  max_steps      = 1000000
+  max_heap_bytes = 1073741824
+}
@@ -0,0 +1,4 @@
+patch_policy {
+  max_operations = 20
+  type_checks    = true
+}
@@ -0,0 +1,8 @@
+read_rule "namespaces" {
+  paths = ["/v1/jobs", "/v1/allocations", "/v1/allocation/*"]
+  opa_rule {
+    query    = "errors = data.reads.errors"
+    filename = "reads.rego"
+  }
+  resolve_token = true
+}
@@ -0,0 +1,10 @@
+response_scrubbing {
+  rule "job-secrets" {
+    paths  = ["/v1/job/*"]
+    fields = ["Meta.*_secret", "TaskGroups.*.Tasks.*.Vault"]
+  }
+  rule "env" {
+    fields = ["TaskGroups.*.Tasks.*.Env.*_TOKEN"]
+    action = "mask"
+  }
+}
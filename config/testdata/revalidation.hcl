@@ -0,0 +1 @@
+revalidation {}
@@ -0,0 +1,7 @@
+siem {
+  format  = "cef"
+  address = "siem.example.com:6514"
+  tls {
+    ca_file = "/etc/nacp/siem-ca.pem"
+  }
+}
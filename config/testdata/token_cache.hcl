@@ -0,0 +1,3 @@
+token_cache {
+  resolve_policies = true
+}
@@ -0,0 +1,18 @@
+token_vending {
+  issuer "github" {
+    url      = "https://token.actions.githubusercontent.com"
+    audience = "nacp"
+  }
+  role "deploy-app" {
+    issuer = "github"
+    bound_claims = {
+      repository = "acme/app"
+      ref        = "refs/heads/main"
+    }
+    policies = ["deploy-app"]
+    opa_rule {
+      query    = "errors = data.vending.errors"
+      filename = "vending.rego"
+    }
+  }
+}
@@ -0,0 +1,5 @@
+identity {
+  source        = "header"
+  header        = "X-Forwarded-User"
+  groups_header = "X-Forwarded-Groups"
+}
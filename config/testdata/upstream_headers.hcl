@@ -0,0 +1,12 @@
+upstream_headers {
+  rule {
+    remove = ["Authorization"]
+  }
+  rule {
+    paths   = ["/v1/jobs", "/v1/job/*"]
+    methods = ["PUT", "POST"]
+    set = {
+      "X-Nomad-Token" = "management-token"
+    }
+  }
+}
@@ -0,0 +1,7 @@
+virtual_tokens {
+  exclusive = true
+  credential "ci" {
+    secret_sha256 = "8a279a73bd3a092854604a2e74e124834d89da2e87ee7facc40582a65a7c6f3e"
+    policies      = ["deploy"]
+  }
+}
@@ -0,0 +1,14 @@
+validator "webhook" "owner" {
+  webhook {
+    endpoint = "http://localhost:8080/validate"
+    method   = "POST"
+  }
+}
+
+mutator "json_patch_webhook" "defaults" {
+  webhook {
+    endpoint          = "http://localhost:8080/mutate"
+    method            = "POST"
+    max_response_size = 4096
+  }
+}
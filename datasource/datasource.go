@@ -0,0 +1,117 @@
+// Package datasource loads external data, e.g. team ownership maps or allowlists, that is made
+// available to the rules as data.sources.<name> in OPA and as data.<name> in webhook payloads.
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+// Source fetches the current content of a data source, the result must be JSON compatible.
+type Source interface {
+	Fetch(ctx context.Context) (interface{}, error)
+}
+
+type entry struct {
+	name     string
+	source   Source
+	interval time.Duration
+}
+
+// Manager keeps the latest content of all data sources and refreshes them in the background.
+type Manager struct {
+	entries []entry
+	store   storage.Store
+	logger  hclog.Logger
+
+	mu     sync.RWMutex
+	values map[string]interface{}
+}
+
+func NewManager(logger hclog.Logger) *Manager {
+	return &Manager{
+		store:  inmem.NewFromObject(map[string]interface{}{"sources": map[string]interface{}{}}),
+		logger: logger,
+		values: make(map[string]interface{}),
+	}
+}
+
+// Add registers a source, an interval of zero fetches it only once.
+func (m *Manager) Add(name string, source Source, interval time.Duration) {
+	m.entries = append(m.entries, entry{name: name, source: source, interval: interval})
+}
+
+// Load fetches all sources once.
+func (m *Manager) Load(ctx context.Context) error {
+	for _, e := range m.entries {
+		if err := m.refresh(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run refreshes the sources with an interval until the context is done.
+// A failed refresh keeps the previous content.
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range m.entries {
+		if e.interval <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(e entry) {
+			defer wg.Done()
+			ticker := time.NewTicker(e.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := m.refresh(ctx, e); err != nil {
+						m.logger.Warn("Failed to refresh data source, keeping previous content", "source", e.name, "error", err)
+					}
+				}
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (m *Manager) refresh(ctx context.Context, e entry) error {
+	value, err := e.source.Fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch data source %s: %w", e.name, err)
+	}
+	if err := storage.WriteOne(ctx, m.store, storage.AddOp, storage.Path{"sources", e.name}, value); err != nil {
+		return fmt.Errorf("failed to store data source %s: %w", e.name, err)
+	}
+	m.mu.Lock()
+	m.values[e.name] = value
+	m.mu.Unlock()
+	m.logger.Debug("Refreshed data source", "source", e.name)
+	return nil
+}
+
+// Store is the OPA store holding the content below /sources.
+func (m *Manager) Store() storage.Store {
+	return m.store
+}
+
+// Snapshot returns the current content of all sources by name.
+func (m *Manager) Snapshot() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snapshot := make(map[string]interface{}, len(m.values))
+	for name, value := range m.values {
+		snapshot[name] = value
+	}
+	return snapshot
+}
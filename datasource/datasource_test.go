@@ -0,0 +1,137 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSources(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "teams.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"team-a": ["alice"]}`), 0644))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/allowlist":
+			w.Write([]byte(`["registry.example.com"]`))
+		case "/v1/kv/nacp/owners":
+			assert.Contains(t, r.URL.RawQuery, "recurse")
+			json.NewEncoder(w).Encode(consulapi.KVPairs{
+				{Key: "nacp/owners/"},
+				{Key: "nacp/owners/web", Value: []byte(`{"team": "team-a"}`)},
+				{Key: "nacp/owners/db", Value: []byte(`team-b`)},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	consul, err := consulapi.NewClient(&consulapi.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	tt := []struct {
+		name    string
+		source  Source
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:   "file",
+			source: &FileSource{Path: file},
+			want:   map[string]interface{}{"team-a": []interface{}{"alice"}},
+		},
+		{
+			name:    "missing file",
+			source:  &FileSource{Path: filepath.Join(t.TempDir(), "missing.json")},
+			wantErr: true,
+		},
+		{
+			name:   "http",
+			source: &HTTPSource{URL: server.URL + "/allowlist"},
+			want:   []interface{}{"registry.example.com"},
+		},
+		{
+			name:    "http not found",
+			source:  &HTTPSource{URL: server.URL + "/missing"},
+			wantErr: true,
+		},
+		{
+			name:   "consul kv",
+			source: &ConsulKVSource{KV: consul.KV(), Prefix: "nacp/owners"},
+			want: map[string]interface{}{
+				"web": map[string]interface{}{"team": "team-a"},
+				"db":  "team-b",
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := tc.source.Fetch(context.Background())
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, value)
+		})
+	}
+}
+
+type countingSource struct {
+	calls int
+	err   error
+}
+
+func (c *countingSource) Fetch(_ context.Context) (interface{}, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.calls++
+	return json.Number(strconv.Itoa(c.calls)), nil
+}
+
+func TestManager(t *testing.T) {
+	source := &countingSource{}
+	manager := NewManager(hclog.NewNullLogger())
+	manager.Add("counter", source, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, manager.Load(ctx))
+	assert.Equal(t, map[string]interface{}{"counter": json.Number("1")}, manager.Snapshot())
+
+	stored, err := storage.ReadOne(ctx, manager.Store(), storage.Path{"sources", "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, json.Number("1"), stored)
+
+	done := make(chan struct{})
+	go func() {
+		manager.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		stored, err := storage.ReadOne(context.Background(), manager.Store(), storage.Path{"sources", "counter"})
+		return err == nil && stored != json.Number("1")
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestManagerLoadFails(t *testing.T) {
+	manager := NewManager(hclog.NewNullLogger())
+	manager.Add("broken", &countingSource{err: assert.AnError}, 0)
+	assert.ErrorContains(t, manager.Load(context.Background()), "failed to fetch data source broken")
+}
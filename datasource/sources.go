@@ -0,0 +1,97 @@
+package datasource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// FileSource reads a static JSON file.
+type FileSource struct {
+	Path string
+}
+
+func (f *FileSource) Fetch(_ context.Context) (interface{}, error) {
+	content, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	return decode(content)
+}
+
+// HTTPSource fetches a JSON document via GET.
+type HTTPSource struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h *HTTPSource) Fetch(ctx context.Context) (interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, h.URL)
+	}
+	var value interface{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// ConsulKVSource reads all keys below a prefix into an object keyed by the path relative to the prefix.
+// Values are decoded as JSON if possible, otherwise kept as string.
+type ConsulKVSource struct {
+	KV     *consulapi.KV
+	Prefix string
+}
+
+func (c *ConsulKVSource) Fetch(ctx context.Context) (interface{}, error) {
+	pairs, _, err := c.KV.List(c.Prefix, (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(c.Prefix, "/") + "/"
+	result := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		key := strings.TrimPrefix(pair.Key, prefix)
+		if key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+		value, err := decode(pair.Value)
+		if err != nil {
+			value = string(pair.Value)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func decode(content []byte) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"context"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+)
+
+// registrationRetry is the pause between attempts while the Consul agent is unavailable
+const registrationRetry = 10 * time.Second
+
+// ConsulAgent is the part of the Consul agent API needed to register a service.
+type ConsulAgent interface {
+	ServiceRegister(service *consulapi.AgentServiceRegistration) error
+	ServiceDeregister(serviceID string) error
+}
+
+// Registration keeps NACP registered in the local Consul agent while it runs.
+type Registration struct {
+	agent   ConsulAgent
+	service *consulapi.AgentServiceRegistration
+	retry   time.Duration
+	logger  hclog.Logger
+}
+
+func NewRegistration(agent ConsulAgent, service *consulapi.AgentServiceRegistration, logger hclog.Logger) *Registration {
+	return &Registration{
+		agent:   agent,
+		service: service,
+		retry:   registrationRetry,
+		logger:  logger,
+	}
+}
+
+// Run registers the service, retrying until it succeeds, and deregisters it when the context is done.
+func (r *Registration) Run(ctx context.Context) {
+	for {
+		err := r.agent.ServiceRegister(r.service)
+		if err == nil {
+			r.logger.Info("Registered in consul", "service", r.service.Name, "id", r.service.ID)
+			break
+		}
+		r.logger.Error("Failed to register in consul, retrying", "service", r.service.Name, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.retry):
+		}
+	}
+
+	<-ctx.Done()
+	if err := r.agent.ServiceDeregister(r.service.ID); err != nil {
+		r.logger.Error("Failed to deregister from consul", "id", r.service.ID, "error", err)
+		return
+	}
+	r.logger.Info("Deregistered from consul", "id", r.service.ID)
+}
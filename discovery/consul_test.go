@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAgent struct {
+	mu           sync.Mutex
+	failures     int
+	registered   []string
+	deregistered []string
+}
+
+func (a *fakeAgent) ServiceRegister(service *consulapi.AgentServiceRegistration) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failures > 0 {
+		a.failures--
+		return errors.New("agent unavailable")
+	}
+	a.registered = append(a.registered, service.ID)
+	return nil
+}
+
+func (a *fakeAgent) ServiceDeregister(serviceID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deregistered = append(a.deregistered, serviceID)
+	return nil
+}
+
+func (a *fakeAgent) state() ([]string, []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string{}, a.registered...), append([]string{}, a.deregistered...)
+}
+
+func TestRegistration(t *testing.T) {
+	agent := &fakeAgent{failures: 2}
+	r := NewRegistration(agent, &consulapi.AgentServiceRegistration{ID: "nacp-6464", Name: "nacp"}, hclog.NewNullLogger())
+	r.retry = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		registered, _ := agent.state()
+		return len(registered) == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	registered, deregistered := agent.state()
+	assert.Equal(t, []string{"nacp-6464"}, registered)
+	assert.Equal(t, []string{"nacp-6464"}, deregistered)
+}
+
+func TestRegistrationStopsWhileRetrying(t *testing.T) {
+	agent := &fakeAgent{failures: 1000}
+	r := NewRegistration(agent, &consulapi.AgentServiceRegistration{ID: "nacp-6464", Name: "nacp"}, hclog.NewNullLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(ctx)
+
+	registered, deregistered := agent.state()
+	assert.Empty(t, registered)
+	assert.Empty(t, deregistered, "nothing to deregister")
+}
@@ -0,0 +1,203 @@
+// Package discovery finds the local Nomad agent and registers NACP in Consul,
+// so NACP can run as sidecar next to every Nomad server without per host configuration.
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	defaultNomadHost = "127.0.0.1"
+	defaultNomadPort = 4646
+	// taskAPISocket is the Nomad task API, available to tasks in their secrets dir
+	taskAPISocket = "api.sock"
+)
+
+// NomadOptions controls where the local Nomad agent is looked for.
+type NomadOptions struct {
+	// SecretsDir contains the task API socket if NACP runs as Nomad task, defaults to NOMAD_SECRETS_DIR
+	SecretsDir string
+	// ConfigDir is the agent's config dir, its http address and tls settings are used
+	ConfigDir string
+}
+
+// NomadAddress returns the address of the local Nomad agent.
+// It prefers the task API socket, then the agent config, then NOMAD_ADDR and finally the default address.
+func NomadAddress(opts NomadOptions) (string, error) {
+	secretsDir := opts.SecretsDir
+	if secretsDir == "" {
+		secretsDir = os.Getenv("NOMAD_SECRETS_DIR")
+	}
+	if secretsDir != "" {
+		socket := filepath.Join(secretsDir, taskAPISocket)
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket, nil
+		}
+	}
+
+	if opts.ConfigDir != "" {
+		address, found, err := agentConfigAddress(opts.ConfigDir)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return address, nil
+		}
+	}
+
+	if address := os.Getenv("NOMAD_ADDR"); address != "" {
+		return address, nil
+	}
+	return fmt.Sprintf("http://%s:%d", defaultNomadHost, defaultNomadPort), nil
+}
+
+// agentConfig holds the parts of the Nomad agent config that make up its http address.
+type agentConfig struct {
+	bindAddr string
+	httpAddr string
+	httpPort int
+	tls      bool
+}
+
+var (
+	agentSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "bind_addr"}},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "addresses"},
+			{Type: "ports"},
+			{Type: "tls"},
+		},
+	}
+	httpSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "http"}},
+	}
+)
+
+// agentConfigAddress reads all config files of the agent in the same order Nomad merges them.
+func agentConfigAddress(dir string) (string, bool, error) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read nomad config dir: %w", err)
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if !f.IsDir() && (ext == ".hcl" || ext == ".json") {
+			names = append(names, f.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", false, nil
+	}
+	sort.Strings(names)
+
+	parser := hclparse.NewParser()
+	agent := &agentConfig{}
+	for _, name := range names {
+		if err := agent.merge(parser, filepath.Join(dir, name)); err != nil {
+			return "", false, err
+		}
+	}
+	return agent.address(), true, nil
+}
+
+func (a *agentConfig) merge(parser *hclparse.Parser, path string) error {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if filepath.Ext(path) == ".json" {
+		file, diags = parser.ParseJSONFile(path)
+	} else {
+		file, diags = parser.ParseHCLFile(path)
+	}
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse nomad config %s: %w", path, diags)
+	}
+
+	content, _, diags := file.Body.PartialContent(agentSchema)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to read nomad config %s: %w", path, diags)
+	}
+	if attr, ok := content.Attributes["bind_addr"]; ok {
+		if v, ok := stringValue(attr); ok {
+			a.bindAddr = v
+		}
+	}
+	for _, block := range content.Blocks {
+		httpContent, _, diags := block.Body.PartialContent(httpSchema)
+		if diags.HasErrors() {
+			return fmt.Errorf("failed to read %s block of nomad config %s: %w", block.Type, path, diags)
+		}
+		attr, ok := httpContent.Attributes["http"]
+		if !ok {
+			continue
+		}
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			// e.g. functions or variables we can't evaluate
+			continue
+		}
+		switch block.Type {
+		case "addresses":
+			if v, ok := stringValue(attr); ok {
+				a.httpAddr = v
+			}
+		case "ports":
+			if value.Type() == cty.Number {
+				port, _ := value.AsBigFloat().Int64()
+				a.httpPort = int(port)
+			} else if v, ok := stringValue(attr); ok {
+				if port, err := strconv.Atoi(v); err == nil {
+					a.httpPort = port
+				}
+			}
+		case "tls":
+			if value.Type() == cty.Bool {
+				a.tls = value.True()
+			}
+		}
+	}
+	return nil
+}
+
+func stringValue(attr *hcl.Attribute) (string, bool) {
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+func (a *agentConfig) address() string {
+	host := a.httpAddr
+	if host == "" {
+		host = a.bindAddr
+	}
+	// wildcards and go-sockaddr templates are reachable on the loopback address
+	if host == "" || host == "0.0.0.0" || host == "::" || strings.Contains(host, "{{") {
+		host = defaultNomadHost
+	}
+	port := a.httpPort
+	if port == 0 {
+		port = defaultNomadPort
+	}
+	scheme := "http"
+	if a.tls {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+}
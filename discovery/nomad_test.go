@@ -0,0 +1,136 @@
+package discovery
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNomadAddress(t *testing.T) {
+	tt := []struct {
+		name      string
+		configs   map[string]string
+		socket    bool
+		nomadAddr string
+		want      string
+	}{
+		{
+			name: "default",
+			want: "http://127.0.0.1:4646",
+		},
+		{
+			name:      "nomad addr env",
+			nomadAddr: "http://nomad.example.com:4646",
+			want:      "http://nomad.example.com:4646",
+		},
+		{
+			name:   "task api socket",
+			socket: true,
+			configs: map[string]string{
+				"nomad.hcl": `ports { http = 5656 }`,
+			},
+			want: "unix://{secrets}/api.sock",
+		},
+		{
+			name: "hcl agent config",
+			configs: map[string]string{
+				"nomad.hcl": `
+data_dir = "/opt/nomad"
+bind_addr = "10.0.0.5"
+ports {
+  http = 5656
+  rpc  = 5657
+}
+tls {
+  http = true
+  rpc  = true
+}
+server {
+  enabled = true
+}`,
+			},
+			nomadAddr: "http://ignored:4646",
+			want:      "https://10.0.0.5:5656",
+		},
+		{
+			name: "merged in file name order",
+			configs: map[string]string{
+				"a.hcl":  `bind_addr = "10.0.0.5"`,
+				"b.json": `{"addresses": {"http": "10.0.0.6"}, "ports": {"http": 5757}}`,
+			},
+			want: "http://10.0.0.6:5757",
+		},
+		{
+			name: "wildcard and templates use loopback",
+			configs: map[string]string{
+				"nomad.hcl": `
+bind_addr = "0.0.0.0"
+addresses {
+  http = "{{ GetPrivateIP }}"
+}`,
+			},
+			want: "http://127.0.0.1:4646",
+		},
+		{
+			name: "no config files",
+			configs: map[string]string{
+				"README.md": "not a config",
+			},
+			nomadAddr: "http://nomad.example.com:4646",
+			want:      "http://nomad.example.com:4646",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("NOMAD_ADDR", tc.nomadAddr)
+			t.Setenv("NOMAD_SECRETS_DIR", "")
+
+			configDir := t.TempDir()
+			for name, content := range tc.configs {
+				require.NoError(t, os.WriteFile(filepath.Join(configDir, name), []byte(content), 0o600))
+			}
+			secretsDir := shortTempDir(t)
+			if tc.socket {
+				l, err := net.Listen("unix", filepath.Join(secretsDir, "api.sock"))
+				require.NoError(t, err)
+				defer l.Close()
+			}
+
+			got, err := NomadAddress(NomadOptions{SecretsDir: secretsDir, ConfigDir: configDir})
+			require.NoError(t, err)
+			assert.Equal(t, replaceSecrets(tc.want, secretsDir), got)
+		})
+	}
+}
+
+func TestNomadAddressMissingConfigDir(t *testing.T) {
+	t.Setenv("NOMAD_ADDR", "")
+	got, err := NomadAddress(NomadOptions{ConfigDir: filepath.Join(t.TempDir(), "missing")})
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:4646", got)
+}
+
+func TestNomadAddressInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nomad.hcl"), []byte(`ports {`), 0o600))
+	_, err := NomadAddress(NomadOptions{ConfigDir: dir})
+	assert.ErrorContains(t, err, "failed to parse nomad config")
+}
+
+// shortTempDir keeps unix socket paths below their length limit
+func shortTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "nacp")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func replaceSecrets(s, secretsDir string) string {
+	return strings.Replace(s, "{secrets}", secretsDir, 1)
+}
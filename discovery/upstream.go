@@ -0,0 +1,171 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/metrics"
+)
+
+// ErrNoUpstream is returned if the discovery did not find any Nomad server yet.
+var ErrNoUpstream = errors.New("no nomad server discovered")
+
+// Resolver returns the current addresses of the Nomad servers.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]*url.URL, error)
+}
+
+// ConsulHealth is the part of the Consul health API needed to find healthy service instances.
+type ConsulHealth interface {
+	Service(service, tag string, passingOnly bool, q *consulapi.QueryOptions) ([]*consulapi.ServiceEntry, *consulapi.QueryMeta, error)
+}
+
+// ConsulResolver finds the healthy instances of a Consul service, e.g. the "nomad" service with the "http" tag.
+type ConsulResolver struct {
+	health  ConsulHealth
+	service string
+	tag     string
+	scheme  string
+}
+
+func NewConsulResolver(health ConsulHealth, service, tag, scheme string) *ConsulResolver {
+	return &ConsulResolver{health: health, service: service, tag: tag, scheme: scheme}
+}
+
+func (r *ConsulResolver) Resolve(ctx context.Context) ([]*url.URL, error) {
+	entries, _, err := r.health.Service(r.service, r.tag, true, (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query consul service %s: %w", r.service, err)
+	}
+	targets := make([]*url.URL, 0, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		targets = append(targets, &url.URL{Scheme: r.scheme, Host: net.JoinHostPort(address, strconv.Itoa(entry.Service.Port))})
+	}
+	return targets, nil
+}
+
+// LookupSRV matches net.Resolver.LookupSRV.
+type LookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+// SRVResolver finds the Nomad servers by a DNS SRV record, e.g. _http._tcp.nomad.service.consul.
+type SRVResolver struct {
+	lookup LookupSRV
+	record string
+	scheme string
+}
+
+func NewSRVResolver(lookup LookupSRV, record, scheme string) *SRVResolver {
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupSRV
+	}
+	return &SRVResolver{lookup: lookup, record: record, scheme: scheme}
+}
+
+func (r *SRVResolver) Resolve(ctx context.Context) ([]*url.URL, error) {
+	// the record is queried as is, not composed from service and proto
+	_, records, err := r.lookup(ctx, "", "", r.record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup srv record %s: %w", r.record, err)
+	}
+	targets := make([]*url.URL, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		targets = append(targets, &url.URL{Scheme: r.scheme, Host: net.JoinHostPort(host, strconv.Itoa(int(record.Port)))})
+	}
+	return targets, nil
+}
+
+// Upstream keeps the discovered Nomad servers up to date and balances requests over them.
+type Upstream struct {
+	resolver Resolver
+	interval time.Duration
+	logger   hclog.Logger
+
+	mu      sync.RWMutex
+	targets []*url.URL
+	next    atomic.Uint64
+}
+
+func NewUpstream(resolver Resolver, interval time.Duration, logger hclog.Logger) *Upstream {
+	return &Upstream{resolver: resolver, interval: interval, logger: logger}
+}
+
+// Refresh resolves the servers once, an empty result or an error keeps the previous servers.
+func (u *Upstream) Refresh(ctx context.Context) error {
+	targets, err := u.resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return ErrNoUpstream
+	}
+	u.mu.Lock()
+	changed := !sameTargets(u.targets, targets)
+	u.targets = targets
+	u.mu.Unlock()
+	if changed {
+		u.logger.Info("Nomad servers changed", "servers", targets)
+	}
+	metrics.UpstreamServers.Set(float64(len(targets)))
+	return nil
+}
+
+// Run refreshes the servers with the interval until the context is done.
+func (u *Upstream) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.Refresh(ctx); err != nil {
+				u.logger.Error("Failed to refresh nomad servers, keeping the previous ones", "error", err)
+			}
+		}
+	}
+}
+
+// Pick returns the next server round robin.
+func (u *Upstream) Pick() (*url.URL, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if len(u.targets) == 0 {
+		return nil, ErrNoUpstream
+	}
+	i := u.next.Add(1) - 1
+	return u.targets[i%uint64(len(u.targets))], nil
+}
+
+// Targets returns the currently known servers.
+func (u *Upstream) Targets() []*url.URL {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return append([]*url.URL(nil), u.targets...)
+}
+
+func sameTargets(a, b []*url.URL) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHealth struct {
+	entries []*consulapi.ServiceEntry
+	service string
+	tag     string
+}
+
+func (h *fakeHealth) Service(service, tag string, passingOnly bool, _ *consulapi.QueryOptions) ([]*consulapi.ServiceEntry, *consulapi.QueryMeta, error) {
+	h.service = service
+	h.tag = tag
+	if !passingOnly {
+		return nil, nil, errors.New("only passing instances must be used")
+	}
+	return h.entries, &consulapi.QueryMeta{}, nil
+}
+
+func TestConsulResolver(t *testing.T) {
+	health := &fakeHealth{entries: []*consulapi.ServiceEntry{
+		{Node: &consulapi.Node{Address: "10.0.0.1"}, Service: &consulapi.AgentService{Port: 4646}},
+		{Node: &consulapi.Node{Address: "10.0.0.2"}, Service: &consulapi.AgentService{Address: "10.0.1.2", Port: 4647}},
+	}}
+	resolver := NewConsulResolver(health, "nomad", "http", "https")
+
+	targets, err := resolver.Resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "nomad", health.service)
+	assert.Equal(t, "http", health.tag)
+	assert.Equal(t, []string{"https://10.0.0.1:4646", "https://10.0.1.2:4647"}, urls(targets))
+}
+
+func TestSRVResolver(t *testing.T) {
+	var queried string
+	lookup := func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		queried = service + proto + name
+		return "", []*net.SRV{
+			{Target: "nomad-1.node.consul.", Port: 4646},
+			{Target: "nomad-2.node.consul.", Port: 4646},
+		}, nil
+	}
+	resolver := NewSRVResolver(lookup, "_http._tcp.nomad.service.consul", "http")
+
+	targets, err := resolver.Resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "_http._tcp.nomad.service.consul", queried)
+	assert.Equal(t, []string{"http://nomad-1.node.consul:4646", "http://nomad-2.node.consul:4646"}, urls(targets))
+}
+
+type staticResolver struct {
+	targets []*url.URL
+	err     error
+}
+
+func (r *staticResolver) Resolve(_ context.Context) ([]*url.URL, error) {
+	return r.targets, r.err
+}
+
+func TestUpstream(t *testing.T) {
+	resolver := &staticResolver{}
+	upstream := NewUpstream(resolver, 0, hclog.NewNullLogger())
+
+	_, err := upstream.Pick()
+	assert.ErrorIs(t, err, ErrNoUpstream)
+	assert.ErrorIs(t, upstream.Refresh(context.Background()), ErrNoUpstream)
+
+	resolver.targets = []*url.URL{{Scheme: "http", Host: "a:4646"}, {Scheme: "http", Host: "b:4646"}}
+	require.NoError(t, upstream.Refresh(context.Background()))
+
+	var picked []string
+	for i := 0; i < 4; i++ {
+		target, err := upstream.Pick()
+		require.NoError(t, err)
+		picked = append(picked, target.Host)
+	}
+	assert.Equal(t, []string{"a:4646", "b:4646", "a:4646", "b:4646"}, picked)
+
+	// failures and empty results keep the known servers
+	resolver.err = errors.New("consul down")
+	assert.Error(t, upstream.Refresh(context.Background()))
+	resolver.err = nil
+	resolver.targets = nil
+	assert.ErrorIs(t, upstream.Refresh(context.Background()), ErrNoUpstream)
+	assert.Equal(t, []string{"http://a:4646", "http://b:4646"}, urls(upstream.Targets()))
+}
+
+func urls(targets []*url.URL) []string {
+	var result []string
+	for _, target := range targets {
+		result = append(result, target.String())
+	}
+	return result
+}
@@ -0,0 +1,122 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var nacpBin string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "nacp-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	nacpBin = filepath.Join(dir, "nacp")
+	build := exec.Command("go", "build", "-o", nacpBin, "./cmd/nacp")
+	build.Dir = repoPath()
+	if out, err := build.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build nacp: %v\n%s", err, out)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func rules() string {
+	return fmt.Sprintf(`
+validator "opa" "costcenter" {
+  opa_rule {
+    query    = "errors = data.costcenter_meta.errors"
+    filename = %q
+  }
+}
+mutator "opa_json_patch" "hello_world" {
+  opa_rule {
+    query    = "patch = data.hello_world_meta.patch"
+    filename = %q
+  }
+}
+`, repoPath("testdata", "opa", "validators", "costcenter_meta.rego"), repoPath("testdata", "opa", "mutators", "hello_world_meta.rego"))
+}
+
+func TestJobRun(t *testing.T) {
+	h := NewHarness(t, nacpBin, rules())
+
+	out, err := h.Nomad("job", "run", "-detach", "testdata/valid.nomad")
+	require.NoError(t, err, out)
+
+	job, _, err := h.NomadClient().Jobs().Info("e2e-valid", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "world", job.Meta["hello"], "mutation was applied before the job reached nomad")
+	assert.Equal(t, "cccode-e2e", job.Meta["costcenter"])
+
+	out, err = h.Nomad("job", "run", "-detach", "testdata/missing_costcenter.nomad")
+	require.Error(t, err)
+	assert.Contains(t, out, "Every job must have a costcenter metadata label")
+
+	_, _, err = h.NomadClient().Jobs().Info("e2e-missing-costcenter", nil)
+	assert.Error(t, err, "rejected job was not registered")
+}
+
+func TestJobRunJson(t *testing.T) {
+	h := NewHarness(t, nacpBin, rules())
+
+	jobJson, err := h.Nomad("job", "run", "-output", "testdata/valid.nomad")
+	require.NoError(t, err, jobJson)
+	jsonFile := filepath.Join(t.TempDir(), "valid.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(jobJson), 0644))
+
+	out, err := h.Nomad("job", "run", "-detach", "-json", jsonFile)
+	require.NoError(t, err, out)
+
+	job, _, err := h.NomadClient().Jobs().Info("e2e-valid", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "world", job.Meta["hello"])
+}
+
+func TestJobPlan(t *testing.T) {
+	h := NewHarness(t, nacpBin, rules())
+
+	// plan exits with 1 if allocations would be created
+	out, err := h.Nomad("job", "plan", "testdata/valid.nomad")
+	assertExitCode(t, err, 0, 1)
+	assert.Contains(t, out, `Job: "e2e-valid"`)
+
+	out, err = h.Nomad("job", "plan", "testdata/missing_costcenter.nomad")
+	assertExitCode(t, err, 255)
+	assert.Contains(t, out, "Every job must have a costcenter metadata label")
+}
+
+func TestJobValidate(t *testing.T) {
+	h := NewHarness(t, nacpBin, rules())
+
+	out, err := h.Nomad("job", "validate", "testdata/valid.nomad")
+	require.NoError(t, err, out)
+	assert.Contains(t, out, "Job validation successful")
+
+	out, err = h.Nomad("job", "validate", "testdata/missing_costcenter.nomad")
+	require.Error(t, err)
+	assert.Contains(t, out, "Every job must have a costcenter metadata label")
+}
+
+func assertExitCode(t *testing.T, err error, codes ...int) {
+	t.Helper()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Contains(t, codes, code, "unexpected exit code")
+}
@@ -0,0 +1,191 @@
+//go:build e2e
+
+// Package e2e runs NACP in front of a real Nomad dev agent and drives it with the nomad CLI.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// NomadBinaryEnv overrides the nomad binary, it defaults to nomad from the PATH.
+const NomadBinaryEnv = "NACP_E2E_NOMAD_BIN"
+
+const startupTimeout = 30 * time.Second
+
+// Harness holds a running Nomad dev agent and a NACP instance proxying to it.
+type Harness struct {
+	t         *testing.T
+	nomadBin  string
+	NomadAddr string
+	NacpAddr  string
+}
+
+// NewHarness starts a Nomad dev agent and a NACP binary configured with the given rules.
+// The rules are appended to the generated NACP config, the processes are stopped when the test ends.
+func NewHarness(t *testing.T, nacpBin string, rules string) *Harness {
+	t.Helper()
+	nomadBin := os.Getenv(NomadBinaryEnv)
+	if nomadBin == "" {
+		var err error
+		if nomadBin, err = exec.LookPath("nomad"); err != nil {
+			t.Skip("nomad binary not found, set " + NomadBinaryEnv + " or add it to the PATH")
+		}
+	}
+	h := &Harness{t: t, nomadBin: nomadBin}
+	h.NomadAddr = h.startNomad()
+	h.NacpAddr = h.startNacp(nacpBin, rules)
+	return h
+}
+
+// Nomad runs the nomad CLI against NACP and returns the combined output.
+func (h *Harness) Nomad(args ...string) (string, error) {
+	h.t.Helper()
+	cmd := exec.Command(h.nomadBin, args...)
+	cmd.Env = append(os.Environ(), "NOMAD_ADDR="+h.NacpAddr)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// NomadClient returns an API client talking to Nomad directly, bypassing NACP.
+func (h *Harness) NomadClient() *api.Client {
+	h.t.Helper()
+	client, err := api.NewClient(&api.Config{Address: h.NomadAddr})
+	if err != nil {
+		h.t.Fatalf("failed to create nomad client: %v", err)
+	}
+	return client
+}
+
+func (h *Harness) startNomad() string {
+	h.t.Helper()
+	dir := h.t.TempDir()
+	httpPort, rpcPort, serfPort := freePort(h.t), freePort(h.t), freePort(h.t)
+	config := fmt.Sprintf(`
+bind_addr = "127.0.0.1"
+ports {
+  http = %d
+  rpc  = %d
+  serf = %d
+}
+client {
+  enabled = false
+}
+`, httpPort, rpcPort, serfPort)
+	configFile := filepath.Join(dir, "nomad.hcl")
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		h.t.Fatalf("failed to write nomad config: %v", err)
+	}
+	h.start("nomad", h.nomadBin, "agent", "-dev", "-config", configFile)
+
+	addr := fmt.Sprintf("http://127.0.0.1:%d", httpPort)
+	h.waitFor("nomad", func() bool {
+		resp, err := httpGet(addr + "/v1/status/leader")
+		return err == nil && resp.StatusCode == 200 && len(resp.Body) > 2
+	})
+	return addr
+}
+
+func (h *Harness) startNacp(nacpBin string, rules string) string {
+	h.t.Helper()
+	port := freePort(h.t)
+	config := fmt.Sprintf(`
+port = %d
+bind = "127.0.0.1"
+nomad {
+  address = %q
+}
+%s
+`, port, h.NomadAddr, rules)
+	configFile := filepath.Join(h.t.TempDir(), "nacp.hcl")
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		h.t.Fatalf("failed to write nacp config: %v", err)
+	}
+	h.start("nacp", nacpBin, "-config", configFile)
+
+	addr := fmt.Sprintf("http://127.0.0.1:%d", port)
+	h.waitFor("nacp", func() bool {
+		resp, err := httpGet(addr + "/v1/status/leader")
+		return err == nil && resp.StatusCode == 200
+	})
+	return addr
+}
+
+// start runs the command until the test ends, its output is logged if the test fails.
+func (h *Harness) start(name string, bin string, args ...string) {
+	h.t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	output := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		cancel()
+		h.t.Fatalf("failed to start %s: %v", name, err)
+	}
+	h.t.Cleanup(func() {
+		cancel()
+		_ = cmd.Wait()
+		if h.t.Failed() {
+			h.t.Logf("%s output:\n%s", name, output.String())
+		}
+	})
+}
+
+func (h *Harness) waitFor(name string, ready func() bool) {
+	h.t.Helper()
+	deadline := time.Now().Add(startupTimeout)
+	for time.Now().Before(deadline) {
+		if ready() {
+			return
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	h.t.Fatalf("%s did not become ready within %s", name, startupTimeout)
+}
+
+type response struct {
+	StatusCode int
+	Body       []byte
+}
+
+func httpGet(url string) (*response, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body := &bytes.Buffer{}
+	if _, err := body.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+	return &response{StatusCode: resp.StatusCode, Body: body.Bytes()}, nil
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// repoPath resolves a path relative to the repository root.
+func repoPath(elem ...string) string {
+	_, filename, _, _ := runtime.Caller(0)
+	return filepath.Join(append([]string{filepath.Dir(filename), ".."}, elem...)...)
+}
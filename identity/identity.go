@@ -0,0 +1,200 @@
+// Package identity maps the submitter of a request to a human identity and its directory groups,
+// so rules can be written in terms of team membership.
+package identity
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+)
+
+const (
+	// SourceTokenName uses the name of the resolved ACL token as identity.
+	SourceTokenName = "token_name"
+	// SourceHeader uses a header set by an SSO proxy in front of NACP as identity.
+	SourceHeader = "header"
+)
+
+// GroupResolver returns the groups of an identity.
+type GroupResolver interface {
+	Groups(ctx context.Context, identity string) ([]string, error)
+}
+
+// HeaderTrust decides whether the identity headers of a request were set by a trusted proxy, e.g. Boundary or an SSO proxy.
+// A request is trusted if its peer is one of the Peers or presents a client certificate issued by the Roots.
+type HeaderTrust struct {
+	Peers []*net.IPNet
+	Roots *x509.CertPool
+}
+
+// Trusts reports whether the identity headers of the request can be used, without trust no request is trusted.
+func (t *HeaderTrust) Trusts(req *http.Request) bool {
+	if t == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, peer := range t.Peers {
+			if peer.Contains(ip) {
+				return true
+			}
+		}
+	}
+	if t.Roots == nil || req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = req.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         t.Roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
+
+type Resolver struct {
+	source string
+	header string
+	groups GroupResolver
+	logger hclog.Logger
+
+	groupsHeader string
+	claimHeaders map[string]string
+	trust        *HeaderTrust
+}
+
+type Option func(*Resolver)
+
+// WithGroupsHeader takes the comma separated groups from a header set by the proxy instead of the group resolver.
+func WithGroupsHeader(header string) Option {
+	return func(r *Resolver) {
+		r.groupsHeader = header
+	}
+}
+
+// WithClaimHeaders adds the values of the headers by name to the claims, e.g. the email or target of a Boundary session.
+func WithClaimHeaders(headers map[string]string) Option {
+	return func(r *Resolver) {
+		r.claimHeaders = headers
+	}
+}
+
+// WithHeaderTrust uses the identity, groups and claim headers of requests that come from a trusted proxy,
+// without it the headers are ignored.
+func WithHeaderTrust(trust *HeaderTrust) Option {
+	return func(r *Resolver) {
+		r.trust = trust
+	}
+}
+
+func NewResolver(source, header string, groups GroupResolver, logger hclog.Logger, opts ...Option) (*Resolver, error) {
+	switch source {
+	case SourceTokenName:
+	case SourceHeader:
+		if header == "" {
+			return nil, fmt.Errorf("identity source %s requires a header", source)
+		}
+	default:
+		return nil, fmt.Errorf("unknown identity source %q", source)
+	}
+	r := &Resolver{
+		source: source,
+		header: header,
+		groups: groups,
+		logger: logger,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// NeedsToken reports whether the ACL token has to be resolved to find the identity.
+func (r *Resolver) NeedsToken() bool {
+	return r.source == SourceTokenName
+}
+
+// Resolve returns the identity and its groups, the identity is empty if it can't be determined.
+// Failing group lookups are logged and result in no groups.
+func (r *Resolver) Resolve(ctx context.Context, req *http.Request, token *api.ACLToken) (string, []string) {
+	var identity string
+	trusted := r.trusted(req)
+	switch r.source {
+	case SourceTokenName:
+		if token != nil {
+			identity = token.Name
+		}
+	case SourceHeader:
+		if trusted {
+			identity = req.Header.Get(r.header)
+		}
+	}
+	if identity == "" {
+		return identity, nil
+	}
+	if r.groupsHeader != "" {
+		if !trusted {
+			return identity, nil
+		}
+		return identity, splitGroups(req.Header.Get(r.groupsHeader))
+	}
+	if r.groups == nil {
+		return identity, nil
+	}
+	groups, err := r.groups.Groups(ctx, identity)
+	if err != nil {
+		r.logger.Error("Resolving groups failed", "identity", identity, "error", err)
+		return identity, nil
+	}
+	return identity, groups
+}
+
+// Claims returns the values of the claim headers by name, it is nil if no claim header is set or the request is not trusted.
+func (r *Resolver) Claims(req *http.Request) map[string]string {
+	if len(r.claimHeaders) == 0 || !r.trusted(req) {
+		return nil
+	}
+	var claims map[string]string
+	for name, header := range r.claimHeaders {
+		if value := req.Header.Get(header); value != "" {
+			if claims == nil {
+				claims = make(map[string]string, len(r.claimHeaders))
+			}
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+// trusted reports whether the headers of the request can be used and logs if they are ignored.
+func (r *Resolver) trusted(req *http.Request) bool {
+	if r.trust.Trusts(req) {
+		return true
+	}
+	if r.source == SourceHeader && req.Header.Get(r.header) != "" {
+		r.logger.Warn("Ignoring identity header of untrusted peer", "peer", req.RemoteAddr, "header", r.header)
+	}
+	return false
+}
+
+func splitGroups(value string) []string {
+	var groups []string
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
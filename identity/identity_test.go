@@ -0,0 +1,185 @@
+package identity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticGroups map[string][]string
+
+func (s staticGroups) Groups(_ context.Context, identity string) ([]string, error) {
+	groups, ok := s[identity]
+	if !ok {
+		return nil, assert.AnError
+	}
+	return groups, nil
+}
+
+func TestResolver(t *testing.T) {
+	groups := staticGroups{"alice": {"team-a"}}
+	// the remote address of httptest requests
+	_, proxy, err := net.ParseCIDR("192.0.2.1/32")
+	require.NoError(t, err)
+
+	tt := []struct {
+		name         string
+		source       string
+		header       string
+		token        *api.ACLToken
+		wantIdentity string
+		wantGroups   []string
+	}{
+		{
+			name:         "token name",
+			source:       SourceTokenName,
+			token:        &api.ACLToken{Name: "alice"},
+			wantIdentity: "alice",
+			wantGroups:   []string{"team-a"},
+		},
+		{
+			name:   "no token",
+			source: SourceTokenName,
+		},
+		{
+			name:         "header",
+			source:       SourceHeader,
+			header:       "alice",
+			wantIdentity: "alice",
+			wantGroups:   []string{"team-a"},
+		},
+		{
+			name:         "failing group lookup",
+			source:       SourceHeader,
+			header:       "mallory",
+			wantIdentity: "mallory",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver, err := NewResolver(tc.source, "X-Forwarded-User", groups, hclog.NewNullLogger(),
+				WithHeaderTrust(&HeaderTrust{Peers: []*net.IPNet{proxy}}))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("PUT", "/v1/jobs", nil)
+			if tc.header != "" {
+				req.Header.Set("X-Forwarded-User", tc.header)
+			}
+			identity, groups := resolver.Resolve(context.Background(), req, tc.token)
+			assert.Equal(t, tc.wantIdentity, identity)
+			assert.Equal(t, tc.wantGroups, groups)
+		})
+	}
+}
+
+func TestNewResolverFailsOnInvalidSource(t *testing.T) {
+	_, err := NewResolver("cookie", "", nil, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "unknown identity source")
+
+	_, err = NewResolver(SourceHeader, "", nil, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "requires a header")
+}
+
+func TestResolver_HeaderTrust(t *testing.T) {
+	_, peer, err := net.ParseCIDR("10.0.5.0/24")
+	require.NoError(t, err)
+	resolver, err := NewResolver(SourceHeader, "X-Boundary-User", staticGroups{}, hclog.NewNullLogger(),
+		WithGroupsHeader("X-Boundary-Groups"),
+		WithClaimHeaders(map[string]string{"email": "X-Boundary-Email", "target": "X-Boundary-Target"}),
+		WithHeaderTrust(&HeaderTrust{Peers: []*net.IPNet{peer}}),
+	)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name         string
+		remoteAddr   string
+		wantIdentity string
+		wantGroups   []string
+		wantClaims   map[string]string
+	}{
+		{
+			name:         "trusted peer",
+			remoteAddr:   "10.0.5.7:4321",
+			wantIdentity: "alice",
+			wantGroups:   []string{"sre", "team-a"},
+			wantClaims:   map[string]string{"email": "alice@example.com"},
+		},
+		{
+			name:       "untrusted peer",
+			remoteAddr: "192.168.1.1:4321",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/v1/jobs", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("X-Boundary-User", "alice")
+			req.Header.Set("X-Boundary-Groups", "sre, team-a,")
+			req.Header.Set("X-Boundary-Email", "alice@example.com")
+
+			identity, groups := resolver.Resolve(context.Background(), req, nil)
+			assert.Equal(t, tc.wantIdentity, identity)
+			assert.Equal(t, tc.wantGroups, groups)
+			assert.Equal(t, tc.wantClaims, resolver.Claims(req))
+		})
+	}
+}
+
+func TestHeaderTrust_ClientCertificate(t *testing.T) {
+	ca, caKey := newTestCert(t, "proxy-ca", nil, nil)
+	proxy, _ := newTestCert(t, "boundary-worker", ca, caKey)
+	other, _ := newTestCert(t, "laptop", nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	trust := &HeaderTrust{Roots: roots}
+
+	req := httptest.NewRequest("PUT", "/v1/jobs", nil)
+	assert.False(t, trust.Trusts(req), "no certificate")
+
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{proxy}}
+	assert.True(t, trust.Trusts(req))
+
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{other}}
+	assert.False(t, trust.Trusts(req))
+
+	var missing *HeaderTrust
+	assert.False(t, missing.Trusts(req), "without trust the headers are ignored")
+}
+
+// newTestCert creates a client certificate signed by the parent, or a self-signed CA without parent.
+func newTestCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
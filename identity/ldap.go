@@ -0,0 +1,114 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+type LDAPConfig struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter with a single %s for the escaped identity, e.g. (sAMAccountName=%s)
+	UserFilter string
+	// GroupAttribute of the user entry listing the groups, e.g. memberOf
+	GroupAttribute string
+	CacheTTL       time.Duration
+}
+
+type cachedGroups struct {
+	groups  []string
+	expires time.Time
+}
+
+// LDAPGroupResolver looks up the groups of a user in LDAP or Active Directory.
+// Group DNs are reduced to the value of their first RDN, e.g. cn=team-a,ou=groups,dc=example,dc=com becomes team-a.
+type LDAPGroupResolver struct {
+	config LDAPConfig
+	dial   func() (ldap.Client, error)
+
+	mu    sync.Mutex
+	cache map[string]cachedGroups
+}
+
+func NewLDAPGroupResolver(config LDAPConfig) *LDAPGroupResolver {
+	return &LDAPGroupResolver{
+		config: config,
+		dial: func() (ldap.Client, error) {
+			return ldap.DialURL(config.URL)
+		},
+		cache: make(map[string]cachedGroups),
+	}
+}
+
+func (l *LDAPGroupResolver) Groups(_ context.Context, identity string) ([]string, error) {
+	l.mu.Lock()
+	cached, ok := l.cache[identity]
+	l.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.groups, nil
+	}
+
+	groups, err := l.lookup(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.cache[identity] = cachedGroups{groups: groups, expires: time.Now().Add(l.config.CacheTTL)}
+	l.mu.Unlock()
+	return groups, nil
+}
+
+func (l *LDAPGroupResolver) lookup(identity string) ([]string, error) {
+	conn, err := l.dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap: %w", err)
+	}
+	defer conn.Close()
+
+	if l.config.BindDN != "" {
+		if err := conn.Bind(l.config.BindDN, l.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind to ldap: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(l.config.UserFilter, ldap.EscapeFilter(identity)),
+		[]string{l.config.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search ldap: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return []string{}, nil
+	}
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("identity %s matches %d ldap entries", identity, len(result.Entries))
+	}
+
+	values := result.Entries[0].GetAttributeValues(l.config.GroupAttribute)
+	groups := make([]string, 0, len(values))
+	for _, value := range values {
+		groups = append(groups, groupName(value))
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func groupName(value string) string {
+	dn, err := ldap.ParseDN(value)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return value
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
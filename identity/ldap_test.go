@@ -0,0 +1,94 @@
+package identity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLDAP struct {
+	ldap.Client
+	entries  map[string][]*ldap.Entry
+	searches []string
+	bindDN   string
+}
+
+func (f *fakeLDAP) Bind(username, _ string) error {
+	f.bindDN = username
+	return nil
+}
+
+func (f *fakeLDAP) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	f.searches = append(f.searches, req.Filter)
+	return &ldap.SearchResult{Entries: f.entries[req.Filter]}, nil
+}
+
+func (f *fakeLDAP) Close() error {
+	return nil
+}
+
+func TestLDAPGroupResolver(t *testing.T) {
+	fake := &fakeLDAP{entries: map[string][]*ldap.Entry{
+		"(uid=alice)": {ldap.NewEntry("uid=alice,dc=example,dc=com", map[string][]string{
+			"memberOf": {"cn=team-b,ou=groups,dc=example,dc=com", "cn=team-a,ou=groups,dc=example,dc=com"},
+		})},
+		"(uid=bob)": {
+			ldap.NewEntry("uid=bob,ou=a,dc=example,dc=com", nil),
+			ldap.NewEntry("uid=bob,ou=b,dc=example,dc=com", nil),
+		},
+		`(uid=\2a)`: {},
+	}}
+	resolver := NewLDAPGroupResolver(LDAPConfig{
+		BindDN:         "cn=nacp,dc=example,dc=com",
+		BaseDN:         "dc=example,dc=com",
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		CacheTTL:       time.Minute,
+	})
+	resolver.dial = func() (ldap.Client, error) {
+		return fake, nil
+	}
+
+	tt := []struct {
+		name     string
+		identity string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "groups are reduced to their name",
+			identity: "alice",
+			want:     []string{"team-a", "team-b"},
+		},
+		{
+			name:     "filter is escaped",
+			identity: "*",
+			want:     []string{},
+		},
+		{
+			name:     "ambiguous identity",
+			identity: "bob",
+			wantErr:  true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := resolver.Groups(context.Background(), tc.identity)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, groups)
+		})
+	}
+
+	_, err := resolver.Groups(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"(uid=alice)", `(uid=\2a)`, "(uid=bob)"}, fake.searches, "results are cached")
+	assert.Equal(t, "cn=nacp,dc=example,dc=com", fake.bindDN)
+}
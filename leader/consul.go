@@ -0,0 +1,60 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+)
+
+// ConsulElector uses a Consul session lock on a KV key for the election.
+type ConsulElector struct {
+	leaderState
+	lock *consulapi.Lock
+	ttl  time.Duration
+}
+
+func NewConsulElector(client *consulapi.Client, key string, ttl time.Duration, logger hclog.Logger) (*ConsulElector, error) {
+	lock, err := client.LockOpts(&consulapi.LockOptions{
+		Key:         key,
+		SessionName: "nacp-leader",
+		SessionTTL:  ttl.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulElector{
+		leaderState: leaderState{logger: logger},
+		lock:        lock,
+		ttl:         ttl,
+	}, nil
+}
+
+func (e *ConsulElector) Run(ctx context.Context) error {
+	defer e.setLeader(false)
+	for {
+		lost, err := e.lock.Lock(ctx.Done())
+		if err != nil {
+			e.logger.Error("Leader election failed", "error", err)
+		}
+		if lost != nil {
+			e.setLeader(true)
+			select {
+			case <-lost:
+				e.setLeader(false)
+			case <-ctx.Done():
+				if err := e.lock.Unlock(); err != nil {
+					e.logger.Error("Releasing leader lock failed", "error", err)
+				}
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(e.ttl):
+		}
+	}
+}
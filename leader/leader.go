@@ -0,0 +1,54 @@
+// Package leader elects a single active replica among several NACP instances.
+// All replicas serve proxy traffic, background subsystems that must only run once
+// (e.g. scanners or reports) check IsLeader before doing work.
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/metrics"
+)
+
+type Elector interface {
+	// Run campaigns for leadership until the context is cancelled.
+	Run(ctx context.Context) error
+	// IsLeader reports whether this replica currently holds the lock.
+	IsLeader() bool
+}
+
+type leaderState struct {
+	leader atomic.Bool
+	logger hclog.Logger
+}
+
+func (s *leaderState) IsLeader() bool {
+	return s.leader.Load()
+}
+
+func (s *leaderState) setLeader(leader bool) {
+	if s.leader.Swap(leader) == leader {
+		return
+	}
+	if leader {
+		s.logger.Info("Acquired leadership")
+		metrics.Leader.Set(1)
+	} else {
+		s.logger.Warn("Lost leadership")
+		metrics.Leader.Set(0)
+	}
+}
+
+// Static is used if leader election is disabled, the single replica is always the leader.
+type Static struct{}
+
+func (Static) Run(ctx context.Context) error {
+	metrics.Leader.Set(1)
+	<-ctx.Done()
+	return nil
+}
+
+func (Static) IsLeader() bool {
+	return true
+}
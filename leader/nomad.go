@@ -0,0 +1,72 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+)
+
+// NomadElector uses a Nomad variable lock for the election.
+type NomadElector struct {
+	leaderState
+	locks *api.Locks
+	ttl   time.Duration
+}
+
+func NewNomadElector(client *api.Client, path string, ttl time.Duration, logger hclog.Logger) (*NomadElector, error) {
+	locks, err := client.Locks(api.WriteOptions{}, api.Variable{
+		Path: path,
+		Lock: &api.VariableLock{TTL: ttl.String()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &NomadElector{
+		leaderState: leaderState{logger: logger},
+		locks:       locks,
+		ttl:         ttl,
+	}, nil
+}
+
+func (e *NomadElector) Run(ctx context.Context) error {
+	defer e.setLeader(false)
+	for {
+		_, err := e.locks.Acquire(ctx)
+		if err == nil {
+			e.setLeader(true)
+			err = e.maintainLease(ctx)
+			e.setLeader(false)
+		}
+		if err != nil && !errors.Is(err, api.ErrLockConflict) && ctx.Err() == nil {
+			e.logger.Error("Leader election failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(e.ttl):
+		}
+	}
+}
+
+// maintainLease renews the lock until the renewal fails or the context is cancelled,
+// in which case the lock is released so another replica can take over immediately.
+func (e *NomadElector) maintainLease(ctx context.Context) error {
+	ticker := time.NewTicker(e.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), e.ttl)
+			defer cancel()
+			return e.locks.Release(releaseCtx)
+		case <-ticker.C:
+			if err := e.locks.Renew(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNomadElector(t *testing.T) {
+	tt := []struct {
+		name        string
+		lockStatus  int
+		wantLeader  bool
+		wantRelease bool
+	}{
+		{
+			name:        "acquires lock",
+			lockStatus:  http.StatusOK,
+			wantLeader:  true,
+			wantRelease: true,
+		},
+		{
+			name:        "lock held by other replica",
+			lockStatus:  http.StatusConflict,
+			wantLeader:  false,
+			wantRelease: false,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var released atomic.Bool
+			nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v1/var/nacp/leader", r.URL.Path)
+				switch {
+				case r.URL.Query().Has("lock-acquire"):
+					if tc.lockStatus != http.StatusOK {
+						w.WriteHeader(tc.lockStatus)
+						return
+					}
+					json.NewEncoder(w).Encode(&api.Variable{
+						Path: "nacp/leader",
+						Lock: &api.VariableLock{ID: "lock-id", TTL: "1s"},
+					})
+				case r.URL.Query().Has("lock-renew"):
+					json.NewEncoder(w).Encode(&api.VariableMetadata{Path: "nacp/leader"})
+				case r.URL.Query().Has("lock-release"):
+					released.Store(true)
+					json.NewEncoder(w).Encode(&api.Variable{Path: "nacp/leader"})
+				}
+			}))
+			defer nomad.Close()
+
+			client, err := api.NewClient(&api.Config{Address: nomad.URL})
+			require.NoError(t, err)
+			elector, err := NewNomadElector(client, "nacp/leader", time.Second, hclog.NewNullLogger())
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				elector.Run(ctx)
+				close(done)
+			}()
+
+			if tc.wantLeader {
+				assert.Eventually(t, elector.IsLeader, time.Second, 10*time.Millisecond)
+			} else {
+				assert.Never(t, elector.IsLeader, 200*time.Millisecond, 10*time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			assert.False(t, elector.IsLeader(), "leadership ends with the context")
+			assert.Equal(t, tc.wantRelease, released.Load())
+		})
+	}
+}
@@ -0,0 +1,204 @@
+// Package metrics holds the Prometheus metrics exposed by NACP.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	Registry = prometheus.NewRegistry()
+
+	// RulesetInfo is always 1 and carries the hash of the active rules and config as label,
+	// so differing replicas can be detected with e.g. count(count by (hash) (nacp_ruleset_info)) > 1
+	RulesetInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nacp_ruleset_info",
+		Help: "Hash of the active rule set and config.",
+	}, []string{"hash"})
+
+	// BuildInfo is always 1 and carries the version of the running binary as labels.
+	BuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nacp_build_info",
+		Help: "Version, commit and Go version of the running NACP binary.",
+	}, []string{"version", "commit", "goversion"})
+
+	// Leader is 1 if this replica is the elected leader.
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nacp_leader",
+		Help: "Whether this replica is the elected leader.",
+	})
+
+	AdmissionQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nacp_admission_queue_depth",
+		Help: "Number of running and waiting admissions.",
+	})
+	AdmissionQueueRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nacp_admission_queue_rejected_total",
+		Help: "Number of admissions rejected because the queue was full.",
+	})
+
+	// RuleDecisions counts the outcome per rule and rule version.
+	RuleDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_rule_decisions_total",
+		Help: "Number of rule evaluations by outcome.",
+	}, []string{"kind", "rule", "version", "decision"})
+
+	// ShadowEvaluations counts the comparisons of the candidate rule set with the active one.
+	ShadowEvaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_shadow_evaluations_total",
+		Help: "Number of shadow evaluations of the candidate rule set by result.",
+	}, []string{"result"})
+
+	// FaultsInjected counts the artificial delays and errors of the fault injection mode.
+	FaultsInjected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_faults_injected_total",
+		Help: "Number of injected rule faults.",
+	}, []string{"rule", "fault"})
+
+	// ExemptionsApplied counts the denials that were turned into warnings by an exemption.
+	ExemptionsApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_exemptions_applied_total",
+		Help: "Number of rule denials suppressed by an exemption.",
+	}, []string{"rule"})
+
+	// Exemptions is the number of exemptions by state, expiring ones are within the warn_before period.
+	Exemptions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nacp_exemptions",
+		Help: "Number of exemptions by state.",
+	}, []string{"state"})
+
+	// AuthLogins counts the OIDC logins of browser users by result.
+	AuthLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_auth_logins_total",
+		Help: "Number of OIDC logins by result.",
+	}, []string{"result"})
+
+	// VendedTokens counts the Nomad tokens requested by CI pipelines by role and result.
+	VendedTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_vended_tokens_total",
+		Help: "Number of Nomad tokens requested via token vending by role and result.",
+	}, []string{"role", "result"})
+
+	// VirtualTokens counts the Nomad tokens created for the credentials of the virtual_tokens by credential and result.
+	VirtualTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_virtual_tokens_total",
+		Help: "Number of Nomad tokens created for virtual token credentials by credential and result.",
+	}, []string{"credential", "result"})
+
+	// NearMissRequests counts writes that resemble job submissions but are passed through unchecked.
+	NearMissRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nacp_near_miss_requests_total",
+		Help: "Number of writes that resemble job submissions but don't match an intercepted endpoint.",
+	})
+
+	// OversizedResponses counts the Nomad responses that were too large to add NACP's warnings.
+	OversizedResponses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nacp_oversized_responses_total",
+		Help: "Number of responses passed through without warnings because they exceed max_response_size.",
+	})
+
+	// DecisionExports counts the decisions written to, dropped by or failed for an exporter, e.g. siem.
+	DecisionExports = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_decision_exports_total",
+		Help: "Number of rule decisions by exporter and result.",
+	}, []string{"exporter", "result"})
+
+	// MirroredJobs counts the jobs mirrored to, failed on or dropped for the secondary cluster.
+	MirroredJobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_mirrored_jobs_total",
+		Help: "Number of jobs mirrored to the secondary cluster by result.",
+	}, []string{"result"})
+
+	// UpstreamRetries counts the retried proxied requests and the ones not retried because the budget is exhausted.
+	UpstreamRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_upstream_retries_total",
+		Help: "Number of retries of proxied requests by result.",
+	}, []string{"result"})
+
+	// MaintenanceRejections counts the writes rejected while the maintenance mode is enabled.
+	MaintenanceRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_maintenance_rejections_total",
+		Help: "Number of writes rejected by the maintenance mode by operation.",
+	}, []string{"operation"})
+
+	// NetworkACLRejections counts the requests rejected by the network_acl by class, writes or reads.
+	NetworkACLRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_network_acl_rejections_total",
+		Help: "Number of requests rejected by the network ACL by class.",
+	}, []string{"class"})
+
+	// ScrubbedFields counts the fields the response_scrubbing rules removed or masked by rule.
+	ScrubbedFields = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_scrubbed_fields_total",
+		Help: "Number of response fields removed or masked by response scrubbing rule.",
+	}, []string{"rule"})
+
+	// APIAuditedRejections counts the requests of audited API groups passed on although they would be rejected.
+	APIAuditedRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_api_audited_rejections_total",
+		Help: "Number of requests of audited API groups that would have been rejected by group.",
+	}, []string{"group"})
+
+	// OpaEvaluationsAborted counts the policy evaluations aborted by the opa_limits.
+	OpaEvaluationsAborted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nacp_opa_evaluations_aborted_total",
+		Help: "Number of OPA policy evaluations aborted by a limit.",
+	}, []string{"limit"})
+
+	// UpstreamServers is the number of discovered Nomad servers, it stays 0 with a static address.
+	UpstreamServers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nacp_upstream_servers",
+		Help: "Number of discovered nomad servers.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RulesetInfo,
+		BuildInfo,
+		Leader,
+		AdmissionQueueDepth,
+		AdmissionQueueRejected,
+		RuleDecisions,
+		ShadowEvaluations,
+		FaultsInjected,
+		ExemptionsApplied,
+		OversizedResponses,
+		AuthLogins,
+		VendedTokens,
+		VirtualTokens,
+		NearMissRequests,
+		Exemptions,
+		UpstreamServers,
+		DecisionExports,
+		OpaEvaluationsAborted,
+		MirroredJobs,
+		UpstreamRetries,
+		MaintenanceRejections,
+		NetworkACLRejections,
+		APIAuditedRejections,
+		ScrubbedFields,
+	)
+}
+
+// Handler serves all NACP metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// SetRulesetHash replaces the active ruleset hash.
+func SetRulesetHash(hash string) {
+	RulesetInfo.Reset()
+	RulesetInfo.WithLabelValues(hash).Set(1)
+}
+
+// SetBuildInfo replaces the version of the running binary.
+func SetBuildInfo(version, commit, goVersion string) {
+	BuildInfo.Reset()
+	BuildInfo.WithLabelValues(version, commit, goVersion).Set(1)
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRulesetHash(t *testing.T) {
+	SetRulesetHash("first")
+	SetRulesetHash("second")
+
+	assert.Equal(t, 1, testutil.CollectAndCount(RulesetInfo), "only the latest hash is exposed")
+	assert.Equal(t, float64(1), testutil.ToFloat64(RulesetInfo.WithLabelValues("second")))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/nacp/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `nacp_ruleset_info{hash="second"} 1`)
+}
@@ -0,0 +1,99 @@
+// Package mirror copies admitted jobs to a secondary Nomad cluster, e.g. a staging cluster or a capacity simulation.
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/metrics"
+)
+
+const (
+	// ModeRegister registers the jobs on the secondary cluster
+	ModeRegister = "register"
+	// ModePlan only plans the jobs, nothing is scheduled on the secondary cluster
+	ModePlan = "plan"
+
+	sendTimeout = 30 * time.Second
+)
+
+// Mirror asynchronously registers or plans scrubbed copies of jobs on a secondary cluster.
+// Mirroring is best effort, jobs are dropped if the queue is full and not retried if the cluster fails.
+type Mirror struct {
+	jobs   *api.Jobs
+	mode   string
+	scrub  Scrubbing
+	queue  chan *api.Job
+	logger hclog.Logger
+}
+
+func New(client *api.Client, mode string, scrub Scrubbing, bufferSize int, logger hclog.Logger) *Mirror {
+	return &Mirror{
+		jobs:   client.Jobs(),
+		mode:   mode,
+		scrub:  scrub,
+		queue:  make(chan *api.Job, bufferSize),
+		logger: logger,
+	}
+}
+
+// Mirror queues a copy of the job, it never blocks the request.
+func (m *Mirror) Mirror(job *api.Job) {
+	copied, err := copyJob(job)
+	if err != nil {
+		m.logger.Warn("Failed to copy job for mirroring", "job", job.ID, "error", err)
+		return
+	}
+	select {
+	case m.queue <- copied:
+	default:
+		metrics.MirroredJobs.WithLabelValues("dropped").Inc()
+		m.logger.Warn("Mirror queue is full, dropping job", "job", job.ID)
+	}
+}
+
+// Run sends the queued jobs until the context is done.
+func (m *Mirror) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-m.queue:
+			m.send(ctx, m.scrub.Scrub(job))
+		}
+	}
+}
+
+func (m *Mirror) send(ctx context.Context, job *api.Job) {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	options := (&api.WriteOptions{Namespace: *job.Namespace}).WithContext(ctx)
+	var err error
+	if m.mode == ModePlan {
+		_, _, err = m.jobs.Plan(job, false, options)
+	} else {
+		_, _, err = m.jobs.Register(job, options)
+	}
+	if err != nil {
+		metrics.MirroredJobs.WithLabelValues("failed").Inc()
+		m.logger.Warn("Failed to mirror job", "job", job.ID, "namespace", job.Namespace, "mode", m.mode, "error", err)
+		return
+	}
+	metrics.MirroredJobs.WithLabelValues("mirrored").Inc()
+	m.logger.Debug("Mirrored job", "job", job.ID, "namespace", job.Namespace, "mode", m.mode)
+}
+
+func copyJob(job *api.Job) (*api.Job, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	copied := &api.Job{}
+	if err := json.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
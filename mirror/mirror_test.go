@@ -0,0 +1,88 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/metrics"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type received struct {
+	path      string
+	namespace string
+	job       *api.Job
+}
+
+// stagingCluster records the jobs registered or planned on it.
+func stagingCluster(t *testing.T) (*api.Client, chan received) {
+	t.Helper()
+	requests := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Job *api.Job
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests <- received{path: r.URL.Path, namespace: r.URL.Query().Get("namespace"), job: body.Job}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+	return client, requests
+}
+
+func TestMirror(t *testing.T) {
+	tests := []struct {
+		mode     string
+		wantPath string
+	}{
+		{mode: ModeRegister, wantPath: "/v1/jobs"},
+		{mode: ModePlan, wantPath: "/v1/job/web/plan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			client, requests := stagingCluster(t)
+			m := New(client, tt.mode, Scrubbing{Namespaces: map[string]string{"*": "staging"}}, 10, hclog.NewNullLogger())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go m.Run(ctx)
+
+			job := &api.Job{ID: pointerOf("web"), Namespace: pointerOf("prod")}
+			m.Mirror(job)
+
+			select {
+			case r := <-requests:
+				assert.Equal(t, tt.wantPath, r.path)
+				assert.Equal(t, "staging", r.namespace)
+				assert.Equal(t, "staging", *r.job.Namespace)
+			case <-time.After(5 * time.Second):
+				t.Fatal("job was not mirrored")
+			}
+			assert.Equal(t, "prod", *job.Namespace, "the admitted job is not changed")
+		})
+	}
+}
+
+func TestMirror_DropsJobsIfQueueIsFull(t *testing.T) {
+	client, _ := stagingCluster(t)
+	m := New(client, ModeRegister, Scrubbing{}, 1, hclog.NewNullLogger())
+	dropped := metrics.MirroredJobs.WithLabelValues("dropped")
+	before := promtestutil.ToFloat64(dropped)
+
+	m.Mirror(&api.Job{ID: pointerOf("a")})
+	m.Mirror(&api.Job{ID: pointerOf("b")})
+	assert.Equal(t, before+1, promtestutil.ToFloat64(dropped))
+}
+
+func pointerOf[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,101 @@
+package mirror
+
+import (
+	"path"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+const redacted = "REDACTED"
+
+// DefaultRedact are the patterns of the keys whose values are redacted unless configured otherwise.
+var DefaultRedact = []string{"*TOKEN*", "*SECRET*", "*PASSWORD*", "*KEY*", "*CREDENTIAL*"}
+
+// Scrubbing adapts a job to the secondary cluster and removes its secrets.
+type Scrubbing struct {
+	// Namespaces maps the namespaces of the jobs to the ones of the secondary cluster, * matches every other namespace
+	Namespaces map[string]string
+	// Datacenters replace the datacenters of the job if set
+	Datacenters []string
+	// Region replaces the region of the job if set
+	Region string
+	// Redact are case-insensitive glob patterns of env, meta and driver config keys whose values are redacted, e.g. *TOKEN*
+	Redact []string
+}
+
+// Scrub changes the job in place and returns it.
+// The tokens of the job and the vault blocks of its tasks are always removed.
+func (s Scrubbing) Scrub(job *api.Job) *api.Job {
+	namespace := "default"
+	if job.Namespace != nil && *job.Namespace != "" {
+		namespace = *job.Namespace
+	}
+	if target, ok := s.Namespaces[namespace]; ok {
+		namespace = target
+	} else if target, ok := s.Namespaces["*"]; ok {
+		namespace = target
+	}
+	job.Namespace = &namespace
+	if len(s.Datacenters) > 0 {
+		job.Datacenters = s.Datacenters
+	}
+	if s.Region != "" {
+		job.Region = &s.Region
+	}
+
+	job.VaultToken = nil
+	job.ConsulToken = nil
+	job.NomadTokenID = nil
+	s.redactStrings(job.Meta)
+	for _, group := range job.TaskGroups {
+		s.redactStrings(group.Meta)
+		for _, task := range group.Tasks {
+			task.Vault = nil
+			s.redactStrings(task.Env)
+			s.redactStrings(task.Meta)
+			s.redactConfig(task.Config)
+		}
+	}
+	return job
+}
+
+func (s Scrubbing) redactStrings(values map[string]string) {
+	for key := range values {
+		if s.sensitive(key) {
+			values[key] = redacted
+		}
+	}
+}
+
+// redactConfig redacts the driver config, e.g. the password of a docker auth block.
+func (s Scrubbing) redactConfig(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if _, isString := child.(string); isString && s.sensitive(key) {
+				v[key] = redacted
+				continue
+			}
+			s.redactConfig(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			s.redactConfig(child)
+		}
+	case []map[string]interface{}:
+		for _, child := range v {
+			s.redactConfig(child)
+		}
+	}
+}
+
+func (s Scrubbing) sensitive(key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range s.Redact {
+		if ok, _ := path.Match(strings.ToUpper(pattern), key); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package mirror
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrubbing_Scrub(t *testing.T) {
+	job := &api.Job{
+		ID:          pointerOf("web"),
+		Namespace:   pointerOf("prod"),
+		Datacenters: []string{"eu-1"},
+		VaultToken:  pointerOf("s.secret"),
+		Meta:        map[string]string{"owner": "team-a", "api_token": "abc"},
+		TaskGroups: []*api.TaskGroup{{
+			Tasks: []*api.Task{{
+				Name:  "server",
+				Vault: &api.Vault{Policies: []string{"web"}},
+				Env:   map[string]string{"DB_PASSWORD": "hunter2", "PORT": "8080"},
+				Config: map[string]interface{}{
+					"image": "web:1.0",
+					"auth":  []interface{}{map[string]interface{}{"username": "ci", "password": "hunter2"}},
+				},
+			}},
+		}},
+	}
+	s := Scrubbing{
+		Namespaces:  map[string]string{"prod": "staging", "*": "sandbox"},
+		Datacenters: []string{"staging-1"},
+		Region:      "staging",
+		Redact:      DefaultRedact,
+	}
+	scrubbed := s.Scrub(job)
+
+	assert.Equal(t, "staging", *scrubbed.Namespace)
+	assert.Equal(t, []string{"staging-1"}, scrubbed.Datacenters)
+	assert.Equal(t, "staging", *scrubbed.Region)
+	assert.Nil(t, scrubbed.VaultToken)
+	assert.Equal(t, map[string]string{"owner": "team-a", "api_token": "REDACTED"}, scrubbed.Meta)
+
+	task := scrubbed.TaskGroups[0].Tasks[0]
+	assert.Nil(t, task.Vault)
+	assert.Equal(t, map[string]string{"DB_PASSWORD": "REDACTED", "PORT": "8080"}, task.Env)
+	assert.Equal(t, map[string]interface{}{
+		"image": "web:1.0",
+		"auth":  []interface{}{map[string]interface{}{"username": "ci", "password": "REDACTED"}},
+	}, task.Config)
+}
+
+func TestScrubbing_Namespaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespace  *string
+		namespaces map[string]string
+		want       string
+	}{
+		{name: "mapped", namespace: pointerOf("prod"), namespaces: map[string]string{"prod": "staging"}, want: "staging"},
+		{name: "wildcard", namespace: pointerOf("team-a"), namespaces: map[string]string{"prod": "staging", "*": "sandbox"}, want: "sandbox"},
+		{name: "unmapped", namespace: pointerOf("team-a"), namespaces: map[string]string{"prod": "staging"}, want: "team-a"},
+		{name: "default namespace", namespaces: map[string]string{"default": "staging"}, want: "staging"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := Scrubbing{Namespaces: tt.namespaces}.Scrub(&api.Job{Namespace: tt.namespace})
+			assert.Equal(t, tt.want, *job.Namespace)
+		})
+	}
+}
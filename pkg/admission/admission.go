@@ -0,0 +1,158 @@
+// Package admission lets Go programs embed the NACP pipeline, e.g. in custom proxies or CLIs.
+// It exposes the rule interfaces, a chain builder and the config loader, the types are kept stable across minor releases.
+package admission
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/opa"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+)
+
+type (
+	Mutator   = admissionctrl.JobMutator
+	Validator = admissionctrl.JobValidator
+	// ContextMutator and ContextValidator are rules that stop when the context of AdmitContext is cancelled
+	ContextMutator   = admissionctrl.ContextMutator
+	ContextValidator = admissionctrl.ContextValidator
+	// PatchMutator describes its changes as a JSON patch, see MutatePatch
+	PatchMutator = admissionctrl.PatchMutator
+	Mutation     = types.Mutation
+	// ResultValidator returns structured results, see ValidateResults
+	ResultValidator = admissionctrl.ResultValidator
+	Result          = types.Result
+	Payload         = types.Payload
+	RequestContext  = config.RequestContext
+	Config          = config.Config
+)
+
+// LoadConfig reads an NACP config file.
+func LoadConfig(path string) (*Config, error) {
+	return config.LoadConfig(path)
+}
+
+// Chain builds a pipeline from configured and custom rules, mutators run in the order they were added.
+type Chain struct {
+	logger       hclog.Logger
+	mutators     []Mutator
+	validators   []Validator
+	resolveToken bool
+	versions     admissionctrl.RuleVersions
+	maxPasses    int
+	conflicts    admissionctrl.ConflictStrategy
+	err          error
+}
+
+func NewChain() *Chain {
+	return &Chain{logger: hclog.NewNullLogger()}
+}
+
+func (c *Chain) WithLogger(logger hclog.Logger) *Chain {
+	c.logger = logger
+	return c
+}
+
+// WithConfig adds the rules of the config, errors are returned by Build.
+func (c *Chain) WithConfig(cfg *Config, opaOptions ...opa.Option) *Chain {
+	mutators, validators, resolveToken, err := BuildRules(cfg, c.logger, opaOptions...)
+	if err != nil {
+		c.err = err
+		return c
+	}
+	c.mutators = append(c.mutators, mutators...)
+	c.validators = append(c.validators, validators...)
+	c.resolveToken = c.resolveToken || resolveToken
+	c.versions = RuleVersions(cfg)
+	if cfg.Revalidation != nil {
+		c.maxPasses = cfg.Revalidation.MaxPasses
+	}
+	if cfg.MutatorConflicts != nil {
+		c.conflicts = admissionctrl.ConflictStrategy(cfg.MutatorConflicts.Strategy)
+	}
+	return c
+}
+
+func (c *Chain) Mutate(mutators ...Mutator) *Chain {
+	c.mutators = append(c.mutators, mutators...)
+	return c
+}
+
+// MutatePatch adds mutators returning JSON patches, they run in order with the other mutators.
+func (c *Chain) MutatePatch(mutators ...PatchMutator) *Chain {
+	for _, mutator := range mutators {
+		c.mutators = append(c.mutators, admissionctrl.AsMutator(mutator))
+	}
+	return c
+}
+
+func (c *Chain) Validate(validators ...Validator) *Chain {
+	c.validators = append(c.validators, validators...)
+	return c
+}
+
+// ValidateResults adds validators returning structured results, results with the severity error reject the job.
+func (c *Chain) ValidateResults(validators ...ResultValidator) *Chain {
+	for _, validator := range validators {
+		c.validators = append(c.validators, admissionctrl.AsValidator(validator))
+	}
+	return c
+}
+
+// Revalidate re-runs the mutators until the job is stable, at most maxPasses times, before it is validated.
+func (c *Chain) Revalidate(maxPasses int) *Chain {
+	c.maxPasses = maxPasses
+	return c
+}
+
+// ResolveToken marks that rules need the token info in the request context.
+func (c *Chain) ResolveToken(resolve bool) *Chain {
+	c.resolveToken = c.resolveToken || resolve
+	return c
+}
+
+func (c *Chain) Build() (*Pipeline, error) {
+	if c.err != nil {
+		return nil, fmt.Errorf("failed to build rules: %w", c.err)
+	}
+	handler := admissionctrl.NewJobHandler(c.mutators, c.validators, c.logger, c.resolveToken)
+	handler.UseRuleVersions(c.versions)
+	handler.UseRevalidation(c.maxPasses)
+	handler.UseConflictStrategy(c.conflicts)
+	return &Pipeline{handler: handler}, nil
+}
+
+// Pipeline applies the mutators and then the validators to a job.
+type Pipeline struct {
+	handler *admissionctrl.JobHandler
+}
+
+// Admit returns the mutated job and warnings, or an error if a rule failed or rejected the job.
+func (p *Pipeline) Admit(job *api.Job, reqCtx *RequestContext) (*api.Job, []error, error) {
+	return p.handler.ApplyAdmissionControllers(&Payload{Job: job, Context: reqCtx})
+}
+
+// AdmitContext is Admit with a context that cancels the rules in flight, e.g. the context of the caller's request.
+func (p *Pipeline) AdmitContext(ctx context.Context, job *api.Job, reqCtx *RequestContext) (*api.Job, []error, error) {
+	return p.handler.ApplyAdmissionControllersContext(ctx, &Payload{Job: job, Context: reqCtx})
+}
+
+// RecordUsage counts the admitted job with the rules limiting usage, e.g. quotas. Callers call it once Nomad
+// accepted the registration, rejected registrations don't count.
+func (p *Pipeline) RecordUsage(job *api.Job, reqCtx *RequestContext) {
+	p.handler.RecordUsage(&Payload{Job: job, Context: reqCtx})
+}
+
+// ResolveToken reports whether the caller has to put the token info into the request context.
+func (p *Pipeline) ResolveToken() bool {
+	return p.handler.ResolveToken()
+}
+
+// Handler returns the underlying job handler, e.g. to swap the rules at runtime.
+func (p *Pipeline) Handler() *admissionctrl.JobHandler {
+	return p.handler
+}
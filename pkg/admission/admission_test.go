@@ -0,0 +1,63 @@
+package admission
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rejectingValidator struct{}
+
+func (rejectingValidator) Validate(payload *types.Payload) ([]error, error) {
+	if payload.Job.Meta["hello"] != "world" {
+		return nil, errors.New("job was not mutated")
+	}
+	if payload.Context == nil || payload.Context.ClientIP != "127.0.0.1" {
+		return nil, errors.New("context is missing")
+	}
+	return []error{errors.New("looks fine")}, nil
+}
+
+func (rejectingValidator) Name() string {
+	return "rejecting"
+}
+
+func TestChain(t *testing.T) {
+	pipeline, err := NewChain().
+		Mutate(&testutil.HelloMutator{MutatorName: "hello"}).
+		Validate(rejectingValidator{}).
+		ResolveToken(true).
+		Revalidate(3).
+		Build()
+	require.NoError(t, err)
+	assert.True(t, pipeline.ResolveToken())
+
+	job, warnings, err := pipeline.Admit(&api.Job{}, &RequestContext{ClientIP: "127.0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "world", job.Meta["hello"])
+	assert.Equal(t, []error{errors.New("looks fine")}, warnings)
+
+	_, _, err = pipeline.Admit(&api.Job{}, nil)
+	assert.ErrorContains(t, err, "context is missing")
+}
+
+func TestChainWithConfig(t *testing.T) {
+	pipeline, err := NewChain().WithConfig(&config.Config{
+		Validators: []config.Validator{{Type: "limits", Name: "limits", Limits: &config.Limits{MaxTaskGroups: 1}}},
+	}).Build()
+	require.NoError(t, err)
+
+	_, _, err = pipeline.Admit(&api.Job{TaskGroups: []*api.TaskGroup{{}, {}}}, nil)
+	assert.ErrorContains(t, err, "job has 2 task groups, the limit in namespace default is 1")
+
+	_, err = NewChain().WithConfig(&config.Config{
+		Validators: []config.Validator{{Type: "unknown", Name: "broken"}},
+	}).Build()
+	assert.ErrorContains(t, err, "unknown validator type unknown")
+}
@@ -0,0 +1,188 @@
+package admission
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// builtinDescriptions explain the built-in rule types for the policy documentation.
+var builtinDescriptions = map[string]string{
+	"validator/notation":          "Job images must be signed by a trusted publisher.",
+	"validator/quota":             "Limits how many jobs, or bytes of job definitions, a namespace or token may register within a time window.",
+	"validator/protected_jobs":    "Critical jobs can only be changed with an override meta key or override policy.",
+	"validator/deregister":        "Critical jobs can only be stopped or purged as allowed, with an override policy or an approval.",
+	"validator/disruption":        "Restarts, allocation stops and forced evaluations of the jobs are restricted or rate limited.",
+	"validator/constraints":       "Constraints that can never be satisfied are rejected before the job gets stuck pending.",
+	"validator/static_ports":      "Static ports must be within the allowed ranges of the namespace.",
+	"validator/connect":           "Consul services must follow the service mesh rules.",
+	"validator/naming":            "Service names, service tags and network hostnames must follow the naming conventions.",
+	"validator/template":          "The template stanzas of the tasks must follow the template policy.",
+	"validator/secrets":           "Env vars, templates and meta must not contain plaintext credentials.",
+	"validator/limits":            "Job specs must stay within the size limits.",
+	"validator/update":            "Service and system jobs must have sane update and migrate stanzas.",
+	"validator/devices":           "Device requests must stay within the limits of the namespace.",
+	"validator/priority":          "The job priority must be within the allowed band.",
+	"validator/periodic":          "Periodic jobs must not run more often than allowed.",
+	"validator/volumes":           "Only the allowed host and CSI volumes may be mounted.",
+	"validator/workload_identity": "Tasks and services must have a consistent workload identity.",
+	"validator/placement":         "Jobs may only target the allowed datacenters and node pools of their namespace.",
+	"validator/ownership":         "The declared owner of the job must match the ownership registry.",
+	"mutator/consul_intentions":   "Creates Consul intentions for the Connect upstreams of the job.",
+	"mutator/placement":           "Places the job into its node pool and adds the required spreads.",
+	"mutator/devices":             "Adds vendor specific env vars and meta to tasks requesting a device.",
+	"mutator/priority":            "Rewrites the job priority into the allowed band.",
+	"mutator/meta":                "Normalizes the meta keys of the job, fills missing values and rejects jobs without the required ones.",
+}
+
+// ruleBlocks are the common blocks of rules, every other block holds the settings of the rule type.
+var ruleBlocks = map[string]bool{"opa_rule": true, "webhook": true, "jobs": true, "canary": true, "notation": true}
+
+// RuleDoc describes a configured rule for the policy documentation.
+type RuleDoc struct {
+	// Kind is validator or mutator
+	Kind    string
+	Type    string
+	Name    string
+	Version string
+	// Enforcement tells what happens to a job violating the rule, e.g. deny or warn
+	Enforcement string
+	Jobs        *config.Jobs
+	// Title and Description come from the METADATA annotation of the package for OPA rules
+	Title       string
+	Description string
+	// Messages are the titles and descriptions of the annotated rules of an OPA policy
+	Messages []string
+	// Settings are the options of a built-in rule by their config names
+	Settings   map[string]interface{}
+	Exemptions []config.Exemption
+}
+
+// Docs describes the rules of the config in their order, the OPA policies are read for their annotations.
+func Docs(c *config.Config) ([]RuleDoc, error) {
+	versions := RuleVersions(c)
+	var docs []RuleDoc
+	for _, m := range c.Mutators {
+		doc := RuleDoc{Kind: "mutator", Type: m.Type, Name: m.Name, Version: versions.Mutators[m.Name], Enforcement: "mutate", Jobs: m.Jobs}
+		if err := describe(&doc, m, m.OpaRule); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	for _, v := range c.Validators {
+		doc := RuleDoc{Kind: "validator", Type: v.Type, Name: v.Name, Version: versions.Validators[v.Name], Jobs: v.Jobs}
+		enforcement, err := enforcement(v)
+		if err != nil {
+			return nil, err
+		}
+		doc.Enforcement = enforcement
+		if err := describe(&doc, v, v.OpaRule); err != nil {
+			return nil, err
+		}
+		if c.Exemptions != nil {
+			for _, e := range c.Exemptions.Exemptions {
+				if e.Rule == v.Name {
+					doc.Exemptions = append(doc.Exemptions, e)
+				}
+			}
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func enforcement(v config.Validator) (string, error) {
+	severity, err := types.ParseSeverity(v.Severity)
+	if err != nil {
+		return "", fmt.Errorf("invalid severity of validator %s: %w", v.Name, err)
+	}
+	switch {
+	case severity == types.SeverityInfo:
+		return "inform", nil
+	case severity == types.SeverityWarning:
+		return "warn", nil
+	case v.Canary != nil:
+		return fmt.Sprintf("deny for %g%% of the jobs, warn for the others", v.Canary.Percent), nil
+	}
+	return "deny", nil
+}
+
+func describe(doc *RuleDoc, rule interface{}, opaRule *config.OpaRule) error {
+	doc.Description = builtinDescriptions[doc.Kind+"/"+doc.Type]
+	if opaRule != nil {
+		if err := annotations(doc, opaRule.Filename); err != nil {
+			return fmt.Errorf("failed to read the annotations of %s: %w", doc.Name, err)
+		}
+	}
+	v := reflect.ValueOf(rule)
+	for i := 0; i < v.NumField(); i++ {
+		name, kind, _ := strings.Cut(v.Type().Field(i).Tag.Get("hcl"), ",")
+		if kind != "block" || ruleBlocks[name] || v.Field(i).IsNil() {
+			continue
+		}
+		doc.Settings = hclValue(v.Field(i)).(map[string]interface{})
+	}
+	return nil
+}
+
+// annotations reads the METADATA comments of the policy, the ones of the package describe the rule.
+func annotations(doc *RuleDoc, filename string) error {
+	policy, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	module, err := ast.ParseModuleWithOpts(filename, string(policy), ast.ParserOptions{ProcessAnnotation: true})
+	if err != nil {
+		return err
+	}
+	for _, a := range module.Annotations {
+		switch a.Scope {
+		case "package", "subpackages":
+			doc.Title, doc.Description = a.Title, a.Description
+		default:
+			var parts []string
+			for _, part := range []string{a.Title, strings.TrimSpace(a.Description)} {
+				if part != "" {
+					parts = append(parts, part)
+				}
+			}
+			if len(parts) > 0 {
+				doc.Messages = append(doc.Messages, strings.Join(parts, ": "))
+			}
+		}
+	}
+	return nil
+}
+
+// hclValue converts a config value to maps keyed by the config names, zero values are omitted.
+func hclValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return hclValue(v.Elem())
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("hcl"), ",")
+			if name == "" || v.Field(i).IsZero() {
+				continue
+			}
+			m[name] = hclValue(v.Field(i))
+		}
+		return m
+	case reflect.Slice:
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = hclValue(v.Index(i))
+		}
+		return values
+	}
+	return v.Interface()
+}
@@ -0,0 +1,115 @@
+package admission
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const annotatedPolicy = `# METADATA
+# title: Cost center
+# description: Every job must be billed to a cost center.
+package costcenter
+
+# METADATA
+# title: Missing cost center
+# description: Set meta.costcenter on the job.
+errors[msg] {
+	not input.job.Meta.costcenter
+	msg := "missing costcenter"
+}
+
+# METADATA
+# title: Unknown cost center
+errors[msg] {
+	false
+	msg := "unknown costcenter"
+}
+`
+
+func TestDocs(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "costcenter.rego")
+	require.NoError(t, os.WriteFile(policyFile, []byte(annotatedPolicy), 0644))
+
+	c := config.DefaultConfig()
+	c.Validators = []config.Validator{
+		{
+			Type:    "opa",
+			Name:    "costcenter",
+			OpaRule: &config.OpaRule{Filename: policyFile, Query: "errors = data.costcenter.errors"},
+			Jobs:    &config.Jobs{Exclude: []string{"legacy-*"}},
+			Canary:  &config.Canary{Percent: 25},
+		},
+		{
+			Type:     "priority",
+			Name:     "priority",
+			Severity: "warning",
+			Priority: &config.Priority{Max: 70, Namespaces: []config.PriorityBand{{Name: "ops", Max: 90}}},
+		},
+	}
+	c.Mutators = []config.Mutator{
+		{Type: "json_patch_webhook", Name: "hook", Webhook: &config.Webhook{Endpoint: "http://localhost", Method: "POST"}},
+	}
+	c.Exemptions = &config.Exemptions{Exemptions: []config.Exemption{
+		{Rule: "costcenter", Job: "batch-*", Expires: "2030-01-01", Reason: "migration"},
+		{Rule: "other", Expires: "2030-01-01", Reason: "other"},
+	}}
+
+	docs, err := Docs(c)
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+	versions := RuleVersions(c)
+
+	assert.Equal(t, RuleDoc{Kind: "mutator", Type: "json_patch_webhook", Name: "hook", Version: versions.Mutators["hook"], Enforcement: "mutate"}, docs[0])
+
+	assert.Equal(t, RuleDoc{
+		Kind:        "validator",
+		Type:        "opa",
+		Name:        "costcenter",
+		Version:     versions.Validators["costcenter"],
+		Enforcement: "deny for 25% of the jobs, warn for the others",
+		Jobs:        &config.Jobs{Exclude: []string{"legacy-*"}},
+		Title:       "Cost center",
+		Description: "Every job must be billed to a cost center.",
+		Messages:    []string{"Missing cost center: Set meta.costcenter on the job.", "Unknown cost center"},
+		Exemptions:  []config.Exemption{c.Exemptions.Exemptions[0]},
+	}, docs[1])
+
+	assert.Equal(t, "warn", docs[2].Enforcement)
+	assert.Equal(t, "The job priority must be within the allowed band.", docs[2].Description)
+	assert.Equal(t, map[string]interface{}{
+		"max":       70,
+		"namespace": []interface{}{map[string]interface{}{"name": "ops", "max": 90}},
+	}, docs[2].Settings)
+}
+
+func TestDocsFails(t *testing.T) {
+	tt := []struct {
+		name      string
+		validator config.Validator
+		want      string
+	}{
+		{
+			name:      "unknown severity",
+			validator: config.Validator{Type: "webhook", Name: "hook", Severity: "fatal"},
+			want:      "invalid severity of validator hook",
+		},
+		{
+			name:      "missing policy",
+			validator: config.Validator{Type: "opa", Name: "missing", OpaRule: &config.OpaRule{Filename: "missing.rego"}},
+			want:      "failed to read the annotations of missing",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := config.DefaultConfig()
+			c.Validators = []config.Validator{tc.validator}
+			_, err := Docs(c)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
@@ -0,0 +1,911 @@
+package admission
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/mutator"
+	"github.com/mxab/nacp/admissionctrl/notation"
+	"github.com/mxab/nacp/admissionctrl/opa"
+	"github.com/mxab/nacp/admissionctrl/priority"
+	"github.com/mxab/nacp/admissionctrl/selector"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/config"
+	"github.com/notaryproject/notation-go/dir"
+	"github.com/notaryproject/notation-go/verifier/trustpolicy"
+	"github.com/notaryproject/notation-go/verifier/truststore"
+)
+
+// BuildRules creates all configured mutators and validators.
+func BuildRules(c *config.Config, appLogger hclog.Logger, opaOptions ...opa.Option) ([]admissionctrl.JobMutator, []admissionctrl.JobValidator, bool, error) {
+	jobMutators, resolveTokenMutators, err := BuildMutators(c, appLogger.Named("mutators"), opaOptions...)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to create mutators: %w", err)
+	}
+
+	jobValidators, resolveTokenValidators, err := BuildValidators(c, appLogger.Named("validators"), opaOptions...)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to create validators: %w", err)
+	}
+
+	var resolveToken bool
+	if resolveTokenMutators || resolveTokenValidators {
+		resolveToken = true
+	}
+	return jobMutators, jobValidators, resolveToken, nil
+}
+
+func BuildMutators(c *config.Config, logger hclog.Logger, extraOpaOptions ...opa.Option) ([]admissionctrl.JobMutator, bool, error) {
+	var jobMutators []admissionctrl.JobMutator
+	var resolveToken bool
+	opaOptions, err := OpaOptions(c, logger)
+	if err != nil {
+		return nil, false, err
+	}
+	opaOptions = append(opaOptions, extraOpaOptions...)
+	var patchPolicy *mutator.PatchPolicy
+	if p := c.PatchPolicy; p != nil {
+		patchPolicy = &mutator.PatchPolicy{ProtectedPaths: p.ProtectedPaths, MaxOperations: p.MaxOperations, TypeChecks: p.TypeChecks}
+	}
+	for _, m := range c.Mutators {
+		if m.ResolveToken {
+			resolveToken = true
+		}
+		switch m.Type {
+		case "opa_json_patch":
+			notationVerifier, err := buildVerifierIfEnabled(m.OpaRule.Notation, logger.Named("notation_verifier"))
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			mutator, err := mutator.NewOpaJsonPatchMutator(m.Name, m.OpaRule.Filename, m.OpaRule.Query, logger.Named("opa_mutator"), notationVerifier, ruleOpaOptions(m.OpaRule, opaOptions)...)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			mutator.UsePatchPolicy(patchPolicy)
+			jobMutators = append(jobMutators, mutator)
+
+		case "json_patch_webhook":
+			mutator, err := mutator.NewJsonPatchWebhookMutator(m.Name, m.Webhook.Endpoint, m.Webhook.Method, m.Webhook.MaxResponseSize, logger.Named("json_patch_webhook_mutator"))
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			mutator.UsePatchPolicy(patchPolicy)
+			jobMutators = append(jobMutators, mutator)
+		case "consul_intentions":
+			client, err := ConsulClient(c)
+			if err != nil {
+				return nil, resolveToken, fmt.Errorf("failed to create consul client: %w", err)
+			}
+			var dryRun bool
+			if m.ConsulIntentions != nil {
+				dryRun = m.ConsulIntentions.DryRun
+			}
+			mutator := mutator.NewConsulIntentionsMutator(logger.Named("consul_intentions_mutator"), m.Name, mutator.NewConsulIntentions(client), dryRun)
+			jobMutators = append(jobMutators, mutator)
+		case "placement":
+			if m.Placement == nil {
+				return nil, resolveToken, fmt.Errorf("placement mutator %s requires a placement block", m.Name)
+			}
+			jobSelector, err := selector.New(m.Placement.Selector)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			spreads, err := buildSpreads(m.Placement.Spreads)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			mutator := mutator.NewPlacementMutator(logger.Named("placement_mutator"), m.Name, jobSelector, m.Placement.NodePool, spreads)
+			jobMutators = append(jobMutators, mutator)
+		case "devices":
+			if m.Devices == nil {
+				return nil, resolveToken, fmt.Errorf("devices mutator %s requires a devices block", m.Name)
+			}
+			vendors := make(map[string]mutator.DeviceSettings, len(m.Devices.Vendors))
+			for _, vendor := range m.Devices.Vendors {
+				vendors[vendor.Name] = mutator.DeviceSettings{Env: vendor.Env, Meta: vendor.Meta}
+			}
+			mutator := mutator.NewDeviceMutator(logger.Named("devices_mutator"), m.Name, vendors)
+			jobMutators = append(jobMutators, mutator)
+		case "priority":
+			if m.Priority == nil {
+				return nil, resolveToken, fmt.Errorf("priority mutator %s requires a priority block", m.Name)
+			}
+			mutator := mutator.NewPriorityMutator(logger.Named("priority_mutator"), m.Name, buildPriorityPolicy(m.Priority))
+			jobMutators = append(jobMutators, mutator)
+		case "meta":
+			if m.Meta == nil {
+				return nil, resolveToken, fmt.Errorf("meta mutator %s requires a meta block", m.Name)
+			}
+			keys := make([]mutator.MetaKey, 0, len(m.Meta.Keys))
+			for _, k := range m.Meta.Keys {
+				keys = append(keys, mutator.MetaKey{Name: k.Name, Aliases: k.Aliases, Required: k.Required, Default: k.Default, From: k.From, Lowercase: k.Lowercase})
+			}
+			required := make(map[string][]string, len(m.Meta.Namespaces))
+			for _, ns := range m.Meta.Namespaces {
+				required[ns.Name] = ns.Required
+			}
+			mutator, err := mutator.NewMetaMutator(logger.Named("meta_mutator"), m.Name, keys, required)
+			if err != nil {
+				return nil, resolveToken, fmt.Errorf("invalid meta mutator %s: %w", m.Name, err)
+			}
+			jobMutators = append(jobMutators, mutator)
+
+		default:
+			return nil, resolveToken, fmt.Errorf("unknown mutator type %s", m.Type)
+		}
+
+		if m.Jobs != nil {
+			last := len(jobMutators) - 1
+			jobs, err := selector.NewJobFilter(m.Jobs)
+			if err != nil {
+				return nil, resolveToken, fmt.Errorf("invalid jobs block of mutator %s: %w", m.Name, err)
+			}
+			jobMutators[last] = admissionctrl.NewScopedMutator(jobMutators[last], jobs, logger.Named("scope"))
+		}
+
+	}
+	return jobMutators, resolveToken, nil
+}
+
+func BuildValidators(c *config.Config, logger hclog.Logger, extraOpaOptions ...opa.Option) ([]admissionctrl.JobValidator, bool, error) {
+	var jobValidators []admissionctrl.JobValidator
+	var resolveToken bool
+	opaOptions, err := OpaOptions(c, logger)
+	if err != nil {
+		return nil, false, err
+	}
+	opaOptions = append(opaOptions, extraOpaOptions...)
+	for _, v := range c.Validators {
+		if v.ResolveToken {
+			resolveToken = true
+		}
+		switch v.Type {
+		case "opa":
+			notationVerifier, err := buildVerifierIfEnabled(v.Notation, logger.Named("notation_verifier"))
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			opaValidator, err := validator.NewOpaValidator(v.Name, v.OpaRule.Filename, v.OpaRule.Query, logger.Named("opa_validator"), notationVerifier, ruleOpaOptions(v.OpaRule, opaOptions)...)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, opaValidator)
+
+		case "webhook":
+			validator, err := validator.NewWebhookValidator(v.Name, v.Webhook.Endpoint, v.Webhook.Method, v.Webhook.MaxResponseSize, logger.Named("webhook_validator"))
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, validator)
+		case "notation":
+			notationVerifier, err := buildVerifier(v.Notation, logger.Named("notation_verifier"))
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			validator := validator.NewNotationValidator(logger.Named("notation_validator"), v.Name, notationVerifier, v.Notation.Parallelism)
+
+			jobValidators = append(jobValidators, validator)
+		case "quota":
+			if v.Quota == nil {
+				return nil, resolveToken, fmt.Errorf("quota validator %s requires a quota block", v.Name)
+			}
+			window, err := time.ParseDuration(v.Quota.Window)
+			if err != nil {
+				return nil, resolveToken, fmt.Errorf("invalid quota window: %w", err)
+			}
+			validator, err := validator.NewQuotaValidator(logger.Named("quota_validator"), v.Name, v.Quota.Key, window, v.Quota.MaxRegistrations, v.Quota.MaxBytes, v.Quota.Namespaces)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, validator)
+		case "protected_jobs":
+			if v.ProtectedJobs == nil {
+				return nil, resolveToken, fmt.Errorf("protected_jobs validator %s requires a protected_jobs block", v.Name)
+			}
+			jobSelector, err := selector.New(v.ProtectedJobs.Selector)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			validator := validator.NewProtectedJobsValidator(logger.Named("protected_jobs_validator"), v.Name, jobSelector, v.ProtectedJobs.OverrideMetaKey, v.ProtectedJobs.OverridePolicies)
+			jobValidators = append(jobValidators, validator)
+		case "deregister":
+			if v.Deregister == nil {
+				return nil, resolveToken, fmt.Errorf("deregister validator %s requires a deregister block", v.Name)
+			}
+			jobSelector, err := selector.New(v.Deregister.Selector)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			policy := validator.DeregisterPolicy{
+				AllowStop:        v.Deregister.AllowStop,
+				OverridePolicies: v.Deregister.OverridePolicies,
+				ApprovalHeader:   v.Deregister.ApprovalHeader,
+			}
+			validator := validator.NewDeregisterValidator(logger.Named("deregister_validator"), v.Name, jobSelector, policy)
+			jobValidators = append(jobValidators, validator)
+		case "disruption":
+			if v.Disruption == nil {
+				return nil, resolveToken, fmt.Errorf("disruption validator %s requires a disruption block", v.Name)
+			}
+			jobSelector, err := selector.New(v.Disruption.Selector)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			policy := validator.DisruptionPolicy{
+				Operations:       v.Disruption.Operations,
+				OverridePolicies: v.Disruption.OverridePolicies,
+				Forbid:           v.Disruption.Forbid,
+				MaxDisruptions:   v.Disruption.MaxDisruptions,
+			}
+			if v.Disruption.Window != "" {
+				policy.Window, err = time.ParseDuration(v.Disruption.Window)
+				if err != nil {
+					return nil, resolveToken, fmt.Errorf("invalid disruption window: %w", err)
+				}
+			}
+			validator, err := validator.NewDisruptionValidator(logger.Named("disruption_validator"), v.Name, jobSelector, policy)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, validator)
+		case "constraints":
+			var mode string
+			var inventory validator.InventorySource
+			if v.Constraints != nil {
+				mode = v.Constraints.Mode
+				if v.Constraints.CheckCluster {
+					client, err := NomadClient(c)
+					if err != nil {
+						return nil, resolveToken, err
+					}
+					ttl, err := LookupCacheTTL(c)
+					if err != nil {
+						return nil, resolveToken, err
+					}
+					inventory = validator.NewNomadInventory(client, ttl)
+				}
+			}
+			validator, err := validator.NewConstraintValidator(logger.Named("constraint_validator"), v.Name, mode, inventory)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, validator)
+		case "static_ports":
+			if v.StaticPorts == nil {
+				return nil, resolveToken, fmt.Errorf("static_ports validator %s requires a static_ports block", v.Name)
+			}
+			defaultRanges, err := parsePortRanges(v.StaticPorts.AllowedRanges)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			namespaceRanges := make(map[string][]validator.PortRange, len(v.StaticPorts.Namespaces))
+			for _, ns := range v.StaticPorts.Namespaces {
+				namespaceRanges[ns.Name], err = parsePortRanges(ns.AllowedRanges)
+				if err != nil {
+					return nil, resolveToken, err
+				}
+			}
+			var allocated validator.AllocatedPortsSource
+			if v.StaticPorts.CheckAllocated {
+				client, err := NomadClient(c)
+				if err != nil {
+					return nil, resolveToken, err
+				}
+				ttl, err := LookupCacheTTL(c)
+				if err != nil {
+					return nil, resolveToken, err
+				}
+				allocated = validator.NewNomadAllocatedPorts(client, ttl)
+			}
+			validator := validator.NewStaticPortValidator(logger.Named("static_port_validator"), v.Name, defaultRanges, namespaceRanges, allocated)
+			jobValidators = append(jobValidators, validator)
+		case "connect":
+			if v.Connect == nil {
+				return nil, resolveToken, fmt.Errorf("connect validator %s requires a connect block", v.Name)
+			}
+			jobSelector, err := selector.New(v.Connect.Selector)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			policy := validator.ConnectPolicy{
+				RequireSidecar:      v.Connect.RequireSidecar,
+				ForbidExposedChecks: v.Connect.ForbidExposedChecks,
+				AllowedUpstreams:    v.Connect.AllowedUpstreams,
+			}
+			if v.Connect.ServiceNamePattern != "" {
+				policy.ServiceNamePattern, err = regexp.Compile(v.Connect.ServiceNamePattern)
+				if err != nil {
+					return nil, resolveToken, fmt.Errorf("invalid service_name_pattern: %w", err)
+				}
+			}
+			validator, err := validator.NewConnectValidator(logger.Named("connect_validator"), v.Name, v.Connect.Mode, jobSelector, policy)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, validator)
+		case "naming":
+			if v.Naming == nil {
+				return nil, resolveToken, fmt.Errorf("naming validator %s requires a naming block", v.Name)
+			}
+			defaults, err := buildNamingConventions(v.Naming.ServiceName, v.Naming.Tag, v.Naming.Hostname, v.Naming.DNSCompatible)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			namespaces := make(map[string]validator.NamingConventions, len(v.Naming.Namespaces))
+			for _, ns := range v.Naming.Namespaces {
+				namespaces[ns.Name], err = buildNamingConventions(ns.ServiceName, ns.Tag, ns.Hostname, ns.DNSCompatible)
+				if err != nil {
+					return nil, resolveToken, err
+				}
+			}
+			validator := validator.NewNamingValidator(logger.Named("naming_validator"), v.Name, defaults, namespaces)
+			jobValidators = append(jobValidators, validator)
+
+		case "template":
+			if v.Template == nil {
+				return nil, resolveToken, fmt.Errorf("template validator %s requires a template block", v.Name)
+			}
+			policy, err := buildTemplatePolicy(v.Template)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			validator := validator.NewTemplateValidator(logger.Named("template_validator"), v.Name, policy)
+			jobValidators = append(jobValidators, validator)
+
+		case "secrets":
+			if v.Secrets == nil {
+				return nil, resolveToken, fmt.Errorf("secrets validator %s requires a secrets block", v.Name)
+			}
+			policy, err := buildSecretsPolicy(v.Secrets)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			validator, err := validator.NewSecretsValidator(logger.Named("secrets_validator"), v.Name, v.Secrets.Mode, policy)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, validator)
+
+		case "limits":
+			if v.Limits == nil {
+				return nil, resolveToken, fmt.Errorf("limits validator %s requires a limits block", v.Name)
+			}
+			defaults := validator.JobLimits{
+				MaxTaskGroups: v.Limits.MaxTaskGroups,
+				MaxTasks:      v.Limits.MaxTasks,
+				MaxServices:   v.Limits.MaxServices,
+				MaxBytes:      v.Limits.MaxBytes,
+			}
+			namespaces := make(map[string]validator.JobLimits, len(v.Limits.Namespaces))
+			for _, ns := range v.Limits.Namespaces {
+				namespaces[ns.Name] = validator.JobLimits{
+					MaxTaskGroups: ns.MaxTaskGroups,
+					MaxTasks:      ns.MaxTasks,
+					MaxServices:   ns.MaxServices,
+					MaxBytes:      ns.MaxBytes,
+				}
+			}
+			validator := validator.NewLimitsValidator(logger.Named("limits_validator"), v.Name, defaults, namespaces)
+			jobValidators = append(jobValidators, validator)
+
+		case "update":
+			if v.Update == nil {
+				return nil, resolveToken, fmt.Errorf("update validator %s requires an update block", v.Name)
+			}
+			jobSelector, err := selector.New(v.Update.Selector)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			validator := validator.NewUpdateValidator(logger.Named("update_validator"), v.Name, jobSelector, validator.UpdatePolicy{
+				MinParallel:         v.Update.MinParallel,
+				MaxParallel:         v.Update.MaxParallel,
+				RequireHealthChecks: v.Update.RequireHealthChecks,
+				RequireAutoRevert:   v.Update.RequireAutoRevert,
+			})
+			jobValidators = append(jobValidators, validator)
+
+		case "devices":
+			if v.Devices == nil {
+				return nil, resolveToken, fmt.Errorf("devices validator %s requires a devices block", v.Name)
+			}
+			defaults := validator.DevicePolicy{MaxGPUs: v.Devices.MaxGPUs, RequiredConstraints: v.Devices.RequiredConstraints}
+			namespaces := make(map[string]validator.DevicePolicy, len(v.Devices.Namespaces))
+			for _, ns := range v.Devices.Namespaces {
+				namespaces[ns.Name] = validator.DevicePolicy{MaxGPUs: ns.MaxGPUs, RequiredConstraints: ns.RequiredConstraints}
+			}
+			validator := validator.NewDeviceValidator(logger.Named("devices_validator"), v.Name, defaults, namespaces)
+			jobValidators = append(jobValidators, validator)
+
+		case "priority":
+			if v.Priority == nil {
+				return nil, resolveToken, fmt.Errorf("priority validator %s requires a priority block", v.Name)
+			}
+			validator := validator.NewPriorityValidator(logger.Named("priority_validator"), v.Name, buildPriorityPolicy(v.Priority))
+			jobValidators = append(jobValidators, validator)
+
+		case "periodic":
+			if v.Periodic == nil {
+				return nil, resolveToken, fmt.Errorf("periodic validator %s requires a periodic block", v.Name)
+			}
+			jobSelector, err := selector.New(v.Periodic.Selector)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			policy := validator.PeriodicPolicy{
+				RequireTimeZone:        v.Periodic.RequireTimeZone,
+				RequireProhibitOverlap: v.Periodic.RequireProhibitOverlap,
+			}
+			if v.Periodic.MinInterval != "" {
+				policy.MinInterval, err = time.ParseDuration(v.Periodic.MinInterval)
+				if err != nil {
+					return nil, resolveToken, fmt.Errorf("invalid min_interval: %w", err)
+				}
+			}
+			validator := validator.NewPeriodicValidator(logger.Named("periodic_validator"), v.Name, jobSelector, policy)
+			jobValidators = append(jobValidators, validator)
+
+		case "volumes":
+			if v.Volumes == nil {
+				return nil, resolveToken, fmt.Errorf("volumes validator %s requires a volumes block", v.Name)
+			}
+			defaults := validator.VolumePolicy{AllowedSources: v.Volumes.AllowedSources, AllowedPlugins: v.Volumes.AllowedPlugins, ReadOnly: v.Volumes.ReadOnly}
+			lookupPlugins := defaults.AllowedPlugins != nil
+			namespaces := make(map[string]validator.VolumePolicy, len(v.Volumes.Namespaces))
+			for _, ns := range v.Volumes.Namespaces {
+				namespaces[ns.Name] = validator.VolumePolicy{AllowedSources: ns.AllowedSources, AllowedPlugins: ns.AllowedPlugins, ReadOnly: ns.ReadOnly}
+				lookupPlugins = lookupPlugins || ns.AllowedPlugins != nil
+			}
+			var plugins validator.VolumePluginSource
+			if lookupPlugins {
+				client, err := NomadClient(c)
+				if err != nil {
+					return nil, resolveToken, err
+				}
+				ttl, err := LookupCacheTTL(c)
+				if err != nil {
+					return nil, resolveToken, err
+				}
+				plugins = validator.NewNomadVolumePlugins(client, ttl)
+			}
+			validator, err := validator.NewVolumeValidator(logger.Named("volumes_validator"), v.Name, defaults, namespaces, plugins)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, validator)
+
+		case "placement":
+			if v.Placement == nil {
+				return nil, resolveToken, fmt.Errorf("placement validator %s requires a placement block", v.Name)
+			}
+			defaults := validator.PlacementPolicy{AllowedDatacenters: v.Placement.AllowedDatacenters, AllowedNodePools: v.Placement.AllowedNodePools}
+			namespaces := make(map[string]validator.PlacementPolicy, len(v.Placement.Namespaces))
+			for _, ns := range v.Placement.Namespaces {
+				namespaces[ns.Name] = validator.PlacementPolicy{AllowedDatacenters: ns.AllowedDatacenters, AllowedNodePools: ns.AllowedNodePools}
+			}
+			validator, err := validator.NewPlacementValidator(logger.Named("placement_validator"), v.Name, defaults, namespaces)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators = append(jobValidators, validator)
+
+		case "ownership":
+			if v.Ownership == nil {
+				return nil, resolveToken, fmt.Errorf("ownership validator %s requires an ownership block", v.Name)
+			}
+			if !slices.ContainsFunc(c.DataSources, func(ds config.DataSource) bool { return ds.Name == v.Ownership.Source }) {
+				return nil, resolveToken, fmt.Errorf("ownership validator %s uses unknown data source %s", v.Name, v.Ownership.Source)
+			}
+			validator := validator.NewOwnershipValidator(logger.Named("ownership_validator"), v.Name, v.Ownership.Source, v.Ownership.OwnerMeta, v.Ownership.RequireRegistered)
+			jobValidators = append(jobValidators, validator)
+
+		case "workload_identity":
+			if v.WorkloadIdentity == nil {
+				return nil, resolveToken, fmt.Errorf("workload_identity validator %s requires a workload_identity block", v.Name)
+			}
+			jobSelector, err := selector.New(v.WorkloadIdentity.Selector)
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			policy := validator.IdentityPolicy{
+				AllowedAudiences: v.WorkloadIdentity.AllowedAudiences,
+				ForbidEnv:        v.WorkloadIdentity.ForbidEnv,
+			}
+			if v.WorkloadIdentity.MaxTTL != "" {
+				policy.MaxTTL, err = time.ParseDuration(v.WorkloadIdentity.MaxTTL)
+				if err != nil {
+					return nil, resolveToken, fmt.Errorf("invalid max_ttl: %w", err)
+				}
+			}
+			validator := validator.NewIdentityValidator(logger.Named("workload_identity_validator"), v.Name, jobSelector, policy)
+			jobValidators = append(jobValidators, validator)
+
+		default:
+			return nil, resolveToken, fmt.Errorf("unknown validator type %s", v.Type)
+		}
+
+		if v.Canary != nil {
+			last := len(jobValidators) - 1
+			canary, err := admissionctrl.NewCanaryValidator(jobValidators[last], v.Canary.Percent, logger.Named("canary"))
+			if err != nil {
+				return nil, resolveToken, err
+			}
+			jobValidators[last] = canary
+		}
+		severity, err := types.ParseSeverity(v.Severity)
+		if err != nil {
+			return nil, resolveToken, fmt.Errorf("invalid severity of validator %s: %w", v.Name, err)
+		}
+		if severity != types.SeverityError {
+			last := len(jobValidators) - 1
+			jobValidators[last] = admissionctrl.NewSeverityValidator(jobValidators[last], severity)
+		}
+		if v.Jobs != nil {
+			last := len(jobValidators) - 1
+			jobs, err := selector.NewJobFilter(v.Jobs)
+			if err != nil {
+				return nil, resolveToken, fmt.Errorf("invalid jobs block of validator %s: %w", v.Name, err)
+			}
+			jobValidators[last] = admissionctrl.NewScopedValidator(jobValidators[last], jobs, logger.Named("scope"))
+		}
+	}
+	return jobValidators, resolveToken, nil
+}
+
+// BuildReadRules creates the configured read rules, their OPA policies see the request context but no job.
+func BuildReadRules(c *config.Config, logger hclog.Logger, extraOpaOptions ...opa.Option) ([]*admissionctrl.ReadRule, error) {
+	if len(c.ReadRules) == 0 {
+		return nil, nil
+	}
+	opaOptions, err := OpaOptions(c, logger)
+	if err != nil {
+		return nil, err
+	}
+	opaOptions = append(opaOptions, extraOpaOptions...)
+	rules := make([]*admissionctrl.ReadRule, 0, len(c.ReadRules))
+	for _, r := range c.ReadRules {
+		opaValidator, err := validator.NewOpaValidator(r.Name, r.OpaRule.Filename, r.OpaRule.Query, logger.Named("opa_read_rule"), nil, ruleOpaOptions(r.OpaRule, opaOptions)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create read rule %s: %w", r.Name, err)
+		}
+		rules = append(rules, &admissionctrl.ReadRule{Validator: opaValidator, Paths: r.Paths, ResolveToken: r.ResolveToken})
+	}
+	return rules, nil
+}
+
+// BuildVendingPolicies creates the OPA policies of the token_vending roles by role name, they see the claims of the
+// CI token as request context but no job.
+func BuildVendingPolicies(c *config.Config, logger hclog.Logger, extraOpaOptions ...opa.Option) (map[string]admissionctrl.JobValidator, error) {
+	if c.TokenVending == nil {
+		return nil, nil
+	}
+	opaOptions, err := OpaOptions(c, logger)
+	if err != nil {
+		return nil, err
+	}
+	opaOptions = append(opaOptions, extraOpaOptions...)
+	policies := map[string]admissionctrl.JobValidator{}
+	for _, role := range c.TokenVending.Roles {
+		if role.OpaRule == nil {
+			continue
+		}
+		opaValidator, err := validator.NewOpaValidator(role.Name, role.OpaRule.Filename, role.OpaRule.Query, logger.Named("opa_vending"), nil, ruleOpaOptions(role.OpaRule, opaOptions)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create policy of token_vending role %s: %w", role.Name, err)
+		}
+		policies[role.Name] = opaValidator
+	}
+	return policies, nil
+}
+
+func buildNamingConventions(serviceName, tag, hostname string, dnsCompatible bool) (validator.NamingConventions, error) {
+	conventions := validator.NamingConventions{DNSCompatible: dnsCompatible}
+	patterns := []struct {
+		field   string
+		pattern string
+		target  **regexp.Regexp
+	}{
+		{"service_name", serviceName, &conventions.ServiceName},
+		{"tag", tag, &conventions.Tag},
+		{"hostname", hostname, &conventions.Hostname},
+	}
+	for _, p := range patterns {
+		if p.pattern == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(p.pattern)
+		if err != nil {
+			return conventions, fmt.Errorf("invalid %s pattern: %w", p.field, err)
+		}
+		*p.target = compiled
+	}
+	return conventions, nil
+}
+
+func buildPriorityPolicy(c *config.Priority) *priority.Policy {
+	policy := &priority.Policy{
+		Default:       priority.Band{Min: c.Min, Max: c.Max},
+		Namespaces:    make(map[string]priority.Band, len(c.Namespaces)),
+		TokenPolicies: make(map[string]priority.Band, len(c.Policies)),
+	}
+	for _, b := range c.Namespaces {
+		policy.Namespaces[b.Name] = priority.Band{Min: b.Min, Max: b.Max}
+	}
+	for _, b := range c.Policies {
+		policy.TokenPolicies[b.Name] = priority.Band{Min: b.Min, Max: b.Max}
+	}
+	return policy
+}
+
+func buildSpreads(c []config.Spread) ([]*api.Spread, error) {
+	var spreads []*api.Spread
+	for _, s := range c {
+		if s.Weight < 0 || s.Weight > 100 {
+			return nil, fmt.Errorf("spread weight of %s must be between 0 and 100", s.Attribute)
+		}
+		spread := &api.Spread{Attribute: s.Attribute}
+		if s.Weight > 0 {
+			weight := int8(s.Weight)
+			spread.Weight = &weight
+		}
+		for _, t := range s.Targets {
+			if t.Percent < 0 || t.Percent > 100 {
+				return nil, fmt.Errorf("spread target %s of %s must be between 0 and 100 percent", t.Value, s.Attribute)
+			}
+			spread.SpreadTarget = append(spread.SpreadTarget, &api.SpreadTarget{Value: t.Value, Percent: uint8(t.Percent)})
+		}
+		spreads = append(spreads, spread)
+	}
+	return spreads, nil
+}
+
+func buildTemplatePolicy(c *config.TemplatePolicy) (validator.TemplatePolicy, error) {
+	policy := validator.TemplatePolicy{
+		AllowedVaultPrefixes: c.AllowedVaultPrefixes,
+		AllowedChangeModes:   c.AllowedChangeModes,
+	}
+	for _, pattern := range c.DenyPatterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return policy, fmt.Errorf("invalid deny pattern: %w", err)
+		}
+		policy.DenyPatterns = append(policy.DenyPatterns, compiled)
+	}
+	if c.MaxSplay != "" {
+		maxSplay, err := time.ParseDuration(c.MaxSplay)
+		if err != nil {
+			return policy, fmt.Errorf("invalid max_splay: %w", err)
+		}
+		policy.MaxSplay = maxSplay
+	}
+	return policy, nil
+}
+
+func buildSecretsPolicy(c *config.Secrets) (validator.SecretsPolicy, error) {
+	policy := validator.SecretsPolicy{
+		MinEntropy:  c.MinEntropy,
+		MinLength:   c.MinLength,
+		AllowedKeys: c.AllowedKeys,
+	}
+	if policy.MinEntropy == 0 {
+		policy.MinEntropy = validator.DefaultSecretMinEntropy
+	}
+	if c.DisableEntropy {
+		policy.MinEntropy = 0
+	}
+	if len(c.Patterns) > 0 {
+		policy.Patterns = make(map[string]*regexp.Regexp, len(c.Patterns))
+	}
+	for name, pattern := range c.Patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return policy, fmt.Errorf("invalid secret pattern %s: %w", name, err)
+		}
+		policy.Patterns[name] = compiled
+	}
+	return policy, nil
+}
+
+func parsePortRanges(ranges []string) ([]validator.PortRange, error) {
+	var result []validator.PortRange
+	for _, r := range ranges {
+		portRange, err := validator.ParsePortRange(r)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, portRange)
+	}
+	return result, nil
+}
+
+// NomadClient creates a client for NACP's own calls against the Nomad API.
+func NomadClient(c *config.Config) (*api.Client, error) {
+	if c.Nomad == nil {
+		return nil, fmt.Errorf("no nomad block configured")
+	}
+	nomadConfig := &api.Config{
+		Address:  c.Nomad.Address,
+		SecretID: c.Nomad.Token,
+	}
+	if c.Nomad.TLS != nil {
+		nomadConfig.TLSConfig = &api.TLSConfig{
+			CACert:     c.Nomad.TLS.CaFile,
+			ClientCert: c.Nomad.TLS.CertFile,
+			ClientKey:  c.Nomad.TLS.KeyFile,
+			Insecure:   c.Nomad.TLS.InsecureSkipVerify,
+		}
+	}
+	return api.NewClient(nomadConfig)
+}
+
+func ConsulClient(c *config.Config) (*consulapi.Client, error) {
+	consulConfig := consulapi.DefaultConfig()
+	if c.Consul != nil {
+		if c.Consul.Address != "" {
+			consulConfig.Address = c.Consul.Address
+		}
+		if c.Consul.Token != "" {
+			consulConfig.Token = c.Consul.Token
+		}
+	}
+	return consulapi.NewClient(consulConfig)
+}
+
+// ruleOpaOptions adds the options of a single rule to the shared ones.
+func ruleOpaOptions(rule *config.OpaRule, opaOptions []opa.Option) []opa.Option {
+	if !rule.PartialEvaluation {
+		return opaOptions
+	}
+	return append(slices.Clone(opaOptions), opa.WithPartialEvaluation())
+}
+
+func OpaOptions(c *config.Config, logger hclog.Logger) ([]opa.Option, error) {
+	var options []opa.Option
+	if c.PolicyCacheDir != "" {
+		cache, err := opa.NewPolicyCache(c.PolicyCacheDir, logger.Named("policy_cache"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create policy cache: %w", err)
+		}
+		options = append(options, opa.WithPolicyCache(cache))
+	}
+	if c.StrictPolicies {
+		options = append(options, opa.WithStrict())
+	}
+	if c.Nomad != nil {
+		client, err := NomadClient(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create nomad client for lookups: %w", err)
+		}
+		ttl, err := LookupCacheTTL(c)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, opa.WithNomadLookup(opa.NewCachedNomadLookup(client, ttl)))
+	}
+	if c.Time != nil {
+		if c.Time.Timezone != "" {
+			location, err := time.LoadLocation(c.Time.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timezone: %w", err)
+			}
+			options = append(options, opa.WithTimeZone(location))
+		}
+		calendars, err := loadCalendars(c.Time.Calendars)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, opa.WithCalendars(calendars))
+	}
+	if c.OpaLimits != nil {
+		// validated by LoadConfig
+		timeout, _ := time.ParseDuration(c.OpaLimits.Timeout)
+		options = append(options, opa.WithLimits(opa.Limits{
+			Timeout:      timeout,
+			MaxSteps:     c.OpaLimits.MaxSteps,
+			MaxHeapBytes: uint64(c.OpaLimits.MaxHeapBytes),
+		}))
+	}
+	return options, nil
+}
+
+// LookupCacheTTL is the time results of NACP's own Nomad API calls are cached.
+func LookupCacheTTL(c *config.Config) (time.Duration, error) {
+	if c.Nomad == nil || c.Nomad.LookupCacheTTL == "" {
+		return 30 * time.Second, nil
+	}
+	ttl, err := time.ParseDuration(c.Nomad.LookupCacheTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lookup_cache_ttl: %w", err)
+	}
+	return ttl, nil
+}
+
+func loadCalendars(calendars []config.Calendar) (map[string][]string, error) {
+	result := make(map[string][]string, len(calendars))
+	for _, calendar := range calendars {
+		dates := append([]string{}, calendar.Dates...)
+		if calendar.File != "" {
+			content, err := os.ReadFile(calendar.File)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read calendar %s: %w", calendar.Name, err)
+			}
+			for _, line := range strings.Split(string(content), "\n") {
+				line = strings.TrimSpace(line)
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				dates = append(dates, line)
+			}
+		}
+		for _, date := range dates {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				return nil, fmt.Errorf("invalid date %q in calendar %s: %w", date, calendar.Name, err)
+			}
+		}
+		result[calendar.Name] = dates
+	}
+	return result, nil
+}
+
+func buildVerifierIfEnabled(notationVerifierConfig *config.NotationVerifierConfig, logger hclog.Logger) (notation.ImageVerifier, error) {
+	if notationVerifierConfig == nil {
+		return nil, nil
+	}
+	return buildVerifier(notationVerifierConfig, logger)
+}
+
+func buildVerifier(notationVerifierConfig *config.NotationVerifierConfig, logger hclog.Logger) (notation.ImageVerifier, error) {
+
+	if notationVerifierConfig == nil {
+		return nil, fmt.Errorf("notation verifier config is nil")
+	}
+	var policy *trustpolicy.Document
+	if notationVerifierConfig.TrustPolicyFile != "" {
+		var err error
+		if policy, err = notation.LoadTrustPolicyDocument(notationVerifierConfig.TrustPolicyFile); err != nil {
+			return nil, err
+		}
+	}
+	ts := truststore.NewX509TrustStore(dir.NewSysFS(notationVerifierConfig.TrustStoreDir))
+
+	var opts []notation.Option
+	if len(notationVerifierConfig.ImagePolicies) > 0 {
+		policies := make([]notation.ImagePolicy, 0, len(notationVerifierConfig.ImagePolicies))
+		for _, p := range notationVerifierConfig.ImagePolicies {
+			policies = append(policies, notation.ImagePolicy{
+				Name:         p.Name,
+				Registries:   p.Registries,
+				Repositories: p.Repositories,
+				TrustStores:  p.TrustStores,
+				Identities:   p.Identities,
+				Level:        p.Level,
+			})
+		}
+		opts = append(opts, notation.WithImagePolicies(policies))
+	}
+	if len(notationVerifierConfig.Mirrors) > 0 {
+		mirrors := make(map[string]notation.Mirror, len(notationVerifierConfig.Mirrors))
+		for _, m := range notationVerifierConfig.Mirrors {
+			mirrors[m.Registry] = notation.Mirror{Endpoint: m.Endpoint, PlainHTTP: m.PlainHTTP}
+		}
+		opts = append(opts, notation.WithMirrors(mirrors))
+	}
+	if notationVerifierConfig.ProxyURL != "" {
+		proxy, err := url.Parse(notationVerifierConfig.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notation proxy_url: %w", err)
+		}
+		opts = append(opts, notation.WithProxy(proxy))
+	}
+
+	return notation.NewImageVerifier(policy, ts, notationVerifierConfig.RepoPlainHTTP, notationVerifierConfig.MaxSigAttempts, notationVerifierConfig.CredentialStoreFile, logger, opts...)
+}
@@ -0,0 +1,849 @@
+package admission
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/admissionctrl/mutator"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/admissionctrl/validator"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildValidators(t *testing.T) {
+
+	tt := []struct {
+		name       string
+		validators config.Validator
+		want       admissionctrl.JobValidator
+		wantErr    bool
+	}{
+
+		{
+			name: "opa validator",
+			validators: config.Validator{
+
+				Type: "opa",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:    "errors = data.dummy.errors",
+					Filename: testutil.Filepath(t, "opa/errors.rego"),
+				},
+			},
+			want: &validator.OpaValidator{},
+		},
+		{
+			name: "opa validator with partial evaluation",
+			validators: config.Validator{
+				Type: "opa",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:             "errors = data.dummy.errors",
+					Filename:          testutil.Filepath(t, "opa/errors.rego"),
+					PartialEvaluation: true,
+				},
+			},
+			want: &validator.OpaValidator{},
+		},
+		{
+			name: "webhook validator",
+			validators: config.Validator{
+
+				Type: "webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+			},
+			want: &validator.WebhookValidator{},
+		},
+		{
+			name: "canary validator",
+			validators: config.Validator{
+				Type: "webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+				Canary: &config.Canary{Percent: 10},
+			},
+			want: &admissionctrl.CanaryValidator{},
+		},
+		{
+			name: "scoped validator",
+			validators: config.Validator{
+				Type: "webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+				Jobs: &config.Jobs{Exclude: []string{"legacy-*"}},
+			},
+			want: &admissionctrl.ScopedValidator{},
+		},
+		{
+			name: "validator with severity",
+			validators: config.Validator{
+				Type: "webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+				Severity: "info",
+			},
+			want: &admissionctrl.SeverityValidator{},
+		},
+		{
+			name: "validator with unknown severity",
+			validators: config.Validator{
+				Type: "webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+				Severity: "fatal",
+			},
+			wantErr: true,
+		},
+		{
+			name: "scoped validator with invalid regex",
+			validators: config.Validator{
+				Type: "webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+				Jobs: &config.Jobs{ExcludeRegex: []string{"legacy-("}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "canary validator with invalid percent",
+			validators: config.Validator{
+				Type: "webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+				Canary: &config.Canary{Percent: 110},
+			},
+			wantErr: true,
+		},
+		{
+			name: "quota validator",
+			validators: config.Validator{
+				Type: "quota",
+				Name: "test",
+				Quota: &config.Quota{
+					Key:              "namespace",
+					Window:           "1h",
+					MaxRegistrations: 10,
+				},
+			},
+			want: &validator.QuotaValidator{},
+		},
+		{
+			name: "quota validator without quota block",
+			validators: config.Validator{
+				Type: "quota",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "protected jobs validator",
+			validators: config.Validator{
+				Type: "protected_jobs",
+				Name: "test",
+				ProtectedJobs: &config.ProtectedJobs{
+					Selector: &config.Selector{JobIDs: []string{"traefik"}},
+				},
+			},
+			want: &validator.ProtectedJobsValidator{},
+		},
+		{
+			name: "deregister validator",
+			validators: config.Validator{
+				Type: "deregister",
+				Name: "test",
+				Deregister: &config.Deregister{
+					Selector:         &config.Selector{Namespaces: []string{"system"}},
+					AllowStop:        true,
+					OverridePolicies: []string{"ops-admin"},
+				},
+			},
+			want: &validator.DeregisterValidator{},
+		},
+		{
+			name: "deregister validator without deregister block",
+			validators: config.Validator{
+				Type: "deregister",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "disruption validator",
+			validators: config.Validator{
+				Type: "disruption",
+				Name: "test",
+				Disruption: &config.Disruption{
+					Operations:     []string{"alloc_restart"},
+					MaxDisruptions: 5,
+					Window:         "1h",
+				},
+			},
+			want: &validator.DisruptionValidator{},
+		},
+		{
+			name: "disruption validator with invalid window",
+			validators: config.Validator{
+				Type:       "disruption",
+				Name:       "test",
+				Disruption: &config.Disruption{MaxDisruptions: 5, Window: "hourly"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "constraints validator",
+			validators: config.Validator{
+				Type:        "constraints",
+				Name:        "test",
+				Constraints: &config.Constraints{Mode: "warn", CheckCluster: true},
+			},
+			want: &validator.ConstraintValidator{},
+		},
+		{
+			name: "static ports validator",
+			validators: config.Validator{
+				Type: "static_ports",
+				Name: "test",
+				StaticPorts: &config.StaticPorts{
+					AllowedRanges:  []string{"20000-20100"},
+					Namespaces:     []config.StaticPortNamespace{{Name: "prod", AllowedRanges: []string{"30000-30100"}}},
+					CheckAllocated: true,
+				},
+			},
+			want: &validator.StaticPortValidator{},
+		},
+		{
+			name: "static ports validator with invalid range",
+			validators: config.Validator{
+				Type:        "static_ports",
+				Name:        "test",
+				StaticPorts: &config.StaticPorts{AllowedRanges: []string{"high"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "connect validator",
+			validators: config.Validator{
+				Type: "connect",
+				Name: "test",
+				Connect: &config.Connect{
+					RequireSidecar:     true,
+					ServiceNamePattern: "^[a-z-]+$",
+				},
+			},
+			want: &validator.ConnectValidator{},
+		},
+		{
+			name: "connect validator with invalid pattern",
+			validators: config.Validator{
+				Type:    "connect",
+				Name:    "test",
+				Connect: &config.Connect{ServiceNamePattern: "("},
+			},
+			wantErr: true,
+		},
+		{
+			name: "naming validator",
+			validators: config.Validator{
+				Type: "naming",
+				Name: "test",
+				Naming: &config.Naming{
+					DNSCompatible: true,
+					Namespaces:    []config.NamingNamespace{{Name: "prod", ServiceName: "^prod-"}},
+				},
+			},
+			want: &validator.NamingValidator{},
+		},
+		{
+			name: "naming validator with invalid pattern",
+			validators: config.Validator{
+				Type:   "naming",
+				Name:   "test",
+				Naming: &config.Naming{Tag: "("},
+			},
+			wantErr: true,
+		},
+		{
+			name: "template validator",
+			validators: config.Validator{
+				Type: "template",
+				Name: "test",
+				Template: &config.TemplatePolicy{
+					DenyPatterns:         []string{"(?i)password\\s*="},
+					AllowedVaultPrefixes: []string{"kv/data/apps/"},
+					MaxSplay:             "30s",
+					AllowedChangeModes:   []string{"restart"},
+				},
+			},
+			want: &validator.TemplateValidator{},
+		},
+		{
+			name: "template validator with invalid max splay",
+			validators: config.Validator{
+				Type:     "template",
+				Name:     "test",
+				Template: &config.TemplatePolicy{MaxSplay: "soon"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "secrets validator",
+			validators: config.Validator{
+				Type: "secrets",
+				Name: "test",
+				Secrets: &config.Secrets{
+					Mode:        "warn",
+					Patterns:    map[string]string{"internal_token": "int_[a-z0-9]{8}"},
+					AllowedKeys: []string{"CHECKSUM_*"},
+				},
+			},
+			want: &validator.SecretsValidator{},
+		},
+		{
+			name: "secrets validator with invalid pattern",
+			validators: config.Validator{
+				Type:    "secrets",
+				Name:    "test",
+				Secrets: &config.Secrets{Patterns: map[string]string{"broken": "("}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "limits validator",
+			validators: config.Validator{
+				Type: "limits",
+				Name: "test",
+				Limits: &config.Limits{
+					MaxTaskGroups: 10,
+					Namespaces:    []config.LimitsNamespace{{Name: "batch", MaxTasks: 100}},
+				},
+			},
+			want: &validator.LimitsValidator{},
+		},
+		{
+			name: "limits validator without limits block",
+			validators: config.Validator{
+				Type: "limits",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "update validator",
+			validators: config.Validator{
+				Type: "update",
+				Name: "test",
+				Update: &config.Update{
+					Selector:          &config.Selector{Namespaces: []string{"prod"}},
+					MaxParallel:       3,
+					RequireAutoRevert: true,
+				},
+			},
+			want: &validator.UpdateValidator{},
+		},
+		{
+			name: "update validator with invalid selector",
+			validators: config.Validator{
+				Type:   "update",
+				Name:   "test",
+				Update: &config.Update{Selector: &config.Selector{JobIDs: []string{"["}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "devices validator",
+			validators: config.Validator{
+				Type: "devices",
+				Name: "test",
+				Devices: &config.Devices{
+					MaxGPUs:    2,
+					Namespaces: []config.DevicesNamespace{{Name: "ml", MaxGPUs: 8}},
+				},
+			},
+			want: &validator.DeviceValidator{},
+		},
+		{
+			name: "devices validator without devices block",
+			validators: config.Validator{
+				Type: "devices",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "priority validator",
+			validators: config.Validator{
+				Type: "priority",
+				Name: "test",
+				Priority: &config.Priority{
+					Max:        60,
+					Namespaces: []config.PriorityBand{{Name: "batch", Min: 10, Max: 30}},
+					Policies:   []config.PriorityBand{{Name: "operator", Max: 100}},
+				},
+			},
+			want: &validator.PriorityValidator{},
+		},
+		{
+			name: "ownership validator",
+			validators: config.Validator{
+				Type:      "ownership",
+				Name:      "test",
+				Ownership: &config.Ownership{Source: "owners"},
+			},
+			want: &validator.OwnershipValidator{},
+		},
+		{
+			name: "ownership validator with unknown data source",
+			validators: config.Validator{
+				Type:      "ownership",
+				Name:      "test",
+				Ownership: &config.Ownership{Source: "teams"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "ownership validator without ownership block",
+			validators: config.Validator{
+				Type: "ownership",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "periodic validator",
+			validators: config.Validator{
+				Type: "periodic",
+				Name: "test",
+				Periodic: &config.Periodic{
+					MinInterval:            "15m",
+					RequireProhibitOverlap: true,
+				},
+			},
+			want: &validator.PeriodicValidator{},
+		},
+		{
+			name: "periodic validator with invalid min interval",
+			validators: config.Validator{
+				Type:     "periodic",
+				Name:     "test",
+				Periodic: &config.Periodic{MinInterval: "often"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "volumes validator",
+			validators: config.Validator{
+				Type: "volumes",
+				Name: "test",
+				Volumes: &config.Volumes{
+					AllowedSources: []string{"shared-*"},
+					ReadOnly:       true,
+					Namespaces:     []config.VolumesNamespace{{Name: "data", AllowedPlugins: []string{"ebs"}}},
+				},
+			},
+			want: &validator.VolumeValidator{},
+		},
+		{
+			name: "volumes validator with invalid source pattern",
+			validators: config.Validator{
+				Type:    "volumes",
+				Name:    "test",
+				Volumes: &config.Volumes{AllowedSources: []string{"["}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "placement validator",
+			validators: config.Validator{
+				Type: "placement",
+				Name: "test",
+				Placement: &config.PlacementAllowlist{
+					AllowedDatacenters: []string{"eu-*"},
+					AllowedNodePools:   []string{"default"},
+					Namespaces:         []config.PlacementNamespace{{Name: "gpu", AllowedNodePools: []string{"gpu"}}},
+				},
+			},
+			want: &validator.PlacementValidator{},
+		},
+		{
+			name: "placement validator without placement block",
+			validators: config.Validator{
+				Type: "placement",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "workload identity validator",
+			validators: config.Validator{
+				Type: "workload_identity",
+				Name: "test",
+				WorkloadIdentity: &config.WorkloadIdentity{
+					AllowedAudiences: []string{"vault.io"},
+					MaxTTL:           "1h",
+					ForbidEnv:        true,
+				},
+			},
+			want: &validator.IdentityValidator{},
+		},
+		{
+			name: "workload identity validator with invalid max ttl",
+			validators: config.Validator{
+				Type:             "workload_identity",
+				Name:             "test",
+				WorkloadIdentity: &config.WorkloadIdentity{MaxTTL: "forever"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid validator type",
+			validators: config.Validator{
+
+				Type: "invalid",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:    "errors = data.dummy.errors",
+					Filename: testutil.Filepath(t, "opa/errors.rego"),
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Config{
+				Nomad:       &config.NomadServer{Address: "http://localhost:4646"},
+				Validators:  []config.Validator{tc.validators},
+				DataSources: []config.DataSource{{Type: "file", Name: "owners", Path: "owners.json"}},
+			}
+
+			validators, _, err := BuildValidators(c, hclog.NewNullLogger())
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.IsType(t, tc.want, validators[0])
+
+		})
+
+	}
+}
+
+func TestNotationValidatorConfig(t *testing.T) {
+
+	policyDir := t.TempDir()
+
+	policyJson := `
+	{
+		"version": "1.0",
+		"trustPolicies": [
+			{
+				"name": "wabbit-networks-images",
+				"registryScopes": [ "*" ],
+				"signatureVerification": {
+					"level" : "strict"
+				},
+				"trustStores": [ "ca:wabbit-networks.io" ],
+				"trustedIdentities": [
+					"*"
+				]
+			}
+		]
+	}`
+
+	policyPath := fmt.Sprintf("%s/policy.json", policyDir)
+	err := os.WriteFile(policyPath, []byte(policyJson), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truststoreDir := t.TempDir()
+
+	c := &config.Config{
+		Validators: []config.Validator{
+			{
+
+				Type: "notation",
+				Name: "test",
+				Notation: &config.NotationVerifierConfig{
+					TrustPolicyFile: policyPath,
+					TrustStoreDir:   truststoreDir,
+					RepoPlainHTTP:   true,
+					MaxSigAttempts:  1,
+				},
+			},
+		},
+	}
+
+	validators, _, err := BuildValidators(c, hclog.NewNullLogger())
+
+	assert.NoError(t, err)
+	assert.IsType(t, &validator.NotationValidator{}, validators[0])
+
+}
+
+func TestBuildMutators(t *testing.T) {
+	tt := []struct {
+		name     string
+		mutators config.Mutator
+		want     admissionctrl.JobMutator
+		wantErr  bool
+	}{
+		{
+			name: "opa json patch mutator",
+			mutators: config.Mutator{
+
+				Type: "opa_json_patch",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:    "errors = data.dummy.errors",
+					Filename: testutil.Filepath(t, "opa/errors.rego"),
+				},
+			},
+			want: &mutator.OpaJsonPatchMutator{},
+		},
+		{
+			name: "webhook json patch mutator",
+			mutators: config.Mutator{
+
+				Type: "json_patch_webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+			},
+			want: &mutator.JsonPatchWebhookMutator{},
+		},
+		{
+			name: "consul intentions mutator",
+			mutators: config.Mutator{
+				Type:             "consul_intentions",
+				Name:             "test",
+				ConsulIntentions: &config.ConsulIntentions{DryRun: true},
+			},
+			want: &mutator.ConsulIntentionsMutator{},
+		},
+		{
+			name: "placement mutator",
+			mutators: config.Mutator{
+				Type: "placement",
+				Name: "test",
+				Placement: &config.Placement{
+					Selector: &config.Selector{Namespaces: []string{"tenant-a"}},
+					NodePool: "tenant-a",
+					Spreads: []config.Spread{{
+						Attribute: "${node.datacenter}",
+						Weight:    50,
+						Targets:   []config.SpreadTarget{{Value: "dc1", Percent: 50}},
+					}},
+				},
+			},
+			want: &mutator.PlacementMutator{},
+		},
+		{
+			name: "placement mutator with invalid spread weight",
+			mutators: config.Mutator{
+				Type:      "placement",
+				Name:      "test",
+				Placement: &config.Placement{Spreads: []config.Spread{{Attribute: "${node.datacenter}", Weight: 200}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "devices mutator",
+			mutators: config.Mutator{
+				Type: "devices",
+				Name: "test",
+				Devices: &config.DeviceInjection{
+					Vendors: []config.DeviceVendor{{Name: "nvidia", Env: map[string]string{"NVIDIA_DRIVER_CAPABILITIES": "compute,utility"}}},
+				},
+			},
+			want: &mutator.DeviceMutator{},
+		},
+		{
+			name: "priority mutator",
+			mutators: config.Mutator{
+				Type:     "priority",
+				Name:     "test",
+				Priority: &config.Priority{Min: 1, Max: 60},
+			},
+			want: &mutator.PriorityMutator{},
+		},
+		{
+			name: "priority mutator without priority block",
+			mutators: config.Mutator{
+				Type: "priority",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "meta mutator",
+			mutators: config.Mutator{
+				Type: "meta",
+				Name: "test",
+				Meta: &config.MetaStandard{
+					Keys:       []config.MetaKey{{Name: "owner", Required: true, From: "identity"}, {Name: "team", From: "data:owners.{owner}.team"}},
+					Namespaces: []config.MetaNamespace{{Name: "sandbox", Required: []string{}}},
+				},
+			},
+			want: &mutator.MetaMutator{},
+		},
+		{
+			name: "meta mutator without meta block",
+			mutators: config.Mutator{
+				Type: "meta",
+				Name: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "meta mutator with invalid from",
+			mutators: config.Mutator{
+				Type: "meta",
+				Name: "test",
+				Meta: &config.MetaStandard{Keys: []config.MetaKey{{Name: "owner", From: "token"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "scoped mutator",
+			mutators: config.Mutator{
+				Type: "json_patch_webhook",
+				Name: "test",
+				Webhook: &config.Webhook{
+					Endpoint: "http://example.com",
+					Method:   "PUT",
+				},
+				Jobs: &config.Jobs{Include: []string{"web-*"}},
+			},
+			want: &admissionctrl.ScopedMutator{},
+		},
+		{
+			name: "invalid mutator type",
+			mutators: config.Mutator{
+
+				Type: "invalid",
+				Name: "test",
+				OpaRule: &config.OpaRule{
+					Query:    "errors = data.dummy.errors",
+					Filename: testutil.Filepath(t, "opa/errors.rego"),
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Config{
+				Mutators: []config.Mutator{tc.mutators},
+			}
+
+			mutators, _, err := BuildMutators(c, hclog.NewNullLogger())
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.IsType(t, tc.want, mutators[0])
+
+		})
+
+	}
+}
+
+func TestBuildReadRules(t *testing.T) {
+	rules, err := BuildReadRules(&config.Config{ReadRules: []config.ReadRule{{
+		Name:         "namespaces",
+		Paths:        []string{"/v1/allocation/*"},
+		OpaRule:      &config.OpaRule{Query: "errors = data.reads.errors", Filename: testutil.Filepath(t, "opa/validators/reads.rego")},
+		ResolveToken: true,
+	}}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "namespaces", rules[0].Validator.Name())
+	assert.Equal(t, []string{"/v1/allocation/*"}, rules[0].Paths)
+	assert.True(t, rules[0].ResolveToken)
+
+	_, err = BuildReadRules(&config.Config{ReadRules: []config.ReadRule{{
+		Name:    "missing",
+		OpaRule: &config.OpaRule{Query: "errors = data.reads.errors", Filename: "missing.rego"},
+	}}}, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "failed to create read rule missing")
+}
+
+func TestBuildVendingPolicies(t *testing.T) {
+	policies, err := BuildVendingPolicies(&config.Config{TokenVending: &config.TokenVending{Roles: []config.VendingRole{
+		{Name: "deploy-app", OpaRule: &config.OpaRule{Query: "errors = data.vending.errors", Filename: testutil.Filepath(t, "opa/validators/vending.rego")}},
+		{Name: "deploy-infra"},
+	}}}, hclog.NewNullLogger())
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+
+	payload := func(ref string) *types.Payload {
+		return &types.Payload{Context: &config.RequestContext{
+			Operation:      config.OperationTokenVending,
+			IdentityClaims: map[string]string{"ref": ref},
+		}}
+	}
+	_, err = policies["deploy-app"].Validate(payload("refs/heads/main"))
+	assert.NoError(t, err)
+	_, err = policies["deploy-app"].Validate(payload("refs/heads/feature"))
+	assert.ErrorContains(t, err, "refs/heads/feature may not deploy")
+
+	_, err = BuildVendingPolicies(&config.Config{TokenVending: &config.TokenVending{Roles: []config.VendingRole{
+		{Name: "missing", OpaRule: &config.OpaRule{Query: "errors = data.vending.errors", Filename: "missing.rego"}},
+	}}}, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "failed to create policy of token_vending role missing")
+}
+
+func TestLoadCalendars(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "holidays.txt")
+	require.NoError(t, os.WriteFile(file, []byte("# christmas\n2024-12-25\n\n2024-12-26\n"), 0644))
+
+	calendars, err := loadCalendars([]config.Calendar{
+		{Name: "holidays", Dates: []string{"2024-01-01"}, File: file},
+		{Name: "freeze", Dates: []string{"2024-12-24"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"holidays": {"2024-01-01", "2024-12-25", "2024-12-26"},
+		"freeze":   {"2024-12-24"},
+	}, calendars)
+
+	_, err = loadCalendars([]config.Calendar{{Name: "broken", Dates: []string{"24.12.2024"}}})
+	assert.ErrorContains(t, err, "invalid date")
+}
@@ -0,0 +1,41 @@
+package admission
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+
+	"github.com/mxab/nacp/admissionctrl"
+	"github.com/mxab/nacp/config"
+)
+
+// ruleVersionLength is the number of hex characters kept of the sha256 hash.
+const ruleVersionLength = 12
+
+// RuleVersions computes a version per configured rule from its config block and the content of its policy file.
+func RuleVersions(c *config.Config) admissionctrl.RuleVersions {
+	versions := admissionctrl.RuleVersions{
+		Mutators:   make(map[string]string, len(c.Mutators)),
+		Validators: make(map[string]string, len(c.Validators)),
+	}
+	for _, m := range c.Mutators {
+		versions.Mutators[m.Name] = ruleVersion(m, m.OpaRule)
+	}
+	for _, v := range c.Validators {
+		versions.Validators[v.Name] = ruleVersion(v, v.OpaRule)
+	}
+	return versions
+}
+
+func ruleVersion(block interface{}, opaRule *config.OpaRule) string {
+	h := sha256.New()
+	data, _ := json.Marshal(block)
+	h.Write(data)
+	if opaRule != nil {
+		if policy, err := os.ReadFile(opaRule.Filename); err == nil {
+			h.Write(policy)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:ruleVersionLength]
+}
@@ -0,0 +1,39 @@
+package admission
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxab/nacp/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleVersions(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.rego")
+	require.NoError(t, os.WriteFile(policyFile, []byte("package one"), 0644))
+
+	c := config.DefaultConfig()
+	c.Validators = []config.Validator{
+		{Type: "opa", Name: "policy", OpaRule: &config.OpaRule{Filename: policyFile, Query: "errors = data.one.errors"}},
+		{Type: "webhook", Name: "hook", Webhook: &config.Webhook{Endpoint: "http://localhost", Method: "POST"}},
+	}
+	c.Mutators = []config.Mutator{
+		{Type: "json_patch_webhook", Name: "hook", Webhook: &config.Webhook{Endpoint: "http://localhost", Method: "POST"}},
+	}
+
+	first := RuleVersions(c)
+	assert.Len(t, first.Validators["policy"], 12)
+	assert.Len(t, first.Validators["hook"], 12)
+	assert.Len(t, first.Mutators["hook"], 12)
+	assert.Equal(t, first, RuleVersions(c), "versions are stable")
+
+	require.NoError(t, os.WriteFile(policyFile, []byte("package two"), 0644))
+	second := RuleVersions(c)
+	assert.NotEqual(t, first.Validators["policy"], second.Validators["policy"], "policy file change changes the version")
+	assert.Equal(t, first.Validators["hook"], second.Validators["hook"], "other rules keep their version")
+
+	c.Validators[1].Webhook.Method = "PUT"
+	assert.NotEqual(t, first.Validators["hook"], RuleVersions(c).Validators["hook"], "config change changes the version")
+}
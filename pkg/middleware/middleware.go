@@ -0,0 +1,75 @@
+// Package middleware composes the handler chain of the NACP proxy by stage.
+// Programs embedding the proxy import it to add their own middlewares, e.g. authentication or auditing.
+package middleware
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Middleware wraps the next handler of the proxy's handler chain.
+type Middleware func(next http.Handler) http.Handler
+
+// Stage orders the middlewares of the proxy, requests pass the stages in ascending order and reach Nomad last.
+// Middlewares of the same stage run in the order they were added, the built-in ones first.
+type Stage int
+
+const (
+	// StageNetwork rejects clients by their address before they are authenticated, e.g. the network ACL
+	StageNetwork Stage = 50
+	// StageAuth authenticates the caller, e.g. the OIDC login
+	StageAuth Stage = 100
+	// StageRateLimit limits the requests in flight, e.g. the admission queue
+	StageRateLimit Stage = 200
+	// StageAccess rejects requests before any work is done, e.g. CORS and maintenance mode
+	StageAccess Stage = 300
+	// StageAudit builds the request context of the rules and logs the request
+	StageAudit Stage = 400
+	// StageAdmission applies the rules to jobs and runs the interceptors
+	StageAdmission Stage = 500
+)
+
+// Entry is a named middleware of a stage.
+type Entry struct {
+	Stage      Stage
+	Name       string
+	Middleware Middleware
+}
+
+// Stack composes the middlewares of the proxy by stage.
+type Stack struct {
+	entries []Entry
+}
+
+// Use adds a middleware to the stage.
+func (s *Stack) Use(stage Stage, name string, middleware Middleware) {
+	s.entries = append(s.entries, Entry{Stage: stage, Name: name, Middleware: middleware})
+}
+
+// Names returns the names of the middlewares in the order requests pass them.
+func (s *Stack) Names() []string {
+	entries := s.sorted()
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	return names
+}
+
+// Handler chains the middlewares in front of the final handler.
+func (s *Stack) Handler(final http.Handler) http.Handler {
+	entries := s.sorted()
+	handler := final
+	for i := len(entries) - 1; i >= 0; i-- {
+		handler = entries[i].Middleware(handler)
+	}
+	return handler
+}
+
+func (s *Stack) sorted() []Entry {
+	entries := slices.Clone(s.entries)
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		return int(a.Stage - b.Stage)
+	})
+	return entries
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recording appends its name to the order before calling the next handler.
+func recording(name string, order *[]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*order = append(*order, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestStack(t *testing.T) {
+	var order []string
+	stack := &Stack{}
+	stack.Use(StageAdmission, "admission", recording("admission", &order))
+	stack.Use(StageAuth, "auth", recording("auth", &order))
+	stack.Use(StageAudit, "audit", recording("audit", &order))
+	stack.Use(StageAuth, "second auth", recording("second auth", &order))
+
+	assert.Equal(t, []string{"auth", "second auth", "audit", "admission"}, stack.Names())
+
+	handler := stack.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "proxy")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/jobs", nil))
+	assert.Equal(t, []string{"auth", "second auth", "audit", "admission", "proxy"}, order)
+}
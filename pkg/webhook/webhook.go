@@ -0,0 +1,122 @@
+// Package webhook contains the JSON contract between NACP and webhook validators and mutators.
+// External webhook implementations can import it instead of copying the types.
+//
+// The contract is versioned, fields are only added within a version and never renamed or removed.
+// The version is sent in the NACP-Contract-Version header of every webhook request.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Version of the contract.
+const Version = "v1"
+
+// Headers set on every webhook request.
+const (
+	HeaderContractVersion = "NACP-Contract-Version"
+	HeaderClientIP        = "NACP-Client-IP"
+	HeaderAccessorID      = "NACP-Accessor-ID"
+)
+
+// Request is the body sent to validation and mutation webhooks.
+type Request struct {
+	Job     *api.Job `json:"job"`
+	Context *Context `json:"context,omitempty"`
+	// Data holds the content of the configured data sources by name
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Context describes the request that submitted the job.
+type Context struct {
+	// Operation is one of register, plan, validate, deregister, alloc_restart, alloc_stop, evaluate, periodic_force or read
+	Operation    string            `json:"operation,omitempty"`
+	ClientIP     string            `json:"clientIP"`
+	AccessorID   string            `json:"accessorID"`
+	ResolveToken bool              `json:"resolveToken"`
+	TokenInfo    *api.ACLToken     `json:"tokenInfo,omitempty"`
+	Identity     string            `json:"identity,omitempty"`
+	Groups       []string          `json:"groups,omitempty"`
+	Method       string            `json:"method,omitempty"`
+	Path         string            `json:"path,omitempty"`
+	Policies     []string          `json:"policies,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	// Namespace the job is written to, NamespaceSource is one of query, header, request or job
+	Namespace       string `json:"namespace,omitempty"`
+	NamespaceSource string `json:"namespaceSource,omitempty"`
+	// IdempotencyToken, EnforceIndex and JobModifyIndex of the submission, EnforceIndex is only set for check-and-set registers
+	IdempotencyToken string `json:"idempotencyToken,omitempty"`
+	EnforceIndex     bool   `json:"enforceIndex,omitempty"`
+	JobModifyIndex   uint64 `json:"jobModifyIndex,omitempty"`
+	// Purge is set if a deregistered job is purged instead of only stopped
+	Purge bool `json:"purge,omitempty"`
+	// AllocID of an allocation restart or stop
+	AllocID string `json:"allocID,omitempty"`
+	// PolicyRules are the rules of the token's policies by name, only set if the token_cache resolves policies
+	PolicyRules map[string]string `json:"policyRules,omitempty"`
+	// CertPolicies are the virtual policies of the client certificate, they are also part of the Policies
+	CertPolicies []string `json:"certPolicies,omitempty"`
+	// IdentityClaims are the values of the identity claim_headers set by a trusted proxy
+	IdentityClaims map[string]string `json:"identityClaims,omitempty"`
+}
+
+// ValidationResponse is returned by validation webhooks, any error rejects the job.
+type ValidationResponse struct {
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+	// Infos are advice that is shown with a lower severity than warnings
+	Infos []string `json:"infos,omitempty"`
+	// Results are findings with details, results with the severity error reject the job like errors
+	Results []Result `json:"results,omitempty"`
+}
+
+// Result is a finding of a validation webhook with the job field it refers to and a link explaining it.
+type Result struct {
+	// Severity is error, warning or info, an empty severity is an error
+	Severity string `json:"severity,omitempty"`
+	Message  string `json:"message"`
+	// Field is the path of the job field, e.g. TaskGroups[0].Count
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code,omitempty"`
+	DocsURL string `json:"docsURL,omitempty"`
+}
+
+// PatchResponse is returned by JSON patch mutation webhooks, the patch is applied to the job.
+type PatchResponse struct {
+	Patch    []PatchOperation `json:"patch"`
+	Warnings []string         `json:"warnings"`
+	Errors   []string         `json:"errors"`
+}
+
+// PatchOperation is a RFC 6902 JSON patch operation.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+	From  string      `json:"from,omitempty"`
+}
+
+// A plain mutation webhook responds with the complete mutated job, i.e. an api.Job.
+
+// DefaultMaxResponseSize bounds the size of a webhook response unless configured otherwise.
+const DefaultMaxResponseSize = 1 << 20
+
+// DecodeResponse decodes a response of at most maxSize into v, larger responses are rejected
+// without being read completely, so a misbehaving endpoint can't exhaust the memory of NACP.
+func DecodeResponse(body io.Reader, maxSize int64, v interface{}) error {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxResponseSize
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > maxSize {
+		return fmt.Errorf("webhook response exceeds the limit of %d bytes", maxSize)
+	}
+	return json.Unmarshal(data, v)
+}
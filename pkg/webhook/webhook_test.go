@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/mxab/nacp/admissionctrl/types"
+	"github.com/mxab/nacp/config"
+	"github.com/mxab/nacp/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readGolden(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(testutil.Filepath(t, "webhook/"+name))
+	require.NoError(t, err)
+	return data
+}
+
+// roundTrip decodes the golden file into v and checks that encoding and decoding it again is lossless.
+func roundTrip(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal(readGolden(t, name), v))
+
+	encoded, err := json.Marshal(v)
+	require.NoError(t, err)
+	again := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+	require.NoError(t, json.Unmarshal(encoded, again))
+	assert.Equal(t, v, again)
+}
+
+func TestRequestV1(t *testing.T) {
+	var request Request
+	roundTrip(t, "request_v1.json", &request)
+
+	assert.Equal(t, "example", *request.Job.ID)
+	assert.Equal(t, "register", request.Context.Operation)
+	assert.Equal(t, []string{"deploy"}, request.Context.TokenInfo.Policies)
+	assert.Equal(t, []string{"developers"}, request.Context.Groups)
+	assert.Equal(t, "/v1/jobs", request.Context.Path)
+	assert.Equal(t, "nomad", request.Context.Headers["User-Agent"])
+	assert.Equal(t, "query", request.Context.NamespaceSource)
+	assert.Equal(t, uint64(42), request.Context.JobModifyIndex)
+	assert.Contains(t, request.Data, "teams")
+}
+
+func TestValidationResponseV1(t *testing.T) {
+	var response ValidationResponse
+	roundTrip(t, "validation_response_v1.json", &response)
+	assert.JSONEq(t, string(readGolden(t, "validation_response_v1.json")), toJSON(t, response))
+	assert.Equal(t, ValidationResponse{Errors: []string{"job must have an owner"}, Warnings: []string{"count is high"}, Infos: []string{"consider a canary"}}, response)
+}
+
+func TestPatchResponseV1(t *testing.T) {
+	var response PatchResponse
+	roundTrip(t, "patch_response_v1.json", &response)
+	assert.JSONEq(t, string(readGolden(t, "patch_response_v1.json")), toJSON(t, response))
+	assert.Equal(t, PatchOperation{Op: "move", Path: "/Meta/team", From: "/Meta/group"}, response.Patch[2])
+}
+
+// TestRequestMatchesPayload makes sure the contract stays in sync with the payload NACP sends.
+// Every field of the request context is set, so a field missing in the Context fails the test.
+func TestRequestMatchesPayload(t *testing.T) {
+	id := "example"
+	reqCtx := &config.RequestContext{}
+	populate(reflect.ValueOf(reqCtx).Elem())
+	payload := &types.Payload{
+		Job:     &api.Job{ID: &id},
+		Context: reqCtx,
+		Data:    map[string]interface{}{"teams": map[string]interface{}{}},
+	}
+	sent, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	var fields map[string]map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(sent, &fields))
+	assert.Len(t, fields["context"], reflect.TypeOf(config.RequestContext{}).NumField(), "every field of the request context is sent")
+
+	var request Request
+	require.NoError(t, json.Unmarshal(sent, &request))
+	received, err := json.Marshal(request)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(sent), string(received))
+}
+
+// populate sets the exported fields of v to non-zero values, structs with unexported fields like time.Time are left zero.
+func populate(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		populate(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		populate(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key := reflect.New(v.Type().Key()).Elem()
+		populate(key)
+		value := reflect.New(v.Type().Elem()).Elem()
+		populate(value)
+		v.SetMapIndex(key, value)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				populate(v.Field(i))
+			}
+		}
+	}
+}
+
+func toJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		maxSize int64
+		wantErr string
+	}{
+		{name: "within limit", body: `{"errors": ["no owner"]}`, maxSize: 1024},
+		{name: "exactly the limit", body: `{"errors": ["no owner"]}`, maxSize: 24},
+		{name: "oversized", body: `{"errors": ["no owner"]}`, maxSize: 10, wantErr: "webhook response exceeds the limit of 10 bytes"},
+		{name: "default limit", body: `{"errors": ["` + strings.Repeat("x", DefaultMaxResponseSize) + `"]}`, wantErr: "webhook response exceeds the limit of 1048576 bytes"},
+		{name: "invalid json", body: `{"errors":`, maxSize: 1024, wantErr: "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response ValidationResponse
+			err := DecodeResponse(strings.NewReader(tt.body), tt.maxSize, &response)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"no owner"}, response.Errors)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package data_sources
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+errors contains msg if {
+	not input.job.Meta.team in data.sources.teams
+	msg := sprintf("unknown team %v", [input.job.Meta.team])
+}
+
+errors contains msg if {
+	input.data
+	msg := "data sources must not be part of the input"
+}
@@ -0,0 +1,16 @@
+package library
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+errors contains msg if {
+	some image in data.nacp.lib.images.all
+	data.nacp.lib.images.latest(image)
+	msg := sprintf("image %v must not use the latest tag", [image])
+}
+
+warnings contains msg if {
+	data.nacp.lib.resources.job_memory > data.nacp.lib.resources.to_mb("1GiB")
+	msg := "job needs more than 1GiB of memory"
+}
@@ -0,0 +1,22 @@
+package network
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+errors contains msg if {
+	input.job.Namespace == "prod"
+	not nacp.ip_in_cidrs(input.context.clientIP, ["10.1.0.0/16", "fd00::/8"])
+	msg := sprintf("%v may not deploy to prod", [input.context.clientIP])
+}
+
+warnings contains msg if {
+	names := nacp.reverse_dns(input.context.clientIP)
+	not endswith_any(names, ".ci.example.com")
+	msg := "job was not submitted from a CI runner"
+}
+
+endswith_any(names, suffix) if {
+	some name in names
+	endswith(name, suffix)
+}
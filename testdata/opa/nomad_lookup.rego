@@ -0,0 +1,21 @@
+package nomad_lookup
+
+import future.keywords.contains
+import future.keywords.if
+
+errors contains msg if {
+	not nomad.namespace(input.job.Namespace)
+	msg := sprintf("namespace %v does not exist", [input.job.Namespace])
+}
+
+errors contains msg if {
+	pool := nomad.node_pool(input.job.NodePool)
+	pool.Meta.frozen == "true"
+	msg := sprintf("node pool %v is frozen", [input.job.NodePool])
+}
+
+warnings contains msg if {
+	existing := nomad.job(input.job.Namespace, input.job.ID)
+	existing.Meta.owner != input.job.Meta.owner
+	msg := "job owner changed"
+}
@@ -0,0 +1,15 @@
+package registries
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+allowed_registries := {sprintf("registry-%d.example.com", [i]) | some i in numbers.range(1, 2000)}
+
+errors contains msg if {
+	some group in input.job.TaskGroups
+	some task in group.Tasks
+	registry := split(task.Config.image, "/")[0]
+	not registry in allowed_registries
+	msg := sprintf("registry %s of task %s is not allowed", [registry, task.Name])
+}
@@ -0,0 +1,21 @@
+package time_window
+
+import future.keywords.contains
+import future.keywords.if
+
+errors contains msg if {
+	input.job.Namespace == "prod"
+	nacp.in_calendar("holidays", nacp.now().date)
+	msg := "no prod deployments on holidays"
+}
+
+errors contains msg if {
+	input.job.Namespace == "prod"
+	not nacp.time_between("08:00", "18:00")
+	msg := sprintf("no prod deployments at %02d:%02d %v", [nacp.now().hour, nacp.now().minute, nacp.now().timezone])
+}
+
+warnings contains msg if {
+	nacp.time_between("22:00", "06:00")
+	msg := "deploying at night"
+}
@@ -2,6 +2,7 @@ package context
 
 import future.keywords.contains
 import future.keywords.if
+import future.keywords.in
 
 # IP validation
 errors contains msg if {
@@ -25,4 +26,16 @@ warnings[msg] {
     policy = input.context.tokenInfo.Policies[_]
     warn_policy[policy]
     msg := sprintf("Debug: TokenInfo: %v", [input.context.tokenInfo])
-}
\ No newline at end of file
+}
+# Policies of the resolved token
+errors contains msg if {
+    "nomad_reject_flat" in input.context.policies
+    msg := "Policy nomad_reject_flat is not allowed"
+}
+
+# Request path and headers
+errors contains msg if {
+    input.context.operation == "register"
+    startswith(input.context.headers["User-Agent"], "curl/")
+    msg := sprintf("%v %v must not be registered with curl", [input.context.method, input.context.path])
+}
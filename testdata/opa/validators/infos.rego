@@ -0,0 +1,14 @@
+package infos
+
+import future.keywords.contains
+import future.keywords.if
+
+infos contains msg if {
+	input.job.Priority > 50
+	msg := "priorities above 50 are reserved for platform jobs"
+}
+
+warnings contains msg if {
+	input.job.Priority > 80
+	msg := "priority is high"
+}
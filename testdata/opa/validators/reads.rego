@@ -0,0 +1,15 @@
+package reads
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+ops if "ops" in input.context.policies
+
+# Only holders of the ops policy read other namespaces than default
+errors contains msg if {
+    input.context.operation == "read"
+    input.context.namespace != "default"
+    not ops
+    msg := sprintf("reading namespace %v requires the ops policy", [input.context.namespace])
+}
@@ -0,0 +1,20 @@
+package results
+
+import future.keywords.contains
+import future.keywords.if
+
+errors contains result if {
+	some i
+	input.job.TaskGroups[i].Count < 2
+	result := {
+		"message": "count must be at least 2",
+		"field": sprintf("TaskGroups[%d].Count", [i]),
+		"code": "min_count",
+		"docs_url": "https://example.com/count",
+	}
+}
+
+warnings contains msg if {
+	input.job.Priority > 80
+	msg := "priority is high"
+}
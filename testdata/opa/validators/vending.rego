@@ -0,0 +1,11 @@
+package vending
+
+import future.keywords.contains
+import future.keywords.if
+
+# Only pipelines of the main branch get a token
+errors contains msg if {
+    input.context.operation == "token_vending"
+    input.context.identityClaims.ref != "refs/heads/main"
+    msg := sprintf("%v may not deploy", [input.context.identityClaims.ref])
+}